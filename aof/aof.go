@@ -10,6 +10,7 @@ import (
 	"github.com/Allen9012/Godis/godis/parser"
 	"github.com/Allen9012/Godis/godis/protocol"
 	"github.com/Allen9012/Godis/interface/database"
+	"github.com/Allen9012/Godis/latency"
 	"github.com/Allen9012/Godis/lib/logger"
 	"github.com/Allen9012/Godis/lib/utils"
 
@@ -19,6 +20,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -193,6 +195,12 @@ type Persister struct {
 	listeners  map[Listener]struct{}
 	// reuse cmdLine buffer
 	buffer []CmdLine
+	// rewriting is 1 while Rewrite is in progress
+	rewriting int32
+	// lastWriteFailed is 1 if the last write into aof file failed
+	lastWriteFailed int32
+	// fsyncRunning is true after the fsyncEverySecond goroutine started
+	fsyncRunning bool
 }
 
 // NewPersister creates a new aof.Persister
@@ -220,6 +228,7 @@ func NewPersister(db database.DBEngine, filename string, load bool, fsync string
 	persister.cancel = cancel
 	// fsync every second if needed
 	if persister.aofFsync == FsyncEverySec {
+		persister.fsyncRunning = true
 		persister.fsyncEverySecond()
 	}
 	// start aof goroutine to write aof file in background and fsync periodically if needed (see fsyncEverySecond)
@@ -308,8 +317,13 @@ func (persister *Persister) fsyncEverySecond() {
 			select {
 			case <-ticker.C:
 				persister.pausingAof.Lock()
-				if err := persister.aofFile.Sync(); err != nil {
-					logger.Errorf("fsync failed: %v", err)
+				// appendfsync may be changed by CONFIG SET
+				if persister.aofFsync == FsyncEverySec {
+					start := time.Now()
+					if err := persister.aofFile.Sync(); err != nil {
+						logger.Errorf("fsync failed: %v", err)
+					}
+					latency.AddSampleIfNeeded(latency.EventAofFsyncEverySec, time.Since(start))
 				}
 				persister.pausingAof.Unlock()
 			case <-persister.ctx.Done():
@@ -359,16 +373,51 @@ func (persister *Persister) writeAof(p *payload) {
 	_, err := persister.aofFile.Write(data)
 	if err != nil {
 		logger.Warn(err)
+		atomic.StoreInt32(&persister.lastWriteFailed, 1)
+	} else {
+		atomic.StoreInt32(&persister.lastWriteFailed, 0)
 	}
 	// 对其他的节点执行callback
 	for listener := range persister.listeners {
 		listener.Callback(persister.buffer)
 	}
 	if persister.aofFsync == FsyncAlways {
+		start := time.Now()
 		_ = persister.aofFile.Sync()
+		latency.AddSampleIfNeeded(latency.EventAofFsyncAlways, time.Since(start))
 	}
 }
 
+// SetFsync changes the fsync strategy during runtime
+func (persister *Persister) SetFsync(fsync string) {
+	persister.pausingAof.Lock()
+	defer persister.pausingAof.Unlock()
+	persister.aofFsync = strings.ToLower(fsync)
+	if persister.aofFsync == FsyncEverySec && !persister.fsyncRunning {
+		persister.fsyncRunning = true
+		persister.fsyncEverySecond()
+	}
+}
+
+// IsRewriting returns whether aof rewriting is in progress
+func (persister *Persister) IsRewriting() bool {
+	return atomic.LoadInt32(&persister.rewriting) == 1
+}
+
+// LastWriteOK returns whether the last write into aof file succeeded
+func (persister *Persister) LastWriteOK() bool {
+	return atomic.LoadInt32(&persister.lastWriteFailed) == 0
+}
+
+// FileSize returns the size of aof file
+func (persister *Persister) FileSize() int64 {
+	info, err := os.Stat(persister.aofFilename)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
 // RemoveListener removes a listener from aof server, so we can close the listener
 func (persister *Persister) RemoveListener(listener Listener) {
 	persister.pausingAof.Lock()
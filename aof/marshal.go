@@ -5,6 +5,7 @@ import (
 	List "github.com/Allen9012/Godis/datastruct/list"
 	"github.com/Allen9012/Godis/datastruct/set"
 	SortedSet "github.com/Allen9012/Godis/datastruct/sortedset"
+	Stream "github.com/Allen9012/Godis/datastruct/stream"
 	"github.com/Allen9012/Godis/godis/protocol"
 	"github.com/Allen9012/Godis/interface/database"
 	"strconv"
@@ -28,7 +29,7 @@ func MakeExpireCmd(key string, expireAt time.Time) *protocol.MultiBulkReply {
 	return protocol.MakeMultiBulkReply(args)
 }
 
-// EntityToCmd serialize data entity to godis command
+// EntityToCmd serialize data entity to godis command, stream needs several commands and should use EntityToCmds
 func EntityToCmd(key string, entity *database.DataEntity) *protocol.MultiBulkReply {
 	if entity == nil {
 		return nil
@@ -49,6 +50,21 @@ func EntityToCmd(key string, entity *database.DataEntity) *protocol.MultiBulkRep
 	return cmd
 }
 
+// EntityToCmds serialize data entity to godis commands
+func EntityToCmds(key string, entity *database.DataEntity) []*protocol.MultiBulkReply {
+	if entity == nil {
+		return nil
+	}
+	if stream, ok := entity.Data.(*Stream.Stream); ok {
+		return streamToCmds(key, stream)
+	}
+	cmd := EntityToCmd(key, entity)
+	if cmd == nil {
+		return nil
+	}
+	return []*protocol.MultiBulkReply{cmd}
+}
+
 var setCmd = []byte("SET")
 
 func stringToCmd(key string, bytes []byte) *protocol.MultiBulkReply {
@@ -121,3 +137,70 @@ func zSetToCmd(key string, zset *SortedSet.SortedSet) *protocol.MultiBulkReply {
 	})
 	return protocol.MakeMultiBulkReply(args)
 }
+
+var (
+	xAddCmd   = []byte("XADD")
+	xSetIDCmd = []byte("XSETID")
+	xGroupCmd = []byte("XGROUP")
+	xClaimCmd = []byte("XCLAIM")
+)
+
+// streamToCmds
+//
+//	@Description: XADD 每个 entry, 然后 XSETID 恢复元信息, 最后恢复 consumer group 和 PEL
+//	空 stream 通过 XADD MAXLEN 0 创建
+//	@param key
+//	@param stream
+//	@return []*protocol.MultiBulkReply
+func streamToCmds(key string, stream *Stream.Stream) []*protocol.MultiBulkReply {
+	keyBytes := []byte(key)
+	cmds := make([]*protocol.MultiBulkReply, 0, stream.Len()+2)
+	stream.ForEach(func(entry *Stream.Entry) bool {
+		args := make([][]byte, 0, 3+len(entry.Fields))
+		args = append(args, xAddCmd, keyBytes, []byte(entry.ID.String()))
+		args = append(args, entry.Fields...)
+		cmds = append(cmds, protocol.MakeMultiBulkReply(args))
+		return true
+	})
+	if stream.Len() == 0 {
+		// 0-0 is not a valid ID of entry, XSETID will reset the last ID
+		id := stream.LastID()
+		if id == Stream.MinID {
+			id = Stream.ID{Seq: 1}
+		}
+		cmds = append(cmds, protocol.MakeMultiBulkReply([][]byte{
+			xAddCmd, keyBytes, []byte("MAXLEN"), []byte("0"), []byte(id.String()), []byte("f"), []byte("v"),
+		}))
+	}
+	cmds = append(cmds, protocol.MakeMultiBulkReply([][]byte{
+		xSetIDCmd, keyBytes, []byte(stream.LastID().String()),
+		[]byte("ENTRIESADDED"), []byte(strconv.FormatUint(stream.EntriesAdded(), 10)),
+		[]byte("MAXDELETEDID"), []byte(stream.MaxDeletedID().String()),
+	}))
+	for _, group := range stream.Groups() {
+		groupName := []byte(group.Name)
+		cmds = append(cmds, protocol.MakeMultiBulkReply([][]byte{
+			xGroupCmd, []byte("CREATE"), keyBytes, groupName, []byte(group.LastID.String()),
+		}))
+		for _, consumer := range group.Consumers() {
+			cmds = append(cmds, protocol.MakeMultiBulkReply([][]byte{
+				xGroupCmd, []byte("CREATECONSUMER"), keyBytes, groupName, []byte(consumer.Name),
+			}))
+		}
+		for _, pending := range group.PendingRange(Stream.MinID, Stream.MaxID, 0, nil) {
+			cmds = append(cmds, MakeXClaimCmd(key, group.Name, pending))
+		}
+	}
+	return cmds
+}
+
+// MakeXClaimCmd generates command line to restore the pending entry of consumer group
+func MakeXClaimCmd(key string, group string, pending *Stream.PendingEntry) *protocol.MultiBulkReply {
+	args := [][]byte{
+		xClaimCmd, []byte(key), []byte(group), []byte(pending.Consumer.Name), []byte("0"), []byte(pending.ID.String()),
+		[]byte("TIME"), []byte(strconv.FormatInt(pending.DeliveryTime.UnixMilli(), 10)),
+		[]byte("RETRYCOUNT"), []byte(strconv.FormatInt(pending.DeliveryCount, 10)),
+		[]byte("FORCE"), []byte("JUSTID"),
+	}
+	return protocol.MakeMultiBulkReply(args)
+}
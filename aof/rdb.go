@@ -0,0 +1,233 @@
+package aof
+
+import (
+	"fmt"
+	"github.com/Allen9012/Godis/config"
+	"github.com/Allen9012/Godis/datastruct/dict"
+	List "github.com/Allen9012/Godis/datastruct/list"
+	"github.com/Allen9012/Godis/datastruct/set"
+	SortedSet "github.com/Allen9012/Godis/datastruct/sortedset"
+	Stream "github.com/Allen9012/Godis/datastruct/stream"
+	"github.com/Allen9012/Godis/interface/database"
+	"github.com/Allen9012/Godis/lib/logger"
+	"github.com/Allen9012/Godis/lib/rdb"
+	"github.com/Allen9012/Godis/lib/utils"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/9/30
+  @desc: 生成 rdb 快照
+  @modified by:
+**/
+
+// GenerateRDB generates a rdb snapshot which is consistent with a prefix of aof file
+// the prefix is replayed in a tmp db, so the online db is not blocked
+func (persister *Persister) GenerateRDB(rdbFilename string) error {
+	ctx, err := persister.startGenerateRDB(nil, nil)
+	if err != nil {
+		return err
+	}
+	return persister.generateRDB(ctx, rdbFilename)
+}
+
+// GenerateRDBForReplication is like GenerateRDB, besides it attaches listener to receive the commands after snapshot,
+// hook will be called while aof is paused, right before listener attached
+func (persister *Persister) GenerateRDBForReplication(rdbFilename string, listener Listener, hook func()) error {
+	ctx, err := persister.startGenerateRDB(listener, hook)
+	if err != nil {
+		return err
+	}
+	return persister.generateRDB(ctx, rdbFilename)
+}
+
+func (persister *Persister) startGenerateRDB(newListener Listener, hook func()) (*RewriteCtx, error) {
+	// 暂停 aof 写入, 保证快照点之后的命令都能被 listener 收到
+	persister.pausingAof.Lock()
+	defer persister.pausingAof.Unlock()
+	err := persister.aofFile.Sync()
+	if err != nil {
+		logger.Warn("fsync failed")
+		return nil, err
+	}
+	fileInfo, err := os.Stat(persister.aofFilename)
+	if err != nil {
+		return nil, err
+	}
+	if hook != nil {
+		hook()
+	}
+	if newListener != nil {
+		persister.listeners[newListener] = struct{}{}
+		// listener 从当前选中的数据库开始接收命令
+		newListener.Callback([]CmdLine{utils.ToCmdLine("SELECT", strconv.Itoa(persister.currentDB))})
+	}
+	return &RewriteCtx{
+		fileSize: fileInfo.Size(),
+		dbIdx:    persister.currentDB,
+	}, nil
+}
+
+func (persister *Persister) generateRDB(ctx *RewriteCtx, rdbFilename string) error {
+	tmpHandler := persister.newRewriteHandler()
+	tmpHandler.LoadAof(int(ctx.fileSize))
+	return GenerateRDB(tmpHandler.db, rdbFilename)
+}
+
+// GenerateRDB dumps all databases into rdb file
+// data is written into a tmp file first, then renamed to filename, so that a crash won't damage the old snapshot
+func GenerateRDB(db database.DBEngine, filename string) error {
+	tmpFile, err := os.CreateTemp(config.GetTmpDir(), "*.rdb")
+	if err != nil {
+		return err
+	}
+	if err = WriteRDB(db, tmpFile); err == nil {
+		err = tmpFile.Sync()
+	}
+	_ = tmpFile.Close()
+	if err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return err
+	}
+	return os.Rename(tmpFile.Name(), filename)
+}
+
+// WriteRDB encodes all databases into w
+func WriteRDB(db database.DBEngine, w io.Writer) error {
+	enc := rdb.NewEncoder(w)
+	if err := enc.WriteHeader(); err != nil {
+		return err
+	}
+	auxMap := map[string]string{
+		"redis-ver":  "7.0.0",
+		"redis-bits": "64",
+		"ctime":      strconv.FormatInt(time.Now().Unix(), 10),
+	}
+	for k, v := range auxMap {
+		if err := enc.WriteAux(k, v); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < config.Properties.Databases; i++ {
+		keyCount, ttlCount := db.GetDBSize(i)
+		if keyCount == 0 {
+			continue
+		}
+		if err := enc.WriteDBHeader(i, keyCount, ttlCount); err != nil {
+			return err
+		}
+		var err error
+		now := time.Now()
+		db.ForEach(i, func(key string, _ *database.DataEntity, _ *time.Time) bool {
+			// 加读锁防止编码过程中数据被修改, 加锁后重新读取
+			keys := []string{key}
+			db.RWLocks(i, nil, keys)
+			defer db.RWUnLocks(i, nil, keys)
+			entity, exists := db.GetEntity(i, key)
+			if !exists {
+				return true
+			}
+			expiration := db.GetExpiration(i, key)
+			if expiration != nil && expiration.Before(now) {
+				return true
+			}
+			err = entityToRdb(enc, key, entity, expiration)
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return enc.WriteEnd()
+}
+
+// entityToRdb writes data entity into rdb encoder
+func entityToRdb(enc *rdb.Encoder, key string, entity *database.DataEntity, expiration *time.Time) error {
+	switch val := entity.Data.(type) {
+	case []byte:
+		return enc.WriteStringObject(key, val, expiration)
+	case List.List:
+		values := make([][]byte, 0, val.Len())
+		val.ForEach(func(i int, v interface{}) bool {
+			bytes, _ := v.([]byte)
+			values = append(values, bytes)
+			return true
+		})
+		return enc.WriteListObject(key, values, expiration)
+	case *set.Set:
+		members := make([][]byte, 0, val.Len())
+		val.ForEach(func(member string) bool {
+			members = append(members, []byte(member))
+			return true
+		})
+		return enc.WriteSetObject(key, members, expiration)
+	case dict.Dict:
+		hash := make(map[string][]byte, val.Len())
+		val.ForEach(func(field string, v interface{}) bool {
+			bytes, _ := v.([]byte)
+			hash[field] = bytes
+			return true
+		})
+		return enc.WriteHashObject(key, hash, expiration)
+	case *SortedSet.SortedSet:
+		entries := make([]*rdb.ZSetEntry, 0, val.Len())
+		if val.Len() > 0 {
+			val.ForEachByRank(0, val.Len(), false, func(element *SortedSet.Element) bool {
+				entries = append(entries, &rdb.ZSetEntry{
+					Member: element.Member,
+					Score:  element.Score,
+				})
+				return true
+			})
+		}
+		return enc.WriteZSetObject(key, entries, expiration)
+	case *Stream.Stream:
+		return enc.WriteStreamObject(key, streamToRdb(val), expiration)
+	}
+	// 不能静默跳过, 否则快照会丢失数据
+	return fmt.Errorf("unknown data type %T of key %s", entity.Data, key)
+}
+
+// streamToRdb converts stream into rdb data with entries, consumer groups and pending entries
+func streamToRdb(stream *Stream.Stream) *rdb.StreamData {
+	data := &rdb.StreamData{
+		Entries:      make([]*rdb.StreamEntry, 0, stream.Len()),
+		LastID:       rdb.StreamID(stream.LastID()),
+		MaxDeletedID: rdb.StreamID(stream.MaxDeletedID()),
+		EntriesAdded: stream.EntriesAdded(),
+	}
+	stream.ForEach(func(entry *Stream.Entry) bool {
+		data.Entries = append(data.Entries, &rdb.StreamEntry{
+			ID:     rdb.StreamID(entry.ID),
+			Fields: entry.Fields,
+		})
+		return true
+	})
+	for _, group := range stream.Groups() {
+		g := &rdb.StreamGroup{
+			Name:   group.Name,
+			LastID: rdb.StreamID(group.LastID),
+		}
+		for _, consumer := range group.Consumers() {
+			g.Consumers = append(g.Consumers, &rdb.StreamConsumer{
+				Name:     consumer.Name,
+				SeenTime: consumer.SeenTime,
+			})
+		}
+		for _, pending := range group.PendingRange(Stream.MinID, Stream.MaxID, 0, nil) {
+			g.Pending = append(g.Pending, &rdb.StreamPending{
+				ID:            rdb.StreamID(pending.ID),
+				Consumer:      pending.Consumer.Name,
+				DeliveryTime:  pending.DeliveryTime,
+				DeliveryCount: uint64(pending.DeliveryCount),
+			})
+		}
+		data.Groups = append(data.Groups, g)
+	}
+	return data
+}
@@ -10,11 +10,13 @@ import (
 	"github.com/Allen9012/Godis/config"
 	"github.com/Allen9012/Godis/godis/protocol"
 	"github.com/Allen9012/Godis/interface/database"
+	"github.com/Allen9012/Godis/latency"
 	"github.com/Allen9012/Godis/lib/logger"
 	"github.com/Allen9012/Godis/lib/utils"
 	"io"
 	"os"
 	"strconv"
+	"sync/atomic"
 	"time"
 )
 
@@ -35,6 +37,12 @@ type RewriteCtx struct {
 
 // Rewrite carries out AOF rewrite
 func (persister *Persister) Rewrite() error {
+	atomic.StoreInt32(&persister.rewriting, 1)
+	defer atomic.StoreInt32(&persister.rewriting, 0)
+	start := time.Now()
+	defer func() {
+		latency.AddSampleIfNeeded(latency.EventAofRewrite, time.Since(start))
+	}()
 	ctx, err := persister.StartRewrite()
 	if err != nil {
 		return err
@@ -57,23 +65,27 @@ func (persister *Persister) DoRewrite(ctx *RewriteCtx) error {
 	tmpAof.LoadAof(int(ctx.fileSize))
 
 	// rewrite aof tmpFile
+	return writeCmds(tmpAof.db, tmpFile)
+}
+
+// writeCmds dumps all databases as commands
+func writeCmds(db database.DBEngine, w io.Writer) error {
 	for i := 0; i < config.Properties.Databases; i++ {
 		// select db
 		data := protocol.MakeMultiBulkReply(utils.ToCmdLine("SELECT", strconv.Itoa(i))).ToBytes()
-		_, err := tmpFile.Write(data)
+		_, err := w.Write(data)
 		if err != nil {
 			return err
 		}
 		//dump db
-		tmpAof.db.ForEach(i, func(key string, entity *database.DataEntity, expiration *time.Time) bool {
-			cmd := EntityToCmd(key, entity)
-			if cmd != nil {
-				_, _ = tmpFile.Write(cmd.ToBytes())
+		db.ForEach(i, func(key string, entity *database.DataEntity, expiration *time.Time) bool {
+			for _, cmd := range EntityToCmds(key, entity) {
+				_, _ = w.Write(cmd.ToBytes())
 			}
 			if expiration != nil {
 				cmd := MakeExpireCmd(key, *expiration)
 				if cmd != nil {
-					_, _ = tmpFile.Write(cmd.ToBytes())
+					_, _ = w.Write(cmd.ToBytes())
 				}
 			}
 			return true
@@ -82,6 +94,36 @@ func (persister *Persister) DoRewrite(ctx *RewriteCtx) error {
 	return nil
 }
 
+// RewriteFrom replaces aof file with the data of the given db
+// used when the whole dataset is replaced, e.g. a slave finished full sync with master
+func (persister *Persister) RewriteFrom(db database.DBEngine) error {
+	persister.pausingAof.Lock()
+	defer persister.pausingAof.Unlock()
+	tmpFile, err := os.CreateTemp(config.GetTmpDir(), "*.aof")
+	if err != nil {
+		return err
+	}
+	err = writeCmds(db, tmpFile)
+	_ = tmpFile.Close()
+	if err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return err
+	}
+	_ = persister.aofFile.Close()
+	if err := os.Rename(tmpFile.Name(), persister.aofFilename); err != nil {
+		logger.Warn(err)
+	}
+	aofFile, err := os.OpenFile(persister.aofFilename, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	persister.aofFile = aofFile
+	// resume selected db of aof file
+	data := protocol.MakeMultiBulkReply(utils.ToCmdLine("SELECT", strconv.Itoa(persister.currentDB))).ToBytes()
+	_, err = persister.aofFile.Write(data)
+	return err
+}
+
 /*开始和结束的时候需要注意*/
 
 // StartRewrite prepares rewrite procedure
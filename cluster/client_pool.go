@@ -8,8 +8,13 @@ package cluster
 import (
 	"context"
 	"errors"
+	"github.com/Allen9012/Godis/config"
 	"github.com/Allen9012/Godis/godis/client"
+	"github.com/Allen9012/Godis/godis/parser"
+	"github.com/Allen9012/Godis/godis/protocol"
 	pool "github.com/jolestar/go-commons-pool/v2"
+	"net"
+	"sync"
 )
 
 type connectionFactory struct {
@@ -17,7 +22,8 @@ type connectionFactory struct {
 }
 
 func (f connectionFactory) MakeObject(ctx context.Context) (*pool.PooledObject, error) {
-	c, err := client.MakeClient(f.Peer)
+	// 集群内所有节点使用相同的 requirepass
+	c, err := client.MakeClientWithPassword(f.Peer, config.Get(&config.Properties.RequirePass))
 	if err != nil {
 		return nil, err
 	}
@@ -43,6 +49,107 @@ func (f connectionFactory) ActivateObject(ctx context.Context, object *pool.Pool
 }
 
 func (f connectionFactory) PassivateObject(ctx context.Context, object *pool.PooledObject) error {
-	//TODO implement me
-	panic("implement me")
+	return nil
+}
+
+// defaultClientFactory creates a connection pool for every peer on first use
+type defaultClientFactory struct {
+	mu    sync.Mutex
+	pools map[string]*pool.ObjectPool // 节点地址 ： 池
+}
+
+func newDefaultClientFactory() *defaultClientFactory {
+	return &defaultClientFactory{
+		pools: make(map[string]*pool.ObjectPool),
+	}
+}
+
+func (factory *defaultClientFactory) getPool(peerAddr string) *pool.ObjectPool {
+	factory.mu.Lock()
+	defer factory.mu.Unlock()
+	p, ok := factory.pools[peerAddr]
+	if !ok {
+		p = pool.NewObjectPoolWithDefaultConfig(context.Background(), connectionFactory{
+			Peer: peerAddr,
+		})
+		factory.pools[peerAddr] = p
+	}
+	return p
+}
+
+// GetPeerClient borrows a client connected to peer from pool
+func (factory *defaultClientFactory) GetPeerClient(peerAddr string) (peerClient, error) {
+	object, err := factory.getPool(peerAddr).BorrowObject(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	c, ok := object.(*client.Client)
+	if !ok {
+		return nil, errors.New("wrong type")
+	}
+	return c, nil
+}
+
+// ReturnPeerClient returns client to pool
+func (factory *defaultClientFactory) ReturnPeerClient(peerAddr string, peerClient peerClient) error {
+	factory.mu.Lock()
+	p, ok := factory.pools[peerAddr]
+	factory.mu.Unlock()
+	if !ok {
+		return errors.New("connection pool not found")
+	}
+	return p.ReturnObject(context.Background(), peerClient)
+}
+
+// tcpStream is a connection reading replies of a command one by one, e.g. keys dumped by peer
+type tcpStream struct {
+	conn net.Conn
+	ch   <-chan *parser.PayLoad
+}
+
+func (s *tcpStream) Stream() <-chan *parser.PayLoad {
+	return s.ch
+}
+
+func (s *tcpStream) Close() error {
+	return s.conn.Close()
+}
+
+// NewStream sends cmdLine to peer through a new connection and returns the stream of replies
+func (factory *defaultClientFactory) NewStream(peerAddr string, cmdLine CmdLine) (peerStream, error) {
+	conn, err := net.Dial("tcp", peerAddr)
+	if err != nil {
+		return nil, err
+	}
+	ch := parser.ParseStream(conn)
+	if password := config.Get(&config.Properties.RequirePass); password != "" {
+		_, err = conn.Write(protocol.MakeMultiBulkReply([][]byte{[]byte("AUTH"), []byte(password)}).ToBytes())
+		if err == nil {
+			if payload := <-ch; payload == nil || payload.Err != nil || protocol.IsErrorReply(payload.Data) {
+				err = errors.New("auth failed")
+			}
+		}
+	}
+	if err == nil {
+		_, err = conn.Write(protocol.MakeMultiBulkReply(cmdLine).ToBytes())
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return &tcpStream{
+		conn: conn,
+		ch:   ch,
+	}, nil
+}
+
+// Close closes all pools
+func (factory *defaultClientFactory) Close() error {
+	factory.mu.Lock()
+	defer factory.mu.Unlock()
+	for _, p := range factory.pools {
+		p.Close(context.Background())
+	}
+	factory.pools = make(map[string]*pool.ObjectPool)
+	return nil
 }
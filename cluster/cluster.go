@@ -1,7 +1,6 @@
 package cluster
 
 import (
-	"context"
 	godis2 "github.com/Allen9012/Godis/config"
 	database2 "github.com/Allen9012/Godis/database"
 	"github.com/Allen9012/Godis/datastruct/dict"
@@ -9,12 +8,15 @@ import (
 	"github.com/Allen9012/Godis/godis/protocol"
 	"github.com/Allen9012/Godis/interface/database"
 	"github.com/Allen9012/Godis/interface/godis"
-	"github.com/Allen9012/Godis/lib/consistenthash"
+	"github.com/Allen9012/Godis/latency"
 	"github.com/Allen9012/Godis/lib/idgenerator"
 	"github.com/Allen9012/Godis/lib/logger"
-	pool "github.com/jolestar/go-commons-pool/v2"
+	"github.com/Allen9012/Godis/lib/rdb"
+	"github.com/Allen9012/Godis/slowlog"
+	"os"
 	"strings"
 	"sync"
+	"time"
 )
 
 /*
@@ -24,54 +26,95 @@ import (
 */
 
 type Cluster struct {
-	self           string                      //记录自己的地址
-	nodes          []string                    // node列表
-	peerPicker     *consistenthash.NodeMap     //节点选择器
-	peerconnection map[string]*pool.ObjectPool //map保存连接池 节点地址 ： 池
-	db             database.DBEngine
-	topology       topology
-	transactions   *dict.SimpleDict // id -> Transaction 不安全的dict
-	transactionMu  sync.RWMutex     // 事务用锁
-	slotMu         sync.RWMutex
-	//slots          map[uint32]*hostSlot
+	self          string //记录自己的地址
+	db            database.DBEngine
+	topology      topology         // 槽和节点的分布
+	transactions  *dict.SimpleDict // id -> Transaction 不安全的dict
+	transactionMu sync.RWMutex     // 事务用锁
+	slotMu        sync.RWMutex
+	slots         map[uint32]*hostSlot // 正在迁入或迁出的槽
+	// asking holds clients sent ASKING, which are allowed to access importing slots by the next command
+	asking      sync.Map
 	idGenerator *idgenerator.IDGenerator
+	// commands slower than slowlog-log-slower-than, including time of relaying to peers
+	slowlog *slowlog.SlowLog
 
 	clientFactory clientFactory
 }
 
-const REPLICA_NUM = 3
-
 // MakeCluster
 //
 //	 @Description:
 //	 @return *Cluster
 //		1. 创建对象，和赋值
-//		2. 一致性Hash并添加节点
-//	 	3. 建立连接池
+//		2. 配置了 cluster-raft-addr 时使用 raft 拓扑, 配置了 cluster-as-seed 或 cluster-seed 时使用 gossip 拓扑,
+//		否则由 self 和 peers 生成固定拓扑
+//	 	3. 按需建立连接池
 func MakeCluster() *Cluster {
 	cluster := &Cluster{
-		self:           godis2.Properties.Self,
-		db:             database2.NewStandaloneServer(),
-		peerPicker:     consistenthash.NewNodeMap(3, nil),
-		peerconnection: make(map[string]*pool.ObjectPool),
-	}
-	nodes := make([]string, len(godis2.Properties.Peers)+1)
-	for _, peer := range godis2.Properties.Peers {
-		nodes = append(nodes, peer)
+		self:          godis2.Properties.Self,
+		db:            database2.NewStandaloneServer(),
+		slots:         make(map[uint32]*hostSlot),
+		transactions:  dict.MakeSimple(),
+		idGenerator:   idgenerator.MakeGenerator(godis2.Properties.Self),
+		slowlog:       slowlog.MakeSlowLog(),
+		clientFactory: newDefaultClientFactory(),
 	}
-	nodes = append(nodes, godis2.Properties.Self)
-	cluster.peerPicker.AddNode(nodes...)
-	ctx := context.Background()
-	// 新建连接池
-	for _, peer := range godis2.Properties.Peers {
-		cluster.peerconnection[peer] = pool.NewObjectPoolWithDefaultConfig(ctx, connectionFactory{
-			Peer: peer,
-		})
+	if godis2.Properties.ClusterRaftAddr != "" {
+		cluster.topology = makeRaftTopology(cluster)
+	} else if godis2.Properties.ClusterAsSeed || godis2.Properties.ClusterSeed != "" {
+		cluster.topology = makeGossipTopology(cluster.clientFactory)
+	} else {
+		cluster.topology = newFixedTopology(godis2.Properties.Self, godis2.Properties.Peers)
 	}
-	cluster.nodes = nodes
 	return cluster
 }
 
+// makeGossipTopology restores topology from cluster-config-file if it exists, otherwise starts or joins a cluster
+func makeGossipTopology(factory clientFactory) *gossipTopology {
+	props := godis2.Properties
+	nodeTimeout := time.Duration(props.ClusterNodeTimeout) * time.Millisecond
+	topo := newGossipTopology(props.Self, factory, props.ClusterConfigFile, nodeTimeout)
+	var err protocol.ErrorReply
+	if props.ClusterConfigFile != "" && fileExists(props.ClusterConfigFile) {
+		err = topo.LoadConfigFile()
+	} else if props.ClusterAsSeed {
+		err = topo.StartAsSeed(props.Self)
+	} else {
+		err = topo.Join(props.ClusterSeed)
+	}
+	if err != nil {
+		logger.Error(err.Error())
+	}
+	return topo
+}
+
+// makeRaftTopology restores topology from cluster-raft-dir if raft state exists, otherwise starts or joins a cluster
+func makeRaftTopology(cluster *Cluster) *raftTopology {
+	props := godis2.Properties
+	nodeTimeout := time.Duration(props.ClusterNodeTimeout) * time.Millisecond
+	topo := newRaftTopology(props.Self, props.ClusterRaftAddr, props.ClusterRaftDir, nodeTimeout,
+		cluster.clientFactory, cluster.setMaster)
+	var err protocol.ErrorReply
+	if topo.hasRaftState() {
+		err = topo.LoadConfigFile()
+	} else if props.ClusterAsSeed {
+		err = topo.StartAsSeed(props.Self)
+	} else {
+		err = topo.Join(props.ClusterSeed)
+	}
+	if err != nil {
+		logger.Error(err.Error())
+	}
+	return topo
+}
+
+// fileExists returns whether the given regular file exists
+func fileExists(filename string) bool {
+	info, err := os.Stat(filename)
+	return err == nil && !info.IsDir()
+}
+
 type peerClient interface {
 	Send(args [][]byte) godis.Reply
 }
@@ -98,14 +141,29 @@ func (c *Cluster) Exec(client godis.Connection, args [][]byte) (result godis.Rep
 	if !ok {
 		return protocol.MakeErrReply("not supported cmd")
 	}
+	if cmdName != "asking" {
+		// ASKING 只对下一条命令有效
+		defer c.asking.Delete(client)
+	}
+	start := time.Now()
 	result = cmdFunc(c, client, args)
+	duration := time.Since(start)
+	latency.AddSampleIfNeeded(latency.EventCommand, duration)
+	c.slowlog.Record(client, args, start, duration)
 	return
 }
 
 func (c *Cluster) Close() {
 	c.db.Close()
+	_ = c.topology.Close()
+	_ = c.clientFactory.Close()
 }
 
 func (c *Cluster) AfterClientClose(conn godis.Connection) {
+	c.asking.Delete(conn)
 	c.db.AfterClientClose(conn)
 }
+
+func (c *Cluster) LoadRDB(dec *rdb.Decoder) error {
+	return c.db.LoadRDB(dec)
+}
@@ -0,0 +1,445 @@
+package cluster
+
+import (
+	"bytes"
+	"github.com/Allen9012/Godis/config"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/interface/godis"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/20
+  @desc: CLUSTER 命令, 集群客户端通过 CLUSTER SLOTS 获取槽的分布
+  @modified by:
+**/
+
+// execCluster
+//
+//	@Description: CLUSTER SLOTS | KEYSLOT key | SETSLOT slot action [node-id] | GETKEYSINSLOT slot count | COUNTKEYSINSLOT slot
+//	| REPLICATE node-id | NODES | SHARDS | INFO | MYID | MEET ip port [bus-port] | FORGET node-id
+//	| ADDSLOTS slot [slot ...] | DELSLOTS slot [slot ...] | ADDSLOTSRANGE start end [start end ...]
+//	| DELSLOTSRANGE start end [start end ...] | RESET [HARD|SOFT]
+//	@param cluster
+//	@param c
+//	@param cmdArgs
+//	@return godis.Reply
+func execCluster(cluster *Cluster, c godis.Connection, cmdArgs [][]byte) godis.Reply {
+	if len(cmdArgs) < 2 {
+		return protocol.MakeArgNumErrReply("cluster")
+	}
+	subCmd := strings.ToLower(string(cmdArgs[1]))
+	switch subCmd {
+	case "slots":
+		if len(cmdArgs) != 2 {
+			return protocol.MakeArgNumErrReply("cluster|slots")
+		}
+		return clusterSlots(cluster)
+	case "keyslot":
+		if len(cmdArgs) != 3 {
+			return protocol.MakeArgNumErrReply("cluster|keyslot")
+		}
+		return protocol.MakeIntReply(int64(getSlot(string(cmdArgs[2]))))
+	case "setslot":
+		return execSetSlot(cluster, c, cmdArgs[2:])
+	case "getkeysinslot":
+		return execGetKeysInSlot(cluster, c, cmdArgs[2:])
+	case "countkeysinslot":
+		return execCountKeysInSlot(cluster, c, cmdArgs[2:])
+	case "replicate":
+		if len(cmdArgs) != 3 {
+			return protocol.MakeArgNumErrReply("cluster|replicate")
+		}
+		return execReplicate(cluster, string(cmdArgs[2]))
+	case "nodes":
+		if len(cmdArgs) != 2 {
+			return protocol.MakeArgNumErrReply("cluster|nodes")
+		}
+		return clusterNodes(cluster)
+	case "shards":
+		if len(cmdArgs) != 2 {
+			return protocol.MakeArgNumErrReply("cluster|shards")
+		}
+		return clusterShards(cluster)
+	case "info":
+		if len(cmdArgs) != 2 {
+			return protocol.MakeArgNumErrReply("cluster|info")
+		}
+		return clusterInfo(cluster)
+	case "myid":
+		if len(cmdArgs) != 2 {
+			return protocol.MakeArgNumErrReply("cluster|myid")
+		}
+		return protocol.MakeBulkReply([]byte(cluster.topology.GetSelfNodeID()))
+	case "meet":
+		return execMeet(cluster, cmdArgs[2:])
+	case "forget":
+		if len(cmdArgs) != 3 {
+			return protocol.MakeArgNumErrReply("cluster|forget")
+		}
+		if err := cluster.topology.Forget(string(cmdArgs[2])); err != nil {
+			return err
+		}
+		return protocol.MakeOkReply()
+	case "addslots", "delslots":
+		if len(cmdArgs) < 3 {
+			return protocol.MakeArgNumErrReply("cluster|" + subCmd)
+		}
+		slotIDs := make([]uint32, 0, len(cmdArgs)-2)
+		for _, arg := range cmdArgs[2:] {
+			slotID, errReply := parseSlot(arg)
+			if errReply != nil {
+				return errReply
+			}
+			slotIDs = append(slotIDs, slotID)
+		}
+		return execAddSlots(cluster, slotIDs, subCmd == "addslots")
+	case "addslotsrange", "delslotsrange":
+		if len(cmdArgs) < 4 || len(cmdArgs)%2 != 0 {
+			return protocol.MakeArgNumErrReply("cluster|" + subCmd)
+		}
+		var slotIDs []uint32
+		for i := 2; i < len(cmdArgs); i += 2 {
+			begin, errReply := parseSlot(cmdArgs[i])
+			if errReply != nil {
+				return errReply
+			}
+			end, errReply := parseSlot(cmdArgs[i+1])
+			if errReply != nil {
+				return errReply
+			}
+			if begin > end {
+				return protocol.MakeErrReply("ERR start slot number " + strconv.Itoa(int(begin)) +
+					" is greater than end slot number " + strconv.Itoa(int(end)))
+			}
+			for slotID := begin; slotID <= end; slotID++ {
+				slotIDs = append(slotIDs, slotID)
+			}
+		}
+		return execAddSlots(cluster, slotIDs, subCmd == "addslotsrange")
+	case "reset":
+		return execReset(cluster, cmdArgs[2:])
+	}
+	return protocol.MakeErrReply("ERR unknown subcommand '" + string(cmdArgs[1]) + "'. Try CLUSTER HELP.")
+}
+
+// slotRange is a range of continuous slots served by the same node
+type slotRange struct {
+	begin  uint32
+	end    uint32 // inclusive
+	nodeID string
+}
+
+// getSlotRanges merges continuous slots served by the same node, unassigned slots are skipped
+func getSlotRanges(slots []*Slot) []*slotRange {
+	var ranges []*slotRange
+	var last *slotRange
+	for _, slot := range slots {
+		if slot == nil || slot.NodeID == "" {
+			last = nil
+			continue
+		}
+		if last != nil && last.nodeID == slot.NodeID && last.end+1 == slot.ID {
+			last.end = slot.ID
+			continue
+		}
+		last = &slotRange{
+			begin:  slot.ID,
+			end:    slot.ID,
+			nodeID: slot.NodeID,
+		}
+		ranges = append(ranges, last)
+	}
+	return ranges
+}
+
+// splitAddr splits addr into host and port, port is 0 if addr is invalid
+func splitAddr(addr string) (string, int) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr, 0
+	}
+	port, _ := strconv.Atoi(portStr)
+	return host, port
+}
+
+// clusterSlots returns [begin, end, [host, port, id, {}]...] of each slot range like redis 7, master comes before its replicas
+func clusterSlots(cluster *Cluster) godis.Reply {
+	ranges := getSlotRanges(cluster.topology.GetSlots())
+	nodes := cluster.topology.GetNodes()
+	replies := make([]godis.Reply, 0, len(ranges))
+	for _, r := range ranges {
+		node := cluster.topology.GetNode(r.nodeID)
+		if node == nil {
+			continue
+		}
+		reply := []godis.Reply{
+			protocol.MakeIntReply(int64(r.begin)),
+			protocol.MakeIntReply(int64(r.end)),
+			makeSlotsNode(node),
+		}
+		for _, replica := range getReplicas(nodes, node.ID) {
+			reply = append(reply, makeSlotsNode(replica))
+		}
+		replies = append(replies, protocol.MakeMultiRawReply(reply))
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+func makeSlotsNode(node *Node) godis.Reply {
+	host, port := splitAddr(node.Addr)
+	return protocol.MakeMultiRawReply([]godis.Reply{
+		protocol.MakeBulkReply([]byte(host)),
+		protocol.MakeIntReply(int64(port)),
+		protocol.MakeBulkReply([]byte(node.ID)),
+		protocol.MakeEmptyMultiBulkReply(),
+	})
+}
+
+// execReplicate makes current node become replica of master, only supported by raft topology
+func execReplicate(cluster *Cluster, masterID string) godis.Reply {
+	topo, ok := cluster.topology.(*raftTopology)
+	if !ok {
+		return protocol.MakeErrReply("ERR CLUSTER REPLICATE requires raft")
+	}
+	if err := topo.Replicate(topo.GetSelfNodeID(), masterID); err != nil {
+		return err
+	}
+	return protocol.MakeOkReply()
+}
+
+// clusterNodes returns all nodes in the format of nodes.conf, migrating and importing slots are appended to current node
+func clusterNodes(cluster *Cluster) godis.Reply {
+	selfID := cluster.topology.GetSelfNodeID()
+	buf := &bytes.Buffer{}
+	for _, node := range cluster.topology.GetNodes() {
+		buf.WriteString(formatNodeLine(node, selfID))
+		if node.ID == selfID {
+			writeHostSlots(cluster, buf)
+		}
+		buf.WriteByte('\n')
+	}
+	return protocol.MakeBulkReply(buf.Bytes())
+}
+
+// writeHostSlots writes [slot->-node-id] for migrating slots and [slot-<-node-id] for importing slots
+func writeHostSlots(cluster *Cluster, buf *bytes.Buffer) {
+	cluster.slotMu.RLock()
+	slotIDs := make([]uint32, 0, len(cluster.slots))
+	for slotID := range cluster.slots {
+		slotIDs = append(slotIDs, slotID)
+	}
+	sort.Slice(slotIDs, func(i, j int) bool {
+		return slotIDs[i] < slotIDs[j]
+	})
+	for _, slotID := range slotIDs {
+		slot := cluster.slots[slotID]
+		arrow := "->-"
+		if slot.state == slotStateImporting {
+			arrow = "-<-"
+		}
+		buf.WriteString(" [" + strconv.Itoa(int(slotID)) + arrow + slot.nodeID + "]")
+	}
+	cluster.slotMu.RUnlock()
+}
+
+// getReplicas returns replicas of master which are not failing, ordered by id
+func getReplicas(nodes []*Node, masterID string) []*Node {
+	var replicas []*Node
+	for _, node := range nodes {
+		if node.MasterID == masterID && node.Flags&nodeFlagFail == 0 {
+			replicas = append(replicas, node)
+		}
+	}
+	return replicas
+}
+
+// clusterShards returns slots and nodes of each master and its replicas like redis 7
+func clusterShards(cluster *Cluster) godis.Reply {
+	nodes := cluster.topology.GetNodes()
+	var shards []godis.Reply
+	for _, master := range nodes {
+		if master.MasterID != "" {
+			continue
+		}
+		var slots []godis.Reply
+		for _, r := range getSlotRanges(master.Slots) {
+			slots = append(slots, protocol.MakeIntReply(int64(r.begin)), protocol.MakeIntReply(int64(r.end)))
+		}
+		members := []godis.Reply{makeShardNode(master, "master")}
+		for _, node := range nodes {
+			if node.MasterID == master.ID {
+				members = append(members, makeShardNode(node, "replica"))
+			}
+		}
+		shards = append(shards, protocol.MakeMultiRawReply([]godis.Reply{
+			protocol.MakeBulkReply([]byte("slots")),
+			protocol.MakeMultiRawReply(slots),
+			protocol.MakeBulkReply([]byte("nodes")),
+			protocol.MakeMultiRawReply(members),
+		}))
+	}
+	return protocol.MakeMultiRawReply(shards)
+}
+
+func makeShardNode(node *Node, role string) godis.Reply {
+	host, port := splitAddr(node.Addr)
+	health := "online"
+	if node.Flags&nodeFlagFail != 0 {
+		health = "failed"
+	}
+	return protocol.MakeMultiRawReply([]godis.Reply{
+		protocol.MakeBulkReply([]byte("id")),
+		protocol.MakeBulkReply([]byte(node.ID)),
+		protocol.MakeBulkReply([]byte("port")),
+		protocol.MakeIntReply(int64(port)),
+		protocol.MakeBulkReply([]byte("ip")),
+		protocol.MakeBulkReply([]byte(host)),
+		protocol.MakeBulkReply([]byte("endpoint")),
+		protocol.MakeBulkReply([]byte(host)),
+		protocol.MakeBulkReply([]byte("role")),
+		protocol.MakeBulkReply([]byte(role)),
+		protocol.MakeBulkReply([]byte("replication-offset")),
+		protocol.MakeIntReply(0),
+		protocol.MakeBulkReply([]byte("health")),
+		protocol.MakeBulkReply([]byte(health)),
+	})
+}
+
+// clusterInfo returns state of cluster, cluster_state is ok only if all slots are served by nodes not failing
+func clusterInfo(cluster *Cluster) godis.Reply {
+	nodes := cluster.topology.GetNodes()
+	selfID := cluster.topology.GetSelfNodeID()
+	var assigned, pfail, fail, size int
+	var currentEpoch, myEpoch uint64
+	for _, node := range nodes {
+		if node.ConfigEpoch > currentEpoch {
+			currentEpoch = node.ConfigEpoch
+		}
+		if len(node.Slots) == 0 {
+			continue
+		}
+		size++
+		assigned += len(node.Slots)
+		if node.Flags&nodeFlagFail != 0 {
+			fail += len(node.Slots)
+		} else if node.Flags&nodeFlagPFail != 0 {
+			pfail += len(node.Slots)
+		}
+	}
+	if self := cluster.topology.GetNode(selfID); self != nil {
+		myEpoch = self.ConfigEpoch
+		// 从节点的 epoch 是主节点的 epoch
+		if master := cluster.topology.GetNode(self.MasterID); master != nil {
+			myEpoch = master.ConfigEpoch
+		}
+	}
+	state := "ok"
+	if assigned < slotCount || fail > 0 {
+		state = "fail"
+	}
+	lines := []string{
+		"cluster_state:" + state,
+		"cluster_slots_assigned:" + strconv.Itoa(assigned),
+		"cluster_slots_ok:" + strconv.Itoa(assigned-pfail-fail),
+		"cluster_slots_pfail:" + strconv.Itoa(pfail),
+		"cluster_slots_fail:" + strconv.Itoa(fail),
+		"cluster_known_nodes:" + strconv.Itoa(len(nodes)),
+		"cluster_size:" + strconv.Itoa(size),
+		"cluster_current_epoch:" + strconv.FormatUint(currentEpoch, 10),
+		"cluster_my_epoch:" + strconv.FormatUint(myEpoch, 10),
+		"total_cluster_links_buffer_limit_exceeded:0",
+	}
+	return protocol.MakeBulkReply([]byte(strings.Join(lines, "\r\n") + "\r\n"))
+}
+
+// execMeet CLUSTER MEET ip port [bus-port], godis uses the same port for clients and cluster bus
+func execMeet(cluster *Cluster, args [][]byte) godis.Reply {
+	if len(args) != 2 && len(args) != 3 {
+		return protocol.MakeArgNumErrReply("cluster|meet")
+	}
+	port, err := strconv.Atoi(string(args[1]))
+	if err != nil || port <= 0 || port > 65535 {
+		return protocol.MakeErrReply("ERR Invalid base port specified: " + string(args[1]))
+	}
+	if len(args) == 3 {
+		busPort, err := strconv.Atoi(string(args[2]))
+		if err != nil || busPort <= 0 || busPort > 65535 {
+			return protocol.MakeErrReply("ERR Invalid bus port specified: " + string(args[2]))
+		}
+	}
+	ip := string(args[0])
+	if net.ParseIP(ip) == nil {
+		return protocol.MakeErrReply("ERR Invalid node address specified: " + ip + ":" + string(args[1]))
+	}
+	if err := cluster.topology.Meet(net.JoinHostPort(ip, string(args[1]))); err != nil {
+		return err
+	}
+	return protocol.MakeOkReply()
+}
+
+// execAddSlots assigns slots to current node if add is true, otherwise unassigns them
+func execAddSlots(cluster *Cluster, slotIDs []uint32, add bool) godis.Reply {
+	slots := cluster.topology.GetSlots()
+	seen := make(map[uint32]struct{}, len(slotIDs))
+	for _, slotID := range slotIDs {
+		if _, ok := seen[slotID]; ok {
+			return protocol.MakeErrReply("ERR Slot " + strconv.Itoa(int(slotID)) + " specified multiple times")
+		}
+		seen[slotID] = struct{}{}
+		assigned := slots[slotID] != nil && slots[slotID].NodeID != ""
+		if add && assigned {
+			return protocol.MakeErrReply("ERR Slot " + strconv.Itoa(int(slotID)) + " is already busy")
+		}
+		if !add && !assigned {
+			return protocol.MakeErrReply("ERR Slot " + strconv.Itoa(int(slotID)) + " is already unassigned")
+		}
+	}
+	nodeID := ""
+	if add {
+		nodeID = cluster.topology.GetSelfNodeID()
+	}
+	if err := cluster.topology.SetSlot(slotIDs, nodeID); err != nil {
+		return err
+	}
+	for _, slotID := range slotIDs {
+		cluster.setHostSlot(slotID, nil)
+	}
+	return protocol.MakeOkReply()
+}
+
+// execReset CLUSTER RESET [HARD|SOFT], master holding keys cannot be reset
+func execReset(cluster *Cluster, args [][]byte) godis.Reply {
+	if len(args) > 1 {
+		return protocol.MakeArgNumErrReply("cluster|reset")
+	}
+	hard := false
+	if len(args) == 1 {
+		switch strings.ToLower(string(args[0])) {
+		case "hard":
+			hard = true
+		case "soft":
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+	}
+	if self := cluster.topology.GetNode(cluster.topology.GetSelfNodeID()); self != nil && self.MasterID == "" {
+		for i := 0; i < config.Properties.Databases; i++ {
+			if keys, _ := cluster.db.GetDBSize(i); keys > 0 {
+				return protocol.MakeErrReply("ERR CLUSTER RESET can't be called with master nodes containing keys")
+			}
+		}
+	}
+	if err := cluster.topology.Reset(hard); err != nil {
+		return err
+	}
+	cluster.slotMu.Lock()
+	cluster.slots = make(map[uint32]*hostSlot)
+	cluster.slotMu.Unlock()
+	return protocol.MakeOkReply()
+}
@@ -0,0 +1,155 @@
+package cluster
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/26
+  @desc: CLUSTER command family
+  @modified by:
+**/
+
+import (
+	"github.com/Allen9012/Godis/godis/connection"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/godis/protocol/asserts"
+	"strings"
+	"testing"
+)
+
+func TestClusterNodes(t *testing.T) {
+	nodes, _ := mockGossipNodes(t, []string{"127.0.0.1:6399", "127.0.0.1:7379"})
+	nodeA := nodes[0]
+	idA := nodeA.topology.GetSelfNodeID()
+	idB := nodes[1].topology.GetSelfNodeID()
+	waitFor(t, "all nodes known", func() bool {
+		return len(nodeA.topology.GetNodes()) == 2
+	})
+	conn := connection.NewFakeConn()
+	result := nodeA.Exec(conn, toArgs("CLUSTER", "MYID"))
+	asserts.AssertBulkReply(t, result, idA)
+
+	nodeA.setHostSlot(100, &hostSlot{state: slotStateMigrating, nodeID: idB})
+	nodeA.setHostSlot(200, &hostSlot{state: slotStateImporting, nodeID: idB})
+	result = nodeA.Exec(conn, toArgs("CLUSTER", "NODES"))
+	bulk, ok := result.(*protocol.BulkReply)
+	if !ok {
+		t.Fatalf("expect bulk reply, actual %s", string(result.ToBytes()))
+	}
+	lines := strings.Split(string(bulk.Arg), "\n")
+	if len(lines) != 3 || lines[2] != "" {
+		t.Fatalf("expect 2 lines ending with line break, actual %q", string(bulk.Arg))
+	}
+	selfLine := idA + " 127.0.0.1:6399@6399 myself,master - 0 0 1 connected 0-16383 [100->-" + idB + "] [200-<-" + idB + "]"
+	if !strings.Contains(string(bulk.Arg), selfLine+"\n") {
+		t.Errorf("expect line %q, actual %q", selfLine, string(bulk.Arg))
+	}
+	if !strings.Contains(string(bulk.Arg), idB+" 127.0.0.1:7379@7379 master - ") {
+		t.Errorf("node b not found: %q", string(bulk.Arg))
+	}
+
+	result = nodeA.Exec(conn, toArgs("CLUSTER", "INFO"))
+	asserts.AssertBulkReply(t, result, "cluster_state:ok\r\n"+
+		"cluster_slots_assigned:16384\r\n"+
+		"cluster_slots_ok:16384\r\n"+
+		"cluster_slots_pfail:0\r\n"+
+		"cluster_slots_fail:0\r\n"+
+		"cluster_known_nodes:2\r\n"+
+		"cluster_size:1\r\n"+
+		"cluster_current_epoch:1\r\n"+
+		"cluster_my_epoch:1\r\n"+
+		"total_cluster_links_buffer_limit_exceeded:0\r\n")
+
+	shardA := "*4\r\n$5\r\nslots\r\n*2\r\n:0\r\n:16383\r\n$5\r\nnodes\r\n*1\r\n" +
+		"*14\r\n$2\r\nid\r\n$40\r\n" + idA + "\r\n$4\r\nport\r\n:6399\r\n$2\r\nip\r\n$9\r\n127.0.0.1\r\n" +
+		"$8\r\nendpoint\r\n$9\r\n127.0.0.1\r\n$4\r\nrole\r\n$6\r\nmaster\r\n" +
+		"$18\r\nreplication-offset\r\n:0\r\n$6\r\nhealth\r\n$6\r\nonline\r\n"
+	result = nodeA.Exec(conn, toArgs("CLUSTER", "SHARDS"))
+	if actual := string(result.ToBytes()); !strings.HasPrefix(actual, "*2\r\n") || !strings.Contains(actual, shardA) {
+		t.Errorf("unexpected cluster shards %q", actual)
+	}
+}
+
+func TestClusterAddSlots(t *testing.T) {
+	nodeA := mockClusterNodes([]string{"127.0.0.1:6399"}, []bool{false})[0]
+	conn := connection.NewFakeConn()
+	result := nodeA.Exec(conn, toArgs("CLUSTER", "DELSLOTSRANGE", "0", "9", "100", "100"))
+	asserts.AssertStatusReply(t, result, "OK")
+	result = nodeA.Exec(conn, toArgs("CLUSTER", "DELSLOTS", "0"))
+	asserts.AssertErrReply(t, result, "ERR Slot 0 is already unassigned")
+	result = nodeA.Exec(conn, toArgs("CLUSTER", "INFO"))
+	if info := string(result.ToBytes()); !strings.Contains(info, "cluster_state:fail\r\n") ||
+		!strings.Contains(info, "cluster_slots_assigned:16373\r\n") {
+		t.Errorf("unexpected cluster info %q", info)
+	}
+
+	result = nodeA.Exec(conn, toArgs("CLUSTER", "ADDSLOTS", "0", "0"))
+	asserts.AssertErrReply(t, result, "ERR Slot 0 specified multiple times")
+	result = nodeA.Exec(conn, toArgs("CLUSTER", "ADDSLOTS", "0", "10"))
+	asserts.AssertErrReply(t, result, "ERR Slot 10 is already busy")
+	result = nodeA.Exec(conn, toArgs("CLUSTER", "ADDSLOTS", "16384"))
+	asserts.AssertErrReply(t, result, "ERR Invalid or out of range slot")
+	result = nodeA.Exec(conn, toArgs("CLUSTER", "ADDSLOTSRANGE", "5", "1"))
+	asserts.AssertErrReply(t, result, "ERR start slot number 5 is greater than end slot number 1")
+	result = nodeA.Exec(conn, toArgs("CLUSTER", "ADDSLOTSRANGE", "0", "9", "100"))
+	asserts.AssertErrReply(t, result, "ERR wrong number of arguments for 'cluster|addslotsrange' command")
+	result = nodeA.Exec(conn, toArgs("CLUSTER", "ADDSLOTSRANGE", "0", "9"))
+	asserts.AssertStatusReply(t, result, "OK")
+	result = nodeA.Exec(conn, toArgs("CLUSTER", "ADDSLOTS", "100"))
+	asserts.AssertStatusReply(t, result, "OK")
+	if owner := slotOwners(nodeA)[5]; owner != nodeA.topology.GetSelfNodeID() {
+		t.Errorf("slot 5 should be served by current node, actual %s", owner)
+	}
+	result = nodeA.Exec(conn, toArgs("CLUSTER", "INFO"))
+	if info := string(result.ToBytes()); !strings.Contains(info, "cluster_state:ok\r\n") {
+		t.Errorf("unexpected cluster info %q", info)
+	}
+}
+
+func TestClusterResetAndMeet(t *testing.T) {
+	nodes, _ := mockGossipNodes(t, []string{"127.0.0.1:6399", "127.0.0.1:7379"})
+	nodeA, nodeB := nodes[0], nodes[1]
+	idA := nodeA.topology.GetSelfNodeID()
+	oldIDB := nodeB.topology.GetSelfNodeID()
+	waitFor(t, "all nodes known", func() bool {
+		return len(nodeA.topology.GetNodes()) == 2 && len(nodeB.topology.GetNodes()) == 2
+	})
+	conn := connection.NewFakeConn()
+	result := nodeA.Exec(conn, toArgs("CLUSTER", "FORGET", idA))
+	asserts.AssertErrReply(t, result, "ERR I tried hard but I can't forget myself...")
+	result = nodeA.Exec(conn, toArgs("CLUSTER", "FORGET", "unknown"))
+	asserts.AssertErrReply(t, result, "ERR Unknown node unknown")
+
+	key := findKey(nodeA, "k")
+	result = nodeA.Exec(conn, toArgs("SET", key, "1"))
+	asserts.AssertStatusReply(t, result, "OK")
+	result = nodeA.Exec(conn, toArgs("CLUSTER", "RESET"))
+	asserts.AssertErrReply(t, result, "ERR CLUSTER RESET can't be called with master nodes containing keys")
+	result = nodeB.Exec(conn, toArgs("CLUSTER", "RESET", "ALL"))
+	asserts.AssertErrReply(t, result, "Err syntax error")
+
+	// node b leaves cluster with a new id, then meets node a again
+	result = nodeB.Exec(conn, toArgs("CLUSTER", "RESET", "HARD"))
+	asserts.AssertStatusReply(t, result, "OK")
+	idB := nodeB.topology.GetSelfNodeID()
+	if idB == oldIDB {
+		t.Error("hard reset should change node id")
+	}
+	result = nodeA.Exec(conn, toArgs("CLUSTER", "FORGET", oldIDB))
+	asserts.AssertStatusReply(t, result, "OK")
+	result = nodeB.Exec(conn, toArgs("CLUSTER", "MEET", "127.0.0.1", "abc"))
+	asserts.AssertErrReply(t, result, "ERR Invalid base port specified: abc")
+	result = nodeB.Exec(conn, toArgs("CLUSTER", "MEET", "localhost", "6399"))
+	asserts.AssertErrReply(t, result, "ERR Invalid node address specified: localhost:6399")
+	result = nodeB.Exec(conn, toArgs("CLUSTER", "MEET", "127.0.0.1", "6399", "16399"))
+	asserts.AssertStatusReply(t, result, "OK")
+	for _, node := range nodes {
+		node := node
+		waitFor(t, "nodes meet again", func() bool {
+			known := node.topology.GetNodes()
+			return len(known) == 2 && node.topology.GetNode(idA) != nil && node.topology.GetNode(idB) != nil
+		})
+	}
+	if owner := slotOwners(nodeB)[0]; owner != idA {
+		t.Errorf("node b should learn slots from node a, actual owner %s", owner)
+	}
+}
@@ -6,9 +6,6 @@ package cluster
 	@desc: //节点之间的通信
 */
 import (
-	"context"
-	"errors"
-	"github.com/Allen9012/Godis/godis/client"
 	"github.com/Allen9012/Godis/godis/protocol"
 	"github.com/Allen9012/Godis/interface/godis"
 	"github.com/Allen9012/Godis/lib/utils"
@@ -24,47 +21,15 @@ type clientFactory interface {
 	Close() error
 }
 
-// getPeerClient
-//
-//	 @Description: 获取一个peer连接池
-//	 @receiver cluster
-//	 @param peer
-//	 @return *client.Client
-//	 @return error
-//		1. 判断是否有这个peer
-//		2. 获取一个对象
-//		3. 断言成真正的类型
-func (cluster *Cluster) getPeerClient(peer string) (*client.Client, error) {
-	pool, ok := cluster.peerconnection[peer]
-	if !ok {
-		return nil, errors.New("connection not found")
-	}
-	object, err := pool.BorrowObject(context.Background())
-	if err != nil {
-		return nil, err
-	}
-	c, ok := object.(*client.Client)
-	if !ok {
-		return nil, errors.New("wrong type")
-	}
-	return c, err
-}
-
 /* ---- 三种执行模式 ----- */
 
-// returnPeerClient
-//
-//	@Description: 返回连接
-//	@receiver cluster
-//	@param peer
-//	@param peerClient
-//	@return error
-func (cluster *Cluster) returnPeerClient(peer string, peerClient *client.Client) error {
-	pool, ok := cluster.peerconnection[peer]
-	if !ok {
-		return errors.New("connection not found")
+// pickNode returns the node serving the slot
+func (cluster *Cluster) pickNode(slotID uint32) *Node {
+	slot := cluster.topology.GetSlots()[slotID]
+	if slot == nil {
+		return nil
 	}
-	return pool.ReturnObject(context.Background(), peerClient)
+	return cluster.topology.GetNode(slot.NodeID)
 }
 
 // relay
@@ -73,20 +38,24 @@ func (cluster *Cluster) returnPeerClient(peer string, peerClient *client.Client)
 //
 //	@Description: relays command to peer
 //	@receiver cluster
-//	@param peer
+//	@param peerID	节点 ID
 //	@param c
 //	@param args
 //	@return redis.Reply
-func (cluster *Cluster) relay(peer string, c godis.Connection, args [][]byte) godis.Reply {
-	if peer == cluster.self {
+func (cluster *Cluster) relay(peerID string, c godis.Connection, args [][]byte) godis.Reply {
+	if peerID == cluster.topology.GetSelfNodeID() {
 		return cluster.db.Exec(c, args)
 	}
-	peerClient, err := cluster.getPeerClient(peer)
+	node := cluster.topology.GetNode(peerID)
+	if node == nil {
+		return protocol.MakeErrReply("ERR Unknown node " + peerID)
+	}
+	peerClient, err := cluster.clientFactory.GetPeerClient(node.Addr)
 	if err != nil {
 		return protocol.MakeErrReply(err.Error())
 	}
 	defer func() {
-		_ = cluster.returnPeerClient(peer, peerClient)
+		_ = cluster.clientFactory.ReturnPeerClient(node.Addr, peerClient)
 	}()
 	peerClient.Send(utils.ToCmdLine("SELECT", strconv.Itoa(c.GetDBIndex())))
 	return peerClient.Send(args)
@@ -98,12 +67,12 @@ func (cluster *Cluster) relay(peer string, c godis.Connection, args [][]byte) go
 //	@receiver cluster
 //	@param c
 //	@param args
-//	@return map[string]redis.Reply
+//	@return map[string]redis.Reply	节点 ID : 回复
 func (cluster *Cluster) broadcast(c godis.Connection, args [][]byte) map[string]godis.Reply {
 	results := make(map[string]godis.Reply)
-	for _, node := range cluster.nodes {
-		result := cluster.relay(node, c, args)
-		results[node] = result
+	for _, node := range cluster.topology.GetNodes() {
+		result := cluster.relay(node.ID, c, args)
+		results[node.ID] = result
 	}
 	return results
 }
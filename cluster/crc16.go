@@ -0,0 +1,36 @@
+package cluster
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/20
+  @desc: CRC16/XMODEM, 与 redis cluster 计算槽的算法相同, 集群客户端才能在本地算出正确的节点
+  @modified by:
+**/
+
+var crc16Table = makeCrc16Table(0x1021)
+
+func makeCrc16Table(poly uint16) [256]uint16 {
+	var table [256]uint16
+	for i := range table {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ poly
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}
+
+// crc16 returns CRC16/XMODEM checksum of data, eg: crc16("123456789") == 0x31c3
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^b]
+	}
+	return crc
+}
@@ -0,0 +1,32 @@
+package cluster
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/20
+  @desc: crc16 and slot of key
+  @modified by:
+**/
+
+import "testing"
+
+func TestGetSlot(t *testing.T) {
+	if crc16([]byte("123456789")) != 0x31c3 {
+		t.Error("wrong crc16 checksum")
+	}
+	// slots calculated by redis cluster
+	slots := map[string]uint32{
+		"foo":                  12182,
+		"bar":                  5061,
+		"{user1000}.following": 3443,
+		"{user1000}.followers": 3443,
+		"foo{}{bar}":           8363,
+		"foo{{bar}}zap":        4015,
+		"foo{bar}{zap}":        5061,
+	}
+	for key, slot := range slots {
+		if actual := getSlot(key); actual != slot {
+			t.Errorf("expect slot of %s is %d, actual %d", key, slot, actual)
+		}
+	}
+}
@@ -1,19 +1,206 @@
 package cluster
 
-import "sync"
+import (
+	"github.com/Allen9012/Godis/godis/protocol"
+	"sort"
+	"sync"
+)
 
 /**
   Copyright © 2023 github.com/Allen9012 All rights reserved.
   @author: Allen
   @since: 2023/9/23
-  @desc:
+  @desc: 由配置文件中的 self 和 peers 生成的固定拓扑, 节点 ID 即节点地址
+	所有节点按地址排序后平分 16384 个槽, 因此各节点计算出的槽分布相同
   @modified by:
 **/
 
-// fixedTopology is a fixed cluster topology, used for test
+// fixedTopology is a fixed cluster topology built from self and peers in config, also used for test
 type fixedTopology struct {
-	mu         sync.RWMutex
-	nodeMap    map[string]*Node
+	mu      sync.RWMutex
+	nodeMap map[string]*Node
+	// slots is replaced as a whole when modified, so the slice returned by GetSlots never changes
 	slots      []*Slot
 	selfNodeID string
 }
+
+// newFixedTopology
+//
+//	@Description: 按地址排序后每个节点分配一段连续的槽
+//	@param self	当前节点地址
+//	@param addrs	集群中所有节点的地址, 可以包含 self
+//	@return *fixedTopology
+func newFixedTopology(self string, addrs []string) *fixedTopology {
+	addrSet := map[string]struct{}{self: {}}
+	for _, addr := range addrs {
+		addrSet[addr] = struct{}{}
+	}
+	sorted := make([]string, 0, len(addrSet))
+	for addr := range addrSet {
+		sorted = append(sorted, addr)
+	}
+	sort.Strings(sorted)
+
+	nodeMap := make(map[string]*Node, len(sorted))
+	slots := make([]*Slot, slotCount)
+	for i, addr := range sorted {
+		node := &Node{
+			ID:   addr,
+			Addr: addr,
+		}
+		nodeMap[addr] = node
+		begin, end := i*slotCount/len(sorted), (i+1)*slotCount/len(sorted)
+		for slotID := begin; slotID < end; slotID++ {
+			slots[slotID] = &Slot{
+				ID:     uint32(slotID),
+				NodeID: addr,
+			}
+			node.Slots = append(node.Slots, slots[slotID])
+		}
+	}
+	return &fixedTopology{
+		nodeMap:    nodeMap,
+		slots:      slots,
+		selfNodeID: self,
+	}
+}
+
+func (fixed *fixedTopology) GetSelfNodeID() string {
+	return fixed.selfNodeID
+}
+
+// GetNodes returns a copy of all nodes
+func (fixed *fixedTopology) GetNodes() []*Node {
+	fixed.mu.RLock()
+	defer fixed.mu.RUnlock()
+	result := make([]*Node, 0, len(fixed.nodeMap))
+	for _, node := range fixed.nodeMap {
+		result = append(result, node)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// GetNode returns node with the given id, returns nil if not found
+func (fixed *fixedTopology) GetNode(nodeID string) *Node {
+	fixed.mu.RLock()
+	defer fixed.mu.RUnlock()
+	return fixed.nodeMap[nodeID]
+}
+
+// GetSlots returns all slots indexed by slot id, invoker should not modify it
+func (fixed *fixedTopology) GetSlots() []*Slot {
+	fixed.mu.RLock()
+	defer fixed.mu.RUnlock()
+	return fixed.slots
+}
+
+// StartAsSeed is a no-op because all nodes of fixed topology are known at start
+func (fixed *fixedTopology) StartAsSeed(addr string) protocol.ErrorReply {
+	return nil
+}
+
+// SetSlot moves slots to the given node
+//
+//	@Description: 复制后修改, 已经通过 GetSlots 获取到的切片不受影响, newNodeID 为空表示取消分配
+//	@receiver fixed
+//	@param slotIDs
+//	@param newNodeID
+//	@return protocol.ErrorReply
+func (fixed *fixedTopology) SetSlot(slotIDs []uint32, newNodeID string) protocol.ErrorReply {
+	fixed.mu.Lock()
+	defer fixed.mu.Unlock()
+	if _, ok := fixed.nodeMap[newNodeID]; !ok && newNodeID != "" {
+		return protocol.MakeErrReply("ERR Unknown node " + newNodeID)
+	}
+	slots := make([]*Slot, slotCount)
+	copy(slots, fixed.slots)
+	for _, slotID := range slotIDs {
+		if int(slotID) >= slotCount {
+			return protocol.MakeErrReply("ERR Invalid or out of range slot")
+		}
+		slots[slotID] = &Slot{
+			ID:     slotID,
+			NodeID: newNodeID,
+		}
+	}
+	fixed.slots = slots
+	fixed.rebuildNodeSlots()
+	return nil
+}
+
+// rebuildNodeSlots refreshes slots of every node, invoker should hold lock
+func (fixed *fixedTopology) rebuildNodeSlots() {
+	nodeMap := make(map[string]*Node, len(fixed.nodeMap))
+	for id, node := range fixed.nodeMap {
+		nodeMap[id] = &Node{
+			ID:    node.ID,
+			Addr:  node.Addr,
+			Flags: node.Flags,
+		}
+	}
+	for _, slot := range fixed.slots {
+		if slot == nil {
+			continue
+		}
+		if node, ok := nodeMap[slot.NodeID]; ok {
+			node.Slots = append(node.Slots, slot)
+		}
+	}
+	fixed.nodeMap = nodeMap
+}
+
+// LoadConfigFile is a no-op because fixed topology is read from config
+func (fixed *fixedTopology) LoadConfigFile() protocol.ErrorReply {
+	return nil
+}
+
+func (fixed *fixedTopology) Join(seed string) protocol.ErrorReply {
+	return protocol.MakeErrReply("ERR fixed topology cannot join another cluster")
+}
+
+// Meet is not supported, nodes of fixed topology are listed in peers
+func (fixed *fixedTopology) Meet(addr string) protocol.ErrorReply {
+	return protocol.MakeErrReply("ERR fixed topology cannot meet other nodes, add the node into peers instead")
+}
+
+// Forget removes node until restart, slots served by it become unassigned
+func (fixed *fixedTopology) Forget(nodeID string) protocol.ErrorReply {
+	fixed.mu.Lock()
+	defer fixed.mu.Unlock()
+	if nodeID == fixed.selfNodeID {
+		return protocol.MakeErrReply("ERR I tried hard but I can't forget myself...")
+	}
+	if _, ok := fixed.nodeMap[nodeID]; !ok {
+		return protocol.MakeErrReply("ERR Unknown node " + nodeID)
+	}
+	delete(fixed.nodeMap, nodeID)
+	slots := make([]*Slot, slotCount)
+	for i, slot := range fixed.slots {
+		if slot != nil && slot.NodeID != nodeID {
+			slots[i] = slot
+		}
+	}
+	fixed.slots = slots
+	fixed.rebuildNodeSlots()
+	return nil
+}
+
+// Reset keeps only current node without slots, node id is the address so it never changes
+func (fixed *fixedTopology) Reset(hard bool) protocol.ErrorReply {
+	fixed.mu.Lock()
+	defer fixed.mu.Unlock()
+	self := fixed.nodeMap[fixed.selfNodeID]
+	fixed.nodeMap = map[string]*Node{
+		self.ID: self,
+	}
+	fixed.slots = make([]*Slot, slotCount)
+	fixed.rebuildNodeSlots()
+	return nil
+}
+
+func (fixed *fixedTopology) Close() error {
+	return nil
+}
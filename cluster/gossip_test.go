@@ -0,0 +1,231 @@
+package cluster
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/22
+  @desc: gossip topology
+  @modified by:
+**/
+
+import (
+	database2 "github.com/Allen9012/Godis/database"
+	"github.com/Allen9012/Godis/datastruct/dict"
+	"github.com/Allen9012/Godis/lib/idgenerator"
+	"github.com/Allen9012/Godis/slowlog"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testNodeTimeout = 200 * time.Millisecond
+
+// mockGossipNodes creates a cluster in which the first node is seed and the others join it
+func mockGossipNodes(t *testing.T, addresses []string) ([]*Cluster, *testClientFactory) {
+	nodes := make([]*Cluster, len(addresses))
+	factory := &testClientFactory{
+		nodes:        nodes,
+		timeoutFlags: make([]bool, len(addresses)),
+	}
+	for i, addr := range addresses {
+		nodes[i] = &Cluster{
+			self:          addr,
+			db:            database2.NewStandaloneServer(),
+			transactions:  dict.MakeSimple(),
+			idGenerator:   idgenerator.MakeGenerator(addr),
+			topology:      newGossipTopology(addr, factory, "", testNodeTimeout),
+			slots:         make(map[uint32]*hostSlot),
+			slowlog:       slowlog.MakeSlowLog(),
+			clientFactory: factory,
+		}
+	}
+	if err := nodes[0].topology.StartAsSeed(addresses[0]); err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, node := range nodes[1:] {
+		if err := node.topology.Join(addresses[0]); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	t.Cleanup(func() {
+		for _, node := range nodes {
+			_ = node.topology.Close()
+		}
+	})
+	return nodes, factory
+}
+
+// waitFor checks cond until it returns true or timeout
+func waitFor(t *testing.T, desc string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for " + desc)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// slotOwners returns node id of every slot
+func slotOwners(cluster *Cluster) []string {
+	slots := cluster.topology.GetSlots()
+	owners := make([]string, len(slots))
+	for i, slot := range slots {
+		if slot != nil {
+			owners[i] = slot.NodeID
+		}
+	}
+	return owners
+}
+
+func sameSlots(nodes []*Cluster) bool {
+	expected := slotOwners(nodes[0])
+	for _, node := range nodes[1:] {
+		owners := slotOwners(node)
+		for i := range owners {
+			if owners[i] != expected[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestGossipJoin(t *testing.T) {
+	nodes, _ := mockGossipNodes(t, []string{"127.0.0.1:6399", "127.0.0.1:7379", "127.0.0.1:8379"})
+	waitFor(t, "all nodes known", func() bool {
+		for _, node := range nodes {
+			if len(node.topology.GetNodes()) != len(nodes) {
+				return false
+			}
+		}
+		return true
+	})
+	seedID := nodes[0].topology.GetSelfNodeID()
+	for _, node := range nodes {
+		if owner := slotOwners(node)[100]; owner != seedID {
+			t.Errorf("expect slot served by seed %s, actual %s", seedID, owner)
+		}
+	}
+
+	// slots are moved to new owner whose config epoch is larger
+	idB := nodes[1].topology.GetSelfNodeID()
+	idC := nodes[2].topology.GetSelfNodeID()
+	var slotsB, slotsC []uint32
+	for i := uint32(5461); i < 10923; i++ {
+		slotsB = append(slotsB, i)
+	}
+	for i := uint32(10923); int(i) < slotCount; i++ {
+		slotsC = append(slotsC, i)
+	}
+	if err := nodes[0].topology.SetSlot(slotsB, idB); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := nodes[0].topology.SetSlot(slotsC, idC); err != nil {
+		t.Fatal(err.Error())
+	}
+	waitFor(t, "slots converged", func() bool {
+		return sameSlots(nodes)
+	})
+	owners := slotOwners(nodes[2])
+	if owners[0] != seedID || owners[5461] != idB || owners[slotCount-1] != idC {
+		t.Errorf("wrong slot owners: %s %s %s", owners[0], owners[5461], owners[slotCount-1])
+	}
+	if epoch := nodes[1].topology.GetNode(idC).ConfigEpoch; epoch != 3 {
+		t.Errorf("expect config epoch 3, actual %d", epoch)
+	}
+
+	// stale claim with smaller epoch is ignored
+	topoB := nodes[1].topology.(*gossipTopology)
+	topoB.merge(&gossipMessage{
+		Type:   gossipPing,
+		Sender: seedID,
+		Nodes: []*gossipNode{
+			{ID: seedID, Addr: "127.0.0.1:6399", ConfigEpoch: 1, Slots: [][2]uint32{{0, uint32(slotCount - 1)}}},
+		},
+	})
+	if owner := slotOwners(nodes[1])[5461]; owner != idB {
+		t.Errorf("stale claim should be ignored, actual owner %s", owner)
+	}
+}
+
+func TestGossipFailureDetection(t *testing.T) {
+	nodes, factory := mockGossipNodes(t, []string{"127.0.0.1:6399", "127.0.0.1:7379", "127.0.0.1:8379"})
+	seedID := nodes[0].topology.GetSelfNodeID()
+	idC := nodes[2].topology.GetSelfNodeID()
+	waitFor(t, "all nodes known", func() bool {
+		for _, node := range nodes {
+			if len(node.topology.GetNodes()) != len(nodes) {
+				return false
+			}
+		}
+		return true
+	})
+	// every node serves slots so that they all vote
+	if err := nodes[0].topology.SetSlot([]uint32{1}, nodes[1].topology.GetSelfNodeID()); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := nodes[0].topology.SetSlot([]uint32{2}, idC); err != nil {
+		t.Fatal(err.Error())
+	}
+	waitFor(t, "slots converged", func() bool {
+		return sameSlots(nodes)
+	})
+
+	// node C is down
+	_ = nodes[2].topology.Close()
+	factory.setTimeout(2, true)
+	waitFor(t, "node marked as failing", func() bool {
+		for _, node := range nodes[:2] {
+			if node.topology.GetNode(idC).Flags&nodeFlagFail == 0 {
+				return false
+			}
+		}
+		return true
+	})
+	if node := nodes[0].topology.GetNode(seedID); node.Flags != 0 {
+		t.Errorf("alive node should not be marked, actual flags %d", node.Flags)
+	}
+}
+
+func TestGossipConfigFile(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "nodes.conf")
+	factory := &testClientFactory{}
+	topo := newGossipTopology("127.0.0.1:6399", factory, configFile, testNodeTimeout)
+	if err := topo.StartAsSeed("127.0.0.1:6399"); err != nil {
+		t.Fatal(err.Error())
+	}
+	topo.merge(&gossipMessage{
+		Type:         gossipPing,
+		Sender:       "b",
+		CurrentEpoch: 2,
+		Nodes: []*gossipNode{
+			{ID: "b", Addr: "127.0.0.1:7379", ConfigEpoch: 2, Slots: [][2]uint32{{100, 200}, {300, 300}}},
+		},
+	})
+	_ = topo.Close()
+
+	loaded := newGossipTopology("", factory, configFile, testNodeTimeout)
+	if err := loaded.LoadConfigFile(); err != nil {
+		t.Fatal(err.Error())
+	}
+	defer func() {
+		_ = loaded.Close()
+	}()
+	if loaded.GetSelfNodeID() != topo.GetSelfNodeID() || loaded.selfAddr != "127.0.0.1:6399" {
+		t.Errorf("wrong self node %s %s", loaded.GetSelfNodeID(), loaded.selfAddr)
+	}
+	if loaded.currentEpoch != 2 {
+		t.Errorf("expect current epoch 2, actual %d", loaded.currentEpoch)
+	}
+	nodeB := loaded.GetNode("b")
+	if nodeB == nil || nodeB.Addr != "127.0.0.1:7379" || nodeB.ConfigEpoch != 2 || len(nodeB.Slots) != 102 {
+		t.Fatalf("wrong node b: %+v", nodeB)
+	}
+	expected := topo.GetSlots()
+	for i, slot := range loaded.GetSlots() {
+		if slot.NodeID != expected[i].NodeID {
+			t.Fatalf("slot %d: expect %s, actual %s", i, expected[i].NodeID, slot.NodeID)
+		}
+	}
+}
@@ -0,0 +1,740 @@
+package cluster
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/interface/godis"
+	"github.com/Allen9012/Godis/lib/logger"
+	"github.com/Allen9012/Godis/lib/utils"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/22
+  @desc: 基于 gossip 的动态拓扑
+	1. cluster-as-seed 的节点持有所有槽启动集群, 其他节点向 cluster-seed 发送 MEET 加入
+	2. 节点定期向其他节点发送 PING, 对方回复 PONG, 消息中带有发送者看到的所有节点和槽
+	3. 节点通过 config epoch 声明自己的槽, epoch 更大的声明生效, 修改槽时递增 epoch
+	4. 超过 cluster-node-timeout 没有收到消息的节点标记为 PFAIL, 多数 master 认为 PFAIL 时标记为 FAIL 并广播
+	5. 拓扑变化时保存到 cluster-config-file, 格式与 redis 的 nodes.conf 相同
+  @modified by:
+**/
+
+// types of gossip message
+const (
+	gossipMeet = "meet"
+	gossipPing = "ping"
+	gossipPong = "pong"
+	gossipFail = "fail"
+)
+
+// gossipNode is the view of a node in gossip message
+type gossipNode struct {
+	ID          string      `json:"id"`
+	Addr        string      `json:"addr"`
+	ConfigEpoch uint64      `json:"epoch"`
+	Flags       uint32      `json:"flags,omitempty"`
+	Slots       [][2]uint32 `json:"slots,omitempty"` // ranges of slots, both ends included
+}
+
+// gossipMessage is sent by `gossip <json>` command through connections between nodes
+type gossipMessage struct {
+	Type         string `json:"type"`
+	Sender       string `json:"sender"`
+	CurrentEpoch uint64 `json:"currentEpoch"`
+	// Nodes contains all nodes known by sender, including sender itself
+	Nodes []*gossipNode `json:"nodes,omitempty"`
+	// Failed is the node marked as FAIL in fail message
+	Failed string `json:"failed,omitempty"`
+}
+
+// gossipTopology is a cluster topology maintained by gossip between nodes
+type gossipTopology struct {
+	mu         sync.RWMutex
+	selfNodeID string
+	selfAddr   string
+	nodes      map[string]*Node // Slots of node are rebuilt when slots changed
+	// slots is replaced as a whole when modified, so the slice returned by GetSlots never changes
+	slots        []*Slot
+	currentEpoch uint64
+	// failReports[nodeID][reporterID] is the last time reporter told us node is failing
+	failReports map[string]map[string]time.Time
+	// forgotten[nodeID] is the deadline before which gossip about the node is ignored, so that it is not added back
+	forgotten map[string]time.Time
+	// seed is the node to meet again if current node failed to join cluster
+	seed string
+
+	clientFactory clientFactory
+	configFile    string
+	nodeTimeout   time.Duration
+	// pinging holds nodes waiting for pong, to avoid sending another ping
+	pinging sync.Map
+
+	startOnce sync.Once
+	closeOnce sync.Once
+	stopped   chan struct{}
+	cronDone  chan struct{}
+}
+
+// newGossipTopology
+//
+//	@Description: 创建后需要调用 StartAsSeed, Join 或 LoadConfigFile 之一
+//	@param selfAddr	当前节点地址
+//	@param factory	用于向其他节点发送消息
+//	@param configFile	保存拓扑的文件, 为空时不保存
+//	@param nodeTimeout
+//	@return *gossipTopology
+func newGossipTopology(selfAddr string, factory clientFactory, configFile string, nodeTimeout time.Duration) *gossipTopology {
+	return &gossipTopology{
+		selfAddr:      selfAddr,
+		nodes:         make(map[string]*Node),
+		slots:         make([]*Slot, slotCount),
+		failReports:   make(map[string]map[string]time.Time),
+		forgotten:     make(map[string]time.Time),
+		clientFactory: factory,
+		configFile:    configFile,
+		nodeTimeout:   nodeTimeout,
+		stopped:       make(chan struct{}),
+		cronDone:      make(chan struct{}),
+	}
+}
+
+func (topo *gossipTopology) GetSelfNodeID() string {
+	topo.mu.RLock()
+	defer topo.mu.RUnlock()
+	return topo.selfNodeID
+}
+
+func (topo *gossipTopology) GetNodes() []*Node {
+	topo.mu.RLock()
+	defer topo.mu.RUnlock()
+	return copyNodes(topo.nodes)
+}
+
+func (topo *gossipTopology) GetNode(nodeID string) *Node {
+	topo.mu.RLock()
+	defer topo.mu.RUnlock()
+	node, ok := topo.nodes[nodeID]
+	if !ok {
+		return nil
+	}
+	return copyNode(node)
+}
+
+func (topo *gossipTopology) GetSlots() []*Slot {
+	topo.mu.RLock()
+	defer topo.mu.RUnlock()
+	return topo.slots
+}
+
+// StartAsSeed bootstraps a cluster in which current node serves all slots
+func (topo *gossipTopology) StartAsSeed(addr string) protocol.ErrorReply {
+	topo.mu.Lock()
+	topo.selfAddr = addr
+	self := topo.makeSelf()
+	topo.currentEpoch++
+	self.ConfigEpoch = topo.currentEpoch
+	slots := make([]*Slot, slotCount)
+	for i := range slots {
+		slots[i] = &Slot{
+			ID:     uint32(i),
+			NodeID: self.ID,
+		}
+	}
+	topo.slots = slots
+	rebuildNodeSlots(topo.nodes, topo.slots)
+	topo.saveWithLock()
+	topo.mu.Unlock()
+	topo.start()
+	return nil
+}
+
+// makeSelf creates current node if not exists, invoker should hold lock
+func (topo *gossipTopology) makeSelf() *Node {
+	if self, ok := topo.nodes[topo.selfNodeID]; ok {
+		return self
+	}
+	self := &Node{
+		ID:        utils.RandHexString(40),
+		Addr:      topo.selfAddr,
+		lastHeard: time.Now(),
+	}
+	topo.selfNodeID = self.ID
+	topo.nodes[self.ID] = self
+	return self
+}
+
+// Join sends MEET to seed, current node knows the whole cluster from the pong of seed
+//
+//	@Description: 加入失败时后台会继续尝试, 直到知道其他节点
+//	@receiver topo
+//	@param seed	集群中任意节点的地址
+//	@return protocol.ErrorReply
+func (topo *gossipTopology) Join(seed string) protocol.ErrorReply {
+	topo.mu.Lock()
+	topo.makeSelf()
+	topo.seed = seed
+	topo.saveWithLock()
+	topo.mu.Unlock()
+	err := topo.meet(seed)
+	topo.start()
+	if err != nil {
+		return protocol.MakeErrReply("ERR join cluster failed: " + err.Error())
+	}
+	return nil
+}
+
+// meet introduces current node to the node at addr
+func (topo *gossipTopology) meet(addr string) error {
+	reply, err := topo.send(addr, topo.makeMessage(gossipMeet))
+	if err != nil {
+		return err
+	}
+	topo.handlePong(reply)
+	return nil
+}
+
+// LoadConfigFile restores topology saved in cluster-config-file
+func (topo *gossipTopology) LoadConfigFile() protocol.ErrorReply {
+	data, err := os.ReadFile(topo.configFile)
+	if err != nil {
+		return protocol.MakeErrReply("ERR read cluster config file failed: " + err.Error())
+	}
+	nodes, selfID, currentEpoch, err := unmarshalNodes(data)
+	if err != nil {
+		return protocol.MakeErrReply("ERR invalid cluster config file: " + err.Error())
+	}
+	topo.mu.Lock()
+	now := time.Now()
+	slots := make([]*Slot, slotCount)
+	for _, node := range nodes {
+		node.lastHeard = now
+		topo.nodes[node.ID] = node
+		for _, slot := range node.Slots {
+			slots[slot.ID] = slot
+		}
+	}
+	topo.selfNodeID = selfID
+	topo.selfAddr = topo.nodes[selfID].Addr
+	topo.currentEpoch = currentEpoch
+	topo.slots = slots
+	rebuildNodeSlots(topo.nodes, topo.slots)
+	topo.mu.Unlock()
+	topo.start()
+	return nil
+}
+
+// SetSlot assigns slots to node and increases its config epoch so that the new assignment wins in gossip
+//
+//	@Description: newNodeID 为空表示取消分配, 这个修改不会传播给其他节点
+//	@receiver topo
+//	@param slotIDs
+//	@param newNodeID
+//	@return protocol.ErrorReply
+func (topo *gossipTopology) SetSlot(slotIDs []uint32, newNodeID string) protocol.ErrorReply {
+	topo.mu.Lock()
+	defer topo.mu.Unlock()
+	if newNodeID != "" {
+		node, ok := topo.nodes[newNodeID]
+		if !ok {
+			return protocol.MakeErrReply("ERR Unknown node " + newNodeID)
+		}
+		topo.currentEpoch++
+		node.ConfigEpoch = topo.currentEpoch
+	}
+	slots := make([]*Slot, slotCount)
+	copy(slots, topo.slots)
+	for _, slotID := range slotIDs {
+		if int(slotID) >= slotCount {
+			return protocol.MakeErrReply("ERR Invalid or out of range slot")
+		}
+		slots[slotID] = &Slot{
+			ID:     slotID,
+			NodeID: newNodeID,
+		}
+	}
+	topo.slots = slots
+	rebuildNodeSlots(topo.nodes, topo.slots)
+	topo.saveWithLock()
+	return nil
+}
+
+// Meet introduces node at addr into cluster, the others will know it through gossip
+func (topo *gossipTopology) Meet(addr string) protocol.ErrorReply {
+	if err := topo.meet(addr); err != nil {
+		return protocol.MakeErrReply("ERR meet " + addr + " failed: " + err.Error())
+	}
+	return nil
+}
+
+// forgetTTL is how long gossip about forgotten node is ignored
+const forgetTTL = time.Minute
+
+// Forget removes node and its slots
+//
+//	@Description: 其他节点仍可能通过 gossip 传回被遗忘的节点, 因此在 forgetTTL 内忽略关于它的消息,
+//	需要在所有节点上执行 FORGET
+//	@receiver topo
+//	@param nodeID
+//	@return protocol.ErrorReply
+func (topo *gossipTopology) Forget(nodeID string) protocol.ErrorReply {
+	topo.mu.Lock()
+	defer topo.mu.Unlock()
+	if nodeID == topo.selfNodeID {
+		return protocol.MakeErrReply("ERR I tried hard but I can't forget myself...")
+	}
+	node, ok := topo.nodes[nodeID]
+	if !ok {
+		return protocol.MakeErrReply("ERR Unknown node " + nodeID)
+	}
+	if self := topo.nodes[topo.selfNodeID]; self != nil && self.MasterID == nodeID {
+		return protocol.MakeErrReply("ERR Can't forget my master!")
+	}
+	delete(topo.nodes, nodeID)
+	delete(topo.failReports, nodeID)
+	topo.forgotten[nodeID] = time.Now().Add(forgetTTL)
+	if len(node.Slots) > 0 {
+		slots := make([]*Slot, slotCount)
+		copy(slots, topo.slots)
+		for _, slot := range node.Slots {
+			slots[slot.ID] = nil
+		}
+		topo.slots = slots
+	}
+	rebuildNodeSlots(topo.nodes, topo.slots)
+	topo.saveWithLock()
+	return nil
+}
+
+// Reset forgets all other nodes and releases all slots
+//
+//	@Description: hard reset 时生成新的节点 ID 并将 epoch 清零
+//	@receiver topo
+//	@param hard
+//	@return protocol.ErrorReply
+func (topo *gossipTopology) Reset(hard bool) protocol.ErrorReply {
+	topo.mu.Lock()
+	defer topo.mu.Unlock()
+	self := topo.makeSelf()
+	self.Slots = nil
+	self.Flags = 0
+	self.MasterID = ""
+	topo.forgotten = make(map[string]time.Time)
+	if hard {
+		// 其他节点仍会传播旧 ID, 忽略它以免把自己当作另一个节点
+		topo.forgotten[self.ID] = time.Now().Add(forgetTTL)
+		self.ID = utils.RandHexString(40)
+		self.ConfigEpoch = 0
+		topo.selfNodeID = self.ID
+		topo.currentEpoch = 0
+	}
+	topo.nodes = map[string]*Node{
+		self.ID: self,
+	}
+	topo.slots = make([]*Slot, slotCount)
+	topo.failReports = make(map[string]map[string]time.Time)
+	topo.seed = ""
+	topo.saveWithLock()
+	return nil
+}
+
+// saveWithLock writes topology into cluster-config-file, invoker should hold lock
+func (topo *gossipTopology) saveWithLock() {
+	if topo.configFile == "" {
+		return
+	}
+	nodes := make([]*Node, 0, len(topo.nodes))
+	for _, node := range topo.nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].ID < nodes[j].ID
+	})
+	data := marshalNodes(nodes, topo.selfNodeID, topo.currentEpoch)
+	// 先写临时文件再重命名, 避免宕机时留下不完整的文件
+	tmpFile := topo.configFile + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		logger.Error("save cluster config failed: " + err.Error())
+		return
+	}
+	if err := os.Rename(tmpFile, topo.configFile); err != nil {
+		logger.Error("save cluster config failed: " + err.Error())
+	}
+}
+
+// makeMessage makes a message containing all nodes known by current node
+func (topo *gossipTopology) makeMessage(msgType string) *gossipMessage {
+	topo.mu.RLock()
+	defer topo.mu.RUnlock()
+	msg := &gossipMessage{
+		Type:         msgType,
+		Sender:       topo.selfNodeID,
+		CurrentEpoch: topo.currentEpoch,
+		Nodes:        make([]*gossipNode, 0, len(topo.nodes)),
+	}
+	for _, node := range topo.nodes {
+		info := &gossipNode{
+			ID:          node.ID,
+			Addr:        node.Addr,
+			ConfigEpoch: node.ConfigEpoch,
+			Flags:       node.Flags,
+		}
+		for _, r := range getSlotRanges(node.Slots) {
+			info.Slots = append(info.Slots, [2]uint32{r.begin, r.end})
+		}
+		msg.Nodes = append(msg.Nodes, info)
+	}
+	return msg
+}
+
+// send sends message to peer and returns its reply, reply is nil if peer replies OK
+func (topo *gossipTopology) send(addr string, msg *gossipMessage) (*gossipMessage, error) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	peer, err := topo.clientFactory.GetPeerClient(addr)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = topo.clientFactory.ReturnPeerClient(addr, peer)
+	}()
+	reply := peer.Send(utils.ToCmdLine("gossip", string(payload)))
+	switch r := reply.(type) {
+	case *protocol.BulkReply:
+		result := &gossipMessage{}
+		if err := json.Unmarshal(r.Arg, result); err != nil {
+			return nil, err
+		}
+		return result, nil
+	case protocol.ErrorReply:
+		return nil, errors.New(r.Error())
+	}
+	return nil, nil
+}
+
+// execGossip handles `gossip <json>` sent by other nodes
+func execGossip(cluster *Cluster, c godis.Connection, cmdArgs [][]byte) godis.Reply {
+	if len(cmdArgs) != 2 {
+		return protocol.MakeArgNumErrReply("gossip")
+	}
+	topo, ok := cluster.topology.(*gossipTopology)
+	if !ok {
+		return protocol.MakeErrReply("ERR gossip is not enabled")
+	}
+	msg := &gossipMessage{}
+	if err := json.Unmarshal(cmdArgs[1], msg); err != nil {
+		return protocol.MakeErrReply("ERR invalid gossip message: " + err.Error())
+	}
+	switch msg.Type {
+	case gossipMeet, gossipPing:
+		topo.merge(msg)
+		payload, err := json.Marshal(topo.makeMessage(gossipPong))
+		if err != nil {
+			return protocol.MakeErrReply(err.Error())
+		}
+		return protocol.MakeBulkReply(payload)
+	case gossipFail:
+		topo.markFailed(msg.Failed)
+		return protocol.MakeOkReply()
+	}
+	return protocol.MakeErrReply("ERR unknown gossip message type " + msg.Type)
+}
+
+func (topo *gossipTopology) handlePong(msg *gossipMessage) {
+	if msg == nil || msg.Type != gossipPong {
+		return
+	}
+	topo.merge(msg)
+}
+
+// merge updates topology with the view of sender
+//
+//	@Description: 收到发送者的消息说明发送者可达, 清除它的故障标记
+//	节点的 config epoch 比本地更大时, 先释放它不再声明的槽, 再把它声明的槽分配给它(原持有者 epoch 更小时)
+//	@receiver topo
+//	@param msg
+func (topo *gossipTopology) merge(msg *gossipMessage) {
+	topo.mu.Lock()
+	defer topo.mu.Unlock()
+	changed := false
+	if msg.CurrentEpoch > topo.currentEpoch {
+		topo.currentEpoch = msg.CurrentEpoch
+		changed = true
+	}
+	now := time.Now()
+	var newer []*gossipNode
+	releasedSlots := make(map[uint32]struct{})
+	for _, info := range msg.Nodes {
+		if info.ID == "" {
+			continue
+		}
+		if deadline, ok := topo.forgotten[info.ID]; ok {
+			if now.Before(deadline) {
+				continue
+			}
+			delete(topo.forgotten, info.ID)
+		}
+		node, ok := topo.nodes[info.ID]
+		if !ok {
+			node = &Node{
+				ID:        info.ID,
+				Addr:      info.Addr,
+				lastHeard: now,
+			}
+			topo.nodes[info.ID] = node
+			changed = true
+		}
+		if info.ID == msg.Sender {
+			if node.Addr != info.Addr && info.ID != topo.selfNodeID {
+				node.Addr = info.Addr
+				changed = true
+			}
+			node.lastHeard = now
+			node.pingSent = time.Time{}
+			if node.Flags&(nodeFlagPFail|nodeFlagFail) != 0 {
+				node.Flags &^= nodeFlagPFail | nodeFlagFail
+				delete(topo.failReports, node.ID)
+				changed = true
+			}
+		} else if info.ID != topo.selfNodeID {
+			topo.updateFailReport(info, msg.Sender, now)
+		}
+		if info.ConfigEpoch > node.ConfigEpoch {
+			claimed := make(map[uint32]struct{})
+			for _, r := range info.Slots {
+				for slotID := r[0]; slotID <= r[1] && int(slotID) < slotCount; slotID++ {
+					claimed[slotID] = struct{}{}
+				}
+			}
+			for _, slot := range node.Slots {
+				if _, ok := claimed[slot.ID]; !ok {
+					releasedSlots[slot.ID] = struct{}{}
+				}
+			}
+			node.ConfigEpoch = info.ConfigEpoch
+			newer = append(newer, info)
+			changed = true
+		}
+	}
+	if len(newer) > 0 || len(releasedSlots) > 0 {
+		slots := make([]*Slot, slotCount)
+		copy(slots, topo.slots)
+		for slotID := range releasedSlots {
+			slots[slotID] = nil
+		}
+		for _, info := range newer {
+			for _, r := range info.Slots {
+				for slotID := r[0]; slotID <= r[1] && int(slotID) < slotCount; slotID++ {
+					if cur := slots[slotID]; cur != nil && cur.NodeID != info.ID {
+						if owner, ok := topo.nodes[cur.NodeID]; ok && owner.ConfigEpoch >= info.ConfigEpoch {
+							continue
+						}
+					}
+					slots[slotID] = &Slot{
+						ID:     slotID,
+						NodeID: info.ID,
+					}
+				}
+			}
+		}
+		topo.slots = slots
+		rebuildNodeSlots(topo.nodes, topo.slots)
+	}
+	if changed {
+		topo.saveWithLock()
+	}
+}
+
+// updateFailReport records whether reporter thinks the node is failing, invoker should hold lock
+func (topo *gossipTopology) updateFailReport(info *gossipNode, reporter string, now time.Time) {
+	reports := topo.failReports[info.ID]
+	if info.Flags&(nodeFlagPFail|nodeFlagFail) == 0 {
+		if reports != nil {
+			delete(reports, reporter)
+		}
+		return
+	}
+	if reports == nil {
+		reports = make(map[string]time.Time)
+		topo.failReports[info.ID] = reports
+	}
+	reports[reporter] = now
+}
+
+// markFailed marks node as FAIL when receiving fail message
+func (topo *gossipTopology) markFailed(nodeID string) {
+	topo.mu.Lock()
+	defer topo.mu.Unlock()
+	node, ok := topo.nodes[nodeID]
+	if !ok || nodeID == topo.selfNodeID || node.Flags&nodeFlagFail != 0 {
+		return
+	}
+	node.Flags = node.Flags&^nodeFlagPFail | nodeFlagFail
+	logger.Info("cluster node " + nodeID + " " + node.Addr + " is marked as failing")
+	topo.saveWithLock()
+}
+
+// isVoter returns whether node takes part in failure detection, only masters serving slots vote like redis
+func isVoter(node *Node) bool {
+	return len(node.Slots) > 0
+}
+
+// checkFailures marks unreachable nodes as PFAIL, and PFAIL nodes as FAIL if the majority of voters agree
+//
+//	@Description: 返回新标记为 FAIL 的节点, 由调用方广播
+//	@receiver topo
+//	@return []string
+func (topo *gossipTopology) checkFailures() []string {
+	topo.mu.Lock()
+	defer topo.mu.Unlock()
+	now := time.Now()
+	voters := 0
+	for _, node := range topo.nodes {
+		if isVoter(node) {
+			voters++
+		}
+	}
+	self := topo.nodes[topo.selfNodeID]
+	var failed []string
+	for _, node := range topo.nodes {
+		if node.ID == topo.selfNodeID || node.Flags&nodeFlagFail != 0 {
+			continue
+		}
+		if now.Sub(node.lastHeard) <= topo.nodeTimeout {
+			continue
+		}
+		node.Flags |= nodeFlagPFail
+		agreed := 0
+		if self != nil && isVoter(self) {
+			agreed++
+		}
+		for reporter, reportTime := range topo.failReports[node.ID] {
+			if now.Sub(reportTime) > 2*topo.nodeTimeout {
+				delete(topo.failReports[node.ID], reporter)
+				continue
+			}
+			if r, ok := topo.nodes[reporter]; ok && reporter != node.ID && isVoter(r) {
+				agreed++
+			}
+		}
+		if voters > 0 && agreed >= voters/2+1 {
+			node.Flags = node.Flags&^nodeFlagPFail | nodeFlagFail
+			logger.Info("cluster node " + node.ID + " " + node.Addr + " is marked as failing")
+			failed = append(failed, node.ID)
+		}
+	}
+	if len(failed) > 0 {
+		topo.saveWithLock()
+	}
+	return failed
+}
+
+// start runs cron in background, it is a no-op if cron is running
+func (topo *gossipTopology) start() {
+	topo.startOnce.Do(func() {
+		go topo.cron()
+	})
+}
+
+// cron pings other nodes and detects failures periodically
+func (topo *gossipTopology) cron() {
+	defer close(topo.cronDone)
+	interval := topo.nodeTimeout / 10
+	if interval > time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-topo.stopped:
+			return
+		case <-ticker.C:
+		}
+		topo.pingNodes()
+		for _, nodeID := range topo.checkFailures() {
+			topo.broadcastFail(nodeID)
+		}
+	}
+}
+
+// pingNodes sends ping to every node not waiting for pong, and meets seed again if no other node known
+func (topo *gossipTopology) pingNodes() {
+	topo.mu.Lock()
+	seed := topo.seed
+	if len(topo.nodes) > 1 {
+		topo.seed = ""
+	}
+	selfID := topo.selfNodeID
+	now := time.Now()
+	var targets []*Node
+	for _, node := range topo.nodes {
+		if node.ID == selfID {
+			continue
+		}
+		if _, waiting := topo.pinging.Load(node.ID); waiting {
+			continue
+		}
+		if node.pingSent.IsZero() {
+			node.pingSent = now
+		}
+		targets = append(targets, copyNode(node))
+	}
+	topo.mu.Unlock()
+	if len(targets) == 0 && seed != "" {
+		if err := topo.meet(seed); err != nil {
+			logger.Warn("join cluster failed: " + err.Error())
+		}
+		return
+	}
+	msg := topo.makeMessage(gossipPing)
+	for _, node := range targets {
+		topo.pinging.Store(node.ID, struct{}{})
+		go func(node *Node) {
+			defer topo.pinging.Delete(node.ID)
+			reply, err := topo.send(node.Addr, msg)
+			if err != nil {
+				return
+			}
+			topo.handlePong(reply)
+		}(node)
+	}
+}
+
+// broadcastFail tells all nodes that node is failing
+func (topo *gossipTopology) broadcastFail(nodeID string) {
+	msg := topo.makeMessage(gossipFail)
+	msg.Failed = nodeID
+	msg.Nodes = nil
+	for _, node := range topo.GetNodes() {
+		if node.ID == msg.Sender || node.ID == nodeID {
+			continue
+		}
+		go func(addr string) {
+			_, _ = topo.send(addr, msg)
+		}(node.Addr)
+	}
+}
+
+// Close stops gossip
+func (topo *gossipTopology) Close() error {
+	topo.closeOnce.Do(func() {
+		close(topo.stopped)
+		started := true
+		topo.startOnce.Do(func() {
+			started = false
+		})
+		if started {
+			<-topo.cronDone
+		}
+	})
+	return nil
+}
@@ -0,0 +1,427 @@
+package cluster
+
+import (
+	"github.com/Allen9012/Godis/aof"
+	database2 "github.com/Allen9012/Godis/database"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/interface/database"
+	"github.com/Allen9012/Godis/interface/godis"
+	"github.com/Allen9012/Godis/lib/sync/atomic"
+	"github.com/Allen9012/Godis/lib/utils"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/21
+  @desc: 在线迁移槽, 流程与 redis cluster 相同:
+	1. 目标节点 CLUSTER SETSLOT slot IMPORTING source-id
+	2. 源节点 CLUSTER SETSLOT slot MIGRATING target-id
+	3. 源节点 CLUSTER GETKEYSINSLOT slot count 后用 MIGRATE 逐批迁移 key
+	4. 所有节点 CLUSTER SETSLOT slot NODE target-id
+	迁移过程中源节点对已经迁走的 key 回复 ASK, 客户端发送 ASKING 后在目标节点重试
+  @modified by:
+**/
+
+const (
+	slotStateMigrating = iota + 1
+	slotStateImporting
+)
+
+// defaultMigrateTimeout is the timeout in milliseconds used by MIGRATE when timeout is 0, the same as redis
+const defaultMigrateTimeout = 1000
+
+var migrateTimeoutErr = protocol.MakeErrReply("IOERR error or timeout reading to target instance")
+
+// hostSlot is a slot migrating from or importing to current node
+type hostSlot struct {
+	state uint32
+	// nodeID is the target node if migrating, or the source node if importing
+	nodeID string
+}
+
+// getHostSlot returns migration state of slot, returns nil if the slot is stable
+func (cluster *Cluster) getHostSlot(slotID uint32) *hostSlot {
+	cluster.slotMu.RLock()
+	defer cluster.slotMu.RUnlock()
+	return cluster.slots[slotID]
+}
+
+func (cluster *Cluster) setHostSlot(slotID uint32, slot *hostSlot) {
+	cluster.slotMu.Lock()
+	defer cluster.slotMu.Unlock()
+	if slot == nil {
+		delete(cluster.slots, slotID)
+		return
+	}
+	cluster.slots[slotID] = slot
+}
+
+// execAsking allows the next command of client to access importing slots
+func execAsking(cluster *Cluster, c godis.Connection, cmdArgs [][]byte) godis.Reply {
+	if len(cmdArgs) != 1 {
+		return protocol.MakeArgNumErrReply("asking")
+	}
+	cluster.asking.Store(c, struct{}{})
+	return protocol.MakeOkReply()
+}
+
+func (cluster *Cluster) isAsking(c godis.Connection) bool {
+	_, ok := cluster.asking.Load(c)
+	return ok
+}
+
+// execMigratingSlot executes command in a slot migrating to another node
+//
+//	@Description: 在持有 key 锁的情况下检查 key 是否还在当前节点, 避免检查后 key 被 MIGRATE 迁走
+//	所有 key 都在时正常执行, 都不在时回复 ASK, 部分存在时回复 TRYAGAIN
+//	@receiver cluster
+//	@param c
+//	@param cmdArgs
+//	@param slotID
+//	@param targetID	导入这个槽的节点
+//	@return godis.Reply
+func (cluster *Cluster) execMigratingSlot(c godis.Connection, cmdArgs [][]byte, slotID uint32, targetID string) godis.Reply {
+	dbIndex := c.GetDBIndex()
+	writeKeys, readKeys := database2.GetRelatedKeys(cmdArgs)
+	cluster.db.RWLocks(dbIndex, writeKeys, readKeys)
+	defer cluster.db.RWUnLocks(dbIndex, writeKeys, readKeys)
+	total, missing := 0, 0
+	for _, keys := range [][]string{writeKeys, readKeys} {
+		for _, key := range keys {
+			total++
+			if _, exists := cluster.db.GetEntity(dbIndex, key); !exists {
+				missing++
+			}
+		}
+	}
+	if missing == 0 {
+		return cluster.db.ExecWithLock(c, cmdArgs)
+	}
+	if missing < total {
+		return protocol.MakeErrReply("TRYAGAIN Multiple keys request during rehashing of slot")
+	}
+	target := cluster.topology.GetNode(targetID)
+	if target == nil {
+		return protocol.MakeErrReply("ERR I don't know about node " + targetID)
+	}
+	return protocol.MakeAskErrReply(slotID, target.Addr)
+}
+
+// parseSlot parses slot id from argument like redis
+func parseSlot(arg []byte) (uint32, protocol.ErrorReply) {
+	slotID, err := strconv.Atoi(string(arg))
+	if err != nil || slotID < 0 || slotID >= slotCount {
+		return 0, protocol.MakeErrReply("ERR Invalid or out of range slot")
+	}
+	return uint32(slotID), nil
+}
+
+// execSetSlot
+//
+//	@Description: CLUSTER SETSLOT slot IMPORTING source-id | MIGRATING target-id | NODE node-id | STABLE
+//	@param cluster
+//	@param c
+//	@param args	SETSLOT 之后的参数
+//	@return godis.Reply
+func execSetSlot(cluster *Cluster, c godis.Connection, args [][]byte) godis.Reply {
+	if len(args) < 2 {
+		return protocol.MakeArgNumErrReply("cluster|setslot")
+	}
+	slotID, errReply := parseSlot(args[0])
+	if errReply != nil {
+		return errReply
+	}
+	selfID := cluster.topology.GetSelfNodeID()
+	var owner string
+	if slot := cluster.topology.GetSlots()[slotID]; slot != nil {
+		owner = slot.NodeID
+	}
+	subCmd := strings.ToLower(string(args[1]))
+	if subCmd == "stable" {
+		if len(args) != 2 {
+			return protocol.MakeSyntaxErrReply()
+		}
+		cluster.setHostSlot(slotID, nil)
+		return protocol.MakeOkReply()
+	}
+	if len(args) != 3 {
+		return protocol.MakeSyntaxErrReply()
+	}
+	nodeID := string(args[2])
+	if cluster.topology.GetNode(nodeID) == nil {
+		return protocol.MakeErrReply("ERR I don't know about node " + nodeID)
+	}
+	slotStr := strconv.Itoa(int(slotID))
+	switch subCmd {
+	case "migrating":
+		if owner != selfID {
+			return protocol.MakeErrReply("ERR I'm not the owner of hash slot " + slotStr)
+		}
+		if nodeID == selfID {
+			return protocol.MakeErrReply("ERR I'm the owner of hash slot " + slotStr + ", can't migrate to myself")
+		}
+		cluster.setHostSlot(slotID, &hostSlot{state: slotStateMigrating, nodeID: nodeID})
+	case "importing":
+		if owner == selfID {
+			return protocol.MakeErrReply("ERR I'm already the owner of hash slot " + slotStr)
+		}
+		if nodeID == selfID {
+			return protocol.MakeErrReply("ERR Can't import hash slot " + slotStr + " from myself")
+		}
+		cluster.setHostSlot(slotID, &hostSlot{state: slotStateImporting, nodeID: nodeID})
+	case "node":
+		if owner == selfID && nodeID != selfID && cluster.countKeysInSlot(c.GetDBIndex(), slotID) > 0 {
+			return protocol.MakeErrReply("ERR Can't assign hashslot " + slotStr +
+				" to a different node while I still hold keys for this hash slot.")
+		}
+		if errReply := cluster.topology.SetSlot([]uint32{slotID}, nodeID); errReply != nil {
+			return errReply
+		}
+		cluster.setHostSlot(slotID, nil)
+	default:
+		return protocol.MakeErrReply("ERR Invalid CLUSTER SETSLOT action or number of arguments. Try CLUSTER HELP")
+	}
+	return protocol.MakeOkReply()
+}
+
+// getKeysInSlot returns at most count keys in slot, negative count means all keys
+func (cluster *Cluster) getKeysInSlot(dbIndex int, slotID uint32, count int) []string {
+	var keys []string
+	cluster.db.ForEach(dbIndex, func(key string, data *database.DataEntity, expiration *time.Time) bool {
+		if count >= 0 && len(keys) >= count {
+			return false
+		}
+		if getSlot(key) == slotID {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	return keys
+}
+
+func (cluster *Cluster) countKeysInSlot(dbIndex int, slotID uint32) int {
+	return len(cluster.getKeysInSlot(dbIndex, slotID, -1))
+}
+
+// execGetKeysInSlot CLUSTER GETKEYSINSLOT slot count
+func execGetKeysInSlot(cluster *Cluster, c godis.Connection, args [][]byte) godis.Reply {
+	if len(args) != 2 {
+		return protocol.MakeArgNumErrReply("cluster|getkeysinslot")
+	}
+	slotID, errReply := parseSlot(args[0])
+	if errReply != nil {
+		return errReply
+	}
+	count, err := strconv.Atoi(string(args[1]))
+	if err != nil || count < 0 {
+		return protocol.MakeErrReply("ERR Invalid number of keys")
+	}
+	keys := cluster.getKeysInSlot(c.GetDBIndex(), slotID, count)
+	return protocol.MakeMultiBulkReply(utils.ToCmdLine(keys...))
+}
+
+// execCountKeysInSlot CLUSTER COUNTKEYSINSLOT slot
+func execCountKeysInSlot(cluster *Cluster, c godis.Connection, args [][]byte) godis.Reply {
+	if len(args) != 1 {
+		return protocol.MakeArgNumErrReply("cluster|countkeysinslot")
+	}
+	slotID, errReply := parseSlot(args[0])
+	if errReply != nil {
+		return errReply
+	}
+	return protocol.MakeIntReply(int64(cluster.countKeysInSlot(c.GetDBIndex(), slotID)))
+}
+
+// execMigrate
+//
+//	@Description: MIGRATE host port key|"" destination-db timeout [COPY] [REPLACE] [KEYS key [key ...]]
+//	通过 clientFactory 的连接把 key 序列化成命令发送给目标节点, 每条命令前发送 ASKING 以写入正在导入的槽
+//	集群节点间使用相同的 requirepass, 不支持 AUTH 选项
+//	@param cluster
+//	@param c
+//	@param cmdArgs
+//	@return godis.Reply
+func execMigrate(cluster *Cluster, c godis.Connection, cmdArgs [][]byte) godis.Reply {
+	if len(cmdArgs) < 6 {
+		return protocol.MakeArgNumErrReply("migrate")
+	}
+	port, err := strconv.Atoi(string(cmdArgs[2]))
+	if err != nil || port <= 0 || port > 65535 {
+		return protocol.MakeErrReply("ERR Invalid TCP port specified: " + string(cmdArgs[2]))
+	}
+	addr := net.JoinHostPort(string(cmdArgs[1]), strconv.Itoa(port))
+	destDB, err := strconv.Atoi(string(cmdArgs[4]))
+	if err != nil {
+		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	timeout, err := strconv.Atoi(string(cmdArgs[5]))
+	if err != nil || timeout < 0 {
+		return protocol.MakeErrReply("ERR timeout is not an integer or out of range")
+	}
+	var copyKeys, replace bool
+	keys := []string{string(cmdArgs[3])}
+	for i := 6; i < len(cmdArgs); i++ {
+		switch strings.ToLower(string(cmdArgs[i])) {
+		case "copy":
+			copyKeys = true
+		case "replace":
+			replace = true
+		case "keys":
+			if len(cmdArgs[3]) != 0 {
+				return protocol.MakeErrReply("ERR When using MIGRATE KEYS option, the key argument must be set to the empty string")
+			}
+			keys = nil
+			for _, key := range cmdArgs[i+1:] {
+				keys = append(keys, string(key))
+			}
+			i = len(cmdArgs)
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+	}
+
+	dbIndex := c.GetDBIndex()
+	cluster.db.RWLocks(dbIndex, keys, nil)
+	defer cluster.db.RWUnLocks(dbIndex, keys, nil)
+	var existKeys []string
+	for _, key := range keys {
+		if _, exists := cluster.db.GetEntity(dbIndex, key); exists {
+			existKeys = append(existKeys, key)
+		}
+	}
+	if len(existKeys) == 0 {
+		return protocol.MakeStatusReply("NOKEY")
+	}
+
+	// 持有锁时把 key 序列化成命令, 超时返回后发送协程仍可能在运行, 不能再读取数据
+	migratingKeys := make([]*migratingKey, 0, len(existKeys))
+	for _, key := range existKeys {
+		migratingKeys = append(migratingKeys, dumpKey(cluster, dbIndex, key))
+	}
+	peer, err := cluster.clientFactory.GetPeerClient(addr)
+	if err != nil {
+		return protocol.MakeErrReply("IOERR error or timeout connecting to the client")
+	}
+	if timeout == 0 {
+		timeout = defaultMigrateTimeout
+	}
+	errReply := sendMigratingKeys(peer, destDB, migratingKeys, replace, time.Duration(timeout)*time.Millisecond, func() {
+		_ = cluster.clientFactory.ReturnPeerClient(addr, peer)
+	})
+	if errReply != nil {
+		return errReply
+	}
+	if !copyKeys {
+		for _, key := range existKeys {
+			cluster.db.ExecWithLock(c, utils.ToCmdLine("DEL", key))
+		}
+	}
+	return protocol.MakeOkReply()
+}
+
+// migratingKey is a key serialized as commands
+type migratingKey struct {
+	key      string
+	cmdLines []CmdLine
+}
+
+// dumpKey serializes key and its ttl as commands, invoker should hold lock of key
+func dumpKey(cluster *Cluster, dbIndex int, key string) *migratingKey {
+	entity, _ := cluster.db.GetEntity(dbIndex, key)
+	mk := &migratingKey{key: key}
+	for _, cmd := range aof.EntityToCmds(key, entity) {
+		mk.cmdLines = append(mk.cmdLines, cmd.Args)
+	}
+	if expiration := cluster.db.GetExpiration(dbIndex, key); expiration != nil {
+		mk.cmdLines = append(mk.cmdLines, aof.MakeExpireCmd(key, *expiration).Args)
+	}
+	return mk
+}
+
+// sendMigratingKeys
+//
+//	@Description: 在另一个协程中把 key 发送给目标节点, 最多等待 timeout, 目标节点卡住时不会一直持有 key 的锁;
+//	超时后发送协程在下一条命令前停止, 并删除目标节点上未发送完整的 key
+//	@param peer
+//	@param destDB
+//	@param keys
+//	@param replace
+//	@param timeout
+//	@param release	发送协程退出后调用, 之前不能再使用 peer
+//	@return protocol.ErrorReply
+func sendMigratingKeys(peer peerClient, destDB int, keys []*migratingKey, replace bool,
+	timeout time.Duration, release func()) protocol.ErrorReply {
+	done := make(chan protocol.ErrorReply, 1)
+	var cancelled atomic.Boolean
+	go func() {
+		defer release()
+		if reply := peer.Send(utils.ToCmdLine("SELECT", strconv.Itoa(destDB))); protocol.IsErrorReply(reply) {
+			done <- protocol.MakeErrReply("ERR Target instance replied with error: " + reply.(protocol.ErrorReply).Error())
+			return
+		}
+		for _, mk := range keys {
+			if errReply := migrateKey(peer, mk, replace, &cancelled); errReply != nil {
+				done <- errReply
+				return
+			}
+		}
+		done <- nil
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case errReply := <-done:
+		return errReply
+	case <-timer.C:
+		cancelled.Set(true)
+		return migrateTimeoutErr
+	}
+}
+
+// migrateKey sends commands of key to peer, the key is deleted from peer if only a part of commands succeeded
+func migrateKey(peer peerClient, mk *migratingKey, replace bool, cancelled *atomic.Boolean) protocol.ErrorReply {
+	key := mk.key
+	if cancelled.Get() {
+		return migrateTimeoutErr
+	}
+	if replace {
+		if reply := sendAsking(peer, utils.ToCmdLine("DEL", key)); protocol.IsErrorReply(reply) {
+			return protocol.MakeErrReply("ERR Target instance replied with error: " + reply.(protocol.ErrorReply).Error())
+		}
+	} else {
+		reply := sendAsking(peer, utils.ToCmdLine("EXISTS", key))
+		if intReply, ok := reply.(*protocol.IntReply); !ok || intReply.Code != 0 {
+			if protocol.IsErrorReply(reply) {
+				return protocol.MakeErrReply("ERR Target instance replied with error: " + reply.(protocol.ErrorReply).Error())
+			}
+			return protocol.MakeErrReply("BUSYKEY Target key name already exists.")
+		}
+	}
+	for _, cmdLine := range mk.cmdLines {
+		var errReply protocol.ErrorReply
+		if cancelled.Get() {
+			errReply = migrateTimeoutErr
+		} else if reply := sendAsking(peer, cmdLine); protocol.IsErrorReply(reply) {
+			errReply = protocol.MakeErrReply("ERR Target instance replied with error: " + reply.(protocol.ErrorReply).Error())
+		}
+		if errReply != nil {
+			// 源节点保留 key, 删除目标节点上不完整的 key
+			sendAsking(peer, utils.ToCmdLine("DEL", key))
+			return errReply
+		}
+	}
+	return nil
+}
+
+// sendAsking sends ASKING before cmdLine so that the peer accepts keys of its importing slot
+func sendAsking(peer peerClient, cmdLine [][]byte) godis.Reply {
+	if reply := peer.Send(utils.ToCmdLine("ASKING")); protocol.IsErrorReply(reply) {
+		return reply
+	}
+	return peer.Send(cmdLine)
+}
@@ -0,0 +1,154 @@
+package cluster
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/21
+  @desc: slot migration
+  @modified by:
+**/
+
+import (
+	"github.com/Allen9012/Godis/godis/connection"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/godis/protocol/asserts"
+	"github.com/Allen9012/Godis/interface/godis"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlotMigration(t *testing.T) {
+	nodes := mockClusterNodes([]string{"127.0.0.1:6399", "127.0.0.1:7379"}, []bool{false, false})
+	nodeA, nodeB := nodes[0], nodes[1]
+	conn := connection.NewFakeConn()
+	key := findKey(nodeA, "k")
+	slot := getSlot(key)
+	slotStr := strconv.Itoa(int(slot))
+	nodeA.Exec(conn, toArgs("SET", key, "1"))
+	nodeA.Exec(conn, toArgs("RPUSH", "{"+key+"}list", "a", "b"))
+	nodeA.Exec(conn, toArgs("SET", "{"+key+"}ttl", "1", "EX", "100"))
+
+	result := nodeA.Exec(conn, toArgs("CLUSTER", "SETSLOT", slotStr, "IMPORTING", nodeB.self))
+	asserts.AssertErrReply(t, result, "ERR I'm already the owner of hash slot "+slotStr)
+	result = nodeB.Exec(conn, toArgs("CLUSTER", "SETSLOT", slotStr, "IMPORTING", nodeA.self))
+	asserts.AssertStatusReply(t, result, "OK")
+	result = nodeA.Exec(conn, toArgs("CLUSTER", "SETSLOT", slotStr, "MIGRATING", nodeB.self))
+	asserts.AssertStatusReply(t, result, "OK")
+	result = nodeA.Exec(conn, toArgs("CLUSTER", "COUNTKEYSINSLOT", slotStr))
+	asserts.AssertIntReply(t, result, 3)
+
+	// keys not migrated yet are served by source node, new keys are created in target node
+	result = nodeA.Exec(conn, toArgs("GET", key))
+	asserts.AssertBulkReply(t, result, "1")
+	result = nodeA.Exec(conn, toArgs("SET", "{"+key+"}new", "1"))
+	asserts.AssertErrReply(t, result, "ASK "+slotStr+" "+nodeB.self)
+	result = nodeB.Exec(conn, toArgs("GET", key))
+	asserts.AssertErrReply(t, result, "MOVED "+slotStr+" "+nodeA.self)
+
+	result = nodeA.Exec(conn, toArgs("MIGRATE", "127.0.0.1", "7379", "", "0", "1000", "KEYS", key))
+	asserts.AssertStatusReply(t, result, "OK")
+	result = nodeA.Exec(conn, toArgs("GET", key))
+	asserts.AssertErrReply(t, result, "ASK "+slotStr+" "+nodeB.self)
+	result = nodeA.Exec(conn, toArgs("DEL", key, "{"+key+"}list"))
+	asserts.AssertErrReply(t, result, "TRYAGAIN Multiple keys request during rehashing of slot")
+	// ASKING only affects the next command
+	result = nodeB.Exec(conn, toArgs("ASKING"))
+	asserts.AssertStatusReply(t, result, "OK")
+	result = nodeB.Exec(conn, toArgs("GET", key))
+	asserts.AssertBulkReply(t, result, "1")
+	result = nodeB.Exec(conn, toArgs("GET", key))
+	asserts.AssertErrReply(t, result, "MOVED "+slotStr+" "+nodeA.self)
+
+	// target key exists
+	nodeA.db.Exec(conn, toArgs("SET", key, "2"))
+	result = nodeA.Exec(conn, toArgs("MIGRATE", "127.0.0.1", "7379", key, "0", "1000"))
+	asserts.AssertErrReply(t, result, "BUSYKEY Target key name already exists.")
+	result = nodeA.Exec(conn, toArgs("MIGRATE", "127.0.0.1", "7379", key, "0", "1000", "REPLACE"))
+	asserts.AssertStatusReply(t, result, "OK")
+	result = nodeA.Exec(conn, toArgs("MIGRATE", "127.0.0.1", "7379", key, "0", "1000"))
+	asserts.AssertStatusReply(t, result, "NOKEY")
+
+	result = nodeA.Exec(conn, toArgs("CLUSTER", "SETSLOT", slotStr, "NODE", nodeB.self))
+	asserts.AssertErrReply(t, result, "ERR Can't assign hashslot "+slotStr+
+		" to a different node while I still hold keys for this hash slot.")
+	result = nodeA.Exec(conn, toArgs("CLUSTER", "GETKEYSINSLOT", slotStr, "10"))
+	keys := result.(*protocol.MultiBulkReply).Args
+	if len(keys) != 2 {
+		t.Fatalf("expect 2 keys left, actual %d", len(keys))
+	}
+	args := []string{"MIGRATE", "127.0.0.1", "7379", "", "0", "1000", "KEYS"}
+	for _, k := range keys {
+		args = append(args, string(k))
+	}
+	result = nodeA.Exec(conn, toArgs(args...))
+	asserts.AssertStatusReply(t, result, "OK")
+
+	for _, node := range nodes {
+		result = node.Exec(conn, toArgs("CLUSTER", "SETSLOT", slotStr, "NODE", nodeB.self))
+		asserts.AssertStatusReply(t, result, "OK")
+	}
+	result = nodeA.Exec(conn, toArgs("GET", key))
+	asserts.AssertErrReply(t, result, "MOVED "+slotStr+" "+nodeB.self)
+	result = nodeB.Exec(conn, toArgs("GET", key))
+	asserts.AssertBulkReply(t, result, "2")
+	result = nodeB.Exec(conn, toArgs("LRANGE", "{"+key+"}list", "0", "-1"))
+	asserts.AssertMultiBulkReply(t, result, []string{"a", "b"})
+	result = nodeB.Exec(conn, toArgs("TTL", "{"+key+"}ttl"))
+	if ttl, ok := result.(*protocol.IntReply); !ok || ttl.Code <= 0 || ttl.Code > 100 {
+		t.Errorf("expect ttl is migrated, actual %s", string(result.ToBytes()))
+	}
+	result = nodeA.Exec(conn, toArgs("CLUSTER", "COUNTKEYSINSLOT", slotStr))
+	asserts.AssertIntReply(t, result, 0)
+}
+
+// faultyClient fails or delays commands to simulate a broken target node
+type faultyClient struct {
+	peerClient
+	failOn  string
+	delayOn string
+	delay   time.Duration
+}
+
+func (cli *faultyClient) Send(cmdLine [][]byte) godis.Reply {
+	cmdName := strings.ToUpper(string(cmdLine[0]))
+	if cmdName == cli.delayOn {
+		time.Sleep(cli.delay)
+	}
+	if cmdName == cli.failOn {
+		return protocol.MakeErrReply("ERR injected")
+	}
+	return cli.peerClient.Send(cmdLine)
+}
+
+func TestMigrateFailure(t *testing.T) {
+	nodes := mockClusterNodes([]string{"127.0.0.1:6400", "127.0.0.1:7380"}, []bool{false, false})
+	nodeA, nodeB := nodes[0], nodes[1]
+	conn := connection.NewFakeConn()
+	key := findKey(nodeA, "k")
+	nodeA.Exec(conn, toArgs("SET", key, "1", "EX", "100"))
+	nodeB.Exec(conn, toArgs("CLUSTER", "SETSLOT", strconv.Itoa(int(getSlot(key))), "IMPORTING", nodeA.self))
+	mk := dumpKey(nodeA, 0, key)
+	peer, _ := nodeA.clientFactory.GetPeerClient(nodeB.self)
+
+	// a part of commands failed
+	errReply := sendMigratingKeys(&faultyClient{peerClient: peer, failOn: "PEXPIREAT"}, 0,
+		[]*migratingKey{mk}, false, time.Second, func() {})
+	asserts.AssertErrReply(t, errReply, "ERR Target instance replied with error: ERR injected")
+	asserts.AssertIntReply(t, nodeB.db.Exec(conn, toArgs("EXISTS", key)), 0)
+
+	// target node is too slow
+	released := make(chan struct{})
+	start := time.Now()
+	errReply = sendMigratingKeys(&faultyClient{peerClient: peer, delayOn: "SET", delay: 200 * time.Millisecond}, 0,
+		[]*migratingKey{mk}, false, 50*time.Millisecond, func() { close(released) })
+	asserts.AssertErrReply(t, errReply, "IOERR error or timeout reading to target instance")
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Errorf("expect returning after timeout, actually %s", elapsed)
+	}
+	<-released
+	asserts.AssertIntReply(t, nodeB.db.Exec(conn, toArgs("EXISTS", key)), 0)
+	// source node keeps the key
+	asserts.AssertBulkReply(t, nodeA.Exec(conn, toArgs("GET", key)), "1")
+}
@@ -0,0 +1,177 @@
+package cluster
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/22
+  @desc: 节点信息的文本格式, 与 redis 的 nodes.conf 和 CLUSTER NODES 相同
+	eg: 67ed2db8d677e59ec4a4cefb06858cf2a1a89fa1 127.0.0.1:30002@30002 master - 0 1426238316232 2 connected 5461-10922
+	godis 的集群总线和客户端使用同一个端口, 因此 @ 之后的端口与节点端口相同
+  @modified by:
+**/
+
+// formatNodeLine formats node as a line of nodes.conf without line break
+func formatNodeLine(node *Node, selfID string) string {
+	buf := &bytes.Buffer{}
+	buf.WriteString(node.ID)
+	buf.WriteByte(' ')
+	buf.WriteString(node.Addr)
+	if _, port := splitAddr(node.Addr); port > 0 {
+		buf.WriteString("@" + strconv.Itoa(port))
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(formatNodeFlags(node, selfID))
+	buf.WriteByte(' ')
+	if node.MasterID != "" {
+		buf.WriteString(node.MasterID)
+	} else {
+		buf.WriteByte('-')
+	}
+	buf.WriteByte(' ')
+	if node.ID == selfID {
+		buf.WriteString("0 0")
+	} else {
+		buf.WriteString(strconv.FormatInt(unixMilli(node.pingSent), 10))
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.FormatInt(unixMilli(node.lastHeard), 10))
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatUint(node.ConfigEpoch, 10))
+	if node.ID != selfID && node.Flags&(nodeFlagPFail|nodeFlagFail) != 0 {
+		buf.WriteString(" disconnected")
+	} else {
+		buf.WriteString(" connected")
+	}
+	for _, r := range getSlotRanges(node.Slots) {
+		buf.WriteByte(' ')
+		buf.WriteString(strconv.Itoa(int(r.begin)))
+		if r.end != r.begin {
+			buf.WriteByte('-')
+			buf.WriteString(strconv.Itoa(int(r.end)))
+		}
+	}
+	return buf.String()
+}
+
+func formatNodeFlags(node *Node, selfID string) string {
+	var flags []string
+	if node.ID == selfID {
+		flags = append(flags, "myself")
+	}
+	if node.MasterID != "" {
+		flags = append(flags, "slave")
+	} else {
+		flags = append(flags, "master")
+	}
+	if node.Flags&nodeFlagFail != 0 {
+		flags = append(flags, "fail")
+	} else if node.Flags&nodeFlagPFail != 0 {
+		flags = append(flags, "fail?")
+	}
+	return strings.Join(flags, ",")
+}
+
+func unixMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// marshalNodes formats nodes and epoch as content of nodes.conf
+func marshalNodes(nodes []*Node, selfID string, currentEpoch uint64) []byte {
+	buf := &bytes.Buffer{}
+	for _, node := range nodes {
+		buf.WriteString(formatNodeLine(node, selfID))
+		buf.WriteByte('\n')
+	}
+	buf.WriteString("vars currentEpoch " + strconv.FormatUint(currentEpoch, 10) + " lastVoteEpoch 0\n")
+	return buf.Bytes()
+}
+
+// unmarshalNodes parses content of nodes.conf, failure flags are dropped because they are out of date
+//
+//	@Description:
+//	@param data
+//	@return nodes	节点的 Slots 按槽 id 升序
+//	@return selfID	带有 myself 标记的节点
+//	@return currentEpoch
+//	@return err
+func unmarshalNodes(data []byte) (nodes []*Node, selfID string, currentEpoch uint64, err error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "vars" {
+			for i := 1; i+1 < len(fields); i += 2 {
+				if fields[i] == "currentEpoch" {
+					currentEpoch, err = strconv.ParseUint(fields[i+1], 10, 64)
+					if err != nil {
+						return nil, "", 0, errors.New("invalid currentEpoch: " + fields[i+1])
+					}
+				}
+			}
+			continue
+		}
+		if len(fields) < 8 {
+			return nil, "", 0, errors.New("invalid node line: " + scanner.Text())
+		}
+		node := &Node{
+			ID:   fields[0],
+			Addr: fields[1],
+		}
+		// ip:port@cport,hostname
+		if i := strings.IndexAny(node.Addr, "@,"); i >= 0 {
+			node.Addr = node.Addr[:i]
+		}
+		for _, flag := range strings.Split(fields[2], ",") {
+			if flag == "myself" {
+				selfID = node.ID
+			}
+		}
+		if fields[3] != "-" {
+			node.MasterID = fields[3]
+		}
+		node.ConfigEpoch, err = strconv.ParseUint(fields[6], 10, 64)
+		if err != nil {
+			return nil, "", 0, errors.New("invalid config epoch: " + fields[6])
+		}
+		for _, field := range fields[8:] {
+			if strings.HasPrefix(field, "[") {
+				// migrating or importing slot
+				continue
+			}
+			begin, end := field, field
+			if i := strings.Index(field, "-"); i >= 0 {
+				begin, end = field[:i], field[i+1:]
+			}
+			beginID, err1 := parseSlot([]byte(begin))
+			endID, err2 := parseSlot([]byte(end))
+			if err1 != nil || err2 != nil || beginID > endID {
+				return nil, "", 0, errors.New("invalid slot range: " + field)
+			}
+			for slotID := beginID; slotID <= endID; slotID++ {
+				node.Slots = append(node.Slots, &Slot{
+					ID:     slotID,
+					NodeID: node.ID,
+				})
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	if selfID == "" {
+		return nil, "", 0, errors.New("myself not found")
+	}
+	return nodes, selfID, currentEpoch, nil
+}
@@ -0,0 +1,318 @@
+package cluster
+
+import (
+	"encoding/json"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/hashicorp/raft"
+	"io"
+	"sort"
+	"sync"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/24
+  @desc: raft 状态机, 保存集群元数据: 节点, 主从关系和槽的分配
+	所有修改都作为 raft 日志提交, 各节点按相同顺序执行, 因此看到相同的拓扑
+  @modified by:
+**/
+
+// types of raft log entry
+const (
+	raftCmdAddNode   = "addNode"   // add a master without slots, or update addresses of node
+	raftCmdSetSlot   = "setSlot"   // assign slots to NodeID, empty NodeID means unassign
+	raftCmdReplicate = "replicate" // NodeID becomes replica of MasterID
+	raftCmdFailover  = "failover"  // replica NodeID takes over its failed master MasterID
+	raftCmdFail      = "fail"      // NodeID is failing
+	raftCmdRecover   = "recover"   // failing NodeID is reachable again
+	raftCmdForget    = "forget"    // NodeID is removed, its slots become unassigned
+)
+
+// raftCommand is the data of raft log entry
+type raftCommand struct {
+	Type     string   `json:"type"`
+	NodeID   string   `json:"nodeId,omitempty"`
+	Addr     string   `json:"addr,omitempty"`
+	RaftAddr string   `json:"raftAddr,omitempty"`
+	MasterID string   `json:"masterId,omitempty"`
+	Slots    []uint32 `json:"slots,omitempty"`
+}
+
+// raftMember is a node in snapshot
+type raftMember struct {
+	ID          string      `json:"id"`
+	Addr        string      `json:"addr"`
+	RaftAddr    string      `json:"raftAddr"`
+	MasterID    string      `json:"masterId,omitempty"`
+	Flags       uint32      `json:"flags,omitempty"`
+	ConfigEpoch uint64      `json:"epoch"`
+	Slots       [][2]uint32 `json:"slots,omitempty"` // ranges of slots, both ends included
+}
+
+// raftState is the content of snapshot
+type raftState struct {
+	CurrentEpoch uint64        `json:"currentEpoch"`
+	Members      []*raftMember `json:"members"`
+}
+
+// clusterFSM implements raft.FSM
+type clusterFSM struct {
+	mu    sync.RWMutex
+	nodes map[string]*Node
+	// raftAddrs[nodeID] is the address of raft transport
+	raftAddrs map[string]string
+	// slots is replaced as a whole when modified, so the slice returned by GetSlots never changes
+	slots        []*Slot
+	currentEpoch uint64
+	// onApply is called after state changed, without holding lock
+	onApply func()
+}
+
+func newClusterFSM() *clusterFSM {
+	return &clusterFSM{
+		nodes:     make(map[string]*Node),
+		raftAddrs: make(map[string]string),
+		slots:     make([]*Slot, slotCount),
+	}
+}
+
+// Apply executes a committed log entry, it returns protocol.ErrorReply if the command is rejected
+func (fsm *clusterFSM) Apply(log *raft.Log) interface{} {
+	cmd := &raftCommand{}
+	if err := json.Unmarshal(log.Data, cmd); err != nil {
+		return protocol.MakeErrReply("ERR invalid raft log: " + err.Error())
+	}
+	fsm.mu.Lock()
+	errReply := fsm.applyCommand(cmd)
+	fsm.mu.Unlock()
+	if errReply == nil && fsm.onApply != nil {
+		fsm.onApply()
+	}
+	if errReply != nil {
+		return errReply
+	}
+	return nil
+}
+
+// applyCommand modifies state, invoker should hold lock
+func (fsm *clusterFSM) applyCommand(cmd *raftCommand) protocol.ErrorReply {
+	switch cmd.Type {
+	case raftCmdAddNode:
+		node, ok := fsm.nodes[cmd.NodeID]
+		if !ok {
+			node = &Node{ID: cmd.NodeID}
+			fsm.nodes[cmd.NodeID] = node
+		}
+		node.Addr = cmd.Addr
+		fsm.raftAddrs[cmd.NodeID] = cmd.RaftAddr
+		return nil
+	case raftCmdSetSlot:
+		for _, slotID := range cmd.Slots {
+			if int(slotID) >= slotCount {
+				return protocol.MakeErrReply("ERR Invalid or out of range slot")
+			}
+		}
+		if cmd.NodeID != "" {
+			node, ok := fsm.nodes[cmd.NodeID]
+			if !ok {
+				return protocol.MakeErrReply("ERR Unknown node " + cmd.NodeID)
+			}
+			if node.MasterID != "" {
+				return protocol.MakeErrReply("ERR Please use SETSLOT only with masters.")
+			}
+			fsm.currentEpoch++
+			node.ConfigEpoch = fsm.currentEpoch
+		}
+		slots := make([]*Slot, slotCount)
+		copy(slots, fsm.slots)
+		for _, slotID := range cmd.Slots {
+			slots[slotID] = &Slot{
+				ID:     slotID,
+				NodeID: cmd.NodeID,
+			}
+		}
+		fsm.slots = slots
+		rebuildNodeSlots(fsm.nodes, fsm.slots)
+		return nil
+	case raftCmdReplicate:
+		node, ok := fsm.nodes[cmd.NodeID]
+		if !ok {
+			return protocol.MakeErrReply("ERR Unknown node " + cmd.NodeID)
+		}
+		master, ok := fsm.nodes[cmd.MasterID]
+		if !ok {
+			return protocol.MakeErrReply("ERR Unknown node " + cmd.MasterID)
+		}
+		if node.ID == master.ID {
+			return protocol.MakeErrReply("ERR Can't replicate myself")
+		}
+		if master.MasterID != "" {
+			return protocol.MakeErrReply("ERR I can only replicate a master, not a replica.")
+		}
+		if len(node.Slots) > 0 {
+			return protocol.MakeErrReply("ERR To set a master the node must be empty and without assigned slots.")
+		}
+		for _, n := range fsm.nodes {
+			if n.MasterID == node.ID {
+				return protocol.MakeErrReply("ERR Can't replicate another node while having replicas")
+			}
+		}
+		node.MasterID = master.ID
+		return nil
+	case raftCmdFailover:
+		node, ok := fsm.nodes[cmd.NodeID]
+		if !ok || node.MasterID != cmd.MasterID {
+			return protocol.MakeErrReply("ERR " + cmd.NodeID + " is not a replica of " + cmd.MasterID)
+		}
+		oldMaster, ok := fsm.nodes[cmd.MasterID]
+		if !ok {
+			return protocol.MakeErrReply("ERR Unknown node " + cmd.MasterID)
+		}
+		fsm.currentEpoch++
+		node.MasterID = ""
+		node.ConfigEpoch = fsm.currentEpoch
+		// 其他从节点和恢复后的原主节点都成为新主节点的从节点
+		for _, n := range fsm.nodes {
+			if n.MasterID == oldMaster.ID {
+				n.MasterID = node.ID
+			}
+		}
+		oldMaster.MasterID = node.ID
+		oldMaster.Flags |= nodeFlagFail
+		slots := make([]*Slot, slotCount)
+		copy(slots, fsm.slots)
+		for _, slot := range oldMaster.Slots {
+			slots[slot.ID] = &Slot{
+				ID:     slot.ID,
+				NodeID: node.ID,
+			}
+		}
+		fsm.slots = slots
+		rebuildNodeSlots(fsm.nodes, fsm.slots)
+		return nil
+	case raftCmdFail, raftCmdRecover:
+		node, ok := fsm.nodes[cmd.NodeID]
+		if !ok {
+			return protocol.MakeErrReply("ERR Unknown node " + cmd.NodeID)
+		}
+		if cmd.Type == raftCmdFail {
+			node.Flags |= nodeFlagFail
+		} else {
+			node.Flags &^= nodeFlagFail
+		}
+		return nil
+	case raftCmdForget:
+		node, ok := fsm.nodes[cmd.NodeID]
+		if !ok {
+			return protocol.MakeErrReply("ERR Unknown node " + cmd.NodeID)
+		}
+		delete(fsm.nodes, node.ID)
+		delete(fsm.raftAddrs, node.ID)
+		// 被遗忘主节点的从节点成为没有槽的主节点
+		for _, n := range fsm.nodes {
+			if n.MasterID == node.ID {
+				n.MasterID = ""
+			}
+		}
+		slots := make([]*Slot, slotCount)
+		copy(slots, fsm.slots)
+		for _, slot := range node.Slots {
+			slots[slot.ID] = nil
+		}
+		fsm.slots = slots
+		rebuildNodeSlots(fsm.nodes, fsm.slots)
+		return nil
+	}
+	return protocol.MakeErrReply("ERR unknown raft command " + cmd.Type)
+}
+
+// Snapshot returns a point-in-time snapshot of state
+func (fsm *clusterFSM) Snapshot() (raft.FSMSnapshot, error) {
+	fsm.mu.RLock()
+	defer fsm.mu.RUnlock()
+	state := &raftState{
+		CurrentEpoch: fsm.currentEpoch,
+		Members:      make([]*raftMember, 0, len(fsm.nodes)),
+	}
+	for _, node := range fsm.nodes {
+		member := &raftMember{
+			ID:          node.ID,
+			Addr:        node.Addr,
+			RaftAddr:    fsm.raftAddrs[node.ID],
+			MasterID:    node.MasterID,
+			Flags:       node.Flags,
+			ConfigEpoch: node.ConfigEpoch,
+		}
+		for _, r := range getSlotRanges(node.Slots) {
+			member.Slots = append(member.Slots, [2]uint32{r.begin, r.end})
+		}
+		state.Members = append(state.Members, member)
+	}
+	sort.Slice(state.Members, func(i, j int) bool {
+		return state.Members[i].ID < state.Members[j].ID
+	})
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	return &clusterSnapshot{data: data}, nil
+}
+
+// Restore replaces state with snapshot
+func (fsm *clusterFSM) Restore(snapshot io.ReadCloser) error {
+	defer func() {
+		_ = snapshot.Close()
+	}()
+	state := &raftState{}
+	if err := json.NewDecoder(snapshot).Decode(state); err != nil {
+		return err
+	}
+	nodes := make(map[string]*Node, len(state.Members))
+	raftAddrs := make(map[string]string, len(state.Members))
+	slots := make([]*Slot, slotCount)
+	for _, member := range state.Members {
+		nodes[member.ID] = &Node{
+			ID:          member.ID,
+			Addr:        member.Addr,
+			MasterID:    member.MasterID,
+			Flags:       member.Flags,
+			ConfigEpoch: member.ConfigEpoch,
+		}
+		raftAddrs[member.ID] = member.RaftAddr
+		for _, r := range member.Slots {
+			for slotID := r[0]; slotID <= r[1] && int(slotID) < slotCount; slotID++ {
+				slots[slotID] = &Slot{
+					ID:     slotID,
+					NodeID: member.ID,
+				}
+			}
+		}
+	}
+	fsm.mu.Lock()
+	fsm.nodes = nodes
+	fsm.raftAddrs = raftAddrs
+	fsm.slots = slots
+	fsm.currentEpoch = state.CurrentEpoch
+	rebuildNodeSlots(fsm.nodes, fsm.slots)
+	fsm.mu.Unlock()
+	if fsm.onApply != nil {
+		fsm.onApply()
+	}
+	return nil
+}
+
+// clusterSnapshot implements raft.FSMSnapshot
+type clusterSnapshot struct {
+	data []byte
+}
+
+func (snapshot *clusterSnapshot) Persist(sink raft.SnapshotSink) error {
+	if _, err := sink.Write(snapshot.data); err != nil {
+		_ = sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (snapshot *clusterSnapshot) Release() {}
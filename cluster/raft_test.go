@@ -0,0 +1,264 @@
+package cluster
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/24
+  @desc: raft topology and failover
+  @modified by:
+**/
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/Allen9012/Godis/config"
+	database2 "github.com/Allen9012/Godis/database"
+	"github.com/Allen9012/Godis/datastruct/dict"
+	"github.com/Allen9012/Godis/godis/connection"
+	"github.com/Allen9012/Godis/godis/parser"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/godis/protocol/asserts"
+	"github.com/Allen9012/Godis/lib/idgenerator"
+	"github.com/Allen9012/Godis/slowlog"
+	"github.com/hashicorp/raft"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const testRaftNodeTimeout = 500 * time.Millisecond
+
+// serveClusterForTest serves cluster on a random loopback port until the listener closed
+func serveClusterForTest(t *testing.T, cluster *Cluster) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				client := connection.NewConn(conn)
+				defer cluster.AfterClientClose(client)
+				for payload := range parser.ParseStream(conn) {
+					if payload.Err != nil {
+						return
+					}
+					cmd, ok := payload.Data.(*protocol.MultiBulkReply)
+					if !ok {
+						continue
+					}
+					_, _ = client.Write(cluster.Exec(client, cmd.Args).ToBytes())
+				}
+			}()
+		}
+	}()
+	return listener
+}
+
+// mockRaftNodes creates n nodes serving on loopback ports, raft transports listen on loopback ports too.
+// The first node bootstraps the cluster and the others join it.
+func mockRaftNodes(t *testing.T, n int) ([]*Cluster, *testClientFactory) {
+	appendOnly, aofFilename := config.Properties.AppendOnly, config.Properties.AppendFilename
+	t.Cleanup(func() {
+		config.Properties.AppendOnly = appendOnly
+		config.Properties.AppendFilename = aofFilename
+	})
+	config.Properties.AppendOnly = true
+	tmpDir := t.TempDir()
+	nodes := make([]*Cluster, n)
+	factory := &testClientFactory{
+		nodes:        nodes,
+		timeoutFlags: make([]bool, n),
+	}
+	for i := range nodes {
+		// 主从复制需要 aof
+		config.Properties.AppendFilename = filepath.Join(tmpDir, strconv.Itoa(i)+".aof")
+		node := &Cluster{
+			db:            database2.NewStandaloneServer(),
+			transactions:  dict.MakeSimple(),
+			slots:         make(map[uint32]*hostSlot),
+			slowlog:       slowlog.MakeSlowLog(),
+			clientFactory: factory,
+		}
+		listener := serveClusterForTest(t, node)
+		node.self = listener.Addr().String()
+		node.idGenerator = idgenerator.MakeGenerator(node.self)
+		node.topology = newRaftTopology(node.self, "127.0.0.1:0", "", testRaftNodeTimeout, factory, node.setMaster)
+		nodes[i] = node
+		t.Cleanup(func() {
+			_ = listener.Close()
+			_ = node.topology.Close()
+			node.db.Close()
+		})
+	}
+	if err := nodes[0].topology.StartAsSeed(nodes[0].self); err != nil {
+		t.Fatal(err.Error())
+	}
+	// join through the previous node, so that forwarding to leader is covered
+	for i := 1; i < n; i++ {
+		if err := nodes[i].topology.Join(nodes[i-1].self); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	return nodes, factory
+}
+
+func TestRaftFailover(t *testing.T) {
+	nodes, factory := mockRaftNodes(t, 3)
+	nodeA, nodeB, nodeC := nodes[0], nodes[1], nodes[2]
+	idA := nodeA.topology.GetSelfNodeID()
+	idB := nodeB.topology.GetSelfNodeID()
+	waitFor(t, "all nodes joined", func() bool {
+		for _, node := range nodes {
+			if len(node.topology.GetNodes()) != len(nodes) {
+				return false
+			}
+		}
+		return true
+	})
+	conn := connection.NewFakeConn()
+	result := nodeB.Exec(conn, toArgs("CLUSTER", "REPLICATE", idB))
+	asserts.AssertErrReply(t, result, "ERR Can't replicate myself")
+	result = nodeA.Exec(conn, toArgs("CLUSTER", "REPLICATE", idB))
+	asserts.AssertErrReply(t, result, "ERR To set a master the node must be empty and without assigned slots.")
+	result = nodeB.Exec(conn, toArgs("CLUSTER", "REPLICATE", idA))
+	asserts.AssertStatusReply(t, result, "OK")
+	waitFor(t, "replica known by all nodes", func() bool {
+		return nodeC.topology.GetNode(idB).MasterID == idA
+	})
+
+	// replica syncs data with master
+	key := findKey(nodeA, "k")
+	result = nodeA.Exec(conn, toArgs("SET", key, "1"))
+	asserts.AssertStatusReply(t, result, "OK")
+	result = nodeB.Exec(conn, toArgs("GET", key))
+	asserts.AssertErrReply(t, result, "MOVED "+strconv.Itoa(int(getSlot(key)))+" "+nodeA.self)
+	expected := protocol.MakeBulkReply([]byte("1")).ToBytes()
+	waitFor(t, "data replicated", func() bool {
+		return bytes.Equal(nodeB.db.Exec(connection.NewFakeConn(), toArgs("GET", key)).ToBytes(), expected)
+	})
+
+	// master is down, the replica takes over its slots
+	_ = nodeA.topology.Close()
+	factory.setTimeout(0, true)
+	for _, node := range nodes[1:] {
+		node := node
+		waitFor(t, "failover", func() bool {
+			owner := slotOwners(node)[getSlot(key)]
+			return owner == idB && node.topology.GetNode(idB).MasterID == ""
+		})
+		nodeA := node.topology.GetNode(idA)
+		if nodeA.Flags&nodeFlagFail == 0 || nodeA.MasterID != idB || len(nodeA.Slots) > 0 {
+			t.Errorf("old master should be a failing replica: %+v", nodeA)
+		}
+	}
+	waitFor(t, "replica promoted", func() bool {
+		result := nodeB.Exec(conn, toArgs("SET", "{"+key+"}new", "2"))
+		return protocol.IsOKReply(result)
+	})
+	result = nodeB.Exec(conn, toArgs("GET", key))
+	asserts.AssertBulkReply(t, result, "1")
+	result = nodeC.Exec(conn, toArgs("GET", key))
+	asserts.AssertErrReply(t, result, "MOVED "+strconv.Itoa(int(getSlot(key)))+" "+nodeB.self)
+}
+
+// bufferSink is a raft.SnapshotSink writing into memory
+type bufferSink struct {
+	bytes.Buffer
+}
+
+func (s *bufferSink) ID() string    { return "test" }
+func (s *bufferSink) Cancel() error { return nil }
+func (s *bufferSink) Close() error  { return nil }
+
+func TestRaftSnapshot(t *testing.T) {
+	fsm := newClusterFSM()
+	commands := []*raftCommand{
+		{Type: raftCmdAddNode, NodeID: "a", Addr: "127.0.0.1:6399", RaftAddr: "127.0.0.1:16399"},
+		{Type: raftCmdAddNode, NodeID: "b", Addr: "127.0.0.1:7379", RaftAddr: "127.0.0.1:17379"},
+		{Type: raftCmdAddNode, NodeID: "c", Addr: "127.0.0.1:8379", RaftAddr: "127.0.0.1:18379"},
+		{Type: raftCmdSetSlot, NodeID: "a", Slots: []uint32{0, 1, 2, 5}},
+		{Type: raftCmdReplicate, NodeID: "b", MasterID: "a"},
+		{Type: raftCmdReplicate, NodeID: "c", MasterID: "a"},
+		{Type: raftCmdFailover, NodeID: "b", MasterID: "a"},
+	}
+	for i, cmd := range commands {
+		data, _ := json.Marshal(cmd)
+		if result := fsm.Apply(&raft.Log{Index: uint64(i + 1), Data: data}); result != nil {
+			t.Fatalf("apply %s failed: %v", cmd.Type, result)
+		}
+	}
+	data, _ := json.Marshal(&raftCommand{Type: raftCmdSetSlot, NodeID: "c", Slots: []uint32{3}})
+	if _, ok := fsm.Apply(&raft.Log{Data: data}).(protocol.ErrorReply); !ok {
+		t.Error("replica should not serve slots")
+	}
+
+	snapshot, err := fsm.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &bufferSink{}
+	if err := snapshot.Persist(sink); err != nil {
+		t.Fatal(err)
+	}
+	restored := newClusterFSM()
+	if err := restored.Restore(io.NopCloser(&sink.Buffer)); err != nil {
+		t.Fatal(err)
+	}
+	if restored.currentEpoch != 2 || restored.raftAddrs["c"] != "127.0.0.1:18379" {
+		t.Errorf("wrong restored state: epoch %d, raft addr %s", restored.currentEpoch, restored.raftAddrs["c"])
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		expected, actual := fsm.nodes[id], restored.nodes[id]
+		if actual == nil || actual.Addr != expected.Addr || actual.MasterID != expected.MasterID ||
+			actual.Flags != expected.Flags || actual.ConfigEpoch != expected.ConfigEpoch ||
+			len(actual.Slots) != len(expected.Slots) {
+			t.Errorf("node %s: expect %+v, actual %+v", id, expected, actual)
+		}
+	}
+	if restored.nodes["c"].MasterID != "b" || len(restored.nodes["b"].Slots) != 4 || restored.slots[5].NodeID != "b" {
+		t.Error("slots of failing master should be taken over by replica")
+	}
+}
+
+func TestRaftRestart(t *testing.T) {
+	dir := t.TempDir()
+	factory := &testClientFactory{}
+	topo := newRaftTopology("127.0.0.1:6399", "127.0.0.1:0", dir, testRaftNodeTimeout, factory, nil)
+	if err := topo.StartAsSeed("127.0.0.1:6399"); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := topo.SetSlot([]uint32{100}, ""); err != nil {
+		t.Fatal(err.Error())
+	}
+	selfID := topo.GetSelfNodeID()
+	_ = topo.Close()
+
+	restarted := newRaftTopology("127.0.0.1:6399", "127.0.0.1:0", dir, testRaftNodeTimeout, factory, nil)
+	defer func() {
+		_ = restarted.Close()
+	}()
+	if !restarted.hasRaftState() {
+		t.Fatal("raft state should be saved")
+	}
+	if err := restarted.LoadConfigFile(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if restarted.GetSelfNodeID() != selfID {
+		t.Errorf("expect node id %s, actual %s", selfID, restarted.GetSelfNodeID())
+	}
+	waitFor(t, "state restored", func() bool {
+		node := restarted.GetNode(selfID)
+		return node != nil && len(node.Slots) == slotCount-1
+	})
+	if slot := restarted.GetSlots()[100]; slot != nil && slot.NodeID != "" {
+		t.Errorf("slot 100 should be unassigned")
+	}
+}
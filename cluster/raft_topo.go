@@ -0,0 +1,662 @@
+package cluster
+
+import (
+	"encoding/json"
+	"github.com/Allen9012/Godis/godis/connection"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/interface/godis"
+	"github.com/Allen9012/Godis/lib/logger"
+	"github.com/Allen9012/Godis/lib/utils"
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/24
+  @desc: 基于 raft 的拓扑, 所有节点都是 raft 组的成员, 元数据的修改由 leader 提交
+	1. cluster-as-seed 的节点初始化 raft 组并持有所有槽, 其他节点通过 cluster-seed 加入
+	2. 非 leader 节点收到的修改请求转发给 leader
+	3. leader 定期 PING 其他节点, 超过 cluster-node-timeout 未回复的主节点由它的从节点接管槽, 否则标记为 fail
+	4. 节点根据状态机中自己的角色执行 REPLICAOF
+	5. cluster-raft-dir 不为空时日志和快照保存在该目录, 重启后恢复
+  @modified by:
+**/
+
+const (
+	raftApplyTimeout = 5 * time.Second
+	// raftJoinTimeout is how long a new node waits to see itself in replicated state
+	raftJoinTimeout = 10 * time.Second
+	raftNodeIDFile  = "node-id"
+	raftDBFile      = "raft.db"
+	// raftRetainSnapshots is the number of snapshots kept in cluster-raft-dir
+	raftRetainSnapshots = 2
+)
+
+// raftTopology is a cluster topology replicated by raft
+type raftTopology struct {
+	selfNodeID string
+	selfAddr   string
+	// raftAddr is the address of raft transport, it must be reachable by other nodes
+	raftAddr string
+	// dir stores raft logs and snapshots, they are kept in memory if dir is empty
+	dir           string
+	nodeTimeout   time.Duration
+	clientFactory clientFactory
+	// onRoleChange is called with the address of master when current node becomes replica,
+	// or with empty string when current node becomes master
+	onRoleChange func(masterAddr string)
+
+	fsm       *clusterFSM
+	raft      *raft.Raft
+	transport *raft.NetworkTransport
+	boltStore *raftboltdb.BoltStore
+
+	// lastHeard is the last time leader received pong from node, it is reset after leadership changed
+	heardMu   sync.Mutex
+	lastHeard map[string]time.Time
+	pinging   sync.Map
+
+	// roleMu protects role, role is the master address current node replicates
+	roleMu sync.Mutex
+	role   string
+	roleCh chan string
+
+	startOnce sync.Once
+	closeOnce sync.Once
+	stopped   chan struct{}
+	done      sync.WaitGroup
+}
+
+// newRaftTopology
+//
+//	@Description: 创建后需要调用 StartAsSeed, Join 或 LoadConfigFile 之一
+//	@param selfAddr	当前节点地址
+//	@param raftAddr	raft 通信地址, 端口为 0 时随机选择
+//	@param dir	raft 日志和快照目录, 为空时保存在内存中
+//	@param nodeTimeout
+//	@param factory	用于向其他节点发送消息
+//	@param onRoleChange	当前节点成为主节点或从节点时调用
+//	@return *raftTopology
+func newRaftTopology(selfAddr string, raftAddr string, dir string, nodeTimeout time.Duration,
+	factory clientFactory, onRoleChange func(masterAddr string)) *raftTopology {
+	topo := &raftTopology{
+		selfAddr:      selfAddr,
+		raftAddr:      raftAddr,
+		dir:           dir,
+		nodeTimeout:   nodeTimeout,
+		clientFactory: factory,
+		onRoleChange:  onRoleChange,
+		fsm:           newClusterFSM(),
+		lastHeard:     make(map[string]time.Time),
+		roleCh:        make(chan string, 1),
+		stopped:       make(chan struct{}),
+	}
+	topo.fsm.onApply = topo.checkRole
+	return topo
+}
+
+// raftLogWriter writes logs of raft into godis logger
+type raftLogWriter struct{}
+
+func (w raftLogWriter) Write(p []byte) (int, error) {
+	logger.Warn(strings.TrimSpace(string(p)))
+	return len(p), nil
+}
+
+// hasRaftState returns whether raft state saved in dir can be restored by LoadConfigFile
+func (topo *raftTopology) hasRaftState() bool {
+	if topo.dir == "" {
+		return false
+	}
+	return fileExists(filepath.Join(topo.dir, raftNodeIDFile))
+}
+
+// startRaft creates raft instance, bootstrap a new raft group with only current node if bootstrap is true
+func (topo *raftTopology) startRaft(bootstrap bool) error {
+	conf := raft.DefaultConfig()
+	conf.LocalID = raft.ServerID(topo.selfNodeID)
+	// 心跳间隔随 cluster-node-timeout 缩短, 使 leader 故障能在超时内被发现
+	heartbeat := topo.nodeTimeout / 5
+	if heartbeat > time.Second {
+		heartbeat = time.Second
+	}
+	conf.HeartbeatTimeout = heartbeat
+	conf.ElectionTimeout = heartbeat
+	conf.LeaderLeaseTimeout = heartbeat / 2
+	conf.CommitTimeout = heartbeat / 10
+	conf.LogOutput = raftLogWriter{}
+	conf.LogLevel = "WARN"
+
+	transport, err := raft.NewTCPTransport(topo.raftAddr, nil, 3, 10*time.Second, raftLogWriter{})
+	if err != nil {
+		return err
+	}
+	var logStore raft.LogStore
+	var stableStore raft.StableStore
+	var snapshotStore raft.SnapshotStore
+	if topo.dir != "" {
+		if err := os.MkdirAll(topo.dir, 0755); err != nil {
+			_ = transport.Close()
+			return err
+		}
+		boltStore, err := raftboltdb.NewBoltStore(filepath.Join(topo.dir, raftDBFile))
+		if err != nil {
+			_ = transport.Close()
+			return err
+		}
+		snapshotStore, err = raft.NewFileSnapshotStore(topo.dir, raftRetainSnapshots, raftLogWriter{})
+		if err != nil {
+			_ = boltStore.Close()
+			_ = transport.Close()
+			return err
+		}
+		topo.boltStore = boltStore
+		logStore, stableStore = boltStore, boltStore
+	} else {
+		store := raft.NewInmemStore()
+		logStore, stableStore = store, store
+		snapshotStore = raft.NewInmemSnapshotStore()
+	}
+	r, err := raft.NewRaft(conf, topo.fsm, logStore, stableStore, snapshotStore, transport)
+	if err != nil {
+		_ = transport.Close()
+		if topo.boltStore != nil {
+			_ = topo.boltStore.Close()
+		}
+		return err
+	}
+	topo.raft = r
+	topo.transport = transport
+	topo.raftAddr = string(transport.LocalAddr())
+	if bootstrap {
+		err := r.BootstrapCluster(raft.Configuration{
+			Servers: []raft.Server{{
+				ID:      conf.LocalID,
+				Address: transport.LocalAddr(),
+			}},
+		}).Error()
+		if err != nil {
+			return err
+		}
+	}
+	if topo.dir != "" {
+		return os.WriteFile(filepath.Join(topo.dir, raftNodeIDFile), []byte(topo.selfNodeID), 0644)
+	}
+	return nil
+}
+
+// pollUntil checks cond until it returns true or timeout
+func pollUntil(cond func() bool, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+// StartAsSeed bootstraps a raft group in which current node is the only member and serves all slots
+func (topo *raftTopology) StartAsSeed(addr string) protocol.ErrorReply {
+	topo.selfAddr = addr
+	topo.selfNodeID = utils.RandHexString(40)
+	if err := topo.startRaft(true); err != nil {
+		return protocol.MakeErrReply("ERR start raft failed: " + err.Error())
+	}
+	if !pollUntil(func() bool { return topo.raft.State() == raft.Leader }, raftJoinTimeout) {
+		return protocol.MakeErrReply("ERR start raft failed: no leader elected")
+	}
+	if err := topo.propose(topo.makeAddNodeCmd()); err != nil {
+		return err
+	}
+	slotIDs := make([]uint32, slotCount)
+	for i := range slotIDs {
+		slotIDs[i] = uint32(i)
+	}
+	if err := topo.SetSlot(slotIDs, topo.selfNodeID); err != nil {
+		return err
+	}
+	topo.start()
+	return nil
+}
+
+func (topo *raftTopology) makeAddNodeCmd() *raftCommand {
+	return &raftCommand{
+		Type:     raftCmdAddNode,
+		NodeID:   topo.selfNodeID,
+		Addr:     topo.selfAddr,
+		RaftAddr: topo.raftAddr,
+	}
+}
+
+// Join asks seed to add current node into raft group as a master without slots
+//
+//	@Description: seed 不是 leader 时会转发给 leader, 等待当前节点出现在状态机中后返回
+//	@receiver topo
+//	@param seed	集群中任意节点的地址
+//	@return protocol.ErrorReply
+func (topo *raftTopology) Join(seed string) protocol.ErrorReply {
+	topo.selfNodeID = utils.RandHexString(40)
+	if err := topo.startRaft(false); err != nil {
+		return protocol.MakeErrReply("ERR start raft failed: " + err.Error())
+	}
+	cmd := topo.makeAddNodeCmd()
+	reply := topo.send(seed, utils.ToCmdLine("raft", "join", cmd.NodeID, cmd.Addr, cmd.RaftAddr))
+	if protocol.IsErrorReply(reply) {
+		return reply.(protocol.ErrorReply)
+	}
+	if !pollUntil(func() bool { return topo.GetNode(topo.selfNodeID) != nil }, raftJoinTimeout) {
+		return protocol.MakeErrReply("ERR join cluster timeout")
+	}
+	topo.start()
+	return nil
+}
+
+// LoadConfigFile restarts raft with logs and snapshots in cluster-raft-dir
+func (topo *raftTopology) LoadConfigFile() protocol.ErrorReply {
+	if !topo.hasRaftState() {
+		return protocol.MakeErrReply("ERR raft state not found in " + topo.dir)
+	}
+	nodeID, err := os.ReadFile(filepath.Join(topo.dir, raftNodeIDFile))
+	if err != nil {
+		return protocol.MakeErrReply("ERR read node id failed: " + err.Error())
+	}
+	topo.selfNodeID = strings.TrimSpace(string(nodeID))
+	if err := topo.startRaft(false); err != nil {
+		return protocol.MakeErrReply("ERR start raft failed: " + err.Error())
+	}
+	topo.start()
+	return nil
+}
+
+// send sends command to node at addr
+func (topo *raftTopology) send(addr string, cmdLine CmdLine) godis.Reply {
+	peer, err := topo.clientFactory.GetPeerClient(addr)
+	if err != nil {
+		return protocol.MakeErrReply("ERR " + err.Error())
+	}
+	defer func() {
+		_ = topo.clientFactory.ReturnPeerClient(addr, peer)
+	}()
+	return peer.Send(cmdLine)
+}
+
+// forward sends command to raft leader
+func (topo *raftTopology) forward(cmdLine CmdLine) protocol.ErrorReply {
+	_, leaderID := topo.raft.LeaderWithID()
+	leader := topo.GetNode(string(leaderID))
+	if leader == nil {
+		return protocol.MakeErrReply("CLUSTERDOWN The cluster is down")
+	}
+	reply := topo.send(leader.Addr, cmdLine)
+	if errReply, ok := reply.(protocol.ErrorReply); ok {
+		return errReply
+	}
+	return nil
+}
+
+// propose commits cmd through raft, it is forwarded to leader if current node is follower
+func (topo *raftTopology) propose(cmd *raftCommand) protocol.ErrorReply {
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return protocol.MakeErrReply("ERR " + err.Error())
+	}
+	if topo.raft.State() != raft.Leader {
+		return topo.forward(utils.ToCmdLine("raft", "propose", string(data)))
+	}
+	return topo.apply(data)
+}
+
+// apply commits data on leader
+func (topo *raftTopology) apply(data []byte) protocol.ErrorReply {
+	future := topo.raft.Apply(data, raftApplyTimeout)
+	if err := future.Error(); err != nil {
+		return protocol.MakeErrReply("CLUSTERDOWN " + err.Error())
+	}
+	if errReply, ok := future.Response().(protocol.ErrorReply); ok {
+		return errReply
+	}
+	return nil
+}
+
+// addVoter adds a new node into raft group, it is forwarded to leader if current node is follower
+func (topo *raftTopology) addVoter(nodeID string, addr string, raftAddr string) protocol.ErrorReply {
+	if topo.raft.State() != raft.Leader {
+		return topo.forward(utils.ToCmdLine("raft", "join", nodeID, addr, raftAddr))
+	}
+	err := topo.raft.AddVoter(raft.ServerID(nodeID), raft.ServerAddress(raftAddr), 0, raftApplyTimeout).Error()
+	if err != nil {
+		return protocol.MakeErrReply("ERR add raft voter failed: " + err.Error())
+	}
+	return topo.propose(&raftCommand{
+		Type:     raftCmdAddNode,
+		NodeID:   nodeID,
+		Addr:     addr,
+		RaftAddr: raftAddr,
+	})
+}
+
+// removeVoter removes node from raft group and cluster, it is forwarded to leader if current node is follower
+func (topo *raftTopology) removeVoter(nodeID string) protocol.ErrorReply {
+	if topo.raft.State() != raft.Leader {
+		return topo.forward(utils.ToCmdLine("raft", "forget", nodeID))
+	}
+	if topo.GetNode(nodeID) == nil {
+		return protocol.MakeErrReply("ERR Unknown node " + nodeID)
+	}
+	err := topo.raft.RemoveServer(raft.ServerID(nodeID), 0, raftApplyTimeout).Error()
+	if err != nil {
+		return protocol.MakeErrReply("ERR remove raft voter failed: " + err.Error())
+	}
+	return topo.propose(&raftCommand{
+		Type:   raftCmdForget,
+		NodeID: nodeID,
+	})
+}
+
+// execRaft handles internal commands between nodes
+//
+//	@Description: raft join node-id addr raft-addr | raft forget node-id | raft propose command
+//	@param cluster
+//	@param c
+//	@param cmdArgs
+//	@return godis.Reply
+func execRaft(cluster *Cluster, c godis.Connection, cmdArgs [][]byte) godis.Reply {
+	topo, ok := cluster.topology.(*raftTopology)
+	if !ok {
+		return protocol.MakeErrReply("ERR raft is not enabled")
+	}
+	if len(cmdArgs) < 2 {
+		return protocol.MakeArgNumErrReply("raft")
+	}
+	var errReply protocol.ErrorReply
+	switch strings.ToLower(string(cmdArgs[1])) {
+	case "join":
+		if len(cmdArgs) != 5 {
+			return protocol.MakeArgNumErrReply("raft|join")
+		}
+		errReply = topo.addVoter(string(cmdArgs[2]), string(cmdArgs[3]), string(cmdArgs[4]))
+	case "forget":
+		if len(cmdArgs) != 3 {
+			return protocol.MakeArgNumErrReply("raft|forget")
+		}
+		errReply = topo.removeVoter(string(cmdArgs[2]))
+	case "propose":
+		if len(cmdArgs) != 3 {
+			return protocol.MakeArgNumErrReply("raft|propose")
+		}
+		// 只有 leader 处理转发来的请求, 避免在 leader 切换时反复转发
+		if topo.raft.State() != raft.Leader {
+			return protocol.MakeErrReply("CLUSTERDOWN not raft leader")
+		}
+		errReply = topo.apply(cmdArgs[2])
+	default:
+		return protocol.MakeErrReply("ERR unknown raft subcommand '" + string(cmdArgs[1]) + "'")
+	}
+	if errReply != nil {
+		return errReply
+	}
+	return protocol.MakeOkReply()
+}
+
+func (topo *raftTopology) GetSelfNodeID() string {
+	return topo.selfNodeID
+}
+
+func (topo *raftTopology) GetNodes() []*Node {
+	topo.fsm.mu.RLock()
+	defer topo.fsm.mu.RUnlock()
+	return copyNodes(topo.fsm.nodes)
+}
+
+func (topo *raftTopology) GetNode(nodeID string) *Node {
+	topo.fsm.mu.RLock()
+	defer topo.fsm.mu.RUnlock()
+	node, ok := topo.fsm.nodes[nodeID]
+	if !ok {
+		return nil
+	}
+	return copyNode(node)
+}
+
+func (topo *raftTopology) GetSlots() []*Slot {
+	topo.fsm.mu.RLock()
+	defer topo.fsm.mu.RUnlock()
+	return topo.fsm.slots
+}
+
+// SetSlot assigns slots to node through raft, newNodeID is empty means unassign
+func (topo *raftTopology) SetSlot(slotIDs []uint32, newNodeID string) protocol.ErrorReply {
+	return topo.propose(&raftCommand{
+		Type:   raftCmdSetSlot,
+		NodeID: newNodeID,
+		Slots:  slotIDs,
+	})
+}
+
+// Replicate makes node become replica of master
+func (topo *raftTopology) Replicate(nodeID string, masterID string) protocol.ErrorReply {
+	return topo.propose(&raftCommand{
+		Type:     raftCmdReplicate,
+		NodeID:   nodeID,
+		MasterID: masterID,
+	})
+}
+
+// Meet is not supported, nodes join raft group through cluster-seed
+func (topo *raftTopology) Meet(addr string) protocol.ErrorReply {
+	return protocol.MakeErrReply("ERR CLUSTER MEET is not supported in raft mode, start the node with cluster-seed instead")
+}
+
+// Forget removes node from raft group, so it is forgotten by all nodes at once
+func (topo *raftTopology) Forget(nodeID string) protocol.ErrorReply {
+	if nodeID == topo.selfNodeID {
+		return protocol.MakeErrReply("ERR I tried hard but I can't forget myself...")
+	}
+	self := topo.GetNode(topo.selfNodeID)
+	if self != nil && self.MasterID == nodeID {
+		return protocol.MakeErrReply("ERR Can't forget my master!")
+	}
+	if topo.GetNode(nodeID) == nil {
+		return protocol.MakeErrReply("ERR Unknown node " + nodeID)
+	}
+	return topo.removeVoter(nodeID)
+}
+
+// Reset is not supported, the raft log of current node would conflict with the others
+func (topo *raftTopology) Reset(hard bool) protocol.ErrorReply {
+	return protocol.MakeErrReply("ERR CLUSTER RESET is not supported in raft mode")
+}
+
+// checkRole notifies role change of current node after state changed
+func (topo *raftTopology) checkRole() {
+	masterAddr := ""
+	topo.fsm.mu.RLock()
+	if self, ok := topo.fsm.nodes[topo.selfNodeID]; ok && self.MasterID != "" {
+		if master, ok := topo.fsm.nodes[self.MasterID]; ok {
+			masterAddr = master.Addr
+		}
+	}
+	topo.fsm.mu.RUnlock()
+	topo.roleMu.Lock()
+	defer topo.roleMu.Unlock()
+	if masterAddr == topo.role {
+		return
+	}
+	topo.role = masterAddr
+	// 只保留最新的角色, 旧的还未处理的通知直接丢弃
+	select {
+	case <-topo.roleCh:
+	default:
+	}
+	topo.roleCh <- masterAddr
+}
+
+// roleLoop calls onRoleChange in order, so that raft is not blocked by REPLICAOF
+func (topo *raftTopology) roleLoop() {
+	defer topo.done.Done()
+	for {
+		select {
+		case <-topo.stopped:
+			return
+		case masterAddr := <-topo.roleCh:
+			if topo.onRoleChange != nil {
+				topo.onRoleChange(masterAddr)
+			}
+		}
+	}
+}
+
+// start runs failure detection and role loop in background
+func (topo *raftTopology) start() {
+	topo.startOnce.Do(func() {
+		topo.done.Add(2)
+		go topo.roleLoop()
+		go topo.cron()
+	})
+}
+
+// cron detects failures periodically while current node is leader
+func (topo *raftTopology) cron() {
+	defer topo.done.Done()
+	interval := topo.nodeTimeout / 10
+	if interval > time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-topo.stopped:
+			return
+		case <-ticker.C:
+		}
+		if topo.raft.State() != raft.Leader {
+			// 新 leader 重新计时, 避免使用过期的 lastHeard
+			topo.heardMu.Lock()
+			topo.lastHeard = make(map[string]time.Time)
+			topo.heardMu.Unlock()
+			continue
+		}
+		topo.pingNodes()
+		topo.detectFailures()
+	}
+}
+
+// pingNodes sends PING to every node not waiting for PONG
+func (topo *raftTopology) pingNodes() {
+	for _, node := range topo.GetNodes() {
+		if node.ID == topo.selfNodeID {
+			continue
+		}
+		if _, waiting := topo.pinging.LoadOrStore(node.ID, struct{}{}); waiting {
+			continue
+		}
+		go func(node *Node) {
+			defer topo.pinging.Delete(node.ID)
+			reply := topo.send(node.Addr, utils.ToCmdLine("PING"))
+			if !protocol.IsErrorReply(reply) {
+				topo.heardMu.Lock()
+				topo.lastHeard[node.ID] = time.Now()
+				topo.heardMu.Unlock()
+			}
+		}(node)
+	}
+}
+
+// detectFailures promotes a replica of failing master, or marks failing node as fail
+func (topo *raftTopology) detectFailures() {
+	nodes := topo.GetNodes()
+	now := time.Now()
+	alive := make(map[string]bool, len(nodes))
+	topo.heardMu.Lock()
+	for _, node := range nodes {
+		if node.ID == topo.selfNodeID {
+			alive[node.ID] = true
+			continue
+		}
+		last, ok := topo.lastHeard[node.ID]
+		if !ok {
+			last = now
+			topo.lastHeard[node.ID] = now
+		}
+		alive[node.ID] = now.Sub(last) <= topo.nodeTimeout
+	}
+	topo.heardMu.Unlock()
+
+	for _, node := range nodes {
+		failed := node.Flags&nodeFlagFail != 0
+		var cmd *raftCommand
+		if alive[node.ID] && failed {
+			cmd = &raftCommand{Type: raftCmdRecover, NodeID: node.ID}
+		} else if !alive[node.ID] && !failed {
+			cmd = &raftCommand{Type: raftCmdFail, NodeID: node.ID}
+			if node.MasterID == "" && len(node.Slots) > 0 {
+				if replica := pickReplica(node.ID, nodes, alive); replica != "" {
+					cmd = &raftCommand{Type: raftCmdFailover, NodeID: replica, MasterID: node.ID}
+				}
+			}
+		}
+		if cmd == nil {
+			continue
+		}
+		if err := topo.propose(cmd); err != nil {
+			logger.Warn("propose " + cmd.Type + " " + cmd.NodeID + " failed: " + err.Error())
+			continue
+		}
+		if cmd.Type == raftCmdFailover {
+			logger.Info("cluster node " + cmd.MasterID + " is failing, replica " + cmd.NodeID + " takes over its slots")
+		}
+	}
+}
+
+// pickReplica returns an alive replica of master, replica with the smallest id is chosen so that the result is stable
+func pickReplica(masterID string, nodes []*Node, alive map[string]bool) string {
+	for _, node := range nodes {
+		if node.MasterID == masterID && alive[node.ID] && node.Flags&nodeFlagFail == 0 {
+			return node.ID
+		}
+	}
+	return ""
+}
+
+// Close stops background jobs and raft
+func (topo *raftTopology) Close() error {
+	var err error
+	topo.closeOnce.Do(func() {
+		close(topo.stopped)
+		topo.done.Wait()
+		if topo.raft != nil {
+			err = topo.raft.Shutdown().Error()
+		}
+		if topo.transport != nil {
+			_ = topo.transport.Close()
+		}
+		if topo.boltStore != nil {
+			_ = topo.boltStore.Close()
+		}
+	})
+	return err
+}
+
+// setMaster makes local db replicate the master at masterAddr, or become master if masterAddr is empty
+func (cluster *Cluster) setMaster(masterAddr string) {
+	cmdLine := utils.ToCmdLine("replicaof", "no", "one")
+	if masterAddr != "" {
+		host, port := splitAddr(masterAddr)
+		cmdLine = utils.ToCmdLine("replicaof", host, strconv.Itoa(port))
+	}
+	reply := cluster.db.Exec(connection.NewFakeConn(), cmdLine)
+	if protocol.IsErrorReply(reply) {
+		logger.Error("replicaof " + masterAddr + " failed: " + string(reply.ToBytes()))
+	}
+}
@@ -9,29 +9,118 @@
 */
 package cluster
 
-import "github.com/Allen9012/Godis/interface/godis"
+import (
+	"github.com/Allen9012/Godis/database"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/interface/godis"
+	"github.com/Allen9012/Godis/slowlog"
+)
+
+// keyCommands are routed by slot of their keys, keys of a command must belong to the same slot
+var keyCommands = []string{
+	"exists", "type", "del", "rename", "renamenx", "expire", "expireat", "pexpire", "pexpireat",
+	"expiretime", "pexpiretime", "ttl", "pttl", "persist",
+	"set", "setnx", "setex", "get", "getset", "getdel", "getex", "append", "strlen",
+	"incr", "incrby", "incrbyfloat", "decr", "decrby",
+	"setbit", "getbit", "bitcount", "bitpos", "bitop", "bitfield", "bitfield_ro",
+	"lpush", "lpushx", "rpush", "rpushx", "lpop", "rpop", "lrem", "llen", "lindex", "lset", "lrange",
+	"rpoplpush", "lmove", "lmpop", "blpop", "brpop", "brpoplpush", "blmove", "blmpop",
+	"hset", "hsetnx", "hget", "hexists", "hdel", "hlen", "hstrlen", "hmget", "hmset", "hkeys", "hvals",
+	"hgetall", "hincrby", "hincrbyfloat", "hrandfield", "hscan",
+	"sadd", "sismember", "srem", "spop", "scard", "smembers", "sinter", "sinterstore", "sunion",
+	"sunionstore", "sdiff", "sdiffstore", "srandmember", "sscan",
+	"zadd", "zscore", "zincrby", "zrank", "zrevrank", "zcount", "zcard", "zrange", "zrevrange",
+	"zrangebyscore", "zrevrangebyscore", "zrangebylex", "zrevrangebylex", "zlexcount", "zpopmin",
+	"zrem", "zremrangebyscore", "zremrangebyrank", "zremrangebylex", "zscan",
+	"xadd", "xlen", "xrange", "xrevrange", "xdel", "xtrim", "xsetid", "xread", "xreadgroup",
+	"xgroup", "xack", "xpending", "xclaim", "xautoclaim",
+	"geoadd", "geopos", "geodist", "geohash", "georadius", "georadius_ro", "georadiusbymember",
+	"georadiusbymember_ro", "geosearch", "geosearchstore",
+	"pfadd", "pfcount", "pfmerge", "pfdebug",
+}
 
 func makeRouter() map[string]CmdFunc {
 	routerMap := make(map[string]CmdFunc)
-	routerMap["exists"] = defaultFunc //exists k1
-	routerMap["type"] = defaultFunc
-	routerMap["rename"] = Rename
-	routerMap["renamenx"] = Rename
-	routerMap["set"] = defaultFunc
-	routerMap["setnx"] = defaultFunc
-	routerMap["get"] = defaultFunc
-	routerMap["getset"] = defaultFunc
-	routerMap["getnx"] = defaultFunc
+	for _, cmd := range keyCommands {
+		routerMap[cmd] = defaultFunc
+	}
 	routerMap["ping"] = Ping
 	routerMap["flushdb"] = FlushDB
-	routerMap["del"] = Del
 	routerMap["select"] = execSelect
+	routerMap["info"] = localFunc
+	routerMap["config"] = localFunc
+	routerMap["latency"] = localFunc
+	routerMap["client"] = localFunc
+	routerMap["slowlog"] = execSlowLog
+	routerMap["keys"] = localFunc
+	routerMap["scan"] = localFunc
+	routerMap["cluster"] = execCluster
+	routerMap["asking"] = execAsking
+	routerMap["migrate"] = execMigrate
+	routerMap["gossip"] = execGossip
+	routerMap["raft"] = execRaft
+	// 从节点通过 PSYNC 和 REPLCONF 与主节点同步
+	routerMap["psync"] = localFunc
+	routerMap["replconf"] = localFunc
 	return routerMap
 }
 
-// GET Key // Set K1 v1
+// execSlowLog reads slow log of cluster, which contains time of relaying commands to peers
+func execSlowLog(cluster *Cluster, c godis.Connection, cmdArgs [][]byte) godis.Reply {
+	return slowlog.Exec(cluster.slowlog, cmdArgs[1:])
+}
+
+// localFunc executes command on current node only, e.g. INFO
+func localFunc(cluster *Cluster, c godis.Connection, cmdArgs [][]byte) godis.Reply {
+	return cluster.db.Exec(c, cmdArgs)
+}
+
+// defaultFunc executes command if the slot of its keys is served by current node
+//
+//	@Description: 槽不在当前节点时返回 MOVED, 由客户端重定向到正确的节点, 如 GET key / SET k1 v1
+//	槽正在迁移时可能返回 ASK, 见 migration.go
+//	@param cluster
+//	@param c
+//	@param cmdArgs
+//	@return godis.Reply
 func defaultFunc(cluster *Cluster, c godis.Connection, cmdArgs [][]byte) godis.Reply {
-	key := string(cmdArgs[0])
-	peer := cluster.peerPicker.PickNode(key)
-	return cluster.relay(peer, c, cmdArgs)
+	slotID, hasKey, errReply := getCmdSlot(cmdArgs)
+	if errReply != nil {
+		return errReply
+	}
+	if !hasKey {
+		// 参数错误等情况由 db 返回错误
+		return cluster.db.Exec(c, cmdArgs)
+	}
+	node := cluster.pickNode(slotID)
+	if node == nil {
+		return protocol.MakeErrReply("CLUSTERDOWN Hash slot not served")
+	}
+	slot := cluster.getHostSlot(slotID)
+	if node.ID == cluster.topology.GetSelfNodeID() {
+		if slot != nil && slot.state == slotStateMigrating {
+			return cluster.execMigratingSlot(c, cmdArgs, slotID, slot.nodeID)
+		}
+		return cluster.db.Exec(c, cmdArgs)
+	}
+	// 客户端收到 ASK 后先发送 ASKING 再到导入槽的节点重试
+	if slot != nil && slot.state == slotStateImporting && cluster.isAsking(c) {
+		return cluster.db.Exec(c, cmdArgs)
+	}
+	return protocol.MakeMovedErrReply(slotID, node.Addr)
+}
+
+// getCmdSlot returns the slot of keys of command, hasKey is false if command has no key
+func getCmdSlot(cmdArgs [][]byte) (slotID uint32, hasKey bool, errReply protocol.ErrorReply) {
+	writeKeys, readKeys := database.GetRelatedKeys(cmdArgs)
+	for _, keys := range [][]string{writeKeys, readKeys} {
+		for _, key := range keys {
+			slot := getSlot(key)
+			if hasKey && slot != slotID {
+				return 0, false, protocol.MakeErrReply("CROSSSLOT Keys in request don't hash to the same slot")
+			}
+			slotID, hasKey = slot, true
+		}
+	}
+	return slotID, hasKey, nil
 }
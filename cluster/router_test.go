@@ -0,0 +1,71 @@
+package cluster
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/20
+  @desc: slot routing
+  @modified by:
+**/
+
+import (
+	"github.com/Allen9012/Godis/godis/connection"
+	"github.com/Allen9012/Godis/godis/protocol/asserts"
+	"strconv"
+	"testing"
+)
+
+// findKey returns a key whose slot is served by node
+func findKey(node *Cluster, prefix string) string {
+	for i := 0; ; i++ {
+		key := prefix + strconv.Itoa(i)
+		if node.pickNode(getSlot(key)).ID == node.topology.GetSelfNodeID() {
+			return key
+		}
+	}
+}
+
+func TestSlotRouting(t *testing.T) {
+	nodeA, nodeB := testCluster[0], testCluster[1]
+	conn := connection.NewFakeConn()
+	keyA := findKey(nodeA, "a")
+	keyB := findKey(nodeB, "b")
+
+	result := nodeA.Exec(conn, toArgs("SET", keyA, "1"))
+	asserts.AssertStatusReply(t, result, "OK")
+	result = nodeA.Exec(conn, toArgs("GET", keyA))
+	asserts.AssertBulkReply(t, result, "1")
+
+	// the wrong node redirects client instead of relaying
+	result = nodeB.Exec(conn, toArgs("GET", keyA))
+	asserts.AssertErrReply(t, result, "MOVED "+strconv.Itoa(int(getSlot(keyA)))+" "+nodeA.self)
+	result = nodeA.Exec(conn, toArgs("SET", keyB, "1"))
+	asserts.AssertErrReply(t, result, "MOVED "+strconv.Itoa(int(getSlot(keyB)))+" "+nodeB.self)
+	result = nodeB.db.Exec(conn, toArgs("GET", keyB))
+	asserts.AssertNullBulk(t, result)
+
+	// keys with the same hashtag are in the same slot
+	result = nodeA.Exec(conn, toArgs("RPUSH", "{"+keyA+"}list", "a"))
+	asserts.AssertIntReply(t, result, 1)
+	result = nodeA.Exec(conn, toArgs("DEL", keyA, "{"+keyA+"}list"))
+	asserts.AssertIntReply(t, result, 2)
+	result = nodeA.Exec(conn, toArgs("RENAME", keyA, keyB))
+	asserts.AssertErrReply(t, result, "CROSSSLOT Keys in request don't hash to the same slot")
+
+	result = nodeA.Exec(conn, toArgs("GET"))
+	asserts.AssertErrReply(t, result, "ERR wrong number of arguments for 'get' command")
+}
+
+func TestClusterSlots(t *testing.T) {
+	nodeA := testCluster[0]
+	conn := connection.NewFakeConn()
+	result := nodeA.Exec(conn, toArgs("CLUSTER", "SLOTS"))
+	expected := "*2\r\n" +
+		"*3\r\n:0\r\n:8191\r\n*4\r\n$9\r\n127.0.0.1\r\n:6399\r\n$14\r\n127.0.0.1:6399\r\n*0\r\n" +
+		"*3\r\n:8192\r\n:16383\r\n*4\r\n$9\r\n127.0.0.1\r\n:7379\r\n$14\r\n127.0.0.1:7379\r\n*0\r\n"
+	if string(result.ToBytes()) != expected {
+		t.Errorf("unexpected cluster slots %q", string(result.ToBytes()))
+	}
+	result = nodeA.Exec(conn, toArgs("CLUSTER", "KEYSLOT", "{user1000}.following"))
+	asserts.AssertIntReply(t, result, 3443)
+}
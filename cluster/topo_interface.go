@@ -2,7 +2,7 @@ package cluster
 
 import (
 	"github.com/Allen9012/Godis/godis/protocol"
-	"hash/crc32"
+	"sort"
 	"strings"
 	"time"
 )
@@ -28,41 +28,98 @@ type Slot struct {
 	Flags uint32
 }
 
-// getPartitionKey extract hashtag
+// getPartitionKey extract hashtag, which is between the first '{' and the first '}' after it
 func getPartitionKey(key string) string {
 	beg := strings.Index(key, "{")
 	if beg == -1 {
 		return key
 	}
-	end := strings.Index(key, "}")
-	if end == -1 || end == beg+1 {
+	end := strings.Index(key[beg+1:], "}")
+	if end <= 0 {
 		return key
 	}
-	return key[beg+1 : end]
+	return key[beg+1 : beg+1+end]
 }
 
+// getSlot returns slot of key like redis cluster, so that cluster clients can pick node locally
 func getSlot(key string) uint32 {
 	partitionKey := getPartitionKey(key)
-	return crc32.ChecksumIEEE([]byte(partitionKey)) % uint32(slotCount)
+	return uint32(crc16([]byte(partitionKey))) % uint32(slotCount)
 }
 
 // Node represents a node and its slots, used in cluster internal messages
 type Node struct {
-	ID        string
-	Addr      string
-	Slots     []*Slot // ascending order by slot id
-	Flags     uint32
-	lastHeard time.Time
+	ID    string
+	Addr  string
+	Slots []*Slot // ascending order by slot id
+	Flags uint32
+	// MasterID is id of the master if node is a replica, replicas serve no slots
+	MasterID string
+	// ConfigEpoch is the version of slots claimed by node, the claim with greater epoch wins
+	ConfigEpoch uint64
+	lastHeard   time.Time
+	// pingSent is the time of the ping waiting for pong, zero if no ping is waiting
+	pingSent time.Time
 }
 
+// flags of node
+const (
+	// nodeFlagPFail means current node cannot reach the node for cluster-node-timeout
+	nodeFlagPFail uint32 = 1 << iota
+	// nodeFlagFail means the majority of masters agree the node is failing
+	nodeFlagFail
+)
+
 type topology interface {
 	GetSelfNodeID() string
-	GetNodes() []*Node // return a copy
+	// GetNodes returns a copy of all nodes ordered by id
+	GetNodes() []*Node
+	// GetNode returns node with the given id, returns nil if not found
 	GetNode(nodeID string) *Node
+	// GetSlots returns all slots indexed by slot id, invoker should not modify it
 	GetSlots() []*Slot
 	StartAsSeed(addr string) protocol.ErrorReply
 	SetSlot(slotIDs []uint32, newNodeID string) protocol.ErrorReply
 	LoadConfigFile() protocol.ErrorReply
 	Join(seed string) protocol.ErrorReply
+	// Meet introduces the node at addr into cluster
+	Meet(addr string) protocol.ErrorReply
+	// Forget removes node from cluster, slots served by it become unassigned
+	Forget(nodeID string) protocol.ErrorReply
+	// Reset forgets all other nodes and releases all slots, current node gets a new id if hard is true
+	Reset(hard bool) protocol.ErrorReply
 	Close() error
 }
+
+// copyNode returns a copy of node, Slots are shared because they are never modified in place
+func copyNode(node *Node) *Node {
+	n := *node
+	return &n
+}
+
+// copyNodes returns copies of nodes ordered by id
+func copyNodes(nodes map[string]*Node) []*Node {
+	result := make([]*Node, 0, len(nodes))
+	for _, node := range nodes {
+		result = append(result, copyNode(node))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// rebuildNodeSlots refreshes Slots of every node according to slots, invoker should hold lock of topology
+func rebuildNodeSlots(nodes map[string]*Node, slots []*Slot) {
+	for _, node := range nodes {
+		node.Slots = nil
+	}
+	for _, slot := range slots {
+		if slot == nil {
+			continue
+		}
+		if node, ok := nodes[slot.NodeID]; ok {
+			node.Slots = append(node.Slots, slot)
+		}
+	}
+}
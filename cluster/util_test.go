@@ -1,7 +1,20 @@
 package cluster
 
 import (
+	"errors"
+	"github.com/Allen9012/Godis/config"
+	database2 "github.com/Allen9012/Godis/database"
+	"github.com/Allen9012/Godis/datastruct/dict"
+	"github.com/Allen9012/Godis/godis/connection"
+	"github.com/Allen9012/Godis/godis/parser"
+	"github.com/Allen9012/Godis/godis/protocol"
 	"github.com/Allen9012/Godis/interface/godis"
+	"github.com/Allen9012/Godis/lib/idgenerator"
+	"github.com/Allen9012/Godis/lib/utils"
+	"github.com/Allen9012/Godis/slowlog"
+	"os"
+	"sync"
+	"testing"
 )
 
 /**
@@ -14,64 +27,121 @@ import (
 
 var addresses = []string{"127.0.0.1:6399", "127.0.0.1:7379"}
 var timeoutFlags = []bool{false, false}
-var testCluster = mockClusterNodes(addresses, timeoutFlags)
+var testCluster []*Cluster
+
+func TestMain(m *testing.M) {
+	// 测试节点默认不开启 aof, 否则所有节点共用包目录下的 appendonly.aof, 多次运行之间会互相影响
+	config.Properties.AppendOnly = false
+	testCluster = mockClusterNodes(addresses, timeoutFlags)
+	os.Exit(m.Run())
+}
 
 type testClientFactory struct {
 	nodes        []*Cluster
 	timeoutFlags []bool
+	// mu guards timeoutFlags which may be changed while gossip is running
+	mu sync.RWMutex
 }
 
 type testClient struct {
-	targetNode  *Cluster
-	timeoutFlag *bool
-	conn        godis.Connection
+	targetNode *Cluster
+	factory    *testClientFactory
+	index      int
+	conn       godis.Connection
 }
 
 // mockClusterNodes creates a fake cluster for test
 // timeoutFlags should have the same length as addresses, set timeoutFlags[i] == true could simulate addresses[i] timeout
 func mockClusterNodes(addresses []string, timeoutFlags []bool) []*Cluster {
-	//nodes := make([]*Cluster, len(addresses))
-	//// build fixedTopology
-	//slots := make([]*Slot, slotCount)
-	//nodeMap := make(map[string]*Node)
-	//for _, addr := range addresses {
-	//	nodeMap[addr] = &Node{
-	//		ID:    addr,
-	//		Addr:  addr,
-	//		Slots: nil,
-	//	}
-	//}
-	//for i := range slots {
-	//	addr := addresses[i%len(addresses)]
-	//	slots[i] = &Slot{
-	//		ID:     uint32(i),
-	//		NodeID: addr,
-	//		Flags:  0,
-	//	}
-	//	nodeMap[addr].Slots = append(nodeMap[addr].Slots, slots[i])
-	//}
-	//factory := &testClientFactory{
-	//	nodes:        nodes,
-	//	timeoutFlags: timeoutFlags,
-	//}
-	//for i, addr := range addresses {
-	//	topo := &fixedTopology{
-	//		mu:         sync.RWMutex{},
-	//		nodeMap:    nodeMap,
-	//		slots:      slots,
-	//		selfNodeID: addr,
-	//	}
-	//	nodes[i] = &Cluster{
-	//		self:          addr,
-	//		db:            database2.NewStandaloneServer(),
-	//		transactions:  dict.MakeSimple(),
-	//		idGenerator:   idgenerator.MakeGenerator(config.Properties.Self),
-	//		topology:      topo,
-	//		clientFactory: factory,
-	//	}
-	//}
-	//return nodes
-
-	// TODO Implement me
-	panic("Implement me")
+	nodes := make([]*Cluster, len(addresses))
+	factory := &testClientFactory{
+		nodes:        nodes,
+		timeoutFlags: timeoutFlags,
+	}
+	for i, addr := range addresses {
+		nodes[i] = &Cluster{
+			self:          addr,
+			db:            database2.NewStandaloneServer(),
+			transactions:  dict.MakeSimple(),
+			idGenerator:   idgenerator.MakeGenerator(addr),
+			topology:      newFixedTopology(addr, addresses),
+			slots:         make(map[uint32]*hostSlot),
+			slowlog:       slowlog.MakeSlowLog(),
+			clientFactory: factory,
+		}
+	}
+	return nodes
+}
+
+func (factory *testClientFactory) GetPeerClient(peerAddr string) (peerClient, error) {
+	for i, n := range factory.nodes {
+		if n.self == peerAddr {
+			return &testClient{
+				targetNode: n,
+				factory:    factory,
+				index:      i,
+				conn:       connection.NewFakeConn(),
+			}, nil
+		}
+	}
+	return nil, errors.New("peer not found")
+}
+
+func (factory *testClientFactory) ReturnPeerClient(peerAddr string, peerClient peerClient) error {
+	return nil
+}
+
+// setTimeout simulates the i-th node is unreachable or recovered
+func (factory *testClientFactory) setTimeout(i int, timeout bool) {
+	factory.mu.Lock()
+	defer factory.mu.Unlock()
+	factory.timeoutFlags[i] = timeout
+}
+
+type mockStream struct {
+	conn *connection.FakeConn
+	ch   <-chan *parser.PayLoad
+}
+
+func (s *mockStream) Stream() <-chan *parser.PayLoad {
+	return s.ch
+}
+
+func (s *mockStream) Close() error {
+	return s.conn.Close()
+}
+
+// NewStream executes cmdLine on peer and parses replies written to a fake connection
+func (factory *testClientFactory) NewStream(peerAddr string, cmdLine CmdLine) (peerStream, error) {
+	for _, n := range factory.nodes {
+		if n.self == peerAddr {
+			conn := connection.NewFakeConn()
+			result := n.Exec(conn, cmdLine)
+			_, _ = conn.Write(result.ToBytes())
+			return &mockStream{
+				conn: conn,
+				ch:   parser.ParseStream(conn),
+			}, nil
+		}
+	}
+	return nil, errors.New("peer not found")
+}
+
+func (factory *testClientFactory) Close() error {
+	return nil
+}
+
+// Send executes command on target node directly, the fake connection keeps selected db like a real connection
+func (cli *testClient) Send(cmdLine [][]byte) godis.Reply {
+	cli.factory.mu.RLock()
+	timeout := cli.factory.timeoutFlags[cli.index]
+	cli.factory.mu.RUnlock()
+	if timeout {
+		return protocol.MakeErrReply("ERR timeout")
+	}
+	return cli.targetNode.Exec(cli.conn, cmdLine)
+}
+
+func toArgs(cmd ...string) [][]byte {
+	return utils.ToCmdLine(cmd...)
 }
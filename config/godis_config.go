@@ -43,10 +43,32 @@ type ServerProperties struct {
 	SlaveAnnouncePort int    `cfg:"slave-announce-port"`
 	SlaveAnnounceIP   string `cfg:"slave-announce-ip"`
 	ReplTimeout       int    `cfg:"repl-timeout"`
+	ReplBacklogSize   int    `cfg:"repl-backlog-size"`
+	ReplicaReadOnly   bool   `cfg:"replica-read-only"`
 	ClusterEnable     bool   `cfg:"cluster-enable"`
 	ClusterAsSeed     bool   `cfg:"cluster-as-seed"`
 	ClusterSeed       string `cfg:"cluster-seed"`
 	ClusterConfigFile string `cfg:"cluster-config-file"`
+	// milliseconds a node can be unreachable before it is considered failing
+	ClusterNodeTimeout int `cfg:"cluster-node-timeout"`
+	// cluster metadata is replicated by raft if cluster-raft-addr is set, raft logs are saved in cluster-raft-dir
+	ClusterRaftAddr string `cfg:"cluster-raft-addr"`
+	ClusterRaftDir  string `cfg:"cluster-raft-dir"`
+	// keyspace notifications, eg: "Ex" publishes expired events to __keyevent@<db>__:expired
+	NotifyKeyspaceEvents string `cfg:"notify-keyspace-events"`
+	// memory limit, eg: 100mb, 0 means no limit
+	MaxMemory        int    `cfg:"maxmemory"`
+	MaxMemoryPolicy  string `cfg:"maxmemory-policy"`
+	MaxMemorySamples int    `cfg:"maxmemory-samples"`
+	// frequency of background tasks such as active expire cycle, in times per second
+	Hz int `cfg:"hz"`
+	// expire-timewheel schedules a timewheel job for every key with ttl besides the active expire cycle
+	ExpireTimeWheel bool `cfg:"expire-timewheel"`
+	// commands slower than slowlog-log-slower-than microseconds are logged, negative disables slow log
+	SlowlogLogSlowerThan int `cfg:"slowlog-log-slower-than"`
+	SlowlogMaxLen        int `cfg:"slowlog-max-len"`
+	// events slower than latency-monitor-threshold milliseconds are sampled, 0 disables latency monitor
+	LatencyMonitorThreshold int `cfg:"latency-monitor-threshold"`
 	//   AOF
 	AppendOnly        bool   `cfg:"appendOnly"` //是否启用AOF
 	AppendFilename    string `cfg:"appendFilename"`
@@ -70,12 +92,26 @@ func (p *ServerProperties) AnnounceAddress() string {
 
 var EachTimeServerInfo *ServerInfo
 
+// defaultProperties holds default value of every setting, settings absent from config file keep these values
 var defaultProperties = &ServerProperties{
-	Bind:       "0.0.0.0",
-	Port:       9012,
-	AppendOnly: false,
-	MaxClients: 1000,
-	RunID:      utils.RandString(40),
+	Bind:                 "0.0.0.0",
+	Port:                 9012,
+	AppendOnly:           false,
+	MaxClients:           1000,
+	ReplicaReadOnly:      true,
+	MaxMemoryPolicy:      "noeviction",
+	MaxMemorySamples:     5,
+	Hz:                   10,
+	SlowlogLogSlowerThan: 10000,
+	SlowlogMaxLen:        128,
+	ClusterNodeTimeout:   15000,
+}
+
+// newProperties returns a copy of defaultProperties with a new run id
+func newProperties() *ServerProperties {
+	p := *defaultProperties
+	p.RunID = utils.RandString(40)
+	return &p
 }
 
 func init() {
@@ -84,13 +120,10 @@ func init() {
 		StartUpTime: time.Now(),
 	}
 
-	// default config
-	Properties = &ServerProperties{
-		Bind:       "127.0.0.1",
-		Port:       6379,
-		AppendOnly: false,
-		RunID:      utils.RandString(40),
-	}
+	// default config, listens on localhost until config file is loaded
+	Properties = newProperties()
+	Properties.Bind = "127.0.0.1"
+	Properties.Port = 6379
 	// init flag
 	flagInit()
 }
@@ -119,7 +152,7 @@ func Set_godis_config() {
 	if fileExists(config_file) {
 		SetupConfig(config_file)
 	} else {
-		Properties = defaultProperties
+		Properties = newProperties()
 	}
 
 }
@@ -153,7 +186,8 @@ func SetupConfig(configFilename string) {
 
 // parse config file
 func parse(src io.Reader) *ServerProperties {
-	config := &ServerProperties{}
+	// 未出现在配置文件中的字段使用默认值
+	config := newProperties()
 
 	// read config file
 	rawMap := make(map[string]string)
@@ -192,7 +226,7 @@ func parse(src io.Reader) *ServerProperties {
 			case reflect.String:
 				fieldVal.SetString(value)
 			case reflect.Int:
-				intValue, err := strconv.ParseInt(value, 10, 64)
+				intValue, err := parseMemory(value)
 				if err == nil {
 					fieldVal.SetInt(intValue)
 				}
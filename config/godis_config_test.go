@@ -35,4 +35,10 @@ func TestParse(t *testing.T) {
 	if len(p.Peers) != 2 || p.Peers[0] != "a" || p.Peers[1] != "b" {
 		t.Error("list parse failed")
 	}
+	if p.MaxClients != defaultProperties.MaxClients || p.Hz != defaultProperties.Hz || !p.ReplicaReadOnly {
+		t.Error("absent settings should keep default values")
+	}
+	if p.RunID == "" || p.RunID == Properties.RunID {
+		t.Error("run id should be generated for every properties")
+	}
 }
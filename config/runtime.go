@@ -0,0 +1,352 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"github.com/Allen9012/Godis/lib/wildcard"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/7
+  @desc: 运行时读写配置, 供 CONFIG GET/SET/REWRITE 使用
+  @modified by:
+**/
+
+// ErrImmutable is returned by SetProperty when the parameter cannot be changed during runtime
+var ErrImmutable = errors.New("can't set immutable config")
+
+// ErrUnknownProperty is returned when the parameter doesn't exist
+var ErrUnknownProperty = errors.New("unknown config parameter")
+
+// maxMemoryPolicies are allowed values of maxmemory-policy
+var maxMemoryPolicies = []string{"noeviction", "allkeys-lru", "allkeys-lfu", "allkeys-random",
+	"volatile-lru", "volatile-lfu", "volatile-random", "volatile-ttl"}
+
+// propertiesMu guards fields of Properties which can be changed by CONFIG SET
+var propertiesMu sync.RWMutex
+
+// Get reads a field of Properties which may be changed by CONFIG SET during runtime
+//
+//	@Description: 服务启动后读取可以被 CONFIG SET 修改的配置都需要通过 Get, eg: config.Get(&config.Properties.Hz)
+//	@param field	Properties 字段的地址
+//	@return T
+func Get[T any](field *T) T {
+	propertiesMu.RLock()
+	defer propertiesMu.RUnlock()
+	return *field
+}
+
+// propertyValidators validates the value of parameters which can be changed by CONFIG SET
+var propertyValidators = map[string]func(value string) error{
+	"appendonly":                validateBool,
+	"appendfsync":               validateEnum("always", "everysec", "no"),
+	"aof-use-rdb-preamble":      validateBool,
+	"maxclients":                validateIntRange(1, 1<<31-1),
+	"requirepass":               nil,
+	"masterauth":                nil,
+	"repl-timeout":              validateIntRange(1, 1<<31-1),
+	"repl-backlog-size":         validateIntRange(1, 1<<31-1),
+	"replica-read-only":         validateBool,
+	"slave-announce-ip":         nil,
+	"slave-announce-port":       validateIntRange(0, 65535),
+	"dbfilename":                validateFilename,
+	"notify-keyspace-events":    validateKeyspaceEvents,
+	"maxmemory":                 validateMemory,
+	"maxmemory-policy":          validateEnum(maxMemoryPolicies...),
+	"maxmemory-samples":         validateIntRange(1, 64),
+	"hz":                        validateIntRange(1, 500),
+	"expire-timewheel":          validateBool,
+	"slowlog-log-slower-than":   validateIntRange(-1, 1<<63-1),
+	"slowlog-max-len":           validateIntRange(0, 1<<31-1),
+	"latency-monitor-threshold": validateIntRange(0, 1<<63-1),
+	"cluster-node-timeout":      validateIntRange(1, 1<<31-1),
+}
+
+// propertyField returns the struct field of parameter name, name is case-insensitive
+func propertyField(name string) (reflect.Value, bool) {
+	name = strings.ToLower(name)
+	v := reflect.ValueOf(Properties).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if propertyName(t.Field(i)) == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// propertyName returns the lower case name in config file, returns empty string for internal fields
+func propertyName(field reflect.StructField) string {
+	key, ok := field.Tag.Lookup("cfg")
+	if !ok {
+		return strings.ToLower(field.Name)
+	}
+	if strings.Contains(key, ",omitempty") {
+		// CfPath is not a config parameter
+		return ""
+	}
+	return strings.ToLower(key)
+}
+
+// formatValue formats field value the same as config file
+func formatValue(value reflect.Value) string {
+	switch value.Kind() {
+	case reflect.String:
+		return value.String()
+	case reflect.Int:
+		return strconv.FormatInt(value.Int(), 10)
+	case reflect.Bool:
+		if value.Bool() {
+			return "yes"
+		}
+		return "no"
+	case reflect.Slice:
+		if slice, ok := value.Interface().([]string); ok {
+			return strings.Join(slice, ",")
+		}
+	}
+	return ""
+}
+
+// GetProperties returns name and value of parameters matching any of patterns, sorted by name
+func GetProperties(patterns ...string) [][2]string {
+	propertiesMu.RLock()
+	defer propertiesMu.RUnlock()
+	return Properties.list(patterns...)
+}
+
+// list returns name and value of parameters in p matching any of patterns
+func (p *ServerProperties) list(patterns ...string) [][2]string {
+	compiled := make([]*wildcard.Pattern, 0, len(patterns))
+	for _, pattern := range patterns {
+		compiled = append(compiled, wildcard.CompilePattern(strings.ToLower(pattern)))
+	}
+	var result [][2]string
+	v := reflect.ValueOf(p).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := propertyName(t.Field(i))
+		if name == "" {
+			continue
+		}
+		for _, pattern := range compiled {
+			if pattern.IsMatch(name) {
+				result = append(result, [2]string{name, formatValue(v.Field(i))})
+				break
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i][0] < result[j][0]
+	})
+	return result
+}
+
+// GetProperty returns the current value of parameter
+func GetProperty(name string) (string, error) {
+	field, ok := propertyField(name)
+	if !ok {
+		return "", ErrUnknownProperty
+	}
+	propertiesMu.RLock()
+	defer propertiesMu.RUnlock()
+	return formatValue(field), nil
+}
+
+// SetProperty validates value and sets it into Properties, only parameters in propertyValidators can be set
+func SetProperty(name string, value string) error {
+	name = strings.ToLower(name)
+	field, ok := propertyField(name)
+	if !ok {
+		return ErrUnknownProperty
+	}
+	validator, ok := propertyValidators[name]
+	if !ok {
+		return ErrImmutable
+	}
+	if validator != nil {
+		if err := validator(value); err != nil {
+			return err
+		}
+	}
+	propertiesMu.Lock()
+	defer propertiesMu.Unlock()
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		intValue, _ := parseMemory(value)
+		field.SetInt(intValue)
+	case reflect.Bool:
+		field.SetBool(strings.ToLower(value) == "yes")
+	}
+	return nil
+}
+
+func validateBool(value string) error {
+	value = strings.ToLower(value)
+	if value != "yes" && value != "no" {
+		return errors.New("argument must be 'yes' or 'no'")
+	}
+	return nil
+}
+
+func validateEnum(options ...string) func(value string) error {
+	return func(value string) error {
+		for _, option := range options {
+			if strings.ToLower(value) == option {
+				return nil
+			}
+		}
+		return errors.New("argument(s) must be one of the following: " + strings.Join(options, ", "))
+	}
+}
+
+func validateIntRange(min int64, max int64) func(value string) error {
+	return func(value string) error {
+		intValue, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return errors.New("argument couldn't be parsed into an integer")
+		}
+		if intValue < min || intValue > max {
+			return errors.New("argument must be between " + strconv.FormatInt(min, 10) +
+				" and " + strconv.FormatInt(max, 10) + " inclusive")
+		}
+		return nil
+	}
+}
+
+// parseMemory parses integer with optional memory unit like redis, eg: 100, 1k, 1kb, 2mb, 1gb
+// k/m/g are powers of 1000, kb/mb/gb are powers of 1024
+func parseMemory(value string) (int64, error) {
+	units := []struct {
+		suffix string
+		mul    int64
+	}{
+		{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+		{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+	}
+	lower := strings.ToLower(value)
+	mul := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(lower, unit.suffix) {
+			lower = strings.TrimSuffix(lower, unit.suffix)
+			mul = unit.mul
+			break
+		}
+	}
+	n, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * mul, nil
+}
+
+func validateMemory(value string) error {
+	n, err := parseMemory(value)
+	if err != nil || n < 0 {
+		return errors.New("argument must be a memory value")
+	}
+	return nil
+}
+
+func validateFilename(value string) error {
+	if value == "" || strings.ContainsAny(value, "/\\") {
+		return errors.New("dbfilename can't be a path, just a filename")
+	}
+	return nil
+}
+
+// validateKeyspaceEvents accepts classes of keyspace events, see notify-keyspace-events of redis
+func validateKeyspaceEvents(value string) error {
+	for _, c := range value {
+		if !strings.ContainsRune("Ag$lshzxetKE", c) {
+			return errors.New("Invalid event class character. Use 'Ag$lshzxetKE'.")
+		}
+	}
+	return nil
+}
+
+// RewriteConfigFile writes current values back into config file
+// lines of other parameters and comments are kept, parameters which are missing in the file
+// and differ from default values are appended at the end of file
+func RewriteConfigFile() error {
+	if Properties.CfPath == "" {
+		return errors.New("the server is running without a config file")
+	}
+	var lines []string
+	file, err := os.Open(Properties.CfPath)
+	if err == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		_ = file.Close()
+		if err = scanner.Err(); err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	current := GetProperties("*")
+	values := make(map[string]string, len(current))
+	for _, kv := range current {
+		values[kv[0]] = kv[1]
+	}
+	written := make(map[string]struct{})
+	for i, line := range lines {
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		pivot := strings.IndexAny(line, " ")
+		if pivot <= 0 {
+			continue
+		}
+		name := strings.ToLower(line[:pivot])
+		value, ok := values[name]
+		if !ok {
+			continue
+		}
+		lines[i] = line[:pivot] + " " + value
+		written[name] = struct{}{}
+	}
+	defaults := make(map[string]string)
+	for _, kv := range parse(strings.NewReader("")).list("*") {
+		defaults[kv[0]] = kv[1]
+	}
+	for _, kv := range current {
+		if _, ok := written[kv[0]]; ok || kv[0] == "runid" || kv[1] == defaults[kv[0]] {
+			continue
+		}
+		lines = append(lines, kv[0]+" "+kv[1])
+	}
+
+	// write into a tmp file first, so that a crash won't damage the config file
+	tmpFile, err := os.CreateTemp(filepath.Dir(Properties.CfPath), "*.conf")
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(tmpFile)
+	for _, line := range lines {
+		_, _ = writer.WriteString(line + "\n")
+	}
+	if err = writer.Flush(); err == nil {
+		err = tmpFile.Sync()
+	}
+	_ = tmpFile.Close()
+	if err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return err
+	}
+	return os.Rename(tmpFile.Name(), Properties.CfPath)
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/7
+  @desc:
+  @modified by:
+**/
+
+func TestGetAndSetProperty(t *testing.T) {
+	origin := Properties
+	defer func() {
+		Properties = origin
+	}()
+	Properties = parse(strings.NewReader("appendfsync everysec\nappendonly yes\nport 6399"))
+
+	result := GetProperties("append*", "port")
+	expected := [][2]string{{"appendfilename", ""}, {"appendfsync", "everysec"}, {"appendonly", "yes"}, {"port", "6399"}}
+	if len(result) != len(expected) {
+		t.Fatalf("wrong properties: %v", result)
+	}
+	for i, kv := range expected {
+		if result[i] != kv {
+			t.Errorf("expect %v, actual %v", kv, result[i])
+		}
+	}
+
+	if err := SetProperty("APPENDFSYNC", "always"); err != nil {
+		t.Error(err)
+	}
+	if value, _ := GetProperty("appendfsync"); value != "always" {
+		t.Errorf("expect always, actual %s", value)
+	}
+	if err := SetProperty("appendfsync", "sometimes"); err == nil {
+		t.Error("expect validation error")
+	}
+	if err := SetProperty("maxclients", "abc"); err == nil {
+		t.Error("expect validation error")
+	}
+	if err := SetProperty("replica-read-only", "no"); err != nil || Properties.ReplicaReadOnly {
+		t.Error("set bool failed")
+	}
+	if err := SetProperty("port", "6380"); err != ErrImmutable {
+		t.Errorf("expect ErrImmutable, actual %v", err)
+	}
+	if err := SetProperty("no-such-config", "1"); err != ErrUnknownProperty {
+		t.Errorf("expect ErrUnknownProperty, actual %v", err)
+	}
+}
+
+func TestRewriteConfigFile(t *testing.T) {
+	origin := Properties
+	defer func() {
+		Properties = origin
+	}()
+	filename := filepath.Join(t.TempDir(), "redis.conf")
+	content := "# comment line\n" +
+		"port 6399\n" +
+		"appendfsync everysec\n" +
+		"\n" +
+		"# appendonly no\n"
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	Properties = parse(strings.NewReader(content))
+	Properties.CfPath = filename
+	if err := SetProperty("appendfsync", "always"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetProperty("maxclients", "100"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RewriteConfigFile(); err != nil {
+		t.Fatal(err)
+	}
+	bytes, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "# comment line\n" +
+		"port 6399\n" +
+		"appendfsync always\n" +
+		"\n" +
+		"# appendonly no\n" +
+		"maxclients 100\n"
+	if string(bytes) != expected {
+		t.Errorf("wrong config file:\n%s", bytes)
+	}
+	// rewrite again changes nothing
+	if err := RewriteConfigFile(); err != nil {
+		t.Fatal(err)
+	}
+	bytes, _ = os.ReadFile(filename)
+	if string(bytes) != expected {
+		t.Errorf("wrong config file:\n%s", bytes)
+	}
+}
+
+func TestSetMaxMemory(t *testing.T) {
+	origin := Properties
+	defer func() {
+		Properties = origin
+	}()
+	Properties = parse(strings.NewReader("maxmemory 1gb"))
+	if Properties.MaxMemory != 1<<30 || Properties.MaxMemoryPolicy != "noeviction" {
+		t.Errorf("wrong maxmemory %d %s", Properties.MaxMemory, Properties.MaxMemoryPolicy)
+	}
+	for value, expected := range map[string]int{"100": 100, "1k": 1000, "2KB": 2048, "3mb": 3 << 20, "1g": 1000000000} {
+		if err := SetProperty("maxmemory", value); err != nil {
+			t.Fatal(err)
+		}
+		if Properties.MaxMemory != expected {
+			t.Errorf("expect %d for %s, actual %d", expected, value, Properties.MaxMemory)
+		}
+	}
+	for _, value := range []string{"abc", "-1", "1tb"} {
+		if err := SetProperty("maxmemory", value); err == nil {
+			t.Errorf("expect validation error for %s", value)
+		}
+	}
+	if err := SetProperty("maxmemory-policy", "allkeys-lru"); err != nil {
+		t.Error(err)
+	}
+	if err := SetProperty("maxmemory-policy", "lru"); err == nil {
+		t.Error("expect validation error")
+	}
+}
+
+// TestConcurrentSetProperty should be run with -race
+func TestConcurrentSetProperty(t *testing.T) {
+	origin := Properties
+	defer func() {
+		Properties = origin
+	}()
+	Properties = parse(strings.NewReader(""))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_ = SetProperty("hz", "20")
+			_ = SetProperty("maxmemory-policy", "allkeys-lru")
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if hz := Get(&Properties.Hz); hz != 10 && hz != 20 {
+			t.Fatalf("unexpected hz %d", hz)
+		}
+		_ = Get(&Properties.MaxMemoryPolicy)
+	}
+	<-done
+	if Get(&Properties.Hz) != 20 || Get(&Properties.MaxMemoryPolicy) != "allkeys-lru" {
+		t.Error("set property failed")
+	}
+}
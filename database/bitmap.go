@@ -0,0 +1,330 @@
+package database
+
+import (
+	"github.com/Allen9012/Godis/datastruct/bitmap"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/interface/database"
+	"github.com/Allen9012/Godis/interface/godis"
+	"github.com/Allen9012/Godis/lib/utils"
+	"strconv"
+	"strings"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/13
+  @desc: BITOP 与 BITFIELD 命令, 位序与 SETBIT/GETBIT 一致
+	BITFIELD 中整数的低位存放在较小的偏移上
+  @modified by:
+**/
+
+func init() {
+	registerCommand("BitOp", execBitOp, prepareBitOp, undoBitOp, -4, flagWrite)
+	registerCommand("BitField", execBitField, writeFirstKey, rollbackFirstKey, -2, flagWrite)
+	registerCommand("BitField_RO", execBitFieldRO, readFirstKey, nil, -2, flagReadOnly)
+}
+
+// maxBitOffset is the max bit offset of bitfield, the same as redis 512MB string limit
+const maxBitOffset = int64(1) << 32
+
+func prepareBitOp(args [][]byte) ([]string, []string) {
+	readKeys := make([]string, 0, len(args)-2)
+	for _, arg := range args[2:] {
+		readKeys = append(readKeys, string(arg))
+	}
+	return []string{string(args[1])}, readKeys
+}
+
+func undoBitOp(db *DB, args [][]byte) []CmdLine {
+	return rollbackGivenKeys(db, string(args[1]))
+}
+
+// execBitOp
+//
+//	@Description: BITOP AND|OR|XOR|NOT destkey key [key ...]
+//	不存在的 key 视为空字符串, 结果为空时删除 destkey
+//	@param db
+//	@param args
+//	@return godis.Reply	destkey 中字符串的长度
+func execBitOp(db *DB, args [][]byte) godis.Reply {
+	operation := strings.ToUpper(string(args[0]))
+	dest := string(args[1])
+	var op bitmap.BitOp
+	switch operation {
+	case "AND":
+		op = bitmap.OpAnd
+	case "OR":
+		op = bitmap.OpOr
+	case "XOR":
+		op = bitmap.OpXor
+	case "NOT":
+		if len(args) != 3 {
+			return protocol.MakeErrReply("ERR BITOP NOT must be called with a single source key.")
+		}
+	default:
+		return protocol.MakeSyntaxErrReply()
+	}
+	sources := make([]*bitmap.BitMap, 0, len(args)-2)
+	for _, arg := range args[2:] {
+		bs, errReply := db.getAsString(string(arg))
+		if errReply != nil {
+			return errReply
+		}
+		sources = append(sources, bitmap.FromBytes(bs))
+	}
+	var result *bitmap.BitMap
+	if op == nil {
+		result = sources[0].Not()
+	} else {
+		result = bitmap.Combine(op, sources...)
+	}
+	bs := result.ToBytes()
+	if len(bs) == 0 {
+		db.removeAndNotify(dest)
+	} else {
+		db.PutEntity(dest, &database.DataEntity{Data: bs})
+		db.Persist(dest)
+		db.notifyKeyspaceEvent(notifyString, "set", dest)
+	}
+	db.addAof(utils.ToCmdLine3("bitop", args...))
+	return protocol.MakeIntReply(int64(len(bs)))
+}
+
+// bitFieldOp is a GET, SET or INCRBY subcommand of BITFIELD
+type bitFieldOp struct {
+	action   string
+	signed   bool
+	width    int
+	offset   int64
+	value    int64
+	overflow string
+}
+
+// parseBitFieldType parses type like i16 or u8, unsigned integer of 64 bits is not supported
+func parseBitFieldType(arg string) (signed bool, width int, ok bool) {
+	if len(arg) < 2 {
+		return false, 0, false
+	}
+	switch arg[0] {
+	case 'i', 'I':
+		signed = true
+	case 'u', 'U':
+		signed = false
+	default:
+		return false, 0, false
+	}
+	width, err := strconv.Atoi(arg[1:])
+	if err != nil || width < 1 || width > 64 || (!signed && width == 64) {
+		return false, 0, false
+	}
+	return signed, width, true
+}
+
+// parseBitFieldOffset parses offset, offset prefixed with # is multiplied by width
+func parseBitFieldOffset(arg string, width int) (int64, bool) {
+	multiply := strings.HasPrefix(arg, "#")
+	if multiply {
+		arg = arg[1:]
+	}
+	offset, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || offset < 0 {
+		return 0, false
+	}
+	if multiply {
+		if offset > maxBitOffset/int64(width) {
+			return 0, false
+		}
+		offset *= int64(width)
+	}
+	if offset+int64(width) > maxBitOffset {
+		return 0, false
+	}
+	return offset, true
+}
+
+// parseBitFieldOps parses all subcommands before executing any of them
+//
+//	@Description: GET type offset | SET type offset value | INCRBY type offset increment | OVERFLOW WRAP|SAT|FAIL
+//	OVERFLOW 作用于其后的 SET 和 INCRBY
+//	@param args
+//	@param readOnly	BITFIELD_RO 只允许 GET
+//	@return []*bitFieldOp
+//	@return protocol.ErrorReply
+func parseBitFieldOps(args [][]byte, readOnly bool) ([]*bitFieldOp, protocol.ErrorReply) {
+	overflow := "wrap"
+	var ops []*bitFieldOp
+	for i := 0; i < len(args); {
+		action := strings.ToLower(string(args[i]))
+		if readOnly && action != "get" {
+			return nil, protocol.MakeErrReply("ERR BITFIELD_RO only supports the GET subcommand")
+		}
+		switch action {
+		case "overflow":
+			if i+1 >= len(args) {
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+			overflow = strings.ToLower(string(args[i+1]))
+			if overflow != "wrap" && overflow != "sat" && overflow != "fail" {
+				return nil, protocol.MakeErrReply("ERR Invalid OVERFLOW type specified")
+			}
+			i += 2
+			continue
+		case "get":
+			if i+2 >= len(args) {
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+		case "set", "incrby":
+			if i+3 >= len(args) {
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+		default:
+			return nil, protocol.MakeSyntaxErrReply()
+		}
+		op := &bitFieldOp{action: action, overflow: overflow}
+		var ok bool
+		op.signed, op.width, ok = parseBitFieldType(string(args[i+1]))
+		if !ok {
+			return nil, protocol.MakeErrReply("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+		}
+		op.offset, ok = parseBitFieldOffset(string(args[i+2]), op.width)
+		if !ok {
+			return nil, protocol.MakeErrReply("ERR bit offset is not an integer or out of range")
+		}
+		i += 3
+		if action != "get" {
+			value, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				return nil, protocol.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			op.value = value
+			i++
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+// valueOf converts raw bits of field to integer
+func (op *bitFieldOp) valueOf(raw uint64) int64 {
+	if op.signed && op.width < 64 && raw&(1<<(op.width-1)) != 0 {
+		raw |= ^uint64(0) << op.width
+	}
+	return int64(raw)
+}
+
+func overflowResult(overflow string, wrapped uint64, limit uint64) (uint64, bool) {
+	switch overflow {
+	case "sat":
+		return limit, true
+	case "fail":
+		return 0, false
+	}
+	return wrapped, true
+}
+
+// addUnsigned returns value+incr in unsigned field of width bits, returns false if overflow with FAIL policy
+func addUnsigned(value uint64, incr int64, width int, overflow string) (uint64, bool) {
+	max := uint64(1)<<width - 1
+	wrapped := value + uint64(incr)
+	if value > max || (incr > 0 && uint64(incr) > max-value) {
+		return overflowResult(overflow, wrapped, max)
+	}
+	if incr < 0 && uint64(-incr) > value {
+		return overflowResult(overflow, wrapped, 0)
+	}
+	return wrapped, true
+}
+
+// addSigned returns value+incr in signed field of width bits, returns false if overflow with FAIL policy
+func addSigned(value int64, incr int64, width int, overflow string) (uint64, bool) {
+	max := int64(uint64(1)<<(width-1) - 1)
+	min := -max - 1
+	wrapped := uint64(value) + uint64(incr)
+	if value > max || (incr > 0 && value > max-incr) {
+		return overflowResult(overflow, wrapped, uint64(max))
+	}
+	if value < min || (incr < 0 && value < min-incr) {
+		return overflowResult(overflow, wrapped, uint64(min))
+	}
+	return wrapped, true
+}
+
+// apply returns the new raw bits of SET or INCRBY
+func (op *bitFieldOp) apply(raw uint64) (uint64, bool) {
+	value, incr := op.value, int64(0)
+	if op.action == "incrby" {
+		value, incr = op.valueOf(raw), op.value
+	}
+	if op.signed {
+		return addSigned(value, incr, op.width, op.overflow)
+	}
+	return addUnsigned(uint64(value), incr, op.width, op.overflow)
+}
+
+// bitField executes BITFIELD or BITFIELD_RO
+//
+//	@Description: 按顺序执行子命令, SET 返回旧值, INCRBY 返回新值, 溢出且策略为 FAIL 时返回 nil 并且不修改
+//	@receiver db
+//	@param args
+//	@param readOnly
+//	@return godis.Reply
+func (db *DB) bitField(args [][]byte, readOnly bool) godis.Reply {
+	key := string(args[0])
+	ops, errReply := parseBitFieldOps(args[1:], readOnly)
+	if errReply != nil {
+		return errReply
+	}
+	bs, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	bm := bitmap.FromBytes(bs)
+	changed := false
+	replies := make([]godis.Reply, 0, len(ops))
+	for _, op := range ops {
+		raw := bm.GetBits(op.offset, op.width)
+		if op.action == "get" {
+			replies = append(replies, protocol.MakeIntReply(op.valueOf(raw)))
+			continue
+		}
+		result, ok := op.apply(raw)
+		if !ok {
+			replies = append(replies, protocol.MakeNullBulkReply())
+			continue
+		}
+		bm.SetBits(op.offset, op.width, result)
+		changed = true
+		if op.action == "set" {
+			replies = append(replies, protocol.MakeIntReply(op.valueOf(raw)))
+		} else {
+			replies = append(replies, protocol.MakeIntReply(op.valueOf(bm.GetBits(op.offset, op.width))))
+		}
+	}
+	if changed {
+		db.PutEntity(key, &database.DataEntity{Data: bm.ToBytes()})
+		db.addAof(utils.ToCmdLine3("bitfield", args...))
+		db.notifyKeyspaceEvent(notifyString, "setbit", key)
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// execBitField
+//
+//	@Description: BITFIELD key [GET type offset] [SET type offset value] [INCRBY type offset increment] [OVERFLOW WRAP|SAT|FAIL]
+//	@param db
+//	@param args
+//	@return godis.Reply
+func execBitField(db *DB, args [][]byte) godis.Reply {
+	return db.bitField(args, false)
+}
+
+// execBitFieldRO
+//
+//	@Description: BITFIELD_RO key [GET type offset ...]
+//	@param db
+//	@param args
+//	@return godis.Reply
+func execBitFieldRO(db *DB, args [][]byte) godis.Reply {
+	return db.bitField(args, true)
+}
@@ -0,0 +1,151 @@
+package database
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/13
+  @desc: bitop and bitfield commands
+  @modified by:
+**/
+
+import (
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/godis/protocol/asserts"
+	"github.com/Allen9012/Godis/interface/godis"
+	"github.com/Allen9012/Godis/lib/utils"
+	"testing"
+)
+
+// assertBitField asserts reply of BITFIELD, nil is presented by "nil"
+func assertBitField(t *testing.T, actual godis.Reply, expected ...interface{}) {
+	t.Helper()
+	reply, ok := actual.(*protocol.MultiRawReply)
+	if !ok || len(reply.Replies) != len(expected) {
+		t.Fatalf("wrong reply %s", actual.ToBytes())
+	}
+	for i, item := range reply.Replies {
+		if expected[i] == "nil" {
+			asserts.AssertNullBulk(t, item)
+		} else {
+			asserts.AssertIntReply(t, item, expected[i].(int))
+		}
+	}
+}
+
+func TestBitOp(t *testing.T) {
+	testDB.Flush()
+	key1 := utils.RandString(10)
+	key2 := utils.RandString(10)
+	dest := utils.RandString(10)
+	testDB.Exec(nil, utils.ToCmdLine("set", key1, "\xf0\x0f"))
+	testDB.Exec(nil, utils.ToCmdLine("set", key2, "\x3c"))
+
+	result := testDB.Exec(nil, utils.ToCmdLine("bitop", "and", dest, key1, key2))
+	asserts.AssertIntReply(t, result, 2)
+	result = testDB.Exec(nil, utils.ToCmdLine("get", dest))
+	asserts.AssertBulkReply(t, result, "\x30\x00")
+	result = testDB.Exec(nil, utils.ToCmdLine("bitop", "or", dest, key1, key2))
+	asserts.AssertIntReply(t, result, 2)
+	result = testDB.Exec(nil, utils.ToCmdLine("get", dest))
+	asserts.AssertBulkReply(t, result, "\xfc\x0f")
+	testDB.Exec(nil, utils.ToCmdLine("bitop", "xor", dest, key1, key2))
+	result = testDB.Exec(nil, utils.ToCmdLine("get", dest))
+	asserts.AssertBulkReply(t, result, "\xcc\x0f")
+	testDB.Exec(nil, utils.ToCmdLine("bitop", "not", dest, key1))
+	result = testDB.Exec(nil, utils.ToCmdLine("get", dest))
+	asserts.AssertBulkReply(t, result, "\x0f\xf0")
+
+	// missing keys are treated as empty strings
+	result = testDB.Exec(nil, utils.ToCmdLine("bitop", "and", dest, key1, utils.RandString(10)))
+	asserts.AssertIntReply(t, result, 2)
+	result = testDB.Exec(nil, utils.ToCmdLine("get", dest))
+	asserts.AssertBulkReply(t, result, "\x00\x00")
+	result = testDB.Exec(nil, utils.ToCmdLine("bitop", "or", dest, utils.RandString(10)))
+	asserts.AssertIntReply(t, result, 0)
+	result = testDB.Exec(nil, utils.ToCmdLine("exists", dest))
+	asserts.AssertIntReply(t, result, 0)
+
+	result = testDB.Exec(nil, utils.ToCmdLine("bitop", "not", dest, key1, key2))
+	asserts.AssertErrReply(t, result, "ERR BITOP NOT must be called with a single source key.")
+	result = testDB.Exec(nil, utils.ToCmdLine("bitop", "nand", dest, key1))
+	asserts.AssertErrReply(t, result, "Err syntax error")
+	testDB.Exec(nil, utils.ToCmdLine("rpush", key2+"list", "a"))
+	result = testDB.Exec(nil, utils.ToCmdLine("bitop", "or", dest, key1, key2+"list"))
+	asserts.AssertErrReply(t, result, "WRONGTYPE Operation against a key holding the wrong kind of value")
+}
+
+func TestBitField(t *testing.T) {
+	testDB.Flush()
+	key := utils.RandString(10)
+	result := testDB.Exec(nil, utils.ToCmdLine("bitfield", key, "set", "u8", "0", "200", "get", "u8", "0", "get", "i8", "0"))
+	assertBitField(t, result, 0, 200, -56)
+	// consistent with SETBIT/GETBIT, low bits are stored at smaller offsets
+	result = testDB.Exec(nil, utils.ToCmdLine("getbit", key, "3"))
+	asserts.AssertIntReply(t, result, 1)
+	result = testDB.Exec(nil, utils.ToCmdLine("get", key))
+	asserts.AssertBulkReply(t, result, "\xc8")
+
+	// # offset is multiplied by width
+	result = testDB.Exec(nil, utils.ToCmdLine("bitfield", key, "set", "i16", "#1", "-1000", "get", "i16", "16", "get", "u4", "#0"))
+	assertBitField(t, result, 0, -1000, 8)
+	result = testDB.Exec(nil, utils.ToCmdLine("strlen", key))
+	asserts.AssertIntReply(t, result, 4)
+
+	result = testDB.Exec(nil, utils.ToCmdLine("bitfield", key, "set", "i64", "32", "9223372036854775807", "incrby", "i64", "32", "1"))
+	assertBitField(t, result, 0, -9223372036854775808)
+	result = testDB.Exec(nil, utils.ToCmdLine("bitfield", key, "set", "u63", "96", "1", "get", "u63", "96"))
+	assertBitField(t, result, 0, 1)
+
+	result = testDB.Exec(nil, utils.ToCmdLine("bitfield", key, "get", "u64", "0"))
+	asserts.AssertErrReply(t, result, "ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+	result = testDB.Exec(nil, utils.ToCmdLine("bitfield", key, "get", "u8", "-1"))
+	asserts.AssertErrReply(t, result, "ERR bit offset is not an integer or out of range")
+	result = testDB.Exec(nil, utils.ToCmdLine("bitfield", key, "set", "u8", "0", "a"))
+	asserts.AssertErrReply(t, result, "ERR value is not an integer or out of range")
+	result = testDB.Exec(nil, utils.ToCmdLine("bitfield", key, "overflow", "none"))
+	asserts.AssertErrReply(t, result, "ERR Invalid OVERFLOW type specified")
+	result = testDB.Exec(nil, utils.ToCmdLine("bitfield", key, "get", "u8"))
+	asserts.AssertErrReply(t, result, "Err syntax error")
+}
+
+func TestBitFieldOverflow(t *testing.T) {
+	testDB.Flush()
+	key := utils.RandString(10)
+	result := testDB.Exec(nil, utils.ToCmdLine("bitfield", key,
+		"incrby", "u2", "100", "1",
+		"overflow", "sat", "incrby", "u2", "102", "1",
+		"overflow", "fail", "incrby", "u2", "104", "1"))
+	assertBitField(t, result, 1, 1, 1)
+	result = testDB.Exec(nil, utils.ToCmdLine("bitfield", key,
+		"incrby", "u2", "100", "3",
+		"overflow", "sat", "incrby", "u2", "102", "3",
+		"overflow", "fail", "incrby", "u2", "104", "3"))
+	assertBitField(t, result, 0, 3, "nil")
+	result = testDB.Exec(nil, utils.ToCmdLine("bitfield", key, "overflow", "sat", "incrby", "u2", "102", "-10"))
+	assertBitField(t, result, 0)
+
+	// signed
+	result = testDB.Exec(nil, utils.ToCmdLine("bitfield", key,
+		"set", "i8", "0", "120", "incrby", "i8", "0", "10",
+		"overflow", "sat", "set", "i8", "8", "-120", "incrby", "i8", "8", "-10",
+		"overflow", "fail", "incrby", "i8", "8", "-1", "set", "i8", "16", "128"))
+	assertBitField(t, result, 0, -126, 0, -128, "nil", "nil")
+	result = testDB.Exec(nil, utils.ToCmdLine("bitfield", key, "overflow", "sat", "set", "i8", "16", "1000", "get", "i8", "16"))
+	assertBitField(t, result, 0, 127)
+	result = testDB.Exec(nil, utils.ToCmdLine("bitfield", key, "set", "u8", "24", "257", "get", "u8", "24"))
+	assertBitField(t, result, 0, 1)
+}
+
+func TestBitFieldRO(t *testing.T) {
+	testDB.Flush()
+	key := utils.RandString(10)
+	result := testDB.Exec(nil, utils.ToCmdLine("bitfield_ro", key, "get", "i8", "0"))
+	assertBitField(t, result, 0)
+	result = testDB.Exec(nil, utils.ToCmdLine("exists", key))
+	asserts.AssertIntReply(t, result, 0)
+	testDB.Exec(nil, utils.ToCmdLine("bitfield", key, "set", "u16", "0", "65535"))
+	result = testDB.Exec(nil, utils.ToCmdLine("bitfield_ro", key, "get", "i16", "0", "get", "u4", "12"))
+	assertBitField(t, result, -1, 15)
+	result = testDB.Exec(nil, utils.ToCmdLine("bitfield_ro", key, "set", "u8", "0", "1"))
+	asserts.AssertErrReply(t, result, "ERR BITFIELD_RO only supports the GET subcommand")
+}
@@ -0,0 +1,411 @@
+package database
+
+import (
+	"container/list"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/interface/godis"
+	"github.com/Allen9012/Godis/lib/utils"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/9
+  @desc: 阻塞式列表命令 BLPOP BRPOP BLMOVE BRPOPLPUSH BLMPOP
+  @modified by:
+**/
+
+func init() {
+	registerBlockingCommand("BLPop", tryBLPop, prepareBLPop, undoBLPop, -3, flagWrite, blockingListKeys, lastArgTimeout)
+	registerBlockingCommand("BRPop", tryBRPop, prepareBLPop, undoBLPop, -3, flagWrite, blockingListKeys, lastArgTimeout)
+	registerBlockingCommand("BRPopLPush", tryBRPopLPush, prepareRPopLPush, rollbackSourceAndDest, 4, flagWrite, blockingSourceKey, lastArgTimeout)
+	registerBlockingCommand("BLMove", tryBLMove, prepareRPopLPush, rollbackSourceAndDest, 6, flagWrite, blockingSourceKey, lastArgTimeout)
+	registerBlockingCommand("BLMPop", tryBLMPop, prepareBLMPop, undoBLMPop, -5, flagWrite, blockingMPopKeys, firstArgTimeout)
+}
+
+// blockingFunc tries to serve a blocking command without waiting,
+// served is false if there is no data to serve, then the client will be blocked
+type blockingFunc func(db *DB, args [][]byte) (result godis.Reply, served bool)
+
+// blockingCommand describes how to block a command
+type blockingCommand struct {
+	try blockingFunc
+	// keys returns the keys whose data could serve the command
+	keys func(args [][]byte) []string
+	// timeout returns how long to block, 0 means forever and negative means never block
+	timeout func(args [][]byte) (time.Duration, protocol.ErrorReply)
+	// nilReply is returned when timeout
+	nilReply godis.Reply
+}
+
+var blockingTable = make(map[string]*blockingCommand)
+
+// registerBlockingCommand registers a command which may block the client until data is available.
+// It is registered as a normal command as well, which never blocks and is used within MULTI
+func registerBlockingCommand(name string, try blockingFunc, prepare PreFunc, rollback UndoFunc, arity int, flags int,
+	keys func(args [][]byte) []string, timeout func(args [][]byte) (time.Duration, protocol.ErrorReply)) {
+	name = strings.ToLower(name)
+	bc := &blockingCommand{
+		try:     try,
+		keys:    keys,
+		timeout: timeout,
+	}
+	switch name {
+	case "blpop", "brpop", "blmpop", "xread", "xreadgroup":
+		bc.nilReply = protocol.MakeNullMultiBulkReply()
+	default:
+		bc.nilReply = protocol.MakeNullBulkReply()
+	}
+	blockingTable[name] = bc
+	registerCommand(name, func(db *DB, args [][]byte) godis.Reply {
+		if _, errReply := timeout(args); errReply != nil {
+			return errReply
+		}
+		result, served := try(db, args)
+		if !served {
+			return bc.nilReply
+		}
+		return result
+	}, prepare, rollback, arity, flags)
+}
+
+// IsBlockingCommand returns whether the command may block the connection, e.g. BLPOP
+func IsBlockingCommand(name string) bool {
+	_, ok := blockingTable[strings.ToLower(name)]
+	return ok
+}
+
+/* ---- blocking manager ---- */
+
+// blockedClient is a client waiting for data of some list keys
+type blockedClient struct {
+	conn godis.Connection
+	keys []string
+	// elements are positions of client in waiting queue of each key
+	elements map[string]*list.Element
+	// ready is notified when one of keys may be able to serve the client
+	ready chan struct{}
+	// cancelled is closed when client closed
+	cancelled  chan struct{}
+	cancelOnce sync.Once
+}
+
+func (client *blockedClient) cancel() {
+	client.cancelOnce.Do(func() {
+		close(client.cancelled)
+	})
+}
+
+// blockingManager records blocked clients of a database,
+// clients blocked on the same key are served in FIFO order
+type blockingManager struct {
+	mu sync.Mutex
+	// key -> list of *blockedClient
+	waiting map[string]*list.List
+	// connection -> *blockedClient, used to release blocked client after connection closed
+	clients map[godis.Connection]*blockedClient
+}
+
+func makeBlockingManager() *blockingManager {
+	return &blockingManager{
+		waiting: make(map[string]*list.List),
+		clients: make(map[godis.Connection]*blockedClient),
+	}
+}
+
+// block appends client to waiting queues of keys, invoker should hold locks of keys
+func (m *blockingManager) block(conn godis.Connection, keys []string) *blockedClient {
+	client := &blockedClient{
+		conn:      conn,
+		keys:      keys,
+		elements:  make(map[string]*list.Element, len(keys)),
+		ready:     make(chan struct{}, 1),
+		cancelled: make(chan struct{}),
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		if _, ok := client.elements[key]; ok {
+			continue
+		}
+		queue, ok := m.waiting[key]
+		if !ok {
+			queue = list.New()
+			m.waiting[key] = queue
+		}
+		client.elements[key] = queue.PushBack(client)
+	}
+	if conn != nil {
+		m.clients[conn] = client
+	}
+	return client
+}
+
+// unblock removes client from all waiting queues
+func (m *blockingManager) unblock(client *blockedClient) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, element := range client.elements {
+		queue := m.waiting[key]
+		queue.Remove(element)
+		if queue.Len() == 0 {
+			delete(m.waiting, key)
+		}
+	}
+	client.elements = nil
+	if client.conn != nil && m.clients[client.conn] == client {
+		delete(m.clients, client.conn)
+	}
+}
+
+// signal wakes up the first client waiting for key
+func (m *blockingManager) signal(key string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	queue, ok := m.waiting[key]
+	if !ok {
+		return
+	}
+	client := queue.Front().Value.(*blockedClient)
+	select {
+	case client.ready <- struct{}{}:
+	default:
+		// already notified
+	}
+}
+
+// cancelClient releases the client blocked by conn
+func (m *blockingManager) cancelClient(conn godis.Connection) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	client, ok := m.clients[conn]
+	m.mu.Unlock()
+	if ok {
+		client.cancel()
+	}
+}
+
+// signalKeyReady wakes up the first client blocked on key, it should be called after pushing into a list or stream
+func (db *DB) signalKeyReady(key string) {
+	db.blocking.signal(key)
+}
+
+// execBlockingCommand serves the command immediately if possible, otherwise blocks the client
+// until data pushed into one of keys, timeout or client closed
+//
+//	@Description: 等待期间不持有锁, 被唤醒后重新加锁尝试; 失败时保留在队列中的位置以保证公平
+//	@receiver db
+//	@param c
+//	@param cmdLine
+//	@return godis.Reply
+func (db *DB) execBlockingCommand(c godis.Connection, cmdLine [][]byte) godis.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd := cmdTable[cmdName]
+	bc := blockingTable[cmdName]
+	if !validateArity(cmd.arity, cmdLine) {
+		return protocol.MakeArgNumErrReply(cmdName)
+	}
+	args := cmdLine[1:]
+	timeout, errReply := bc.timeout(args)
+	if errReply != nil {
+		return errReply
+	}
+	write, read := cmd.prepare(args)
+
+	var client *blockedClient
+	// timewheel 按秒转动, 会丢失超时的亚秒精度, 因此每个阻塞的客户端使用独立的定时器
+	var timer *time.Timer
+	var timeoutCh <-chan time.Time
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+		if client == nil {
+			return
+		}
+		db.blocking.unblock(client)
+		// the client may have consumed a notification for other clients
+		for _, key := range client.keys {
+			if _, exists := db.data.Get(key); exists {
+				db.signalKeyReady(key)
+			}
+		}
+	}()
+	for {
+		db.RWLocks(write, read)
+		result, served := bc.try(db, args)
+		if served {
+			db.addVersion(write...)
+			db.trackKeys(write, read)
+		} else if client == nil && timeout >= 0 {
+			// register before unlocking, so that no push will be missed
+			client = db.blocking.block(c, bc.keys(args))
+		}
+		db.RWUnLocks(write, read)
+		if served {
+			return result
+		}
+		if client == nil {
+			// the command does not ask to block, e.g. XREAD without BLOCK
+			return bc.nilReply
+		}
+		if timer == nil && timeout > 0 {
+			timer = time.NewTimer(timeout)
+			timeoutCh = timer.C
+		}
+		select {
+		case <-client.ready:
+		case <-timeoutCh:
+			return bc.nilReply
+		case <-client.cancelled:
+			return bc.nilReply
+		}
+	}
+}
+
+/* ---- arguments ---- */
+
+// parseTimeout parses timeout in seconds, decimal is allowed
+func parseTimeout(arg []byte) (time.Duration, protocol.ErrorReply) {
+	seconds, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return 0, protocol.MakeErrReply("ERR timeout is not a float or out of range")
+	}
+	if seconds < 0 {
+		return 0, protocol.MakeErrReply("ERR timeout is negative")
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+func lastArgTimeout(args [][]byte) (time.Duration, protocol.ErrorReply) {
+	return parseTimeout(args[len(args)-1])
+}
+
+func firstArgTimeout(args [][]byte) (time.Duration, protocol.ErrorReply) {
+	return parseTimeout(args[0])
+}
+
+// blockingListKeys returns keys of BLPOP key [key ...] timeout
+func blockingListKeys(args [][]byte) []string {
+	keys := make([]string, 0, len(args)-1)
+	for _, arg := range args[:len(args)-1] {
+		keys = append(keys, string(arg))
+	}
+	return keys
+}
+
+// blockingSourceKey returns source key of BLMOVE and BRPOPLPUSH
+func blockingSourceKey(args [][]byte) []string {
+	return []string{string(args[0])}
+}
+
+// blockingMPopKeys returns keys of BLMPOP timeout numkeys key [key ...] LEFT|RIGHT [COUNT count]
+func blockingMPopKeys(args [][]byte) []string {
+	keys, _ := parseMPopKeys(args[1:])
+	return keys
+}
+
+func prepareBLPop(args [][]byte) ([]string, []string) {
+	return blockingListKeys(args), nil
+}
+
+func prepareBLMPop(args [][]byte) ([]string, []string) {
+	return blockingMPopKeys(args), nil
+}
+
+func undoBLPop(db *DB, args [][]byte) []CmdLine {
+	return rollbackGivenKeys(db, blockingListKeys(args)...)
+}
+
+func undoBLMPop(db *DB, args [][]byte) []CmdLine {
+	return rollbackGivenKeys(db, blockingMPopKeys(args)...)
+}
+
+/* ---- commands ---- */
+
+// tryBLPop
+//
+//	@Description: BLPOP key [key ...] timeout
+//	@param db
+//	@param args
+//	@return godis.Reply
+//	@return bool
+func tryBLPop(db *DB, args [][]byte) (godis.Reply, bool) {
+	return tryBPop(db, args, true)
+}
+
+// tryBRPop
+//
+//	@Description: BRPOP key [key ...] timeout
+//	@param db
+//	@param args
+//	@return godis.Reply
+//	@return bool
+func tryBRPop(db *DB, args [][]byte) (godis.Reply, bool) {
+	return tryBPop(db, args, false)
+}
+
+// tryBPop pops from the first non-empty list
+func tryBPop(db *DB, args [][]byte, fromLeft bool) (godis.Reply, bool) {
+	for _, key := range blockingListKeys(args) {
+		list, errReply := db.getAsList(key)
+		if errReply != nil {
+			return errReply, true
+		}
+		if list == nil {
+			continue
+		}
+		val := db.popFromList(key, list, fromLeft)
+		if fromLeft {
+			db.addAof(utils.ToCmdLine("lpop", key))
+		} else {
+			db.addAof(utils.ToCmdLine("rpop", key))
+		}
+		db.notifyListPop(key, list, fromLeft)
+		return protocol.MakeMultiBulkReply([][]byte{[]byte(key), val}), true
+	}
+	return nil, false
+}
+
+// tryBRPopLPush
+//
+//	@Description: BRPOPLPUSH source destination timeout
+//	@param db
+//	@param args
+//	@return godis.Reply
+//	@return bool
+func tryBRPopLPush(db *DB, args [][]byte) (godis.Reply, bool) {
+	return lMove(db, args[0], args[1], []byte("right"), []byte("left"))
+}
+
+// tryBLMove
+//
+//	@Description: BLMOVE source destination LEFT|RIGHT LEFT|RIGHT timeout
+//	@param db
+//	@param args
+//	@return godis.Reply
+//	@return bool
+func tryBLMove(db *DB, args [][]byte) (godis.Reply, bool) {
+	return lMove(db, args[0], args[1], args[2], args[3])
+}
+
+// tryBLMPop
+//
+//	@Description: BLMPOP timeout numkeys key [key ...] LEFT|RIGHT [COUNT count]
+//	@param db
+//	@param args
+//	@return godis.Reply
+//	@return bool
+func tryBLMPop(db *DB, args [][]byte) (godis.Reply, bool) {
+	return lMPop(db, args[1:])
+}
@@ -0,0 +1,222 @@
+package database
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/9
+  @desc: blocking list commands
+  @modified by:
+**/
+
+import (
+	"github.com/Allen9012/Godis/godis/connection"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/godis/protocol/asserts"
+	"github.com/Allen9012/Godis/interface/godis"
+	"github.com/Allen9012/Godis/lib/utils"
+	"testing"
+	"time"
+)
+
+// waitBlocked waits until n clients are blocked on key
+func waitBlocked(t *testing.T, db *DB, key string, n int) {
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		db.blocking.mu.Lock()
+		queue, ok := db.blocking.waiting[key]
+		blocked := ok && queue.Len() == n
+		db.blocking.mu.Unlock()
+		if blocked {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expect %d clients blocked on %s", n, key)
+}
+
+// execAsync executes command in another goroutine
+func execAsync(server *StandaloneServer, conn godis.Connection, cmdLine ...string) <-chan godis.Reply {
+	ch := make(chan godis.Reply, 1)
+	go func() {
+		ch <- server.Exec(conn, utils.ToCmdLine(cmdLine...))
+	}()
+	return ch
+}
+
+func receiveReply(t *testing.T, ch <-chan godis.Reply) godis.Reply {
+	select {
+	case result := <-ch:
+		return result
+	case <-time.After(5 * time.Second):
+		t.Fatal("blocking command doesn't return")
+	}
+	return nil
+}
+
+func TestBLPop(t *testing.T) {
+	server := NewStandaloneServer()
+	defer server.Close()
+	db := server.mustSelectDB(0)
+	conn := connection.NewFakeConn()
+	key1 := utils.RandString(10)
+	key2 := utils.RandString(10)
+
+	// served immediately
+	server.Exec(conn, utils.ToCmdLine("rpush", key2, "a", "b"))
+	result := server.Exec(conn, utils.ToCmdLine("blpop", key1, key2, "0"))
+	asserts.AssertMultiBulkReply(t, result, []string{key2, "a"})
+	result = server.Exec(conn, utils.ToCmdLine("brpop", key1, key2, "0"))
+	asserts.AssertMultiBulkReply(t, result, []string{key2, "b"})
+
+	// blocked until push
+	ch := execAsync(server, connection.NewFakeConn(), "brpop", key1, key2, "0")
+	waitBlocked(t, db, key1, 1)
+	server.Exec(conn, utils.ToCmdLine("lpush", key2, "c"))
+	asserts.AssertMultiBulkReply(t, receiveReply(t, ch), []string{key2, "c"})
+	asserts.AssertIntReply(t, server.Exec(conn, utils.ToCmdLine("exists", key2)), 0)
+
+	// wrong type
+	server.Exec(conn, utils.ToCmdLine("set", key1, "v"))
+	result = server.Exec(conn, utils.ToCmdLine("blpop", key1, "0"))
+	asserts.AssertErrReply(t, result, "WRONGTYPE Operation against a key holding the wrong kind of value")
+	result = server.Exec(conn, utils.ToCmdLine("blpop", key2, "-1"))
+	asserts.AssertErrReply(t, result, "ERR timeout is negative")
+	result = server.Exec(conn, utils.ToCmdLine("blpop", key2, "abc"))
+	asserts.AssertErrReply(t, result, "ERR timeout is not a float or out of range")
+}
+
+func TestBLPopFIFO(t *testing.T) {
+	server := NewStandaloneServer()
+	defer server.Close()
+	db := server.mustSelectDB(0)
+	conn := connection.NewFakeConn()
+	key := utils.RandString(10)
+	other := utils.RandString(10)
+
+	ch1 := execAsync(server, connection.NewFakeConn(), "blpop", key, "0")
+	waitBlocked(t, db, key, 1)
+	ch2 := execAsync(server, connection.NewFakeConn(), "blpop", other, key, "0")
+	waitBlocked(t, db, key, 2)
+	ch3 := execAsync(server, connection.NewFakeConn(), "blpop", key, "0")
+	waitBlocked(t, db, key, 3)
+
+	server.Exec(conn, utils.ToCmdLine("rpush", key, "a", "b"))
+	asserts.AssertMultiBulkReply(t, receiveReply(t, ch1), []string{key, "a"})
+	asserts.AssertMultiBulkReply(t, receiveReply(t, ch2), []string{key, "b"})
+	waitBlocked(t, db, key, 1)
+	server.Exec(conn, utils.ToCmdLine("rpush", key, "c"))
+	asserts.AssertMultiBulkReply(t, receiveReply(t, ch3), []string{key, "c"})
+}
+
+func TestBLPopTimeout(t *testing.T) {
+	server := NewStandaloneServer()
+	defer server.Close()
+	conn := connection.NewFakeConn()
+	key := utils.RandString(10)
+	start := time.Now()
+	ch := execAsync(server, conn, "blpop", key, "0.5")
+	result := receiveReply(t, ch)
+	if _, ok := result.(*protocol.NullMultiBulkReply); !ok {
+		t.Errorf("expect null multi bulk, actual: %s", result.ToBytes())
+	}
+	// sub-second timeout should not be rounded to seconds
+	if elapsed := time.Since(start); elapsed < 500*time.Millisecond || elapsed > 900*time.Millisecond {
+		t.Errorf("expect returning after 0.5s, actually %s", elapsed)
+	}
+	ch = execAsync(server, conn, "brpoplpush", key, "dest", "0.1")
+	asserts.AssertNullBulk(t, receiveReply(t, ch))
+	asserts.AssertIntReply(t, server.Exec(conn, utils.ToCmdLine("exists", "dest")), 0)
+}
+
+func TestBlockedClientClose(t *testing.T) {
+	server := NewStandaloneServer()
+	defer server.Close()
+	db := server.mustSelectDB(0)
+	conn := connection.NewFakeConn()
+	key := utils.RandString(10)
+	blockedConn := connection.NewFakeConn()
+	ch := execAsync(server, blockedConn, "blpop", key, "0")
+	waitBlocked(t, db, key, 1)
+	server.AfterClientClose(blockedConn)
+	receiveReply(t, ch)
+
+	// element is not consumed by the closed client
+	server.Exec(conn, utils.ToCmdLine("rpush", key, "a"))
+	asserts.AssertIntReply(t, server.Exec(conn, utils.ToCmdLine("llen", key)), 1)
+	db.blocking.mu.Lock()
+	defer db.blocking.mu.Unlock()
+	if len(db.blocking.waiting) != 0 || len(db.blocking.clients) != 0 {
+		t.Error("blocked client is not released")
+	}
+}
+
+func TestBLMove(t *testing.T) {
+	server := NewStandaloneServer()
+	defer server.Close()
+	db := server.mustSelectDB(0)
+	conn := connection.NewFakeConn()
+	source := utils.RandString(10)
+	dest := utils.RandString(10)
+
+	ch := execAsync(server, connection.NewFakeConn(), "blmove", source, dest, "right", "left", "0")
+	waitBlocked(t, db, source, 1)
+	// dest of BRPOPLPUSH wakes up BLMOVE blocked on it
+	ch2 := execAsync(server, connection.NewFakeConn(), "brpoplpush", dest, source, "0")
+	waitBlocked(t, db, dest, 1)
+	server.Exec(conn, utils.ToCmdLine("rpush", source, "a", "b"))
+	asserts.AssertBulkReply(t, receiveReply(t, ch), "b")
+	asserts.AssertBulkReply(t, receiveReply(t, ch2), "b")
+	result := server.Exec(conn, utils.ToCmdLine("lrange", source, "0", "-1"))
+	asserts.AssertMultiBulkReply(t, result, []string{"b", "a"})
+
+	result = server.Exec(conn, utils.ToCmdLine("lmove", source, source, "left", "right"))
+	asserts.AssertBulkReply(t, result, "b")
+	result = server.Exec(conn, utils.ToCmdLine("lmove", source, dest, "up", "left"))
+	asserts.AssertErrReply(t, result, "Err syntax error")
+}
+
+func TestBLMPop(t *testing.T) {
+	server := NewStandaloneServer()
+	defer server.Close()
+	db := server.mustSelectDB(0)
+	conn := connection.NewFakeConn()
+	key1 := utils.RandString(10)
+	key2 := utils.RandString(10)
+
+	ch := execAsync(server, connection.NewFakeConn(), "blmpop", "0", "2", key1, key2, "right", "count", "2")
+	waitBlocked(t, db, key2, 1)
+	server.Exec(conn, utils.ToCmdLine("rpush", key2, "a", "b", "c"))
+	result := receiveReply(t, ch)
+	expected := "*2\r\n$10\r\n" + key2 + "\r\n*2\r\n$1\r\nc\r\n$1\r\nb\r\n"
+	if string(result.ToBytes()) != expected {
+		t.Errorf("expect %q, actual %q", expected, result.ToBytes())
+	}
+
+	result = server.Exec(conn, utils.ToCmdLine("lmpop", "2", key1, key2, "left", "count", "5"))
+	expected = "*2\r\n$10\r\n" + key2 + "\r\n*1\r\n$1\r\na\r\n"
+	if string(result.ToBytes()) != expected {
+		t.Errorf("expect %q, actual %q", expected, result.ToBytes())
+	}
+	result = server.Exec(conn, utils.ToCmdLine("lmpop", "2", key1, key2, "left"))
+	if _, ok := result.(*protocol.NullMultiBulkReply); !ok {
+		t.Errorf("expect null multi bulk, actual: %s", result.ToBytes())
+	}
+	result = server.Exec(conn, utils.ToCmdLine("blmpop", "0", "0", key1, "left"))
+	asserts.AssertErrReply(t, result, "ERR numkeys should be greater than 0")
+}
+
+func TestBLPopInMulti(t *testing.T) {
+	server := NewStandaloneServer()
+	defer server.Close()
+	conn := connection.NewFakeConn()
+	key := utils.RandString(10)
+	server.Exec(conn, utils.ToCmdLine("multi"))
+	server.Exec(conn, utils.ToCmdLine("blpop", key, "0"))
+	server.Exec(conn, utils.ToCmdLine("rpush", key, "a"))
+	server.Exec(conn, utils.ToCmdLine("blpop", key, "0"))
+	result := server.Exec(conn, utils.ToCmdLine("exec"))
+	expected := "*3\r\n*-1\r\n:1\r\n*2\r\n$10\r\n" + key + "\r\n$1\r\na\r\n"
+	if string(result.ToBytes()) != expected {
+		t.Errorf("expect %q, actual %q", expected, result.ToBytes())
+	}
+}
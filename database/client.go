@@ -0,0 +1,54 @@
+package database
+
+import (
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/interface/godis"
+	"strings"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/18
+  @desc: CLIENT SETNAME | GETNAME
+  @modified by:
+**/
+
+// execClient
+//
+//	@Description: 客户端名称会显示在 SLOWLOG 中
+//	@param c
+//	@param args	eg: client setname conn1 | client getname
+//	@return godis.Reply
+func execClient(c godis.Connection, args [][]byte) godis.Reply {
+	if len(args) == 0 {
+		return protocol.MakeArgNumErrReply("client")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "setname":
+		if len(args) != 2 {
+			return protocol.MakeArgNumErrReply("client|setname")
+		}
+		name := string(args[1])
+		for _, ch := range name {
+			// 与 redis 相同, 名称只能包含可打印字符且不能有空格
+			if ch < '!' || ch > '~' {
+				return protocol.MakeErrReply("ERR Client names cannot contain spaces, newlines or special characters.")
+			}
+		}
+		if c != nil {
+			c.SetName(name)
+		}
+		return protocol.MakeOkReply()
+	case "getname":
+		if len(args) != 1 {
+			return protocol.MakeArgNumErrReply("client|getname")
+		}
+		if c == nil || c.GetName() == "" {
+			return protocol.MakeNullBulkReply()
+		}
+		return protocol.MakeBulkReply([]byte(c.GetName()))
+	}
+	return protocol.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try CLIENT HELP.")
+}
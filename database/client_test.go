@@ -0,0 +1,57 @@
+package database
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/18
+  @desc: CLIENT and slow log of commands
+  @modified by:
+**/
+
+import (
+	"github.com/Allen9012/Godis/config"
+	"github.com/Allen9012/Godis/godis/connection"
+	"github.com/Allen9012/Godis/godis/protocol/asserts"
+	"github.com/Allen9012/Godis/lib/utils"
+	"testing"
+)
+
+func TestClientSetName(t *testing.T) {
+	server := NewStandaloneServer()
+	defer server.Close()
+	conn := connection.NewFakeConn()
+	result := server.Exec(conn, utils.ToCmdLine("client", "getname"))
+	asserts.AssertNullBulk(t, result)
+	result = server.Exec(conn, utils.ToCmdLine("client", "setname", "conn1"))
+	asserts.AssertStatusReply(t, result, "OK")
+	result = server.Exec(conn, utils.ToCmdLine("client", "getname"))
+	asserts.AssertBulkReply(t, result, "conn1")
+	result = server.Exec(conn, utils.ToCmdLine("client", "setname", "a b"))
+	asserts.AssertErrReply(t, result, "ERR Client names cannot contain spaces, newlines or special characters.")
+}
+
+func TestCommandSlowLog(t *testing.T) {
+	server := NewStandaloneServer()
+	defer server.Close()
+	config.Properties.SlowlogLogSlowerThan = 0
+	defer func() {
+		config.Properties.SlowlogLogSlowerThan = 10000
+	}()
+	conn := connection.NewFakeConn()
+	server.Exec(conn, utils.ToCmdLine("slowlog", "reset"))
+	server.Exec(conn, utils.ToCmdLine("client", "setname", "conn1"))
+	server.Exec(conn, utils.ToCmdLine("set", "k", "v"))
+	// blocking commands are not logged
+	server.Exec(conn, utils.ToCmdLine("blpop", "list", "0.01"))
+
+	entries := server.slowlog.Get(-1)
+	if len(entries) != 3 {
+		t.Fatalf("expect 3 entries, actual %d", len(entries))
+	}
+	if string(entries[0].Args[0]) != "set" || entries[0].ClientName != "conn1" {
+		t.Errorf("unexpected entry %+v", entries[0])
+	}
+	if string(entries[2].Args[0]) != "slowlog" {
+		t.Errorf("unexpected entry %+v", entries[2])
+	}
+}
@@ -0,0 +1,146 @@
+package database
+
+import (
+	"errors"
+	"github.com/Allen9012/Godis/config"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/interface/godis"
+	"strings"
+	"sync/atomic"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/7
+  @desc: CONFIG GET/SET/REWRITE/RESETSTAT
+  @modified by:
+**/
+
+// execConfig
+//
+//	@Description: 运行时查看和修改配置
+//	@param server
+//	@param args	eg: config get append* | config set appendfsync always | config rewrite | config resetstat
+//	@return godis.Reply
+func execConfig(server *StandaloneServer, args [][]byte) godis.Reply {
+	if len(args) == 0 {
+		return protocol.MakeArgNumErrReply("config")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "get":
+		if len(args) < 2 {
+			return protocol.MakeArgNumErrReply("config|get")
+		}
+		patterns := make([]string, 0, len(args)-1)
+		for _, arg := range args[1:] {
+			patterns = append(patterns, string(arg))
+		}
+		properties := config.GetProperties(patterns...)
+		result := make([][]byte, 0, len(properties)*2)
+		for _, kv := range properties {
+			result = append(result, []byte(kv[0]), []byte(kv[1]))
+		}
+		return protocol.MakeMultiBulkReply(result)
+	case "set":
+		if len(args) < 3 || len(args)%2 == 0 {
+			return protocol.MakeArgNumErrReply("config|set")
+		}
+		return server.configSet(args[1:])
+	case "rewrite":
+		if len(args) != 1 {
+			return protocol.MakeArgNumErrReply("config|rewrite")
+		}
+		if err := config.RewriteConfigFile(); err != nil {
+			return protocol.MakeErrReply("ERR Rewriting config file: " + err.Error())
+		}
+		return protocol.MakeOkReply()
+	case "resetstat":
+		if len(args) != 1 {
+			return protocol.MakeArgNumErrReply("config|resetstat")
+		}
+		server.stats.reset()
+		return protocol.MakeOkReply()
+	}
+	return protocol.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try CONFIG HELP.")
+}
+
+// configSet sets all parameters or none of them
+func (server *StandaloneServer) configSet(args [][]byte) godis.Reply {
+	type change struct {
+		name     string
+		oldValue string
+	}
+	changes := make([]*change, 0, len(args)/2)
+	rollback := func() {
+		for i := len(changes) - 1; i >= 0; i-- {
+			_ = config.SetProperty(changes[i].name, changes[i].oldValue)
+		}
+	}
+	for i := 0; i < len(args); i += 2 {
+		name := strings.ToLower(string(args[i]))
+		value := string(args[i+1])
+		oldValue, err := config.GetProperty(name)
+		if err == nil {
+			err = config.SetProperty(name, value)
+		}
+		if errors.Is(err, config.ErrUnknownProperty) {
+			rollback()
+			return protocol.MakeErrReply("ERR Unknown option or number of arguments for CONFIG SET - '" + name + "'")
+		}
+		if err != nil {
+			rollback()
+			return protocol.MakeErrReply("ERR CONFIG SET failed (possibly related to argument '" + name + "') - " + err.Error())
+		}
+		changes = append(changes, &change{name: name, oldValue: oldValue})
+	}
+	// some parameters are copied by other modules, they need to be notified
+	for _, c := range changes {
+		if err := server.applyConfig(c.name, c.oldValue); err != nil {
+			rollback()
+			return protocol.MakeErrReply("ERR CONFIG SET failed (possibly related to argument '" + c.name + "') - " + err.Error())
+		}
+	}
+	return protocol.MakeOkReply()
+}
+
+// applyConfig makes the new value of parameter take effect
+func (server *StandaloneServer) applyConfig(name string, oldValue string) error {
+	switch name {
+	case "appendfsync":
+		if server.persister != nil {
+			server.persister.SetFsync(config.Get(&config.Properties.AppendFsync))
+		}
+	case "appendonly":
+		if !config.Get(&config.Properties.AppendOnly) || oldValue == "yes" {
+			return nil
+		}
+		// aof file missed the commands executed while appendonly is off, so rewrite it with current data
+		if server.persister == nil {
+			persister, err := NewPersister(server, config.Properties.AppendFilename, false, config.Get(&config.Properties.AppendFsync))
+			if err != nil {
+				return err
+			}
+			server.bindPersister(persister)
+		}
+		return server.persister.RewriteFrom(server)
+	case "notify-keyspace-events":
+		server.notifier.setEvents(config.Get(&config.Properties.NotifyKeyspaceEvents))
+	}
+	return nil
+}
+
+// reset clears all counters, used by CONFIG RESETSTAT
+func (stats *serverStats) reset() {
+	if stats == nil {
+		return
+	}
+	atomic.StoreInt64(&stats.totalCommands, 0)
+	atomic.StoreInt64(&stats.keyspaceHits, 0)
+	atomic.StoreInt64(&stats.keyspaceMisses, 0)
+	atomic.StoreInt64(&stats.evictedKeys, 0)
+	atomic.StoreInt64(&stats.expiredKeys, 0)
+	atomic.StoreInt64(&stats.expiredTimeCapReached, 0)
+	atomic.StoreInt64(&stats.expireCycleTime, 0)
+}
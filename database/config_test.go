@@ -0,0 +1,103 @@
+package database
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/7
+  @desc: config
+  @modified by:
+**/
+
+import (
+	"github.com/Allen9012/Godis/config"
+	"github.com/Allen9012/Godis/godis/connection"
+	"github.com/Allen9012/Godis/godis/protocol/asserts"
+	"github.com/Allen9012/Godis/lib/utils"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigGetSet(t *testing.T) {
+	maxClients := config.Properties.MaxClients
+	defer func() {
+		config.Properties.MaxClients = maxClients
+	}()
+	conn := connection.NewFakeConn()
+	result := testServer.Exec(conn, utils.ToCmdLine("config", "set", "maxclients", "100"))
+	asserts.AssertStatusReply(t, result, "OK")
+	result = testServer.Exec(conn, utils.ToCmdLine("config", "get", "maxclient?"))
+	asserts.AssertMultiBulkReply(t, result, []string{"maxclients", "100"})
+
+	result = testServer.Exec(conn, utils.ToCmdLine("config", "set", "maxclients", "200", "appendfsync", "sometimes"))
+	asserts.AssertErrReply(t, result, "ERR CONFIG SET failed (possibly related to argument 'appendfsync') - argument(s) must be one of the following: always, everysec, no")
+	// all parameters are rolled back
+	result = testServer.Exec(conn, utils.ToCmdLine("config", "get", "maxclients"))
+	asserts.AssertMultiBulkReply(t, result, []string{"maxclients", "100"})
+
+	result = testServer.Exec(conn, utils.ToCmdLine("config", "set", "port", "1"))
+	asserts.AssertErrReply(t, result, "ERR CONFIG SET failed (possibly related to argument 'port') - can't set immutable config")
+	result = testServer.Exec(conn, utils.ToCmdLine("config", "set", "foo", "1"))
+	asserts.AssertErrReply(t, result, "ERR Unknown option or number of arguments for CONFIG SET - 'foo'")
+	result = testServer.Exec(conn, utils.ToCmdLine("config", "set", "maxclients"))
+	asserts.AssertErrReply(t, result, "ERR wrong number of arguments for 'config|set' command")
+	result = testServer.Exec(conn, utils.ToCmdLine("config", "foo"))
+	asserts.AssertErrReply(t, result, "ERR unknown subcommand 'foo'. Try CONFIG HELP.")
+}
+
+func TestConfigSetAppendOnly(t *testing.T) {
+	appendOnly := config.Properties.AppendOnly
+	aofFilename := config.Properties.AppendFilename
+	defer func() {
+		config.Properties.AppendOnly = appendOnly
+		config.Properties.AppendFilename = aofFilename
+	}()
+	config.Properties.AppendOnly = false
+	config.Properties.AppendFilename = filepath.Join(t.TempDir(), "appendonly.aof")
+	server := NewStandaloneServer()
+	defer server.Close()
+	conn := connection.NewFakeConn()
+	server.Exec(conn, utils.ToCmdLine("set", "k1", "v1"))
+	result := server.Exec(conn, utils.ToCmdLine("config", "set", "appendonly", "yes", "appendfsync", "always"))
+	asserts.AssertStatusReply(t, result, "OK")
+	server.Exec(conn, utils.ToCmdLine("set", "k2", "v2"))
+
+	// aof file contains data written before appendonly turned on
+	loaded := MakeAuxiliaryServer()
+	persister, err := NewPersister(loaded, config.Properties.AppendFilename, true, "no")
+	if err != nil {
+		t.Fatal(err)
+	}
+	persister.Close()
+	conn2 := connection.NewFakeConn()
+	asserts.AssertBulkReply(t, loaded.Exec(conn2, utils.ToCmdLine("get", "k1")), "v1")
+	asserts.AssertBulkReply(t, loaded.Exec(conn2, utils.ToCmdLine("get", "k2")), "v2")
+}
+
+func TestConfigResetStat(t *testing.T) {
+	conn := connection.NewFakeConn()
+	testServer.Exec(conn, utils.ToCmdLine("get", "k"))
+	result := testServer.Exec(conn, utils.ToCmdLine("config", "resetstat"))
+	asserts.AssertStatusReply(t, result, "OK")
+	result = testServer.Exec(conn, utils.ToCmdLine("info", "stats"))
+	asserts.AssertBulkReply(t, result, "# Stats\r\ntotal_commands_processed:1\r\nkeyspace_hits:0\r\nkeyspace_misses:0\r\n"+
+		"expired_keys:0\r\nexpired_time_cap_reached_count:0\r\nexpire_cycle_cpu_milliseconds:0\r\nevicted_keys:0\r\n")
+}
+
+func TestConfigRewrite(t *testing.T) {
+	cfPath := config.Properties.CfPath
+	defer func() {
+		config.Properties.CfPath = cfPath
+	}()
+	config.Properties.CfPath = filepath.Join(t.TempDir(), "redis.conf")
+	if err := os.WriteFile(config.Properties.CfPath, []byte("# godis\nport 6399\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	conn := connection.NewFakeConn()
+	result := testServer.Exec(conn, utils.ToCmdLine("config", "rewrite"))
+	asserts.AssertStatusReply(t, result, "OK")
+	bytes, _ := os.ReadFile(config.Properties.CfPath)
+	if len(bytes) == 0 || string(bytes[:8]) != "# godis\n" {
+		t.Errorf("wrong config file: %s", bytes)
+	}
+}
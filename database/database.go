@@ -6,6 +6,7 @@ package database
 	@desc: database
 */
 import (
+	"github.com/Allen9012/Godis/config"
 	"github.com/Allen9012/Godis/datastruct/dict"
 	"github.com/Allen9012/Godis/datastruct/lock"
 	"github.com/Allen9012/Godis/godis/protocol"
@@ -14,11 +15,14 @@ import (
 	"github.com/Allen9012/Godis/lib/logger"
 	"github.com/Allen9012/Godis/lib/timewheel"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
 const (
-	dataDictSize = 1 << 16
+	// dataDictSize is the number of shards of keyspace, SCAN visits one shard at least in a call,
+	// every database allocates all shards at start, so it shouldn't be too large
+	dataDictSize = 1 << 12
 	ttlDictSize  = 1 << 10
 	lockerSize   = 1024
 )
@@ -30,8 +34,7 @@ type DB struct {
 	data dict.Dict
 	// key -> expireTime (time.Time)
 	ttlMap dict.Dict // key -> expireTime (time.Time)
-	// key -> version(uint32)
-	// TODO versionMap is not used now
+	// key -> version(uint32), used by WATCH to detect modification
 	versionMap dict.Dict
 	// addaof is used to add command to aof
 	addAof func(CmdLine)
@@ -39,9 +42,19 @@ type DB struct {
 	// dict.Dict will ensure concurrent-safety of its method
 	// use this mutex for complicated command only, eg. rpush, incr ...
 	locker *lock.Locks
-	//// TODO callbacks
-	//insertCallback database.KeyEventCallback
-	//deleteCallback database.KeyEventCallback
+	// stats is shared by all databases of a server, it is nil for auxiliary databases
+	stats *serverStats
+	// blocking records clients blocked by BLPOP etc, it is nil for auxiliary databases
+	blocking *blockingManager
+	// notifier publishes keyspace events, it is nil for auxiliary databases
+	notifier *keyspaceNotifier
+	// callbacks of key inserted and deleted, nil means no callback
+	insertCallback database.KeyEventCallback
+	deleteCallback database.KeyEventCallback
+	// key -> *keyMeta, access metadata and estimated memory used by eviction, it is nil for auxiliary databases
+	meta dict.Dict
+	// usedMemory is the sum of estimated memory of all keys, it should be accessed atomically
+	usedMemory int64
 }
 
 // ExecFunc 统一执行方法
@@ -63,13 +76,15 @@ type UndoFunc func(db *DB, args [][]byte) []CmdLine
 // makeDB create DB instance
 func makeDB() *DB {
 	db := &DB{
-		data: dict.MakeSyncDict(),
+		data: dict.MakeConcurrent(dataDictSize),
 		//修改一个bug，增加一个空的实现
 		addAof: func(line CmdLine) {},
-		// 初始化map 赋值一个SyncMap
-		ttlMap:     dict.MakeSyncDict(),
+		// 初始化map 赋值一个分片的ConcurrentDict
+		ttlMap:     dict.MakeConcurrent(ttlDictSize),
 		versionMap: dict.MakeSyncDict(),
 		locker:     lock.Make(lockerSize),
+		blocking:   makeBlockingManager(),
+		meta:       dict.MakeSyncDict(),
 	}
 	return db
 }
@@ -77,57 +92,89 @@ func makeDB() *DB {
 // makeBasicDB create DB instance only with basic abilities.
 func makeBasicDB() *DB {
 	db := &DB{
-		data:       dict.MakeSyncDict(),
-		ttlMap:     dict.MakeSyncDict(),
+		data:       dict.MakeConcurrent(dataDictSize),
+		ttlMap:     dict.MakeConcurrent(ttlDictSize),
 		versionMap: dict.MakeSyncDict(),
 		addAof:     func(line CmdLine) {},
+		locker:     lock.Make(lockerSize),
 	}
 	return db
 }
 
 // Exec executes command within one database
 //
-//	TODO 优化Exec方法
-//	@Description:
+//	@Description: 事务控制命令在这里处理，其余命令在multi状态下入队，否则直接执行
 //	@receiver db*
 //	@param connection
 //	@param cmdline
-func (db *DB) Exec(connection godis.Connection, cmdLine CmdLine) godis.Reply {
+func (db *DB) Exec(c godis.Connection, cmdLine CmdLine) godis.Reply {
 	// 用户发的是什么指令
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	// transaction control commands and other commands which cannot execute within transaction
+	if cmdName == "multi" {
+		if len(cmdLine) != 1 {
+			return protocol.MakeArgNumErrReply(cmdName)
+		}
+		return StartMulti(c)
+	} else if cmdName == "discard" {
+		if len(cmdLine) != 1 {
+			return protocol.MakeArgNumErrReply(cmdName)
+		}
+		return DiscardMulti(c)
+	} else if cmdName == "exec" {
+		if len(cmdLine) != 1 {
+			return protocol.MakeArgNumErrReply(cmdName)
+		}
+		return execMulti(db, c)
+	} else if cmdName == "watch" {
+		if !validateArity(-2, cmdLine) {
+			return protocol.MakeArgNumErrReply(cmdName)
+		}
+		return Watch(db, c, cmdLine[1:])
+	} else if cmdName == "unwatch" {
+		if len(cmdLine) != 1 {
+			return protocol.MakeArgNumErrReply(cmdName)
+		}
+		return UnWatch(c)
+	}
+	// multi状态下只入队不执行
+	if c != nil && c.InMultiState() {
+		return EnqueueCmd(c, cmdLine)
+	}
+	// 阻塞命令在没有数据时等待, 事务中的阻塞命令不会阻塞
+	if db.blocking != nil && IsBlockingCommand(cmdName) {
+		return db.execBlockingCommand(c, cmdLine)
+	}
+	return db.execNormalCommand(cmdLine)
+}
+
+// execNormalCommand locks related keys, bumps versions of write keys and executes the command
+func (db *DB) execNormalCommand(cmdLine [][]byte) godis.Reply {
 	cmdName := strings.ToLower(string(cmdLine[0]))
 	cmd, ok := cmdTable[cmdName]
 	if !ok {
-		return protocol.MakeErrReply("ERR unknown command " + cmdName)
+		return protocol.MakeErrReply("ERR unknown command '" + cmdName + "'")
 	}
 	// 校验arity是否合法
 	if !validateArity(cmd.arity, cmdLine) {
 		return protocol.MakeArgNumErrReply(cmdName)
 	}
+
+	prepare := cmd.prepare
+	write, read := prepare(cmdLine[1:])
+	db.addVersion(write...)
+	db.RWLocks(write, read)
+	defer db.RWUnLocks(write, read)
+	if cmd.flags&flagReadOnly > 0 {
+		db.countKeyspaceLookup(read)
+	}
 	fun := cmd.executor
 	// SET K V ->K V
-	return fun(db, cmdLine[1:])
+	result := fun(db, cmdLine[1:])
+	db.trackKeys(write, read)
+	return result
 }
 
-// TODO 优化实现prepare
-// func (db *DB) execNormalCommand(cmdLine [][]byte) godis.Reply {
-//	cmdName := strings.ToLower(string(cmdLine[0]))
-//	cmd, ok := cmdTable[cmdName]
-//	if !ok {
-//		return protocol.MakeErrReply("ERR unknown command '" + cmdName + "'")
-//	}
-//	if !validateArity(cmd.arity, cmdLine) {
-//		return protocol.MakeArgNumErrReply(cmdName)
-//	}
-//
-//	prepare := cmd.prepare
-//	write, read := prepare(cmdLine[1:])
-//	db.addVersion(write...)
-//	db.RWLocks(write, read)
-//	defer db.RWUnLocks(write, read)
-//	fun := cmd.executor
-//	return fun(db, cmdLine[1:])
-//}
-
 // execWithLock executes normal commands, invoker should provide locks
 func (db *DB) execWithLock(cmdLine [][]byte) godis.Reply {
 	cmdName := strings.ToLower(string(cmdLine[0]))
@@ -139,7 +186,25 @@ func (db *DB) execWithLock(cmdLine [][]byte) godis.Reply {
 		return protocol.MakeArgNumErrReply(cmdName)
 	}
 	fun := cmd.executor
-	return fun(db, cmdLine[1:])
+	result := fun(db, cmdLine[1:])
+	if db.meta != nil {
+		db.trackKeys(cmd.prepare(cmdLine[1:]))
+	}
+	return result
+}
+
+// countKeyspaceLookup counts keyspace hits and misses of read-only commands
+func (db *DB) countKeyspaceLookup(keys []string) {
+	if db.stats == nil {
+		return
+	}
+	for _, key := range keys {
+		if _, exists := db.GetEntity(key); exists {
+			db.stats.incrKeyspaceHits()
+		} else {
+			db.stats.incrKeyspaceMisses()
+		}
+	}
 }
 
 // SET K V -> arity = 3
@@ -170,6 +235,10 @@ func (db *DB) GetEntity(key string) (*database.DataEntity, bool) {
 	if !ok {
 		return nil, false
 	}
+	// 惰性删除: 访问到已过期的 key 时删除
+	if db.IsExpired(key) {
+		return nil, false
+	}
 	entity, _ := raw.(*database.DataEntity)
 	return entity, true
 }
@@ -183,26 +252,47 @@ func (db *DB) GetEntity(key string) (*database.DataEntity, bool) {
 //	@return int 存入多少个
 func (db *DB) PutEntity(key string, entity *database.DataEntity) int {
 	// 存的时候会自动转化空接口，取的时候需要自己转化
-	return db.data.Put(key, entity)
+	ret := db.data.Put(key, entity)
+	db.updateKeyMeta(key, entity)
+	// 回调可能被并发替换, 先读到局部变量中
+	if cb := db.insertCallback; ret > 0 && cb != nil {
+		cb(db.index, key, entity)
+	}
+	return ret
 }
 
 // PutIfExists edit an existing DataEntity
 func (db *DB) PutIfExists(key string, entity *database.DataEntity) int {
-	return db.data.PutIfExists(key, entity)
+	ret := db.data.PutIfExists(key, entity)
+	if ret > 0 {
+		db.updateKeyMeta(key, entity)
+	}
+	return ret
 }
 
 // PutIfAbsent insert an DataEntity only if the key not exists
 func (db *DB) PutIfAbsent(key string, entity *database.DataEntity) int {
-	return db.data.PutIfAbsent(key, entity)
+	ret := db.data.PutIfAbsent(key, entity)
+	if ret > 0 {
+		db.updateKeyMeta(key, entity)
+	}
+	if cb := db.insertCallback; ret > 0 && cb != nil {
+		cb(db.index, key, entity)
+	}
+	return ret
 }
 
 // Remove the given key from db
 func (db *DB) Remove(key string) {
-	db.data.Remove(key)
+	raw, deleted := db.data.Remove(key)
+	db.removeKeyMeta(key)
 	// 删除ttl相关
 	db.ttlMap.Remove(key)
-	taskKey := genExpireTask(key)
-	timewheel.Cancel(taskKey)
+	cancelExpireTask(key)
+	if cb := db.deleteCallback; deleted > 0 && cb != nil {
+		entity, _ := raw.(*database.DataEntity)
+		cb(db.index, key, entity)
+	}
 }
 
 // Removes the given keys from db
@@ -216,7 +306,7 @@ func (db *DB) Remove(key string) {
 func (db *DB) Removes(keys ...string) (deleted int) {
 	deleted = 0
 	for _, key := range keys {
-		_, exists := db.data.Get(key)
+		_, exists := db.GetEntity(key)
 		if exists {
 			db.Remove(key)
 			deleted++
@@ -226,11 +316,17 @@ func (db *DB) Removes(keys ...string) (deleted int) {
 }
 
 // Flush clean database
+//
+//	@Description: 不能替换 locker, 事务和其他命令可能仍持有旧 locker 中的锁, 之后会在同一个 locker 上解锁
+//	@receiver db
 func (db *DB) Flush() {
 	db.data.Clear()
 	// 删除ttl相关
 	db.ttlMap.Clear()
-	db.locker = lock.Make(lockerSize)
+	if db.meta != nil {
+		db.meta.Clear()
+		atomic.StoreInt64(&db.usedMemory, 0)
+	}
 }
 
 /* TODO 优化---- Lock Function ----- */
@@ -246,6 +342,25 @@ func (db *DB) RWUnLocks(writeKeys []string, readKeys []string) {
 	db.locker.RWUnLocks(writeKeys, readKeys)
 }
 
+/* ---- Version Functions ---- */
+
+// addVersion increases version of the given keys, invoker should lock keys
+func (db *DB) addVersion(keys ...string) {
+	for _, key := range keys {
+		versionCode := db.GetVersion(key)
+		db.versionMap.Put(key, versionCode+1)
+	}
+}
+
+// GetVersion returns version code for given key
+func (db *DB) GetVersion(key string) uint32 {
+	entity, ok := db.versionMap.Get(key)
+	if !ok {
+		return 0
+	}
+	return entity.(uint32)
+}
+
 /* ---- TTL Functions ---- */
 func genExpireTask(key string) string {
 	return "expire:" + key
@@ -259,27 +374,25 @@ func genExpireTask(key string) string {
 //	@param expireTime
 func (db *DB) Expire(key string, expireTime time.Time) {
 	db.ttlMap.Put(key, expireTime)
+	// 默认由 active expire cycle 和惰性删除处理过期, 开启 expire-timewheel 时额外为每个 key 注册定时任务
+	if !config.Get(&config.Properties.ExpireTimeWheel) {
+		return
+	}
 	taskKey := genExpireTask(key)
 	// 指定时间执行操作
 	timewheel.At(expireTime, taskKey, func() {
-		keys := []string{key}
-		// 需要锁住所有的keys
-		db.RWLocks(keys, nil)
-		defer db.RWUnLocks(keys, nil)
-		// check-lock-check, ttl may be updated during waiting lock
 		logger.Info("expire " + key)
-		rawExpireTime, ok := db.ttlMap.Get(key)
-		if !ok {
-			return
-		}
-		expireTime, _ := rawExpireTime.(time.Time)
-		expired := time.Now().After(expireTime)
-		if expired {
-			db.Remove(key)
-		}
+		db.expireIfNeeded(key)
 	})
 }
 
+// cancelExpireTask cancels timewheel job of key, nothing happens if expire-timewheel is disabled
+func cancelExpireTask(key string) {
+	if config.Get(&config.Properties.ExpireTimeWheel) {
+		timewheel.Cancel(genExpireTask(key))
+	}
+}
+
 // Persist cancel ttlCmd of key
 //
 //	@Description: 删除过期时间
@@ -287,21 +400,16 @@ func (db *DB) Expire(key string, expireTime time.Time) {
 //	@param key
 func (db *DB) Persist(key string) {
 	db.ttlMap.Remove(key)
-	taskKey := genExpireTask(key)
 	// 调用第三方库删除倒计时
-	timewheel.Cancel(taskKey)
+	cancelExpireTask(key)
 }
 
 // IsExpired check whether a key is expired
+// expired key will be removed
 func (db *DB) IsExpired(key string) bool {
-	rawExpireTime, ok := db.ttlMap.Get(key)
-	if !ok {
-		return false
-	}
-	expireTime, _ := rawExpireTime.(time.Time)
-	expired := time.Now().After(expireTime)
+	expired := db.hasExpired(key, time.Now())
 	if expired {
-		db.Remove(key)
+		db.expireKey(key)
 	}
 	return expired
 }
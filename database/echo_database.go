@@ -12,6 +12,7 @@ package database
 import (
 	"github.com/Allen9012/Godis/godis/protocol"
 	"github.com/Allen9012/Godis/interface/godis"
+	"github.com/Allen9012/Godis/lib/rdb"
 )
 
 type EchoDatabase struct {
@@ -32,3 +33,7 @@ func (e EchoDatabase) Close() {
 func (e EchoDatabase) AfterClientClose(c godis.Connection) {
 
 }
+
+func (e EchoDatabase) LoadRDB(dec *rdb.Decoder) error {
+	return nil
+}
@@ -0,0 +1,300 @@
+package database
+
+import (
+	"github.com/Allen9012/Godis/config"
+	"github.com/Allen9012/Godis/interface/database"
+	"github.com/Allen9012/Godis/interface/godis"
+	"github.com/Allen9012/Godis/latency"
+	"github.com/Allen9012/Godis/lib/utils"
+	"math"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/16
+  @desc: maxmemory 淘汰策略, 与 redis 一样使用近似算法
+	每个 key 记录最近访问时间, 对数访问计数和估算的内存, 已用内存超过 maxmemory 时,
+	从每个 db 随机采样 maxmemory-samples 个 key, 淘汰其中最合适的一个, 直到内存低于限制
+	volatile-* 策略只从设置了过期时间的 key 中采样, noeviction 或者没有可淘汰的 key 时拒绝写命令
+  @modified by:
+**/
+
+const (
+	policyNoEviction     = "noeviction"
+	policyAllKeysLRU     = "allkeys-lru"
+	policyAllKeysLFU     = "allkeys-lfu"
+	policyAllKeysRandom  = "allkeys-random"
+	policyVolatileLRU    = "volatile-lru"
+	policyVolatileLFU    = "volatile-lfu"
+	policyVolatileRandom = "volatile-random"
+	policyVolatileTTL    = "volatile-ttl"
+)
+
+// parameters of lfu counter, same as default values of redis
+const (
+	// counter of new keys, so that they won't be evicted at once
+	lfuInitVal = 5
+	// the larger the factor, the more accesses are needed to increase counter
+	lfuLogFactor = 10
+	// counter decreases by 1 every lfuDecayTime without access
+	lfuDecayTime = time.Minute
+	lfuMaxVal    = 255
+)
+
+const oomErr = "OOM command not allowed when used memory > 'maxmemory'."
+
+// keyMeta records access metadata and estimated memory of a key, all fields should be accessed atomically
+type keyMeta struct {
+	// accessTime is unix milliseconds of last access
+	accessTime int64
+	// lfuCounter is logarithmic access counter, it decays with time since last access
+	lfuCounter uint32
+	// size is estimated memory in bytes
+	size int64
+}
+
+func makeKeyMeta(now time.Time) *keyMeta {
+	return &keyMeta{
+		accessTime: now.UnixMilli(),
+		lfuCounter: lfuInitVal,
+	}
+}
+
+// touch updates access time and lfu counter
+func (meta *keyMeta) touch(now time.Time) {
+	counter := lfuLogIncr(meta.lfuValue(now))
+	atomic.StoreUint32(&meta.lfuCounter, counter)
+	atomic.StoreInt64(&meta.accessTime, now.UnixMilli())
+}
+
+// idleTime returns time since last access
+func (meta *keyMeta) idleTime(now time.Time) time.Duration {
+	return time.Duration(now.UnixMilli()-atomic.LoadInt64(&meta.accessTime)) * time.Millisecond
+}
+
+// lfuValue returns lfu counter after decay
+func (meta *keyMeta) lfuValue(now time.Time) uint32 {
+	counter := atomic.LoadUint32(&meta.lfuCounter)
+	periods := uint32(meta.idleTime(now) / lfuDecayTime)
+	if periods >= counter {
+		return 0
+	}
+	return counter - periods
+}
+
+// lfuLogIncr increases counter with probability 1/((counter-lfuInitVal)*lfuLogFactor+1)
+func lfuLogIncr(counter uint32) uint32 {
+	if counter >= lfuMaxVal {
+		return lfuMaxVal
+	}
+	base := 0.0
+	if counter > lfuInitVal {
+		base = float64(counter - lfuInitVal)
+	}
+	if rand.Float64() < 1/(base*lfuLogFactor+1) {
+		counter++
+	}
+	return counter
+}
+
+/* ---- key metadata of DB ---- */
+
+// getKeyMeta returns metadata of key, returns false for auxiliary databases or not existed key
+func (db *DB) getKeyMeta(key string) (*keyMeta, bool) {
+	if db.meta == nil {
+		return nil, false
+	}
+	raw, ok := db.meta.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return raw.(*keyMeta), true
+}
+
+// updateKeyMeta re-estimates memory of key, metadata is created for new key, invoker should hold the write lock of key
+func (db *DB) updateKeyMeta(key string, entity *database.DataEntity) {
+	if db.meta == nil {
+		return
+	}
+	meta, ok := db.getKeyMeta(key)
+	if !ok {
+		meta = makeKeyMeta(time.Now())
+		db.meta.Put(key, meta)
+	}
+	size := estimateKeySize(key, entity, defaultMemorySamples)
+	old := atomic.SwapInt64(&meta.size, size)
+	atomic.AddInt64(&db.usedMemory, size-old)
+}
+
+// removeKeyMeta removes metadata of deleted key
+func (db *DB) removeKeyMeta(key string) {
+	if db.meta == nil {
+		return
+	}
+	raw, removed := db.meta.Remove(key)
+	if removed > 0 {
+		meta := raw.(*keyMeta)
+		atomic.AddInt64(&db.usedMemory, -atomic.LoadInt64(&meta.size))
+	}
+}
+
+// trackKeys is called after command executed, it updates memory of written keys and access time of all keys
+// invoker should hold locks of keys
+func (db *DB) trackKeys(writeKeys []string, readKeys []string) {
+	if db.meta == nil {
+		return
+	}
+	now := time.Now()
+	for _, key := range writeKeys {
+		// 命令可能原地修改了集合, 需要重新估算内存
+		entity, exists := db.GetEntity(key)
+		if !exists {
+			continue
+		}
+		db.updateKeyMeta(key, entity)
+		if meta, ok := db.getKeyMeta(key); ok {
+			meta.touch(now)
+		}
+	}
+	for _, key := range readKeys {
+		if meta, ok := db.getKeyMeta(key); ok {
+			meta.touch(now)
+		}
+	}
+}
+
+/* ---- eviction ---- */
+
+// sampleEvictionKey samples keys and returns the best one to evict by policy, larger score is better
+func (db *DB) sampleEvictionKey(policy string, samples int, now time.Time) (string, float64, bool) {
+	pool := db.data
+	if strings.HasPrefix(policy, "volatile-") {
+		pool = db.ttlMap
+	}
+	bestKey, bestScore, found := "", 0.0, false
+	for _, key := range pool.RandomDistinctKeys(samples) {
+		meta, ok := db.getKeyMeta(key)
+		if !ok {
+			continue
+		}
+		var score float64
+		switch policy {
+		case policyAllKeysLRU, policyVolatileLRU:
+			score = float64(meta.idleTime(now))
+		case policyAllKeysLFU, policyVolatileLFU:
+			score = float64(lfuMaxVal - meta.lfuValue(now))
+		case policyVolatileTTL:
+			raw, ok := db.ttlMap.Get(key)
+			if !ok {
+				continue
+			}
+			// 越早过期越优先淘汰
+			score = -float64(raw.(time.Time).UnixMilli())
+		default:
+			score = rand.Float64()
+		}
+		if !found || score > bestScore {
+			bestKey, bestScore, found = key, score, true
+		}
+	}
+	return bestKey, bestScore, found
+}
+
+// evictKey removes key like DEL and publishes evicted event, returns false if key no longer exists
+func (db *DB) evictKey(key string) bool {
+	keys := []string{key}
+	db.RWLocks(keys, nil)
+	defer db.RWUnLocks(keys, nil)
+	if _, exists := db.data.Get(key); !exists {
+		return false
+	}
+	db.addVersion(key)
+	db.Remove(key)
+	db.addAof(utils.ToCmdLine("del", key))
+	db.notifyKeyspaceEvent(notifyEvicted, "evicted", key)
+	db.stats.incrEvictedKeys()
+	return true
+}
+
+// usedMemory returns estimated memory of all keys
+func (server *StandaloneServer) usedMemory() int64 {
+	var used int64
+	for i := range server.dbSet {
+		used += atomic.LoadInt64(&server.mustSelectDB(i).usedMemory)
+	}
+	return used
+}
+
+// evictOne samples every database and evicts the best key, returns false if there is nothing to evict
+func (server *StandaloneServer) evictOne(policy string, samples int) bool {
+	now := time.Now()
+	var victimDB *DB
+	victim, bestScore := "", math.Inf(-1)
+	for i := range server.dbSet {
+		db := server.mustSelectDB(i)
+		key, score, ok := db.sampleEvictionKey(policy, samples, now)
+		if ok && score > bestScore {
+			victimDB, victim, bestScore = db, key, score
+		}
+	}
+	if victimDB == nil {
+		return false
+	}
+	victimDB.evictKey(victim)
+	return true
+}
+
+// freeMemoryIfNeeded evicts keys until used memory is under maxmemory
+//
+//	@Description: 加载数据期间和从节点不淘汰, 从节点的数据由主节点同步的 del 删除
+//	@receiver server
+//	@param c
+//	@return bool	内存仍然超过限制时返回 false
+func (server *StandaloneServer) freeMemoryIfNeeded(c godis.Connection) bool {
+	maxMemory := int64(config.Get(&config.Properties.MaxMemory))
+	if maxMemory <= 0 || atomic.LoadInt32(&server.loading) == 1 || server.getRole() == slaveRole ||
+		(c != nil && c.IsMaster()) {
+		return true
+	}
+	policy := strings.ToLower(config.Get(&config.Properties.MaxMemoryPolicy))
+	samples := config.Get(&config.Properties.MaxMemorySamples)
+	if samples <= 0 {
+		samples = defaultMemorySamples
+	}
+	start := time.Now()
+	defer func() {
+		latency.AddSampleIfNeeded(latency.EventEvictionCycle, time.Since(start))
+	}()
+	for server.usedMemory() > maxMemory {
+		if policy == policyNoEviction || policy == "" {
+			return false
+		}
+		if !server.evictOne(policy, samples) {
+			return false
+		}
+	}
+	return true
+}
+
+// oomAllowedCommands are write commands which never increase memory, they are allowed when memory is over limit
+var oomAllowedCommands = map[string]struct{}{
+	"del": {}, "flushdb": {}, "getdel": {},
+	"expire": {}, "expireat": {}, "pexpire": {}, "pexpireat": {}, "persist": {},
+	"lpop": {}, "rpop": {}, "lrem": {}, "lmpop": {}, "blpop": {}, "brpop": {}, "blmpop": {},
+	"srem": {}, "spop": {}, "hdel": {},
+	"zrem": {}, "zpopmin": {}, "zremrangebyscore": {}, "zremrangebyrank": {}, "zremrangebylex": {},
+	"xdel": {}, "xtrim": {}, "xack": {},
+}
+
+// denyOOM returns whether the command should be rejected when memory is over limit
+func denyOOM(cmdName string) bool {
+	if _, ok := oomAllowedCommands[cmdName]; ok {
+		return false
+	}
+	return isWriteCommand(cmdName)
+}
@@ -0,0 +1,190 @@
+package database
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/16
+  @desc: maxmemory eviction
+  @modified by:
+**/
+
+import (
+	"github.com/Allen9012/Godis/config"
+	"github.com/Allen9012/Godis/godis/connection"
+	"github.com/Allen9012/Godis/godis/protocol/asserts"
+	"github.com/Allen9012/Godis/lib/utils"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// setMaxMemory changes maxmemory settings, returns a function to restore them
+func setMaxMemory(server *StandaloneServer, maxMemory string, policy string) func() {
+	conn := connection.NewFakeConn()
+	server.Exec(conn, utils.ToCmdLine("config", "set", "maxmemory-policy", policy))
+	server.Exec(conn, utils.ToCmdLine("config", "set", "maxmemory", maxMemory))
+	server.Exec(conn, utils.ToCmdLine("config", "set", "maxmemory-samples", "64"))
+	return func() {
+		config.Properties.MaxMemory = 0
+		config.Properties.MaxMemoryPolicy = policyNoEviction
+		config.Properties.MaxMemorySamples = defaultMemorySamples
+	}
+}
+
+func TestMaxMemoryNoEviction(t *testing.T) {
+	server := NewStandaloneServer()
+	defer server.Close()
+	conn := connection.NewFakeConn()
+	server.Exec(conn, utils.ToCmdLine("flushdb"))
+	defer setMaxMemory(server, "1kb", "noeviction")()
+
+	value := utils.RandString(100)
+	var result = server.Exec(conn, utils.ToCmdLine("set", "k0", value))
+	asserts.AssertStatusReply(t, result, "OK")
+	for i := 1; i < 100 && server.usedMemory() <= 1024; i++ {
+		server.Exec(conn, utils.ToCmdLine("set", "k"+strconv.Itoa(i), value))
+	}
+	result = server.Exec(conn, utils.ToCmdLine("set", "new", value))
+	asserts.AssertErrReply(t, result, oomErr)
+	result = server.Exec(conn, utils.ToCmdLine("rpush", "list", value))
+	asserts.AssertErrReply(t, result, oomErr)
+	// read commands and commands which release memory are allowed
+	result = server.Exec(conn, utils.ToCmdLine("get", "k0"))
+	asserts.AssertBulkReply(t, result, value)
+	result = server.Exec(conn, utils.ToCmdLine("del", "k0", "k1"))
+	asserts.AssertIntReply(t, result, 2)
+	result = server.Exec(conn, utils.ToCmdLine("set", "new", value))
+	asserts.AssertStatusReply(t, result, "OK")
+}
+
+func TestOOMInScriptAndMulti(t *testing.T) {
+	server := NewStandaloneServer()
+	defer server.Close()
+	conn := connection.NewFakeConn()
+	server.Exec(conn, utils.ToCmdLine("flushdb"))
+	server.Exec(conn, utils.ToCmdLine("set", "k0", utils.RandString(100)))
+	server.Exec(conn, utils.ToCmdLine("set", "k2", utils.RandString(100)))
+	defer setMaxMemory(server, "1", "noeviction")()
+
+	// EVAL is not a write command, write commands called by script are rejected
+	result := server.Exec(conn, utils.ToCmdLine("eval", "return redis.call('set', KEYS[1], ARGV[1])", "1", "k1", "v"))
+	asserts.AssertErrReply(t, result, oomErr)
+	result = server.Exec(conn, utils.ToCmdLine("eval", "return redis.call('get', KEYS[1])", "1", "k1"))
+	asserts.AssertNullBulk(t, result)
+	result = server.Exec(conn, utils.ToCmdLine("eval", "return redis.call('del', KEYS[1])", "1", "k0"))
+	asserts.AssertIntReply(t, result, 1)
+
+	// command rejected while queueing discards the transaction
+	server.Exec(conn, utils.ToCmdLine("multi"))
+	result = server.Exec(conn, utils.ToCmdLine("set", "k1", "v"))
+	asserts.AssertErrReply(t, result, oomErr)
+	result = server.Exec(conn, utils.ToCmdLine("exec"))
+	asserts.AssertErrReply(t, result, "EXECABORT Transaction discarded because of previous errors.")
+	result = server.Exec(conn, utils.ToCmdLine("get", "k1"))
+	asserts.AssertNullBulk(t, result)
+}
+
+func TestEvictionAllKeysLRU(t *testing.T) {
+	server := NewStandaloneServer()
+	defer server.Close()
+	conn := connection.NewFakeConn()
+	server.Exec(conn, utils.ToCmdLine("flushdb"))
+	value := utils.RandString(100)
+	for i := 0; i < 10; i++ {
+		server.Exec(conn, utils.ToCmdLine("set", "k"+strconv.Itoa(i), value))
+	}
+	time.Sleep(10 * time.Millisecond)
+	for i := 5; i < 10; i++ {
+		server.Exec(conn, utils.ToCmdLine("get", "k"+strconv.Itoa(i)))
+	}
+	defer setMaxMemory(server, strconv.FormatInt(server.usedMemory(), 10), "allkeys-lru")()
+
+	// every new key causes one key evicted before next command
+	result := server.Exec(conn, utils.ToCmdLine("set", "kA", value))
+	asserts.AssertStatusReply(t, result, "OK")
+	result = server.Exec(conn, utils.ToCmdLine("set", "kB", value))
+	asserts.AssertStatusReply(t, result, "OK")
+	// keys accessed recently are kept
+	for i := 5; i < 10; i++ {
+		result = server.Exec(conn, utils.ToCmdLine("exists", "k"+strconv.Itoa(i)))
+		asserts.AssertIntReply(t, result, 1)
+	}
+	result = server.Exec(conn, utils.ToCmdLine("exists", "k0", "k1", "k2", "k3", "k4"))
+	asserts.AssertIntReply(t, result, 3)
+	if evicted := server.stats.evictedKeys; evicted != 2 {
+		t.Errorf("expect 2 evicted keys, actual %d", evicted)
+	}
+}
+
+func TestEvictionVolatileTTL(t *testing.T) {
+	server := NewStandaloneServer()
+	defer server.Close()
+	defer func() {
+		config.Properties.NotifyKeyspaceEvents = ""
+	}()
+	sub := subscribeKeyspace(server, "Ee")
+	conn := connection.NewFakeConn()
+	server.Exec(conn, utils.ToCmdLine("flushdb"))
+	value := utils.RandString(100)
+	server.Exec(conn, utils.ToCmdLine("set", "persistent", value))
+	server.Exec(conn, utils.ToCmdLine("set", "short", value, "ex", "100"))
+	server.Exec(conn, utils.ToCmdLine("set", "long", value, "ex", "1000"))
+	defer setMaxMemory(server, strconv.FormatInt(server.usedMemory(), 10), "volatile-ttl")()
+
+	result := server.Exec(conn, utils.ToCmdLine("set", "new", value))
+	asserts.AssertStatusReply(t, result, "OK")
+	result = server.Exec(conn, utils.ToCmdLine("exists", "persistent", "short", "long"))
+	asserts.AssertIntReply(t, result, 2)
+	result = server.Exec(conn, utils.ToCmdLine("exists", "short"))
+	asserts.AssertIntReply(t, result, 0)
+	assertKeyspaceMessages(t, sub, "__keyevent@0__:evicted short")
+
+	// keys without ttl are never evicted by volatile policies
+	server.Exec(conn, utils.ToCmdLine("persist", "long"))
+	result = server.Exec(conn, utils.ToCmdLine("set", "new2", value))
+	asserts.AssertStatusReply(t, result, "OK")
+	result = server.Exec(conn, utils.ToCmdLine("set", "new3", value))
+	asserts.AssertErrReply(t, result, oomErr)
+}
+
+func TestLFUCounter(t *testing.T) {
+	now := time.Now()
+	meta := makeKeyMeta(now)
+	for i := 0; i < 1000; i++ {
+		meta.touch(now)
+	}
+	counter := meta.lfuValue(now)
+	if counter <= lfuInitVal || counter >= lfuMaxVal {
+		t.Errorf("counter should grow logarithmically, actual %d", counter)
+	}
+	if decayed := meta.lfuValue(now.Add(3 * lfuDecayTime)); decayed != counter-3 {
+		t.Errorf("expect %d after decay, actual %d", counter-3, decayed)
+	}
+}
+
+func TestUsedMemory(t *testing.T) {
+	server := NewStandaloneServer()
+	defer server.Close()
+	conn := connection.NewFakeConn()
+	server.Exec(conn, utils.ToCmdLine("flushdb"))
+	if used := server.usedMemory(); used != 0 {
+		t.Errorf("expect 0 after flush, actual %d", used)
+	}
+	server.Exec(conn, utils.ToCmdLine("set", "k", "v"))
+	used := server.usedMemory()
+	if used <= 0 {
+		t.Errorf("expect positive memory, actual %d", used)
+	}
+	// modification in place is tracked
+	for i := 0; i < 100; i++ {
+		server.Exec(conn, utils.ToCmdLine("rpush", "list", utils.RandString(100)))
+	}
+	if server.usedMemory() < used+100*100 {
+		t.Errorf("memory of list is not tracked, actual %d", server.usedMemory())
+	}
+	server.Exec(conn, utils.ToCmdLine("rename", "list", "list2"))
+	server.Exec(conn, utils.ToCmdLine("del", "list2"))
+	if server.usedMemory() != used {
+		t.Errorf("expect %d, actual %d", used, server.usedMemory())
+	}
+}
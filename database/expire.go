@@ -0,0 +1,146 @@
+package database
+
+import (
+	"github.com/Allen9012/Godis/config"
+	"github.com/Allen9012/Godis/latency"
+	"github.com/Allen9012/Godis/lib/utils"
+	"sync/atomic"
+	"time"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/16
+  @desc: 过期 key 的删除, 与 redis 相同分为两部分
+	惰性删除: 访问 key 时发现已过期则删除
+	主动删除: 每秒 hz 次从 ttlMap 中随机采样, 删除其中过期的 key, 过期比例较高时继续采样,
+	每个周期最多使用 25% 的时间, 超时后下个周期从中断的 db 继续
+	删除过期 key 时向 aof 和从节点传播 DEL
+  @modified by:
+**/
+
+const (
+	// number of keys sampled in each loop of a database
+	activeExpireKeysPerLoop = 20
+	// percentage of time of a cron period used by active expire cycle
+	activeExpireCycleTimePerc = 25
+	// keep sampling a database while the percentage of expired keys is above it
+	activeExpireStalePerc = 10
+)
+
+// hasExpired returns whether key has ttl and the ttl has been reached, it won't remove the key
+func (db *DB) hasExpired(key string, now time.Time) bool {
+	raw, ok := db.ttlMap.Get(key)
+	if !ok {
+		return false
+	}
+	expireTime, _ := raw.(time.Time)
+	return now.After(expireTime)
+}
+
+// expireKey removes expired key, invoker should hold the lock of key
+func (db *DB) expireKey(key string) {
+	_, exists := db.data.Get(key)
+	db.Remove(key)
+	if !exists {
+		return
+	}
+	db.addAof(utils.ToCmdLine("del", key))
+	db.notifyKeyspaceEvent(notifyExpired, "expired", key)
+	db.stats.incrExpiredKeys()
+}
+
+// expireIfNeeded locks key and removes it if it is expired, returns whether the key is removed
+func (db *DB) expireIfNeeded(key string) bool {
+	keys := []string{key}
+	db.RWLocks(keys, nil)
+	defer db.RWUnLocks(keys, nil)
+	// check-lock-check, ttl may be updated during waiting lock
+	return db.IsExpired(key)
+}
+
+// activeExpireSample samples keys with ttl and removes expired ones
+func (db *DB) activeExpireSample(count int, now time.Time) (expired int, sampled int) {
+	keys := db.ttlMap.RandomDistinctKeys(count)
+	for _, key := range keys {
+		// 先不加锁检查, 只对过期的 key 加锁
+		if db.hasExpired(key, now) && db.expireIfNeeded(key) {
+			expired++
+		}
+	}
+	return expired, len(keys)
+}
+
+// startExpireCron runs activeExpireCycle hz times per second until server closed
+func (server *StandaloneServer) startExpireCron() {
+	stopCron := server.stopCron
+	go func() {
+		for {
+			hz := config.Get(&config.Properties.Hz)
+			if hz <= 0 {
+				hz = 10
+			}
+			timer := time.NewTimer(time.Second / time.Duration(hz))
+			select {
+			case <-timer.C:
+				server.activeExpireCycle(hz)
+			case <-stopCron:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// activeExpireCycle removes expired keys of all databases within time budget
+//
+//	@Description: 逐个 db 采样, 过期比例低于 activeExpireStalePerc 时处理下一个 db
+//	@receiver server
+//	@param hz	每秒执行次数, 用于计算时间预算
+func (server *StandaloneServer) activeExpireCycle(hz int) {
+	start := time.Now()
+	budget := time.Second * activeExpireCycleTimePerc / 100 / time.Duration(hz)
+	timeout := false
+	dbNum := len(server.dbSet)
+	for i := 0; i < dbNum && !timeout; i++ {
+		db := server.mustSelectDB(server.expireCursor % dbNum)
+		for {
+			expired, sampled := db.activeExpireSample(activeExpireKeysPerLoop, time.Now())
+			if time.Since(start) > budget {
+				timeout = true
+				break
+			}
+			if sampled == 0 || expired*100/sampled <= activeExpireStalePerc {
+				break
+			}
+		}
+		if !timeout {
+			server.expireCursor++
+		}
+	}
+	elapsed := time.Since(start)
+	server.stats.addExpireCycleTime(elapsed)
+	latency.AddSampleIfNeeded(latency.EventExpireCycle, elapsed)
+	if timeout {
+		server.stats.incrExpiredTimeCapReached()
+	}
+}
+
+func (stats *serverStats) incrExpiredKeys() {
+	if stats != nil {
+		atomic.AddInt64(&stats.expiredKeys, 1)
+	}
+}
+
+func (stats *serverStats) incrExpiredTimeCapReached() {
+	if stats != nil {
+		atomic.AddInt64(&stats.expiredTimeCapReached, 1)
+	}
+}
+
+func (stats *serverStats) addExpireCycleTime(d time.Duration) {
+	if stats != nil {
+		atomic.AddInt64(&stats.expireCycleTime, int64(d))
+	}
+}
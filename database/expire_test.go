@@ -0,0 +1,83 @@
+package database
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/16
+  @desc: active and lazy expiration
+  @modified by:
+**/
+
+import (
+	"github.com/Allen9012/Godis/config"
+	"github.com/Allen9012/Godis/godis/connection"
+	"github.com/Allen9012/Godis/godis/protocol/asserts"
+	"github.com/Allen9012/Godis/lib/utils"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestActiveExpireCycle(t *testing.T) {
+	server := NewStandaloneServer()
+	defer server.Close()
+	conn := connection.NewFakeConn()
+	server.Exec(conn, utils.ToCmdLine("flushdb"))
+	server.Exec(conn, utils.ToCmdLine("config", "resetstat"))
+	for i := 0; i < 100; i++ {
+		server.Exec(conn, utils.ToCmdLine("set", "k"+strconv.Itoa(i), "v", "px", "50"))
+	}
+	server.Exec(conn, utils.ToCmdLine("set", "persistent", "v"))
+
+	db := server.mustSelectDB(0)
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) && db.ttlMap.Len() > 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// keys are removed without being accessed
+	if keys, expires := server.GetDBSize(0); keys != 1 || expires != 0 {
+		t.Errorf("expect 1 key and 0 expires, actual %d %d", keys, expires)
+	}
+	if expired := atomic.LoadInt64(&server.stats.expiredKeys); expired != 100 {
+		t.Errorf("expect 100 expired keys, actual %d", expired)
+	}
+}
+
+func TestLazyExpire(t *testing.T) {
+	db := makeTestDB()
+	db.Exec(nil, utils.ToCmdLine("set", "k1", "v", "px", "10"))
+	db.Exec(nil, utils.ToCmdLine("set", "k2", "v", "px", "10"))
+	db.Exec(nil, utils.ToCmdLine("set", "k3", "v"))
+	time.Sleep(20 * time.Millisecond)
+	// there is no expire cron for test db
+	if db.data.Len() != 3 {
+		t.Fatalf("expect 3 keys before access, actual %d", db.data.Len())
+	}
+	result := db.Exec(nil, utils.ToCmdLine("keys", "*"))
+	asserts.AssertMultiBulkReply(t, result, []string{"k3"})
+	result = db.Exec(nil, utils.ToCmdLine("exists", "k1"))
+	asserts.AssertIntReply(t, result, 0)
+	result = db.Exec(nil, utils.ToCmdLine("ttl", "k2"))
+	asserts.AssertIntReply(t, result, -2)
+	if db.data.Len() != 1 || db.ttlMap.Len() != 0 {
+		t.Errorf("expired keys should be removed on access, actual %d keys", db.data.Len())
+	}
+}
+
+func TestExpireTimeWheel(t *testing.T) {
+	// the timewheel task reads expire-timewheel in another goroutine, so change it through the locked setter
+	_ = config.SetProperty("expire-timewheel", "yes")
+	defer func() {
+		_ = config.SetProperty("expire-timewheel", "no")
+	}()
+	db := makeTestDB()
+	db.Exec(nil, utils.ToCmdLine("set", "k", "v", "px", "100"))
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) && db.data.Len() > 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if db.data.Len() != 0 {
+		t.Error("key should be removed by timewheel")
+	}
+}
@@ -0,0 +1,698 @@
+package database
+
+import (
+	"fmt"
+	SortedSet "github.com/Allen9012/Godis/datastruct/sortedset"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/interface/database"
+	"github.com/Allen9012/Godis/interface/godis"
+	"github.com/Allen9012/Godis/lib/geohash"
+	"github.com/Allen9012/Godis/lib/utils"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/11
+  @desc: GEO 命令, 位置以 52 位 geohash 作为 score 存放在 sorted set 中, 可以使用 ZSET 命令操作
+  @modified by:
+**/
+
+func init() {
+	registerCommand("GeoAdd", execGeoAdd, writeFirstKey, undoGeoAdd, -5, flagWrite)
+	registerCommand("GeoPos", execGeoPos, readFirstKey, nil, -2, flagReadOnly)
+	registerCommand("GeoDist", execGeoDist, readFirstKey, nil, -4, flagReadOnly)
+	registerCommand("GeoHash", execGeoHash, readFirstKey, nil, -2, flagReadOnly)
+	registerCommand("GeoSearch", execGeoSearch, readFirstKey, nil, -7, flagReadOnly)
+	registerCommand("GeoSearchStore", execGeoSearchStore, prepareGeoSearchStore, rollbackFirstKey, -8, flagWrite)
+	registerCommand("GeoRadius", execGeoRadius, prepareGeoRadius, undoGeoRadius, -6, flagWrite)
+	registerCommand("GeoRadius_RO", execGeoRadiusRO, readFirstKey, nil, -6, flagReadOnly)
+	registerCommand("GeoRadiusByMember", execGeoRadiusByMember, prepareGeoRadius, undoGeoRadius, -5, flagWrite)
+	registerCommand("GeoRadiusByMember_RO", execGeoRadiusByMemberRO, readFirstKey, nil, -5, flagReadOnly)
+}
+
+// parseGeoAddFlags returns flags of GEOADD key [NX|XX] [CH] and the index of first coordinate
+func parseGeoAddFlags(args [][]byte) (nx bool, xx bool, ch bool, i int) {
+	for i = 1; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "CH":
+			ch = true
+		default:
+			return
+		}
+	}
+	return
+}
+
+func undoGeoAdd(db *DB, args [][]byte) []CmdLine {
+	_, _, _, i := parseGeoAddFlags(args)
+	var members []string
+	for j := i + 2; j < len(args); j += 3 {
+		members = append(members, string(args[j]))
+	}
+	return rollbackZSetFields(db, string(args[0]), members...)
+}
+
+// parseGeoUnit returns meters of the unit
+func parseGeoUnit(arg []byte) (float64, protocol.ErrorReply) {
+	switch strings.ToLower(string(arg)) {
+	case "m":
+		return 1, nil
+	case "km":
+		return 1000, nil
+	case "ft":
+		return 0.3048, nil
+	case "mi":
+		return 1609.34, nil
+	}
+	return 0, protocol.MakeErrReply("ERR unsupported unit provided. please use M, KM, FT, MI")
+}
+
+// parseCoordinate parses longitude and latitude
+func parseCoordinate(lngArg []byte, latArg []byte) (lat float64, lng float64, errReply protocol.ErrorReply) {
+	lng, err := strconv.ParseFloat(string(lngArg), 64)
+	if err != nil {
+		return 0, 0, protocol.MakeErrReply("ERR value is not a valid float")
+	}
+	lat, err = strconv.ParseFloat(string(latArg), 64)
+	if err != nil {
+		return 0, 0, protocol.MakeErrReply("ERR value is not a valid float")
+	}
+	if !geohash.Valid(lat, lng) {
+		return 0, 0, protocol.MakeErrReply(fmt.Sprintf("ERR invalid longitude,latitude pair %f,%f", lng, lat))
+	}
+	return lat, lng, nil
+}
+
+func formatCoordinate(score float64) [][]byte {
+	lat, lng := geohash.Decode(uint64(score))
+	return [][]byte{
+		[]byte(strconv.FormatFloat(lng, 'f', -1, 64)),
+		[]byte(strconv.FormatFloat(lat, 'f', -1, 64)),
+	}
+}
+
+func formatDistance(dist float64, unit float64) []byte {
+	return []byte(strconv.FormatFloat(dist/unit, 'f', 4, 64))
+}
+
+// execGeoAdd
+//
+//	@Description: GEOADD key [NX|XX] [CH] longitude latitude member [longitude latitude member ...]
+//	@param db
+//	@param args
+//	@return godis.Reply	新增的成员数, 指定 CH 时为变化的成员数
+func execGeoAdd(db *DB, args [][]byte) godis.Reply {
+	key := string(args[0])
+	nx, xx, ch, i := parseGeoAddFlags(args)
+	if nx && xx {
+		return protocol.MakeErrReply("ERR XX and NX options at the same time are not compatible")
+	}
+	locations := args[i:]
+	if len(locations) == 0 || len(locations)%3 != 0 {
+		return protocol.MakeErrReply("ERR syntax error. Try GEOADD key [x1] [y1] [name1] [x2] [y2] [name2] ... ")
+	}
+	elements := make([]*SortedSet.Element, 0, len(locations)/3)
+	for j := 0; j < len(locations); j += 3 {
+		lat, lng, errReply := parseCoordinate(locations[j], locations[j+1])
+		if errReply != nil {
+			return errReply
+		}
+		elements = append(elements, &SortedSet.Element{
+			Member: string(locations[j+2]),
+			Score:  float64(geohash.Encode(lat, lng)),
+		})
+	}
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		if xx {
+			return protocol.MakeIntReply(0)
+		}
+		sortedSet, _, _ = db.getOrInitSortedSet(key)
+	}
+	count := 0
+	updated := false
+	for _, e := range elements {
+		old, exists := sortedSet.Get(e.Member)
+		if (exists && nx) || (!exists && xx) {
+			continue
+		}
+		if !exists || (ch && old.Score != e.Score) {
+			count++
+		}
+		sortedSet.Add(e.Member, e.Score)
+		updated = true
+	}
+	db.addAof(utils.ToCmdLine3("geoadd", args...))
+	if updated {
+		db.notifyKeyspaceEvent(notifyZSet, "zadd", key)
+	}
+	return protocol.MakeIntReply(int64(count))
+}
+
+// execGeoPos
+//
+//	@Description: GEOPOS key member [member ...]
+//	@param db
+//	@param args
+//	@return godis.Reply	每个成员的 [经度, 纬度], 不存在时为 nil
+func execGeoPos(db *DB, args [][]byte) godis.Reply {
+	sortedSet, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	positions := make([]godis.Reply, len(args)-1)
+	for i, member := range args[1:] {
+		positions[i] = protocol.MakeNullMultiBulkReply()
+		if sortedSet == nil {
+			continue
+		}
+		if element, exists := sortedSet.Get(string(member)); exists {
+			positions[i] = protocol.MakeMultiBulkReply(formatCoordinate(element.Score))
+		}
+	}
+	return protocol.MakeMultiRawReply(positions)
+}
+
+// execGeoDist
+//
+//	@Description: GEODIST key member1 member2 [M|KM|FT|MI]
+//	@param db
+//	@param args
+//	@return godis.Reply
+func execGeoDist(db *DB, args [][]byte) godis.Reply {
+	unit := 1.0
+	if len(args) == 4 {
+		var errReply protocol.ErrorReply
+		if unit, errReply = parseGeoUnit(args[3]); errReply != nil {
+			return errReply
+		}
+	} else if len(args) > 4 {
+		return protocol.MakeSyntaxErrReply()
+	}
+	sortedSet, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return protocol.MakeNullBulkReply()
+	}
+	e1, exists1 := sortedSet.Get(string(args[1]))
+	e2, exists2 := sortedSet.Get(string(args[2]))
+	if !exists1 || !exists2 {
+		return protocol.MakeNullBulkReply()
+	}
+	lat1, lng1 := geohash.Decode(uint64(e1.Score))
+	lat2, lng2 := geohash.Decode(uint64(e2.Score))
+	return protocol.MakeBulkReply(formatDistance(geohash.Distance(lat1, lng1, lat2, lng2), unit))
+}
+
+// execGeoHash
+//
+//	@Description: GEOHASH key member [member ...]
+//	@param db
+//	@param args
+//	@return godis.Reply	标准的 11 位 base32 geohash
+func execGeoHash(db *DB, args [][]byte) godis.Reply {
+	sortedSet, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	hashes := make([][]byte, len(args)-1)
+	for i, member := range args[1:] {
+		if sortedSet == nil {
+			continue
+		}
+		if element, exists := sortedSet.Get(string(member)); exists {
+			lat, lng := geohash.Decode(uint64(element.Score))
+			hashes[i] = []byte(geohash.ToBase32(lat, lng))
+		}
+	}
+	return protocol.MakeMultiBulkReply(hashes)
+}
+
+/* ---- search ---- */
+
+const (
+	geoSearchMode = iota
+	geoSearchStoreMode
+	geoRadiusMode
+	geoRadiusROMode
+)
+
+// geoSearchOptions is the arguments of GEOSEARCH, GEOSEARCHSTORE and GEORADIUS
+type geoSearchOptions struct {
+	fromMember string
+	hasMember  bool
+	lat        float64
+	lng        float64
+	hasCenter  bool
+	byRadius   bool
+	radius     float64
+	width      float64
+	height     float64
+	hasShape   bool
+	// unit is meters per unit of distance
+	unit float64
+	// sort is 1 for ASC, -1 for DESC and 0 for unsorted
+	sort      int
+	count     int
+	any       bool
+	withCoord bool
+	withDist  bool
+	withHash  bool
+	storeKey  string
+	storeDist bool
+}
+
+type geoResult struct {
+	member string
+	score  float64
+	dist   float64
+}
+
+// parseGeoSearchOptions
+//
+//	@Description: 解析 GEOSEARCH 的 FROMMEMBER|FROMLONLAT BYRADIUS|BYBOX 等参数, 以及 GEORADIUS 的 STORE|STOREDIST 参数
+//	@param args
+//	@param mode
+//	@param opts
+//	@return protocol.ErrorReply
+func parseGeoSearchOptions(args [][]byte, mode int, opts *geoSearchOptions) protocol.ErrorReply {
+	isSearch := mode == geoSearchMode || mode == geoSearchStoreMode
+	for i := 0; i < len(args); i++ {
+		arg := strings.ToUpper(string(args[i]))
+		// number of arguments following the option
+		var n int
+		switch arg {
+		case "FROMMEMBER", "COUNT", "STORE", "STOREDIST":
+			n = 1
+		case "FROMLONLAT":
+			n = 2
+		case "BYRADIUS":
+			n = 2
+		case "BYBOX":
+			n = 3
+		}
+		if arg == "STOREDIST" && mode == geoSearchStoreMode {
+			n = 0
+		}
+		if i+n >= len(args) {
+			return protocol.MakeSyntaxErrReply()
+		}
+		var errReply protocol.ErrorReply
+		switch {
+		case arg == "FROMMEMBER" && isSearch:
+			if opts.hasCenter {
+				return protocol.MakeErrReply("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for GEOSEARCH")
+			}
+			opts.fromMember, opts.hasMember, opts.hasCenter = string(args[i+1]), true, true
+		case arg == "FROMLONLAT" && isSearch:
+			if opts.hasCenter {
+				return protocol.MakeErrReply("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for GEOSEARCH")
+			}
+			if opts.lat, opts.lng, errReply = parseCoordinate(args[i+1], args[i+2]); errReply != nil {
+				return errReply
+			}
+			opts.hasCenter = true
+		case (arg == "BYRADIUS" || arg == "BYBOX") && isSearch:
+			if opts.hasShape {
+				return protocol.MakeErrReply("ERR exactly one of BYRADIUS and BYBOX can be specified for GEOSEARCH")
+			}
+			if arg == "BYRADIUS" {
+				errReply = parseGeoRadius(args[i+1:i+3], opts)
+			} else {
+				errReply = parseGeoBox(args[i+1:i+4], opts)
+			}
+			if errReply != nil {
+				return errReply
+			}
+			opts.hasShape = true
+		case arg == "ASC":
+			opts.sort = 1
+		case arg == "DESC":
+			opts.sort = -1
+		case arg == "COUNT":
+			count, err := strconv.Atoi(string(args[i+1]))
+			if err != nil {
+				return protocol.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			if count <= 0 {
+				return protocol.MakeErrReply("ERR COUNT must be > 0")
+			}
+			opts.count = count
+			if i+2 < len(args) && strings.ToUpper(string(args[i+2])) == "ANY" {
+				opts.any = true
+				i++
+			}
+		case arg == "WITHCOORD":
+			opts.withCoord = true
+		case arg == "WITHDIST":
+			opts.withDist = true
+		case arg == "WITHHASH":
+			opts.withHash = true
+		case arg == "STOREDIST" && mode == geoSearchStoreMode:
+			opts.storeDist = true
+		case (arg == "STORE" || arg == "STOREDIST") && mode == geoRadiusMode:
+			opts.storeKey = string(args[i+1])
+			opts.storeDist = arg == "STOREDIST"
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+		i += n
+	}
+	if isSearch && !opts.hasCenter {
+		return protocol.MakeErrReply("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for GEOSEARCH")
+	}
+	if isSearch && !opts.hasShape {
+		return protocol.MakeErrReply("ERR exactly one of BYRADIUS and BYBOX can be specified for GEOSEARCH")
+	}
+	if (mode == geoSearchStoreMode || opts.storeKey != "") && (opts.withCoord || opts.withDist || opts.withHash) {
+		return protocol.MakeErrReply("ERR STORE option in GEORADIUS is not compatible with WITHDIST, WITHHASH and WITHCOORD options")
+	}
+	return nil
+}
+
+// parseGeoRadius parses radius unit
+func parseGeoRadius(args [][]byte, opts *geoSearchOptions) protocol.ErrorReply {
+	radius, err := strconv.ParseFloat(string(args[0]), 64)
+	if err != nil {
+		return protocol.MakeErrReply("ERR need numeric radius")
+	}
+	if radius < 0 {
+		return protocol.MakeErrReply("ERR radius cannot be negative")
+	}
+	unit, errReply := parseGeoUnit(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	opts.byRadius, opts.radius, opts.unit = true, radius*unit, unit
+	return nil
+}
+
+// parseGeoBox parses width height unit
+func parseGeoBox(args [][]byte, opts *geoSearchOptions) protocol.ErrorReply {
+	width, err1 := strconv.ParseFloat(string(args[0]), 64)
+	height, err2 := strconv.ParseFloat(string(args[1]), 64)
+	if err1 != nil || err2 != nil {
+		return protocol.MakeErrReply("ERR need numeric width and height")
+	}
+	if width < 0 || height < 0 {
+		return protocol.MakeErrReply("ERR height or width cannot be negative")
+	}
+	unit, errReply := parseGeoUnit(args[2])
+	if errReply != nil {
+		return errReply
+	}
+	opts.width, opts.height, opts.unit = width*unit, height*unit, unit
+	return nil
+}
+
+// geoSearch finds members within the shape around center
+//
+//	@Description: 先根据 geohash 找出覆盖搜索范围的 score 区间, 再逐个计算距离过滤
+//	@receiver db
+//	@param key
+//	@param opts
+//	@return []*geoResult
+//	@return protocol.ErrorReply
+func (db *DB) geoSearch(key string, opts *geoSearchOptions) ([]*geoResult, protocol.ErrorReply) {
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if sortedSet == nil {
+		return nil, nil
+	}
+	if opts.hasMember {
+		element, exists := sortedSet.Get(opts.fromMember)
+		if !exists {
+			return nil, protocol.MakeErrReply("ERR could not decode requested zset member")
+		}
+		opts.lat, opts.lng = geohash.Decode(uint64(element.Score))
+	}
+	radius := opts.radius
+	if !opts.byRadius {
+		radius = math.Sqrt(opts.width*opts.width+opts.height*opts.height) / 2
+	}
+	var results []*geoResult
+	full := func() bool {
+		return opts.any && len(results) >= opts.count
+	}
+	for _, scoreRange := range geohash.Ranges(opts.lat, opts.lng, radius) {
+		min := &SortedSet.ScoreBorder{Value: float64(scoreRange[0])}
+		max := &SortedSet.ScoreBorder{Value: float64(scoreRange[1]), Exclude: true}
+		sortedSet.ForEach(min, max, 0, -1, false, func(element *SortedSet.Element) bool {
+			lat, lng := geohash.Decode(uint64(element.Score))
+			var dist float64
+			if opts.byRadius {
+				if dist = geohash.Distance(opts.lat, opts.lng, lat, lng); dist > opts.radius {
+					return true
+				}
+			} else {
+				if geohash.LatDistance(opts.lat, lat) > opts.height/2 ||
+					geohash.Distance(lat, opts.lng, lat, lng) > opts.width/2 {
+					return true
+				}
+				dist = geohash.Distance(opts.lat, opts.lng, lat, lng)
+			}
+			results = append(results, &geoResult{
+				member: element.Member,
+				score:  element.Score,
+				dist:   dist,
+			})
+			return !full()
+		})
+		if full() {
+			break
+		}
+	}
+	// COUNT without ANY returns the nearest members
+	if opts.sort == 0 && opts.count > 0 && !opts.any {
+		opts.sort = 1
+	}
+	if opts.sort != 0 {
+		sort.SliceStable(results, func(i, j int) bool {
+			if opts.sort > 0 {
+				return results[i].dist < results[j].dist
+			}
+			return results[i].dist > results[j].dist
+		})
+	}
+	if opts.count > 0 && len(results) > opts.count {
+		results = results[:opts.count]
+	}
+	return results, nil
+}
+
+func makeGeoSearchReply(results []*geoResult, opts *geoSearchOptions) godis.Reply {
+	if !opts.withDist && !opts.withHash && !opts.withCoord {
+		members := make([][]byte, len(results))
+		for i, result := range results {
+			members[i] = []byte(result.member)
+		}
+		return protocol.MakeMultiBulkReply(members)
+	}
+	replies := make([]godis.Reply, len(results))
+	for i, result := range results {
+		item := []godis.Reply{protocol.MakeBulkReply([]byte(result.member))}
+		if opts.withDist {
+			item = append(item, protocol.MakeBulkReply(formatDistance(result.dist, opts.unit)))
+		}
+		if opts.withHash {
+			item = append(item, protocol.MakeIntReply(int64(result.score)))
+		}
+		if opts.withCoord {
+			item = append(item, protocol.MakeMultiBulkReply(formatCoordinate(result.score)))
+		}
+		replies[i] = protocol.MakeMultiRawReply(item)
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// storeGeoResults saves results as sorted set, score is geohash or distance if STOREDIST is set
+// event is the keyspace event of dest, geosearchstore or georadiusstore
+func (db *DB) storeGeoResults(dest string, results []*geoResult, opts *geoSearchOptions, event string) int {
+	if len(results) == 0 {
+		db.removeAndNotify(dest)
+		return 0
+	}
+	db.Remove(dest) // clean ttl
+	sortedSet := SortedSet.Make()
+	for _, result := range results {
+		score := result.score
+		if opts.storeDist {
+			score = result.dist / opts.unit
+		}
+		sortedSet.Add(result.member, score)
+	}
+	db.PutEntity(dest, &database.DataEntity{
+		Data: sortedSet,
+	})
+	db.notifyKeyspaceEvent(notifyZSet, event, dest)
+	return len(results)
+}
+
+// execGeoSearch
+//
+//	@Description: GEOSEARCH key FROMMEMBER member|FROMLONLAT longitude latitude BYRADIUS radius unit|BYBOX width height unit
+//	[ASC|DESC] [COUNT count [ANY]] [WITHCOORD] [WITHDIST] [WITHHASH]
+//	@param db
+//	@param args
+//	@return godis.Reply
+func execGeoSearch(db *DB, args [][]byte) godis.Reply {
+	opts := &geoSearchOptions{}
+	if errReply := parseGeoSearchOptions(args[1:], geoSearchMode, opts); errReply != nil {
+		return errReply
+	}
+	results, errReply := db.geoSearch(string(args[0]), opts)
+	if errReply != nil {
+		return errReply
+	}
+	return makeGeoSearchReply(results, opts)
+}
+
+func prepareGeoSearchStore(args [][]byte) ([]string, []string) {
+	return []string{string(args[0])}, []string{string(args[1])}
+}
+
+// execGeoSearchStore
+//
+//	@Description: GEOSEARCHSTORE destination source FROMMEMBER member|FROMLONLAT longitude latitude
+//	BYRADIUS radius unit|BYBOX width height unit [ASC|DESC] [COUNT count [ANY]] [STOREDIST]
+//	@param db
+//	@param args
+//	@return godis.Reply	保存的成员数
+func execGeoSearchStore(db *DB, args [][]byte) godis.Reply {
+	opts := &geoSearchOptions{}
+	if errReply := parseGeoSearchOptions(args[2:], geoSearchStoreMode, opts); errReply != nil {
+		return errReply
+	}
+	results, errReply := db.geoSearch(string(args[1]), opts)
+	if errReply != nil {
+		return errReply
+	}
+	count := db.storeGeoResults(string(args[0]), results, opts, "geosearchstore")
+	db.addAof(utils.ToCmdLine3("geosearchstore", args...))
+	return protocol.MakeIntReply(int64(count))
+}
+
+// parseGeoRadiusArgs parses GEORADIUS key longitude latitude radius unit [options]
+// or GEORADIUSBYMEMBER key member radius unit [options]
+func parseGeoRadiusArgs(args [][]byte, byMember bool, mode int) (*geoSearchOptions, protocol.ErrorReply) {
+	opts := &geoSearchOptions{byRadius: true}
+	if byMember {
+		opts.fromMember, opts.hasMember = string(args[1]), true
+		args = args[2:]
+	} else {
+		var errReply protocol.ErrorReply
+		if opts.lat, opts.lng, errReply = parseCoordinate(args[1], args[2]); errReply != nil {
+			return nil, errReply
+		}
+		args = args[3:]
+	}
+	if errReply := parseGeoRadius(args[:2], opts); errReply != nil {
+		return nil, errReply
+	}
+	if errReply := parseGeoSearchOptions(args[2:], mode, opts); errReply != nil {
+		return nil, errReply
+	}
+	return opts, nil
+}
+
+// geoRadiusStoreKey returns the key of STORE or STOREDIST option of GEORADIUS and GEORADIUSBYMEMBER
+func geoRadiusStoreKey(args [][]byte) string {
+	for i := len(args) - 2; i > 0; i-- {
+		option := strings.ToUpper(string(args[i]))
+		if option == "STORE" || option == "STOREDIST" {
+			return string(args[i+1])
+		}
+	}
+	return ""
+}
+
+func prepareGeoRadius(args [][]byte) ([]string, []string) {
+	if dest := geoRadiusStoreKey(args); dest != "" {
+		return []string{dest}, []string{string(args[0])}
+	}
+	return nil, []string{string(args[0])}
+}
+
+func undoGeoRadius(db *DB, args [][]byte) []CmdLine {
+	if dest := geoRadiusStoreKey(args); dest != "" {
+		return rollbackGivenKeys(db, dest)
+	}
+	return nil
+}
+
+func geoRadius(db *DB, cmdName string, args [][]byte, byMember bool, mode int) godis.Reply {
+	opts, errReply := parseGeoRadiusArgs(args, byMember, mode)
+	if errReply != nil {
+		return errReply
+	}
+	results, errReply := db.geoSearch(string(args[0]), opts)
+	if errReply != nil {
+		return errReply
+	}
+	if opts.storeKey == "" {
+		return makeGeoSearchReply(results, opts)
+	}
+	count := db.storeGeoResults(opts.storeKey, results, opts, "georadiusstore")
+	db.addAof(utils.ToCmdLine3(cmdName, args...))
+	return protocol.MakeIntReply(int64(count))
+}
+
+// execGeoRadius
+//
+//	@Description: GEORADIUS key longitude latitude radius M|KM|FT|MI [WITHCOORD] [WITHDIST] [WITHHASH]
+//	[COUNT count [ANY]] [ASC|DESC] [STORE key|STOREDIST key]
+//	@param db
+//	@param args
+//	@return godis.Reply
+func execGeoRadius(db *DB, args [][]byte) godis.Reply {
+	return geoRadius(db, "georadius", args, false, geoRadiusMode)
+}
+
+// execGeoRadiusRO
+//
+//	@Description: GEORADIUS_RO key longitude latitude radius M|KM|FT|MI [WITHCOORD] [WITHDIST] [WITHHASH]
+//	[COUNT count [ANY]] [ASC|DESC]
+//	@param db
+//	@param args
+//	@return godis.Reply
+func execGeoRadiusRO(db *DB, args [][]byte) godis.Reply {
+	return geoRadius(db, "georadius_ro", args, false, geoRadiusROMode)
+}
+
+// execGeoRadiusByMember
+//
+//	@Description: GEORADIUSBYMEMBER key member radius M|KM|FT|MI [WITHCOORD] [WITHDIST] [WITHHASH]
+//	[COUNT count [ANY]] [ASC|DESC] [STORE key|STOREDIST key]
+//	@param db
+//	@param args
+//	@return godis.Reply
+func execGeoRadiusByMember(db *DB, args [][]byte) godis.Reply {
+	return geoRadius(db, "georadiusbymember", args, true, geoRadiusMode)
+}
+
+// execGeoRadiusByMemberRO
+//
+//	@Description: GEORADIUSBYMEMBER_RO key member radius M|KM|FT|MI [WITHCOORD] [WITHDIST] [WITHHASH]
+//	[COUNT count [ANY]] [ASC|DESC]
+//	@param db
+//	@param args
+//	@return godis.Reply
+func execGeoRadiusByMemberRO(db *DB, args [][]byte) godis.Reply {
+	return geoRadius(db, "georadiusbymember_ro", args, true, geoRadiusROMode)
+}
@@ -0,0 +1,162 @@
+package database
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/11
+  @desc: geo commands
+  @modified by:
+**/
+
+import (
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/godis/protocol/asserts"
+	"github.com/Allen9012/Godis/interface/godis"
+	"github.com/Allen9012/Godis/lib/utils"
+	"strconv"
+	"testing"
+)
+
+func addSicily(key string) {
+	testDB.Exec(nil, utils.ToCmdLine("geoadd", key,
+		"13.361389", "38.115556", "Palermo",
+		"15.087269", "37.502669", "Catania"))
+}
+
+// assertGeoDist asserts reply of WITHDIST is [[member, dist]...]
+func assertGeoDist(t *testing.T, actual godis.Reply, expected ...string) {
+	t.Helper()
+	reply, ok := actual.(*protocol.MultiRawReply)
+	if !ok || len(reply.Replies)*2 != len(expected) {
+		t.Fatalf("wrong reply %s", actual.ToBytes())
+	}
+	for i, item := range reply.Replies {
+		fields := item.(*protocol.MultiRawReply).Replies
+		asserts.AssertBulkReply(t, fields[0], expected[2*i])
+		asserts.AssertBulkReply(t, fields[1], expected[2*i+1])
+	}
+}
+
+func TestGeoAdd(t *testing.T) {
+	testDB.Flush()
+	key := utils.RandString(10)
+	result := testDB.Exec(nil, utils.ToCmdLine("geoadd", key, "13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania"))
+	asserts.AssertIntReply(t, result, 2)
+	result = testDB.Exec(nil, utils.ToCmdLine("zscore", key, "Palermo"))
+	asserts.AssertBulkReply(t, result, "3479099956230698")
+	result = testDB.Exec(nil, utils.ToCmdLine("geoadd", key, "NX", "CH", "15", "37", "Catania"))
+	asserts.AssertIntReply(t, result, 0)
+	result = testDB.Exec(nil, utils.ToCmdLine("geoadd", key, "XX", "15", "37", "Catania", "15", "37", "Agrigento"))
+	asserts.AssertIntReply(t, result, 0)
+	result = testDB.Exec(nil, utils.ToCmdLine("zcard", key))
+	asserts.AssertIntReply(t, result, 2)
+	result = testDB.Exec(nil, utils.ToCmdLine("geoadd", key, "CH", "15.087269", "37.502669", "Catania", "13.5833", "37.3167", "Agrigento"))
+	asserts.AssertIntReply(t, result, 2)
+	result = testDB.Exec(nil, utils.ToCmdLine("geoadd", key, "NX", "XX", "15", "37", "Catania"))
+	asserts.AssertErrReply(t, result, "ERR XX and NX options at the same time are not compatible")
+	result = testDB.Exec(nil, utils.ToCmdLine("geoadd", key, "15", "86", "Pole"))
+	asserts.AssertErrReply(t, result, "ERR invalid longitude,latitude pair 15.000000,86.000000")
+	result = testDB.Exec(nil, utils.ToCmdLine("geoadd", key, "15", "37"))
+	asserts.AssertErrReply(t, result, "ERR wrong number of arguments for 'geoadd' command")
+
+	// ZSET commands work on geo set
+	result = testDB.Exec(nil, utils.ToCmdLine("zrem", key, "Agrigento"))
+	asserts.AssertIntReply(t, result, 1)
+	result = testDB.Exec(nil, utils.ToCmdLine("zrange", key, "0", "-1"))
+	asserts.AssertMultiBulkReply(t, result, []string{"Palermo", "Catania"})
+}
+
+func TestGeoPosAndDist(t *testing.T) {
+	testDB.Flush()
+	key := utils.RandString(10)
+	addSicily(key)
+	result := testDB.Exec(nil, utils.ToCmdLine("geopos", key, "Palermo", "NonExisting"))
+	positions := result.(*protocol.MultiRawReply).Replies
+	coordinate := positions[0].(*protocol.MultiBulkReply).Args
+	lng, _ := strconv.ParseFloat(string(coordinate[0]), 64)
+	lat, _ := strconv.ParseFloat(string(coordinate[1]), 64)
+	if lng < 13.36138 || lng > 13.36139 || lat < 38.11555 || lat > 38.11556 {
+		t.Errorf("wrong position %f %f", lng, lat)
+	}
+	if _, ok := positions[1].(*protocol.NullMultiBulkReply); !ok {
+		t.Errorf("expect nil position, actually %s", positions[1].ToBytes())
+	}
+
+	result = testDB.Exec(nil, utils.ToCmdLine("geodist", key, "Palermo", "Catania"))
+	asserts.AssertBulkReply(t, result, "166274.1516")
+	result = testDB.Exec(nil, utils.ToCmdLine("geodist", key, "Palermo", "Catania", "km"))
+	asserts.AssertBulkReply(t, result, "166.2742")
+	result = testDB.Exec(nil, utils.ToCmdLine("geodist", key, "Palermo", "Catania", "mi"))
+	asserts.AssertBulkReply(t, result, "103.3182")
+	result = testDB.Exec(nil, utils.ToCmdLine("geodist", key, "Palermo", "NonExisting"))
+	asserts.AssertNullBulk(t, result)
+	result = testDB.Exec(nil, utils.ToCmdLine("geodist", key, "Palermo", "Catania", "yard"))
+	asserts.AssertErrReply(t, result, "ERR unsupported unit provided. please use M, KM, FT, MI")
+
+	result = testDB.Exec(nil, utils.ToCmdLine("geohash", key, "Palermo", "Catania"))
+	asserts.AssertMultiBulkReply(t, result, []string{"sqc8b49rny0", "sqdtr74hyu0"})
+}
+
+func TestGeoSearch(t *testing.T) {
+	testDB.Flush()
+	key := utils.RandString(10)
+	addSicily(key)
+	testDB.Exec(nil, utils.ToCmdLine("geoadd", key, "12.758489", "38.788135", "edge1", "17.241510", "38.788135", "edge2"))
+
+	result := testDB.Exec(nil, utils.ToCmdLine("geosearch", key, "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "ASC"))
+	asserts.AssertMultiBulkReply(t, result, []string{"Catania", "Palermo"})
+	result = testDB.Exec(nil, utils.ToCmdLine("geosearch", key, "FROMLONLAT", "15", "37", "BYBOX", "400", "400", "km", "ASC", "WITHDIST"))
+	assertGeoDist(t, result, "Catania", "56.4413", "Palermo", "190.4424", "edge2", "279.7403", "edge1", "279.7405")
+	result = testDB.Exec(nil, utils.ToCmdLine("geosearch", key, "FROMMEMBER", "Palermo", "BYRADIUS", "200", "km", "DESC", "COUNT", "1"))
+	asserts.AssertMultiBulkReply(t, result, []string{"Catania"})
+	result = testDB.Exec(nil, utils.ToCmdLine("geosearch", key, "FROMLONLAT", "15", "37", "BYRADIUS", "1000", "km", "COUNT", "3", "ANY"))
+	asserts.AssertMultiBulkReplySize(t, result, 3)
+	result = testDB.Exec(nil, utils.ToCmdLine("geosearch", key, "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "WITHCOORD", "WITHHASH", "COUNT", "1"))
+	item := result.(*protocol.MultiRawReply).Replies[0].(*protocol.MultiRawReply)
+	asserts.AssertBulkReply(t, item.Replies[0], "Catania")
+	asserts.AssertIntReply(t, item.Replies[1], 3479447370796909)
+	asserts.AssertMultiBulkReplySize(t, item.Replies[2], 2)
+
+	result = testDB.Exec(nil, utils.ToCmdLine("geosearch", key, "FROMMEMBER", "NonExisting", "BYRADIUS", "200", "km"))
+	asserts.AssertErrReply(t, result, "ERR could not decode requested zset member")
+	result = testDB.Exec(nil, utils.ToCmdLine("geosearch", key, "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "ANY"))
+	asserts.AssertErrReply(t, result, "Err syntax error")
+	result = testDB.Exec(nil, utils.ToCmdLine("geosearch", key, "BYRADIUS", "200", "km", "BYBOX", "1", "1", "km"))
+	asserts.AssertErrReply(t, result, "ERR exactly one of BYRADIUS and BYBOX can be specified for GEOSEARCH")
+	result = testDB.Exec(nil, utils.ToCmdLine("geosearch", utils.RandString(10), "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km"))
+	asserts.AssertMultiBulkReplySize(t, result, 0)
+
+	dest := utils.RandString(10)
+	result = testDB.Exec(nil, utils.ToCmdLine("geosearchstore", dest, key, "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "STOREDIST"))
+	asserts.AssertIntReply(t, result, 2)
+	result = testDB.Exec(nil, utils.ToCmdLine("zrange", dest, "0", "-1"))
+	asserts.AssertMultiBulkReply(t, result, []string{"Catania", "Palermo"})
+	result = testDB.Exec(nil, utils.ToCmdLine("geosearchstore", dest, key, "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "WITHDIST"))
+	asserts.AssertErrReply(t, result, "ERR STORE option in GEORADIUS is not compatible with WITHDIST, WITHHASH and WITHCOORD options")
+}
+
+func TestGeoRadius(t *testing.T) {
+	testDB.Flush()
+	key := utils.RandString(10)
+	addSicily(key)
+	result := testDB.Exec(nil, utils.ToCmdLine("georadius", key, "15", "37", "200", "km", "WITHDIST", "ASC"))
+	assertGeoDist(t, result, "Catania", "56.4413", "Palermo", "190.4424")
+	result = testDB.Exec(nil, utils.ToCmdLine("georadius_ro", key, "15", "37", "100", "km"))
+	asserts.AssertMultiBulkReply(t, result, []string{"Catania"})
+	result = testDB.Exec(nil, utils.ToCmdLine("georadiusbymember", key, "Palermo", "200", "km", "WITHDIST", "ASC"))
+	assertGeoDist(t, result, "Palermo", "0.0000", "Catania", "166.2742")
+
+	dest := utils.RandString(10)
+	result = testDB.Exec(nil, utils.ToCmdLine("georadius", key, "15", "37", "200", "km", "STORE", dest))
+	asserts.AssertIntReply(t, result, 2)
+	result = testDB.Exec(nil, utils.ToCmdLine("geodist", dest, "Palermo", "Catania", "km"))
+	asserts.AssertBulkReply(t, result, "166.2742")
+	result = testDB.Exec(nil, utils.ToCmdLine("georadius_ro", key, "15", "37", "200", "km", "STORE", dest))
+	asserts.AssertErrReply(t, result, "Err syntax error")
+
+	// STOREDIST saves distance in unit as score
+	result = testDB.Exec(nil, utils.ToCmdLine("georadiusbymember", key, "Palermo", "1", "km", "STOREDIST", dest))
+	asserts.AssertIntReply(t, result, 1)
+	result = testDB.Exec(nil, utils.ToCmdLine("zscore", dest, "Palermo"))
+	asserts.AssertBulkReply(t, result, "0")
+}
@@ -39,22 +39,55 @@ func (db *DB) getOrInitDict(key string) (dict Dict.Dict, inited bool, errReply p
 }
 
 func init() {
-	registerCommand("HSet", execHSet, 4, flagWrite)
-	registerCommand("HSetNX", execHSetNX, 4, flagWrite)
-	registerCommand("HGet", execHGet, 3, flagReadOnly)
-	registerCommand("HExists", execHExists, 3, flagReadOnly)
-	registerCommand("HDel", execHDel, -3, flagWrite)
-	registerCommand("HLen", execHLen, 2, flagReadOnly)
-	registerCommand("HStrlen", execHStrlen, 3, flagReadOnly)
-	registerCommand("HMSet", execHMSet, -4, flagWrite)
-	registerCommand("HMGet", execHMGet, -3, flagReadOnly)
-	registerCommand("HGet", execHGet, -3, flagReadOnly)
-	registerCommand("HKeys", execHKeys, 2, flagReadOnly)
-	registerCommand("HVals", execHVals, 2, flagReadOnly)
-	registerCommand("HGetAll", execHGetAll, 2, flagReadOnly)
-	registerCommand("HIncrBy", execHIncrBy, 4, flagWrite)
-	registerCommand("HIncrByFloat", execHIncrByFloat, 4, flagWrite)
-	registerCommand("HRandField", execHRandField, -2, flagReadOnly)
+	registerCommand("HSet", execHSet, writeFirstKey, undoHSet, 4, flagWrite)
+	registerCommand("HSetNX", execHSetNX, writeFirstKey, undoHSet, 4, flagWrite)
+	registerCommand("HGet", execHGet, readFirstKey, nil, 3, flagReadOnly)
+	registerCommand("HExists", execHExists, readFirstKey, nil, 3, flagReadOnly)
+	registerCommand("HDel", execHDel, writeFirstKey, undoHDel, -3, flagWrite)
+	registerCommand("HLen", execHLen, readFirstKey, nil, 2, flagReadOnly)
+	registerCommand("HStrlen", execHStrlen, readFirstKey, nil, 3, flagReadOnly)
+	registerCommand("HMSet", execHMSet, writeFirstKey, undoHMSet, -4, flagWrite)
+	registerCommand("HMGet", execHMGet, readFirstKey, nil, -3, flagReadOnly)
+	registerCommand("HGet", execHGet, readFirstKey, nil, -3, flagReadOnly)
+	registerCommand("HKeys", execHKeys, readFirstKey, nil, 2, flagReadOnly)
+	registerCommand("HVals", execHVals, readFirstKey, nil, 2, flagReadOnly)
+	registerCommand("HGetAll", execHGetAll, readFirstKey, nil, 2, flagReadOnly)
+	registerCommand("HIncrBy", execHIncrBy, writeFirstKey, undoHIncr, 4, flagWrite)
+	registerCommand("HIncrByFloat", execHIncrByFloat, writeFirstKey, undoHIncr, 4, flagWrite)
+	registerCommand("HRandField", execHRandField, readFirstKey, nil, -2, flagReadOnly)
+	registerCommand("HScan", execHScan, readFirstKey, nil, -3, flagReadOnly)
+}
+
+func undoHSet(db *DB, args [][]byte) []CmdLine {
+	key := string(args[0])
+	field := string(args[1])
+	return rollbackHashFields(db, key, field)
+}
+
+func undoHDel(db *DB, args [][]byte) []CmdLine {
+	key := string(args[0])
+	fields := make([]string, len(args)-1)
+	fieldArgs := args[1:]
+	for i, v := range fieldArgs {
+		fields[i] = string(v)
+	}
+	return rollbackHashFields(db, key, fields...)
+}
+
+func undoHMSet(db *DB, args [][]byte) []CmdLine {
+	key := string(args[0])
+	size := (len(args) - 1) / 2
+	fields := make([]string, size)
+	for i := 0; i < size; i++ {
+		fields[i] = string(args[2*i+1])
+	}
+	return rollbackHashFields(db, key, fields...)
+}
+
+func undoHIncr(db *DB, args [][]byte) []CmdLine {
+	key := string(args[0])
+	field := string(args[1])
+	return rollbackHashFields(db, key, field)
 }
 
 // execHRandField implements HRANDFIELD key [count]
@@ -165,6 +198,7 @@ func execHIncrByFloat(db *DB, args [][]byte) godis.Reply {
 	value, exists := dict.Get(field)
 	if !exists {
 		dict.Put(field, args[2])
+		db.notifyKeyspaceEvent(notifyHash, "hincrbyfloat", key)
 		return protocol.MakeBulkReply(args[2])
 	}
 	val, err := strconv.ParseFloat(string(value.([]byte)), 64)
@@ -175,6 +209,7 @@ func execHIncrByFloat(db *DB, args [][]byte) godis.Reply {
 	resultBytes := []byte(strconv.FormatFloat(result, 'f', -1, 64))
 	dict.Put(field, resultBytes)
 	db.addAof(utils.ToCmdLine3("hincrbyfloat", args...))
+	db.notifyKeyspaceEvent(notifyHash, "hincrbyfloat", key)
 	return protocol.MakeBulkReply(resultBytes)
 }
 
@@ -205,6 +240,7 @@ func execHIncrBy(db *DB, args [][]byte) godis.Reply {
 	if !exists {
 		dict.Put(field, args[2])
 		db.addAof(utils.ToCmdLine3("hincrby", args...))
+		db.notifyKeyspaceEvent(notifyHash, "hincrby", key)
 		return protocol.MakeBulkReply(args[2])
 	}
 	val, err := strconv.ParseInt(string(value.([]byte)), 10, 64)
@@ -215,6 +251,7 @@ func execHIncrBy(db *DB, args [][]byte) godis.Reply {
 	bytes := []byte(strconv.FormatInt(val, 10))
 	dict.Put(field, bytes)
 	db.addAof(utils.ToCmdLine3("hincrby", args...))
+	db.notifyKeyspaceEvent(notifyHash, "hincrby", key)
 	return protocol.MakeBulkReply(bytes)
 }
 
@@ -382,6 +419,7 @@ func execHMSet(db *DB, args [][]byte) godis.Reply {
 		dict.Put(field, value)
 	}
 	db.addAof(utils.ToCmdLine3("hmset", args...))
+	db.notifyKeyspaceEvent(notifyHash, "hset", key)
 	return protocol.MakeOkReply()
 }
 
@@ -466,12 +504,14 @@ func execHDel(db *DB, args [][]byte) godis.Reply {
 		_, result := dict.Remove(field)
 		deleted += result
 	}
+	if deleted > 0 {
+		db.addAof(utils.ToCmdLine3("hdel", args...))
+		db.notifyKeyspaceEvent(notifyHash, "hdel", key)
+	}
 	// 删除完了这个map就删除整个key
 	if dict.Len() == 0 {
 		db.Remove(key)
-	}
-	if deleted > 0 {
-		db.addAof(utils.ToCmdLine3("hdel", args...))
+		db.notifyKeyspaceEvent(notifyGeneric, "del", key)
 	}
 
 	return protocol.MakeIntReply(int64(deleted))
@@ -553,6 +593,7 @@ func execHSetNX(db *DB, args [][]byte) godis.Reply {
 	result := dict.PutIfAbsent(field, value)
 	if result > 0 {
 		db.addAof(utils.ToCmdLine3("hsetnx", args...))
+		db.notifyKeyspaceEvent(notifyHash, "hset", key)
 	}
 	return protocol.MakeIntReply(int64(result))
 }
@@ -577,5 +618,38 @@ func execHSet(db *DB, args [][]byte) godis.Reply {
 
 	result := dict.Put(field, value)
 	db.addAof(utils.ToCmdLine3("hset", args...))
+	db.notifyKeyspaceEvent(notifyHash, "hset", key)
 	return protocol.MakeIntReply(int64(result))
 }
+
+// execHScan iterates fields and values of hash by cursor
+//
+//	@Description: HSCAN key cursor [MATCH pattern] [COUNT count]
+//	@param db
+//	@param args
+//	@return godis.Reply
+func execHScan(db *DB, args [][]byte) godis.Reply {
+	key := string(args[0])
+	opts, errReply := parseScanArgs(args[1:], false)
+	if errReply != nil {
+		return errReply
+	}
+	dict, errReply := db.getAsDict(key)
+	if errReply != nil {
+		return errReply
+	}
+	if dict == nil {
+		return makeScanReply(0, nil)
+	}
+	fields, next := dict.Scan(opts.cursor, opts.count, opts.pattern)
+	result := make([][]byte, 0, len(fields)*2)
+	for _, field := range fields {
+		val, exists := dict.Get(field)
+		if !exists {
+			continue
+		}
+		value, _ := val.([]byte)
+		result = append(result, []byte(field), value)
+	}
+	return makeScanReply(next, result)
+}
@@ -0,0 +1,203 @@
+package database
+
+import (
+	"github.com/Allen9012/Godis/datastruct/hyperloglog"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/interface/database"
+	"github.com/Allen9012/Godis/interface/godis"
+	"github.com/Allen9012/Godis/lib/utils"
+	"strings"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/12
+  @desc: HyperLogLog 命令, 以 redis 兼容的 HYLL 字符串存储, GET/SET/STRLEN/APPEND 等字符串命令仍然可用
+	持久化与普通字符串相同, AOF 重写时会生成 SET 命令
+  @modified by:
+**/
+
+func init() {
+	registerCommand("PFAdd", execPFAdd, writeFirstKey, rollbackFirstKey, -2, flagWrite)
+	registerCommand("PFCount", execPFCount, readAllKeys, nil, -2, flagReadOnly)
+	registerCommand("PFMerge", execPFMerge, preparePFMerge, rollbackFirstKey, -2, flagWrite)
+	registerCommand("PFDebug", execPFDebug, preparePFDebug, undoPFDebug, 3, flagWrite)
+}
+
+// getAsHyperLogLog returns nil if key does not exist, and returns error if the value is not a valid hyperloglog
+func (db *DB) getAsHyperLogLog(key string) (*hyperloglog.HyperLogLog, protocol.ErrorReply) {
+	bytes, errReply := db.getAsString(key)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if bytes == nil {
+		return nil, nil
+	}
+	hll, err := hyperloglog.Parse(bytes)
+	if err != nil {
+		return nil, protocol.MakeErrReply(err.Error())
+	}
+	return hll, nil
+}
+
+func (db *DB) putHyperLogLog(key string, hll *hyperloglog.HyperLogLog) {
+	db.PutEntity(key, &database.DataEntity{Data: hll.Bytes()})
+}
+
+// execPFAdd
+//
+//	@Description: PFADD key [element [element ...]]
+//	@param db
+//	@param args
+//	@return godis.Reply	1 表示有寄存器被修改或创建了新的 key, 否则为 0
+func execPFAdd(db *DB, args [][]byte) godis.Reply {
+	key := string(args[0])
+	hll, errReply := db.getAsHyperLogLog(key)
+	if errReply != nil {
+		return errReply
+	}
+	changed := false
+	if hll == nil {
+		hll = hyperloglog.Make()
+		changed = true
+	}
+	for _, element := range args[1:] {
+		if hll.Add(element) {
+			changed = true
+		}
+	}
+	if !changed {
+		return protocol.MakeIntReply(0)
+	}
+	db.putHyperLogLog(key, hll)
+	db.addAof(utils.ToCmdLine3("pfadd", args...))
+	db.notifyKeyspaceEvent(notifyString, "pfadd", key)
+	return protocol.MakeIntReply(1)
+}
+
+// execPFCount
+//
+//	@Description: PFCOUNT key [key ...], 多个 key 时返回并集的基数, 不存在的 key 视为空集
+//	@param db
+//	@param args
+//	@return godis.Reply
+func execPFCount(db *DB, args [][]byte) godis.Reply {
+	if len(args) == 1 {
+		hll, errReply := db.getAsHyperLogLog(string(args[0]))
+		if errReply != nil {
+			return errReply
+		}
+		if hll == nil {
+			return protocol.MakeIntReply(0)
+		}
+		return protocol.MakeIntReply(int64(hll.Count()))
+	}
+	union := hyperloglog.Make()
+	for _, arg := range args {
+		hll, errReply := db.getAsHyperLogLog(string(arg))
+		if errReply != nil {
+			return errReply
+		}
+		if hll != nil {
+			union.Merge(hll)
+		}
+	}
+	return protocol.MakeIntReply(int64(union.Count()))
+}
+
+func preparePFMerge(args [][]byte) ([]string, []string) {
+	readKeys := make([]string, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		readKeys = append(readKeys, string(arg))
+	}
+	return []string{string(args[0])}, readKeys
+}
+
+// execPFMerge
+//
+//	@Description: PFMERGE destkey [sourcekey [sourcekey ...]], destkey 原有的值也参与合并
+//	只要有一个 dense 编码的输入, 结果就是 dense 编码
+//	@param db
+//	@param args
+//	@return godis.Reply
+func execPFMerge(db *DB, args [][]byte) godis.Reply {
+	dest, errReply := db.getAsHyperLogLog(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if dest == nil {
+		dest = hyperloglog.Make()
+	}
+	for _, arg := range args[1:] {
+		hll, errReply := db.getAsHyperLogLog(string(arg))
+		if errReply != nil {
+			return errReply
+		}
+		if hll != nil {
+			dest.Merge(hll)
+		}
+	}
+	db.putHyperLogLog(string(args[0]), dest)
+	db.addAof(utils.ToCmdLine3("pfmerge", args...))
+	db.notifyKeyspaceEvent(notifyString, "pfadd", string(args[0]))
+	return protocol.MakeOkReply()
+}
+
+func preparePFDebug(args [][]byte) ([]string, []string) {
+	return []string{string(args[1])}, nil
+}
+
+func undoPFDebug(db *DB, args [][]byte) []CmdLine {
+	return rollbackGivenKeys(db, string(args[1]))
+}
+
+// execPFDebug
+//
+//	@Description: PFDEBUG GETREG|DECODE|ENCODING|TODENSE key
+//	@param db
+//	@param args
+//	@return godis.Reply
+func execPFDebug(db *DB, args [][]byte) godis.Reply {
+	subCmd := strings.ToLower(string(args[0]))
+	key := string(args[1])
+	hll, errReply := db.getAsHyperLogLog(key)
+	if errReply != nil {
+		return errReply
+	}
+	if hll == nil {
+		return protocol.MakeErrReply("ERR The specified key does not exist")
+	}
+	switch subCmd {
+	case "getreg":
+		registers := hll.Registers()
+		replies := make([]godis.Reply, len(registers))
+		for i, v := range registers {
+			replies[i] = protocol.MakeIntReply(int64(v))
+		}
+		return protocol.MakeMultiRawReply(replies)
+	case "decode":
+		if !hll.IsSparse() {
+			return protocol.MakeErrReply("ERR HLL encoding is not sparse")
+		}
+		bytes, _ := db.getAsString(key)
+		desc, err := hyperloglog.DescribeSparse(bytes)
+		if err != nil {
+			return protocol.MakeErrReply(err.Error())
+		}
+		return protocol.MakeStatusReply(desc)
+	case "encoding":
+		if hll.IsSparse() {
+			return protocol.MakeStatusReply("sparse")
+		}
+		return protocol.MakeStatusReply("dense")
+	case "todense":
+		if !hll.ToDense() {
+			return protocol.MakeIntReply(0)
+		}
+		db.putHyperLogLog(key, hll)
+		db.addAof(utils.ToCmdLine3("pfdebug", args...))
+		return protocol.MakeIntReply(1)
+	}
+	return protocol.MakeErrReply("ERR Unknown PFDEBUG subcommand '" + string(args[0]) + "'")
+}
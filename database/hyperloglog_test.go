@@ -0,0 +1,148 @@
+package database
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/12
+  @desc: hyperloglog commands
+  @modified by:
+**/
+
+import (
+	"github.com/Allen9012/Godis/aof"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/godis/protocol/asserts"
+	"github.com/Allen9012/Godis/interface/godis"
+	"github.com/Allen9012/Godis/lib/utils"
+	"math"
+	"strconv"
+	"testing"
+)
+
+// assertApproxCount asserts the estimated cardinality is within 2% error
+func assertApproxCount(t *testing.T, actual godis.Reply, expected int64) {
+	t.Helper()
+	reply, ok := actual.(*protocol.IntReply)
+	if !ok || math.Abs(float64(reply.Code-expected)) > float64(expected)*0.02 {
+		t.Errorf("expected about %d, actually %s", expected, actual.ToBytes())
+	}
+}
+
+func TestPFAdd(t *testing.T) {
+	testDB.Flush()
+	key := utils.RandString(10)
+	result := testDB.Exec(nil, utils.ToCmdLine("pfadd", key))
+	asserts.AssertIntReply(t, result, 1)
+	result = testDB.Exec(nil, utils.ToCmdLine("pfadd", key))
+	asserts.AssertIntReply(t, result, 0)
+	result = testDB.Exec(nil, utils.ToCmdLine("pfadd", key, "a", "b", "c", "d", "e", "f", "g"))
+	asserts.AssertIntReply(t, result, 1)
+	result = testDB.Exec(nil, utils.ToCmdLine("pfadd", key, "a", "b"))
+	asserts.AssertIntReply(t, result, 0)
+	result = testDB.Exec(nil, utils.ToCmdLine("pfcount", key))
+	asserts.AssertIntReply(t, result, 7)
+
+	// stored as string
+	result = testDB.Exec(nil, utils.ToCmdLine("type", key))
+	asserts.AssertStatusReply(t, result, "string")
+	result = testDB.Exec(nil, utils.ToCmdLine("get", key))
+	value := result.(*protocol.BulkReply).Arg
+	if string(value[:4]) != "HYLL" {
+		t.Errorf("wrong hyperloglog header %q", value[:4])
+	}
+	result = testDB.Exec(nil, utils.ToCmdLine("strlen", key))
+	asserts.AssertIntReply(t, result, len(value))
+
+	// string written by SET is accepted
+	other := utils.RandString(10)
+	testDB.Exec(nil, utils.ToCmdLine("set", other, string(value)))
+	result = testDB.Exec(nil, utils.ToCmdLine("pfcount", other))
+	asserts.AssertIntReply(t, result, 7)
+
+	testDB.Exec(nil, utils.ToCmdLine("set", other, "value"))
+	result = testDB.Exec(nil, utils.ToCmdLine("pfadd", other, "a"))
+	asserts.AssertErrReply(t, result, "WRONGTYPE Key is not a valid HyperLogLog string value.")
+	testDB.Exec(nil, utils.ToCmdLine("append", key, "x"))
+	result = testDB.Exec(nil, utils.ToCmdLine("pfcount", key))
+	asserts.AssertErrReply(t, result, "INVALIDOBJ Corrupted HLL object detected")
+	list := utils.RandString(10)
+	testDB.Exec(nil, utils.ToCmdLine("rpush", list, "a"))
+	result = testDB.Exec(nil, utils.ToCmdLine("pfcount", list))
+	asserts.AssertErrReply(t, result, "WRONGTYPE Operation against a key holding the wrong kind of value")
+}
+
+func TestPFCountAndMerge(t *testing.T) {
+	testDB.Flush()
+	key1 := utils.RandString(10)
+	key2 := utils.RandString(10)
+	for i := 0; i < 100; i++ {
+		testDB.Exec(nil, utils.ToCmdLine("pfadd", key1, strconv.Itoa(i)))
+		testDB.Exec(nil, utils.ToCmdLine("pfadd", key2, strconv.Itoa(i+50)))
+	}
+	result := testDB.Exec(nil, utils.ToCmdLine("pfcount", key1, key2, utils.RandString(10)))
+	assertApproxCount(t, result, 150)
+
+	dest := utils.RandString(10)
+	testDB.Exec(nil, utils.ToCmdLine("pfadd", dest, "x"))
+	result = testDB.Exec(nil, utils.ToCmdLine("pfmerge", dest, key1, key2))
+	asserts.AssertStatusReply(t, result, "OK")
+	result = testDB.Exec(nil, utils.ToCmdLine("pfcount", dest))
+	assertApproxCount(t, result, 151)
+	count := result.(*protocol.IntReply).Code
+	result = testDB.Exec(nil, utils.ToCmdLine("pfdebug", "encoding", dest))
+	asserts.AssertStatusReply(t, result, "sparse")
+
+	// merging dense hyperloglog results in dense
+	result = testDB.Exec(nil, utils.ToCmdLine("pfdebug", "todense", key1))
+	asserts.AssertIntReply(t, result, 1)
+	result = testDB.Exec(nil, utils.ToCmdLine("pfdebug", "todense", key1))
+	asserts.AssertIntReply(t, result, 0)
+	testDB.Exec(nil, utils.ToCmdLine("pfmerge", dest, key1))
+	result = testDB.Exec(nil, utils.ToCmdLine("pfdebug", "encoding", dest))
+	asserts.AssertStatusReply(t, result, "dense")
+	result = testDB.Exec(nil, utils.ToCmdLine("pfcount", dest))
+	asserts.AssertIntReply(t, result, int(count))
+
+	empty := utils.RandString(10)
+	result = testDB.Exec(nil, utils.ToCmdLine("pfmerge", empty))
+	asserts.AssertStatusReply(t, result, "OK")
+	result = testDB.Exec(nil, utils.ToCmdLine("pfcount", empty))
+	asserts.AssertIntReply(t, result, 0)
+}
+
+func TestPFDebug(t *testing.T) {
+	testDB.Flush()
+	key := utils.RandString(10)
+	testDB.Exec(nil, utils.ToCmdLine("pfadd", key, "a"))
+	result := testDB.Exec(nil, utils.ToCmdLine("pfdebug", "getreg", key))
+	registers := result.(*protocol.MultiRawReply).Replies
+	if len(registers) != 16384 {
+		t.Fatalf("expect 16384 registers, actually %d", len(registers))
+	}
+	result = testDB.Exec(nil, utils.ToCmdLine("pfdebug", "decode", key))
+	if desc := result.(*protocol.StatusReply).Status; len(desc) == 0 {
+		t.Error("empty sparse description")
+	}
+	result = testDB.Exec(nil, utils.ToCmdLine("pfdebug", "todense", key))
+	asserts.AssertIntReply(t, result, 1)
+	result = testDB.Exec(nil, utils.ToCmdLine("pfdebug", "decode", key))
+	asserts.AssertErrReply(t, result, "ERR HLL encoding is not sparse")
+	result = testDB.Exec(nil, utils.ToCmdLine("pfdebug", "unknown", key))
+	asserts.AssertErrReply(t, result, "ERR Unknown PFDEBUG subcommand 'unknown'")
+	result = testDB.Exec(nil, utils.ToCmdLine("pfdebug", "encoding", utils.RandString(10)))
+	asserts.AssertErrReply(t, result, "ERR The specified key does not exist")
+}
+
+func TestHyperLogLogToCmd(t *testing.T) {
+	testDB.Flush()
+	key := utils.RandString(10)
+	for i := 0; i < 20; i++ {
+		testDB.Exec(nil, utils.ToCmdLine("pfadd", key, strconv.Itoa(i)))
+	}
+	entity, _ := testDB.GetEntity(key)
+	cmd := aof.EntityToCmd(key, entity)
+	testDB.Remove(key)
+	testDB.Exec(nil, cmd.Args)
+	result := testDB.Exec(nil, utils.ToCmdLine("pfcount", key))
+	asserts.AssertIntReply(t, result, 20)
+}
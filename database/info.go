@@ -0,0 +1,275 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/Allen9012/Godis/config"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/interface/godis"
+	"github.com/Allen9012/Godis/tcp"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/6
+  @desc: INFO 命令, 以 redis 文本格式输出服务器状态
+  @modified by:
+**/
+
+// godisVersion is reported as redis_version, so clients treat godis as redis 7
+const godisVersion = "7.0.0"
+
+// serverStats holds counters reported by INFO stats, all fields should be accessed atomically
+type serverStats struct {
+	totalCommands  int64
+	keyspaceHits   int64
+	keyspaceMisses int64
+	evictedKeys    int64
+	expiredKeys    int64
+	// times of active expire cycle exited due to time limit
+	expiredTimeCapReached int64
+	// total time used by active expire cycle in nanoseconds
+	expireCycleTime int64
+}
+
+func (stats *serverStats) incrCommands() {
+	if stats != nil {
+		atomic.AddInt64(&stats.totalCommands, 1)
+	}
+}
+
+func (stats *serverStats) incrKeyspaceHits() {
+	if stats != nil {
+		atomic.AddInt64(&stats.keyspaceHits, 1)
+	}
+}
+
+func (stats *serverStats) incrKeyspaceMisses() {
+	if stats != nil {
+		atomic.AddInt64(&stats.keyspaceMisses, 1)
+	}
+}
+
+func (stats *serverStats) incrEvictedKeys() {
+	if stats != nil {
+		atomic.AddInt64(&stats.evictedKeys, 1)
+	}
+}
+
+// infoSection generates content of one INFO section
+type infoSection struct {
+	name string
+	gen  func(server *StandaloneServer, buf *bytes.Buffer)
+}
+
+// infoSections are printed in this order by INFO without arguments
+var infoSections = []*infoSection{
+	{name: "server", gen: genServerInfo},
+	{name: "clients", gen: genClientsInfo},
+	{name: "memory", gen: genMemoryInfo},
+	{name: "persistence", gen: genPersistenceInfo},
+	{name: "stats", gen: genStatsInfo},
+	{name: "replication", gen: genReplicationInfo},
+	{name: "keyspace", gen: genKeyspaceInfo},
+}
+
+// execInfo
+//
+//	@Description: 返回服务器状态
+//	@param server
+//	@param args	eg: info | info all | info keyspace | info server clients
+//	@return godis.Reply
+func execInfo(server *StandaloneServer, args [][]byte) godis.Reply {
+	selected := make(map[string]struct{})
+	all := len(args) == 0
+	for _, arg := range args {
+		section := strings.ToLower(string(arg))
+		if section == "all" || section == "default" || section == "everything" {
+			all = true
+			continue
+		}
+		selected[section] = struct{}{}
+	}
+	buf := &bytes.Buffer{}
+	for _, section := range infoSections {
+		if _, ok := selected[section.name]; !all && !ok {
+			continue
+		}
+		if buf.Len() > 0 {
+			buf.WriteString("\r\n")
+		}
+		buf.WriteString("# " + strings.ToUpper(section.name[:1]) + section.name[1:] + "\r\n")
+		section.gen(server, buf)
+	}
+	return protocol.MakeBulkReply(buf.Bytes())
+}
+
+// writeInfoField writes a `field:value` line
+func writeInfoField(buf *bytes.Buffer, field string, value interface{}) {
+	buf.WriteString(field)
+	buf.WriteByte(':')
+	buf.WriteString(fmt.Sprint(value))
+	buf.WriteString("\r\n")
+}
+
+func genServerInfo(server *StandaloneServer, buf *bytes.Buffer) {
+	mode := "standalone"
+	if config.Properties.ClusterEnable {
+		mode = "cluster"
+	}
+	uptime := int64(time.Since(config.EachTimeServerInfo.StartUpTime) / time.Second)
+	writeInfoField(buf, "redis_version", godisVersion)
+	writeInfoField(buf, "redis_mode", mode)
+	writeInfoField(buf, "os", runtime.GOOS+" "+runtime.GOARCH)
+	writeInfoField(buf, "arch_bits", strconv.Itoa(32<<(^uint(0)>>63)))
+	writeInfoField(buf, "go_version", runtime.Version())
+	writeInfoField(buf, "process_id", os.Getpid())
+	writeInfoField(buf, "run_id", config.Properties.RunID)
+	writeInfoField(buf, "tcp_port", config.Properties.Port)
+	writeInfoField(buf, "uptime_in_seconds", uptime)
+	writeInfoField(buf, "uptime_in_days", uptime/(24*3600))
+	writeInfoField(buf, "config_file", config.Properties.CfPath)
+}
+
+func genClientsInfo(server *StandaloneServer, buf *bytes.Buffer) {
+	writeInfoField(buf, "connected_clients", atomic.LoadInt32(&tcp.ClientCounter))
+	writeInfoField(buf, "maxclients", config.Get(&config.Properties.MaxClients))
+}
+
+func genMemoryInfo(server *StandaloneServer, buf *bytes.Buffer) {
+	memStats := &runtime.MemStats{}
+	runtime.ReadMemStats(memStats)
+	writeInfoField(buf, "used_memory", memStats.HeapAlloc)
+	writeInfoField(buf, "used_memory_human", bytesToHuman(memStats.HeapAlloc))
+	writeInfoField(buf, "used_memory_rss", memStats.Sys)
+	writeInfoField(buf, "used_memory_rss_human", bytesToHuman(memStats.Sys))
+	writeInfoField(buf, "used_memory_dataset", server.usedMemory())
+	maxMemory := config.Get(&config.Properties.MaxMemory)
+	writeInfoField(buf, "maxmemory", maxMemory)
+	writeInfoField(buf, "maxmemory_human", bytesToHuman(uint64(maxMemory)))
+	writeInfoField(buf, "maxmemory_policy", config.Get(&config.Properties.MaxMemoryPolicy))
+}
+
+func genPersistenceInfo(server *StandaloneServer, buf *bytes.Buffer) {
+	writeInfoField(buf, "loading", atomic.LoadInt32(&server.loading))
+	writeInfoField(buf, "rdb_bgsave_in_progress", atomic.LoadInt32(&server.rdbSaving))
+	writeInfoField(buf, "rdb_last_save_time", atomic.LoadInt64(&server.lastSave))
+	if server.persister == nil {
+		writeInfoField(buf, "aof_enabled", 0)
+		return
+	}
+	writeInfoField(buf, "aof_enabled", boolToInt(config.Get(&config.Properties.AppendOnly)))
+	writeInfoField(buf, "aof_rewrite_in_progress", boolToInt(server.persister.IsRewriting()))
+	status := "ok"
+	if !server.persister.LastWriteOK() {
+		status = "err"
+	}
+	writeInfoField(buf, "aof_last_write_status", status)
+	writeInfoField(buf, "aof_current_size", server.persister.FileSize())
+}
+
+func genStatsInfo(server *StandaloneServer, buf *bytes.Buffer) {
+	stats := server.stats
+	if stats == nil {
+		stats = &serverStats{}
+	}
+	writeInfoField(buf, "total_commands_processed", atomic.LoadInt64(&stats.totalCommands))
+	writeInfoField(buf, "keyspace_hits", atomic.LoadInt64(&stats.keyspaceHits))
+	writeInfoField(buf, "keyspace_misses", atomic.LoadInt64(&stats.keyspaceMisses))
+	writeInfoField(buf, "expired_keys", atomic.LoadInt64(&stats.expiredKeys))
+	writeInfoField(buf, "expired_time_cap_reached_count", atomic.LoadInt64(&stats.expiredTimeCapReached))
+	writeInfoField(buf, "expire_cycle_cpu_milliseconds", atomic.LoadInt64(&stats.expireCycleTime)/int64(time.Millisecond))
+	writeInfoField(buf, "evicted_keys", atomic.LoadInt64(&stats.evictedKeys))
+}
+
+func genReplicationInfo(server *StandaloneServer, buf *bytes.Buffer) {
+	if server.getRole() == slaveRole {
+		status := server.slaveStatus
+		status.mutex.Lock()
+		defer status.mutex.Unlock()
+		linkStatus := "down"
+		if atomic.LoadInt32(&status.linkUp) == 1 {
+			linkStatus = "up"
+		}
+		lastIO := int64(-1)
+		if !status.lastRecvTime.IsZero() {
+			lastIO = int64(time.Since(status.lastRecvTime) / time.Second)
+		}
+		writeInfoField(buf, "role", "slave")
+		writeInfoField(buf, "master_host", status.masterHost)
+		writeInfoField(buf, "master_port", status.masterPort)
+		writeInfoField(buf, "master_link_status", linkStatus)
+		writeInfoField(buf, "master_last_io_seconds_ago", lastIO)
+		writeInfoField(buf, "slave_repl_offset", status.replOffset)
+		writeInfoField(buf, "slave_read_only", boolToInt(config.Get(&config.Properties.ReplicaReadOnly)))
+		writeInfoField(buf, "master_replid", status.replId)
+		return
+	}
+	writeInfoField(buf, "role", "master")
+	status := server.masterStatus
+	if status == nil {
+		writeInfoField(buf, "connected_slaves", 0)
+		return
+	}
+	status.mu.RLock()
+	defer status.mu.RUnlock()
+	writeInfoField(buf, "connected_slaves", len(status.onlineSlaves))
+	i := 0
+	now := time.Now()
+	for slave := range status.onlineSlaves {
+		ip := slave.announceIp
+		if ip == "" {
+			ip, _, _ = net.SplitHostPort(slave.conn.RemoteAddr())
+		}
+		writeInfoField(buf, "slave"+strconv.Itoa(i), fmt.Sprintf("ip=%s,port=%d,state=online,offset=%d,lag=%d",
+			ip, slave.announcePort, slave.offset, int64(now.Sub(slave.lastAckTime)/time.Second)))
+		i++
+	}
+	backlog := status.backlog
+	writeInfoField(buf, "master_replid", status.replId)
+	writeInfoField(buf, "master_repl_offset", backlog.currentOffset)
+	writeInfoField(buf, "repl_backlog_active", boolToInt(status.aofListener != nil))
+	writeInfoField(buf, "repl_backlog_size", backlog.maxSize)
+	writeInfoField(buf, "repl_backlog_first_byte_offset", backlog.beginOffset+1)
+	writeInfoField(buf, "repl_backlog_histlen", len(backlog.buf))
+}
+
+func genKeyspaceInfo(server *StandaloneServer, buf *bytes.Buffer) {
+	for i := range server.dbSet {
+		keys, expires := server.GetDBSize(i)
+		if keys == 0 {
+			continue
+		}
+		writeInfoField(buf, "db"+strconv.Itoa(i), fmt.Sprintf("keys=%d,expires=%d,avg_ttl=0", keys, expires))
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// bytesToHuman formats bytes like redis, eg: 1.50M
+func bytesToHuman(n uint64) string {
+	units := []string{"B", "K", "M", "G", "T"}
+	value := float64(n)
+	i := 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	if i == 0 {
+		return strconv.FormatUint(n, 10) + "B"
+	}
+	return strconv.FormatFloat(value, 'f', 2, 64) + units[i]
+}
@@ -0,0 +1,57 @@
+package database
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/6
+  @desc: info
+  @modified by:
+**/
+
+import (
+	"github.com/Allen9012/Godis/godis/connection"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/lib/utils"
+	"strings"
+	"testing"
+)
+
+func TestInfo(t *testing.T) {
+	server := NewStandaloneServer()
+	defer server.Close()
+	conn := connection.NewFakeConn()
+	server.Exec(conn, utils.ToCmdLine("flushdb"))
+	server.Exec(conn, utils.ToCmdLine("set", "k1", "v"))
+	server.Exec(conn, utils.ToCmdLine("set", "k2", "v", "ex", "100"))
+	server.Exec(conn, utils.ToCmdLine("get", "k1"))
+	server.Exec(conn, utils.ToCmdLine("get", "missing"))
+
+	result := server.Exec(conn, utils.ToCmdLine("info"))
+	bulk, ok := result.(*protocol.BulkReply)
+	if !ok {
+		t.Fatalf("expect bulk reply, actual: %s", result.ToBytes())
+	}
+	info := string(bulk.Arg)
+	for _, expected := range []string{
+		"# Server\r\n", "# Clients\r\n", "# Memory\r\n", "# Persistence\r\n",
+		"# Stats\r\n", "# Replication\r\n", "# Keyspace\r\n",
+		"redis_version:", "uptime_in_seconds:", "connected_clients:", "used_memory:",
+		"total_commands_processed:", "keyspace_hits:1\r\n", "keyspace_misses:1\r\n",
+		"role:master\r\n", "aof_enabled:1\r\n", "db0:keys=2,expires=1,avg_ttl=0\r\n",
+	} {
+		if !strings.Contains(info, expected) {
+			t.Errorf("expect %q in info:\n%s", expected, info)
+		}
+	}
+
+	result = server.Exec(conn, utils.ToCmdLine("info", "KEYSPACE"))
+	bulk, _ = result.(*protocol.BulkReply)
+	if string(bulk.Arg) != "# Keyspace\r\ndb0:keys=2,expires=1,avg_ttl=0\r\n" {
+		t.Errorf("wrong keyspace info: %q", bulk.Arg)
+	}
+	result = server.Exec(conn, utils.ToCmdLine("info", "unknown"))
+	bulk, _ = result.(*protocol.BulkReply)
+	if len(bulk.Arg) != 0 {
+		t.Errorf("expect empty info, actual: %q", bulk.Arg)
+	}
+}
@@ -7,38 +7,77 @@ package database
 */
 import (
 	"github.com/Allen9012/Godis/aof"
+	Dict "github.com/Allen9012/Godis/datastruct/dict"
+	List "github.com/Allen9012/Godis/datastruct/list"
+	HashSet "github.com/Allen9012/Godis/datastruct/set"
+	SortedSet "github.com/Allen9012/Godis/datastruct/sortedset"
+	Stream "github.com/Allen9012/Godis/datastruct/stream"
 	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/interface/database"
 	"github.com/Allen9012/Godis/interface/godis"
 	"github.com/Allen9012/Godis/lib/utils"
 	"github.com/Allen9012/Godis/lib/wildcard"
 	"strconv"
+	"strings"
 	"time"
 )
 
 func init() {
 	//DEL key [key ...]
-	registerCommand("Del", execDel, -2, flagWrite)
+	registerCommand("Del", execDel, writeAllKeys, undoDel, -2, flagWrite)
 	//EXISTS key [key ...]
-	registerCommand("Exists", execExists, -2, flagReadOnly)
+	registerCommand("Exists", execExists, readAllKeys, nil, -2, flagReadOnly)
 	//KEYS pattern
-	registerCommand("Keys", execKeys, 2, flagReadOnly)
+	registerCommand("Keys", execKeys, noPrepare, nil, 2, flagReadOnly)
 	//FLUSHDB [ASYNC | SYNC]
-	registerCommand("FlushDB", execFlushDB, -1, flagReadOnly)
+	registerCommand("FlushDB", execFlushDB, noPrepare, nil, -1, flagWrite)
 	//TYPE key
-	registerCommand("Type", execType, 2, flagReadOnly)
+	registerCommand("Type", execType, readFirstKey, nil, 2, flagReadOnly)
 	//RENAME key newkey
-	registerCommand("Rename", execRename, 3, flagReadOnly)
+	registerCommand("Rename", execRename, prepareRename, undoRename, 3, flagWrite)
 	//RENAMENX key newkey
-	registerCommand("RenameNx", execRenameNx, 3, flagReadOnly)
-	registerCommand("Expire", execExpire, 3, flagWrite)
-	registerCommand("ExpireAt", execExpireAt, 3, flagWrite)
-	registerCommand("ExpireTime", execExpireTime, 2, flagReadOnly)
-	registerCommand("TTL", execTTL, 2, flagReadOnly)
-	registerCommand("Persist", execPersist, 2, flagWrite)
-	registerCommand("PTTL", execPTTL, 2, flagReadOnly)
-	registerCommand("PExpire", execPExpire, 3, flagWrite)
-	registerCommand("PExpireAt", execPExpireAt, 3, flagWrite)
-	registerCommand("PExpireTime", execPExpireTime, 2, flagReadOnly)
+	registerCommand("RenameNx", execRenameNx, prepareRename, undoRename, 3, flagWrite)
+	registerCommand("Expire", execExpire, writeFirstKey, undoExpire, 3, flagWrite)
+	registerCommand("ExpireAt", execExpireAt, writeFirstKey, undoExpire, 3, flagWrite)
+	registerCommand("ExpireTime", execExpireTime, readFirstKey, nil, 2, flagReadOnly)
+	registerCommand("TTL", execTTL, readFirstKey, nil, 2, flagReadOnly)
+	registerCommand("Persist", execPersist, writeFirstKey, undoExpire, 2, flagWrite)
+	registerCommand("PTTL", execPTTL, readFirstKey, nil, 2, flagReadOnly)
+	registerCommand("PExpire", execPExpire, writeFirstKey, undoExpire, 3, flagWrite)
+	registerCommand("PExpireAt", execPExpireAt, writeFirstKey, undoExpire, 3, flagWrite)
+	registerCommand("PExpireTime", execPExpireTime, readFirstKey, nil, 2, flagReadOnly)
+	//SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+	registerCommand("Scan", execScan, noPrepare, nil, -2, flagReadOnly)
+}
+
+// undoDel restores all deleted keys
+func undoDel(db *DB, args [][]byte) []CmdLine {
+	keys := make([]string, len(args))
+	for i, v := range args {
+		keys[i] = string(v)
+	}
+	return rollbackGivenKeys(db, keys...)
+}
+
+// prepareRename locks dest for writing and src for reading
+func prepareRename(args [][]byte) ([]string, []string) {
+	src := string(args[0])
+	dest := string(args[1])
+	return []string{dest}, []string{src}
+}
+
+func undoRename(db *DB, args [][]byte) []CmdLine {
+	src := string(args[0])
+	dest := string(args[1])
+	return rollbackGivenKeys(db, src, dest)
+}
+
+// undoExpire restores ttl of key
+func undoExpire(db *DB, args [][]byte) []CmdLine {
+	key := string(args[0])
+	return []CmdLine{
+		toTTLCmd(db, key).Args,
+	}
 }
 
 func execPExpireTime(db *DB, args [][]byte) godis.Reply {
@@ -74,6 +113,7 @@ func execPExpireAt(db *DB, args [][]byte) godis.Reply {
 	db.Expire(key, expireAt)
 
 	db.addAof(aof.MakeExpireCmd(key, expireAt).Args)
+	db.notifyKeyspaceEvent(notifyGeneric, "expire", key)
 	return protocol.MakeIntReply(1)
 }
 
@@ -94,6 +134,7 @@ func execPExpire(db *DB, args [][]byte) godis.Reply {
 	expireAt := time.Now().Add(ttl)
 	db.Expire(key, expireAt)
 	db.addAof(aof.MakeExpireCmd(key, expireAt).Args)
+	db.notifyKeyspaceEvent(notifyGeneric, "expire", key)
 	return protocol.MakeIntReply(1)
 }
 
@@ -141,6 +182,7 @@ func execPersist(db *DB, args [][]byte) godis.Reply {
 
 	db.Persist(key)
 	db.addAof(utils.ToCmdLine3("persist", args...))
+	db.notifyKeyspaceEvent(notifyGeneric, "persist", key)
 	return protocol.MakeIntReply(1)
 }
 
@@ -188,6 +230,7 @@ func execExpireAt(db *DB, args [][]byte) godis.Reply {
 
 	db.Expire(key, expireAt)
 	db.addAof(aof.MakeExpireCmd(key, expireAt).Args)
+	db.notifyKeyspaceEvent(notifyGeneric, "expire", key)
 	return protocol.MakeIntReply(1)
 }
 
@@ -213,6 +256,7 @@ func execExpire(db *DB, args [][]byte) godis.Reply {
 	expireAt := time.Now().Add(ttl)
 	db.Expire(key, expireAt)
 	db.addAof(aof.MakeExpireCmd(key, expireAt).Args)
+	db.notifyKeyspaceEvent(notifyGeneric, "expire", key)
 	return protocol.MakeIntReply(1)
 }
 
@@ -254,7 +298,12 @@ func execDel(db *DB, args [][]byte) godis.Reply {
 		keys[i] = string(v)
 	}
 
-	deleted := db.Removes(keys...)
+	deleted := 0
+	for _, key := range keys {
+		if db.removeAndNotify(key) {
+			deleted++
+		}
+	}
 	//aof
 	if deleted > 0 {
 		db.addAof(utils.ToCmdLine3("del", args...))
@@ -284,20 +333,38 @@ func execFlushDB(db *DB, args [][]byte) godis.Reply {
 	return protocol.MakeOkReply()
 }
 
-// execType returns the type of entity, including: string, list, hash, set and zset
+// execType returns the type of entity, including: string, list, hash, set, zset and stream
 func execType(db *DB, args [][]byte) godis.Reply {
 	key := string(args[0])
 	entity, exists := db.GetEntity(key)
 	if !exists {
 		return protocol.MakeStatusReply("none")
 	}
-	// TODO 增加类型
+	typeName := getTypeName(entity)
+	if typeName == "" {
+		// 未知类型默认reply
+		return &protocol.UnknownErrReply{}
+	}
+	return protocol.MakeStatusReply(typeName)
+}
+
+// getTypeName returns the type name of entity used by TYPE, returns empty string for unknown type
+func getTypeName(entity *database.DataEntity) string {
 	switch entity.Data.(type) {
 	case []byte:
-		return protocol.MakeStatusReply("string")
+		return "string"
+	case List.List:
+		return "list"
+	case *HashSet.Set:
+		return "set"
+	case Dict.Dict:
+		return "hash"
+	case *SortedSet.SortedSet:
+		return "zset"
+	case *Stream.Stream:
+		return "stream"
 	}
-	// 未知类型默认reply
-	return &protocol.UnknownErrReply{}
+	return ""
 }
 
 // @Description: execRename a key
@@ -326,6 +393,8 @@ func execRename(db *DB, args [][]byte) godis.Reply {
 		db.Expire(dest, expireTime)
 	}
 	db.addAof(utils.ToCmdLine3("rename", args...))
+	db.notifyKeyspaceEvent(notifyGeneric, "rename_from", src)
+	db.notifyKeyspaceEvent(notifyGeneric, "rename_to", dest)
 	return protocol.MakeOkReply()
 }
 
@@ -359,6 +428,8 @@ func execRenameNx(db *DB, args [][]byte) godis.Reply {
 	}
 	//aof
 	db.addAof(utils.ToCmdLine3("renamenx", args...))
+	db.notifyKeyspaceEvent(notifyGeneric, "rename_from", src)
+	db.notifyKeyspaceEvent(notifyGeneric, "rename_to", dest)
 	return protocol.MakeIntReply(1)
 }
 
@@ -373,11 +444,97 @@ func execKeys(db *DB, args [][]byte) godis.Reply {
 	pattern := wildcard.CompilePattern(string(args[0]))
 	// 返回用初始化二维切片
 	result := make([][]byte, 0)
+	now := time.Now()
+	// KEYS 不持有锁, 只跳过过期的 key 而不删除
 	db.data.ForEach(func(key string, val interface{}) bool {
-		if pattern.IsMatch(key) {
+		if pattern.IsMatch(key) && !db.hasExpired(key, now) {
 			result = append(result, []byte(key))
 		}
 		return true
 	})
 	return protocol.MakeMultiBulkReply(result)
 }
+
+// scanOptions holds the options of SCAN family
+type scanOptions struct {
+	cursor   uint64
+	count    int
+	pattern  string
+	typeName string
+}
+
+// parseScanArgs parses `cursor [MATCH pattern] [COUNT count] [TYPE type]`, TYPE is only allowed when withType is true
+func parseScanArgs(args [][]byte, withType bool) (*scanOptions, protocol.ErrorReply) {
+	cursor, err := strconv.ParseUint(string(args[0]), 10, 64)
+	if err != nil {
+		return nil, protocol.MakeErrReply("ERR invalid cursor")
+	}
+	opts := &scanOptions{
+		cursor:  cursor,
+		count:   10,
+		pattern: "*",
+	}
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return nil, protocol.MakeSyntaxErrReply()
+		}
+		arg := strings.ToLower(string(args[i]))
+		value := string(args[i+1])
+		switch {
+		case arg == "match":
+			opts.pattern = value
+		case arg == "count":
+			count, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, protocol.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			if count < 1 {
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+			opts.count = count
+		case arg == "type" && withType:
+			opts.typeName = strings.ToLower(value)
+		default:
+			return nil, protocol.MakeSyntaxErrReply()
+		}
+	}
+	return opts, nil
+}
+
+// makeScanReply makes reply of SCAN family: [next cursor, [elements]]
+func makeScanReply(cursor uint64, elements [][]byte) godis.Reply {
+	return protocol.MakeMultiRawReply([]godis.Reply{
+		protocol.MakeBulkReply([]byte(strconv.FormatUint(cursor, 10))),
+		protocol.MakeMultiBulkReply(elements),
+	})
+}
+
+// execScan iterates keys of current database by cursor
+//
+//	@Description: SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+//	@param db
+//	@param args
+//	@return godis.Reply
+func execScan(db *DB, args [][]byte) godis.Reply {
+	opts, errReply := parseScanArgs(args, true)
+	if errReply != nil {
+		return errReply
+	}
+	keys, next := db.data.Scan(opts.cursor, opts.count, opts.pattern)
+	result := make([][]byte, 0, len(keys))
+	now := time.Now()
+	for _, key := range keys {
+		if db.hasExpired(key, now) {
+			continue
+		}
+		if opts.typeName != "" {
+			// SCAN 不持有 key 的锁, 不能调用会惰性删除 key 的 GetEntity, 过期已经在上面检查过
+			raw, exists := db.data.Get(key)
+			if !exists || getTypeName(raw.(*database.DataEntity)) != opts.typeName {
+				continue
+			}
+		}
+		result = append(result, []byte(key))
+	}
+	return makeScanReply(next, result)
+}
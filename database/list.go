@@ -7,6 +7,7 @@ import (
 	"github.com/Allen9012/Godis/interface/godis"
 	"github.com/Allen9012/Godis/lib/utils"
 	"strconv"
+	"strings"
 )
 
 /*
@@ -15,18 +16,20 @@ import (
 @desc: //list
 */
 func init() {
-	registerCommand("LPush", execLPush, -3, flagWrite)
-	registerCommand("LPushX", execLPushX, -3, flagWrite)
-	registerCommand("RPush", execRPush, -3, flagWrite)
-	registerCommand("RPushX", execRPushX, -3, flagWrite)
-	registerCommand("LPop", execLPop, 2, flagWrite)
-	registerCommand("RPop", execRPop, 2, flagWrite)
-	registerCommand("RPopLPush", execRPopLPush, 3, flagWrite)
-	registerCommand("LRem", execLRem, 4, flagWrite)
-	registerCommand("LLen", execLLen, 2, flagReadOnly)
-	registerCommand("LIndex", execLIndex, 3, flagReadOnly)
-	registerCommand("LSet", execLSet, 4, flagWrite)
-	registerCommand("LRange", execLRange, 4, flagReadOnly)
+	registerCommand("LPush", execLPush, writeFirstKey, undoLPush, -3, flagWrite)
+	registerCommand("LPushX", execLPushX, writeFirstKey, undoLPush, -3, flagWrite)
+	registerCommand("RPush", execRPush, writeFirstKey, undoRPush, -3, flagWrite)
+	registerCommand("RPushX", execRPushX, writeFirstKey, undoRPush, -3, flagWrite)
+	registerCommand("LPop", execLPop, writeFirstKey, undoLPop, 2, flagWrite)
+	registerCommand("RPop", execRPop, writeFirstKey, undoRPop, 2, flagWrite)
+	registerCommand("RPopLPush", execRPopLPush, prepareRPopLPush, undoRPopLPush, 3, flagWrite)
+	registerCommand("LRem", execLRem, writeFirstKey, rollbackFirstKey, 4, flagWrite)
+	registerCommand("LLen", execLLen, readFirstKey, nil, 2, flagReadOnly)
+	registerCommand("LIndex", execLIndex, readFirstKey, nil, 3, flagReadOnly)
+	registerCommand("LSet", execLSet, writeFirstKey, undoLSet, 4, flagWrite)
+	registerCommand("LRange", execLRange, readFirstKey, nil, 4, flagReadOnly)
+	registerCommand("LMove", execLMove, prepareRPopLPush, rollbackSourceAndDest, 5, flagWrite)
+	registerCommand("LMPop", execLMPop, prepareLMPop, undoLMPop, -4, flagWrite)
 }
 
 /*--- 辅助函数 ---*/
@@ -163,6 +166,7 @@ func execLSet(db *DB, args [][]byte) godis.Reply {
 
 	list.Set(index, value)
 	db.addAof(utils.ToCmdLine3("lset", args...))
+	db.notifyKeyspaceEvent(notifyList, "lset", key)
 	return protocol.MakeOkReply()
 }
 
@@ -303,6 +307,10 @@ func execLRem(db *DB, args [][]byte) godis.Reply {
 	}
 	if removed > 0 {
 		db.addAof(utils.ToCmdLine3("lrem", args...))
+		db.notifyKeyspaceEvent(notifyList, "lrem", key)
+		if list.Len() == 0 {
+			db.notifyKeyspaceEvent(notifyGeneric, "del", key)
+		}
 	}
 	return protocol.MakeIntReply(int64(removed))
 }
@@ -339,11 +347,22 @@ func execRPopLPush(db *DB, args [][]byte) godis.Reply {
 	if sourceList.Len() == 0 {
 		db.Remove(sourceKey)
 	}
+	db.signalKeyReady(destKey)
 
 	db.addAof(utils.ToCmdLine3("rpoplpush", args...))
+	db.notifyListPop(sourceKey, sourceList, false)
+	db.notifyKeyspaceEvent(notifyList, "lpush", destKey)
 	return protocol.MakeBulkReply(val)
 }
 
+// prepareRPopLPush locks both source and destination for writing
+func prepareRPopLPush(args [][]byte) ([]string, []string) {
+	return []string{
+		string(args[0]),
+		string(args[1]),
+	}, nil
+}
+
 func undoRPopLPush(db *DB, args [][]byte) []CmdLine {
 	sourceKey := string(args[0])
 	list, errReply := db.getAsList(sourceKey)
@@ -391,6 +410,7 @@ func execRPop(db *DB, args [][]byte) godis.Reply {
 		db.Remove(key)
 	}
 	db.addAof(utils.ToCmdLine3("rpop", args...))
+	db.notifyListPop(key, list, false)
 	return protocol.MakeBulkReply(val)
 }
 
@@ -438,6 +458,7 @@ func execLPop(db *DB, args [][]byte) godis.Reply {
 		db.Remove(key)
 	}
 	db.addAof(utils.ToCmdLine3("lpop", args...))
+	db.notifyListPop(key, list, true)
 	return protocol.MakeBulkReply(val)
 }
 
@@ -486,6 +507,8 @@ func execRPushX(db *DB, args [][]byte) godis.Reply {
 		list.Add(value)
 	}
 	db.addAof(utils.ToCmdLine3("rpushx", args...))
+	db.notifyKeyspaceEvent(notifyList, "rpush", key)
+	db.signalKeyReady(key)
 	return protocol.MakeIntReply(int64(list.Len()))
 }
 
@@ -516,9 +539,21 @@ func execRPush(db *DB, args [][]byte) godis.Reply {
 		list.Add(value)
 	}
 	db.addAof(utils.ToCmdLine3("rpush", args...))
+	db.notifyKeyspaceEvent(notifyList, "rpush", key)
+	db.signalKeyReady(key)
 	return protocol.MakeIntReply(int64(list.Len()))
 }
 
+func undoRPush(db *DB, args [][]byte) []CmdLine {
+	key := string(args[0])
+	count := len(args) - 1
+	cmdLines := make([]CmdLine, 0, count)
+	for i := 0; i < count; i++ {
+		cmdLines = append(cmdLines, utils.ToCmdLine("RPOP", key))
+	}
+	return cmdLines
+}
+
 // execLPushX inserts element at head of list, only if list exists
 //
 //	@Description: LPUSHX key element [element ...]
@@ -542,6 +577,8 @@ func execLPushX(db *DB, args [][]byte) godis.Reply {
 		list.Insert(0, value)
 	}
 	db.addAof(utils.ToCmdLine3("lpushx", args...))
+	db.notifyKeyspaceEvent(notifyList, "lpush", key)
+	db.signalKeyReady(key)
 	return protocol.MakeIntReply(int64(list.Len()))
 }
 
@@ -566,6 +603,8 @@ func execLPush(db *DB, args [][]byte) godis.Reply {
 		list.Insert(0, value)
 	}
 	db.addAof(utils.ToCmdLine3("lpush", args...))
+	db.notifyKeyspaceEvent(notifyList, "lpush", key)
+	db.signalKeyReady(key)
 	return protocol.MakeIntReply(int64(list.Len()))
 }
 
@@ -578,3 +617,196 @@ func undoLPush(db *DB, args [][]byte) []CmdLine {
 	}
 	return cmdLines
 }
+
+// popFromList removes and returns the first or last element of list, removes key if list becomes empty
+func (db *DB) popFromList(key string, list List.List, fromLeft bool) []byte {
+	var val []byte
+	if fromLeft {
+		val, _ = list.Remove(0).([]byte)
+	} else {
+		val, _ = list.RemoveLast().([]byte)
+	}
+	if list.Len() == 0 {
+		db.Remove(key)
+	}
+	return val
+}
+
+// notifyListPop publishes lpop or rpop event of key, and del event if the list has been removed
+func (db *DB) notifyListPop(key string, list List.List, fromLeft bool) {
+	if fromLeft {
+		db.notifyKeyspaceEvent(notifyList, "lpop", key)
+	} else {
+		db.notifyKeyspaceEvent(notifyList, "rpop", key)
+	}
+	if list.Len() == 0 {
+		db.notifyKeyspaceEvent(notifyGeneric, "del", key)
+	}
+}
+
+// parseListDirection parses LEFT|RIGHT, returns true for LEFT
+func parseListDirection(arg []byte) (bool, protocol.ErrorReply) {
+	switch strings.ToLower(string(arg)) {
+	case "left":
+		return true, nil
+	case "right":
+		return false, nil
+	}
+	return false, protocol.MakeSyntaxErrReply()
+}
+
+// execLMove atomically moves an element from source list to destination list
+//
+//	@Description: LMOVE source destination LEFT|RIGHT LEFT|RIGHT
+//	@param db
+//	@param args
+//	@return godis.Reply
+func execLMove(db *DB, args [][]byte) godis.Reply {
+	result, served := lMove(db, args[0], args[1], args[2], args[3])
+	if !served {
+		return protocol.MakeNullBulkReply()
+	}
+	return result
+}
+
+// lMove is shared by LMOVE, BLMOVE and BRPOPLPUSH, served is false if source list is empty
+func lMove(db *DB, source []byte, dest []byte, whereFrom []byte, whereTo []byte) (godis.Reply, bool) {
+	fromLeft, errReply := parseListDirection(whereFrom)
+	if errReply != nil {
+		return errReply, true
+	}
+	toLeft, errReply := parseListDirection(whereTo)
+	if errReply != nil {
+		return errReply, true
+	}
+	sourceKey := string(source)
+	destKey := string(dest)
+	sourceList, errReply := db.getAsList(sourceKey)
+	if errReply != nil {
+		return errReply, true
+	}
+	if sourceList == nil {
+		return nil, false
+	}
+	destList, _, errReply := db.getOrInitList(destKey)
+	if errReply != nil {
+		return errReply, true
+	}
+
+	var val []byte
+	if fromLeft {
+		val, _ = sourceList.Remove(0).([]byte)
+	} else {
+		val, _ = sourceList.RemoveLast().([]byte)
+	}
+	if toLeft {
+		destList.Insert(0, val)
+	} else {
+		destList.Add(val)
+	}
+	// source and destination may be the same list, so remove source after pushing
+	if sourceList.Len() == 0 {
+		db.Remove(sourceKey)
+	}
+	db.signalKeyReady(destKey)
+	db.addAof(utils.ToCmdLine3("lmove", source, dest, whereFrom, whereTo))
+	db.notifyListPop(sourceKey, sourceList, fromLeft)
+	if toLeft {
+		db.notifyKeyspaceEvent(notifyList, "lpush", destKey)
+	} else {
+		db.notifyKeyspaceEvent(notifyList, "rpush", destKey)
+	}
+	return protocol.MakeBulkReply(val), true
+}
+
+// rollbackSourceAndDest restores source and destination of LMOVE like commands
+func rollbackSourceAndDest(db *DB, args [][]byte) []CmdLine {
+	return rollbackGivenKeys(db, string(args[0]), string(args[1]))
+}
+
+// parseMPopKeys parses `numkeys key [key ...]` of LMPOP, returns keys and the rest args
+func parseMPopKeys(args [][]byte) ([]string, [][]byte) {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil || numKeys <= 0 || numKeys >= len(args) {
+		return nil, nil
+	}
+	keys := make([]string, 0, numKeys)
+	for _, arg := range args[1 : numKeys+1] {
+		keys = append(keys, string(arg))
+	}
+	return keys, args[numKeys+1:]
+}
+
+func prepareLMPop(args [][]byte) ([]string, []string) {
+	keys, _ := parseMPopKeys(args)
+	return keys, nil
+}
+
+func undoLMPop(db *DB, args [][]byte) []CmdLine {
+	keys, _ := parseMPopKeys(args)
+	return rollbackGivenKeys(db, keys...)
+}
+
+// execLMPop pops elements from the first non-empty list
+//
+//	@Description: LMPOP numkeys key [key ...] LEFT|RIGHT [COUNT count]
+//	@param db
+//	@param args
+//	@return godis.Reply
+func execLMPop(db *DB, args [][]byte) godis.Reply {
+	result, served := lMPop(db, args)
+	if !served {
+		return protocol.MakeNullMultiBulkReply()
+	}
+	return result
+}
+
+// lMPop is shared by LMPOP and BLMPOP, served is false if all lists are empty
+func lMPop(db *DB, args [][]byte) (godis.Reply, bool) {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil || numKeys <= 0 {
+		return protocol.MakeErrReply("ERR numkeys should be greater than 0"), true
+	}
+	keys, rest := parseMPopKeys(args)
+	if keys == nil || len(rest) == 0 {
+		return protocol.MakeSyntaxErrReply(), true
+	}
+	fromLeft, errReply := parseListDirection(rest[0])
+	if errReply != nil {
+		return errReply, true
+	}
+	count := 1
+	if len(rest) > 1 {
+		if len(rest) != 3 || strings.ToLower(string(rest[1])) != "count" {
+			return protocol.MakeSyntaxErrReply(), true
+		}
+		count, err = strconv.Atoi(string(rest[2]))
+		if err != nil || count <= 0 {
+			return protocol.MakeErrReply("ERR count should be greater than 0"), true
+		}
+	}
+
+	for _, key := range keys {
+		list, errReply := db.getAsList(key)
+		if errReply != nil {
+			return errReply, true
+		}
+		if list == nil {
+			continue
+		}
+		if count > list.Len() {
+			count = list.Len()
+		}
+		elements := make([][]byte, 0, count)
+		for i := 0; i < count; i++ {
+			elements = append(elements, db.popFromList(key, list, fromLeft))
+		}
+		db.addAof(utils.ToCmdLine3("lmpop", []byte("1"), []byte(key), rest[0], []byte("count"), []byte(strconv.Itoa(count))))
+		db.notifyListPop(key, list, fromLeft)
+		return protocol.MakeMultiRawReply([]godis.Reply{
+			protocol.MakeBulkReply([]byte(key)),
+			protocol.MakeMultiBulkReply(elements),
+		}), true
+	}
+	return nil, false
+}
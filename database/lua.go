@@ -0,0 +1,243 @@
+package database
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/interface/godis"
+	"github.com/Allen9012/Godis/lib/logger"
+	lua "github.com/yuin/gopher-lua"
+	"strings"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/14
+  @desc: lua 虚拟机中的 redis 库, 以及 godis.Reply 与 lua 值的相互转换
+	转换规则与 redis 相同:
+	integer <-> number, bulk <-> string, multi bulk <-> table, nil bulk/nil multi bulk -> false
+	status <-> {ok=...}, error <-> {err=...}, lua false -> nil bulk, lua true -> integer 1
+  @modified by:
+**/
+
+const (
+	logDebug = iota
+	logVerbose
+	logNotice
+	logWarning
+)
+
+// sha1Hex returns lowercase hex of sha1 digest
+func sha1Hex(data []byte) string {
+	digest := sha1.Sum(data)
+	return hex.EncodeToString(digest[:])
+}
+
+// newLuaState creates a lua vm with safe standard libraries and redis library bound to run
+func newLuaState(run *scriptRun) *lua.LState {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	// scripts should not access file system
+	L.SetGlobal("dofile", lua.LNil)
+	L.SetGlobal("loadfile", lua.LNil)
+
+	redis := L.NewTable()
+	L.SetFuncs(redis, map[string]lua.LGFunction{
+		"call": func(L *lua.LState) int {
+			return run.luaCall(L, true)
+		},
+		"pcall": func(L *lua.LState) int {
+			return run.luaCall(L, false)
+		},
+		"error_reply": func(L *lua.LState) int {
+			L.Push(errorTable(L, L.CheckString(1)))
+			return 1
+		},
+		"status_reply": func(L *lua.LState) int {
+			L.Push(statusTable(L, L.CheckString(1)))
+			return 1
+		},
+		"sha1hex": func(L *lua.LState) int {
+			L.Push(lua.LString(sha1Hex([]byte(L.CheckString(1)))))
+			return 1
+		},
+		"log": luaLog,
+	})
+	L.SetField(redis, "LOG_DEBUG", lua.LNumber(logDebug))
+	L.SetField(redis, "LOG_VERBOSE", lua.LNumber(logVerbose))
+	L.SetField(redis, "LOG_NOTICE", lua.LNumber(logNotice))
+	L.SetField(redis, "LOG_WARNING", lua.LNumber(logWarning))
+	L.SetGlobal("redis", redis)
+	return L
+}
+
+// luaLog implements redis.log(level, message, ...)
+func luaLog(L *lua.LState) int {
+	level := L.CheckInt(1)
+	parts := make([]string, 0, L.GetTop()-1)
+	for i := 2; i <= L.GetTop(); i++ {
+		parts = append(parts, L.ToStringMeta(L.Get(i)).String())
+	}
+	msg := strings.Join(parts, " ")
+	switch level {
+	case logDebug:
+		logger.Debug(msg)
+	case logVerbose, logNotice:
+		logger.Info(msg)
+	case logWarning:
+		logger.Warn(msg)
+	default:
+		L.RaiseError("Invalid debug level.")
+	}
+	return 0
+}
+
+// luaCall implements redis.call and redis.pcall
+//
+//	@Description: redis.call 遇到错误时抛出 {err=...}, redis.pcall 则将其作为返回值
+//	@receiver run
+//	@param L
+//	@param raise
+//	@return int
+func (run *scriptRun) luaCall(L *lua.LState, raise bool) int {
+	top := L.GetTop()
+	if top == 0 {
+		return luaCallError(L, "ERR Please specify at least one argument for this redis lib call", raise)
+	}
+	cmdLine := make([][]byte, 0, top)
+	for i := 1; i <= top; i++ {
+		switch arg := L.Get(i).(type) {
+		case lua.LString:
+			cmdLine = append(cmdLine, []byte(arg))
+		case lua.LNumber:
+			cmdLine = append(cmdLine, []byte(arg.String()))
+		default:
+			return luaCallError(L, "ERR Lua redis lib command arguments must be strings or integers", raise)
+		}
+	}
+	reply := run.exec(cmdLine)
+	if protocol.IsErrorReply(reply) {
+		return luaCallError(L, errorMessage(reply), raise)
+	}
+	L.Push(replyToLua(L, reply))
+	return 1
+}
+
+func luaCallError(L *lua.LState, msg string, raise bool) int {
+	if raise {
+		L.Error(errorTable(L, msg), 0)
+		return 0
+	}
+	L.Push(errorTable(L, msg))
+	return 1
+}
+
+// errorMessage returns the message of error reply without leading '-' and trailing CRLF
+func errorMessage(reply godis.Reply) string {
+	return strings.TrimSuffix(string(reply.ToBytes()[1:]), protocol.CRLF)
+}
+
+func errorTable(L *lua.LState, msg string) *lua.LTable {
+	table := L.NewTable()
+	table.RawSetString("err", lua.LString(msg))
+	return table
+}
+
+func statusTable(L *lua.LState, status string) *lua.LTable {
+	table := L.NewTable()
+	table.RawSetString("ok", lua.LString(status))
+	return table
+}
+
+// replyToLua converts reply of command to lua value
+func replyToLua(L *lua.LState, reply godis.Reply) lua.LValue {
+	if protocol.IsErrorReply(reply) {
+		return errorTable(L, errorMessage(reply))
+	}
+	switch r := reply.(type) {
+	case *protocol.IntReply:
+		return lua.LNumber(r.Code)
+	case *protocol.BulkReply:
+		return lua.LString(r.Arg)
+	case *protocol.EmptyBulkReply:
+		return lua.LString("")
+	case *protocol.StatusReply:
+		return statusTable(L, r.Status)
+	case *protocol.OkReply:
+		return statusTable(L, "OK")
+	case *protocol.PongReply:
+		return statusTable(L, "PONG")
+	case *protocol.EmptyMultiBulkReply:
+		return L.NewTable()
+	case *protocol.MultiBulkReply:
+		table := L.CreateTable(len(r.Args), 0)
+		for _, arg := range r.Args {
+			if arg == nil {
+				table.Append(lua.LFalse)
+			} else {
+				table.Append(lua.LString(arg))
+			}
+		}
+		return table
+	case *protocol.MultiRawReply:
+		table := L.CreateTable(len(r.Replies), 0)
+		for _, item := range r.Replies {
+			table.Append(replyToLua(L, item))
+		}
+		return table
+	}
+	// nil bulk and nil multi bulk
+	return lua.LFalse
+}
+
+// luaToReply converts value returned by script to reply, array is truncated at the first nil
+func luaToReply(value lua.LValue) godis.Reply {
+	switch v := value.(type) {
+	case lua.LString:
+		if len(v) == 0 {
+			// 空的 BulkReply 会被编码为 null bulk
+			return protocol.MakeEmptyBulkReply()
+		}
+		return protocol.MakeBulkReply([]byte(v))
+	case lua.LNumber:
+		return protocol.MakeIntReply(int64(v))
+	case lua.LBool:
+		if v {
+			return protocol.MakeIntReply(1)
+		}
+		return protocol.MakeNullBulkReply()
+	case *lua.LTable:
+		if msg, ok := v.RawGetString("err").(lua.LString); ok {
+			return protocol.MakeErrReply(string(msg))
+		}
+		if status, ok := v.RawGetString("ok").(lua.LString); ok {
+			return protocol.MakeStatusReply(string(status))
+		}
+		var replies []godis.Reply
+		for i := 1; ; i++ {
+			item := v.RawGetInt(i)
+			if item == lua.LNil {
+				break
+			}
+			replies = append(replies, luaToReply(item))
+		}
+		if len(replies) == 0 {
+			return protocol.MakeEmptyMultiBulkReply()
+		}
+		return protocol.MakeMultiRawReply(replies)
+	}
+	return protocol.MakeNullBulkReply()
+}
@@ -0,0 +1,283 @@
+package database
+
+import (
+	"bytes"
+	"github.com/Allen9012/Godis/config"
+	Dict "github.com/Allen9012/Godis/datastruct/dict"
+	List "github.com/Allen9012/Godis/datastruct/list"
+	HashSet "github.com/Allen9012/Godis/datastruct/set"
+	SortedSet "github.com/Allen9012/Godis/datastruct/sortedset"
+	Stream "github.com/Allen9012/Godis/datastruct/stream"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/interface/database"
+	"github.com/Allen9012/Godis/interface/godis"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/16
+  @desc: 估算 key 占用的内存, 用于 maxmemory 淘汰和 MEMORY 命令
+	估算值只考虑数据本身和大致的结构开销, 与 go runtime 实际分配的内存并不相等
+	集合类型只采样前若干个元素, 用平均大小乘以元素个数, 因此估算的开销与集合大小无关
+  @modified by:
+**/
+
+// approximate overheads of data structures in bytes
+const (
+	// dict entry, DataEntity and keyMeta of a key
+	keyOverhead = 96
+	// slice header of []byte
+	bytesOverhead = 24
+	// element of quicklist page
+	listElemOverhead = 16
+	// entry of map used by hash, set, and keyspace dict and ttl dict of database
+	dictEntryOverhead = 48
+	// skiplist node and dict entry of sorted set member
+	zsetElemOverhead = 96
+	// entry of stream, including ID and slice header of fields
+	streamEntryOverhead = 64
+	// consumer group of stream
+	streamGroupOverhead = 128
+)
+
+// defaultMemorySamples is the number of elements sampled when estimating collections
+const defaultMemorySamples = 5
+
+// estimateKeySize returns estimated memory used by key and its value
+func estimateKeySize(key string, entity *database.DataEntity, samples int) int64 {
+	return keyOverhead + int64(len(key)) + estimateEntitySize(entity, samples)
+}
+
+// estimateEntitySize estimates memory used by value of entity
+//
+//	@Description: 集合类型采样前 samples 个元素估算, samples <= 0 表示遍历所有元素
+//	@param entity
+//	@param samples
+//	@return int64
+func estimateEntitySize(entity *database.DataEntity, samples int) int64 {
+	switch data := entity.Data.(type) {
+	case []byte:
+		return bytesOverhead + int64(len(data))
+	case List.List:
+		size := data.Len()
+		sampled, total := 0, int64(0)
+		data.ForEach(func(i int, v interface{}) bool {
+			val, _ := v.([]byte)
+			total += listElemOverhead + bytesOverhead + int64(len(val))
+			sampled++
+			return samples <= 0 || sampled < samples
+		})
+		return scaleSampledSize(total, sampled, size)
+	case Dict.Dict:
+		size := data.Len()
+		sampled, total := 0, int64(0)
+		data.ForEach(func(field string, v interface{}) bool {
+			val, _ := v.([]byte)
+			total += dictEntryOverhead + int64(len(field)) + bytesOverhead + int64(len(val))
+			sampled++
+			return samples <= 0 || sampled < samples
+		})
+		return scaleSampledSize(total, sampled, size)
+	case *HashSet.Set:
+		size := data.Len()
+		sampled, total := 0, int64(0)
+		data.ForEach(func(member string) bool {
+			total += dictEntryOverhead + int64(len(member))
+			sampled++
+			return samples <= 0 || sampled < samples
+		})
+		return scaleSampledSize(total, sampled, size)
+	case *SortedSet.SortedSet:
+		size := int(data.Len())
+		if size == 0 {
+			// ForEachByRank 不接受空区间, 新建的空 zset 也会在此估算
+			return 0
+		}
+		sampled, total := 0, int64(0)
+		data.ForEachByRank(0, data.Len(), false, func(element *SortedSet.Element) bool {
+			// member 在 dict 和 skiplist 中各引用一次, 但只存一份
+			total += zsetElemOverhead + int64(len(element.Member))
+			sampled++
+			return samples <= 0 || sampled < samples
+		})
+		return scaleSampledSize(total, sampled, size)
+	case *Stream.Stream:
+		size := data.Len()
+		sampled, total := 0, int64(0)
+		data.ForEach(func(entry *Stream.Entry) bool {
+			total += streamEntryOverhead
+			for _, field := range entry.Fields {
+				total += bytesOverhead + int64(len(field))
+			}
+			sampled++
+			return samples <= 0 || sampled < samples
+		})
+		return scaleSampledSize(total, sampled, size) + int64(len(data.Groups()))*streamGroupOverhead
+	}
+	return 0
+}
+
+// scaleSampledSize estimates total size of size elements by average size of sampled elements
+func scaleSampledSize(sampledSize int64, sampled int, size int) int64 {
+	if sampled == 0 {
+		return 0
+	}
+	return sampledSize * int64(size) / int64(sampled)
+}
+
+// execMemory
+//
+//	@Description: MEMORY USAGE key [SAMPLES count] | MEMORY STATS | MEMORY DOCTOR
+//	@receiver server
+//	@param db	当前选择的 db, 用于 MEMORY USAGE
+//	@param args
+//	@return godis.Reply
+func (server *StandaloneServer) execMemory(db *DB, args [][]byte) godis.Reply {
+	if len(args) == 0 {
+		return protocol.MakeArgNumErrReply("memory")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "usage":
+		if len(args) < 2 {
+			return protocol.MakeArgNumErrReply("memory|usage")
+		}
+		return execMemoryUsage(db, args[1:])
+	case "stats":
+		if len(args) != 1 {
+			return protocol.MakeArgNumErrReply("memory|stats")
+		}
+		return server.memoryStats()
+	case "doctor":
+		if len(args) != 1 {
+			return protocol.MakeArgNumErrReply("memory|doctor")
+		}
+		return protocol.MakeBulkReply([]byte(server.memoryDoctor()))
+	}
+	return protocol.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try MEMORY HELP.")
+}
+
+// execMemoryUsage returns estimated memory of key, SAMPLES 0 means all elements of collections are counted
+func execMemoryUsage(db *DB, args [][]byte) godis.Reply {
+	key := string(args[0])
+	samples := defaultMemorySamples
+	if len(args) > 1 {
+		if len(args) != 3 || strings.ToLower(string(args[1])) != "samples" {
+			return protocol.MakeSyntaxErrReply()
+		}
+		n, err := strconv.Atoi(string(args[2]))
+		if err != nil || n < 0 {
+			return protocol.MakeErrReply("ERR value is out of range, must be positive")
+		}
+		samples = n
+	}
+	keys := []string{key}
+	db.RWLocks(nil, keys)
+	defer db.RWUnLocks(nil, keys)
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return protocol.MakeNullBulkReply()
+	}
+	return protocol.MakeIntReply(estimateKeySize(key, entity, samples))
+}
+
+// memoryStats reports memory usage of server as field-value pairs, eg: db.0 [overhead.hashtable.main 4800 ...]
+func (server *StandaloneServer) memoryStats() godis.Reply {
+	memStats := &runtime.MemStats{}
+	runtime.ReadMemStats(memStats)
+	var replies []godis.Reply
+	addField := func(name string, value godis.Reply) {
+		replies = append(replies, protocol.MakeBulkReply([]byte(name)), value)
+	}
+	addField("total.allocated", protocol.MakeIntReply(int64(memStats.HeapAlloc)))
+	backlogSize := 0
+	if status := server.masterStatus; status != nil {
+		status.mu.RLock()
+		backlogSize = len(status.backlog.buf)
+		status.mu.RUnlock()
+	}
+	addField("replication.backlog", protocol.MakeIntReply(int64(backlogSize)))
+
+	var overhead, keysCount int64
+	for i := range server.dbSet {
+		keys, expires := server.GetDBSize(i)
+		if keys == 0 {
+			continue
+		}
+		mainOverhead := int64(keys) * dictEntryOverhead
+		expiresOverhead := int64(expires) * dictEntryOverhead
+		addField("db."+strconv.Itoa(i), protocol.MakeMultiRawReply([]godis.Reply{
+			protocol.MakeBulkReply([]byte("overhead.hashtable.main")), protocol.MakeIntReply(mainOverhead),
+			protocol.MakeBulkReply([]byte("overhead.hashtable.expires")), protocol.MakeIntReply(expiresOverhead),
+		}))
+		overhead += mainOverhead + expiresOverhead
+		keysCount += int64(keys)
+	}
+	addField("overhead.total", protocol.MakeIntReply(overhead+int64(backlogSize)))
+	addField("keys.count", protocol.MakeIntReply(keysCount))
+	dataset := server.usedMemory()
+	bytesPerKey := int64(0)
+	if keysCount > 0 {
+		bytesPerKey = dataset / keysCount
+	}
+	addField("keys.bytes-per-key", protocol.MakeIntReply(bytesPerKey))
+	addField("dataset.bytes", protocol.MakeIntReply(dataset))
+	addField("dataset.percentage", formatFloatReply(percentage(dataset, int64(memStats.HeapAlloc))))
+	addField("fragmentation", formatFloatReply(fragmentation(memStats)))
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// memoryDoctor reports memory problems in human-readable text like redis
+func (server *StandaloneServer) memoryDoctor() string {
+	memStats := &runtime.MemStats{}
+	runtime.ReadMemStats(memStats)
+	if memStats.HeapAlloc < 5<<20 {
+		return "Hi Sam, this instance is empty or is using very little memory, my issues detector can't be used in these conditions. " +
+			"Please, leave for your mission on Earth and fill it with some data. " +
+			"The new Sam and I will be back to our programming as soon as I finished rebooting."
+	}
+	buf := &bytes.Buffer{}
+	if fragmentation(memStats) > 1.4 {
+		buf.WriteString(" * High total RSS: This instance has a memory fragmentation and RSS overhead greater than 1.4 " +
+			"(this means that the Resident Set Size of the process is much larger than the sum of the logical allocations godis performed). " +
+			"MEMORY STATS may help to find where the memory goes.\n\n")
+	}
+	if maxMemory := int64(config.Get(&config.Properties.MaxMemory)); maxMemory > 0 && server.usedMemory()*10 > maxMemory*9 {
+		buf.WriteString(" * Close to maxmemory: The dataset uses more than 90% of maxmemory, " +
+			"keys will be evicted or write commands will be rejected according to maxmemory-policy soon.\n\n")
+	}
+	if server.scripts != nil && server.scripts.count() > 1000 {
+		buf.WriteString(" * Many scripts: There seem to be many cached scripts in this instance (more than 1000). " +
+			"This may be because scripts are generated and `EVAL`ed, instead of being parameterized (with KEYS and ARGV), " +
+			"`SCRIPT LOAD`ed and `EVALSHA`ed. Unless `SCRIPT FLUSH` is called periodically, " +
+			"the scripts' caches may end up consuming most of your memory.\n\n")
+	}
+	if buf.Len() == 0 {
+		return "Hi Sam, I can't find any memory issue in your instance. I can only account for what occurs on this base."
+	}
+	return "Sam, I detected a few issues in this godis instance memory implants:\n\n" + buf.String() +
+		"I'm here to keep you safe, Sam. I want to help you.\n"
+}
+
+// fragmentation returns ratio of memory obtained from OS to memory allocated by heap objects
+func fragmentation(memStats *runtime.MemStats) float64 {
+	if memStats.HeapAlloc == 0 {
+		return 0
+	}
+	return float64(memStats.Sys) / float64(memStats.HeapAlloc)
+}
+
+func percentage(part int64, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) * 100 / float64(total)
+}
+
+func formatFloatReply(value float64) godis.Reply {
+	return protocol.MakeBulkReply([]byte(strconv.FormatFloat(value, 'f', 2, 64)))
+}
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"github.com/Allen9012/Godis/pubsub"
+	"strconv"
+	"sync/atomic"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/15
+  @desc: keyspace notifications, 配置方式与 redis 的 notify-keyspace-events 相同
+	K: 发布到 __keyspace@<db>__:<key>, 消息为事件名
+	E: 发布到 __keyevent@<db>__:<event>, 消息为 key
+	g$lshzxet 为事件类别, A 是 g$lshzxet 的别名, K 和 E 至少需要一个
+  @modified by:
+**/
+
+// classes of keyspace events
+const (
+	notifyKeyspace = 1 << iota // K
+	notifyKeyevent             // E
+	notifyGeneric              // g
+	notifyString               // $
+	notifyList                 // l
+	notifySet                  // s
+	notifyHash                 // h
+	notifyZSet                 // z
+	notifyExpired              // x
+	notifyEvicted              // e
+	notifyStream               // t
+
+	notifyAll = notifyGeneric | notifyString | notifyList | notifySet | notifyHash |
+		notifyZSet | notifyExpired | notifyEvicted | notifyStream // A
+)
+
+// parseKeyspaceEvents converts value of notify-keyspace-events to flags, unknown characters are ignored
+func parseKeyspaceEvents(value string) int {
+	flags := 0
+	for _, c := range value {
+		switch c {
+		case 'A':
+			flags |= notifyAll
+		case 'K':
+			flags |= notifyKeyspace
+		case 'E':
+			flags |= notifyKeyevent
+		case 'g':
+			flags |= notifyGeneric
+		case '$':
+			flags |= notifyString
+		case 'l':
+			flags |= notifyList
+		case 's':
+			flags |= notifySet
+		case 'h':
+			flags |= notifyHash
+		case 'z':
+			flags |= notifyZSet
+		case 'x':
+			flags |= notifyExpired
+		case 'e':
+			flags |= notifyEvicted
+		case 't':
+			flags |= notifyStream
+		}
+	}
+	return flags
+}
+
+// keyspaceNotifier publishes keyspace events to pubsub hub, it is shared by all databases of a server
+type keyspaceNotifier struct {
+	hub   *pubsub.Hub
+	flags int32
+}
+
+func makeKeyspaceNotifier(hub *pubsub.Hub, events string) *keyspaceNotifier {
+	notifier := &keyspaceNotifier{hub: hub}
+	notifier.setEvents(events)
+	return notifier
+}
+
+// setEvents changes classes of events to publish, used by CONFIG SET notify-keyspace-events
+func (notifier *keyspaceNotifier) setEvents(events string) {
+	atomic.StoreInt32(&notifier.flags, int32(parseKeyspaceEvents(events)))
+}
+
+// notify publishes event if its class is enabled
+//
+//	@Description: eg: DEL k 在 db0 中发布 __keyspace@0__:k del 和 __keyevent@0__:del k
+//	@receiver notifier
+//	@param dbIndex
+//	@param class	notifyGeneric, notifyString ...
+//	@param event	事件名, 通常为命令名
+//	@param key
+func (notifier *keyspaceNotifier) notify(dbIndex int, class int, event string, key string) {
+	flags := int(atomic.LoadInt32(&notifier.flags))
+	if flags&class == 0 {
+		return
+	}
+	db := strconv.Itoa(dbIndex)
+	if flags&notifyKeyspace > 0 {
+		pubsub.Publish(notifier.hub, [][]byte{[]byte("__keyspace@" + db + "__:" + key), []byte(event)})
+	}
+	if flags&notifyKeyevent > 0 {
+		pubsub.Publish(notifier.hub, [][]byte{[]byte("__keyevent@" + db + "__:" + event), []byte(key)})
+	}
+}
+
+// removeAndNotify removes key and publishes del event, returns false if key does not exist
+func (db *DB) removeAndNotify(key string) bool {
+	if _, exists := db.GetEntity(key); !exists {
+		return false
+	}
+	db.Remove(key)
+	db.notifyKeyspaceEvent(notifyGeneric, "del", key)
+	return true
+}
+
+// notifyKeyspaceEvent publishes event of key happened in db, nothing happens for auxiliary databases
+func (db *DB) notifyKeyspaceEvent(class int, event string, key string) {
+	if db.notifier == nil {
+		return
+	}
+	db.notifier.notify(db.index, class, event, key)
+}
@@ -0,0 +1,147 @@
+package database
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/15
+  @desc: keyspace notifications
+  @modified by:
+**/
+
+import (
+	"github.com/Allen9012/Godis/config"
+	"github.com/Allen9012/Godis/godis/connection"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/godis/protocol/asserts"
+	"github.com/Allen9012/Godis/interface/database"
+	"github.com/Allen9012/Godis/lib/utils"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// subscribeKeyspace subscribes all keyspace events of db 0
+func subscribeKeyspace(server *StandaloneServer, events string) *connection.FakeConn {
+	conn := connection.NewFakeConn()
+	server.Exec(conn, utils.ToCmdLine("config", "set", "notify-keyspace-events", events))
+	server.Exec(conn, utils.ToCmdLine("psubscribe", "__key*@0__:*"))
+	conn.Clean()
+	return conn
+}
+
+// keyspaceMessages formats messages received by subscribeKeyspace, each message is `channel message`
+func keyspaceMessages(events ...string) []byte {
+	var result []byte
+	for _, event := range events {
+		channel, msg, _ := strings.Cut(event, " ")
+		reply := protocol.MakeMultiBulkReply(utils.ToCmdLine("pmessage", "__key*@0__:*", channel, msg))
+		result = append(result, reply.ToBytes()...)
+	}
+	return result
+}
+
+func assertKeyspaceMessages(t *testing.T, conn *connection.FakeConn, events ...string) {
+	t.Helper()
+	expected := keyspaceMessages(events...)
+	if actual := conn.Bytes(); string(actual) != string(expected) {
+		t.Errorf("expected %q, actually %q", expected, actual)
+	}
+	conn.Clean()
+}
+
+func TestKeyspaceEvents(t *testing.T) {
+	server := NewStandaloneServer()
+	defer server.Close()
+	defer func() {
+		config.Properties.NotifyKeyspaceEvents = ""
+	}()
+	sub := subscribeKeyspace(server, "KEA")
+	conn := connection.NewFakeConn()
+	key := utils.RandString(10)
+
+	server.Exec(conn, utils.ToCmdLine("set", key, "1"))
+	assertKeyspaceMessages(t, sub, "__keyspace@0__:"+key+" set", "__keyevent@0__:set "+key)
+	server.Exec(conn, utils.ToCmdLine("incr", key))
+	assertKeyspaceMessages(t, sub, "__keyspace@0__:"+key+" incrby", "__keyevent@0__:incrby "+key)
+	server.Exec(conn, utils.ToCmdLine("del", key, utils.RandString(10)))
+	assertKeyspaceMessages(t, sub, "__keyspace@0__:"+key+" del", "__keyevent@0__:del "+key)
+
+	// the list is deleted after popping the last element
+	server.Exec(conn, utils.ToCmdLine("config", "set", "notify-keyspace-events", "Elg"))
+	server.Exec(conn, utils.ToCmdLine("rpush", key, "a"))
+	server.Exec(conn, utils.ToCmdLine("lpop", key))
+	assertKeyspaceMessages(t, sub, "__keyevent@0__:rpush "+key, "__keyevent@0__:lpop "+key, "__keyevent@0__:del "+key)
+
+	// only the enabled classes are published
+	server.Exec(conn, utils.ToCmdLine("config", "set", "notify-keyspace-events", "Kh"))
+	server.Exec(conn, utils.ToCmdLine("sadd", key+"set", "a"))
+	server.Exec(conn, utils.ToCmdLine("hset", key+"hash", "f", "v"))
+	server.Exec(conn, utils.ToCmdLine("hget", key+"hash", "f"))
+	assertKeyspaceMessages(t, sub, "__keyspace@0__:"+key+"hash hset")
+
+	server.Exec(conn, utils.ToCmdLine("config", "set", "notify-keyspace-events", "Eg"))
+	server.Exec(conn, utils.ToCmdLine("set", key, "1"))
+	server.Exec(conn, utils.ToCmdLine("rename", key, key+"new"))
+	server.Exec(conn, utils.ToCmdLine("expire", key+"new", "100"))
+	server.Exec(conn, utils.ToCmdLine("persist", key+"new"))
+	assertKeyspaceMessages(t, sub, "__keyevent@0__:rename_from "+key, "__keyevent@0__:rename_to "+key+"new",
+		"__keyevent@0__:expire "+key+"new", "__keyevent@0__:persist "+key+"new")
+
+	// events need K or E
+	server.Exec(conn, utils.ToCmdLine("config", "set", "notify-keyspace-events", "A"))
+	server.Exec(conn, utils.ToCmdLine("del", key+"new"))
+	assertKeyspaceMessages(t, sub)
+
+	result := server.Exec(conn, utils.ToCmdLine("config", "set", "notify-keyspace-events", "KEy"))
+	asserts.AssertErrReply(t, result, "ERR CONFIG SET failed (possibly related to argument 'notify-keyspace-events') - "+
+		"Invalid event class character. Use 'Ag$lshzxetKE'.")
+}
+
+func TestExpiredEvent(t *testing.T) {
+	server := NewStandaloneServer()
+	defer server.Close()
+	defer func() {
+		config.Properties.NotifyKeyspaceEvents = ""
+	}()
+	sub := subscribeKeyspace(server, "Ex")
+	conn := connection.NewFakeConn()
+	key := utils.RandString(10)
+	server.Exec(conn, utils.ToCmdLine("set", key, "1", "px", "10"))
+	expected := keyspaceMessages("__keyevent@0__:expired " + key)
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) && len(sub.Bytes()) < len(expected) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if actual := sub.Bytes(); string(actual) != string(expected) {
+		t.Errorf("expected %q, actually %q", expected, actual)
+	}
+}
+
+func TestKeyEventCallback(t *testing.T) {
+	server := NewStandaloneServer()
+	defer server.Close()
+	var mu sync.Mutex
+	var events []string
+	server.SetKeyInsertedCallback(func(dbIndex int, key string, entity *database.DataEntity) {
+		mu.Lock()
+		events = append(events, "insert "+key)
+		mu.Unlock()
+	})
+	server.SetKeyDeletedCallback(func(dbIndex int, key string, entity *database.DataEntity) {
+		mu.Lock()
+		events = append(events, "delete "+key)
+		mu.Unlock()
+	})
+	conn := connection.NewFakeConn()
+	key := utils.RandString(10)
+	server.Exec(conn, utils.ToCmdLine("set", key, "1"))
+	server.Exec(conn, utils.ToCmdLine("set", key, "2"))
+	server.Exec(conn, utils.ToCmdLine("del", key))
+	server.Exec(conn, utils.ToCmdLine("del", key))
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 2 || events[0] != "insert "+key || events[1] != "delete "+key {
+		t.Errorf("wrong events %v", events)
+	}
+}
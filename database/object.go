@@ -0,0 +1,118 @@
+package database
+
+import (
+	"github.com/Allen9012/Godis/config"
+	Dict "github.com/Allen9012/Godis/datastruct/dict"
+	List "github.com/Allen9012/Godis/datastruct/list"
+	HashSet "github.com/Allen9012/Godis/datastruct/set"
+	SortedSet "github.com/Allen9012/Godis/datastruct/sortedset"
+	Stream "github.com/Allen9012/Godis/datastruct/stream"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/interface/database"
+	"github.com/Allen9012/Godis/interface/godis"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/17
+  @desc: OBJECT ENCODING | IDLETIME | FREQ | REFCOUNT
+	OBJECT 不会更新 key 的访问时间和访问频率, 因此在 server 层执行而不是注册为普通命令
+  @modified by:
+**/
+
+// strings longer than embstrSizeLimit are encoded as raw in redis
+const embstrSizeLimit = 44
+
+// getEncoding returns the encoding name of entity used by OBJECT ENCODING
+//
+//	@Description: godis 的集合类型没有 listpack 和 intset 等紧凑编码, 返回实际使用的数据结构
+//	@param entity
+//	@return string
+func getEncoding(entity *database.DataEntity) string {
+	switch data := entity.Data.(type) {
+	case []byte:
+		if len(data) <= 20 {
+			if _, err := strconv.ParseInt(string(data), 10, 64); err == nil {
+				return "int"
+			}
+		}
+		if len(data) <= embstrSizeLimit {
+			return "embstr"
+		}
+		return "raw"
+	case List.List:
+		return "quicklist"
+	case Dict.Dict, *HashSet.Set:
+		return "hashtable"
+	case *SortedSet.SortedSet:
+		return "skiplist"
+	case *Stream.Stream:
+		return "stream"
+	}
+	return ""
+}
+
+// isLFUPolicy returns whether maxmemory-policy evicts keys by access frequency
+func isLFUPolicy() bool {
+	return strings.HasSuffix(strings.ToLower(config.Get(&config.Properties.MaxMemoryPolicy)), "-lfu")
+}
+
+// execObject
+//
+//	@Description: OBJECT ENCODING key | OBJECT IDLETIME key | OBJECT FREQ key | OBJECT REFCOUNT key
+//	与 redis 相同, 只有 lfu 策略下才能查询 FREQ, lfu 策略下不能查询 IDLETIME
+//	@param db
+//	@param args
+//	@return godis.Reply
+func execObject(db *DB, args [][]byte) godis.Reply {
+	if len(args) == 0 {
+		return protocol.MakeArgNumErrReply("object")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "encoding", "idletime", "freq", "refcount":
+	default:
+		return protocol.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try OBJECT HELP.")
+	}
+	if len(args) != 2 {
+		return protocol.MakeArgNumErrReply("object|" + subCmd)
+	}
+	key := string(args[1])
+	keys := []string{key}
+	db.RWLocks(nil, keys)
+	defer db.RWUnLocks(nil, keys)
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return protocol.MakeNullBulkReply()
+	}
+	meta, hasMeta := db.getKeyMeta(key)
+	switch subCmd {
+	case "encoding":
+		return protocol.MakeBulkReply([]byte(getEncoding(entity)))
+	case "refcount":
+		// godis 没有共享对象, 每个值只被引用一次
+		return protocol.MakeIntReply(1)
+	case "idletime":
+		if isLFUPolicy() {
+			return protocol.MakeErrReply("ERR An LFU maxmemory policy is selected, idle time not tracked. " +
+				"Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust.")
+		}
+		if !hasMeta {
+			return protocol.MakeIntReply(0)
+		}
+		return protocol.MakeIntReply(int64(meta.idleTime(time.Now()) / time.Second))
+	default: // freq
+		if !isLFUPolicy() {
+			return protocol.MakeErrReply("ERR An LFU maxmemory policy is not selected, access frequency not tracked. " +
+				"Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust.")
+		}
+		if !hasMeta {
+			return protocol.MakeIntReply(0)
+		}
+		return protocol.MakeIntReply(int64(meta.lfuValue(time.Now())))
+	}
+}
@@ -0,0 +1,130 @@
+package database
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/17
+  @desc: OBJECT and MEMORY
+  @modified by:
+**/
+
+import (
+	"github.com/Allen9012/Godis/godis/connection"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/godis/protocol/asserts"
+	"github.com/Allen9012/Godis/lib/utils"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestObjectEncoding(t *testing.T) {
+	server := NewStandaloneServer()
+	defer server.Close()
+	conn := connection.NewFakeConn()
+	server.Exec(conn, utils.ToCmdLine("flushdb"))
+	server.Exec(conn, utils.ToCmdLine("set", "int", "12345"))
+	server.Exec(conn, utils.ToCmdLine("set", "embstr", "hello"))
+	server.Exec(conn, utils.ToCmdLine("set", "raw", utils.RandString(100)))
+	server.Exec(conn, utils.ToCmdLine("rpush", "list", "a"))
+	server.Exec(conn, utils.ToCmdLine("hset", "hash", "f", "v"))
+	server.Exec(conn, utils.ToCmdLine("sadd", "set", "a"))
+	server.Exec(conn, utils.ToCmdLine("zadd", "zset", "1", "a"))
+	server.Exec(conn, utils.ToCmdLine("xadd", "stream", "*", "f", "v"))
+	encodings := map[string]string{
+		"int":    "int",
+		"embstr": "embstr",
+		"raw":    "raw",
+		"list":   "quicklist",
+		"hash":   "hashtable",
+		"set":    "hashtable",
+		"zset":   "skiplist",
+		"stream": "stream",
+	}
+	for key, encoding := range encodings {
+		result := server.Exec(conn, utils.ToCmdLine("object", "encoding", key))
+		asserts.AssertBulkReply(t, result, encoding)
+	}
+	result := server.Exec(conn, utils.ToCmdLine("object", "encoding", "missing"))
+	asserts.AssertNullBulk(t, result)
+	result = server.Exec(conn, utils.ToCmdLine("object", "refcount", "int"))
+	asserts.AssertIntReply(t, result, 1)
+	result = server.Exec(conn, utils.ToCmdLine("object", "foo", "int"))
+	asserts.AssertErrReply(t, result, "ERR unknown subcommand 'foo'. Try OBJECT HELP.")
+}
+
+func TestObjectIdleTimeAndFreq(t *testing.T) {
+	server := NewStandaloneServer()
+	defer server.Close()
+	conn := connection.NewFakeConn()
+	server.Exec(conn, utils.ToCmdLine("flushdb"))
+	server.Exec(conn, utils.ToCmdLine("set", "k", "v"))
+	meta, _ := server.mustSelectDB(0).getKeyMeta("k")
+	atomic.AddInt64(&meta.accessTime, -int64(3*time.Second/time.Millisecond))
+
+	// OBJECT won't touch the key
+	for i := 0; i < 2; i++ {
+		result := server.Exec(conn, utils.ToCmdLine("object", "idletime", "k"))
+		asserts.AssertIntReply(t, result, 3)
+	}
+	result := server.Exec(conn, utils.ToCmdLine("object", "freq", "k"))
+	asserts.AssertErrReply(t, result, "ERR An LFU maxmemory policy is not selected, access frequency not tracked. "+
+		"Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust.")
+
+	defer setMaxMemory(server, "0", "allkeys-lfu")()
+	// SET is the first access of the key
+	result = server.Exec(conn, utils.ToCmdLine("object", "freq", "k"))
+	asserts.AssertIntReply(t, result, lfuInitVal+1)
+	result = server.Exec(conn, utils.ToCmdLine("object", "idletime", "k"))
+	asserts.AssertErrReply(t, result, "ERR An LFU maxmemory policy is selected, idle time not tracked. "+
+		"Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust.")
+}
+
+func TestMemoryUsage(t *testing.T) {
+	server := NewStandaloneServer()
+	defer server.Close()
+	conn := connection.NewFakeConn()
+	server.Exec(conn, utils.ToCmdLine("flushdb"))
+	server.Exec(conn, utils.ToCmdLine("set", "small", "v"))
+	server.Exec(conn, utils.ToCmdLine("set", "large", utils.RandString(1000)))
+	small := server.Exec(conn, utils.ToCmdLine("memory", "usage", "small")).(*protocol.IntReply).Code
+	large := server.Exec(conn, utils.ToCmdLine("memory", "usage", "large")).(*protocol.IntReply).Code
+	if large < small+999 {
+		t.Errorf("usage of large key should be greater, actual %d %d", small, large)
+	}
+	result := server.Exec(conn, utils.ToCmdLine("memory", "usage", "missing"))
+	asserts.AssertNullBulk(t, result)
+
+	for i := 0; i < 100; i++ {
+		server.Exec(conn, utils.ToCmdLine("rpush", "list", strconv.Itoa(i)))
+	}
+	result = server.Exec(conn, utils.ToCmdLine("memory", "usage", "list", "samples", "0"))
+	if _, ok := result.(*protocol.IntReply); !ok {
+		t.Errorf("expect int reply, actual %s", string(result.ToBytes()))
+	}
+	result = server.Exec(conn, utils.ToCmdLine("memory", "usage", "list", "samples", "-1"))
+	asserts.AssertErrReply(t, result, "ERR value is out of range, must be positive")
+	result = server.Exec(conn, utils.ToCmdLine("memory", "usage", "list", "count", "1"))
+	asserts.AssertErrReply(t, result, "Err syntax error")
+}
+
+func TestMemoryStatsAndDoctor(t *testing.T) {
+	server := NewStandaloneServer()
+	defer server.Close()
+	conn := connection.NewFakeConn()
+	server.Exec(conn, utils.ToCmdLine("flushdb"))
+	server.Exec(conn, utils.ToCmdLine("set", "k", "v", "ex", "100"))
+	result := server.Exec(conn, utils.ToCmdLine("memory", "stats"))
+	stats := string(result.ToBytes())
+	for _, field := range []string{"total.allocated", "db.0", "overhead.hashtable.expires", "keys.count", "dataset.bytes", "fragmentation"} {
+		if !strings.Contains(stats, field) {
+			t.Errorf("memory stats should contain %s", field)
+		}
+	}
+	result = server.Exec(conn, utils.ToCmdLine("memory", "doctor"))
+	if reply, ok := result.(*protocol.BulkReply); !ok || !strings.Contains(string(reply.Arg), "Sam") {
+		t.Errorf("unexpected memory doctor reply %s", string(result.ToBytes()))
+	}
+}
@@ -31,11 +31,15 @@ func (server *StandaloneServer) bindPersister(aofHandler *aof.Persister) {
 	server.persister = aofHandler
 	// bind SaveCmdLine
 	for _, db := range server.dbSet {
-		singleDB := db.Load().(*DB)
-		singleDB.addAof = func(line CmdLine) {
-			if config.Properties.AppendOnly { // config may be changed during runtime
-				server.persister.SaveCmdLine(singleDB.index, line)
-			}
+		server.bindAddAof(db.Load().(*DB))
+	}
+}
+
+// bindAddAof makes singleDB write its commands into persister
+func (server *StandaloneServer) bindAddAof(singleDB *DB) {
+	singleDB.addAof = func(line CmdLine) {
+		if config.Get(&config.Properties.AppendOnly) { // config may be changed during runtime
+			server.persister.SaveCmdLine(singleDB.index, line)
 		}
 	}
 }
@@ -0,0 +1,197 @@
+package database
+
+import (
+	"github.com/Allen9012/Godis/aof"
+	"github.com/Allen9012/Godis/config"
+	Dict "github.com/Allen9012/Godis/datastruct/dict"
+	List "github.com/Allen9012/Godis/datastruct/list"
+	HashSet "github.com/Allen9012/Godis/datastruct/set"
+	SortedSet "github.com/Allen9012/Godis/datastruct/sortedset"
+	Stream "github.com/Allen9012/Godis/datastruct/stream"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/interface/database"
+	"github.com/Allen9012/Godis/interface/godis"
+	"github.com/Allen9012/Godis/lib/logger"
+	"github.com/Allen9012/Godis/lib/rdb"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/9/30
+  @desc: rdb 持久化: SAVE BGSAVE LASTSAVE 以及启动时加载
+  @modified by:
+**/
+
+// LoadRDB loads objects decoded from rdb file into databases, expired keys are dropped
+// Implement database.DB
+func (server *StandaloneServer) LoadRDB(dec *rdb.Decoder) error {
+	now := time.Now()
+	return dec.Parse(func(o rdb.RedisObject) bool {
+		db, errReply := server.selectDB(o.GetDBIndex())
+		if errReply != nil {
+			logger.Warn("load rdb: skip key " + o.GetKey() + " of illegal db index")
+			return true
+		}
+		expiration := o.GetExpiration()
+		if expiration != nil && expiration.Before(now) {
+			return true
+		}
+		entity := objectToEntity(o)
+		if entity == nil {
+			return true
+		}
+		db.PutEntity(o.GetKey(), entity)
+		if expiration != nil {
+			db.Expire(o.GetKey(), *expiration)
+		}
+		return true
+	})
+}
+
+// objectToEntity converts rdb object into data entity
+func objectToEntity(o rdb.RedisObject) *database.DataEntity {
+	switch obj := o.(type) {
+	case *rdb.StringObject:
+		return &database.DataEntity{Data: obj.Value}
+	case *rdb.ListObject:
+		list := List.NewQuickList()
+		for _, v := range obj.Values {
+			list.Add(v)
+		}
+		return &database.DataEntity{Data: list}
+	case *rdb.SetObject:
+		set := HashSet.Make()
+		for _, member := range obj.Members {
+			set.Add(string(member))
+		}
+		return &database.DataEntity{Data: set}
+	case *rdb.HashObject:
+		hash := Dict.MakeSimple()
+		for field, value := range obj.Hash {
+			hash.Put(field, value)
+		}
+		return &database.DataEntity{Data: hash}
+	case *rdb.ZSetObject:
+		zset := SortedSet.Make()
+		for _, e := range obj.Entries {
+			zset.Add(e.Member, e.Score)
+		}
+		return &database.DataEntity{Data: zset}
+	case *rdb.StreamObject:
+		return &database.DataEntity{Data: rdbToStream(obj.StreamData)}
+	}
+	return nil
+}
+
+// rdbToStream restores stream with metadata, consumer groups and pending entries
+func rdbToStream(data *rdb.StreamData) *Stream.Stream {
+	stream := Stream.Make()
+	for _, entry := range data.Entries {
+		_ = stream.Add(Stream.ID(entry.ID), entry.Fields)
+	}
+	stream.SetLastID(Stream.ID(data.LastID))
+	stream.SetMaxDeletedID(Stream.ID(data.MaxDeletedID))
+	stream.SetEntriesAdded(data.EntriesAdded)
+	for _, g := range data.Groups {
+		group, ok := stream.CreateGroup(g.Name, Stream.ID(g.LastID))
+		if !ok {
+			continue
+		}
+		for _, c := range g.Consumers {
+			group.CreateConsumer(c.Name, c.SeenTime)
+		}
+		for _, p := range g.Pending {
+			consumer, _ := group.CreateConsumer(p.Consumer, p.DeliveryTime)
+			pending := group.Deliver(Stream.ID(p.ID), consumer, p.DeliveryTime)
+			pending.DeliveryCount = int64(p.DeliveryCount)
+		}
+	}
+	return stream
+}
+
+// loadRdbFile loads rdb file configured by dbfilename
+func (server *StandaloneServer) loadRdbFile() error {
+	rdbFile, err := os.Open(config.Get(&config.Properties.RDBFilename))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rdbFile.Close()
+	}()
+	return server.LoadRDB(rdb.NewDecoder(rdbFile))
+}
+
+// saveRDB dumps all databases into dbfilename, only one saving can be in progress at the same time
+func (server *StandaloneServer) saveRDB() godis.Reply {
+	if !atomic.CompareAndSwapInt32(&server.rdbSaving, 0, 1) {
+		return protocol.MakeErrReply("ERR Background save already in progress")
+	}
+	defer atomic.StoreInt32(&server.rdbSaving, 0)
+	var err error
+	if server.persister != nil {
+		// 开启 aof 时从 aof 文件生成快照, 不阻塞在线数据库
+		err = server.persister.GenerateRDB(config.Get(&config.Properties.RDBFilename))
+	} else {
+		err = aof.GenerateRDB(server, config.Get(&config.Properties.RDBFilename))
+	}
+	if err != nil {
+		logger.Error("save rdb failed: " + err.Error())
+		return protocol.MakeErrReply("ERR " + err.Error())
+	}
+	atomic.StoreInt64(&server.lastSave, time.Now().Unix())
+	return protocol.MakeOkReply()
+}
+
+// execSave
+//
+//	@Description: 同步保存快照, 保存期间阻塞当前客户端
+//	@param server
+//	@param args	eg: save
+//	@return godis.Reply
+func execSave(server *StandaloneServer, args [][]byte) godis.Reply {
+	if len(args) != 0 {
+		return protocol.MakeArgNumErrReply("save")
+	}
+	return server.saveRDB()
+}
+
+// execBGSave
+//
+//	@Description: 后台保存快照
+//	@param server
+//	@param args	eg: bgsave
+//	@return godis.Reply
+func execBGSave(server *StandaloneServer, args [][]byte) godis.Reply {
+	if len(args) != 0 {
+		return protocol.MakeArgNumErrReply("bgsave")
+	}
+	if atomic.LoadInt32(&server.rdbSaving) == 1 {
+		return protocol.MakeErrReply("ERR Background save already in progress")
+	}
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				logger.Error(err)
+			}
+		}()
+		server.saveRDB()
+	}()
+	return protocol.MakeStatusReply("Background saving started")
+}
+
+// execLastSave
+//
+//	@Description: 返回最近一次成功保存快照的 unix 时间
+//	@param server
+//	@param args	eg: lastsave
+//	@return godis.Reply
+func execLastSave(server *StandaloneServer, args [][]byte) godis.Reply {
+	if len(args) != 0 {
+		return protocol.MakeArgNumErrReply("lastsave")
+	}
+	return protocol.MakeIntReply(atomic.LoadInt64(&server.lastSave))
+}
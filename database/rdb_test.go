@@ -0,0 +1,114 @@
+package database
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/9/30
+  @desc: save/bgsave/lastsave
+  @modified by:
+**/
+
+import (
+	"github.com/Allen9012/Godis/config"
+	"github.com/Allen9012/Godis/godis/connection"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/godis/protocol/asserts"
+	"github.com/Allen9012/Godis/lib/utils"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSaveAndLoadRDB(t *testing.T) {
+	filename := config.Properties.RDBFilename
+	config.Properties.RDBFilename = filepath.Join(t.TempDir(), "dump.rdb")
+	defer func() {
+		config.Properties.RDBFilename = filename
+	}()
+	server := MakeAuxiliaryServer()
+	conn := connection.NewFakeConn()
+	server.Exec(conn, utils.ToCmdLine("set", "str", "value"))
+	server.Exec(conn, utils.ToCmdLine("set", "int", "1024"))
+	server.Exec(conn, utils.ToCmdLine("expire", "str", "100"))
+	server.Exec(conn, utils.ToCmdLine("rpush", "list", "a", "b", "c"))
+	server.Exec(conn, utils.ToCmdLine("hset", "hash", "f", "v"))
+	for i := 1; i <= 5; i++ {
+		server.Exec(conn, utils.ToCmdLine("xadd", "stream", strconv.Itoa(i), "f", "v"))
+	}
+	server.Exec(conn, utils.ToCmdLine("xdel", "stream", "5"))
+	server.Exec(conn, utils.ToCmdLine("xgroup", "create", "stream", "g", "0"))
+	server.Exec(conn, utils.ToCmdLine("xreadgroup", "GROUP", "g", "alice", "COUNT", "2", "STREAMS", "stream", ">"))
+	server.Exec(conn, utils.ToCmdLine("select", "2"))
+	server.Exec(conn, utils.ToCmdLine("sadd", "set", "x", "y"))
+	server.Exec(conn, utils.ToCmdLine("zadd", "zset", "1.5", "m", "-3", "n"))
+
+	before := time.Now().Unix()
+	result := server.Exec(conn, utils.ToCmdLine("save"))
+	asserts.AssertStatusReply(t, result, "OK")
+	result = server.Exec(conn, utils.ToCmdLine("lastsave"))
+	asserts.AssertNotError(t, result)
+	if string(result.ToBytes()) < ":"+strconv.FormatInt(before, 10) {
+		t.Errorf("wrong lastsave: %s", result.ToBytes())
+	}
+
+	loaded := MakeAuxiliaryServer()
+	if err := loaded.loadRdbFile(); err != nil {
+		t.Fatal(err)
+	}
+	conn2 := connection.NewFakeConn()
+	result = loaded.Exec(conn2, utils.ToCmdLine("get", "str"))
+	asserts.AssertBulkReply(t, result, "value")
+	result = loaded.Exec(conn2, utils.ToCmdLine("get", "int"))
+	asserts.AssertBulkReply(t, result, "1024")
+	if loaded.GetExpiration(0, "str") == nil {
+		t.Error("expect ttl of str")
+	}
+	result = loaded.Exec(conn2, utils.ToCmdLine("lrange", "list", "0", "-1"))
+	asserts.AssertMultiBulkReply(t, result, []string{"a", "b", "c"})
+	result = loaded.Exec(conn2, utils.ToCmdLine("hget", "hash", "f"))
+	asserts.AssertBulkReply(t, result, "v")
+	result = loaded.Exec(conn2, utils.ToCmdLine("xlen", "stream"))
+	asserts.AssertIntReply(t, result, 4)
+	// last id is kept after the last entry deleted
+	result = loaded.Exec(conn2, utils.ToCmdLine("xadd", "stream", "5", "f", "v"))
+	asserts.AssertErrReply(t, result, "ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	result = loaded.Exec(conn2, utils.ToCmdLine("xpending", "stream", "g", "-", "+", "10", "alice"))
+	if size := len(result.(*protocol.MultiRawReply).Replies); size != 2 {
+		t.Errorf("expect 2 pending entries, actually %d", size)
+	}
+	result = loaded.Exec(conn2, utils.ToCmdLine("xreadgroup", "GROUP", "g", "bob", "STREAMS", "stream", ">"))
+	if size := len(result.(*protocol.MultiRawReply).Replies[0].(*protocol.MultiRawReply).Replies[1].(*protocol.MultiRawReply).Replies); size != 2 {
+		t.Errorf("expect 2 new entries for group, actually %d", size)
+	}
+	loaded.Exec(conn2, utils.ToCmdLine("select", "2"))
+	result = loaded.Exec(conn2, utils.ToCmdLine("scard", "set"))
+	asserts.AssertIntReply(t, result, 2)
+	result = loaded.Exec(conn2, utils.ToCmdLine("zrange", "zset", "0", "-1"))
+	asserts.AssertMultiBulkReply(t, result, []string{"n", "m"})
+	result = loaded.Exec(conn2, utils.ToCmdLine("zscore", "zset", "m"))
+	asserts.AssertBulkReply(t, result, "1.5")
+}
+
+func TestBGSave(t *testing.T) {
+	filename := config.Properties.RDBFilename
+	config.Properties.RDBFilename = filepath.Join(t.TempDir(), "dump.rdb")
+	defer func() {
+		config.Properties.RDBFilename = filename
+	}()
+	server := MakeAuxiliaryServer()
+	conn := connection.NewFakeConn()
+	server.Exec(conn, utils.ToCmdLine("set", "k", "v"))
+	result := server.Exec(conn, utils.ToCmdLine("bgsave"))
+	asserts.AssertStatusReply(t, result, "Background saving started")
+	for i := 0; i < 100 && (atomic.LoadInt32(&server.rdbSaving) == 1 || !fileExists(config.Properties.RDBFilename)); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := os.Stat(config.Properties.RDBFilename); err != nil {
+		t.Error(err)
+	}
+	result = server.Exec(conn, utils.ToCmdLine("save", "x"))
+	asserts.AssertErrReply(t, result, "ERR wrong number of arguments for 'save' command")
+}
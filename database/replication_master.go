@@ -0,0 +1,480 @@
+package database
+
+import (
+	"errors"
+	"github.com/Allen9012/Godis/config"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/interface/godis"
+	"github.com/Allen9012/Godis/lib/logger"
+	"github.com/Allen9012/Godis/lib/utils"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/3
+  @desc: 主从复制 主节点部分: PSYNC 全量/增量同步, 命令传播, REPLCONF ACK
+  @modified by:
+**/
+
+const (
+	masterRole = iota
+	slaveRole
+)
+
+const (
+	slaveStateHandShake = uint8(iota)
+	slaveStateWaitSaveEnd
+	slaveStateSendingRDB
+	slaveStateOnline
+)
+
+const (
+	bgSaveIdle = uint8(iota)
+	bgSaveRunning
+	bgSaveFinish
+)
+
+const (
+	defaultReplBacklogSize = 1 << 20
+	// master sends PING to slaves periodically so slaves can detect timeout
+	replPingSlavePeriod = 10 * time.Second
+)
+
+// slaveClient holds the state of a slave connected to this master
+type slaveClient struct {
+	conn         godis.Connection
+	state        uint8
+	offset       int64
+	lastAckTime  time.Time
+	announceIp   string
+	announcePort int
+}
+
+// replBacklog keeps the latest replication stream for partial resync
+type replBacklog struct {
+	buf []byte
+	// beginOffset is the replication offset of buf[0]
+	beginOffset int64
+	// currentOffset is the replication offset after the last byte of buf
+	currentOffset int64
+	maxSize       int
+}
+
+func makeReplBacklog(offset int64, maxSize int) *replBacklog {
+	return &replBacklog{
+		beginOffset:   offset,
+		currentOffset: offset,
+		maxSize:       maxSize,
+	}
+}
+
+// appendBytes appends bytes into backlog, the oldest bytes are dropped if backlog is full
+func (backlog *replBacklog) appendBytes(bin []byte) {
+	backlog.buf = append(backlog.buf, bin...)
+	backlog.currentOffset += int64(len(bin))
+	if overflow := len(backlog.buf) - backlog.maxSize; overflow > 0 {
+		// copy to release the underlying array
+		backlog.buf = append([]byte(nil), backlog.buf[overflow:]...)
+		backlog.beginOffset += int64(overflow)
+	}
+}
+
+// isValidOffset returns whether the stream after offset is still in the backlog
+func (backlog *replBacklog) isValidOffset(offset int64) bool {
+	return offset >= backlog.beginOffset && offset <= backlog.currentOffset
+}
+
+// getSnapshotAfter returns stream after the given offset and current offset
+func (backlog *replBacklog) getSnapshotAfter(offset int64) ([]byte, int64) {
+	begin := offset - backlog.beginOffset
+	return append([]byte(nil), backlog.buf[begin:]...), backlog.currentOffset
+}
+
+type masterStatus struct {
+	mu      sync.RWMutex
+	replId  string
+	backlog *replBacklog
+	// all connected slaves, including slaves waiting for full sync
+	slaveMap     map[godis.Connection]*slaveClient
+	waitSlaves   map[*slaveClient]struct{}
+	onlineSlaves map[*slaveClient]struct{}
+	bgSaveState  uint8
+	rdbFilename  string
+	// snapshotOffset is the replication offset when the rdb file was taken
+	snapshotOffset int64
+	// aofListener receives commands from aof persister, it is nil until the first slave asks for full sync
+	aofListener *replAofListener
+	lastPing    time.Time
+}
+
+// replAofListener forwards write commands to backlog and online slaves
+type replAofListener struct {
+	server *StandaloneServer
+}
+
+// Callback receives commands written into aof file
+// Implement aof.Listener
+func (listener *replAofListener) Callback(cmdLines []CmdLine) {
+	status := listener.server.masterStatus
+	status.mu.Lock()
+	defer status.mu.Unlock()
+	for _, cmdLine := range cmdLines {
+		status.feed(protocol.MakeMultiBulkReply(cmdLine).ToBytes())
+	}
+}
+
+// feed appends bytes into replication stream, invoker should hold mu
+func (status *masterStatus) feed(data []byte) {
+	status.backlog.appendBytes(data)
+	for slave := range status.onlineSlaves {
+		if _, err := slave.conn.Write(data); err != nil {
+			logger.Errorf("send to slave %s failed: %v", slave.conn.RemoteAddr(), err)
+		}
+	}
+}
+
+func (server *StandaloneServer) initMaster(offset int64) {
+	backlogSize := config.Get(&config.Properties.ReplBacklogSize)
+	if backlogSize <= 0 {
+		backlogSize = defaultReplBacklogSize
+	}
+	server.masterStatus = &masterStatus{
+		replId:       utils.RandString(40),
+		backlog:      makeReplBacklog(offset, backlogSize),
+		slaveMap:     make(map[godis.Connection]*slaveClient),
+		waitSlaves:   make(map[*slaveClient]struct{}),
+		onlineSlaves: make(map[*slaveClient]struct{}),
+		bgSaveState:  bgSaveIdle,
+	}
+}
+
+// stopMaster forgets all slaves and stops command propagation, it is called when this node becomes a slave
+func (server *StandaloneServer) stopMaster() {
+	status := server.masterStatus
+	status.mu.Lock()
+	listener := status.aofListener
+	status.aofListener = nil
+	if status.rdbFilename != "" {
+		_ = os.Remove(status.rdbFilename)
+		status.rdbFilename = ""
+	}
+	status.bgSaveState = bgSaveIdle
+	status.slaveMap = make(map[godis.Connection]*slaveClient)
+	status.waitSlaves = make(map[*slaveClient]struct{})
+	status.onlineSlaves = make(map[*slaveClient]struct{})
+	status.mu.Unlock()
+	// persister calls listener while holding its lock, so remove listener after releasing mu to avoid deadlock
+	if listener != nil && server.persister != nil {
+		server.persister.RemoveListener(listener)
+	}
+}
+
+// getOrCreateSlave returns the slaveClient of the connection, invoker should hold mu
+func (status *masterStatus) getOrCreateSlave(c godis.Connection) *slaveClient {
+	slave := status.slaveMap[c]
+	if slave == nil {
+		slave = &slaveClient{
+			conn:        c,
+			state:       slaveStateHandShake,
+			lastAckTime: time.Now(),
+		}
+		status.slaveMap[c] = slave
+	}
+	return slave
+}
+
+// removeSlave is called after the connection with slave closed
+func (server *StandaloneServer) removeSlave(c godis.Connection) {
+	status := server.masterStatus
+	status.mu.Lock()
+	defer status.mu.Unlock()
+	slave := status.slaveMap[c]
+	if slave == nil {
+		return
+	}
+	delete(status.slaveMap, c)
+	delete(status.waitSlaves, slave)
+	delete(status.onlineSlaves, slave)
+}
+
+// setSlaveOnline starts to send the replication stream to slave, invoker should hold mu
+func (status *masterStatus) setSlaveOnline(slave *slaveClient, offset int64) {
+	slave.state = slaveStateOnline
+	slave.offset = offset
+	status.onlineSlaves[slave] = struct{}{}
+}
+
+// execPSync
+//
+//	@Description: 从节点请求同步, 能增量同步则发送 backlog, 否则触发 bgsave 全量同步
+//	@receiver server
+//	@param c	与从节点的连接
+//	@param args	eg: psync replid offset | psync ? -1
+//	@return godis.Reply
+func (server *StandaloneServer) execPSync(c godis.Connection, args [][]byte) godis.Reply {
+	if len(args) != 2 {
+		return protocol.MakeArgNumErrReply("psync")
+	}
+	if server.getRole() == slaveRole {
+		return protocol.MakeErrReply("ERR chained replication is not supported")
+	}
+	if server.persister == nil {
+		return protocol.MakeErrReply("ERR replication requires appendonly to be enabled on master")
+	}
+	replId := string(args[0])
+	// psync offset is the offset of the next byte slave wants
+	offset, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	c.SetSlave()
+	status := server.masterStatus
+	status.mu.Lock()
+	defer status.mu.Unlock()
+	slave := status.getOrCreateSlave(c)
+	if status.tryPartialSync(slave, replId, offset-1) {
+		return protocol.MakeNoReply()
+	}
+	// full resync
+	switch status.bgSaveState {
+	case bgSaveFinish:
+		// reuse the latest snapshot if the stream after it is still in backlog
+		if status.backlog.isValidOffset(status.snapshotOffset) {
+			slave.state = slaveStateSendingRDB
+			go server.fullSyncWithSlave(slave)
+			break
+		}
+		fallthrough
+	case bgSaveIdle:
+		status.bgSaveState = bgSaveRunning
+		go func() {
+			defer func() {
+				if err := recover(); err != nil {
+					logger.Error(err)
+				}
+			}()
+			if err := server.saveForReplication(); err != nil {
+				logger.Error("bgsave for replication failed: " + err.Error())
+			}
+		}()
+		fallthrough
+	case bgSaveRunning:
+		slave.state = slaveStateWaitSaveEnd
+		status.waitSlaves[slave] = struct{}{}
+	}
+	return protocol.MakeNoReply()
+}
+
+// tryPartialSync sends backlog after offset to slave if possible, invoker should hold mu
+func (status *masterStatus) tryPartialSync(slave *slaveClient, replId string, offset int64) bool {
+	if status.aofListener == nil || replId != status.replId || !status.backlog.isValidOffset(offset) {
+		return false
+	}
+	header := "+CONTINUE " + status.replId + protocol.CRLF
+	if _, err := slave.conn.Write([]byte(header)); err != nil {
+		logger.Errorf("send to slave %s failed: %v", slave.conn.RemoteAddr(), err)
+		return true
+	}
+	data, currentOffset := status.backlog.getSnapshotAfter(offset)
+	if _, err := slave.conn.Write(data); err != nil {
+		logger.Errorf("send to slave %s failed: %v", slave.conn.RemoteAddr(), err)
+		return true
+	}
+	status.setSlaveOnline(slave, currentOffset)
+	return true
+}
+
+// saveForReplication generates rdb snapshot and sends it to waiting slaves
+func (server *StandaloneServer) saveForReplication() error {
+	status := server.masterStatus
+	rdbFile, err := os.CreateTemp(config.GetTmpDir(), "*.rdb")
+	if err != nil {
+		server.abortWaitingSlaves()
+		return err
+	}
+	_ = rdbFile.Close()
+	filename := rdbFile.Name()
+
+	status.mu.Lock()
+	if status.aofListener == nil {
+		status.aofListener = &replAofListener{server: server}
+	}
+	listener := status.aofListener
+	status.mu.Unlock()
+
+	var snapshotOffset int64
+	err = server.persister.GenerateRDBForReplication(filename, listener, func() {
+		// aof 暂停期间记录快照对应的复制偏移量
+		status.mu.RLock()
+		snapshotOffset = status.backlog.currentOffset
+		status.mu.RUnlock()
+	})
+	if err != nil {
+		_ = os.Remove(filename)
+		server.abortWaitingSlaves()
+		return err
+	}
+
+	status.mu.Lock()
+	if status.rdbFilename != "" {
+		_ = os.Remove(status.rdbFilename)
+	}
+	status.rdbFilename = filename
+	status.snapshotOffset = snapshotOffset
+	status.bgSaveState = bgSaveFinish
+	waitSlaves := status.waitSlaves
+	status.waitSlaves = make(map[*slaveClient]struct{})
+	for slave := range waitSlaves {
+		slave.state = slaveStateSendingRDB
+	}
+	status.mu.Unlock()
+
+	for slave := range waitSlaves {
+		go server.fullSyncWithSlave(slave)
+	}
+	return nil
+}
+
+// abortWaitingSlaves resets bgsave state after bgsave failed, waiting slaves will retry psync later
+func (server *StandaloneServer) abortWaitingSlaves() {
+	status := server.masterStatus
+	status.mu.Lock()
+	defer status.mu.Unlock()
+	status.bgSaveState = bgSaveIdle
+	for slave := range status.waitSlaves {
+		_, _ = slave.conn.Write(protocol.MakeErrReply("ERR bgsave for replication failed").ToBytes())
+	}
+	status.waitSlaves = make(map[*slaveClient]struct{})
+}
+
+// fullSyncWithSlave sends rdb file and following backlog to slave
+func (server *StandaloneServer) fullSyncWithSlave(slave *slaveClient) {
+	if err := server.doFullSyncWithSlave(slave); err != nil {
+		logger.Errorf("full sync with slave %s failed: %v", slave.conn.RemoteAddr(), err)
+	}
+}
+
+func (server *StandaloneServer) doFullSyncWithSlave(slave *slaveClient) error {
+	status := server.masterStatus
+	status.mu.RLock()
+	replId := status.replId
+	snapshotOffset := status.snapshotOffset
+	rdbFile, err := os.Open(status.rdbFilename)
+	status.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rdbFile.Close()
+	}()
+	rdbInfo, err := rdbFile.Stat()
+	if err != nil {
+		return err
+	}
+	// +FULLRESYNC replid offset\r\n$size\r\n<rdb>, there is no CRLF after rdb
+	header := "+FULLRESYNC " + replId + " " + strconv.FormatInt(snapshotOffset, 10) + protocol.CRLF +
+		"$" + strconv.FormatInt(rdbInfo.Size(), 10) + protocol.CRLF
+	if _, err := slave.conn.Write([]byte(header)); err != nil {
+		return err
+	}
+	if _, err := io.Copy(slave.conn, rdbFile); err != nil {
+		return err
+	}
+
+	status.mu.Lock()
+	defer status.mu.Unlock()
+	if status.slaveMap[slave.conn] != slave {
+		return errors.New("slave disconnected")
+	}
+	if !status.backlog.isValidOffset(snapshotOffset) {
+		// the stream after snapshot has been dropped, slave has to retry
+		delete(status.slaveMap, slave.conn)
+		return errors.New("backlog overflowed during full sync")
+	}
+	data, currentOffset := status.backlog.getSnapshotAfter(snapshotOffset)
+	if _, err := slave.conn.Write(data); err != nil {
+		return err
+	}
+	status.setSlaveOnline(slave, currentOffset)
+	return nil
+}
+
+// execReplConf
+//
+//	@Description: 从节点上报信息, ACK 不需要回复
+//	@receiver server
+//	@param c
+//	@param args	eg: replconf listening-port 6380 | replconf capa psync2 | replconf ack 1024
+//	@return godis.Reply
+func (server *StandaloneServer) execReplConf(c godis.Connection, args [][]byte) godis.Reply {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return protocol.MakeSyntaxErrReply()
+	}
+	status := server.masterStatus
+	status.mu.Lock()
+	defer status.mu.Unlock()
+	for i := 0; i < len(args); i += 2 {
+		key := strings.ToLower(string(args[i]))
+		value := string(args[i+1])
+		switch key {
+		case "ack":
+			offset, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return protocol.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			if slave := status.slaveMap[c]; slave != nil {
+				slave.offset = offset
+				slave.lastAckTime = time.Now()
+			}
+			return protocol.MakeNoReply()
+		case "listening-port":
+			port, err := strconv.Atoi(value)
+			if err != nil {
+				return protocol.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			status.getOrCreateSlave(c).announcePort = port
+		case "ip-address":
+			status.getOrCreateSlave(c).announceIp = value
+		case "capa":
+			// only psync2 is supported, other capabilities are ignored
+		default:
+			return protocol.MakeErrReply("ERR Unrecognized REPLCONF option: " + key)
+		}
+	}
+	return protocol.MakeOkReply()
+}
+
+// masterCron pings slaves and stops sending stream to slaves which haven't acked for a long time
+func (server *StandaloneServer) masterCron() {
+	if server.getRole() != masterRole {
+		return
+	}
+	status := server.masterStatus
+	status.mu.Lock()
+	defer status.mu.Unlock()
+	timeout := time.Duration(config.Get(&config.Properties.ReplTimeout)) * time.Second
+	if timeout <= 0 {
+		timeout = defaultReplTimeout
+	}
+	now := time.Now()
+	for slave := range status.onlineSlaves {
+		if now.Sub(slave.lastAckTime) > timeout {
+			logger.Info("slave timeout: " + slave.conn.RemoteAddr())
+			delete(status.onlineSlaves, slave)
+			delete(status.slaveMap, slave.conn)
+			// 断开连接使从节点发现并重新 PSYNC, 否则从节点会一直保持半开的连接
+			_ = slave.conn.Disconnect()
+		}
+	}
+	if status.aofListener != nil && now.Sub(status.lastPing) >= replPingSlavePeriod {
+		status.feed(protocol.MakeMultiBulkReply(utils.ToCmdLine("PING")).ToBytes())
+		status.lastPing = now
+	}
+}
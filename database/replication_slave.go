@@ -0,0 +1,407 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/Allen9012/Godis/config"
+	"github.com/Allen9012/Godis/godis/connection"
+	"github.com/Allen9012/Godis/godis/parser"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/interface/godis"
+	"github.com/Allen9012/Godis/lib/logger"
+	"github.com/Allen9012/Godis/lib/rdb"
+	"github.com/Allen9012/Godis/lib/utils"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/3
+  @desc: 主从复制 从节点部分: REPLICAOF, 握手, 加载主节点快照, 接收命令流
+  @modified by:
+**/
+
+const (
+	defaultReplTimeout = 60 * time.Second
+	// slave sends REPLCONF ACK to master every second
+	replAckPeriod = time.Second
+	// slave reconnects master after the link is broken
+	replRetryPeriod = time.Second
+)
+
+type slaveStatus struct {
+	// configMu serializes REPLICAOF commands
+	configMu sync.Mutex
+	cancel   context.CancelFunc
+	// running is done after the goroutine syncing with master exited
+	running sync.WaitGroup
+
+	// mutex protects the fields below
+	mutex sync.Mutex
+
+	masterHost string
+	masterPort int
+	// replId and replOffset identify the replication stream received, used for partial resync
+	replId     string
+	replOffset int64
+	// linkUp is 1 while the slave is receiving stream from master
+	linkUp       int32
+	lastRecvTime time.Time
+}
+
+// getRole returns masterRole or slaveRole
+func (server *StandaloneServer) getRole() int32 {
+	return atomic.LoadInt32(&server.role)
+}
+
+// execSlaveOf
+//
+//	@Description: 成为某个节点的从节点, 或者通过 NO ONE 重新成为主节点
+//	@receiver server
+//	@param args	eg: replicaof 127.0.0.1 6379 | replicaof no one
+//	@return godis.Reply
+func (server *StandaloneServer) execSlaveOf(args [][]byte) godis.Reply {
+	if len(args) != 2 {
+		return protocol.MakeArgNumErrReply("replicaof")
+	}
+	if strings.ToLower(string(args[0])) == "no" && strings.ToLower(string(args[1])) == "one" {
+		server.slaveOfNone()
+		return protocol.MakeOkReply()
+	}
+	host := string(args[0])
+	port, err := strconv.Atoi(string(args[1]))
+	if err != nil || port <= 0 || port > 65535 {
+		return protocol.MakeErrReply("ERR Invalid master port")
+	}
+	status := server.slaveStatus
+	status.configMu.Lock()
+	defer status.configMu.Unlock()
+	status.mutex.Lock()
+	connected := server.getRole() == slaveRole && status.masterHost == host && status.masterPort == port
+	status.mutex.Unlock()
+	if connected {
+		return protocol.MakeStatusReply("OK Already connected to specified master")
+	}
+	server.stopSlave()
+	if atomic.SwapInt32(&server.role, slaveRole) == masterRole {
+		server.stopMaster()
+	}
+	status.mutex.Lock()
+	status.masterHost = host
+	status.masterPort = port
+	// a new master means a new replication stream
+	status.replId = ""
+	status.mutex.Unlock()
+	ctx, cancel := context.WithCancel(context.Background())
+	status.cancel = cancel
+	status.running.Add(1)
+	go server.syncWithMasterLoop(ctx)
+	return protocol.MakeOkReply()
+}
+
+// slaveOfNone turns this node into master, data received from old master is kept
+func (server *StandaloneServer) slaveOfNone() {
+	status := server.slaveStatus
+	status.configMu.Lock()
+	defer status.configMu.Unlock()
+	if server.getRole() == masterRole {
+		return
+	}
+	server.stopSlave()
+	status.mutex.Lock()
+	offset := status.replOffset
+	status.masterHost = ""
+	status.masterPort = 0
+	status.replId = ""
+	status.mutex.Unlock()
+	server.initMaster(offset)
+	atomic.StoreInt32(&server.role, masterRole)
+}
+
+// stopSlave stops syncing with master and waits until the goroutine exited, invoker should hold configMu
+func (server *StandaloneServer) stopSlave() {
+	status := server.slaveStatus
+	if status.cancel != nil {
+		status.cancel()
+		status.cancel = nil
+	}
+	status.running.Wait()
+}
+
+// syncWithMasterLoop keeps syncing with master until ctx is canceled, it reconnects master after link broken
+func (server *StandaloneServer) syncWithMasterLoop(ctx context.Context) {
+	defer server.slaveStatus.running.Done()
+	for {
+		err := server.syncWithMaster(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.Error("sync with master failed: " + err.Error())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(replRetryPeriod):
+		}
+	}
+}
+
+// masterLink wraps the tcp connection with master
+type masterLink struct {
+	ctx     context.Context
+	conn    net.Conn
+	ch      <-chan *parser.PayLoad
+	timeout time.Duration
+	// protect conn from concurrent writing by acker
+	mu sync.Mutex
+}
+
+func (link *masterLink) send(cmdLine CmdLine) error {
+	link.mu.Lock()
+	defer link.mu.Unlock()
+	_, err := link.conn.Write(protocol.MakeMultiBulkReply(cmdLine).ToBytes())
+	return err
+}
+
+func (link *masterLink) recv() (godis.Reply, error) {
+	select {
+	case payload, ok := <-link.ch:
+		if !ok {
+			return nil, errors.New("connection closed")
+		}
+		if payload.Err != nil {
+			return nil, payload.Err
+		}
+		return payload.Data, nil
+	case <-time.After(link.timeout):
+		return nil, errors.New("master timeout")
+	case <-link.ctx.Done():
+		return nil, link.ctx.Err()
+	}
+}
+
+// request sends command to master and returns error if master replied error
+func (link *masterLink) request(cmdLine CmdLine) (godis.Reply, error) {
+	if err := link.send(cmdLine); err != nil {
+		return nil, err
+	}
+	reply, err := link.recv()
+	if err != nil {
+		return nil, err
+	}
+	if protocol.IsErrorReply(reply) {
+		return nil, errors.New(strings.TrimSpace(string(reply.ToBytes()[1:])))
+	}
+	return reply, nil
+}
+
+// syncWithMaster does handshake, psync and then receives the stream until the link is broken
+func (server *StandaloneServer) syncWithMaster(ctx context.Context) error {
+	status := server.slaveStatus
+	status.mutex.Lock()
+	addr := status.masterHost + ":" + strconv.Itoa(status.masterPort)
+	status.mutex.Unlock()
+	timeout := time.Duration(config.Get(&config.Properties.ReplTimeout)) * time.Second
+	if timeout <= 0 {
+		timeout = defaultReplTimeout
+	}
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return err
+	}
+	linkCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-linkCtx.Done()
+		_ = conn.Close()
+	}()
+	link := &masterLink{
+		ctx:     linkCtx,
+		conn:    conn,
+		ch:      parser.ParseStream(conn),
+		timeout: timeout,
+	}
+	if err := server.handshake(link); err != nil {
+		return err
+	}
+	if err := server.psync(link); err != nil {
+		return err
+	}
+	atomic.StoreInt32(&status.linkUp, 1)
+	defer atomic.StoreInt32(&status.linkUp, 0)
+	logger.Info("connected with master " + addr)
+	go server.ackLoop(link)
+	return server.receiveStream(link)
+}
+
+func (server *StandaloneServer) handshake(link *masterLink) error {
+	if masterAuth := config.Get(&config.Properties.MasterAuth); masterAuth != "" {
+		if _, err := link.request(utils.ToCmdLine("AUTH", masterAuth)); err != nil {
+			return errors.New("auth failed: " + err.Error())
+		}
+	}
+	if _, err := link.request(utils.ToCmdLine("PING")); err != nil {
+		return errors.New("ping failed: " + err.Error())
+	}
+	port := config.Get(&config.Properties.SlaveAnnouncePort)
+	if port == 0 {
+		port = config.Properties.Port
+	}
+	if _, err := link.request(utils.ToCmdLine("REPLCONF", "listening-port", strconv.Itoa(port))); err != nil {
+		return err
+	}
+	if announceIP := config.Get(&config.Properties.SlaveAnnounceIP); announceIP != "" {
+		if _, err := link.request(utils.ToCmdLine("REPLCONF", "ip-address", announceIP)); err != nil {
+			return err
+		}
+	}
+	_, err := link.request(utils.ToCmdLine("REPLCONF", "capa", "psync2"))
+	return err
+}
+
+// psync asks master for partial resync first, and loads the rdb snapshot if master decides to do full resync
+func (server *StandaloneServer) psync(link *masterLink) error {
+	status := server.slaveStatus
+	status.mutex.Lock()
+	replId := status.replId
+	offset := status.replOffset
+	status.mutex.Unlock()
+	psyncCmd := utils.ToCmdLine("PSYNC", "?", "-1")
+	if replId != "" {
+		psyncCmd = utils.ToCmdLine("PSYNC", replId, strconv.FormatInt(offset+1, 10))
+	}
+	reply, err := link.request(psyncCmd)
+	if err != nil {
+		return err
+	}
+	statusReply, ok := reply.(*protocol.StatusReply)
+	if !ok {
+		return errors.New("illegal psync reply: " + string(reply.ToBytes()))
+	}
+	headers := strings.Fields(statusReply.Status)
+	switch {
+	case len(headers) == 3 && headers[0] == "FULLRESYNC":
+		masterOffset, err := strconv.ParseInt(headers[2], 10, 64)
+		if err != nil {
+			return errors.New("illegal psync reply: " + statusReply.Status)
+		}
+		// rdb 文件紧跟在 FULLRESYNC 之后
+		payload, err := link.recv()
+		if err != nil {
+			return err
+		}
+		rdbReply, ok := payload.(*protocol.BulkReply)
+		if !ok {
+			return errors.New("illegal rdb payload: " + string(payload.ToBytes()))
+		}
+		if err := server.loadMasterRDB(rdbReply.Arg); err != nil {
+			return errors.New("load rdb from master failed: " + err.Error())
+		}
+		logger.Info("full resync with master finished")
+		status.mutex.Lock()
+		status.replId = headers[1]
+		status.replOffset = masterOffset
+		status.mutex.Unlock()
+	case len(headers) >= 1 && headers[0] == "CONTINUE":
+		if len(headers) == 2 {
+			status.mutex.Lock()
+			status.replId = headers[1]
+			status.mutex.Unlock()
+		}
+		logger.Info("partial resync with master")
+	default:
+		return errors.New("illegal psync reply: " + statusReply.Status)
+	}
+	return nil
+}
+
+// loadMasterRDB replaces all databases with the snapshot from master
+func (server *StandaloneServer) loadMasterRDB(data []byte) error {
+	rdbHolder := MakeAuxiliaryServer()
+	if err := rdbHolder.LoadRDB(rdb.NewDecoder(bytes.NewReader(data))); err != nil {
+		return err
+	}
+	for i, holder := range rdbHolder.dbSet {
+		newDB := holder.Load().(*DB)
+		newDB.index = i
+		newDB.stats = server.stats
+		newDB.notifier = server.notifier
+		newDB.insertCallback = server.insertCallback
+		newDB.deleteCallback = server.deleteCallback
+		if server.persister != nil {
+			server.bindAddAof(newDB)
+		}
+		server.dbSet[i].Store(newDB)
+	}
+	if server.persister != nil {
+		// aof file must describe the new dataset
+		return server.persister.RewriteFrom(server)
+	}
+	return nil
+}
+
+// receiveStream executes commands from master and updates replication offset
+func (server *StandaloneServer) receiveStream(link *masterLink) error {
+	status := server.slaveStatus
+	masterConn := &connection.Connection{} // only used for save dbIndex
+	masterConn.SetMaster()
+	for {
+		reply, err := link.recv()
+		if err != nil {
+			return err
+		}
+		cmd, ok := reply.(*protocol.MultiBulkReply)
+		if !ok || len(cmd.Args) == 0 {
+			return errors.New("illegal command from master: " + string(reply.ToBytes()))
+		}
+		size := int64(len(cmd.ToBytes()))
+		cmdName := strings.ToLower(string(cmd.Args[0]))
+		switch {
+		case cmdName == "ping":
+		case cmdName == "replconf" && len(cmd.Args) >= 2 && strings.ToLower(string(cmd.Args[1])) == "getack":
+			status.mutex.Lock()
+			offset := status.replOffset
+			status.mutex.Unlock()
+			if err := link.send(utils.ToCmdLine("REPLCONF", "ACK", strconv.FormatInt(offset, 10))); err != nil {
+				return err
+			}
+		default:
+			result := server.Exec(masterConn, cmd.Args)
+			if protocol.IsErrorReply(result) {
+				logger.Error("exec command from master failed: " + string(result.ToBytes()))
+			}
+		}
+		status.mutex.Lock()
+		status.replOffset += size
+		status.lastRecvTime = time.Now()
+		status.mutex.Unlock()
+	}
+}
+
+// ackLoop reports replication offset to master periodically
+func (server *StandaloneServer) ackLoop(link *masterLink) {
+	ticker := time.NewTicker(replAckPeriod)
+	defer ticker.Stop()
+	status := server.slaveStatus
+	for {
+		select {
+		case <-ticker.C:
+			status.mutex.Lock()
+			offset := status.replOffset
+			status.mutex.Unlock()
+			if err := link.send(utils.ToCmdLine("REPLCONF", "ACK", strconv.FormatInt(offset, 10))); err != nil {
+				return
+			}
+		case <-link.ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package database
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/3
+  @desc: 主从复制
+  @modified by:
+**/
+
+import (
+	"bytes"
+	"github.com/Allen9012/Godis/config"
+	"github.com/Allen9012/Godis/godis/connection"
+	"github.com/Allen9012/Godis/godis/parser"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/godis/protocol/asserts"
+	"github.com/Allen9012/Godis/lib/utils"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestReplBacklog(t *testing.T) {
+	backlog := makeReplBacklog(100, 8)
+	backlog.appendBytes([]byte("abcde"))
+	if !backlog.isValidOffset(100) || !backlog.isValidOffset(105) || backlog.isValidOffset(106) {
+		t.Error("wrong valid offset")
+	}
+	data, offset := backlog.getSnapshotAfter(102)
+	if string(data) != "cde" || offset != 105 {
+		t.Errorf("wrong snapshot: %s %d", data, offset)
+	}
+	// backlog is full, the oldest bytes are dropped
+	backlog.appendBytes([]byte("fghij"))
+	if backlog.isValidOffset(101) || !backlog.isValidOffset(102) {
+		t.Error("wrong valid offset after overflow")
+	}
+	data, offset = backlog.getSnapshotAfter(102)
+	if string(data) != "cdefghij" || offset != 110 {
+		t.Errorf("wrong snapshot: %s %d", data, offset)
+	}
+}
+
+// serveForTest serves server on a random local port until the listener closed
+func serveForTest(t *testing.T, server *StandaloneServer) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				client := connection.NewConn(conn)
+				defer server.AfterClientClose(client)
+				for payload := range parser.ParseStream(conn) {
+					if payload.Err != nil {
+						return
+					}
+					cmd, ok := payload.Data.(*protocol.MultiBulkReply)
+					if !ok {
+						continue
+					}
+					_, _ = client.Write(server.Exec(client, cmd.Args).ToBytes())
+				}
+			}()
+		}
+	}()
+	return listener
+}
+
+// waitBulkReply waits until key of the server equals to value
+func waitBulkReply(t *testing.T, server *StandaloneServer, conn *connection.FakeConn, key string, value string) {
+	expected := protocol.MakeBulkReply([]byte(value)).ToBytes()
+	var actual []byte
+	for i := 0; i < 500; i++ {
+		actual = server.Exec(conn, utils.ToCmdLine("get", key)).ToBytes()
+		if bytes.Equal(actual, expected) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("expect %s to be %s, actual: %s", key, value, actual)
+}
+
+func TestReplication(t *testing.T) {
+	tmpDir := t.TempDir()
+	aofFilename := config.Properties.AppendFilename
+	defer func() {
+		config.Properties.AppendFilename = aofFilename
+	}()
+	config.Properties.AppendFilename = filepath.Join(tmpDir, "master.aof")
+	master := NewStandaloneServer()
+	defer master.Close()
+	config.Properties.AppendFilename = filepath.Join(tmpDir, "slave.aof")
+	slave := NewStandaloneServer()
+	defer slave.Close()
+	listener := serveForTest(t, master)
+	defer func() {
+		_ = listener.Close()
+	}()
+
+	masterConn := connection.NewFakeConn()
+	slaveConn := connection.NewFakeConn()
+	master.Exec(masterConn, utils.ToCmdLine("set", "before", "1"))
+	master.Exec(masterConn, utils.ToCmdLine("rpush", "list", "a", "b"))
+	slave.Exec(slaveConn, utils.ToCmdLine("set", "stale", "1"))
+
+	addr := listener.Addr().(*net.TCPAddr)
+	result := slave.Exec(slaveConn, utils.ToCmdLine("replicaof", addr.IP.String(), strconv.Itoa(addr.Port)))
+	asserts.AssertStatusReply(t, result, "OK")
+	// full sync
+	waitBulkReply(t, slave, slaveConn, "before", "1")
+	result = slave.Exec(slaveConn, utils.ToCmdLine("lrange", "list", "0", "-1"))
+	asserts.AssertMultiBulkReply(t, result, []string{"a", "b"})
+	result = slave.Exec(slaveConn, utils.ToCmdLine("exists", "stale"))
+	asserts.AssertIntReply(t, result, 0)
+
+	// command propagation
+	master.Exec(masterConn, utils.ToCmdLine("set", "after", "2"))
+	master.Exec(masterConn, utils.ToCmdLine("select", "1"))
+	master.Exec(masterConn, utils.ToCmdLine("set", "db1", "3"))
+	waitBulkReply(t, slave, slaveConn, "after", "2")
+	slave.Exec(slaveConn, utils.ToCmdLine("select", "1"))
+	waitBulkReply(t, slave, slaveConn, "db1", "3")
+
+	result = slave.Exec(slaveConn, utils.ToCmdLine("set", "k", "v"))
+	asserts.AssertErrReply(t, result, "READONLY You can't write against a read only replica.")
+	result = slave.Exec(slaveConn, utils.ToCmdLine("psync", "?", "-1"))
+	asserts.AssertErrReply(t, result, "ERR chained replication is not supported")
+
+	result = slave.Exec(slaveConn, utils.ToCmdLine("replicaof", "no", "one"))
+	asserts.AssertStatusReply(t, result, "OK")
+	result = slave.Exec(slaveConn, utils.ToCmdLine("set", "k", "v"))
+	asserts.AssertStatusReply(t, result, "OK")
+	result = slave.Exec(slaveConn, utils.ToCmdLine("replicaof", "127.0.0.1", "x"))
+	asserts.AssertErrReply(t, result, "ERR Invalid master port")
+}
+
+func TestSlaveTimeout(t *testing.T) {
+	server := NewStandaloneServer()
+	defer server.Close()
+	conn := connection.NewFakeConn()
+	conn.SetSlave()
+	status := server.masterStatus
+	status.mu.Lock()
+	slave := status.getOrCreateSlave(conn)
+	status.setSlaveOnline(slave, 0)
+	slave.lastAckTime = time.Now().Add(-time.Hour)
+	status.mu.Unlock()
+
+	server.masterCron()
+	status.mu.RLock()
+	_, exists := status.slaveMap[conn]
+	status.mu.RUnlock()
+	if exists {
+		t.Error("expect slave removed after timeout")
+	}
+	// connection is closed so that the slave reconnects
+	if _, err := conn.Write([]byte("PING")); err == nil {
+		t.Error("expect connection with slave closed")
+	}
+}
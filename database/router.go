@@ -12,7 +12,6 @@ var cmdTable = make(map[string]*command)
 type command struct {
 	name     string
 	executor ExecFunc // 每一个command会有一个执行方法，实现执行方法
-	// TODO 优化pre和undo方法
 	// prepare returns related keys command
 	prepare PreFunc
 	// undo generates undo-log before command actually executed, in case the command needs to be rolled back
@@ -39,33 +38,29 @@ const (
 	flagSpecial  // command invoked in Exec
 )
 
-func registerCommand(name string, executor ExecFunc, arity int, flags int) {
+// registerCommand registers a normal command, which only read or modify a limited number of keys
+func registerCommand(name string, executor ExecFunc, prepare PreFunc, rollback UndoFunc, arity int, flags int) *command {
 	name = strings.ToLower(name)
-	cmdTable[name] = &command{
+	cmd := &command{
 		name:     name,
 		executor: executor,
-		//prepare:  prepare,
-		//undo:     rollback,
-		arity: arity,
-		flags: flags,
+		prepare:  prepare,
+		undo:     rollback,
+		arity:    arity,
+		flags:    flags,
 	}
+	cmdTable[name] = cmd
+	return cmd
 }
 
-// TODO 使用时Extra的优化
-//// registerCommand registers a normal command, which only read or modify a limited number of keys
-//func registerCommand(name string, executor ExecFunc, prepare PreFunc, rollback UndoFunc, arity int, flags int) *command {
-//	name = strings.ToLower(name)
-//	cmd := &command{
-//		name:     name,
-//		executor: executor,
-//		prepare:  prepare,
-//		undo:     rollback,
-//		arity:    arity,
-//		flags:    flags,
-//	}
-//	cmdTable[name] = cmd
-//	return cmd
-//}
+// isWriteCommand returns whether the registered command may modify data
+func isWriteCommand(name string) bool {
+	cmd, ok := cmdTable[name]
+	if !ok {
+		return false
+	}
+	return cmd.flags&flagReadOnly == 0
+}
 
 func (cmd *command) attachCommandExtra(signs []string, firstKey int, lastKey int, keyStep int) {
 	cmd.extra = &commandExtra{
@@ -75,3 +70,41 @@ func (cmd *command) attachCommandExtra(signs []string, firstKey int, lastKey int
 		keyStep:  keyStep,
 	}
 }
+
+/* ---- prepare functions ---- */
+
+// readFirstKey locks args[0] for reading, e.g. GET key
+func readFirstKey(args [][]byte) ([]string, []string) {
+	// assert len(args) > 0
+	key := string(args[0])
+	return nil, []string{key}
+}
+
+// writeFirstKey locks args[0] for writing, e.g. SET key value
+func writeFirstKey(args [][]byte) ([]string, []string) {
+	key := string(args[0])
+	return []string{key}, nil
+}
+
+// writeAllKeys locks all args for writing, e.g. DEL key [key ...]
+func writeAllKeys(args [][]byte) ([]string, []string) {
+	keys := make([]string, len(args))
+	for i, v := range args {
+		keys[i] = string(v)
+	}
+	return keys, nil
+}
+
+// readAllKeys locks all args for reading, e.g. EXISTS key [key ...]
+func readAllKeys(args [][]byte) ([]string, []string) {
+	keys := make([]string, len(args))
+	for i, v := range args {
+		keys[i] = string(v)
+	}
+	return nil, keys
+}
+
+// noPrepare is used by commands that touch no key, e.g. PING
+func noPrepare(args [][]byte) ([]string, []string) {
+	return nil, nil
+}
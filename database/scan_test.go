@@ -0,0 +1,162 @@
+package database
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/8
+  @desc: scan
+  @modified by:
+**/
+
+import (
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/godis/protocol/asserts"
+	"github.com/Allen9012/Godis/lib/utils"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// scanAll runs a SCAN family command until cursor returns to 0, returns all elements
+func scanAll(t *testing.T, cmd string, key string, options ...string) []string {
+	var result []string
+	cursor := "0"
+	for i := 0; i < 1000; i++ {
+		args := []string{cmd}
+		if key != "" {
+			args = append(args, key)
+		}
+		args = append(args, cursor)
+		args = append(args, options...)
+		reply := testDB.Exec(nil, utils.ToCmdLine(args...))
+		raw, ok := reply.(*protocol.MultiRawReply)
+		if !ok || len(raw.Replies) != 2 {
+			t.Fatalf("wrong reply of %s: %s", cmd, reply.ToBytes())
+		}
+		cursor = string(raw.Replies[0].(*protocol.BulkReply).Arg)
+		for _, arg := range raw.Replies[1].(*protocol.MultiBulkReply).Args {
+			result = append(result, string(arg))
+		}
+		if cursor == "0" {
+			return result
+		}
+	}
+	t.Fatalf("%s doesn't finish", cmd)
+	return nil
+}
+
+func assertSameElements(t *testing.T, actual []string, expected []string) {
+	actual = append([]string(nil), actual...)
+	expected = append([]string(nil), expected...)
+	sort.Strings(actual)
+	sort.Strings(expected)
+	if len(actual) != len(expected) {
+		t.Fatalf("expect %v, actual %v", expected, actual)
+	}
+	for i := range expected {
+		if actual[i] != expected[i] {
+			t.Fatalf("expect %v, actual %v", expected, actual)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	testDB.Flush()
+	var expected []string
+	for i := 0; i < 30; i++ {
+		key := "str" + strconv.Itoa(i)
+		testDB.Exec(nil, utils.ToCmdLine("set", key, "v"))
+		expected = append(expected, key)
+	}
+	testDB.Exec(nil, utils.ToCmdLine("rpush", "list", "a"))
+	testDB.Exec(nil, utils.ToCmdLine("hset", "hash", "f", "v"))
+	testDB.Exec(nil, utils.ToCmdLine("sadd", "set", "a"))
+	testDB.Exec(nil, utils.ToCmdLine("zadd", "zset", "1", "a"))
+
+	assertSameElements(t, scanAll(t, "scan", "", "count", "4"),
+		append([]string{"list", "hash", "set", "zset"}, expected...))
+	assertSameElements(t, scanAll(t, "scan", "", "match", "str*"), expected)
+	assertSameElements(t, scanAll(t, "scan", "", "type", "string"), expected)
+	assertSameElements(t, scanAll(t, "scan", "", "type", "zset"), []string{"zset"})
+	assertSameElements(t, scanAll(t, "scan", "", "match", "*s*", "type", "hash"), []string{"hash"})
+
+	result := testDB.Exec(nil, utils.ToCmdLine("scan", "abc"))
+	asserts.AssertErrReply(t, result, "ERR invalid cursor")
+	result = testDB.Exec(nil, utils.ToCmdLine("scan", "0", "count"))
+	asserts.AssertErrReply(t, result, "Err syntax error")
+	result = testDB.Exec(nil, utils.ToCmdLine("scan", "0", "count", "0"))
+	asserts.AssertErrReply(t, result, "Err syntax error")
+	result = testDB.Exec(nil, utils.ToCmdLine("sscan", "set", "0", "type", "set"))
+	asserts.AssertErrReply(t, result, "Err syntax error")
+}
+
+func TestHScan(t *testing.T) {
+	testDB.Flush()
+	key := utils.RandString(10)
+	fields := make(map[string]string)
+	for i := 0; i < 30; i++ {
+		field := "f" + strconv.Itoa(i)
+		value := utils.RandString(5)
+		fields[field] = value
+		testDB.Exec(nil, utils.ToCmdLine("hset", key, field, value))
+	}
+	result := scanAll(t, "hscan", key, "count", "3")
+	if len(result) != 60 {
+		t.Fatalf("expect 60 elements, actual %d", len(result))
+	}
+	for i := 0; i < len(result); i += 2 {
+		if fields[result[i]] != result[i+1] {
+			t.Errorf("wrong value of field %s", result[i])
+		}
+	}
+	result = scanAll(t, "hscan", key, "match", "f2?")
+	if len(result) != 20 {
+		t.Errorf("expect 20 elements, actual %d", len(result))
+	}
+	assertSameElements(t, scanAll(t, "hscan", "missing"), nil)
+	// small hash is returned in one call
+	reply := testDB.Exec(nil, utils.ToCmdLine("hscan", key, "0", "count", "3"))
+	raw := reply.(*protocol.MultiRawReply)
+	asserts.AssertBulkReply(t, raw.Replies[0], "0")
+	asserts.AssertMultiBulkReplySize(t, raw.Replies[1], 60)
+}
+
+func TestSScan(t *testing.T) {
+	testDB.Flush()
+	key := utils.RandString(10)
+	var members []string
+	// more members than a small set, so cursor is used
+	for i := 0; i < 300; i++ {
+		member := "m" + strconv.Itoa(i)
+		members = append(members, member)
+		testDB.Exec(nil, utils.ToCmdLine("sadd", key, member))
+	}
+	assertSameElements(t, scanAll(t, "sscan", key, "count", "4"), members)
+	assertSameElements(t, scanAll(t, "sscan", key, "match", "m1?"), members[10:20])
+
+	testDB.Exec(nil, utils.ToCmdLine("set", "str", "v"))
+	result := testDB.Exec(nil, utils.ToCmdLine("sscan", "str", "0"))
+	asserts.AssertErrReply(t, result, "WRONGTYPE Operation against a key holding the wrong kind of value")
+}
+
+func TestZScan(t *testing.T) {
+	testDB.Flush()
+	key := utils.RandString(10)
+	for i := 0; i < 30; i++ {
+		testDB.Exec(nil, utils.ToCmdLine("zadd", key, strconv.Itoa(i)+".5", "m"+strconv.Itoa(i)))
+	}
+	result := scanAll(t, "zscan", key, "count", "4")
+	if len(result) != 60 {
+		t.Fatalf("expect 60 elements, actual %d", len(result))
+	}
+	for i := 0; i < len(result); i += 2 {
+		if result[i+1] != result[i][1:]+".5" {
+			t.Errorf("wrong score of member %s: %s", result[i], result[i+1])
+		}
+	}
+	reply := testDB.Exec(nil, utils.ToCmdLine("zscan", key, "0", "match", "m0"))
+	expected := "*2\r\n$1\r\n0\r\n*2\r\n$2\r\nm0\r\n$3\r\n0.5\r\n"
+	if string(reply.ToBytes()) != expected {
+		t.Errorf("expect %q, actual %q", expected, reply.ToBytes())
+	}
+}
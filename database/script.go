@@ -0,0 +1,359 @@
+package database
+
+import (
+	"context"
+	"github.com/Allen9012/Godis/config"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/interface/godis"
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/14
+  @desc: lua 脚本 EVAL EVALSHA EVAL_RO EVALSHA_RO SCRIPT
+	脚本执行期间持有 KEYS 的锁, 因此只能访问声明过的 key, 不同 key 的脚本可以并发执行
+	脚本中执行的写命令各自写入 AOF, 因此 AOF 记录的是脚本的效果而不是脚本本身
+  @modified by:
+**/
+
+const scriptKilledErr = "ERR Script killed by user with SCRIPT KILL..."
+
+// scriptCache holds compiled scripts by sha1 and running scripts, it is shared by all databases
+type scriptCache struct {
+	mu      sync.Mutex
+	scripts map[string]*lua.FunctionProto
+	running map[*scriptRun]struct{}
+}
+
+func makeScriptCache() *scriptCache {
+	return &scriptCache{
+		scripts: make(map[string]*lua.FunctionProto),
+		running: make(map[*scriptRun]struct{}),
+	}
+}
+
+// load compiles script if it is not cached, returns sha1 of script
+func (cache *scriptCache) load(body []byte) (string, *lua.FunctionProto, error) {
+	sha := sha1Hex(body)
+	cache.mu.Lock()
+	proto, ok := cache.scripts[sha]
+	cache.mu.Unlock()
+	if ok {
+		return sha, proto, nil
+	}
+	chunk, err := parse.Parse(strings.NewReader(string(body)), "@user_script")
+	if err != nil {
+		return "", nil, err
+	}
+	proto, err = lua.Compile(chunk, "@user_script")
+	if err != nil {
+		return "", nil, err
+	}
+	cache.mu.Lock()
+	cache.scripts[sha] = proto
+	cache.mu.Unlock()
+	return sha, proto, nil
+}
+
+func (cache *scriptCache) get(sha string) *lua.FunctionProto {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return cache.scripts[sha]
+}
+
+// count returns the number of cached scripts
+func (cache *scriptCache) count() int {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return len(cache.scripts)
+}
+
+func (cache *scriptCache) flush() {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.scripts = make(map[string]*lua.FunctionProto)
+}
+
+// kill stops running scripts which have not executed any write command
+func (cache *scriptCache) kill() godis.Reply {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if len(cache.running) == 0 {
+		return protocol.MakeErrReply("NOTBUSY No scripts in execution right now.")
+	}
+	killed := 0
+	for run := range cache.running {
+		if run.kill() {
+			killed++
+		}
+	}
+	if killed == 0 {
+		return protocol.MakeErrReply("UNKILLABLE Sorry the script already executed write commands against the dataset. " +
+			"You can either wait the script termination or kill the server in a hard way using the SHUTDOWN NOSAVE command.")
+	}
+	return protocol.MakeOkReply()
+}
+
+// scriptRun is the context of a running script
+type scriptRun struct {
+	db *DB
+	// keys declared by KEYS, script could only access these keys
+	keys map[string]struct{}
+	// writeErr is returned when script calls write commands, empty means writes are allowed
+	writeErr string
+	// oom is whether memory is over limit when the script starts, commands may increase memory are rejected
+	oom bool
+
+	mu      sync.Mutex
+	written bool
+	killed  bool
+	cancel  context.CancelFunc
+}
+
+// kill cancels the script if it has not written anything
+func (run *scriptRun) kill() bool {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	if run.written {
+		return false
+	}
+	run.killed = true
+	run.cancel()
+	return true
+}
+
+func (run *scriptRun) isKilled() bool {
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	return run.killed
+}
+
+// exec executes command called by redis.call or redis.pcall, locks of keys are held by EVAL
+func (run *scriptRun) exec(cmdLine [][]byte) godis.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := cmdTable[cmdName]
+	if !ok {
+		return protocol.MakeErrReply("ERR Unknown Redis command called from script")
+	}
+	if !validateArity(cmd.arity, cmdLine) {
+		return protocol.MakeArgNumErrReply(cmdName)
+	}
+	write := cmd.flags&flagReadOnly == 0
+	if write && run.writeErr != "" {
+		return protocol.MakeErrReply(run.writeErr)
+	}
+	if run.oom && denyOOM(cmdName) {
+		return protocol.MakeErrReply(oomErr)
+	}
+	writeKeys, readKeys := cmd.prepare(cmdLine[1:])
+	for _, key := range append(writeKeys, readKeys...) {
+		if _, ok := run.keys[key]; !ok {
+			return protocol.MakeErrReply("ERR Script attempted to access key '" + key + "' which is not declared in KEYS")
+		}
+	}
+	run.mu.Lock()
+	if run.killed {
+		run.mu.Unlock()
+		return protocol.MakeErrReply(scriptKilledErr)
+	}
+	if write {
+		run.written = true
+	}
+	run.mu.Unlock()
+	return run.db.execWithLock(cmdLine)
+}
+
+func bytesToTable(L *lua.LState, items [][]byte) *lua.LTable {
+	table := L.CreateTable(len(items), 0)
+	for _, item := range items {
+		table.Append(lua.LString(item))
+	}
+	return table
+}
+
+// runScript executes compiled script in a new lua vm
+//
+//	@Description: redis.call 抛出的错误原样返回, 其它运行时错误包装为 ERR Error running script
+//	@receiver cache
+//	@param run
+//	@param sha
+//	@param proto
+//	@param keys
+//	@param argv
+//	@return godis.Reply
+func (cache *scriptCache) runScript(run *scriptRun, sha string, proto *lua.FunctionProto, keys [][]byte, argv [][]byte) godis.Reply {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	run.cancel = cancel
+	cache.mu.Lock()
+	cache.running[run] = struct{}{}
+	cache.mu.Unlock()
+	defer func() {
+		cache.mu.Lock()
+		delete(cache.running, run)
+		cache.mu.Unlock()
+	}()
+
+	L := newLuaState(run)
+	defer L.Close()
+	L.SetContext(ctx)
+	L.SetGlobal("KEYS", bytesToTable(L, keys))
+	L.SetGlobal("ARGV", bytesToTable(L, argv))
+	L.Push(L.NewFunctionFromProto(proto))
+	if err := L.PCall(0, 1, nil); err != nil {
+		if run.isKilled() {
+			return protocol.MakeErrReply(scriptKilledErr)
+		}
+		msg := err.Error()
+		if apiErr, ok := err.(*lua.ApiError); ok {
+			if table, ok := apiErr.Object.(*lua.LTable); ok {
+				if errMsg, ok := table.RawGetString("err").(lua.LString); ok {
+					return protocol.MakeErrReply(string(errMsg))
+				}
+			}
+			msg = apiErr.Object.String()
+		}
+		return protocol.MakeErrReply("ERR Error running script (call to f_" + sha + "): " + msg)
+	}
+	return luaToReply(L.Get(-1))
+}
+
+// isEvalCommand returns whether the command runs lua script
+func isEvalCommand(cmdName string) bool {
+	switch cmdName {
+	case "eval", "evalsha", "eval_ro", "evalsha_ro":
+		return true
+	}
+	return false
+}
+
+// execEval
+//
+//	@Description: EVAL script numkeys [key ...] [arg ...], EVALSHA sha1 numkeys [key ...] [arg ...]
+//	EVAL_RO 和 EVALSHA_RO 只对 KEYS 加读锁并且不允许执行写命令
+//	@receiver server
+//	@param c
+//	@param db
+//	@param cmdLine
+//	@param oom	执行脚本前内存是否仍然超过 maxmemory
+//	@return godis.Reply
+func (server *StandaloneServer) execEval(c godis.Connection, db *DB, cmdLine [][]byte, oom bool) godis.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	if len(cmdLine) < 3 {
+		return protocol.MakeArgNumErrReply(cmdName)
+	}
+	var sha string
+	var proto *lua.FunctionProto
+	if cmdName == "eval" || cmdName == "eval_ro" {
+		var err error
+		sha, proto, err = server.scripts.load(cmdLine[1])
+		if err != nil {
+			return protocol.MakeErrReply("ERR Error compiling script (new function): " + err.Error())
+		}
+	} else {
+		sha = strings.ToLower(string(cmdLine[1]))
+		proto = server.scripts.get(sha)
+		if proto == nil {
+			return protocol.MakeErrReply("NOSCRIPT No matching script. Please use EVAL.")
+		}
+	}
+	numKeys, err := strconv.Atoi(string(cmdLine[2]))
+	if err != nil {
+		return protocol.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if numKeys < 0 {
+		return protocol.MakeErrReply("ERR Number of keys can't be negative")
+	}
+	if numKeys > len(cmdLine)-3 {
+		return protocol.MakeErrReply("ERR Number of keys can't be greater than number of args")
+	}
+	keys := cmdLine[3 : 3+numKeys]
+	argv := cmdLine[3+numKeys:]
+
+	run := &scriptRun{
+		db:   db,
+		keys: make(map[string]struct{}, numKeys),
+		oom:  oom,
+	}
+	lockKeys := make([]string, 0, numKeys)
+	for _, key := range keys {
+		run.keys[string(key)] = struct{}{}
+		lockKeys = append(lockKeys, string(key))
+	}
+	readOnly := strings.HasSuffix(cmdName, "_ro")
+	if readOnly {
+		run.writeErr = "ERR Write commands are not allowed from read-only scripts."
+	} else if server.getRole() == slaveRole && config.Get(&config.Properties.ReplicaReadOnly) && !(c != nil && c.IsMaster()) {
+		run.writeErr = "READONLY You can't write against a read only replica."
+	}
+	if readOnly {
+		db.RWLocks(nil, lockKeys)
+		defer db.RWUnLocks(nil, lockKeys)
+	} else {
+		db.addVersion(lockKeys...)
+		db.RWLocks(lockKeys, nil)
+		defer db.RWUnLocks(lockKeys, nil)
+	}
+	return server.scripts.runScript(run, sha, proto, keys, argv)
+}
+
+// execScript
+//
+//	@Description: SCRIPT LOAD script | SCRIPT EXISTS sha1 [sha1 ...] | SCRIPT FLUSH [ASYNC|SYNC] | SCRIPT KILL
+//	@receiver server
+//	@param args
+//	@return godis.Reply
+func (server *StandaloneServer) execScript(args [][]byte) godis.Reply {
+	if len(args) == 0 {
+		return protocol.MakeArgNumErrReply("script")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "load":
+		if len(args) != 2 {
+			return protocol.MakeArgNumErrReply("script|load")
+		}
+		sha, _, err := server.scripts.load(args[1])
+		if err != nil {
+			return protocol.MakeErrReply("ERR Error compiling script (new function): " + err.Error())
+		}
+		return protocol.MakeBulkReply([]byte(sha))
+	case "exists":
+		if len(args) < 2 {
+			return protocol.MakeArgNumErrReply("script|exists")
+		}
+		replies := make([]godis.Reply, 0, len(args)-1)
+		for _, arg := range args[1:] {
+			if server.scripts.get(strings.ToLower(string(arg))) != nil {
+				replies = append(replies, protocol.MakeIntReply(1))
+			} else {
+				replies = append(replies, protocol.MakeIntReply(0))
+			}
+		}
+		return protocol.MakeMultiRawReply(replies)
+	case "flush":
+		if len(args) > 2 {
+			return protocol.MakeArgNumErrReply("script|flush")
+		}
+		if len(args) == 2 {
+			mode := strings.ToLower(string(args[1]))
+			if mode != "async" && mode != "sync" {
+				return protocol.MakeErrReply("ERR SCRIPT FLUSH only support SYNC|ASYNC option")
+			}
+		}
+		server.scripts.flush()
+		return protocol.MakeOkReply()
+	case "kill":
+		if len(args) != 1 {
+			return protocol.MakeArgNumErrReply("script|kill")
+		}
+		return server.scripts.kill()
+	}
+	return protocol.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try SCRIPT HELP.")
+}
@@ -0,0 +1,251 @@
+package database
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/14
+  @desc: lua scripts
+  @modified by:
+**/
+
+import (
+	"github.com/Allen9012/Godis/godis/connection"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/godis/protocol/asserts"
+	"github.com/Allen9012/Godis/lib/utils"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEvalReplies(t *testing.T) {
+	server := NewStandaloneServer()
+	defer server.Close()
+	conn := connection.NewFakeConn()
+
+	result := server.Exec(conn, utils.ToCmdLine("eval", "return 3.99", "0"))
+	asserts.AssertIntReply(t, result, 3)
+	result = server.Exec(conn, utils.ToCmdLine("eval", "return 'hello'", "0"))
+	asserts.AssertBulkReply(t, result, "hello")
+	result = server.Exec(conn, utils.ToCmdLine("eval", "return true", "0"))
+	asserts.AssertIntReply(t, result, 1)
+	result = server.Exec(conn, utils.ToCmdLine("eval", "return false", "0"))
+	asserts.AssertNullBulk(t, result)
+	result = server.Exec(conn, utils.ToCmdLine("eval", "return {}", "0"))
+	asserts.AssertMultiBulkReplySize(t, result, 0)
+	result = server.Exec(conn, utils.ToCmdLine("eval", "return redis.status_reply('FINE')", "0"))
+	asserts.AssertStatusReply(t, result, "FINE")
+	result = server.Exec(conn, utils.ToCmdLine("eval", "return redis.error_reply('MYERR failed')", "0"))
+	asserts.AssertErrReply(t, result, "MYERR failed")
+	result = server.Exec(conn, utils.ToCmdLine("eval", "return {1, 'a', {2}, nil, 'ignored'}", "0"))
+	asserts.AssertNotError(t, result)
+	if s := string(result.ToBytes()); s != "*3\r\n:1\r\n$1\r\na\r\n*1\r\n:2\r\n" {
+		t.Errorf("wrong reply %q", s)
+	}
+	result = server.Exec(conn, utils.ToCmdLine("eval", "return {KEYS[1], KEYS[2], ARGV[1]}", "2", "k1", "k2", "a1"))
+	if s := string(result.ToBytes()); s != "*3\r\n$2\r\nk1\r\n$2\r\nk2\r\n$2\r\na1\r\n" {
+		t.Errorf("wrong reply %q", s)
+	}
+	// empty string is not null bulk
+	result = server.Exec(conn, utils.ToCmdLine("eval", "return ''", "0"))
+	if s := string(result.ToBytes()); s != "$0\r\n\r\n" {
+		t.Errorf("wrong reply %q", s)
+	}
+	result = server.Exec(conn, utils.ToCmdLine("eval", "return {'', 'a'}", "0"))
+	if s := string(result.ToBytes()); s != "*2\r\n$0\r\n\r\n$1\r\na\r\n" {
+		t.Errorf("wrong reply %q", s)
+	}
+	result = server.Exec(conn, utils.ToCmdLine("eval", "return redis.sha1hex('')", "0"))
+	asserts.AssertBulkReply(t, result, "da39a3ee5e6b4b0d3255bfef95601890afd80709")
+
+	result = server.Exec(conn, utils.ToCmdLine("eval", "return 1", "-1"))
+	asserts.AssertErrReply(t, result, "ERR Number of keys can't be negative")
+	result = server.Exec(conn, utils.ToCmdLine("eval", "return 1", "2", "k1"))
+	asserts.AssertErrReply(t, result, "ERR Number of keys can't be greater than number of args")
+	result = server.Exec(conn, utils.ToCmdLine("eval", "return +", "0"))
+	if !strings.HasPrefix(string(result.ToBytes()), "-ERR Error compiling script") {
+		t.Errorf("expect compile error, actually %s", result.ToBytes())
+	}
+	result = server.Exec(conn, utils.ToCmdLine("eval", "error('boom')", "0"))
+	if !strings.HasPrefix(string(result.ToBytes()), "-ERR Error running script") || !strings.Contains(string(result.ToBytes()), "boom") {
+		t.Errorf("expect runtime error, actually %s", result.ToBytes())
+	}
+	result = server.Exec(conn, utils.ToCmdLine("eval", "return dofile", "0"))
+	asserts.AssertNullBulk(t, result)
+}
+
+func TestEvalRedisCall(t *testing.T) {
+	server := NewStandaloneServer()
+	defer server.Close()
+	conn := connection.NewFakeConn()
+	key := utils.RandString(10)
+
+	result := server.Exec(conn, utils.ToCmdLine("eval", "return redis.call('set', KEYS[1], ARGV[1])", "1", key, "v"))
+	asserts.AssertStatusReply(t, result, "OK")
+	result = server.Exec(conn, utils.ToCmdLine("eval", "return redis.call('get', KEYS[1])", "1", key))
+	asserts.AssertBulkReply(t, result, "v")
+	result = server.Exec(conn, utils.ToCmdLine("eval", "return redis.call('get', KEYS[1])", "1", utils.RandString(10)))
+	asserts.AssertNullBulk(t, result)
+	result = server.Exec(conn, utils.ToCmdLine("eval", "return redis.call('set', KEYS[1], ARGV[1]).ok", "1", key, "v"))
+	asserts.AssertBulkReply(t, result, "OK")
+	result = server.Exec(conn, utils.ToCmdLine("eval", "return redis.call('incrby', KEYS[1], 10)", "1", key+"counter"))
+	asserts.AssertIntReply(t, result, 10)
+
+	// compare and delete, e.g. releasing a lock
+	release := "if redis.call('get', KEYS[1]) == ARGV[1] then return redis.call('del', KEYS[1]) else return 0 end"
+	result = server.Exec(conn, utils.ToCmdLine("eval", release, "1", key, "other"))
+	asserts.AssertIntReply(t, result, 0)
+	result = server.Exec(conn, utils.ToCmdLine("eval", release, "1", key, "v"))
+	asserts.AssertIntReply(t, result, 1)
+
+	// errors
+	server.Exec(conn, utils.ToCmdLine("set", key, "v"))
+	result = server.Exec(conn, utils.ToCmdLine("eval", "return redis.call('lpush', KEYS[1], 'a')", "1", key))
+	asserts.AssertErrReply(t, result, "WRONGTYPE Operation against a key holding the wrong kind of value")
+	result = server.Exec(conn, utils.ToCmdLine("eval", "return redis.pcall('lpush', KEYS[1], 'a').err", "1", key))
+	asserts.AssertBulkReply(t, result, "WRONGTYPE Operation against a key holding the wrong kind of value")
+	result = server.Exec(conn, utils.ToCmdLine("eval", "return redis.call('nocommand')", "0"))
+	asserts.AssertErrReply(t, result, "ERR Unknown Redis command called from script")
+	result = server.Exec(conn, utils.ToCmdLine("eval", "return redis.call('get', 'undeclared')", "0"))
+	asserts.AssertErrReply(t, result, "ERR Script attempted to access key 'undeclared' which is not declared in KEYS")
+	result = server.Exec(conn, utils.ToCmdLine("eval", "return redis.call('get', {})", "0"))
+	asserts.AssertErrReply(t, result, "ERR Lua redis lib command arguments must be strings or integers")
+
+	conn.SetMultiState(true)
+	result = server.Exec(conn, utils.ToCmdLine("eval", "return 1", "0"))
+	asserts.AssertErrReply(t, result, "ERR command eval cannot be used in MULTI")
+	result = server.Exec(conn, utils.ToCmdLine("script", "flush"))
+	asserts.AssertErrReply(t, result, "ERR command script cannot be used in MULTI")
+	conn.SetMultiState(false)
+}
+
+func TestEvalShaAndScript(t *testing.T) {
+	server := NewStandaloneServer()
+	defer server.Close()
+	conn := connection.NewFakeConn()
+	script := "return ARGV[1]"
+	sha := sha1Hex([]byte(script))
+
+	result := server.Exec(conn, utils.ToCmdLine("evalsha", sha, "0", "a"))
+	asserts.AssertErrReply(t, result, "NOSCRIPT No matching script. Please use EVAL.")
+	result = server.Exec(conn, utils.ToCmdLine("script", "load", script))
+	asserts.AssertBulkReply(t, result, sha)
+	result = server.Exec(conn, utils.ToCmdLine("evalsha", strings.ToUpper(sha), "0", "a"))
+	asserts.AssertBulkReply(t, result, "a")
+	result = server.Exec(conn, utils.ToCmdLine("evalsha_ro", sha, "0", "b"))
+	asserts.AssertBulkReply(t, result, "b")
+	result = server.Exec(conn, utils.ToCmdLine("script", "exists", sha, sha1Hex([]byte("return 1"))))
+	if s := string(result.ToBytes()); s != "*2\r\n:1\r\n:0\r\n" {
+		t.Errorf("wrong reply %q", s)
+	}
+	// EVAL caches script as well
+	server.Exec(conn, utils.ToCmdLine("eval", "return 1", "0"))
+	result = server.Exec(conn, utils.ToCmdLine("evalsha", sha1Hex([]byte("return 1")), "0"))
+	asserts.AssertIntReply(t, result, 1)
+
+	result = server.Exec(conn, utils.ToCmdLine("script", "flush", "async"))
+	asserts.AssertStatusReply(t, result, "OK")
+	result = server.Exec(conn, utils.ToCmdLine("evalsha", sha, "0"))
+	asserts.AssertErrReply(t, result, "NOSCRIPT No matching script. Please use EVAL.")
+	result = server.Exec(conn, utils.ToCmdLine("script", "flush", "now"))
+	asserts.AssertErrReply(t, result, "ERR SCRIPT FLUSH only support SYNC|ASYNC option")
+	result = server.Exec(conn, utils.ToCmdLine("script", "load", "return +"))
+	if !strings.HasPrefix(string(result.ToBytes()), "-ERR Error compiling script") {
+		t.Errorf("expect compile error, actually %s", result.ToBytes())
+	}
+	result = server.Exec(conn, utils.ToCmdLine("script", "help2"))
+	asserts.AssertErrReply(t, result, "ERR unknown subcommand 'help2'. Try SCRIPT HELP.")
+}
+
+func TestEvalRO(t *testing.T) {
+	server := NewStandaloneServer()
+	defer server.Close()
+	conn := connection.NewFakeConn()
+	key := utils.RandString(10)
+	server.Exec(conn, utils.ToCmdLine("set", key, "v"))
+	result := server.Exec(conn, utils.ToCmdLine("eval_ro", "return redis.call('get', KEYS[1])", "1", key))
+	asserts.AssertBulkReply(t, result, "v")
+	result = server.Exec(conn, utils.ToCmdLine("eval_ro", "return redis.call('del', KEYS[1])", "1", key))
+	asserts.AssertErrReply(t, result, "ERR Write commands are not allowed from read-only scripts.")
+	result = server.Exec(conn, utils.ToCmdLine("get", key))
+	asserts.AssertBulkReply(t, result, "v")
+}
+
+func TestScriptAof(t *testing.T) {
+	server := NewStandaloneServer()
+	defer server.Close()
+	conn := connection.NewFakeConn()
+	db := server.mustSelectDB(0)
+	var logged []string
+	db.addAof = func(line CmdLine) {
+		logged = append(logged, strings.ToLower(string(line[0]))+" "+string(line[1]))
+	}
+	key := utils.RandString(10)
+	script := "redis.call('get', KEYS[1]); redis.call('set', KEYS[1], '1'); redis.call('del', KEYS[1]); return 0"
+	server.Exec(conn, utils.ToCmdLine("eval", script, "1", key))
+	if len(logged) != 2 || logged[0] != "set "+key || logged[1] != "del "+key {
+		t.Errorf("wrong aof %v", logged)
+	}
+}
+
+func TestEvalAtomic(t *testing.T) {
+	server := NewStandaloneServer()
+	defer server.Close()
+	key := utils.RandString(10)
+	// read and write in separate calls, which loses updates without atomicity
+	script := "local v = redis.call('get', KEYS[1]) or 0; return redis.call('set', KEYS[1], v + 1)"
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn := connection.NewFakeConn()
+			for j := 0; j < 50; j++ {
+				server.Exec(conn, utils.ToCmdLine("eval", script, "1", key))
+			}
+		}()
+	}
+	wg.Wait()
+	result := server.Exec(connection.NewFakeConn(), utils.ToCmdLine("get", key))
+	asserts.AssertBulkReply(t, result, "1000")
+}
+
+// waitScriptRunning waits until n scripts are running
+func waitScriptRunning(t *testing.T, server *StandaloneServer, n int) {
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		server.scripts.mu.Lock()
+		running := len(server.scripts.running)
+		server.scripts.mu.Unlock()
+		if running == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expect %d scripts running", n)
+}
+
+func TestScriptKill(t *testing.T) {
+	server := NewStandaloneServer()
+	defer server.Close()
+	conn := connection.NewFakeConn()
+	result := server.Exec(conn, utils.ToCmdLine("script", "kill"))
+	asserts.AssertErrReply(t, result, "NOTBUSY No scripts in execution right now.")
+
+	ch := execAsync(server, connection.NewFakeConn(), "eval", "while true do end", "0")
+	waitScriptRunning(t, server, 1)
+	result = server.Exec(conn, utils.ToCmdLine("script", "kill"))
+	asserts.AssertStatusReply(t, result, "OK")
+	asserts.AssertErrReply(t, receiveReply(t, ch), scriptKilledErr)
+
+	key := utils.RandString(10)
+	ch = execAsync(server, connection.NewFakeConn(), "eval",
+		"redis.call('set', KEYS[1], '1'); local i = 0; while i < 3000000 do i = i + 1 end; return i", "1", key)
+	waitScriptRunning(t, server, 1)
+	result = server.Exec(conn, utils.ToCmdLine("script", "kill"))
+	if _, ok := result.(*protocol.StandardErrReply); !ok || !strings.HasPrefix(string(result.ToBytes()), "-UNKILLABLE") {
+		t.Errorf("expect UNKILLABLE, actually %s", result.ToBytes())
+	}
+	asserts.AssertIntReply(t, receiveReply(t, ch), 3000000)
+}
@@ -16,19 +16,42 @@ import (
 )
 
 func init() {
-	registerCommand("SAdd", execSAdd, -3, flagWrite)
-	registerCommand("SIsMember", execSIsMember, 3, flagReadOnly)
-	registerCommand("SRem", execSRem, -3, flagWrite)
-	registerCommand("SPop", execSPop, -2, flagWrite)
-	registerCommand("SCard", execSCard, 2, flagReadOnly)
-	registerCommand("SMembers", execSMembers, 2, flagReadOnly)
-	registerCommand("SInter", execSInter, -2, flagReadOnly)
-	registerCommand("SInterStore", execSInterStore, -3, flagWrite)
-	registerCommand("SUnion", execSUnion, -2, flagReadOnly)
-	registerCommand("SUnionStore", execSUnionStore, -3, flagWrite)
-	registerCommand("SDiff", execSDiff, -2, flagReadOnly)
-	registerCommand("SDiffStore", execSDiffStore, -3, flagReadOnly)
-	registerCommand("SRandMember", execSRandMember, -2, flagReadOnly)
+	registerCommand("SAdd", execSAdd, writeFirstKey, undoSetChange, -3, flagWrite)
+	registerCommand("SIsMember", execSIsMember, readFirstKey, nil, 3, flagReadOnly)
+	registerCommand("SRem", execSRem, writeFirstKey, undoSetChange, -3, flagWrite)
+	registerCommand("SPop", execSPop, writeFirstKey, rollbackFirstKey, -2, flagWrite)
+	registerCommand("SCard", execSCard, readFirstKey, nil, 2, flagReadOnly)
+	registerCommand("SMembers", execSMembers, readFirstKey, nil, 2, flagReadOnly)
+	registerCommand("SInter", execSInter, readAllKeys, nil, -2, flagReadOnly)
+	registerCommand("SInterStore", execSInterStore, prepareSetCalculateStore, rollbackFirstKey, -3, flagWrite)
+	registerCommand("SUnion", execSUnion, readAllKeys, nil, -2, flagReadOnly)
+	registerCommand("SUnionStore", execSUnionStore, prepareSetCalculateStore, rollbackFirstKey, -3, flagWrite)
+	registerCommand("SDiff", execSDiff, readAllKeys, nil, -2, flagReadOnly)
+	registerCommand("SDiffStore", execSDiffStore, prepareSetCalculateStore, rollbackFirstKey, -3, flagWrite)
+	registerCommand("SRandMember", execSRandMember, readFirstKey, nil, -2, flagReadOnly)
+	registerCommand("SScan", execSScan, readFirstKey, nil, -3, flagReadOnly)
+}
+
+// prepareSetCalculateStore locks dest for writing and source sets for reading
+func prepareSetCalculateStore(args [][]byte) ([]string, []string) {
+	dest := string(args[0])
+	keys := make([]string, len(args)-1)
+	keySrc := args[1:]
+	for i, arg := range keySrc {
+		keys[i] = string(arg)
+	}
+	return []string{dest}, keys
+}
+
+// undoSetChange rollbacks SADD and SREM command
+func undoSetChange(db *DB, args [][]byte) []CmdLine {
+	key := string(args[0])
+	memberArgs := args[1:]
+	members := make([]string, len(memberArgs))
+	for i, mem := range memberArgs {
+		members[i] = string(mem)
+	}
+	return rollbackSetMembers(db, key, members...)
 }
 
 func (db *DB) getAsSet(key string) (*HashSet.Set, protocol.ErrorReply) {
@@ -130,7 +153,7 @@ func execSDiffStore(db *DB, args [][]byte) godis.Reply {
 		if set == nil {
 			if i == 0 {
 				// early termination
-				db.Remove(dest)
+				db.removeAndNotify(dest)
 				return protocol.MakeIntReply(0)
 			}
 			continue
@@ -142,7 +165,7 @@ func execSDiffStore(db *DB, args [][]byte) godis.Reply {
 			result = result.Diff(set)
 			if result.Len() == 0 {
 				// early termination
-				db.Remove(dest)
+				db.removeAndNotify(dest)
 				return protocol.MakeIntReply(0)
 			}
 		}
@@ -150,7 +173,7 @@ func execSDiffStore(db *DB, args [][]byte) godis.Reply {
 
 	if result == nil {
 		// all keys are nil
-		db.Remove(dest)
+		db.removeAndNotify(dest)
 		return protocol.MakeEmptyMultiBulkReply()
 	}
 	set := HashSet.Make(result.ToSlice()...)
@@ -159,6 +182,7 @@ func execSDiffStore(db *DB, args [][]byte) godis.Reply {
 	})
 
 	db.addAof(utils.ToCmdLine3("sdiffstore", args...))
+	db.notifyKeyspaceEvent(notifySet, "sdiffstore", dest)
 	return protocol.MakeIntReply(int64(set.Len()))
 }
 
@@ -245,11 +269,12 @@ func execSUnionStore(db *DB, args [][]byte) godis.Reply {
 		}
 	}
 
-	db.Remove(dest) // clean ttl
 	if result == nil {
 		// all keys are empty set
+		db.removeAndNotify(dest)
 		return protocol.MakeEmptyMultiBulkReply()
 	}
+	db.Remove(dest) // clean ttl
 
 	set := HashSet.Make(result.ToSlice()...)
 	db.PutEntity(dest, &database.DataEntity{
@@ -257,6 +282,7 @@ func execSUnionStore(db *DB, args [][]byte) godis.Reply {
 	})
 
 	db.addAof(utils.ToCmdLine3("sunionstore", args...))
+	db.notifyKeyspaceEvent(notifySet, "sunionstore", dest)
 	return protocol.MakeIntReply(int64(set.Len()))
 }
 
@@ -325,7 +351,7 @@ func execSInterStore(db *DB, args [][]byte) godis.Reply {
 			return errReply
 		}
 		if set == nil {
-			db.Remove(dest) // clean ttl and old value
+			db.removeAndNotify(dest) // clean ttl and old value
 			return protocol.MakeIntReply(0)
 		}
 
@@ -336,7 +362,7 @@ func execSInterStore(db *DB, args [][]byte) godis.Reply {
 			result = result.Intersect(set)
 			if result.Len() == 0 {
 				// early termination
-				db.Remove(dest) // clean ttl and old value
+				db.removeAndNotify(dest) // clean ttl and old value
 				return protocol.MakeIntReply(0)
 			}
 		}
@@ -346,6 +372,7 @@ func execSInterStore(db *DB, args [][]byte) godis.Reply {
 		Data: set,
 	})
 	db.addAof(utils.ToCmdLine3("sinterscore", args...))
+	db.notifyKeyspaceEvent(notifySet, "sinterstore", dest)
 	return protocol.MakeIntReply(int64(set.Len()))
 }
 
@@ -484,6 +511,7 @@ func execSPop(db *DB, args [][]byte) godis.Reply {
 	}
 	if count > 0 {
 		db.addAof(utils.ToCmdLine3("spop", args...))
+		db.notifyKeyspaceEvent(notifySet, "spop", key)
 	}
 	return protocol.MakeMultiBulkReply(result)
 }
@@ -517,6 +545,10 @@ func execSRem(db *DB, args [][]byte) godis.Reply {
 	}
 	if counter > 0 {
 		db.addAof(utils.ToCmdLine3("srem", args...))
+		db.notifyKeyspaceEvent(notifySet, "srem", key)
+		if set.Len() == 0 {
+			db.notifyKeyspaceEvent(notifyGeneric, "del", key)
+		}
 	}
 	return protocol.MakeIntReply(int64(counter))
 }
@@ -567,5 +599,35 @@ func execSAdd(db *DB, args [][]byte) godis.Reply {
 		counter += set.Add(string(member))
 	}
 	db.addAof(utils.ToCmdLine3("sadd", args...))
+	if counter > 0 {
+		db.notifyKeyspaceEvent(notifySet, "sadd", key)
+	}
 	return protocol.MakeIntReply(int64(counter))
 }
+
+// execSScan iterates members of set by cursor
+//
+//	@Description: SSCAN key cursor [MATCH pattern] [COUNT count]
+//	@param db
+//	@param args
+//	@return godis.Reply
+func execSScan(db *DB, args [][]byte) godis.Reply {
+	key := string(args[0])
+	opts, errReply := parseScanArgs(args[1:], false)
+	if errReply != nil {
+		return errReply
+	}
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return makeScanReply(0, nil)
+	}
+	members, next := set.Scan(opts.cursor, opts.count, opts.pattern)
+	result := make([][]byte, len(members))
+	for i, member := range members {
+		result[i] = []byte(member)
+	}
+	return makeScanReply(next, result)
+}
@@ -12,25 +12,52 @@ import (
 )
 
 func init() {
-	registerCommand("ZAdd", execZAdd, -4, flagWrite)
-	registerCommand("ZScore", execZScore, 3, flagReadOnly)
-	registerCommand("ZIncrBy", execZIncrBy, 4, flagWrite)
-	registerCommand("ZRank", execZRank, 3, flagReadOnly)
-	registerCommand("ZCount", execZCount, 4, flagReadOnly)
-	registerCommand("ZRevRank", execZRevRank, 3, flagReadOnly)
-	registerCommand("ZCard", execZCard, 2, flagReadOnly)
-	registerCommand("ZRange", execZRange, -4, flagReadOnly)
-	registerCommand("ZRangeByScore", execZRangeByScore, -4, flagReadOnly)
-	registerCommand("ZRevRange", execZRevRange, -4, flagReadOnly)
-	registerCommand("ZRevRangeByScore", execZRevRangeByScore, -4, flagReadOnly)
-	registerCommand("ZPopMin", execZPopMin, -2, flagWrite)
-	registerCommand("ZRem", execZRem, -3, flagWrite)
-	registerCommand("ZRemRangeByScore", execZRemRangeByScore, 4, flagWrite)
-	registerCommand("ZRemRangeByRank", execZRemRangeByRank, 4, flagWrite)
-	registerCommand("ZLexCount", execZLexCount, 4, flagReadOnly)
-	registerCommand("ZRangeByLex", execZRangeByLex, -4, flagReadOnly)
-	registerCommand("ZRemRangeByLex", execZRemRangeByLex, 4, flagWrite)
-	registerCommand("ZRevRangeByLex", execZRevRangeByLex, -4, flagReadOnly)
+	registerCommand("ZAdd", execZAdd, writeFirstKey, undoZAdd, -4, flagWrite)
+	registerCommand("ZScore", execZScore, readFirstKey, nil, 3, flagReadOnly)
+	registerCommand("ZIncrBy", execZIncrBy, writeFirstKey, undoZIncr, 4, flagWrite)
+	registerCommand("ZRank", execZRank, readFirstKey, nil, 3, flagReadOnly)
+	registerCommand("ZCount", execZCount, readFirstKey, nil, 4, flagReadOnly)
+	registerCommand("ZRevRank", execZRevRank, readFirstKey, nil, 3, flagReadOnly)
+	registerCommand("ZCard", execZCard, readFirstKey, nil, 2, flagReadOnly)
+	registerCommand("ZRange", execZRange, readFirstKey, nil, -4, flagReadOnly)
+	registerCommand("ZRangeByScore", execZRangeByScore, readFirstKey, nil, -4, flagReadOnly)
+	registerCommand("ZRevRange", execZRevRange, readFirstKey, nil, -4, flagReadOnly)
+	registerCommand("ZRevRangeByScore", execZRevRangeByScore, readFirstKey, nil, -4, flagReadOnly)
+	registerCommand("ZPopMin", execZPopMin, writeFirstKey, rollbackFirstKey, -2, flagWrite)
+	registerCommand("ZRem", execZRem, writeFirstKey, undoZRem, -3, flagWrite)
+	registerCommand("ZRemRangeByScore", execZRemRangeByScore, writeFirstKey, rollbackFirstKey, 4, flagWrite)
+	registerCommand("ZRemRangeByRank", execZRemRangeByRank, writeFirstKey, rollbackFirstKey, 4, flagWrite)
+	registerCommand("ZLexCount", execZLexCount, readFirstKey, nil, 4, flagReadOnly)
+	registerCommand("ZRangeByLex", execZRangeByLex, readFirstKey, nil, -4, flagReadOnly)
+	registerCommand("ZRemRangeByLex", execZRemRangeByLex, writeFirstKey, rollbackFirstKey, 4, flagWrite)
+	registerCommand("ZRevRangeByLex", execZRevRangeByLex, readFirstKey, nil, -4, flagReadOnly)
+	registerCommand("ZScan", execZScan, readFirstKey, nil, -3, flagReadOnly)
+}
+
+func undoZAdd(db *DB, args [][]byte) []CmdLine {
+	key := string(args[0])
+	size := (len(args) - 1) / 2
+	fields := make([]string, size)
+	for i := 0; i < size; i++ {
+		fields[i] = string(args[2*i+2])
+	}
+	return rollbackZSetFields(db, key, fields...)
+}
+
+func undoZIncr(db *DB, args [][]byte) []CmdLine {
+	key := string(args[0])
+	field := string(args[2])
+	return rollbackZSetFields(db, key, field)
+}
+
+func undoZRem(db *DB, args [][]byte) []CmdLine {
+	key := string(args[0])
+	fields := make([]string, len(args)-1)
+	fieldArgs := args[1:]
+	for i, v := range fieldArgs {
+		fields[i] = string(v)
+	}
+	return rollbackZSetFields(db, key, fields...)
 }
 
 // getAsSortedSet
@@ -109,6 +136,7 @@ func execZAdd(db *DB, args [][]byte) godis.Reply {
 	}
 
 	db.addAof(utils.ToCmdLine3("zadd", args...))
+	db.notifyKeyspaceEvent(notifyZSet, "zadd", key)
 
 	return protocol.MakeIntReply(int64(i))
 }
@@ -168,12 +196,14 @@ func execZIncrBy(db *DB, args [][]byte) godis.Reply {
 	if !exists {
 		sortedSet.Add(member, delta)
 		db.addAof(utils.ToCmdLine3("zincrby", args...))
+		db.notifyKeyspaceEvent(notifyZSet, "zincr", key)
 		return protocol.MakeBulkReply(args[1])
 	}
 	score := element.Score + delta
 	sortedSet.Add(member, score)
 	bytes := []byte(strconv.FormatFloat(score, 'f', -1, 64))
 	db.addAof(utils.ToCmdLine3("zincrby", args...))
+	db.notifyKeyspaceEvent(notifyZSet, "zincr", key)
 	return protocol.MakeBulkReply(bytes)
 }
 
@@ -483,6 +513,7 @@ func execZPopMin(db *DB, args [][]byte) godis.Reply {
 	removed := sortedSet.PopMin(count)
 	if len(removed) > 0 {
 		db.addAof(utils.ToCmdLine3("zpopmin", args...))
+		db.notifyKeyspaceEvent(notifyZSet, "zpopmin", key)
 	}
 	result := make([][]byte, 0, len(removed)*2)
 	for _, element := range removed {
@@ -527,6 +558,7 @@ func execZRem(db *DB, args [][]byte) godis.Reply {
 	}
 	if deleted > 0 {
 		db.addAof(utils.ToCmdLine3("zrem", args...))
+		db.notifyKeyspaceEvent(notifyZSet, "zrem", key)
 	}
 	return protocol.MakeIntReply(deleted)
 }
@@ -562,6 +594,7 @@ func execZRemRangeByScore(db *DB, args [][]byte) godis.Reply {
 	removed := sortedSet.RemoveRange(min, max)
 	if removed > 0 {
 		db.addAof(utils.ToCmdLine3("zremrangebyscore", args...))
+		db.notifyKeyspaceEvent(notifyZSet, "zremrangebyscore", key)
 	}
 	return protocol.MakeIntReply(removed)
 }
@@ -614,6 +647,9 @@ func execZRemRangeByRank(db *DB, args [][]byte) godis.Reply {
 		stop = start
 	}
 	removed := sortedSet.RemoveByRank(start, stop)
+	if removed > 0 {
+		db.notifyKeyspaceEvent(notifyZSet, "zremrangebyrank", key)
+	}
 	return protocol.MakeIntReply(removed)
 }
 
@@ -743,7 +779,9 @@ func execZRemRangeByLex(db *DB, args [][]byte) godis.Reply {
 	}
 	// 使用removeRange接口
 	count := sortedSet.RemoveRange(min, max)
-
+	if count > 0 {
+		db.notifyKeyspaceEvent(notifyZSet, "zremrangebylex", key)
+	}
 	return protocol.MakeIntReply(count)
 }
 
@@ -919,3 +957,31 @@ func rangeByScore0(db *DB, key string, min SortedSet.Border, max SortedSet.Borde
 	}
 	return protocol.MakeMultiBulkReply(result)
 }
+
+// execZScan iterates members and scores of sorted set by cursor
+//
+//	@Description: ZSCAN key cursor [MATCH pattern] [COUNT count]
+//	@param db
+//	@param args
+//	@return godis.Reply
+func execZScan(db *DB, args [][]byte) godis.Reply {
+	key := string(args[0])
+	opts, errReply := parseScanArgs(args[1:], false)
+	if errReply != nil {
+		return errReply
+	}
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return makeScanReply(0, nil)
+	}
+	elements, next := sortedSet.Scan(opts.cursor, opts.count, opts.pattern)
+	result := make([][]byte, 0, len(elements)*2)
+	for _, element := range elements {
+		scoreStr := strconv.FormatFloat(element.Score, 'f', -1, 64)
+		result = append(result, []byte(element.Member), []byte(scoreStr))
+	}
+	return makeScanReply(next, result)
+}
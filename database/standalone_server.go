@@ -13,7 +13,10 @@ import (
 	"github.com/Allen9012/Godis/godis/protocol"
 	"github.com/Allen9012/Godis/interface/database"
 	"github.com/Allen9012/Godis/interface/godis"
+	"github.com/Allen9012/Godis/latency"
 	"github.com/Allen9012/Godis/lib/logger"
+	"github.com/Allen9012/Godis/pubsub"
+	"github.com/Allen9012/Godis/slowlog"
 	"os"
 	"runtime/debug"
 	"strconv"
@@ -28,17 +31,35 @@ type StandaloneServer struct {
 	dbSet     []*atomic.Value // *DB
 	persister *aof.Persister
 
-	//// TODO handle publish/subscribe
-	//hub *pubsub.Hub
-	//// TODO for replication
+	// handle publish/subscribe
+	hub *pubsub.Hub
+	// publishes keyspace events into hub
+	notifier *keyspaceNotifier
+	// loading is 1 while loading aof or rdb file on startup
+	loading int32
+	// rdbSaving is 1 while SAVE or BGSAVE is in progress
+	rdbSaving int32
+	// lastSave is the unix time of last successful rdb saving
+	lastSave int64
 
-	//role         int32
-	//slaveStatus  *slaveStatus
-	//masterStatus *masterStatus
-	//
-	//// TODO hooks
-	//insertCallback database.KeyEventCallback
-	//deleteCallback database.KeyEventCallback
+	// counters reported by INFO
+	stats *serverStats
+	// lua scripts cached by SCRIPT LOAD and EVAL
+	scripts *scriptCache
+	// commands slower than slowlog-log-slower-than
+	slowlog *slowlog.SlowLog
+	// for replication
+	role         int32
+	slaveStatus  *slaveStatus
+	masterStatus *masterStatus
+	// stopCron stops the replication and expire cron goroutines
+	stopCron chan struct{}
+	// expireCursor is the database to be checked by next active expire cycle, only accessed by expire cron
+	expireCursor int
+
+	// hooks of key events, they are copied into every database
+	insertCallback database.KeyEventCallback
+	deleteCallback database.KeyEventCallback
 }
 
 // NewStandaloneServer creates a godis database with multi database and all other funtions
@@ -47,9 +68,18 @@ type StandaloneServer struct {
 //	@return *StandaloneServer
 func NewStandaloneServer() *StandaloneServer {
 	server := &StandaloneServer{}
+	server.hub = pubsub.MakeHub()
+	server.notifier = makeKeyspaceNotifier(server.hub, godis2.Properties.NotifyKeyspaceEvents)
+	server.stats = &serverStats{}
+	server.scripts = makeScriptCache()
+	server.slowlog = slowlog.MakeSlowLog()
+	server.lastSave = time.Now().Unix()
 	if godis2.Properties.Databases == 0 {
 		godis2.Properties.Databases = 16
 	}
+	if godis2.Properties.RDBFilename == "" {
+		godis2.Properties.RDBFilename = "dump.rdb"
+	}
 	// creat tmp dir
 	err := os.MkdirAll(godis2.GetTmpDir(), os.ModePerm)
 	if err != nil {
@@ -61,10 +91,20 @@ func NewStandaloneServer() *StandaloneServer {
 	for i := range server.dbSet {
 		singleDB := makeDB()
 		singleDB.index = i
+		singleDB.stats = server.stats
+		singleDB.notifier = server.notifier
 		holder := &atomic.Value{}
 		holder.Store(singleDB)
 		server.dbSet[i] = holder
 	}
+	// 加载数据期间不淘汰 key
+	atomic.StoreInt32(&server.loading, 1)
+	// 未开启 aof 时从 rdb 文件恢复数据
+	if !godis2.Properties.AppendOnly && fileExists(godis2.Properties.RDBFilename) {
+		if err := server.loadRdbFile(); err != nil {
+			logger.Error("load rdb failed: " + err.Error())
+		}
+	}
 	// 查询是否打开配置
 	if godis2.Properties.AppendOnly {
 		aofHandler, err := NewPersister(server,
@@ -74,10 +114,33 @@ func NewStandaloneServer() *StandaloneServer {
 		}
 		server.bindPersister(aofHandler)
 	}
-	// TODO RDB and slave
+	atomic.StoreInt32(&server.loading, 0)
+	// 主从复制, 默认以主节点身份启动
+	server.slaveStatus = &slaveStatus{}
+	server.initMaster(0)
+	server.stopCron = make(chan struct{})
+	server.startReplCron()
+	server.startExpireCron()
 	return server
 }
 
+// startReplCron runs masterCron every second until server closed
+func (server *StandaloneServer) startReplCron() {
+	stopCron := server.stopCron
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				server.masterCron()
+			case <-stopCron:
+				return
+			}
+		}
+	}()
+}
+
 // Exec executes command
 //
 //	@Description: 执行用户指令，相当于转交给DB处理指令
@@ -94,9 +157,92 @@ func (server *StandaloneServer) Exec(c godis.Connection, cmdLine [][]byte) (resu
 			result = protocol.MakeUnknowErrReply()
 		}
 	}()
-	// 先处理select
 	cmdName := strings.ToLower(string(cmdLine[0]))
+	server.stats.incrCommands()
+	start := time.Now()
+	defer func() {
+		server.recordCommand(c, cmdName, cmdLine, start)
+	}()
+	// 订阅状态下只能执行订阅相关的命令
+	if c != nil && c.SubsCount() > 0 && !isSubscribeModeCommand(cmdName) {
+		return protocol.MakeErrReply("ERR Can't execute '" + cmdName +
+			"': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING are allowed in this context")
+	}
+	// 由 server 处理的命令不经过 DB.Exec 入队, 在事务中直接执行会脱离事务, 与 EnqueueCmd 一样拒绝并放弃事务
+	if c != nil && c.InMultiState() && isServerCommand(cmdName) {
+		errReply := protocol.MakeErrReply("ERR command " + cmdName + " cannot be used in MULTI")
+		c.AddTxError(errReply)
+		return errReply
+	}
+	// 先处理pubsub
+	if cmdName == "subscribe" {
+		if len(cmdLine) < 2 {
+			return protocol.MakeArgNumErrReply("subscribe")
+		}
+		return pubsub.Subscribe(server.hub, c, cmdLine[1:])
+	} else if cmdName == "unsubscribe" {
+		return pubsub.UnSubscribe(server.hub, c, cmdLine[1:])
+	} else if cmdName == "psubscribe" {
+		if len(cmdLine) < 2 {
+			return protocol.MakeArgNumErrReply("psubscribe")
+		}
+		return pubsub.PSubscribe(server.hub, c, cmdLine[1:])
+	} else if cmdName == "punsubscribe" {
+		return pubsub.PUnSubscribe(server.hub, c, cmdLine[1:])
+	} else if cmdName == "publish" {
+		return pubsub.Publish(server.hub, cmdLine[1:])
+	} else if cmdName == "pubsub" {
+		return pubsub.PubSub(server.hub, cmdLine[1:])
+	}
+	// rdb 持久化
+	if cmdName == "save" {
+		return execSave(server, cmdLine[1:])
+	} else if cmdName == "bgsave" {
+		return execBGSave(server, cmdLine[1:])
+	} else if cmdName == "lastsave" {
+		return execLastSave(server, cmdLine[1:])
+	}
+	if cmdName == "info" {
+		return execInfo(server, cmdLine[1:])
+	} else if cmdName == "config" {
+		return execConfig(server, cmdLine[1:])
+	} else if cmdName == "script" {
+		return server.execScript(cmdLine[1:])
+	} else if cmdName == "slowlog" {
+		return slowlog.Exec(server.slowlog, cmdLine[1:])
+	} else if cmdName == "latency" {
+		return latency.Exec(cmdLine[1:])
+	} else if cmdName == "client" {
+		return execClient(c, cmdLine[1:])
+	}
+	// 主从复制
+	if cmdName == "slaveof" || cmdName == "replicaof" {
+		return server.execSlaveOf(cmdLine[1:])
+	} else if cmdName == "psync" {
+		return server.execPSync(c, cmdLine[1:])
+	} else if cmdName == "replconf" {
+		return server.execReplConf(c, cmdLine[1:])
+	}
+	// 从节点只接受主节点同步过来的写命令
+	if server.getRole() == slaveRole && godis2.Get(&godis2.Properties.ReplicaReadOnly) &&
+		!(c != nil && c.IsMaster()) && isWriteCommand(cmdName) {
+		return protocol.MakeErrReply("READONLY You can't write against a read only replica.")
+	}
+	// 内存超过 maxmemory 时先淘汰 key, 仍然超过时拒绝可能增加内存的写命令
+	oom := !server.freeMemoryIfNeeded(c)
+	if oom && denyOOM(cmdName) {
+		errReply := protocol.MakeErrReply(oomErr)
+		// 与 redis 一样, 入队时被拒绝的命令会使 EXEC 返回 EXECABORT
+		if c != nil && c.InMultiState() {
+			c.AddTxError(errReply)
+		}
+		return errReply
+	}
+	// 再处理select
 	if cmdName == "select" {
+		if c != nil && c.InMultiState() {
+			return protocol.MakeErrReply("cannot select database within multi")
+		}
 		if len(cmdLine) != 2 {
 			return protocol.MakeArgNumErrReply("select")
 		}
@@ -108,22 +254,85 @@ func (server *StandaloneServer) Exec(c godis.Connection, cmdLine [][]byte) (resu
 	if errReply != nil {
 		return errReply
 	}
+	// OBJECT 和 MEMORY 不应更新 key 的访问时间
+	if cmdName == "object" {
+		return execObject(selectedDB, cmdLine[1:])
+	}
+	if cmdName == "memory" {
+		return server.execMemory(selectedDB, cmdLine[1:])
+	}
+	// lua 脚本
+	if isEvalCommand(cmdName) {
+		return server.execEval(c, selectedDB, cmdLine, oom)
+	}
 	return selectedDB.Exec(c, cmdLine)
 }
 
+// recordCommand samples execution time of command into slow log and latency monitor
+//
+//	@Description: 阻塞命令的执行时间包含等待数据的时间, 因此不记录;
+//	加载 aof 期间的命令和 aof 重写使用的辅助 server 也不记录
+//	@receiver server
+//	@param c
+//	@param cmdName
+//	@param cmdLine
+//	@param start	命令开始执行的时间
+func (server *StandaloneServer) recordCommand(c godis.Connection, cmdName string, cmdLine [][]byte, start time.Time) {
+	if server.slowlog == nil || atomic.LoadInt32(&server.loading) == 1 || IsBlockingCommand(cmdName) {
+		return
+	}
+	duration := time.Since(start)
+	latency.AddSampleIfNeeded(latency.EventCommand, duration)
+	server.slowlog.Record(c, cmdLine, start, duration)
+}
+
 // Close graceful shutdown database
 // Implement database.DB
 func (server *StandaloneServer) Close() {
 	if server.persister != nil {
 		server.persister.Close()
 	}
-	//TODO 主从模式需要关闭
+	if server.slaveStatus != nil {
+		server.slaveStatus.configMu.Lock()
+		server.stopSlave()
+		server.slaveStatus.configMu.Unlock()
+	}
+	if server.stopCron != nil {
+		close(server.stopCron)
+		server.stopCron = nil
+	}
 }
 
-// AfterClientClose
+// AfterClientClose does some clean after client close connection
 // Implement database.DB
 func (server *StandaloneServer) AfterClientClose(c godis.Connection) {
-	//	TODO pubsub 模式需要实现
+	pubsub.UnsubscribeAll(server.hub, c)
+	if db, errReply := server.selectDB(c.GetDBIndex()); errReply == nil {
+		db.blocking.cancelClient(c)
+	}
+	if c.IsSlave() && server.masterStatus != nil {
+		server.removeSlave(c)
+	}
+}
+
+// isSubscribeModeCommand returns whether the command can be executed by a subscribing connection
+func isSubscribeModeCommand(cmdName string) bool {
+	switch cmdName {
+	case "subscribe", "unsubscribe", "psubscribe", "punsubscribe", "ping":
+		return true
+	}
+	return false
+}
+
+// isServerCommand returns whether the command is executed by server instead of DB.Exec, so it can't be queued by MULTI
+func isServerCommand(cmdName string) bool {
+	switch cmdName {
+	case "subscribe", "unsubscribe", "psubscribe", "punsubscribe", "publish", "pubsub",
+		"save", "bgsave", "lastsave", "info", "config", "script", "slowlog", "latency", "client",
+		"slaveof", "replicaof", "psync", "replconf", "object", "memory":
+		return true
+	}
+	return isEvalCommand(cmdName)
 }
 
 // ExecWithLock executes normal commands, invoker should provide locks
@@ -178,19 +387,15 @@ func (server *StandaloneServer) GetExpiration(dbIndex int, key string) *time.Tim
 	return &expireTime
 }
 
-//// TODO 实现ExecMulti executes multi commands transaction Atomically and Isolated
-//func (server *StandaloneServer) ExecMulti(conn godis.Connection, watching map[string]uint32, cmdLines []CmdLine) redis.Reply {
-//	selectedDB, errReply := server.selectDB(conn.GetDBIndex())
-//	if errReply != nil {
-//		return errReply
-//	}
-//	return selectedDB.ExecMulti(conn, watching, cmdLines)
-//}
-
-//// TODO 实现GetUndoLogs return rollback commands
-//func (server *StandaloneServer) GetUndoLogs(dbIndex int, cmdLine [][]byte) []CmdLine {
-//	return server.mustSelectDB(dbIndex).GetUndoLogs(cmdLine)
-//}
+// ExecMulti executes multi commands transaction Atomically and Isolated
+// Implement database.DBEngine
+func (server *StandaloneServer) ExecMulti(conn godis.Connection, watching map[string]uint32, cmdLines []CmdLine) godis.Reply {
+	selectedDB, errReply := server.selectDB(conn.GetDBIndex())
+	if errReply != nil {
+		return errReply
+	}
+	return selectedDB.ExecMulti(conn, watching, cmdLines)
+}
 
 // execSelect
 //
@@ -211,7 +416,7 @@ func execSelect(conn godis.Connection, database *StandaloneServer, args [][]byte
 	return protocol.MakeOkReply()
 }
 
-// TODO 优化RDB and slave
+// fileExists returns whether the given regular file exists
 func fileExists(filename string) bool {
 	info, err := os.Stat(filename)
 	return err == nil && !info.IsDir()
@@ -234,6 +439,24 @@ func (server *StandaloneServer) mustSelectDB(dbIndex int) *DB {
 	return selectedDB
 }
 
+// SetKeyInsertedCallback sets callback which will be called when a new key is inserted
+// Implement database.DBEngine
+func (server *StandaloneServer) SetKeyInsertedCallback(cb database.KeyEventCallback) {
+	server.insertCallback = cb
+	for i := range server.dbSet {
+		server.mustSelectDB(i).insertCallback = cb
+	}
+}
+
+// SetKeyDeletedCallback sets callback which will be called when a key is deleted
+// Implement database.DBEngine
+func (server *StandaloneServer) SetKeyDeletedCallback(cb database.KeyEventCallback) {
+	server.deleteCallback = cb
+	for i := range server.dbSet {
+		server.mustSelectDB(i).deleteCallback = cb
+	}
+}
+
 // GetUndoLogs return rollback commands
 func (server *StandaloneServer) GetUndoLogs(dbIndex int, cmdLine [][]byte) []CmdLine {
 	return server.mustSelectDB(dbIndex).GetUndoLogs(cmdLine)
@@ -0,0 +1,1349 @@
+package database
+
+import (
+	"github.com/Allen9012/Godis/aof"
+	Stream "github.com/Allen9012/Godis/datastruct/stream"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/interface/database"
+	"github.com/Allen9012/Godis/interface/godis"
+	"github.com/Allen9012/Godis/lib/utils"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/10
+  @desc: stream 命令, 包括 XADD XRANGE XREAD 和 consumer group 相关命令
+  @modified by:
+**/
+
+func init() {
+	registerCommand("XAdd", execXAdd, writeFirstKey, rollbackFirstKey, -5, flagWrite)
+	registerCommand("XLen", execXLen, readFirstKey, nil, 2, flagReadOnly)
+	registerCommand("XRange", execXRange, readFirstKey, nil, -4, flagReadOnly)
+	registerCommand("XRevRange", execXRevRange, readFirstKey, nil, -4, flagReadOnly)
+	registerCommand("XDel", execXDel, writeFirstKey, rollbackFirstKey, -3, flagWrite)
+	registerCommand("XTrim", execXTrim, writeFirstKey, rollbackFirstKey, -4, flagWrite)
+	registerCommand("XSetID", execXSetID, writeFirstKey, rollbackFirstKey, -3, flagWrite)
+	registerCommand("XGroup", execXGroup, prepareXGroup, undoXGroup, -2, flagWrite)
+	registerCommand("XAck", execXAck, writeFirstKey, rollbackFirstKey, -4, flagWrite)
+	registerCommand("XPending", execXPending, readFirstKey, nil, -3, flagReadOnly)
+	registerCommand("XClaim", execXClaim, writeFirstKey, rollbackFirstKey, -6, flagWrite)
+	registerCommand("XAutoClaim", execXAutoClaim, writeFirstKey, rollbackFirstKey, -6, flagWrite)
+	registerBlockingCommand("XRead", tryXRead, prepareXRead, nil, -4, flagReadOnly, xReadKeys, xReadTimeout)
+	registerBlockingCommand("XReadGroup", tryXReadGroup, prepareXReadGroup, undoXReadGroup, -7, flagWrite, xReadGroupKeys, xReadGroupTimeout)
+}
+
+func (db *DB) getAsStream(key string) (*Stream.Stream, protocol.ErrorReply) {
+	entity, ok := db.GetEntity(key)
+	if !ok {
+		return nil, nil
+	}
+	stream, ok := entity.Data.(*Stream.Stream)
+	if !ok {
+		return nil, protocol.MakeWrongTypeErrReply()
+	}
+	return stream, nil
+}
+
+// getStreamGroup returns stream and its consumer group, returns NOGROUP error if any of them does not exist
+func (db *DB) getStreamGroup(key string, groupName string) (*Stream.Stream, *Stream.Group, protocol.ErrorReply) {
+	stream, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return nil, nil, errReply
+	}
+	var group *Stream.Group
+	if stream != nil {
+		group = stream.GetGroup(groupName)
+	}
+	if group == nil {
+		return nil, nil, protocol.MakeErrReply("NOGROUP No such key '" + key + "' or consumer group '" + groupName + "'")
+	}
+	return stream, group, nil
+}
+
+/* ---- arguments ---- */
+
+func makeInvalidStreamIDErr() protocol.ErrorReply {
+	return protocol.MakeErrReply("ERR Invalid stream ID specified as stream command argument")
+}
+
+func makeNotIntegerErr() protocol.ErrorReply {
+	return protocol.MakeErrReply("ERR value is not an integer or out of range")
+}
+
+// parseStreamID parses <ms>-<seq>, seq is 0 if omitted
+func parseStreamID(arg []byte) (Stream.ID, protocol.ErrorReply) {
+	id, err := Stream.ParseID(string(arg), 0)
+	if err != nil {
+		return id, makeInvalidStreamIDErr()
+	}
+	return id, nil
+}
+
+// parseRangeID parses boundary of XRANGE, supports - + and exclusive boundary starts with (
+//
+//	@Description: 省略序列号时, start 的序列号为 0, end 的序列号为最大值
+//	@param arg
+//	@param isStart
+//	@return Stream.ID
+//	@return protocol.ErrorReply
+func parseRangeID(arg []byte, isStart bool) (Stream.ID, protocol.ErrorReply) {
+	s := string(arg)
+	if s == "-" {
+		return Stream.MinID, nil
+	} else if s == "+" {
+		return Stream.MaxID, nil
+	}
+	exclusive := strings.HasPrefix(s, "(")
+	if exclusive {
+		s = s[1:]
+	}
+	defaultSeq := uint64(0)
+	if !isStart {
+		defaultSeq = math.MaxUint64
+	}
+	id, err := Stream.ParseID(s, defaultSeq)
+	if err != nil {
+		return id, makeInvalidStreamIDErr()
+	}
+	if !exclusive {
+		return id, nil
+	}
+	var ok bool
+	if isStart {
+		if id, ok = id.Next(); !ok {
+			return id, protocol.MakeErrReply("ERR invalid start ID for the interval")
+		}
+	} else {
+		if id, ok = id.Prev(); !ok {
+			return id, protocol.MakeErrReply("ERR invalid end ID for the interval")
+		}
+	}
+	return id, nil
+}
+
+// nextStreamID generates ID of the new entry of XADD, idArg could be *, <ms>-* or <ms>-<seq>
+func nextStreamID(lastID Stream.ID, idArg string) (Stream.ID, protocol.ErrorReply) {
+	tooSmallErr := protocol.MakeErrReply("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	var id Stream.ID
+	if idArg == "*" {
+		var ok bool
+		if id, ok = Stream.NextID(lastID, time.Now()); !ok {
+			return id, protocol.MakeErrReply("ERR The stream has exhausted the last possible ID, unable to add more items")
+		}
+		return id, nil
+	} else if strings.HasSuffix(idArg, "-*") {
+		ms, err := strconv.ParseUint(strings.TrimSuffix(idArg, "-*"), 10, 64)
+		if err != nil {
+			return id, makeInvalidStreamIDErr()
+		}
+		if ms < lastID.Ms || (ms == lastID.Ms && lastID.Seq == math.MaxUint64) {
+			return id, tooSmallErr
+		}
+		id.Ms = ms
+		if ms == lastID.Ms {
+			id.Seq = lastID.Seq + 1
+		}
+	} else {
+		var errReply protocol.ErrorReply
+		if id, errReply = parseStreamID([]byte(idArg)); errReply != nil {
+			return id, errReply
+		}
+	}
+	if id == Stream.MinID {
+		return id, protocol.MakeErrReply("ERR The ID specified in XADD must be greater than 0-0")
+	}
+	if !lastID.Less(id) {
+		return id, tooSmallErr
+	}
+	return id, nil
+}
+
+// streamTrimOptions is MAXLEN|MINID [=|~] threshold [LIMIT count]
+type streamTrimOptions struct {
+	byMinID bool
+	maxLen  int
+	minID   Stream.ID
+	approx  bool
+	limit   int
+}
+
+// parseStreamTrim parses trim options starts from args[i], returns the index of next argument
+func parseStreamTrim(args [][]byte, i int) (*streamTrimOptions, int, protocol.ErrorReply) {
+	opts := &streamTrimOptions{
+		byMinID: strings.ToUpper(string(args[i])) == "MINID",
+	}
+	i++
+	if i < len(args) && (string(args[i]) == "=" || string(args[i]) == "~") {
+		opts.approx = string(args[i]) == "~"
+		i++
+	}
+	if i >= len(args) {
+		return nil, 0, protocol.MakeSyntaxErrReply()
+	}
+	if opts.byMinID {
+		minID, errReply := parseStreamID(args[i])
+		if errReply != nil {
+			return nil, 0, errReply
+		}
+		opts.minID = minID
+	} else {
+		maxLen, err := strconv.ParseInt(string(args[i]), 10, 64)
+		if err != nil {
+			return nil, 0, makeNotIntegerErr()
+		}
+		if maxLen < 0 {
+			return nil, 0, protocol.MakeErrReply("ERR The MAXLEN argument must be >= 0.")
+		}
+		opts.maxLen = int(maxLen)
+	}
+	i++
+	if i+1 < len(args) && strings.ToUpper(string(args[i])) == "LIMIT" {
+		limit, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+		if err != nil {
+			return nil, 0, makeNotIntegerErr()
+		}
+		if limit < 0 {
+			return nil, 0, protocol.MakeErrReply("ERR The LIMIT argument must be >= 0.")
+		}
+		if !opts.approx {
+			return nil, 0, protocol.MakeErrReply("ERR syntax error, LIMIT cannot be used without the special ~ option")
+		}
+		opts.limit = int(limit)
+		i += 2
+	}
+	return opts, i, nil
+}
+
+// trimStream removes entries by options and records the result in aof, returns the number of removed entries
+func (db *DB) trimStream(key string, stream *Stream.Stream, opts *streamTrimOptions) int {
+	var removed int
+	if opts.byMinID {
+		removed = stream.TrimByMinID(opts.minID, opts.approx, opts.limit)
+	} else {
+		removed = stream.TrimByLen(opts.maxLen, opts.approx, opts.limit)
+	}
+	if removed > 0 {
+		// approximate trimming depends on the layout of nodes, so record the exact length
+		db.addAof(utils.ToCmdLine("xtrim", key, "MAXLEN", strconv.Itoa(stream.Len())))
+		db.notifyKeyspaceEvent(notifyStream, "xtrim", key)
+	}
+	return removed
+}
+
+/* ---- replies ---- */
+
+func streamEntryToReply(entry *Stream.Entry) godis.Reply {
+	return protocol.MakeMultiRawReply([]godis.Reply{
+		protocol.MakeBulkReply([]byte(entry.ID.String())),
+		protocol.MakeMultiBulkReply(entry.Fields),
+	})
+}
+
+func streamEntriesToReply(entries []*Stream.Entry) godis.Reply {
+	replies := make([]godis.Reply, len(entries))
+	for i, entry := range entries {
+		replies[i] = streamEntryToReply(entry)
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+func streamIDsToReply(ids []Stream.ID) godis.Reply {
+	args := make([][]byte, len(ids))
+	for i, id := range ids {
+		args[i] = []byte(id.String())
+	}
+	return protocol.MakeMultiBulkReply(args)
+}
+
+/* ---- basic commands ---- */
+
+// execXAdd
+//
+//	@Description: XADD key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold [LIMIT count]] *|id field value [field value ...]
+//	@param db
+//	@param args
+//	@return godis.Reply	新 entry 的 ID
+func execXAdd(db *DB, args [][]byte) godis.Reply {
+	key := string(args[0])
+	noMkStream := false
+	var trimOpts *streamTrimOptions
+	i := 1
+	for i < len(args) {
+		arg := strings.ToUpper(string(args[i]))
+		if arg == "NOMKSTREAM" {
+			noMkStream = true
+			i++
+		} else if arg == "MAXLEN" || arg == "MINID" {
+			opts, next, errReply := parseStreamTrim(args, i)
+			if errReply != nil {
+				return errReply
+			}
+			trimOpts = opts
+			i = next
+		} else {
+			break
+		}
+	}
+	fields := args[i+1:]
+	if i >= len(args) || len(fields) == 0 || len(fields)%2 != 0 {
+		return protocol.MakeArgNumErrReply("xadd")
+	}
+	stream, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+	if stream == nil && noMkStream {
+		return protocol.MakeNullBulkReply()
+	}
+	lastID := Stream.MinID
+	if stream != nil {
+		lastID = stream.LastID()
+	}
+	id, errReply := nextStreamID(lastID, string(args[i]))
+	if errReply != nil {
+		return errReply
+	}
+	if stream == nil {
+		stream = Stream.Make()
+		db.PutEntity(key, &database.DataEntity{
+			Data: stream,
+		})
+	}
+	_ = stream.Add(id, fields)
+	// record the generated ID, so that the entry is the same after reloading
+	db.addAof(utils.ToCmdLine3("xadd", append([][]byte{args[0], []byte(id.String())}, fields...)...))
+	db.notifyKeyspaceEvent(notifyStream, "xadd", key)
+	if trimOpts != nil {
+		db.trimStream(key, stream, trimOpts)
+	}
+	db.signalKeyReady(key)
+	return protocol.MakeBulkReply([]byte(id.String()))
+}
+
+// execXLen
+//
+//	@Description: XLEN key
+//	@param db
+//	@param args
+//	@return godis.Reply
+func execXLen(db *DB, args [][]byte) godis.Reply {
+	stream, errReply := db.getAsStream(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if stream == nil {
+		return protocol.MakeIntReply(0)
+	}
+	return protocol.MakeIntReply(int64(stream.Len()))
+}
+
+// execXRange
+//
+//	@Description: XRANGE key start end [COUNT count]
+//	@param db
+//	@param args
+//	@return godis.Reply
+func execXRange(db *DB, args [][]byte) godis.Reply {
+	return xRange(db, args, false)
+}
+
+// execXRevRange
+//
+//	@Description: XREVRANGE key end start [COUNT count]
+//	@param db
+//	@param args
+//	@return godis.Reply
+func execXRevRange(db *DB, args [][]byte) godis.Reply {
+	return xRange(db, args, true)
+}
+
+func xRange(db *DB, args [][]byte, reverse bool) godis.Reply {
+	startArg, endArg := args[1], args[2]
+	if reverse {
+		startArg, endArg = args[2], args[1]
+	}
+	start, errReply := parseRangeID(startArg, true)
+	if errReply != nil {
+		return errReply
+	}
+	end, errReply := parseRangeID(endArg, false)
+	if errReply != nil {
+		return errReply
+	}
+	count := int64(0)
+	if len(args) > 3 {
+		if len(args) != 5 || strings.ToUpper(string(args[3])) != "COUNT" {
+			return protocol.MakeSyntaxErrReply()
+		}
+		var err error
+		if count, err = strconv.ParseInt(string(args[4]), 10, 64); err != nil {
+			return makeNotIntegerErr()
+		}
+		if count <= 0 {
+			return protocol.MakeEmptyMultiBulkReply()
+		}
+	}
+	stream, errReply := db.getAsStream(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if stream == nil {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+	return streamEntriesToReply(stream.Range(start, end, int(count), reverse))
+}
+
+// execXDel
+//
+//	@Description: XDEL key id [id ...]
+//	@param db
+//	@param args
+//	@return godis.Reply	删除的 entry 数量
+func execXDel(db *DB, args [][]byte) godis.Reply {
+	ids := make([]Stream.ID, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		id, errReply := parseStreamID(arg)
+		if errReply != nil {
+			return errReply
+		}
+		ids = append(ids, id)
+	}
+	stream, errReply := db.getAsStream(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if stream == nil {
+		return protocol.MakeIntReply(0)
+	}
+	deleted := 0
+	for _, id := range ids {
+		if stream.Delete(id) {
+			deleted++
+		}
+	}
+	if deleted > 0 {
+		db.addAof(utils.ToCmdLine3("xdel", args...))
+		db.notifyKeyspaceEvent(notifyStream, "xdel", string(args[0]))
+	}
+	return protocol.MakeIntReply(int64(deleted))
+}
+
+// execXTrim
+//
+//	@Description: XTRIM key MAXLEN|MINID [=|~] threshold [LIMIT count]
+//	@param db
+//	@param args
+//	@return godis.Reply	删除的 entry 数量
+func execXTrim(db *DB, args [][]byte) godis.Reply {
+	key := string(args[0])
+	strategy := strings.ToUpper(string(args[1]))
+	if strategy != "MAXLEN" && strategy != "MINID" {
+		return protocol.MakeSyntaxErrReply()
+	}
+	opts, next, errReply := parseStreamTrim(args, 1)
+	if errReply != nil {
+		return errReply
+	}
+	if next != len(args) {
+		return protocol.MakeSyntaxErrReply()
+	}
+	stream, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+	if stream == nil {
+		return protocol.MakeIntReply(0)
+	}
+	return protocol.MakeIntReply(int64(db.trimStream(key, stream, opts)))
+}
+
+// execXSetID
+//
+//	@Description: XSETID key last-id [ENTRIESADDED entries-added] [MAXDELETEDID max-deleted-id]
+//	@param db
+//	@param args
+//	@return godis.Reply
+func execXSetID(db *DB, args [][]byte) godis.Reply {
+	id, errReply := parseStreamID(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	entriesAdded := int64(-1)
+	var maxDeletedID *Stream.ID
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return protocol.MakeSyntaxErrReply()
+		}
+		switch strings.ToUpper(string(args[i])) {
+		case "ENTRIESADDED":
+			n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return makeNotIntegerErr()
+			}
+			if n < 0 {
+				return protocol.MakeErrReply("ERR entries_added must be positive")
+			}
+			entriesAdded = n
+		case "MAXDELETEDID":
+			maxDeleted, errReply := parseStreamID(args[i+1])
+			if errReply != nil {
+				return errReply
+			}
+			if id.Less(maxDeleted) {
+				return protocol.MakeErrReply("ERR The ID specified in XSETID is smaller than the provided max_deleted_entry_id")
+			}
+			maxDeletedID = &maxDeleted
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+	}
+	stream, errReply := db.getAsStream(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if stream == nil {
+		return protocol.MakeErrReply("ERR no such key")
+	}
+	if last := stream.LastEntry(); last != nil && id.Less(last.ID) {
+		return protocol.MakeErrReply("ERR The ID specified in XSETID is smaller than the target stream top item")
+	}
+	if entriesAdded >= 0 && entriesAdded < int64(stream.Len()) {
+		return protocol.MakeErrReply("ERR The entries_added specified in XSETID is smaller than the target stream length")
+	}
+	stream.SetLastID(id)
+	if entriesAdded >= 0 {
+		stream.SetEntriesAdded(uint64(entriesAdded))
+	}
+	if maxDeletedID != nil {
+		stream.SetMaxDeletedID(*maxDeletedID)
+	}
+	db.addAof(utils.ToCmdLine3("xsetid", args...))
+	db.notifyKeyspaceEvent(notifyStream, "xsetid", string(args[0]))
+	return protocol.MakeOkReply()
+}
+
+/* ---- consumer group ---- */
+
+func prepareXGroup(args [][]byte) ([]string, []string) {
+	if len(args) < 2 {
+		return nil, nil
+	}
+	return []string{string(args[1])}, nil
+}
+
+func undoXGroup(db *DB, args [][]byte) []CmdLine {
+	if len(args) < 2 {
+		return nil
+	}
+	return rollbackGivenKeys(db, string(args[1]))
+}
+
+// execXGroup
+//
+//	@Description: XGROUP CREATE|SETID|DESTROY|CREATECONSUMER|DELCONSUMER key group ...
+//	@param db
+//	@param args
+//	@return godis.Reply
+func execXGroup(db *DB, args [][]byte) godis.Reply {
+	subCommand := strings.ToLower(string(args[0]))
+	var arity int
+	var exec ExecFunc
+	switch subCommand {
+	case "create":
+		arity, exec = -4, execXGroupCreate
+	case "setid":
+		arity, exec = -4, execXGroupSetID
+	case "destroy":
+		arity, exec = 3, execXGroupDestroy
+	case "createconsumer":
+		arity, exec = 4, execXGroupCreateConsumer
+	case "delconsumer":
+		arity, exec = 4, execXGroupDelConsumer
+	default:
+		return protocol.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try XGROUP HELP.")
+	}
+	if !validateArity(arity, args) {
+		return protocol.MakeArgNumErrReply("xgroup|" + subCommand)
+	}
+	return exec(db, args[1:])
+}
+
+// parseEntriesRead validates ENTRIESREAD option, entries read of group is not tracked
+func parseEntriesRead(args [][]byte) protocol.ErrorReply {
+	if len(args) != 2 || strings.ToUpper(string(args[0])) != "ENTRIESREAD" {
+		return protocol.MakeSyntaxErrReply()
+	}
+	if _, err := strconv.ParseInt(string(args[1]), 10, 64); err != nil {
+		return makeNotIntegerErr()
+	}
+	return nil
+}
+
+// parseGroupID parses last delivered ID of group, $ means the last ID of stream
+func parseGroupID(stream *Stream.Stream, arg []byte) (Stream.ID, protocol.ErrorReply) {
+	if string(arg) != "$" {
+		return parseStreamID(arg)
+	}
+	if stream == nil {
+		return Stream.MinID, nil
+	}
+	return stream.LastID(), nil
+}
+
+// execXGroupCreate
+//
+//	@Description: XGROUP CREATE key group id|$ [MKSTREAM] [ENTRIESREAD entries-read]
+//	@param db
+//	@param args
+//	@return godis.Reply
+func execXGroupCreate(db *DB, args [][]byte) godis.Reply {
+	key, groupName := string(args[0]), string(args[1])
+	mkStream := false
+	options := args[3:]
+	if len(options) > 0 && strings.ToUpper(string(options[0])) == "MKSTREAM" {
+		mkStream = true
+		options = options[1:]
+	}
+	if len(options) > 0 {
+		if errReply := parseEntriesRead(options); errReply != nil {
+			return errReply
+		}
+	}
+	stream, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+	id, errReply := parseGroupID(stream, args[2])
+	if errReply != nil {
+		return errReply
+	}
+	if stream == nil {
+		if !mkStream {
+			return protocol.MakeErrReply("ERR The XGROUP subcommand requires the key to exist. " +
+				"Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+		}
+		stream = Stream.Make()
+		db.PutEntity(key, &database.DataEntity{
+			Data: stream,
+		})
+	}
+	if _, ok := stream.CreateGroup(groupName, id); !ok {
+		return protocol.MakeErrReply("BUSYGROUP Consumer Group name already exists")
+	}
+	db.addAof(utils.ToCmdLine("xgroup", "create", key, groupName, id.String(), "MKSTREAM"))
+	db.notifyKeyspaceEvent(notifyStream, "xgroup-create", key)
+	return protocol.MakeOkReply()
+}
+
+// execXGroupSetID
+//
+//	@Description: XGROUP SETID key group id|$ [ENTRIESREAD entries-read]
+//	@param db
+//	@param args
+//	@return godis.Reply
+func execXGroupSetID(db *DB, args [][]byte) godis.Reply {
+	key, groupName := string(args[0]), string(args[1])
+	if len(args) > 3 {
+		if errReply := parseEntriesRead(args[3:]); errReply != nil {
+			return errReply
+		}
+	}
+	stream, group, errReply := db.getStreamGroup(key, groupName)
+	if errReply != nil {
+		return errReply
+	}
+	id, errReply := parseGroupID(stream, args[2])
+	if errReply != nil {
+		return errReply
+	}
+	group.LastID = id
+	db.addAof(utils.ToCmdLine("xgroup", "setid", key, groupName, id.String()))
+	db.notifyKeyspaceEvent(notifyStream, "xgroup-setid", key)
+	return protocol.MakeOkReply()
+}
+
+// execXGroupDestroy
+//
+//	@Description: XGROUP DESTROY key group
+//	@param db
+//	@param args
+//	@return godis.Reply	1 表示删除成功
+func execXGroupDestroy(db *DB, args [][]byte) godis.Reply {
+	key, groupName := string(args[0]), string(args[1])
+	stream, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+	if stream == nil {
+		return protocol.MakeErrReply("ERR The XGROUP subcommand requires the key to exist.")
+	}
+	if !stream.DestroyGroup(groupName) {
+		return protocol.MakeIntReply(0)
+	}
+	db.addAof(utils.ToCmdLine("xgroup", "destroy", key, groupName))
+	db.notifyKeyspaceEvent(notifyStream, "xgroup-destroy", key)
+	// clients blocked by XREADGROUP of this group should get error
+	db.signalKeyReady(key)
+	return protocol.MakeIntReply(1)
+}
+
+// execXGroupCreateConsumer
+//
+//	@Description: XGROUP CREATECONSUMER key group consumer
+//	@param db
+//	@param args
+//	@return godis.Reply	1 表示新建了 consumer
+func execXGroupCreateConsumer(db *DB, args [][]byte) godis.Reply {
+	key, groupName, consumerName := string(args[0]), string(args[1]), string(args[2])
+	_, group, errReply := db.getStreamGroup(key, groupName)
+	if errReply != nil {
+		return errReply
+	}
+	if _, created := group.CreateConsumer(consumerName, time.Now()); !created {
+		return protocol.MakeIntReply(0)
+	}
+	db.addAof(utils.ToCmdLine("xgroup", "createconsumer", key, groupName, consumerName))
+	db.notifyKeyspaceEvent(notifyStream, "xgroup-createconsumer", key)
+	return protocol.MakeIntReply(1)
+}
+
+// execXGroupDelConsumer
+//
+//	@Description: XGROUP DELCONSUMER key group consumer
+//	@param db
+//	@param args
+//	@return godis.Reply	consumer 被删除的 pending entry 数量
+func execXGroupDelConsumer(db *DB, args [][]byte) godis.Reply {
+	key, groupName, consumerName := string(args[0]), string(args[1]), string(args[2])
+	_, group, errReply := db.getStreamGroup(key, groupName)
+	if errReply != nil {
+		return errReply
+	}
+	if group.GetConsumer(consumerName) == nil {
+		return protocol.MakeIntReply(0)
+	}
+	removed := group.DeleteConsumer(consumerName)
+	db.addAof(utils.ToCmdLine("xgroup", "delconsumer", key, groupName, consumerName))
+	db.notifyKeyspaceEvent(notifyStream, "xgroup-delconsumer", key)
+	return protocol.MakeIntReply(int64(removed))
+}
+
+// execXAck
+//
+//	@Description: XACK key group id [id ...]
+//	@param db
+//	@param args
+//	@return godis.Reply	确认的 entry 数量
+func execXAck(db *DB, args [][]byte) godis.Reply {
+	ids := make([]Stream.ID, 0, len(args)-2)
+	for _, arg := range args[2:] {
+		id, errReply := parseStreamID(arg)
+		if errReply != nil {
+			return errReply
+		}
+		ids = append(ids, id)
+	}
+	stream, errReply := db.getAsStream(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if stream == nil {
+		return protocol.MakeIntReply(0)
+	}
+	group := stream.GetGroup(string(args[1]))
+	if group == nil {
+		return protocol.MakeIntReply(0)
+	}
+	acked := 0
+	for _, id := range ids {
+		if group.Ack(id) {
+			acked++
+		}
+	}
+	if acked > 0 {
+		db.addAof(utils.ToCmdLine3("xack", args...))
+	}
+	return protocol.MakeIntReply(int64(acked))
+}
+
+// execXPending
+//
+//	@Description: XPENDING key group [[IDLE min-idle-time] start end count [consumer]]
+//	不带范围时返回汇总信息: 数量, 最小 ID, 最大 ID, 每个 consumer 的数量
+//	@param db
+//	@param args
+//	@return godis.Reply
+func execXPending(db *DB, args [][]byte) godis.Reply {
+	_, group, errReply := db.getStreamGroup(string(args[0]), string(args[1]))
+	if errReply != nil {
+		return errReply
+	}
+	if len(args) == 2 {
+		return makeXPendingSummary(group)
+	}
+	i := 2
+	minIdle := int64(0)
+	if strings.ToUpper(string(args[i])) == "IDLE" {
+		if i+1 >= len(args) {
+			return protocol.MakeSyntaxErrReply()
+		}
+		var err error
+		if minIdle, err = strconv.ParseInt(string(args[i+1]), 10, 64); err != nil {
+			return makeNotIntegerErr()
+		}
+		i += 2
+	}
+	if len(args)-i != 3 && len(args)-i != 4 {
+		return protocol.MakeSyntaxErrReply()
+	}
+	start, errReply := parseRangeID(args[i], true)
+	if errReply != nil {
+		return errReply
+	}
+	end, errReply := parseRangeID(args[i+1], false)
+	if errReply != nil {
+		return errReply
+	}
+	count, err := strconv.ParseInt(string(args[i+2]), 10, 64)
+	if err != nil {
+		return makeNotIntegerErr()
+	}
+	var consumer *Stream.Consumer
+	if len(args)-i == 4 {
+		if consumer = group.GetConsumer(string(args[i+3])); consumer == nil {
+			return protocol.MakeEmptyMultiBulkReply()
+		}
+	}
+	now := time.Now()
+	replies := make([]godis.Reply, 0)
+	for _, pending := range group.PendingRange(start, end, 0, consumer) {
+		if int64(len(replies)) >= count {
+			break
+		}
+		idle := now.Sub(pending.DeliveryTime).Milliseconds()
+		if idle < minIdle {
+			continue
+		}
+		replies = append(replies, protocol.MakeMultiRawReply([]godis.Reply{
+			protocol.MakeBulkReply([]byte(pending.ID.String())),
+			protocol.MakeBulkReply([]byte(pending.Consumer.Name)),
+			protocol.MakeIntReply(idle),
+			protocol.MakeIntReply(pending.DeliveryCount),
+		}))
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+func makeXPendingSummary(group *Stream.Group) godis.Reply {
+	if group.PendingLen() == 0 {
+		return protocol.MakeMultiRawReply([]godis.Reply{
+			protocol.MakeIntReply(0),
+			protocol.MakeNullBulkReply(),
+			protocol.MakeNullBulkReply(),
+			protocol.MakeNullMultiBulkReply(),
+		})
+	}
+	pendings := group.PendingRange(Stream.MinID, Stream.MaxID, 0, nil)
+	consumers := make([]godis.Reply, 0)
+	for _, consumer := range group.Consumers() {
+		if consumer.PendingCount() == 0 {
+			continue
+		}
+		consumers = append(consumers, protocol.MakeMultiBulkReply([][]byte{
+			[]byte(consumer.Name),
+			[]byte(strconv.Itoa(consumer.PendingCount())),
+		}))
+	}
+	return protocol.MakeMultiRawReply([]godis.Reply{
+		protocol.MakeIntReply(int64(len(pendings))),
+		protocol.MakeBulkReply([]byte(pendings[0].ID.String())),
+		protocol.MakeBulkReply([]byte(pendings[len(pendings)-1].ID.String())),
+		protocol.MakeMultiRawReply(consumers),
+	})
+}
+
+// xClaimOptions is options of XCLAIM and XAUTOCLAIM
+type xClaimOptions struct {
+	// deliveryTime is set by IDLE or TIME, nil means now
+	deliveryTime *time.Time
+	// retryCount is set by RETRYCOUNT, -1 means increasing delivery count
+	retryCount int64
+	force      bool
+	justID     bool
+	lastID     *Stream.ID
+}
+
+// claimPending transfers pending entry to consumer and records it in aof
+func (db *DB) claimPending(key string, group *Stream.Group, pending *Stream.PendingEntry,
+	consumer *Stream.Consumer, opts *xClaimOptions, now time.Time) {
+	group.Claim(pending, consumer)
+	pending.DeliveryTime = now
+	if opts.deliveryTime != nil {
+		pending.DeliveryTime = *opts.deliveryTime
+	}
+	if !opts.justID {
+		pending.DeliveryCount++
+	}
+	if opts.retryCount >= 0 {
+		pending.DeliveryCount = opts.retryCount
+	}
+	db.addAof(aof.MakeXClaimCmd(key, group.Name, pending).Args)
+}
+
+// execXClaim
+//
+//	@Description: XCLAIM key group consumer min-idle-time id [id ...] [IDLE ms] [TIME unix-time-milliseconds]
+//	[RETRYCOUNT count] [FORCE] [JUSTID] [LASTID lastid]
+//	已经从 stream 中删除的 entry 会从 PEL 中移除且不返回
+//	@param db
+//	@param args
+//	@return godis.Reply
+func execXClaim(db *DB, args [][]byte) godis.Reply {
+	key, groupName, consumerName := string(args[0]), string(args[1]), string(args[2])
+	minIdle, err := strconv.ParseInt(string(args[3]), 10, 64)
+	if err != nil {
+		return protocol.MakeErrReply("ERR Invalid min-idle-time argument for XCLAIM")
+	}
+	var ids []Stream.ID
+	i := 4
+	for ; i < len(args); i++ {
+		id, err := Stream.ParseID(string(args[i]), 0)
+		if err != nil {
+			break
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return makeInvalidStreamIDErr()
+	}
+	now := time.Now()
+	opts := &xClaimOptions{retryCount: -1}
+	for ; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		switch option {
+		case "FORCE":
+			opts.force = true
+		case "JUSTID":
+			opts.justID = true
+		case "IDLE", "TIME", "RETRYCOUNT", "LASTID":
+			if i+1 >= len(args) {
+				return protocol.MakeSyntaxErrReply()
+			}
+			i++
+			if option == "LASTID" {
+				lastID, errReply := parseStreamID(args[i])
+				if errReply != nil {
+					return errReply
+				}
+				opts.lastID = &lastID
+				continue
+			}
+			n, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				return makeNotIntegerErr()
+			}
+			if option == "RETRYCOUNT" {
+				opts.retryCount = n
+				continue
+			}
+			deliveryTime := time.UnixMilli(n)
+			if option == "IDLE" {
+				deliveryTime = now.Add(-time.Duration(n) * time.Millisecond)
+			}
+			opts.deliveryTime = &deliveryTime
+		default:
+			return protocol.MakeErrReply("ERR Unrecognized XCLAIM option '" + string(args[i]) + "'")
+		}
+	}
+	stream, group, errReply := db.getStreamGroup(key, groupName)
+	if errReply != nil {
+		return errReply
+	}
+	if opts.lastID != nil && group.LastID.Less(*opts.lastID) {
+		group.LastID = *opts.lastID
+		db.addAof(utils.ToCmdLine("xgroup", "setid", key, groupName, group.LastID.String()))
+	}
+	consumer, _ := group.CreateConsumer(consumerName, now)
+	consumer.SeenTime = now
+	var claimed []*Stream.Entry
+	var claimedIDs []Stream.ID
+	for _, id := range ids {
+		entry := stream.Get(id)
+		pending := group.GetPending(id)
+		if pending == nil {
+			if !opts.force || entry == nil {
+				continue
+			}
+			// FORCE creates pending entry even though it was not delivered
+			pending = group.Deliver(id, consumer, now)
+			pending.DeliveryCount = 0
+		} else if entry == nil {
+			group.Ack(id)
+			db.addAof(utils.ToCmdLine("xack", key, groupName, id.String()))
+			continue
+		} else if now.Sub(pending.DeliveryTime).Milliseconds() < minIdle {
+			continue
+		}
+		db.claimPending(key, group, pending, consumer, opts, now)
+		claimed = append(claimed, entry)
+		claimedIDs = append(claimedIDs, id)
+	}
+	if opts.justID {
+		return streamIDsToReply(claimedIDs)
+	}
+	return streamEntriesToReply(claimed)
+}
+
+// execXAutoClaim
+//
+//	@Description: XAUTOCLAIM key group consumer min-idle-time start [COUNT count] [JUSTID]
+//	返回 [下一次扫描的起始 ID, 转移的 entry, 已经从 stream 中删除的 ID]
+//	@param db
+//	@param args
+//	@return godis.Reply
+func execXAutoClaim(db *DB, args [][]byte) godis.Reply {
+	key, groupName, consumerName := string(args[0]), string(args[1]), string(args[2])
+	minIdle, err := strconv.ParseInt(string(args[3]), 10, 64)
+	if err != nil {
+		return protocol.MakeErrReply("ERR Invalid min-idle-time argument for XAUTOCLAIM")
+	}
+	start, errReply := parseRangeID(args[4], true)
+	if errReply != nil {
+		return errReply
+	}
+	count := int64(100)
+	opts := &xClaimOptions{retryCount: -1}
+	for i := 5; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "COUNT":
+			if i+1 >= len(args) {
+				return protocol.MakeSyntaxErrReply()
+			}
+			i++
+			if count, err = strconv.ParseInt(string(args[i]), 10, 64); err != nil {
+				return makeNotIntegerErr()
+			}
+			if count <= 0 {
+				return protocol.MakeErrReply("ERR COUNT must be > 0")
+			}
+		case "JUSTID":
+			opts.justID = true
+		default:
+			return protocol.MakeSyntaxErrReply()
+		}
+	}
+	stream, group, errReply := db.getStreamGroup(key, groupName)
+	if errReply != nil {
+		return errReply
+	}
+	now := time.Now()
+	consumer, _ := group.CreateConsumer(consumerName, now)
+	consumer.SeenTime = now
+
+	pendings := group.PendingRange(start, Stream.MaxID, int(count), nil)
+	next := Stream.MinID
+	if int64(len(pendings)) == count {
+		if after, ok := pendings[len(pendings)-1].ID.Next(); ok {
+			if rest := group.PendingRange(after, Stream.MaxID, 1, nil); len(rest) > 0 {
+				next = rest[0].ID
+			}
+		}
+	}
+	var claimed []*Stream.Entry
+	var claimedIDs, deletedIDs []Stream.ID
+	for _, pending := range pendings {
+		if now.Sub(pending.DeliveryTime).Milliseconds() < minIdle {
+			continue
+		}
+		entry := stream.Get(pending.ID)
+		if entry == nil {
+			group.Ack(pending.ID)
+			db.addAof(utils.ToCmdLine("xack", key, groupName, pending.ID.String()))
+			deletedIDs = append(deletedIDs, pending.ID)
+			continue
+		}
+		db.claimPending(key, group, pending, consumer, opts, now)
+		claimed = append(claimed, entry)
+		claimedIDs = append(claimedIDs, pending.ID)
+	}
+	var claimedReply godis.Reply
+	if opts.justID {
+		claimedReply = streamIDsToReply(claimedIDs)
+	} else {
+		claimedReply = streamEntriesToReply(claimed)
+	}
+	return protocol.MakeMultiRawReply([]godis.Reply{
+		protocol.MakeBulkReply([]byte(next.String())),
+		claimedReply,
+		streamIDsToReply(deletedIDs),
+	})
+}
+
+/* ---- XREAD ---- */
+
+// xReadOptions is arguments of XREAD and XREADGROUP
+type xReadOptions struct {
+	group    string
+	consumer string
+	// count <= 0 means no limit
+	count int
+	// block is negative if not blocking
+	block time.Duration
+	noAck bool
+	keys  []string
+	// idIndex is the index of ID of the first key in args
+	idIndex int
+}
+
+// parseXReadArgs
+//
+//	@Description: 解析 XREAD [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+//	和 XREADGROUP GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+//	@param args
+//	@param withGroup
+//	@return *xReadOptions
+//	@return protocol.ErrorReply
+func parseXReadArgs(args [][]byte, withGroup bool) (*xReadOptions, protocol.ErrorReply) {
+	opts := &xReadOptions{block: -1}
+	for i := 0; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		switch option {
+		case "GROUP":
+			if !withGroup || i+2 >= len(args) {
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+			opts.group, opts.consumer = string(args[i+1]), string(args[i+2])
+			i += 2
+		case "COUNT", "BLOCK":
+			if i+1 >= len(args) {
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+			i++
+			n, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if option == "COUNT" {
+				if err != nil {
+					return nil, makeNotIntegerErr()
+				}
+				opts.count = int(n)
+				continue
+			}
+			if err != nil {
+				return nil, protocol.MakeErrReply("ERR timeout is not an integer or out of range")
+			}
+			if n < 0 {
+				return nil, protocol.MakeErrReply("ERR timeout is negative")
+			}
+			opts.block = time.Duration(n) * time.Millisecond
+		case "NOACK":
+			if !withGroup {
+				return nil, protocol.MakeSyntaxErrReply()
+			}
+			opts.noAck = true
+		case "STREAMS":
+			rest := args[i+1:]
+			if len(rest) == 0 || len(rest)%2 != 0 {
+				cmdName := "xread"
+				if withGroup {
+					cmdName = "xreadgroup"
+				}
+				return nil, protocol.MakeErrReply("ERR Unbalanced '" + cmdName +
+					"' list of streams: for each stream key an ID or '$' must be specified.")
+			}
+			if withGroup && opts.group == "" {
+				return nil, protocol.MakeErrReply("ERR Missing GROUP option for XREADGROUP")
+			}
+			n := len(rest) / 2
+			opts.keys = make([]string, n)
+			for j := 0; j < n; j++ {
+				opts.keys[j] = string(rest[j])
+			}
+			opts.idIndex = i + 1 + n
+			return opts, nil
+		default:
+			return nil, protocol.MakeSyntaxErrReply()
+		}
+	}
+	return nil, protocol.MakeSyntaxErrReply()
+}
+
+func xReadKeys(args [][]byte) []string {
+	opts, errReply := parseXReadArgs(args, false)
+	if errReply != nil {
+		return nil
+	}
+	return opts.keys
+}
+
+func xReadGroupKeys(args [][]byte) []string {
+	opts, errReply := parseXReadArgs(args, true)
+	if errReply != nil {
+		return nil
+	}
+	return opts.keys
+}
+
+func prepareXRead(args [][]byte) ([]string, []string) {
+	return nil, xReadKeys(args)
+}
+
+func prepareXReadGroup(args [][]byte) ([]string, []string) {
+	return xReadGroupKeys(args), nil
+}
+
+func undoXReadGroup(db *DB, args [][]byte) []CmdLine {
+	return rollbackGivenKeys(db, xReadGroupKeys(args)...)
+}
+
+func xReadTimeout(args [][]byte) (time.Duration, protocol.ErrorReply) {
+	opts, errReply := parseXReadArgs(args, false)
+	if errReply != nil {
+		return 0, errReply
+	}
+	return opts.block, nil
+}
+
+func xReadGroupTimeout(args [][]byte) (time.Duration, protocol.ErrorReply) {
+	opts, errReply := parseXReadArgs(args, true)
+	if errReply != nil {
+		return 0, errReply
+	}
+	return opts.block, nil
+}
+
+func makeXReadResult(key string, entries godis.Reply) godis.Reply {
+	return protocol.MakeMultiRawReply([]godis.Reply{
+		protocol.MakeBulkReply([]byte(key)),
+		entries,
+	})
+}
+
+// tryXRead
+//
+//	@Description: XREAD [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+//	$ 会被替换为当前的最后一个 ID, 阻塞期间新增的 entry 在唤醒后可以被读取
+//	@param db
+//	@param args
+//	@return godis.Reply
+//	@return bool
+func tryXRead(db *DB, args [][]byte) (godis.Reply, bool) {
+	opts, errReply := parseXReadArgs(args, false)
+	if errReply != nil {
+		return errReply, true
+	}
+	var result []godis.Reply
+	for i, key := range opts.keys {
+		stream, errReply := db.getAsStream(key)
+		if errReply != nil {
+			return errReply, true
+		}
+		if string(args[opts.idIndex+i]) == "$" {
+			lastID := Stream.MinID
+			if stream != nil {
+				lastID = stream.LastID()
+			}
+			args[opts.idIndex+i] = []byte(lastID.String())
+			continue
+		}
+		id, errReply := parseStreamID(args[opts.idIndex+i])
+		if errReply != nil {
+			return errReply, true
+		}
+		start, ok := id.Next()
+		if stream == nil || !ok {
+			continue
+		}
+		entries := stream.Range(start, Stream.MaxID, opts.count, false)
+		if len(entries) > 0 {
+			result = append(result, makeXReadResult(key, streamEntriesToReply(entries)))
+		}
+	}
+	if len(result) == 0 {
+		return nil, false
+	}
+	return protocol.MakeMultiRawReply(result), true
+}
+
+// tryXReadGroup
+//
+//	@Description: XREADGROUP GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+//	id 为 > 时读取未投递过的 entry 并加入 PEL, 否则读取 consumer 在 PEL 中的历史 entry
+//	@param db
+//	@param args
+//	@return godis.Reply
+//	@return bool
+func tryXReadGroup(db *DB, args [][]byte) (godis.Reply, bool) {
+	opts, errReply := parseXReadArgs(args, true)
+	if errReply != nil {
+		return errReply, true
+	}
+	now := time.Now()
+	served := false
+	var result []godis.Reply
+	for i, key := range opts.keys {
+		stream, group, errReply := db.getStreamGroup(key, opts.group)
+		if errReply != nil {
+			return errReply, true
+		}
+		idArg := args[opts.idIndex+i]
+		var id Stream.ID
+		if string(idArg) != ">" {
+			if id, errReply = parseStreamID(idArg); errReply != nil {
+				return errReply, true
+			}
+		}
+		consumer, created := group.CreateConsumer(opts.consumer, now)
+		consumer.SeenTime = now
+		if created {
+			db.addAof(utils.ToCmdLine("xgroup", "createconsumer", key, opts.group, opts.consumer))
+			db.notifyKeyspaceEvent(notifyStream, "xgroup-createconsumer", key)
+		}
+
+		if string(idArg) != ">" {
+			// history of consumer never blocks
+			served = true
+			replies := make([]godis.Reply, 0)
+			if start, ok := id.Next(); ok {
+				for _, pending := range group.PendingRange(start, Stream.MaxID, opts.count, consumer) {
+					if entry := stream.Get(pending.ID); entry != nil {
+						replies = append(replies, streamEntryToReply(entry))
+					} else {
+						replies = append(replies, protocol.MakeMultiRawReply([]godis.Reply{
+							protocol.MakeBulkReply([]byte(pending.ID.String())),
+							protocol.MakeNullMultiBulkReply(),
+						}))
+					}
+				}
+			}
+			result = append(result, makeXReadResult(key, protocol.MakeMultiRawReply(replies)))
+			continue
+		}
+		start, ok := group.LastID.Next()
+		if !ok {
+			continue
+		}
+		entries := stream.Range(start, Stream.MaxID, opts.count, false)
+		if len(entries) == 0 {
+			continue
+		}
+		served = true
+		group.LastID = entries[len(entries)-1].ID
+		if !opts.noAck {
+			for _, entry := range entries {
+				pending := group.Deliver(entry.ID, consumer, now)
+				db.addAof(aof.MakeXClaimCmd(key, opts.group, pending).Args)
+			}
+		}
+		db.addAof(utils.ToCmdLine("xgroup", "setid", key, opts.group, group.LastID.String()))
+		result = append(result, makeXReadResult(key, streamEntriesToReply(entries)))
+	}
+	if !served {
+		return nil, false
+	}
+	return protocol.MakeMultiRawReply(result), true
+}
@@ -0,0 +1,319 @@
+package database
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/10
+  @desc: stream commands
+  @modified by:
+**/
+
+import (
+	"github.com/Allen9012/Godis/aof"
+	"github.com/Allen9012/Godis/godis/connection"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/godis/protocol/asserts"
+	"github.com/Allen9012/Godis/interface/godis"
+	"github.com/Allen9012/Godis/lib/utils"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// assertEntryIDs asserts reply is a list of stream entries with the given IDs
+func assertEntryIDs(t *testing.T, actual godis.Reply, expected ...string) {
+	t.Helper()
+	reply, ok := actual.(*protocol.MultiRawReply)
+	if !ok {
+		t.Fatalf("expected multi raw reply, actually %s", actual.ToBytes())
+	}
+	if len(reply.Replies) != len(expected) {
+		t.Fatalf("expected %d entries, actually %s", len(expected), actual.ToBytes())
+	}
+	for i, entry := range reply.Replies {
+		id := entry.(*protocol.MultiRawReply).Replies[0].(*protocol.BulkReply).Arg
+		if string(id) != expected[i] {
+			t.Errorf("expected %s, actually %s", expected[i], id)
+		}
+	}
+}
+
+func TestXAdd(t *testing.T) {
+	testDB.Flush()
+	key := utils.RandString(10)
+	result := testDB.Exec(nil, utils.ToCmdLine("xadd", key, "*", "f", "v"))
+	first := string(result.(*protocol.BulkReply).Arg)
+	result = testDB.Exec(nil, utils.ToCmdLine("xadd", key, "*", "f", "v"))
+	second := string(result.(*protocol.BulkReply).Arg)
+	if second <= first && len(second) <= len(first) {
+		t.Errorf("expect increasing id, %s %s", first, second)
+	}
+	result = testDB.Exec(nil, utils.ToCmdLine("xadd", key, "1-1", "f", "v"))
+	asserts.AssertErrReply(t, result, "ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	result = testDB.Exec(nil, utils.ToCmdLine("type", key))
+	asserts.AssertStatusReply(t, result, "stream")
+
+	key = utils.RandString(10)
+	result = testDB.Exec(nil, utils.ToCmdLine("xadd", key, "0-0", "f", "v"))
+	asserts.AssertErrReply(t, result, "ERR The ID specified in XADD must be greater than 0-0")
+	result = testDB.Exec(nil, utils.ToCmdLine("xadd", key, "NOMKSTREAM", "1-1", "f", "v"))
+	asserts.AssertNullBulk(t, result)
+	result = testDB.Exec(nil, utils.ToCmdLine("xadd", key, "1-1", "f"))
+	asserts.AssertErrReply(t, result, "ERR wrong number of arguments for 'xadd' command")
+	result = testDB.Exec(nil, utils.ToCmdLine("xadd", key, "5-*", "f", "v"))
+	asserts.AssertBulkReply(t, result, "5-0")
+	result = testDB.Exec(nil, utils.ToCmdLine("xadd", key, "5-*", "f", "v"))
+	asserts.AssertBulkReply(t, result, "5-1")
+	result = testDB.Exec(nil, utils.ToCmdLine("xadd", key, "5", "f", "v"))
+	asserts.AssertErrReply(t, result, "ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	for i := 6; i <= 10; i++ {
+		testDB.Exec(nil, utils.ToCmdLine("xadd", key, "MAXLEN", "3", strconv.Itoa(i), "f", "v"))
+	}
+	result = testDB.Exec(nil, utils.ToCmdLine("xlen", key))
+	asserts.AssertIntReply(t, result, 3)
+	result = testDB.Exec(nil, utils.ToCmdLine("xadd", key, "MINID", "10", "11", "f", "v"))
+	asserts.AssertBulkReply(t, result, "11-0")
+	result = testDB.Exec(nil, utils.ToCmdLine("xrange", key, "-", "+"))
+	assertEntryIDs(t, result, "10-0", "11-0")
+	result = testDB.Exec(nil, utils.ToCmdLine("xadd", key, "MAXLEN", "1", "LIMIT", "10", "12", "f", "v"))
+	asserts.AssertErrReply(t, result, "ERR syntax error, LIMIT cannot be used without the special ~ option")
+
+	testDB.Exec(nil, utils.ToCmdLine("set", "str", "v"))
+	result = testDB.Exec(nil, utils.ToCmdLine("xadd", "str", "*", "f", "v"))
+	asserts.AssertErrReply(t, result, "WRONGTYPE Operation against a key holding the wrong kind of value")
+}
+
+func TestXRange(t *testing.T) {
+	testDB.Flush()
+	key := utils.RandString(10)
+	for i := 1; i <= 5; i++ {
+		testDB.Exec(nil, utils.ToCmdLine("xadd", key, strconv.Itoa(i)+"-1", "f", strconv.Itoa(i)))
+	}
+	result := testDB.Exec(nil, utils.ToCmdLine("xrange", key, "-", "+"))
+	assertEntryIDs(t, result, "1-1", "2-1", "3-1", "4-1", "5-1")
+	result = testDB.Exec(nil, utils.ToCmdLine("xrange", key, "2", "4"))
+	assertEntryIDs(t, result, "2-1", "3-1", "4-1")
+	result = testDB.Exec(nil, utils.ToCmdLine("xrange", key, "(2-1", "+", "COUNT", "2"))
+	assertEntryIDs(t, result, "3-1", "4-1")
+	result = testDB.Exec(nil, utils.ToCmdLine("xrevrange", key, "+", "-", "COUNT", "2"))
+	assertEntryIDs(t, result, "5-1", "4-1")
+	result = testDB.Exec(nil, utils.ToCmdLine("xrevrange", key, "(5-1", "(2-1"))
+	assertEntryIDs(t, result, "4-1", "3-1")
+	result = testDB.Exec(nil, utils.ToCmdLine("xrange", key, "-", "+", "COUNT", "0"))
+	asserts.AssertMultiBulkReplySize(t, result, 0)
+	result = testDB.Exec(nil, utils.ToCmdLine("xrange", key, "a", "+"))
+	asserts.AssertErrReply(t, result, "ERR Invalid stream ID specified as stream command argument")
+	result = testDB.Exec(nil, utils.ToCmdLine("xrange", key, "-", "+", "LIMIT"))
+	asserts.AssertErrReply(t, result, "Err syntax error")
+
+	entry := testDB.Exec(nil, utils.ToCmdLine("xrange", key, "3-1", "3-1")).(*protocol.MultiRawReply).Replies[0]
+	asserts.AssertMultiBulkReply(t, entry.(*protocol.MultiRawReply).Replies[1], []string{"f", "3"})
+}
+
+func TestXDelAndXTrim(t *testing.T) {
+	testDB.Flush()
+	key := utils.RandString(10)
+	for i := 1; i <= 10; i++ {
+		testDB.Exec(nil, utils.ToCmdLine("xadd", key, strconv.Itoa(i), "f", "v"))
+	}
+	result := testDB.Exec(nil, utils.ToCmdLine("xdel", key, "2", "3", "100"))
+	asserts.AssertIntReply(t, result, 2)
+	result = testDB.Exec(nil, utils.ToCmdLine("xtrim", key, "MAXLEN", "=", "6"))
+	asserts.AssertIntReply(t, result, 2)
+	result = testDB.Exec(nil, utils.ToCmdLine("xrange", key, "-", "+", "COUNT", "1"))
+	assertEntryIDs(t, result, "5-0")
+	result = testDB.Exec(nil, utils.ToCmdLine("xtrim", key, "MINID", "8"))
+	asserts.AssertIntReply(t, result, 3)
+	result = testDB.Exec(nil, utils.ToCmdLine("xtrim", key, "MAXLEN", "-1"))
+	asserts.AssertErrReply(t, result, "ERR The MAXLEN argument must be >= 0.")
+
+	// empty stream is kept
+	result = testDB.Exec(nil, utils.ToCmdLine("xtrim", key, "MAXLEN", "0"))
+	asserts.AssertIntReply(t, result, 3)
+	result = testDB.Exec(nil, utils.ToCmdLine("xlen", key))
+	asserts.AssertIntReply(t, result, 0)
+	result = testDB.Exec(nil, utils.ToCmdLine("xadd", key, "10", "f", "v"))
+	asserts.AssertErrReply(t, result, "ERR The ID specified in XADD is equal or smaller than the target stream top item")
+
+	result = testDB.Exec(nil, utils.ToCmdLine("xsetid", key, "5"))
+	asserts.AssertStatusReply(t, result, "OK")
+	result = testDB.Exec(nil, utils.ToCmdLine("xadd", key, "6", "f", "v"))
+	asserts.AssertBulkReply(t, result, "6-0")
+	result = testDB.Exec(nil, utils.ToCmdLine("xsetid", key, "5"))
+	asserts.AssertErrReply(t, result, "ERR The ID specified in XSETID is smaller than the target stream top item")
+}
+
+func TestXReadGroup(t *testing.T) {
+	testDB.Flush()
+	key := utils.RandString(10)
+	result := testDB.Exec(nil, utils.ToCmdLine("xgroup", "create", key, "g", "$"))
+	asserts.AssertErrReply(t, result, "ERR The XGROUP subcommand requires the key to exist. "+
+		"Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+	result = testDB.Exec(nil, utils.ToCmdLine("xgroup", "create", key, "g", "$", "MKSTREAM"))
+	asserts.AssertStatusReply(t, result, "OK")
+	result = testDB.Exec(nil, utils.ToCmdLine("xgroup", "create", key, "g", "$"))
+	asserts.AssertErrReply(t, result, "BUSYGROUP Consumer Group name already exists")
+	for i := 1; i <= 5; i++ {
+		testDB.Exec(nil, utils.ToCmdLine("xadd", key, strconv.Itoa(i), "f", "v"))
+	}
+
+	result = testDB.Exec(nil, utils.ToCmdLine("xreadgroup", "GROUP", "g", "alice", "COUNT", "3", "STREAMS", key, ">"))
+	assertEntryIDs(t, result.(*protocol.MultiRawReply).Replies[0].(*protocol.MultiRawReply).Replies[1], "1-0", "2-0", "3-0")
+	result = testDB.Exec(nil, utils.ToCmdLine("xreadgroup", "GROUP", "g", "bob", "STREAMS", key, ">"))
+	assertEntryIDs(t, result.(*protocol.MultiRawReply).Replies[0].(*protocol.MultiRawReply).Replies[1], "4-0", "5-0")
+	result = testDB.Exec(nil, utils.ToCmdLine("xreadgroup", "GROUP", "g", "bob", "STREAMS", key, ">"))
+	if _, ok := result.(*protocol.NullMultiBulkReply); !ok {
+		t.Errorf("expect null reply, actually %s", result.ToBytes())
+	}
+	// history of alice
+	result = testDB.Exec(nil, utils.ToCmdLine("xreadgroup", "GROUP", "g", "alice", "STREAMS", key, "1"))
+	assertEntryIDs(t, result.(*protocol.MultiRawReply).Replies[0].(*protocol.MultiRawReply).Replies[1], "2-0", "3-0")
+
+	result = testDB.Exec(nil, utils.ToCmdLine("xack", key, "g", "1", "2", "100"))
+	asserts.AssertIntReply(t, result, 2)
+	result = testDB.Exec(nil, utils.ToCmdLine("xpending", key, "g"))
+	expected := protocol.MakeMultiRawReply([]godis.Reply{
+		protocol.MakeIntReply(3),
+		protocol.MakeBulkReply([]byte("3-0")),
+		protocol.MakeBulkReply([]byte("5-0")),
+		protocol.MakeMultiRawReply([]godis.Reply{
+			protocol.MakeMultiBulkReply(utils.ToCmdLine("alice", "1")),
+			protocol.MakeMultiBulkReply(utils.ToCmdLine("bob", "2")),
+		}),
+	})
+	if string(result.ToBytes()) != string(expected.ToBytes()) {
+		t.Errorf("wrong xpending summary %s", result.ToBytes())
+	}
+	result = testDB.Exec(nil, utils.ToCmdLine("xpending", key, "g", "-", "+", "10", "bob"))
+	if size := len(result.(*protocol.MultiRawReply).Replies); size != 2 {
+		t.Errorf("expect 2 pending entries, actually %d", size)
+	}
+	result = testDB.Exec(nil, utils.ToCmdLine("xpending", key, "g", "IDLE", "100000", "-", "+", "10"))
+	asserts.AssertMultiBulkReplySize(t, result, 0)
+
+	result = testDB.Exec(nil, utils.ToCmdLine("xgroup", "delconsumer", key, "g", "bob"))
+	asserts.AssertIntReply(t, result, 2)
+	result = testDB.Exec(nil, utils.ToCmdLine("xreadgroup", "GROUP", "nogroup", "bob", "STREAMS", key, ">"))
+	asserts.AssertErrReply(t, result, "NOGROUP No such key '"+key+"' or consumer group 'nogroup'")
+	result = testDB.Exec(nil, utils.ToCmdLine("xgroup", "destroy", key, "g"))
+	asserts.AssertIntReply(t, result, 1)
+	result = testDB.Exec(nil, utils.ToCmdLine("xgroup", "destroy", key, "g"))
+	asserts.AssertIntReply(t, result, 0)
+}
+
+func TestXClaim(t *testing.T) {
+	testDB.Flush()
+	key := utils.RandString(10)
+	for i := 1; i <= 5; i++ {
+		testDB.Exec(nil, utils.ToCmdLine("xadd", key, strconv.Itoa(i), "f", "v"))
+	}
+	testDB.Exec(nil, utils.ToCmdLine("xgroup", "create", key, "g", "0"))
+	testDB.Exec(nil, utils.ToCmdLine("xreadgroup", "GROUP", "g", "alice", "STREAMS", key, ">"))
+
+	result := testDB.Exec(nil, utils.ToCmdLine("xclaim", key, "g", "bob", "100000", "1", "2"))
+	asserts.AssertMultiBulkReplySize(t, result, 0)
+	result = testDB.Exec(nil, utils.ToCmdLine("xclaim", key, "g", "bob", "0", "1", "2", "RETRYCOUNT", "5"))
+	assertEntryIDs(t, result, "1-0", "2-0")
+	result = testDB.Exec(nil, utils.ToCmdLine("xpending", key, "g", "-", "+", "1"))
+	pending := result.(*protocol.MultiRawReply).Replies[0].(*protocol.MultiRawReply)
+	asserts.AssertBulkReply(t, pending.Replies[1], "bob")
+	asserts.AssertIntReply(t, pending.Replies[3], 5)
+
+	// deleted entry is removed from PEL
+	testDB.Exec(nil, utils.ToCmdLine("xdel", key, "4"))
+	result = testDB.Exec(nil, utils.ToCmdLine("xautoclaim", key, "g", "carol", "0", "-", "COUNT", "2", "JUSTID"))
+	asserts.AssertBulkReply(t, result.(*protocol.MultiRawReply).Replies[0], "3-0")
+	asserts.AssertMultiBulkReply(t, result.(*protocol.MultiRawReply).Replies[1], []string{"1-0", "2-0"})
+	result = testDB.Exec(nil, utils.ToCmdLine("xautoclaim", key, "g", "carol", "0", "3"))
+	asserts.AssertBulkReply(t, result.(*protocol.MultiRawReply).Replies[0], "0-0")
+	assertEntryIDs(t, result.(*protocol.MultiRawReply).Replies[1], "3-0", "5-0")
+	asserts.AssertMultiBulkReply(t, result.(*protocol.MultiRawReply).Replies[2], []string{"4-0"})
+	result = testDB.Exec(nil, utils.ToCmdLine("xpending", key, "g", "-", "+", "10", "carol"))
+	if size := len(result.(*protocol.MultiRawReply).Replies); size != 4 {
+		t.Errorf("expect 4 pending entries, actually %d", size)
+	}
+}
+
+func TestXReadBlock(t *testing.T) {
+	server := NewStandaloneServer()
+	defer server.Close()
+	db := server.mustSelectDB(0)
+	conn := connection.NewFakeConn()
+	key := utils.RandString(10)
+
+	result := server.Exec(conn, utils.ToCmdLine("xread", "STREAMS", key, "0"))
+	if _, ok := result.(*protocol.NullMultiBulkReply); !ok {
+		t.Errorf("expect null reply, actually %s", result.ToBytes())
+	}
+	server.Exec(conn, utils.ToCmdLine("xadd", key, "1", "f", "v"))
+	result = server.Exec(conn, utils.ToCmdLine("xread", "COUNT", "1", "STREAMS", key, "0"))
+	assertEntryIDs(t, result.(*protocol.MultiRawReply).Replies[0].(*protocol.MultiRawReply).Replies[1], "1-0")
+
+	ch := execAsync(server, connection.NewFakeConn(), "xread", "BLOCK", "0", "STREAMS", key, "$")
+	ch2 := execAsync(server, connection.NewFakeConn(), "xread", "BLOCK", "0", "STREAMS", key, "$")
+	waitBlocked(t, db, key, 2)
+	server.Exec(conn, utils.ToCmdLine("xadd", key, "2", "f", "v"))
+	assertEntryIDs(t, receiveReply(t, ch).(*protocol.MultiRawReply).Replies[0].(*protocol.MultiRawReply).Replies[1], "2-0")
+	assertEntryIDs(t, receiveReply(t, ch2).(*protocol.MultiRawReply).Replies[0].(*protocol.MultiRawReply).Replies[1], "2-0")
+
+	server.Exec(conn, utils.ToCmdLine("xgroup", "create", key, "g", "$"))
+	ch = execAsync(server, connection.NewFakeConn(), "xreadgroup", "GROUP", "g", "alice", "BLOCK", "0", "STREAMS", key, ">")
+	waitBlocked(t, db, key, 1)
+	server.Exec(conn, utils.ToCmdLine("xadd", key, "3", "f", "v"))
+	assertEntryIDs(t, receiveReply(t, ch).(*protocol.MultiRawReply).Replies[0].(*protocol.MultiRawReply).Replies[1], "3-0")
+
+	start := time.Now()
+	result = server.Exec(conn, utils.ToCmdLine("xread", "BLOCK", "100", "STREAMS", key, "$"))
+	if _, ok := result.(*protocol.NullMultiBulkReply); !ok {
+		t.Errorf("expect null reply, actually %s", result.ToBytes())
+	}
+	// BLOCK is in milliseconds, it should not be rounded to seconds
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > 500*time.Millisecond {
+		t.Errorf("expect xread returning after 100ms, actually %s", elapsed)
+	}
+}
+
+func TestStreamToCmds(t *testing.T) {
+	testDB.Flush()
+	key := utils.RandString(10)
+	for i := 1; i <= 5; i++ {
+		testDB.Exec(nil, utils.ToCmdLine("xadd", key, strconv.Itoa(i), "f", strconv.Itoa(i)))
+	}
+	testDB.Exec(nil, utils.ToCmdLine("xdel", key, "5"))
+	testDB.Exec(nil, utils.ToCmdLine("xgroup", "create", key, "g", "0"))
+	testDB.Exec(nil, utils.ToCmdLine("xreadgroup", "GROUP", "g", "alice", "COUNT", "2", "STREAMS", key, ">"))
+	testDB.Exec(nil, utils.ToCmdLine("xgroup", "createconsumer", key, "g", "bob"))
+	entity, _ := testDB.GetEntity(key)
+	cmds := aof.EntityToCmds(key, entity)
+
+	expectedRange := testDB.Exec(nil, utils.ToCmdLine("xrange", key, "-", "+")).ToBytes()
+	expectedPending := testDB.Exec(nil, utils.ToCmdLine("xpending", key, "g")).ToBytes()
+	testDB.Flush()
+	for _, cmd := range cmds {
+		asserts.AssertNotError(t, testDB.Exec(nil, cmd.Args))
+	}
+	if result := testDB.Exec(nil, utils.ToCmdLine("xrange", key, "-", "+")); string(result.ToBytes()) != string(expectedRange) {
+		t.Errorf("wrong entries %s", result.ToBytes())
+	}
+	if result := testDB.Exec(nil, utils.ToCmdLine("xpending", key, "g")); string(result.ToBytes()) != string(expectedPending) {
+		t.Errorf("wrong pending entries %s", result.ToBytes())
+	}
+	result := testDB.Exec(nil, utils.ToCmdLine("xadd", key, "5", "f", "v"))
+	asserts.AssertErrReply(t, result, "ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	result = testDB.Exec(nil, utils.ToCmdLine("xreadgroup", "GROUP", "g", "bob", "STREAMS", key, ">"))
+	assertEntryIDs(t, result.(*protocol.MultiRawReply).Replies[0].(*protocol.MultiRawReply).Replies[1], "3-0", "4-0")
+
+	// empty stream without entry
+	key = utils.RandString(10)
+	testDB.Exec(nil, utils.ToCmdLine("xgroup", "create", key, "g", "$", "MKSTREAM"))
+	entity, _ = testDB.GetEntity(key)
+	cmds = aof.EntityToCmds(key, entity)
+	testDB.Remove(key)
+	for _, cmd := range cmds {
+		asserts.AssertNotError(t, testDB.Exec(nil, cmd.Args))
+	}
+	result = testDB.Exec(nil, utils.ToCmdLine("xlen", key))
+	asserts.AssertIntReply(t, result, 0)
+	result = testDB.Exec(nil, utils.ToCmdLine("xadd", key, "0-1", "f", "v"))
+	asserts.AssertBulkReply(t, result, "0-1")
+}
@@ -37,34 +37,34 @@ const (
 // SETEX
 func init() {
 	// GET key
-	registerCommand("Get", execGet, 2, flagReadOnly)
+	registerCommand("Get", execGet, readFirstKey, nil, 2, flagReadOnly)
 	// SET key value (只实现最简单的模式)
-	registerCommand("Set", execSet, -3, flagWrite)
+	registerCommand("Set", execSet, writeFirstKey, rollbackFirstKey, -3, flagWrite)
 	// SETNX key value
-	registerCommand("SetNx", execSetNX, 3, flagWrite)
+	registerCommand("SetNx", execSetNX, writeFirstKey, rollbackFirstKey, 3, flagWrite)
 	// GETSET key value
-	registerCommand("GetSet", execGetSet, 3, flagWrite)
+	registerCommand("GetSet", execGetSet, writeFirstKey, rollbackFirstKey, 3, flagWrite)
 	// STRLEN key
-	registerCommand("StrLen", execStrLen, 2, flagReadOnly)
+	registerCommand("StrLen", execStrLen, readFirstKey, nil, 2, flagReadOnly)
 	// GETEX key +
-	registerCommand("GetEx", execGetEX, -2, flagReadOnly)
+	registerCommand("GetEx", execGetEX, writeFirstKey, rollbackFirstKey, -2, flagWrite)
 	// SETEX key seconds value
-	registerCommand("SetEx", execSetEX, 4, flagWrite)
+	registerCommand("SetEx", execSetEX, writeFirstKey, rollbackFirstKey, 4, flagWrite)
 
-	registerCommand("GetDel", execGetDel, 2, flagWrite)
+	registerCommand("GetDel", execGetDel, writeFirstKey, rollbackFirstKey, 2, flagWrite)
 	// INCR associated
-	registerCommand("Incr", execIncr, 2, flagWrite)
-	registerCommand("IncrBy", execIncrBy, 3, flagWrite)
-	registerCommand("IncrByFloat", execIncrByFloat, 3, flagWrite)
-	registerCommand("Decr", execDecr, 2, flagWrite)
-	registerCommand("DecrBy", execDecrBy, 3, flagWrite)
+	registerCommand("Incr", execIncr, writeFirstKey, rollbackFirstKey, 2, flagWrite)
+	registerCommand("IncrBy", execIncrBy, writeFirstKey, rollbackFirstKey, 3, flagWrite)
+	registerCommand("IncrByFloat", execIncrByFloat, writeFirstKey, rollbackFirstKey, 3, flagWrite)
+	registerCommand("Decr", execDecr, writeFirstKey, rollbackFirstKey, 2, flagWrite)
+	registerCommand("DecrBy", execDecrBy, writeFirstKey, rollbackFirstKey, 3, flagWrite)
 	// APPEND key value
-	registerCommand("Append", execAppend, 3, flagWrite)
+	registerCommand("Append", execAppend, writeFirstKey, rollbackFirstKey, 3, flagWrite)
 	// BitMap
-	registerCommand("SetBit", execSetBit, 4, flagWrite)
-	registerCommand("GetBit", execGetBit, 3, flagReadOnly)
-	registerCommand("BitCount", execBitCount, -2, flagReadOnly)
-	registerCommand("BitPos", execBitPos, -3, flagWrite)
+	registerCommand("SetBit", execSetBit, writeFirstKey, rollbackFirstKey, 4, flagWrite)
+	registerCommand("GetBit", execGetBit, readFirstKey, nil, 3, flagReadOnly)
+	registerCommand("BitCount", execBitCount, readFirstKey, nil, -2, flagReadOnly)
+	registerCommand("BitPos", execBitPos, readFirstKey, nil, -3, flagReadOnly)
 }
 
 // getAsString
@@ -296,6 +296,7 @@ func execSetBit(db *DB, args [][]byte) godis.Reply {
 	bm.SetBit(offset, v)
 	db.PutEntity(key, &database.DataEntity{Data: bm.ToBytes()})
 	db.addAof(utils.ToCmdLine3("setBit", args...))
+	db.notifyKeyspaceEvent(notifyString, "setbit", key)
 	return protocol.MakeIntReply(int64(former))
 }
 
@@ -392,10 +393,12 @@ func execGetEX(db *DB, args [][]byte) godis.Reply {
 			expireTime := time.Now().Add(time.Duration(ttl) * time.Millisecond)
 			db.Expire(key, expireTime)
 			db.addAof(aof.MakeExpireCmd(key, expireTime).Args)
+			db.notifyKeyspaceEvent(notifyGeneric, "expire", key)
 		} else { // PERSIST
 			db.Persist(key) // override ttl
 			// we convert to persist command to write aof
 			db.addAof(utils.ToCmdLine3("persist", args[0]))
+			db.notifyKeyspaceEvent(notifyGeneric, "persist", key)
 		}
 	}
 	return protocol.MakeBulkReply(bytes)
@@ -493,6 +496,10 @@ func execSet(db *DB, args [][]byte) godis.Reply {
 			db.Persist(key) // override ttl
 			db.addAof(utils.ToCmdLine3("set", args...))
 		}
+		db.notifyKeyspaceEvent(notifyString, "set", key)
+		if ttl != unlimitedTTL {
+			db.notifyKeyspaceEvent(notifyGeneric, "expire", key)
+		}
 	}
 	if result > 0 {
 		return protocol.MakeOkReply()
@@ -515,6 +522,7 @@ func execGetDel(db *DB, args [][]byte) godis.Reply {
 
 	// We convert to del command to write aof
 	db.addAof(utils.ToCmdLine3("del", args...))
+	db.notifyKeyspaceEvent(notifyGeneric, "del", key)
 	return protocol.MakeBulkReply(old)
 }
 
@@ -528,6 +536,9 @@ func execSetNX(db *DB, args [][]byte) godis.Reply {
 	result := db.PutIfAbsent(key, entity)
 	//aof
 	db.addAof(utils.ToCmdLine3("setnx", args...))
+	if result > 0 {
+		db.notifyKeyspaceEvent(notifyString, "set", key)
+	}
 	return protocol.MakeIntReply(int64(result))
 }
 
@@ -557,6 +568,8 @@ func execSetEX(db *DB, args [][]byte) godis.Reply {
 	// aof操作
 	db.addAof(utils.ToCmdLine3("setex", args...))
 	db.addAof(aof.MakeExpireCmd(key, expireTime).Args)
+	db.notifyKeyspaceEvent(notifyString, "set", key)
+	db.notifyKeyspaceEvent(notifyGeneric, "expire", key)
 	return protocol.MakeOkReply()
 }
 
@@ -579,6 +592,7 @@ func execGetSet(db *DB, args [][]byte) godis.Reply {
 	db.Persist(key) // override ttl
 	//aof
 	db.addAof(utils.ToCmdLine3("set", args...))
+	db.notifyKeyspaceEvent(notifyString, "set", key)
 	if old == nil {
 		return protocol.MakeNullBulkReply()
 	}
@@ -618,12 +632,14 @@ func execIncr(db *DB, args [][]byte) godis.Reply {
 		db.PutEntity(key, &database.DataEntity{
 			Data: []byte(strconv.FormatInt(val+1, 10)),
 		})
+		db.notifyKeyspaceEvent(notifyString, "incrby", key)
 		return protocol.MakeIntReply(val + 1)
 	}
 	db.PutEntity(key, &database.DataEntity{
 		Data: []byte("1"),
 	})
 	db.addAof(utils.ToCmdLine3("incr", args...))
+	db.notifyKeyspaceEvent(notifyString, "incrby", key)
 	return protocol.MakeIntReply(1)
 }
 
@@ -654,12 +670,14 @@ func execIncrBy(db *DB, args [][]byte) godis.Reply {
 			Data: []byte(strconv.FormatInt(val+delta, 10)),
 		})
 		db.addAof(utils.ToCmdLine3("incrby", args...))
+		db.notifyKeyspaceEvent(notifyString, "incrby", key)
 		return protocol.MakeIntReply(val + delta)
 	}
 	db.PutEntity(key, &database.DataEntity{
 		Data: args[1],
 	})
 	db.addAof(utils.ToCmdLine3("incrby", args...))
+	db.notifyKeyspaceEvent(notifyString, "incrby", key)
 	return protocol.MakeIntReply(delta)
 }
 
@@ -691,12 +709,14 @@ func execIncrByFloat(db *DB, args [][]byte) godis.Reply {
 			Data: resultBytes,
 		})
 		db.addAof(utils.ToCmdLine3("incrbyfloat", args...))
+		db.notifyKeyspaceEvent(notifyString, "incrbyfloat", key)
 		return protocol.MakeBulkReply(resultBytes)
 	}
 	db.PutEntity(key, &database.DataEntity{
 		Data: args[1],
 	})
 	db.addAof(utils.ToCmdLine3("incrbyfloat", args...))
+	db.notifyKeyspaceEvent(notifyString, "incrbyfloat", key)
 	return protocol.MakeBulkReply(args[1])
 }
 
@@ -717,6 +737,7 @@ func execDecr(db *DB, args [][]byte) godis.Reply {
 			Data: []byte(strconv.FormatInt(val-1, 10)),
 		})
 		db.addAof(utils.ToCmdLine3("decr", args...))
+		db.notifyKeyspaceEvent(notifyString, "incrby", key)
 		return protocol.MakeIntReply(val - 1)
 	}
 	entity := &database.DataEntity{
@@ -724,6 +745,7 @@ func execDecr(db *DB, args [][]byte) godis.Reply {
 	}
 	db.PutEntity(key, entity)
 	db.addAof(utils.ToCmdLine3("decr", args...))
+	db.notifyKeyspaceEvent(notifyString, "incrby", key)
 	return protocol.MakeIntReply(-1)
 }
 
@@ -749,6 +771,7 @@ func execDecrBy(db *DB, args [][]byte) godis.Reply {
 			Data: []byte(strconv.FormatInt(val-delta, 10)),
 		})
 		db.addAof(utils.ToCmdLine3("decrby", args...))
+		db.notifyKeyspaceEvent(notifyString, "incrby", key)
 		return protocol.MakeIntReply(val - delta)
 	}
 	valueStr := strconv.FormatInt(-delta, 10)
@@ -756,6 +779,7 @@ func execDecrBy(db *DB, args [][]byte) godis.Reply {
 		Data: []byte(valueStr),
 	})
 	db.addAof(utils.ToCmdLine3("decrby", args...))
+	db.notifyKeyspaceEvent(notifyString, "incrby", key)
 	return protocol.MakeIntReply(-delta)
 }
 
@@ -774,5 +798,6 @@ func execAppend(db *DB, args [][]byte) godis.Reply {
 	bytes = append(bytes, args[1]...)
 	db.PutEntity(key, &database.DataEntity{Data: bytes})
 	db.addAof(utils.ToCmdLine3("append", args...))
+	db.notifyKeyspaceEvent(notifyString, "append", key)
 	return protocol.MakeIntReply(int64(len(bytes)))
 }
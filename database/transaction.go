@@ -1,15 +1,190 @@
 package database
 
-import "strings"
+import (
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/interface/godis"
+	"strings"
+)
 
 /**
   Copyright © 2023 github.com/Allen9012 All rights reserved.
   @author: Allen
   @since: 2023/9/23
-  @desc:
+  @desc: multi/exec/discard/watch
   @modified by:
 **/
 
+// Watch set watching keys
+//
+//	@Description: WATCH key [key ...]
+//	@param db
+//	@param conn
+//	@param args
+//	@return godis.Reply
+func Watch(db *DB, conn godis.Connection, args [][]byte) godis.Reply {
+	if conn.InMultiState() {
+		return protocol.MakeErrReply("ERR WATCH inside MULTI is not allowed")
+	}
+	watching := conn.GetWatching()
+	for _, bkey := range args {
+		key := string(bkey)
+		watching[key] = db.GetVersion(key)
+	}
+	return protocol.MakeOkReply()
+}
+
+// UnWatch flushes all the previously watched keys
+//
+//	@Description: UNWATCH
+//	@param conn
+//	@return godis.Reply
+func UnWatch(conn godis.Connection) godis.Reply {
+	conn.ClearWatching()
+	return protocol.MakeOkReply()
+}
+
+// invoker should lock watching keys
+func isWatchingChanged(db *DB, watching map[string]uint32) bool {
+	for key, ver := range watching {
+		currentVersion := db.GetVersion(key)
+		if ver != currentVersion {
+			return true
+		}
+	}
+	return false
+}
+
+// StartMulti starts multi-command-transaction
+//
+//	@Description: MULTI
+//	@param conn
+//	@return godis.Reply
+func StartMulti(conn godis.Connection) godis.Reply {
+	if conn.InMultiState() {
+		return protocol.MakeErrReply("ERR MULTI calls can not be nested")
+	}
+	conn.SetMultiState(true)
+	return protocol.MakeOkReply()
+}
+
+// EnqueueCmd puts command line into `multi` pending queue
+// 入队前先做语法检查，出错的命令会让整个事务在EXEC时放弃
+func EnqueueCmd(conn godis.Connection, cmdLine [][]byte) godis.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := cmdTable[cmdName]
+	if !ok {
+		err := protocol.MakeErrReply("ERR unknown command '" + cmdName + "'")
+		conn.AddTxError(err)
+		return err
+	}
+	if cmd.prepare == nil {
+		err := protocol.MakeErrReply("ERR command '" + cmdName + "' cannot be used in MULTI")
+		conn.AddTxError(err)
+		return err
+	}
+	if !validateArity(cmd.arity, cmdLine) {
+		err := protocol.MakeArgNumErrReply(cmdName)
+		conn.AddTxError(err)
+		return err
+	}
+	conn.EnqueueCmd(cmdLine)
+	return protocol.MakeQueuedReply()
+}
+
+// execMulti executes the queued commands of conn
+func execMulti(db *DB, conn godis.Connection) godis.Reply {
+	if !conn.InMultiState() {
+		return protocol.MakeErrReply("ERR EXEC without MULTI")
+	}
+	defer conn.SetMultiState(false)
+	if len(conn.GetTxErrors()) > 0 {
+		return protocol.MakeErrReply("EXECABORT Transaction discarded because of previous errors.")
+	}
+	cmdLines := conn.GetQueuedCmdLine()
+	return db.ExecMulti(conn, conn.GetWatching(), cmdLines)
+}
+
+// ExecMulti executes multi commands transaction Atomically and Isolated
+//
+//	@Description:
+//	@receiver db
+//	@param conn
+//	@param watching key -> version when WATCH was called
+//	@param cmdLines
+//	@return godis.Reply
+//	1. 收集所有命令的读写key，连同watching key一起加锁
+//	2. watching key被修改过则放弃执行
+//	3. 依次执行，执行前记录undo log，出错时倒序回滚
+func (db *DB) ExecMulti(conn godis.Connection, watching map[string]uint32, cmdLines []CmdLine) godis.Reply {
+	// prepare
+	writeKeys := make([]string, 0) // may contains duplicate
+	readKeys := make([]string, 0)
+	for _, cmdLine := range cmdLines {
+		cmdName := strings.ToLower(string(cmdLine[0]))
+		cmd := cmdTable[cmdName]
+		prepare := cmd.prepare
+		write, read := prepare(cmdLine[1:])
+		writeKeys = append(writeKeys, write...)
+		readKeys = append(readKeys, read...)
+	}
+	// set watch
+	watchingKeys := make([]string, 0, len(watching))
+	for key := range watching {
+		watchingKeys = append(watchingKeys, key)
+	}
+	readKeys = append(readKeys, watchingKeys...)
+	db.RWLocks(writeKeys, readKeys)
+	defer db.RWUnLocks(writeKeys, readKeys)
+
+	if isWatchingChanged(db, watching) { // watching keys changed, abort
+		return protocol.MakeNullMultiBulkReply()
+	}
+	// execute
+	results := make([]godis.Reply, 0, len(cmdLines))
+	aborted := false
+	undoCmdLines := make([][]CmdLine, 0, len(cmdLines))
+	for _, cmdLine := range cmdLines {
+		undoCmdLines = append(undoCmdLines, db.GetUndoLogs(cmdLine))
+		result := db.execWithLock(cmdLine)
+		if protocol.IsErrorReply(result) {
+			aborted = true
+			// don't rollback failed commands
+			undoCmdLines = undoCmdLines[:len(undoCmdLines)-1]
+			break
+		}
+		results = append(results, result)
+	}
+	if !aborted { //success
+		db.addVersion(writeKeys...)
+		return protocol.MakeMultiRawReply(results)
+	}
+	// undo if aborted
+	size := len(undoCmdLines)
+	for i := size - 1; i >= 0; i-- {
+		curCmdLines := undoCmdLines[i]
+		if len(curCmdLines) == 0 {
+			continue
+		}
+		for _, cmdLine := range curCmdLines {
+			db.execWithLock(cmdLine)
+		}
+	}
+	return protocol.MakeErrReply("EXECABORT Transaction discarded because of previous errors.")
+}
+
+// DiscardMulti drops MULTI pending commands
+//
+//	@Description: DISCARD
+//	@param conn
+//	@return godis.Reply
+func DiscardMulti(conn godis.Connection) godis.Reply {
+	if !conn.InMultiState() {
+		return protocol.MakeErrReply("ERR DISCARD without MULTI")
+	}
+	conn.SetMultiState(false)
+	return protocol.MakeOkReply()
+}
+
 // GetUndoLogs return rollback commands
 func (db *DB) GetUndoLogs(cmdLine [][]byte) []CmdLine {
 	cmdName := strings.ToLower(string(cmdLine[0]))
@@ -24,11 +199,11 @@ func (db *DB) GetUndoLogs(cmdLine [][]byte) []CmdLine {
 	return undo(db, cmdLine[1:])
 }
 
-// GetRelatedKeys analysis related keys
+// GetRelatedKeys analysis related keys, returns nil if command is unknown or has wrong number of arguments
 func GetRelatedKeys(cmdLine [][]byte) ([]string, []string) {
 	cmdName := strings.ToLower(string(cmdLine[0]))
 	cmd, ok := cmdTable[cmdName]
-	if !ok {
+	if !ok || !validateArity(cmd.arity, cmdLine) {
 		return nil, nil
 	}
 	prepare := cmd.prepare
@@ -0,0 +1,178 @@
+package database
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/9/24
+  @desc: multi/exec/discard/watch
+  @modified by:
+**/
+
+import (
+	"github.com/Allen9012/Godis/config"
+	"github.com/Allen9012/Godis/godis/connection"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/godis/protocol/asserts"
+	"github.com/Allen9012/Godis/lib/utils"
+	"testing"
+)
+
+func TestMulti(t *testing.T) {
+	testDB.Flush()
+	conn := connection.NewFakeConn()
+	result := testDB.Exec(conn, utils.ToCmdLine("multi"))
+	asserts.AssertNotError(t, result)
+	key := utils.RandString(10)
+	value := utils.RandString(10)
+	result = testDB.Exec(conn, utils.ToCmdLine("set", key, value))
+	asserts.AssertStatusReply(t, result, "QUEUED")
+	key2 := utils.RandString(10)
+	result = testDB.Exec(conn, utils.ToCmdLine("rpush", key2, value))
+	asserts.AssertStatusReply(t, result, "QUEUED")
+	result = testDB.Exec(conn, utils.ToCmdLine("exec"))
+	asserts.AssertNotError(t, result)
+	if conn.InMultiState() {
+		t.Error("expect not in multi state")
+	}
+	result = testDB.Exec(conn, utils.ToCmdLine("get", key))
+	asserts.AssertBulkReply(t, result, value)
+	result = testDB.Exec(conn, utils.ToCmdLine("lrange", key2, "0", "-1"))
+	asserts.AssertMultiBulkReply(t, result, []string{value})
+}
+
+func TestSyntaxErrInMulti(t *testing.T) {
+	testDB.Flush()
+	conn := connection.NewFakeConn()
+	result := testDB.Exec(conn, utils.ToCmdLine("multi"))
+	asserts.AssertNotError(t, result)
+	key := utils.RandString(10)
+	value := utils.RandString(10)
+	result = testDB.Exec(conn, utils.ToCmdLine("set", key, value))
+	asserts.AssertStatusReply(t, result, "QUEUED")
+	result = testDB.Exec(conn, utils.ToCmdLine("get"))
+	asserts.AssertErrReply(t, result, "ERR wrong number of arguments for 'get' command")
+	result = testDB.Exec(conn, utils.ToCmdLine("exec"))
+	asserts.AssertErrReply(t, result, "EXECABORT Transaction discarded because of previous errors.")
+	result = testDB.Exec(conn, utils.ToCmdLine("get", key))
+	asserts.AssertNullBulk(t, result)
+}
+
+func TestRollback(t *testing.T) {
+	testDB.Flush()
+	conn := connection.NewFakeConn()
+	key := utils.RandString(10)
+	value := utils.RandString(10)
+	testDB.Exec(conn, utils.ToCmdLine("set", key, value))
+	key2 := utils.RandString(10)
+	testDB.Exec(conn, utils.ToCmdLine("rpush", key2, value))
+
+	result := testDB.Exec(conn, utils.ToCmdLine("multi"))
+	asserts.AssertNotError(t, result)
+	testDB.Exec(conn, utils.ToCmdLine("del", key))
+	testDB.Exec(conn, utils.ToCmdLine("rpush", key2, utils.RandString(10)))
+	testDB.Exec(conn, utils.ToCmdLine("incr", key2)) // wrong type, abort transaction
+	result = testDB.Exec(conn, utils.ToCmdLine("exec"))
+	if !protocol.IsErrorReply(result) {
+		t.Error("expect error reply")
+	}
+	result = testDB.Exec(conn, utils.ToCmdLine("get", key))
+	asserts.AssertBulkReply(t, result, value)
+	result = testDB.Exec(conn, utils.ToCmdLine("lrange", key2, "0", "-1"))
+	asserts.AssertMultiBulkReply(t, result, []string{value})
+}
+
+func TestDiscard(t *testing.T) {
+	testDB.Flush()
+	conn := connection.NewFakeConn()
+	result := testDB.Exec(conn, utils.ToCmdLine("discard"))
+	asserts.AssertErrReply(t, result, "ERR DISCARD without MULTI")
+	result = testDB.Exec(conn, utils.ToCmdLine("multi"))
+	asserts.AssertNotError(t, result)
+	key := utils.RandString(10)
+	value := utils.RandString(10)
+	testDB.Exec(conn, utils.ToCmdLine("set", key, value))
+	result = testDB.Exec(conn, utils.ToCmdLine("discard"))
+	asserts.AssertNotError(t, result)
+	result = testDB.Exec(conn, utils.ToCmdLine("get", key))
+	asserts.AssertNullBulk(t, result)
+}
+
+func TestWatch(t *testing.T) {
+	testDB.Flush()
+	conn := connection.NewFakeConn()
+	key := utils.RandString(10)
+	value := utils.RandString(10)
+	testDB.Exec(conn, utils.ToCmdLine("watch", key))
+	testDB.Exec(conn, utils.ToCmdLine("set", key, value)) // modified by others
+	testDB.Exec(conn, utils.ToCmdLine("multi"))
+	key2 := utils.RandString(10)
+	testDB.Exec(conn, utils.ToCmdLine("set", key2, value))
+	result := testDB.Exec(conn, utils.ToCmdLine("exec"))
+	if _, ok := result.(*protocol.NullMultiBulkReply); !ok {
+		t.Errorf("expect null multi bulk, actually %s", result.ToBytes())
+	}
+	result = testDB.Exec(conn, utils.ToCmdLine("get", key2))
+	asserts.AssertNullBulk(t, result)
+
+	// watching is cleared after exec
+	testDB.Exec(conn, utils.ToCmdLine("multi"))
+	testDB.Exec(conn, utils.ToCmdLine("set", key2, value))
+	result = testDB.Exec(conn, utils.ToCmdLine("exec"))
+	asserts.AssertNotError(t, result)
+	result = testDB.Exec(conn, utils.ToCmdLine("get", key2))
+	asserts.AssertBulkReply(t, result, value)
+}
+
+func TestUnWatch(t *testing.T) {
+	testDB.Flush()
+	conn := connection.NewFakeConn()
+	key := utils.RandString(10)
+	value := utils.RandString(10)
+	testDB.Exec(conn, utils.ToCmdLine("watch", key))
+	testDB.Exec(conn, utils.ToCmdLine("unwatch"))
+	testDB.Exec(conn, utils.ToCmdLine("set", key, value))
+	testDB.Exec(conn, utils.ToCmdLine("multi"))
+	testDB.Exec(conn, utils.ToCmdLine("get", key))
+	result := testDB.Exec(conn, utils.ToCmdLine("exec"))
+	asserts.AssertNotError(t, result)
+}
+
+func TestFlushDBInMulti(t *testing.T) {
+	testDB.Flush()
+	conn := connection.NewFakeConn()
+	key := utils.RandString(10)
+	testDB.Exec(conn, utils.ToCmdLine("multi"))
+	testDB.Exec(conn, utils.ToCmdLine("set", key, "v"))
+	result := testDB.Exec(conn, utils.ToCmdLine("flushdb"))
+	asserts.AssertStatusReply(t, result, "QUEUED")
+	// EXEC unlocks keys after FLUSHDB executed, it must not panic
+	result = testDB.Exec(conn, utils.ToCmdLine("exec"))
+	asserts.AssertNotError(t, result)
+	result = testDB.Exec(conn, utils.ToCmdLine("get", key))
+	asserts.AssertNullBulk(t, result)
+	result = testDB.Exec(conn, utils.ToCmdLine("set", key, "v"))
+	asserts.AssertStatusReply(t, result, "OK")
+}
+
+func TestServerCommandInMulti(t *testing.T) {
+	maxClients := config.Properties.MaxClients
+	defer func() {
+		config.Properties.MaxClients = maxClients
+	}()
+	conn := connection.NewFakeConn()
+	key := utils.RandString(10)
+	testServer.Exec(conn, utils.ToCmdLine("multi"))
+	result := testServer.Exec(conn, utils.ToCmdLine("set", key, "v"))
+	asserts.AssertStatusReply(t, result, "QUEUED")
+	result = testServer.Exec(conn, utils.ToCmdLine("publish", "ch", "msg"))
+	asserts.AssertErrReply(t, result, "ERR command publish cannot be used in MULTI")
+	result = testServer.Exec(conn, utils.ToCmdLine("config", "set", "maxclients", "1"))
+	asserts.AssertErrReply(t, result, "ERR command config cannot be used in MULTI")
+	result = testServer.Exec(conn, utils.ToCmdLine("exec"))
+	asserts.AssertErrReply(t, result, "EXECABORT Transaction discarded because of previous errors.")
+	result = testServer.Exec(conn, utils.ToCmdLine("get", key))
+	asserts.AssertNullBulk(t, result)
+	if config.Properties.MaxClients == 1 {
+		t.Error("config set should not be executed in multi")
+	}
+}
@@ -0,0 +1,143 @@
+package database
+
+import (
+	"github.com/Allen9012/Godis/aof"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/lib/utils"
+	"strconv"
+	"time"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/9/24
+  @desc: undo logs used to roll back a transaction
+  @modified by:
+**/
+
+// rollbackFirstKey restores args[0] to its state before the command executed
+func rollbackFirstKey(db *DB, args [][]byte) []CmdLine {
+	key := string(args[0])
+	return rollbackGivenKeys(db, key)
+}
+
+// rollbackGivenKeys restores the whole entity and ttl of every given key
+func rollbackGivenKeys(db *DB, keys ...string) []CmdLine {
+	var undoCmdLines [][][]byte
+	for _, key := range keys {
+		entity, ok := db.GetEntity(key)
+		if !ok {
+			undoCmdLines = append(undoCmdLines,
+				utils.ToCmdLine("DEL", key),
+			)
+		} else {
+			undoCmdLines = append(undoCmdLines,
+				utils.ToCmdLine("DEL", key), // clean existed first
+			)
+			for _, cmd := range aof.EntityToCmds(key, entity) {
+				undoCmdLines = append(undoCmdLines, cmd.Args)
+			}
+			undoCmdLines = append(undoCmdLines, toTTLCmd(db, key).Args)
+		}
+	}
+	return undoCmdLines
+}
+
+// rollbackHashFields only restores the given fields of a hash
+func rollbackHashFields(db *DB, key string, fields ...string) []CmdLine {
+	var undoCmdLines [][][]byte
+	dict, errReply := db.getAsDict(key)
+	if errReply != nil {
+		return nil
+	}
+	if dict == nil {
+		undoCmdLines = append(undoCmdLines,
+			utils.ToCmdLine("DEL", key),
+		)
+		return undoCmdLines
+	}
+	for _, field := range fields {
+		entity, ok := dict.Get(field)
+		if !ok {
+			undoCmdLines = append(undoCmdLines,
+				utils.ToCmdLine("HDEL", key, field),
+			)
+		} else {
+			value, _ := entity.([]byte)
+			undoCmdLines = append(undoCmdLines,
+				utils.ToCmdLine("HSET", key, field, string(value)),
+			)
+		}
+	}
+	return undoCmdLines
+}
+
+// rollbackSetMembers only restores the given members of a set
+func rollbackSetMembers(db *DB, key string, members ...string) []CmdLine {
+	var undoCmdLines [][][]byte
+	set, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return nil
+	}
+	if set == nil {
+		undoCmdLines = append(undoCmdLines,
+			utils.ToCmdLine("DEL", key),
+		)
+		return undoCmdLines
+	}
+	for _, member := range members {
+		ok := set.Has(member)
+		if !ok {
+			undoCmdLines = append(undoCmdLines,
+				utils.ToCmdLine("SREM", key, member),
+			)
+		} else {
+			undoCmdLines = append(undoCmdLines,
+				utils.ToCmdLine("SADD", key, member),
+			)
+		}
+	}
+	return undoCmdLines
+}
+
+// rollbackZSetFields only restores the given members of a sorted set
+func rollbackZSetFields(db *DB, key string, fields ...string) []CmdLine {
+	var undoCmdLines [][][]byte
+	zset, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return nil
+	}
+	if zset == nil {
+		undoCmdLines = append(undoCmdLines,
+			utils.ToCmdLine("DEL", key),
+		)
+		return undoCmdLines
+	}
+	for _, field := range fields {
+		elem, ok := zset.Get(field)
+		if !ok {
+			undoCmdLines = append(undoCmdLines,
+				utils.ToCmdLine("ZREM", key, field),
+			)
+		} else {
+			score := strconv.FormatFloat(elem.Score, 'f', -1, 64)
+			undoCmdLines = append(undoCmdLines,
+				utils.ToCmdLine("ZADD", key, score, field),
+			)
+		}
+	}
+	return undoCmdLines
+}
+
+// toTTLCmd serializes the ttl of key, PERSIST if key has no ttl
+func toTTLCmd(db *DB, key string) *protocol.MultiBulkReply {
+	raw, exists := db.ttlMap.Get(key)
+	if !exists {
+		// has no TTL
+		return protocol.MakeMultiBulkReply(utils.ToCmdLine("PERSIST", key))
+	}
+	expireTime, _ := raw.(time.Time)
+	timestamp := strconv.FormatInt(expireTime.UnixNano()/1000/1000, 10)
+	return protocol.MakeMultiBulkReply(utils.ToCmdLine("PEXPIREAT", key, timestamp))
+}
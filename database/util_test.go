@@ -16,11 +16,12 @@ import (
 
 func makeTestDB() *DB {
 	return &DB{
-		data: dict.MakeSyncDict(),
+		data: dict.MakeConcurrent(dataDictSize),
 		//修改一个bug，增加一个空的实现
 		addAof: func(line CmdLine) {},
-		// 初始化map 赋值一个SyncMap
-		ttlMap: dict.MakeSyncDict(),
-		locker: lock.Make(lockerSize),
+		// 初始化map 赋值一个分片的ConcurrentDict
+		ttlMap:     dict.MakeConcurrent(ttlDictSize),
+		versionMap: dict.MakeSyncDict(),
+		locker:     lock.Make(lockerSize),
 	}
 }
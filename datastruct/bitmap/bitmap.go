@@ -143,3 +143,102 @@ func (b *BitMap) ForEachByte(begin int, end int, cb Callback) {
 		}
 	}
 }
+
+// GetBits
+//
+//	@Description: 读取从 offset 开始的 width 位(不超过 64)作为无符号整数, 与 SetBit 的位序一致, 低位在前
+//	超出位图长度的部分视为 0
+//	@receiver b
+//	@param offset
+//	@param width
+//	@return uint64
+func (b *BitMap) GetBits(offset int64, width int) uint64 {
+	var val uint64
+	for read := 0; read < width; {
+		byteIndex := (offset + int64(read)) / 8
+		bitOffset := int((offset + int64(read)) % 8)
+		n := 8 - bitOffset
+		if n > width-read {
+			n = width - read
+		}
+		if byteIndex < int64(len(*b)) {
+			chunk := uint64((*b)[byteIndex]>>bitOffset) & (1<<n - 1)
+			val |= chunk << read
+		}
+		read += n
+	}
+	return val
+}
+
+// SetBits
+//
+//	@Description: 将 val 的低 width 位写入从 offset 开始的位置, 位序与 GetBits 相同, 位图不够长时自动扩容
+//	@receiver b
+//	@param offset
+//	@param width
+//	@param val
+func (b *BitMap) SetBits(offset int64, width int, val uint64) {
+	b.grow(offset + int64(width))
+	for written := 0; written < width; {
+		byteIndex := (offset + int64(written)) / 8
+		bitOffset := int((offset + int64(written)) % 8)
+		n := 8 - bitOffset
+		if n > width-written {
+			n = width - written
+		}
+		mask := byte(1<<n-1) << bitOffset
+		(*b)[byteIndex] = (*b)[byteIndex]&^mask | byte(val>>written)<<bitOffset&mask
+		written += n
+	}
+}
+
+// BitOp is bitwise operation applied to bytes
+type BitOp func(a byte, b byte) byte
+
+var (
+	// OpAnd is bitwise AND
+	OpAnd BitOp = func(a byte, b byte) byte { return a & b }
+	// OpOr is bitwise OR
+	OpOr BitOp = func(a byte, b byte) byte { return a | b }
+	// OpXor is bitwise XOR
+	OpXor BitOp = func(a byte, b byte) byte { return a ^ b }
+)
+
+// Combine
+//
+//	@Description: 按字节对多个位图做位运算, 结果长度为最长位图的长度, 较短的位图用 0 补齐
+//	@param op
+//	@param bitmaps
+//	@return *BitMap
+func Combine(op BitOp, bitmaps ...*BitMap) *BitMap {
+	size := 0
+	for _, bm := range bitmaps {
+		if len(*bm) > size {
+			size = len(*bm)
+		}
+	}
+	result := BitMap(make([]byte, size))
+	for i, bm := range bitmaps {
+		for j := range result {
+			var char byte
+			if j < len(*bm) {
+				char = (*bm)[j]
+			}
+			if i == 0 {
+				result[j] = char
+			} else {
+				result[j] = op(result[j], char)
+			}
+		}
+	}
+	return &result
+}
+
+// Not returns a new bitmap whose bits are inverted
+func (b *BitMap) Not() *BitMap {
+	result := BitMap(make([]byte, len(*b)))
+	for i, char := range *b {
+		result[i] = ^char
+	}
+	return &result
+}
@@ -171,3 +171,46 @@ func TestBitMap_ForEachByte(t *testing.T) {
 		t.Error("break failed")
 	}
 }
+
+func TestBits(t *testing.T) {
+	bm := New()
+	bm.SetBits(3, 12, 0xabc)
+	if v := bm.GetBits(3, 12); v != 0xabc {
+		t.Errorf("wrong value %x", v)
+	}
+	for i := 0; i < 12; i++ {
+		if uint64(bm.GetBit(int64(3+i))) != 0xabc>>i&1 {
+			t.Errorf("wrong bit at %d", 3+i)
+		}
+	}
+	if bm.GetBit(2) != 0 || bm.GetBit(15) != 0 {
+		t.Error("bits outside of range are changed")
+	}
+	bm.SetBits(5, 64, 0xfedcba9876543210)
+	if v := bm.GetBits(5, 64); v != 0xfedcba9876543210 {
+		t.Errorf("wrong value %x", v)
+	}
+	if v := bm.GetBits(100, 8); v != 0 {
+		t.Errorf("expect 0 beyond bitmap, actually %x", v)
+	}
+	if len(bm.ToBytes()) != 9 {
+		t.Errorf("wrong size %d", len(bm.ToBytes()))
+	}
+}
+
+func TestCombine(t *testing.T) {
+	bm1 := FromBytes([]byte{0xf0, 0x0f})
+	bm2 := FromBytes([]byte{0x3c})
+	if r := Combine(OpAnd, bm1, bm2).ToBytes(); !bytes.Equal(r, []byte{0x30, 0x00}) {
+		t.Errorf("wrong and %x", r)
+	}
+	if r := Combine(OpOr, bm1, bm2).ToBytes(); !bytes.Equal(r, []byte{0xfc, 0x0f}) {
+		t.Errorf("wrong or %x", r)
+	}
+	if r := Combine(OpXor, bm1, bm2).ToBytes(); !bytes.Equal(r, []byte{0xcc, 0x0f}) {
+		t.Errorf("wrong xor %x", r)
+	}
+	if r := bm1.Not().ToBytes(); !bytes.Equal(r, []byte{0x0f, 0xf0}) {
+		t.Errorf("wrong not %x", r)
+	}
+}
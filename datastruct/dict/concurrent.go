@@ -279,6 +279,7 @@ func (dict *ConcurrentDict) RemoveWithinLock(key string) (val interface{}, resul
 	return nil, 0
 }
 
+// ForEach traverses the dict, consumer is called without lock so it could read or modify the dict
 // Implement dict
 func (dict *ConcurrentDict) ForEach(consumer Consumer) {
 	if dict == nil {
@@ -286,19 +287,23 @@ func (dict *ConcurrentDict) ForEach(consumer Consumer) {
 	}
 
 	for _, s := range dict.table {
+		// 复制分片后释放锁再调用 consumer, 否则 consumer 读写同一分片会死锁
 		s.mutex.RLock()
-		f := func() bool {
-			defer s.mutex.RUnlock()
-			for key, value := range s.m {
-				continues := consumer(key, value)
-				if !continues {
-					return false
-				}
-			}
-			return true
+		if len(s.m) == 0 {
+			s.mutex.RUnlock()
+			continue
 		}
-		if !f() {
-			break
+		keys := make([]string, 0, len(s.m))
+		values := make([]interface{}, 0, len(s.m))
+		for key, value := range s.m {
+			keys = append(keys, key)
+			values = append(values, value)
+		}
+		s.mutex.RUnlock()
+		for i, key := range keys {
+			if !consumer(key, values[i]) {
+				return
+			}
 		}
 	}
 }
@@ -21,4 +21,6 @@ type Dict interface {
 	RandomKeys(limit int) []string         //返回limit数量的键
 	RandomDistinctKeys(limit int) []string // 返回limit数量的不重复的键
 	Clear()
+	// Scan 基于游标遍历, 返回匹配 pattern 的键和下一次的游标, 游标为 0 表示遍历结束
+	Scan(cursor uint64, count int, pattern string) (keys []string, nextCursor uint64)
 }
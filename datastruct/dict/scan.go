@@ -0,0 +1,163 @@
+package dict
+
+import (
+	"container/heap"
+	"github.com/Allen9012/Godis/lib/wildcard"
+	"math"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/8
+  @desc: 基于游标的遍历, 供 SCAN HSCAN SSCAN ZSCAN 使用
+  @modified by:
+**/
+
+// maxHashCursor is the largest cursor of ScanByHash, the cursor after it means the end of iteration
+const maxHashCursor = uint64(1) << 32
+
+// smallScanSize is the max size of containers returned in one call, like hash-max-listpack-entries of redis
+const smallScanSize = 128
+
+// ScanByHash iterates keys in ascending order of their fnv32 hash, cursor is the smallest hash to return.
+// A key exists during the whole iteration is returned at least once, no matter what was added or removed,
+// because the order of a key only depends on itself. It returns matched keys and the next cursor, 0 means finished.
+// Containers with no more than smallScanSize keys are returned in one call like listpack encoding of redis.
+// Otherwise every call walks all keys twice and keeps only count hashes in a heap, costs O(N log count),
+// so it fits containers without stable iteration order such as go map
+func ScanByHash(size int, forEach func(consumer func(key string) bool), cursor uint64, count int, pattern string) ([]string, uint64) {
+	matcher := compileMatcher(pattern)
+	if size <= smallScanSize {
+		var result []string
+		forEach(func(key string) bool {
+			if matcher(key) {
+				result = append(result, key)
+			}
+			return true
+		})
+		return result, 0
+	}
+	if cursor >= maxHashCursor {
+		return nil, 0
+	}
+	if count <= 0 {
+		count = 10
+	}
+	// 第一次遍历找出不小于 cursor 的最小的 count 个 hash, 其中最大的作为本次返回的上界
+	hashes := &hashHeap{}
+	forEach(func(key string) bool {
+		hash := fnv32(key)
+		if uint64(hash) < cursor {
+			return true
+		}
+		if hashes.Len() < count {
+			heap.Push(hashes, hash)
+		} else if hash < (*hashes)[0] {
+			(*hashes)[0] = hash
+			heap.Fix(hashes, 0)
+		}
+		return true
+	})
+	bound := uint64(math.MaxUint32)
+	if hashes.Len() == count {
+		bound = uint64((*hashes)[0])
+	}
+	// keys with the same hash must be returned together, otherwise the cursor can't tell them apart
+	var result []string
+	more := false
+	forEach(func(key string) bool {
+		hash := uint64(fnv32(key))
+		if hash > bound {
+			more = true
+		} else if hash >= cursor && matcher(key) {
+			result = append(result, key)
+		}
+		return true
+	})
+	if !more {
+		return result, 0
+	}
+	return result, bound + 1
+}
+
+// hashHeap is a max heap of hashes
+type hashHeap []uint32
+
+func (h hashHeap) Len() int           { return len(h) }
+func (h hashHeap) Less(i, j int) bool { return h[i] > h[j] }
+func (h hashHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *hashHeap) Push(x interface{}) {
+	*h = append(*h, x.(uint32))
+}
+
+func (h *hashHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// compileMatcher returns a function reporting whether key matches pattern, empty pattern matches all
+func compileMatcher(pattern string) func(key string) bool {
+	if pattern == "" || pattern == "*" {
+		return func(key string) bool {
+			return true
+		}
+	}
+	p := wildcard.CompilePattern(pattern)
+	return p.IsMatch
+}
+
+// Scan iterates dict by cursor, see ScanByHash
+// Implement dict
+func (dict *SimpleDict) Scan(cursor uint64, count int, pattern string) ([]string, uint64) {
+	return ScanByHash(dict.Len(), func(consumer func(key string) bool) {
+		dict.ForEach(func(key string, val interface{}) bool {
+			return consumer(key)
+		})
+	}, cursor, count, pattern)
+}
+
+// Scan iterates dict by cursor, see ScanByHash
+// Implement dict
+func (dict *SyncDict) Scan(cursor uint64, count int, pattern string) ([]string, uint64) {
+	return ScanByHash(dict.Len(), func(consumer func(key string) bool) {
+		dict.ForEach(func(key string, val interface{}) bool {
+			return consumer(key)
+		})
+	}, cursor, count, pattern)
+}
+
+// Scan iterates dict shard by shard, cursor is the index of next shard to visit.
+// The number of shards never changes, so keys exist during the whole iteration will be returned.
+// It returns matched keys of at least count keys visited unless reached the end, and the next cursor, 0 means finished
+// Implement dict
+func (dict *ConcurrentDict) Scan(cursor uint64, count int, pattern string) ([]string, uint64) {
+	if dict == nil {
+		panic("dict is nil")
+	}
+	if count <= 0 {
+		count = 10
+	}
+	matcher := compileMatcher(pattern)
+	var result []string
+	visited := 0
+	i := cursor
+	for ; i < uint64(len(dict.table)) && visited < count; i++ {
+		s := dict.table[i]
+		s.mutex.RLock()
+		for key := range s.m {
+			visited++
+			if matcher(key) {
+				result = append(result, key)
+			}
+		}
+		s.mutex.RUnlock()
+	}
+	if i >= uint64(len(dict.table)) {
+		return result, 0
+	}
+	return result, i
+}
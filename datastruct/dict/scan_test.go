@@ -0,0 +1,90 @@
+package dict
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/8
+  @desc: scan
+  @modified by:
+**/
+
+import (
+	"strconv"
+	"testing"
+)
+
+// scanAll iterates d until cursor returns to 0, calls between iterations run between rounds
+func scanAll(d Dict, count int, pattern string, between func(round int)) map[string]int {
+	seen := make(map[string]int)
+	var cursor uint64
+	for round := 0; ; round++ {
+		keys, next := d.Scan(cursor, count, pattern)
+		for _, key := range keys {
+			seen[key]++
+		}
+		if next == 0 {
+			return seen
+		}
+		cursor = next
+		if between != nil {
+			between(round)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	for name, d := range map[string]Dict{
+		"simple":     MakeSimple(),
+		"sync":       MakeSyncDict(),
+		"concurrent": MakeConcurrent(16),
+	} {
+		for i := 0; i < 1000; i++ {
+			d.Put("k"+strconv.Itoa(i), i)
+		}
+		seen := scanAll(d, 7, "*", nil)
+		if len(seen) != 1000 {
+			t.Errorf("%s: expect 1000 keys, actual %d", name, len(seen))
+		}
+		seen = scanAll(d, 7, "k1*", nil)
+		if len(seen) != 111 {
+			t.Errorf("%s: expect 111 keys matching k1*, actual %d", name, len(seen))
+		}
+		// a call visits about count keys instead of returning all
+		keys, next := d.Scan(0, 7, "*")
+		if next == 0 || len(keys) > 100 {
+			t.Errorf("%s: expect a part of keys, actual %d keys, cursor %d", name, len(keys), next)
+		}
+	}
+}
+
+func TestScanSmall(t *testing.T) {
+	d := MakeSimple()
+	for i := 0; i < smallScanSize; i++ {
+		d.Put("k"+strconv.Itoa(i), i)
+	}
+	keys, next := d.Scan(0, 7, "*")
+	if next != 0 || len(keys) != smallScanSize {
+		t.Errorf("expect all %d keys in one call, actual %d keys, cursor %d", smallScanSize, len(keys), next)
+	}
+}
+
+func TestScanWithModification(t *testing.T) {
+	for name, d := range map[string]Dict{
+		"simple":     MakeSimple(),
+		"concurrent": MakeConcurrent(16),
+	} {
+		for i := 0; i < 1000; i++ {
+			d.Put("k"+strconv.Itoa(i), i)
+		}
+		// keys k0-k499 exist during the whole iteration, k500-k999 are removed and new keys are added
+		seen := scanAll(d, 5, "*", func(round int) {
+			d.Remove("k" + strconv.Itoa(500+round%500))
+			d.Put("n"+strconv.Itoa(round), round)
+		})
+		for i := 0; i < 500; i++ {
+			if seen["k"+strconv.Itoa(i)] == 0 {
+				t.Errorf("%s: k%d missed", name, i)
+			}
+		}
+	}
+}
@@ -66,10 +66,9 @@ func (dict *SyncDict) PutIfExists(key string, val interface{}) (result int) {
 
 // Remove removes the key and return the number of deleted key-value
 func (dict *SyncDict) Remove(key string) (val interface{}, result int) {
-	_, existed := dict.m.Load(key)
-	dict.m.Delete(key)
+	value, existed := dict.m.LoadAndDelete(key)
 	if existed {
-		return nil, 1
+		return value, 1
 	}
 	return nil, 0
 }
@@ -110,15 +109,14 @@ func (dict *SyncDict) RandomKeys(limit int) []string {
 
 // RandomDistinctKeys randomly returns keys of the given number, won't contain duplicated key
 func (dict *SyncDict) RandomDistinctKeys(limit int) []string {
-	ret := make([]string, dict.Len())
-	i := 0
+	if limit <= 0 {
+		return nil
+	}
+	// 不调用 Len, 避免每次采样都遍历整个 map
+	ret := make([]string, 0, limit)
 	dict.m.Range(func(key, value any) bool {
-		ret[i] = key.(string)
-		i++
-		if i == limit {
-			return false
-		}
-		return true
+		ret = append(ret, key.(string))
+		return len(ret) < limit
 	})
 	return ret
 }
@@ -0,0 +1,382 @@
+package hyperloglog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/12
+  @desc: HyperLogLog 基数统计, 序列化格式与 redis 的 HYLL 字符串兼容
+	header 共 16 字节: "HYLL" 魔数, 1 字节编码, 3 字节保留, 8 字节小端序的基数缓存(最高位为 1 表示缓存失效)
+	dense 编码为 16384 个 6 bit 的寄存器, sparse 编码由 ZERO, XZERO, VAL 三种操作码组成
+  @modified by:
+**/
+
+const (
+	precision    = 14
+	registerBits = 6
+	registerMax  = 1<<registerBits - 1
+	// q is the number of hash bits used to count leading zeros
+	q = 64 - precision
+	// Registers is the number of registers
+	Registers = 1 << precision
+	// HeaderSize is the size of HYLL header
+	HeaderSize = 16
+	// DenseSize is the size of dense encoded hyperloglog
+	DenseSize = HeaderSize + (Registers*registerBits+7)/8
+	// SparseMaxBytes is the max size of sparse encoded hyperloglog, the same as redis default hll-sparse-max-bytes
+	SparseMaxBytes = 3000
+
+	encodingDense  = 0
+	encodingSparse = 1
+
+	sparseValMax   = 32
+	sparseValLen   = 4
+	sparseZeroLen  = 64
+	sparseXZeroLen = 16384
+
+	hashSeed = 0xadc83b19
+	alphaInf = 0.721347520444481703680
+)
+
+var magic = []byte("HYLL")
+
+var (
+	// ErrInvalid is returned when the string is not a hyperloglog
+	ErrInvalid = errors.New("WRONGTYPE Key is not a valid HyperLogLog string value.")
+	// ErrCorrupted is returned when the sparse encoded hyperloglog is broken
+	ErrCorrupted = errors.New("INVALIDOBJ Corrupted HLL object detected")
+)
+
+// HyperLogLog estimates cardinality of a set
+type HyperLogLog struct {
+	registers [Registers]uint8
+	sparse    bool
+	card      uint64
+	cardValid bool
+}
+
+// Make creates an empty sparse encoded hyperloglog
+func Make() *HyperLogLog {
+	return &HyperLogLog{
+		sparse:    true,
+		cardValid: true,
+	}
+}
+
+// Parse decodes hyperloglog from redis compatible HYLL string
+//
+//	@Description: 解析 header 和寄存器, 非 HYLL 字符串返回 ErrInvalid, sparse 编码损坏返回 ErrCorrupted
+//	@param data
+//	@return *HyperLogLog
+//	@return error
+func Parse(data []byte) (*HyperLogLog, error) {
+	if len(data) < HeaderSize || !bytes.Equal(data[:len(magic)], magic) {
+		return nil, ErrInvalid
+	}
+	h := &HyperLogLog{}
+	if data[HeaderSize-1]&0x80 == 0 {
+		h.cardValid = true
+		h.card = binary.LittleEndian.Uint64(data[8:HeaderSize])
+	}
+	switch data[4] {
+	case encodingDense:
+		if len(data) != DenseSize {
+			return nil, ErrInvalid
+		}
+		for i := range h.registers {
+			h.registers[i] = denseGet(data[HeaderSize:], i)
+		}
+	case encodingSparse:
+		h.sparse = true
+		if err := sparseDecode(data[HeaderSize:], &h.registers); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrInvalid
+	}
+	return h, nil
+}
+
+// hashElement returns the register index of element and the position of its first 1 bit
+func hashElement(element []byte) (int, uint8) {
+	hash := murmurHash64A(element, hashSeed)
+	index := int(hash & (Registers - 1))
+	hash >>= precision
+	// make sure count is no more than q+1
+	hash |= 1 << q
+	return index, uint8(bits.TrailingZeros64(hash) + 1)
+}
+
+// Add puts element into hyperloglog, returns whether any register is changed
+func (h *HyperLogLog) Add(element []byte) bool {
+	index, count := hashElement(element)
+	if count <= h.registers[index] {
+		return false
+	}
+	h.registers[index] = count
+	h.cardValid = false
+	return true
+}
+
+// Merge sets registers to the max of h and other, the result is dense if other is dense
+func (h *HyperLogLog) Merge(other *HyperLogLog) {
+	for i, v := range other.registers {
+		if v > h.registers[i] {
+			h.registers[i] = v
+		}
+	}
+	if !other.sparse {
+		h.sparse = false
+	}
+	h.cardValid = false
+}
+
+// Count returns estimated cardinality, using cached value if valid
+func (h *HyperLogLog) Count() uint64 {
+	if !h.cardValid {
+		h.card = estimate(&h.registers)
+		h.cardValid = true
+	}
+	return h.card
+}
+
+// IsSparse returns whether the hyperloglog is sparse encoded
+func (h *HyperLogLog) IsSparse() bool {
+	return h.sparse
+}
+
+// ToDense converts hyperloglog to dense encoding, returns false if it is dense already
+func (h *HyperLogLog) ToDense() bool {
+	if !h.sparse {
+		return false
+	}
+	h.sparse = false
+	return true
+}
+
+// Registers returns a copy of registers
+func (h *HyperLogLog) Registers() []uint8 {
+	result := make([]uint8, Registers)
+	copy(result, h.registers[:])
+	return result
+}
+
+// Bytes encodes hyperloglog as HYLL string
+//
+//	@Description: sparse 编码无法表示的寄存器值或超过 SparseMaxBytes 时会转为 dense 编码
+//	@receiver h
+//	@return []byte
+func (h *HyperLogLog) Bytes() []byte {
+	if h.sparse {
+		if data := h.encodeSparse(); data != nil {
+			return data
+		}
+		h.sparse = false
+	}
+	return h.encodeDense()
+}
+
+func (h *HyperLogLog) header(encoding byte, size int) []byte {
+	data := make([]byte, HeaderSize, size)
+	copy(data, magic)
+	data[4] = encoding
+	if h.cardValid {
+		binary.LittleEndian.PutUint64(data[8:HeaderSize], h.card)
+	} else {
+		data[HeaderSize-1] = 0x80
+	}
+	return data
+}
+
+func (h *HyperLogLog) encodeDense() []byte {
+	data := h.header(encodingDense, DenseSize)[:DenseSize]
+	for i, v := range h.registers {
+		denseSet(data[HeaderSize:], i, v)
+	}
+	return data
+}
+
+// encodeSparse returns nil if registers could not be sparse encoded within SparseMaxBytes
+func (h *HyperLogLog) encodeSparse() []byte {
+	data := h.header(encodingSparse, HeaderSize+2)
+	for i := 0; i < Registers; {
+		v := h.registers[i]
+		run := 1
+		for i+run < Registers && h.registers[i+run] == v {
+			run++
+		}
+		i += run
+		if v > sparseValMax {
+			return nil
+		}
+		for run > 0 {
+			switch {
+			case v > 0:
+				n := minInt(run, sparseValLen)
+				data = append(data, 0x80|(v-1)<<2|byte(n-1))
+				run -= n
+			case run <= sparseZeroLen:
+				data = append(data, byte(run-1))
+				run = 0
+			default:
+				n := minInt(run, sparseXZeroLen)
+				data = append(data, 0x40|byte((n-1)>>8), byte(n-1))
+				run -= n
+			}
+		}
+		if len(data) > SparseMaxBytes {
+			return nil
+		}
+	}
+	return data
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func denseGet(registers []byte, i int) uint8 {
+	pos := i * registerBits
+	b, fb := pos/8, uint(pos&7)
+	v := registers[b] >> fb
+	if fb > 8-registerBits {
+		v |= registers[b+1] << (8 - fb)
+	}
+	return v & registerMax
+}
+
+func denseSet(registers []byte, i int, v uint8) {
+	pos := i * registerBits
+	b, fb := pos/8, uint(pos&7)
+	registers[b] &^= byte(registerMax) << fb
+	registers[b] |= v << fb
+	if fb > 8-registerBits {
+		registers[b+1] &^= byte(registerMax) >> (8 - fb)
+		registers[b+1] |= v >> (8 - fb)
+	}
+}
+
+// sparseOp decodes the opcode at data[0], returns value, run length and size of opcode
+func sparseOp(data []byte) (uint8, int, int, error) {
+	op := data[0]
+	switch op & 0xc0 {
+	case 0x00: // ZERO: 00xxxxxx
+		return 0, int(op&0x3f) + 1, 1, nil
+	case 0x40: // XZERO: 01xxxxxx yyyyyyyy
+		if len(data) < 2 {
+			return 0, 0, 0, ErrCorrupted
+		}
+		return 0, (int(op&0x3f)<<8 | int(data[1])) + 1, 2, nil
+	default: // VAL: 1vvvvvxx
+		return (op>>2)&0x1f + 1, int(op&0x03) + 1, 1, nil
+	}
+}
+
+func sparseDecode(data []byte, registers *[Registers]uint8) error {
+	idx := 0
+	for len(data) > 0 {
+		v, run, size, err := sparseOp(data)
+		if err != nil {
+			return err
+		}
+		if idx+run > Registers {
+			return ErrCorrupted
+		}
+		for j := 0; j < run; j++ {
+			registers[idx+j] = v
+		}
+		idx += run
+		data = data[size:]
+	}
+	if idx != Registers {
+		return ErrCorrupted
+	}
+	return nil
+}
+
+// DescribeSparse returns human-readable opcodes of sparse encoded hyperloglog, like "Z:10 v:3,1 XZ:16373"
+func DescribeSparse(data []byte) (string, error) {
+	if len(data) < HeaderSize || data[4] != encodingSparse {
+		return "", ErrInvalid
+	}
+	var ops []string
+	data = data[HeaderSize:]
+	for len(data) > 0 {
+		v, run, size, err := sparseOp(data)
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case v > 0:
+			ops = append(ops, "v:"+strconv.Itoa(int(v))+","+strconv.Itoa(run))
+		case size == 1:
+			ops = append(ops, "Z:"+strconv.Itoa(run))
+		default:
+			ops = append(ops, "XZ:"+strconv.Itoa(run))
+		}
+		data = data[size:]
+	}
+	return strings.Join(ops, " "), nil
+}
+
+// estimate returns cardinality by the improved estimator of Otmar Ertl, the same as redis
+func estimate(registers *[Registers]uint8) uint64 {
+	var histogram [64]int
+	for _, v := range registers {
+		histogram[v]++
+	}
+	m := float64(Registers)
+	z := m * tau((m-float64(histogram[q+1]))/m)
+	for j := q; j >= 1; j-- {
+		z += float64(histogram[j])
+		z *= 0.5
+	}
+	z += m * sigma(float64(histogram[0])/m)
+	return uint64(math.Round(alphaInf * m * m / z))
+}
+
+func sigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y := 1.0
+	z := x
+	for {
+		x *= x
+		prev := z
+		z += x * y
+		y += y
+		if prev == z {
+			return z
+		}
+	}
+}
+
+func tau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y := 1.0
+	z := 1 - x
+	for {
+		x = math.Sqrt(x)
+		prev := z
+		y *= 0.5
+		z -= math.Pow(1-x, 2) * y
+		if prev == z {
+			return z / 3
+		}
+	}
+}
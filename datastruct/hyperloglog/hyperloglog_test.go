@@ -0,0 +1,131 @@
+package hyperloglog
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"testing"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/12
+  @desc:
+  @modified by:
+**/
+
+func TestEmpty(t *testing.T) {
+	hll := Make()
+	expected := []byte("HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x7f\xff")
+	if data := hll.Bytes(); !bytes.Equal(data, expected) {
+		t.Errorf("wrong empty hyperloglog %q", data)
+	}
+	if hll.Count() != 0 {
+		t.Errorf("expect 0, actually %d", hll.Count())
+	}
+}
+
+func TestCount(t *testing.T) {
+	hll := Make()
+	for i := 0; i < 10; i++ {
+		hll.Add([]byte(strconv.Itoa(i)))
+	}
+	if hll.Count() != 10 {
+		t.Errorf("expect 10, actually %d", hll.Count())
+	}
+	for _, n := range []int{1000, 100000} {
+		hll = Make()
+		for i := 0; i < n; i++ {
+			hll.Add([]byte("element:" + strconv.Itoa(i)))
+		}
+		if e := math.Abs(float64(hll.Count())-float64(n)) / float64(n); e > 0.02 {
+			t.Errorf("error of %d elements is too large: %d", n, hll.Count())
+		}
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	hll := Make()
+	for i := 0; i < 100; i++ {
+		hll.Add([]byte(strconv.Itoa(i)))
+	}
+	data := hll.Bytes()
+	if !hll.IsSparse() || data[4] != encodingSparse || data[15]&0x80 == 0 {
+		t.Fatalf("expect sparse encoding with invalid cache")
+	}
+	decoded, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.registers != hll.registers || decoded.Count() != hll.Count() {
+		t.Error("sparse decoding mismatch")
+	}
+
+	// too many registers for sparse encoding
+	for i := 0; i < 5000; i++ {
+		hll.Add([]byte(strconv.Itoa(i)))
+	}
+	data = hll.Bytes()
+	if hll.IsSparse() || len(data) != DenseSize {
+		t.Fatalf("expect dense encoding")
+	}
+	decoded, err = Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.registers != hll.registers || decoded.IsSparse() {
+		t.Error("dense decoding mismatch")
+	}
+
+	// cached cardinality
+	hll.Count()
+	decoded, _ = Parse(hll.Bytes())
+	if !decoded.cardValid || decoded.card != hll.Count() {
+		t.Error("wrong cached cardinality")
+	}
+
+	if _, err = Parse([]byte("HYLL")); err != ErrInvalid {
+		t.Error("expect invalid")
+	}
+	if _, err = Parse(data[:DenseSize-1]); err != ErrInvalid {
+		t.Error("expect invalid")
+	}
+	if _, err = Parse([]byte("HYLL\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x7f\xfe")); err != ErrCorrupted {
+		t.Error("expect corrupted")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	hll1 := Make()
+	hll2 := Make()
+	for i := 0; i < 1000; i++ {
+		hll1.Add([]byte(strconv.Itoa(i)))
+		hll2.Add([]byte(strconv.Itoa(i + 500)))
+	}
+	hll1.Merge(hll2)
+	if e := math.Abs(float64(hll1.Count())-1500) / 1500; e > 0.02 {
+		t.Errorf("wrong merged cardinality %d", hll1.Count())
+	}
+	if !hll1.IsSparse() {
+		t.Error("merge of sparse should be sparse")
+	}
+	hll2.ToDense()
+	hll1.Merge(hll2)
+	if hll1.IsSparse() {
+		t.Error("merge of dense should be dense")
+	}
+}
+
+func TestDescribeSparse(t *testing.T) {
+	hll := Make()
+	hll.registers[10] = 3
+	hll.registers[11] = 3
+	desc, err := DescribeSparse(hll.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc != "Z:10 v:3,2 XZ:16372" {
+		t.Errorf("wrong description %s", desc)
+	}
+}
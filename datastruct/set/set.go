@@ -126,3 +126,8 @@ func (set *Set) RandomMembers(limit int) []string {
 func (set *Set) RandomDistinctMembers(limit int) []string {
 	return set.dict.RandomDistinctKeys(limit)
 }
+
+// Scan iterates members by cursor, returns matched members and the next cursor, 0 means finished
+func (set *Set) Scan(cursor uint64, count int, pattern string) ([]string, uint64) {
+	return set.dict.Scan(cursor, count, pattern)
+}
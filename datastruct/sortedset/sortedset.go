@@ -1,6 +1,7 @@
 package sortedset
 
 import (
+	"github.com/Allen9012/Godis/datastruct/dict"
 	"github.com/Allen9012/Godis/lib/logger"
 	"strconv"
 )
@@ -252,3 +253,19 @@ func (sortedSet *SortedSet) RemoveByRank(start int64, stop int64) int64 {
 	}
 	return int64(len(removed))
 }
+
+// Scan iterates members by cursor, returns matched elements and the next cursor, 0 means finished
+func (sortedSet *SortedSet) Scan(cursor uint64, count int, pattern string) ([]*Element, uint64) {
+	members, next := dict.ScanByHash(len(sortedSet.dict), func(consumer func(key string) bool) {
+		for member := range sortedSet.dict {
+			if !consumer(member) {
+				return
+			}
+		}
+	}, cursor, count, pattern)
+	elements := make([]*Element, 0, len(members))
+	for _, member := range members {
+		elements = append(elements, sortedSet.dict[member])
+	}
+	return elements, next
+}
@@ -0,0 +1,219 @@
+package stream
+
+import (
+	"sort"
+	"time"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/10
+  @desc: consumer group, 记录每个 group 已投递的位置和未确认的 entry (PEL)
+  @modified by:
+**/
+
+// Group is a consumer group of stream
+type Group struct {
+	Name string
+	// LastID is the ID of last entry delivered to consumers
+	LastID    ID
+	consumers map[string]*Consumer
+	// pel is pending entries list sorted by ID, entries delivered but not acknowledged
+	pel []*PendingEntry
+}
+
+// Consumer is a member of consumer group
+type Consumer struct {
+	Name string
+	// SeenTime is the last time the consumer interacted with the group
+	SeenTime time.Time
+	pending  int
+}
+
+// PendingEntry is an entry delivered but not acknowledged
+type PendingEntry struct {
+	ID            ID
+	Consumer      *Consumer
+	DeliveryTime  time.Time
+	DeliveryCount int64
+}
+
+// CreateGroup creates a consumer group starting after lastID, returns false if group exists
+func (s *Stream) CreateGroup(name string, lastID ID) (*Group, bool) {
+	if _, ok := s.groups[name]; ok {
+		return nil, false
+	}
+	group := &Group{
+		Name:      name,
+		LastID:    lastID,
+		consumers: make(map[string]*Consumer),
+	}
+	s.groups[name] = group
+	return group, true
+}
+
+// GetGroup returns group of name, returns nil if not found
+func (s *Stream) GetGroup(name string) *Group {
+	return s.groups[name]
+}
+
+// DestroyGroup removes group of name, returns whether the group existed
+func (s *Stream) DestroyGroup(name string) bool {
+	if _, ok := s.groups[name]; !ok {
+		return false
+	}
+	delete(s.groups, name)
+	return true
+}
+
+// Groups returns all groups sorted by name
+func (s *Stream) Groups() []*Group {
+	groups := make([]*Group, 0, len(s.groups))
+	for _, group := range s.groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+	return groups
+}
+
+// GetConsumer returns consumer of name, returns nil if not found
+func (g *Group) GetConsumer(name string) *Consumer {
+	return g.consumers[name]
+}
+
+// CreateConsumer creates consumer if absent, returns the consumer and whether it is created
+func (g *Group) CreateConsumer(name string, now time.Time) (*Consumer, bool) {
+	if consumer, ok := g.consumers[name]; ok {
+		return consumer, false
+	}
+	consumer := &Consumer{
+		Name:     name,
+		SeenTime: now,
+	}
+	g.consumers[name] = consumer
+	return consumer, true
+}
+
+// DeleteConsumer removes consumer and its pending entries, returns the number of pending entries removed
+func (g *Group) DeleteConsumer(name string) int {
+	consumer, ok := g.consumers[name]
+	if !ok {
+		return 0
+	}
+	removed := consumer.pending
+	if removed > 0 {
+		pel := g.pel[:0]
+		for _, pending := range g.pel {
+			if pending.Consumer != consumer {
+				pel = append(pel, pending)
+			}
+		}
+		g.pel = pel
+	}
+	delete(g.consumers, name)
+	return removed
+}
+
+// Consumers returns all consumers sorted by name
+func (g *Group) Consumers() []*Consumer {
+	consumers := make([]*Consumer, 0, len(g.consumers))
+	for _, consumer := range g.consumers {
+		consumers = append(consumers, consumer)
+	}
+	sort.Slice(consumers, func(i, j int) bool {
+		return consumers[i].Name < consumers[j].Name
+	})
+	return consumers
+}
+
+// PendingCount returns the number of pending entries of consumer
+func (c *Consumer) PendingCount() int {
+	return c.pending
+}
+
+// searchPending returns the index of the first pending entry whose ID >= id
+func (g *Group) searchPending(id ID) int {
+	return sort.Search(len(g.pel), func(i int) bool {
+		return !g.pel[i].ID.Less(id)
+	})
+}
+
+// GetPending returns pending entry of id, returns nil if not found
+func (g *Group) GetPending(id ID) *PendingEntry {
+	i := g.searchPending(id)
+	if i < len(g.pel) && g.pel[i].ID == id {
+		return g.pel[i]
+	}
+	return nil
+}
+
+// Deliver records that entry of id is delivered to consumer, the delivery count increases if it is pending already
+func (g *Group) Deliver(id ID, consumer *Consumer, now time.Time) *PendingEntry {
+	i := g.searchPending(id)
+	if i < len(g.pel) && g.pel[i].ID == id {
+		pending := g.pel[i]
+		pending.Consumer.pending--
+		consumer.pending++
+		pending.Consumer = consumer
+		pending.DeliveryTime = now
+		pending.DeliveryCount++
+		return pending
+	}
+	pending := &PendingEntry{
+		ID:            id,
+		Consumer:      consumer,
+		DeliveryTime:  now,
+		DeliveryCount: 1,
+	}
+	g.pel = append(g.pel, nil)
+	copy(g.pel[i+1:], g.pel[i:])
+	g.pel[i] = pending
+	consumer.pending++
+	return pending
+}
+
+// Claim transfers pending entry to consumer without changing delivery count
+func (g *Group) Claim(pending *PendingEntry, consumer *Consumer) {
+	pending.Consumer.pending--
+	consumer.pending++
+	pending.Consumer = consumer
+}
+
+// Ack removes entry of id from pending entries list, returns whether it was pending
+func (g *Group) Ack(id ID) bool {
+	i := g.searchPending(id)
+	if i == len(g.pel) || g.pel[i].ID != id {
+		return false
+	}
+	g.pel[i].Consumer.pending--
+	g.pel = append(g.pel[:i], g.pel[i+1:]...)
+	return true
+}
+
+// PendingLen returns the number of pending entries
+func (g *Group) PendingLen() int {
+	return len(g.pel)
+}
+
+// PendingRange returns at most count pending entries whose ID in [start, end] in ascending order,
+// count <= 0 means no limit. Only entries of consumer are returned if consumer is not nil
+func (g *Group) PendingRange(start ID, end ID, count int, consumer *Consumer) []*PendingEntry {
+	var result []*PendingEntry
+	for i := g.searchPending(start); i < len(g.pel); i++ {
+		if count > 0 && len(result) >= count {
+			break
+		}
+		pending := g.pel[i]
+		if end.Less(pending.ID) {
+			break
+		}
+		if consumer != nil && pending.Consumer != consumer {
+			continue
+		}
+		result = append(result, pending)
+	}
+	return result
+}
@@ -0,0 +1,108 @@
+package stream
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/10
+  @desc: stream entry id, 格式为 <毫秒时间戳>-<序列号>
+  @modified by:
+**/
+
+// ID identifies an entry of stream, entries are ordered by ID
+type ID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+var (
+	// MinID is the smallest ID, which is never used by entries
+	MinID = ID{}
+	// MaxID is the largest ID
+	MaxID = ID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+)
+
+// ErrInvalidID is returned when parsing a malformed ID
+var ErrInvalidID = errors.New("invalid stream id")
+
+// String formats ID as <ms>-<seq>
+func (id ID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+// Compare returns -1, 0 or 1 if id is less than, equal to or greater than other
+func (id ID) Compare(other ID) int {
+	switch {
+	case id.Ms < other.Ms:
+		return -1
+	case id.Ms > other.Ms:
+		return 1
+	case id.Seq < other.Seq:
+		return -1
+	case id.Seq > other.Seq:
+		return 1
+	}
+	return 0
+}
+
+// Less returns whether id is less than other
+func (id ID) Less(other ID) bool {
+	return id.Compare(other) < 0
+}
+
+// Next returns the smallest ID greater than id, returns false if id is MaxID
+func (id ID) Next() (ID, bool) {
+	if id.Seq < math.MaxUint64 {
+		return ID{Ms: id.Ms, Seq: id.Seq + 1}, true
+	}
+	if id.Ms < math.MaxUint64 {
+		return ID{Ms: id.Ms + 1}, true
+	}
+	return id, false
+}
+
+// Prev returns the largest ID less than id, returns false if id is MinID
+func (id ID) Prev() (ID, bool) {
+	if id.Seq > 0 {
+		return ID{Ms: id.Ms, Seq: id.Seq - 1}, true
+	}
+	if id.Ms > 0 {
+		return ID{Ms: id.Ms - 1, Seq: math.MaxUint64}, true
+	}
+	return id, false
+}
+
+// ParseID parses <ms>-<seq> or <ms>, seq of the latter is defaultSeq
+func ParseID(s string, defaultSeq uint64) (ID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return ID{}, ErrInvalidID
+	}
+	if !hasSeq {
+		return ID{Ms: ms, Seq: defaultSeq}, nil
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return ID{}, ErrInvalidID
+	}
+	return ID{Ms: ms, Seq: seq}, nil
+}
+
+// NextID generates ID for new entry like idgenerator.IDGenerator does: current unix time in milliseconds
+// with a sequence, the sequence increases within the same millisecond or when clock moves backwards.
+// It returns false if no ID is greater than lastID
+func NextID(lastID ID, now time.Time) (ID, bool) {
+	ms := uint64(now.UnixMilli())
+	if ms > lastID.Ms {
+		return ID{Ms: ms}, true
+	}
+	return lastID.Next()
+}
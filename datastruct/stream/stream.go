@@ -0,0 +1,287 @@
+package stream
+
+import (
+	"errors"
+	"sort"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/10
+  @desc: stream 数据结构
+	entries 存放在两层的 B+ 树中: 有序的节点索引 + 每个节点内至多 nodeCapacity 个有序的 entry,
+	ID 只会递增, 所以新 entry 总是追加在最后一个节点, 近似裁剪时整个节点一起删除
+  @modified by:
+**/
+
+// nodeCapacity is the max number of entries in a node
+const nodeCapacity = 128
+
+// ErrIDTooSmall is returned by Add if id is not greater than the last ID
+var ErrIDTooSmall = errors.New("the ID specified is equal or smaller than the target stream top item")
+
+// Entry is an element of stream
+type Entry struct {
+	ID ID
+	// Fields are field-value pairs
+	Fields [][]byte
+}
+
+type node struct {
+	entries []*Entry
+}
+
+func (n *node) firstID() ID {
+	return n.entries[0].ID
+}
+
+func (n *node) lastID() ID {
+	return n.entries[len(n.entries)-1].ID
+}
+
+// search returns the index of the first entry whose ID >= id
+func (n *node) search(id ID) int {
+	return sort.Search(len(n.entries), func(i int) bool {
+		return !n.entries[i].ID.Less(id)
+	})
+}
+
+// Stream is an append-only log of entries, it is not concurrent safe
+type Stream struct {
+	nodes  []*node
+	length int
+	// lastID is the largest ID ever added, new entries must have greater ID
+	lastID ID
+	// maxDeletedID is the largest ID of deleted entries
+	maxDeletedID ID
+	// entriesAdded is the count of all entries ever added
+	entriesAdded uint64
+	groups       map[string]*Group
+}
+
+// Make creates an empty stream
+func Make() *Stream {
+	return &Stream{
+		groups: make(map[string]*Group),
+	}
+}
+
+// Len returns the number of entries
+func (s *Stream) Len() int {
+	return s.length
+}
+
+// LastID returns the largest ID ever added
+func (s *Stream) LastID() ID {
+	return s.lastID
+}
+
+// SetLastID sets last ID, used by XSETID
+func (s *Stream) SetLastID(id ID) {
+	s.lastID = id
+}
+
+// MaxDeletedID returns the largest ID of deleted entries
+func (s *Stream) MaxDeletedID() ID {
+	return s.maxDeletedID
+}
+
+// SetMaxDeletedID sets max deleted ID, used by XSETID
+func (s *Stream) SetMaxDeletedID(id ID) {
+	s.maxDeletedID = id
+}
+
+// EntriesAdded returns the count of all entries ever added
+func (s *Stream) EntriesAdded() uint64 {
+	return s.entriesAdded
+}
+
+// SetEntriesAdded sets count of entries ever added, used by XSETID
+func (s *Stream) SetEntriesAdded(n uint64) {
+	s.entriesAdded = n
+}
+
+// Add appends a new entry, id must be greater than the last ID
+func (s *Stream) Add(id ID, fields [][]byte) error {
+	if !s.lastID.Less(id) {
+		return ErrIDTooSmall
+	}
+	entry := &Entry{ID: id, Fields: fields}
+	if len(s.nodes) == 0 || len(s.nodes[len(s.nodes)-1].entries) >= nodeCapacity {
+		s.nodes = append(s.nodes, &node{entries: make([]*Entry, 0, nodeCapacity)})
+	}
+	last := s.nodes[len(s.nodes)-1]
+	last.entries = append(last.entries, entry)
+	s.length++
+	s.lastID = id
+	s.entriesAdded++
+	return nil
+}
+
+// searchNode returns the index of the first node whose last ID >= id
+func (s *Stream) searchNode(id ID) int {
+	return sort.Search(len(s.nodes), func(i int) bool {
+		return !s.nodes[i].lastID().Less(id)
+	})
+}
+
+// Get returns the entry of id, returns nil if not found
+func (s *Stream) Get(id ID) *Entry {
+	i := s.searchNode(id)
+	if i == len(s.nodes) {
+		return nil
+	}
+	n := s.nodes[i]
+	j := n.search(id)
+	if j < len(n.entries) && n.entries[j].ID == id {
+		return n.entries[j]
+	}
+	return nil
+}
+
+// Delete removes entry of id, returns whether the entry existed
+func (s *Stream) Delete(id ID) bool {
+	i := s.searchNode(id)
+	if i == len(s.nodes) {
+		return false
+	}
+	n := s.nodes[i]
+	j := n.search(id)
+	if j == len(n.entries) || n.entries[j].ID != id {
+		return false
+	}
+	n.entries = append(n.entries[:j], n.entries[j+1:]...)
+	if len(n.entries) == 0 {
+		s.nodes = append(s.nodes[:i], s.nodes[i+1:]...)
+	}
+	s.length--
+	if s.maxDeletedID.Less(id) {
+		s.maxDeletedID = id
+	}
+	return true
+}
+
+// FirstEntry returns the entry with smallest ID, returns nil if stream is empty
+func (s *Stream) FirstEntry() *Entry {
+	if len(s.nodes) == 0 {
+		return nil
+	}
+	return s.nodes[0].entries[0]
+}
+
+// LastEntry returns the entry with largest ID, returns nil if stream is empty
+func (s *Stream) LastEntry() *Entry {
+	if len(s.nodes) == 0 {
+		return nil
+	}
+	n := s.nodes[len(s.nodes)-1]
+	return n.entries[len(n.entries)-1]
+}
+
+// Range returns at most count entries whose ID in [start, end], count <= 0 means no limit.
+// Entries are in descending order if reverse is true
+func (s *Stream) Range(start ID, end ID, count int, reverse bool) []*Entry {
+	var result []*Entry
+	if end.Less(start) {
+		return result
+	}
+	full := func() bool {
+		return count > 0 && len(result) >= count
+	}
+	if !reverse {
+		for i := s.searchNode(start); i < len(s.nodes) && !full(); i++ {
+			n := s.nodes[i]
+			for j := n.search(start); j < len(n.entries) && !full(); j++ {
+				if end.Less(n.entries[j].ID) {
+					return result
+				}
+				result = append(result, n.entries[j])
+			}
+		}
+		return result
+	}
+	i := s.searchNode(end)
+	if i == len(s.nodes) {
+		i--
+	}
+	for ; i >= 0 && !full(); i-- {
+		n := s.nodes[i]
+		j := n.search(end)
+		if j == len(n.entries) || end.Less(n.entries[j].ID) {
+			j--
+		}
+		for ; j >= 0 && !full(); j-- {
+			if n.entries[j].ID.Less(start) {
+				return result
+			}
+			result = append(result, n.entries[j])
+		}
+	}
+	return result
+}
+
+// ForEach visits entries in ascending order until consumer returns false
+func (s *Stream) ForEach(consumer func(entry *Entry) bool) {
+	for _, n := range s.nodes {
+		for _, entry := range n.entries {
+			if !consumer(entry) {
+				return
+			}
+		}
+	}
+}
+
+// trim removes entries from head while shouldRemove returns true.
+// If approx is true, only whole nodes are removed. limit is the max number of entries to remove, limit <= 0 means no limit
+func (s *Stream) trim(shouldRemove func(entry *Entry, remaining int) bool, approx bool, limit int) int {
+	removed := 0
+	for len(s.nodes) > 0 {
+		n := s.nodes[0]
+		if approx {
+			last := n.entries[len(n.entries)-1]
+			if !shouldRemove(last, s.length-len(n.entries)+1) || (limit > 0 && removed+len(n.entries) > limit) {
+				break
+			}
+			removed += len(n.entries)
+			s.length -= len(n.entries)
+			s.updateMaxDeletedID(last.ID)
+			s.nodes = s.nodes[1:]
+			continue
+		}
+		j := 0
+		for j < len(n.entries) && (limit <= 0 || removed < limit) && shouldRemove(n.entries[j], s.length) {
+			s.updateMaxDeletedID(n.entries[j].ID)
+			j++
+			removed++
+			s.length--
+		}
+		if j < len(n.entries) {
+			n.entries = n.entries[j:]
+			break
+		}
+		s.nodes = s.nodes[1:]
+	}
+	return removed
+}
+
+func (s *Stream) updateMaxDeletedID(id ID) {
+	if s.maxDeletedID.Less(id) {
+		s.maxDeletedID = id
+	}
+}
+
+// TrimByLen removes the oldest entries until length <= maxLen, returns the number of removed entries
+func (s *Stream) TrimByLen(maxLen int, approx bool, limit int) int {
+	return s.trim(func(entry *Entry, remaining int) bool {
+		// remaining is the length before removing entry
+		return remaining > maxLen
+	}, approx, limit)
+}
+
+// TrimByMinID removes entries whose ID is less than minID, returns the number of removed entries
+func (s *Stream) TrimByMinID(minID ID, approx bool, limit int) int {
+	return s.trim(func(entry *Entry, remaining int) bool {
+		return entry.ID.Less(minID)
+	}, approx, limit)
+}
@@ -0,0 +1,173 @@
+package stream
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/10
+  @desc:
+  @modified by:
+**/
+
+func makeStream(size int) *Stream {
+	s := Make()
+	for i := 1; i <= size; i++ {
+		_ = s.Add(ID{Ms: uint64(i)}, [][]byte{[]byte("f"), []byte(strconv.Itoa(i))})
+	}
+	return s
+}
+
+func assertIDs(t *testing.T, entries []*Entry, expected ...uint64) {
+	t.Helper()
+	if len(entries) != len(expected) {
+		t.Fatalf("expect %d entries, actual %d", len(expected), len(entries))
+	}
+	for i, entry := range entries {
+		if entry.ID.Ms != expected[i] {
+			t.Errorf("expect %d, actual %s", expected[i], entry.ID)
+		}
+	}
+}
+
+func TestParseID(t *testing.T) {
+	id, err := ParseID("1526919030474-55", 0)
+	if err != nil || id != (ID{Ms: 1526919030474, Seq: 55}) {
+		t.Errorf("wrong id: %s %v", id, err)
+	}
+	id, err = ParseID("1526919030474", 7)
+	if err != nil || id.String() != "1526919030474-7" {
+		t.Errorf("wrong id: %s %v", id, err)
+	}
+	for _, s := range []string{"", "-1", "a-1", "1-b", "1-"} {
+		if _, err := ParseID(s, 0); err == nil {
+			t.Errorf("expect error for %q", s)
+		}
+	}
+	next, _ := MaxID.Prev()
+	if next, ok := next.Next(); !ok || next != MaxID {
+		t.Errorf("wrong next id %s", next)
+	}
+	if _, ok := MaxID.Next(); ok {
+		t.Error("expect no id after MaxID")
+	}
+}
+
+func TestNextID(t *testing.T) {
+	now := time.UnixMilli(1000)
+	id, _ := NextID(MinID, now)
+	if id != (ID{Ms: 1000}) {
+		t.Errorf("wrong id %s", id)
+	}
+	id, _ = NextID(id, now)
+	if id != (ID{Ms: 1000, Seq: 1}) {
+		t.Errorf("wrong id %s", id)
+	}
+	// clock moves backwards
+	id, _ = NextID(ID{Ms: 2000, Seq: 3}, now)
+	if id != (ID{Ms: 2000, Seq: 4}) {
+		t.Errorf("wrong id %s", id)
+	}
+}
+
+func TestAddAndRange(t *testing.T) {
+	s := makeStream(1000)
+	if s.Len() != 1000 || s.LastID() != (ID{Ms: 1000}) {
+		t.Fatalf("wrong stream length %d", s.Len())
+	}
+	if err := s.Add(ID{Ms: 1000}, nil); err != ErrIDTooSmall {
+		t.Errorf("expect ErrIDTooSmall, actual %v", err)
+	}
+	assertIDs(t, s.Range(ID{Ms: 126}, ID{Ms: 130}, 0, false), 126, 127, 128, 129, 130)
+	assertIDs(t, s.Range(ID{Ms: 126}, ID{Ms: 130}, 2, true), 130, 129)
+	assertIDs(t, s.Range(MinID, MaxID, 3, false), 1, 2, 3)
+	assertIDs(t, s.Range(MinID, MaxID, 3, true), 1000, 999, 998)
+	assertIDs(t, s.Range(ID{Ms: 999, Seq: 1}, MaxID, 0, false), 1000)
+	assertIDs(t, s.Range(ID{Ms: 5}, ID{Ms: 4}, 0, false))
+	if len(s.Range(MinID, MaxID, 0, true)) != 1000 {
+		t.Error("wrong range size")
+	}
+
+	if !s.Delete(ID{Ms: 128}) || s.Delete(ID{Ms: 128}) {
+		t.Error("delete failed")
+	}
+	if s.Get(ID{Ms: 128}) != nil || s.Get(ID{Ms: 129}) == nil {
+		t.Error("get failed")
+	}
+	assertIDs(t, s.Range(ID{Ms: 127}, ID{Ms: 129}, 0, true), 129, 127)
+	if s.MaxDeletedID() != (ID{Ms: 128}) || s.Len() != 999 || s.EntriesAdded() != 1000 {
+		t.Error("wrong stream meta")
+	}
+	for i := 1; i <= 1000; i++ {
+		s.Delete(ID{Ms: uint64(i)})
+	}
+	if s.Len() != 0 || s.FirstEntry() != nil || len(s.Range(MinID, MaxID, 0, true)) != 0 {
+		t.Error("stream should be empty")
+	}
+}
+
+func TestTrim(t *testing.T) {
+	s := makeStream(1000)
+	if removed := s.TrimByLen(900, false, 0); removed != 100 || s.FirstEntry().ID.Ms != 101 {
+		t.Errorf("wrong trim result %d", removed)
+	}
+	// the first node contains entries 101-128
+	if removed := s.TrimByLen(880, true, 0); removed != 0 {
+		t.Errorf("approximate trim should keep partial node, removed %d", removed)
+	}
+	// the second node contains entries 129-256, removing it makes length less than 800
+	if removed := s.TrimByLen(800, true, 0); removed != 28 {
+		t.Errorf("wrong approximate trim result %d", removed)
+	}
+	if removed := s.TrimByMinID(ID{Ms: 300}, false, 10); removed != 10 || s.FirstEntry().ID.Ms != 139 {
+		t.Errorf("wrong trim result %d", removed)
+	}
+	if removed := s.TrimByMinID(ID{Ms: 300}, false, 0); removed != 161 || s.FirstEntry().ID.Ms != 300 {
+		t.Errorf("wrong trim result %d", removed)
+	}
+	if removed := s.TrimByLen(0, false, 0); removed != 701 || s.Len() != 0 || s.MaxDeletedID() != (ID{Ms: 1000}) {
+		t.Errorf("wrong trim result %d", removed)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	s := makeStream(10)
+	group, ok := s.CreateGroup("g", ID{Ms: 2})
+	if !ok {
+		t.Fatal("create group failed")
+	}
+	if _, ok := s.CreateGroup("g", MinID); ok {
+		t.Error("group should exist")
+	}
+	now := time.Now()
+	alice, _ := group.CreateConsumer("alice", now)
+	bob, _ := group.CreateConsumer("bob", now)
+	for i := 3; i <= 6; i++ {
+		group.Deliver(ID{Ms: uint64(i)}, alice, now)
+	}
+	group.Deliver(ID{Ms: 7}, bob, now)
+	pending := group.Deliver(ID{Ms: 4}, bob, now)
+	if pending.DeliveryCount != 2 || alice.PendingCount() != 3 || bob.PendingCount() != 2 {
+		t.Error("wrong pending count")
+	}
+	if result := group.PendingRange(MinID, MaxID, 0, bob); len(result) != 2 || result[0].ID.Ms != 4 {
+		t.Error("wrong pending range")
+	}
+	if !group.Ack(ID{Ms: 3}) || group.Ack(ID{Ms: 3}) || group.PendingLen() != 4 {
+		t.Error("ack failed")
+	}
+	group.Claim(group.GetPending(ID{Ms: 5}), bob)
+	if alice.PendingCount() != 1 || bob.PendingCount() != 3 {
+		t.Error("claim failed")
+	}
+	if removed := group.DeleteConsumer("bob"); removed != 3 || group.PendingLen() != 1 {
+		t.Errorf("wrong removed pending count %d", removed)
+	}
+	if len(s.Groups()) != 1 || !s.DestroyGroup("g") || s.GetGroup("g") != nil {
+		t.Error("destroy group failed")
+	}
+}
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"bufio"
 	"errors"
 	"github.com/Allen9012/Godis/godis/parser"
 	"github.com/Allen9012/Godis/godis/protocol"
@@ -22,6 +23,7 @@ type Client struct {
 	waitingReqs chan *request // waiting response
 	ticker      *time.Ticker
 	addr        string
+	password    string // sends AUTH after connected if password is not empty
 	status      int32
 	working     *sync.WaitGroup // its counter presents unfinished requests(pending and waiting)
 }
@@ -48,12 +50,18 @@ const (
 
 // MakeClient creates a new client
 func MakeClient(addr string) (*Client, error) {
-	conn, err := net.Dial("tcp", addr)
+	return MakeClientWithPassword(addr, "")
+}
+
+// MakeClientWithPassword creates a new client which authenticates with password every time it connects to server
+func MakeClientWithPassword(addr string, password string) (*Client, error) {
+	conn, err := dial(addr, password)
 	if err != nil {
 		return nil, err
 	}
 	return &Client{
 		addr:        addr,
+		password:    password,
 		conn:        conn,
 		pendingReqs: make(chan *request, chanSize),
 		waitingReqs: make(chan *request, chanSize),
@@ -72,6 +80,10 @@ func (client *Client) Start() {
 
 // Close stops asynchronous goroutines and close connection
 func (client *Client) Close() {
+	// handleRead won't reconnect after closed, and Close may be called again after reconnect failed
+	if atomic.SwapInt32(&client.status, closed) == closed {
+		return
+	}
 	client.ticker.Stop()
 	// stop new request
 	close(client.pendingReqs)
@@ -91,7 +103,7 @@ func (client *Client) reconnect() {
 	var conn net.Conn
 	for i := 0; i < 3; i++ {
 		var err error
-		conn, err = net.Dial("tcp", client.addr)
+		conn, err = dial(client.addr, client.password)
 		if err != nil {
 			logger.Error("reconnect error: " + err.Error())
 			time.Sleep(time.Second)
@@ -116,6 +128,33 @@ func (client *Client) reconnect() {
 	go client.handleRead()
 }
 
+// dial connects to server and sends AUTH synchronously before any other request
+func dial(addr string, password string) (net.Conn, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if password == "" {
+		return conn, nil
+	}
+	authCmd := protocol.MakeMultiBulkReply([][]byte{[]byte("AUTH"), []byte(password)})
+	if _, err = conn.Write(authCmd.ToBytes()); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	// server replies a single line for AUTH, and sends nothing else before next request
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if line != "+OK\r\n" {
+		_ = conn.Close()
+		return nil, errors.New("auth failed: " + strings.TrimSpace(line))
+	}
+	return conn, nil
+}
+
 func (client *Client) heartbeat() {
 	for range client.ticker.C {
 		client.doHeartbeat()
@@ -35,6 +35,8 @@ type Connection struct {
 
 	// subscribing channels
 	subs map[string]bool
+	// subscribing patterns
+	psubs map[string]bool
 
 	// password may be changed by CONFIG command during runtime, so store the password
 	password string
@@ -46,6 +48,9 @@ type Connection struct {
 
 	// selected db
 	selectedDB int
+
+	// name set by CLIENT SETNAME
+	name string
 }
 
 var connPool = sync.Pool{
@@ -68,23 +73,46 @@ func NewConn(conn net.Conn) *Connection {
 }
 
 func (c *Connection) RemoteAddr() string {
+	// connection used for loading aof has no net.Conn
+	if c.conn == nil {
+		return ""
+	}
 	return c.conn.RemoteAddr().String()
 }
 
+// SetName sets the name of connection
+func (c *Connection) SetName(name string) {
+	c.name = name
+}
+
+// GetName returns the name of connection
+func (c *Connection) GetName() string {
+	return c.name
+}
+
 func (c *Connection) Close() error {
 	// 等待通信结束之后关闭，目的是防止还在传输数据
 	c.sendingData.WaitWithTimeout(10 * time.Second)
 	_ = c.conn.Close()
 	c.subs = nil
+	c.psubs = nil
 	c.password = ""
 	c.queue = nil
 	c.watching = nil
 	c.txErrors = nil
+	c.flags = 0
 	c.selectedDB = 0
+	c.name = ""
 	connPool.Put(c)
 	return nil
 }
 
+// Disconnect closes the tcp connection without resetting the client,
+// Close is still called by the goroutine reading it, so the client won't be put back into pool twice
+func (c *Connection) Disconnect() error {
+	return c.conn.Close()
+}
+
 // Write sends response to client over tcp connection
 //
 //	@Description: 给用户写数据
@@ -110,3 +138,180 @@ func (c *Connection) GetDBIndex() int {
 func (c *Connection) SelectDB(i int) {
 	c.selectedDB = i
 }
+
+/* ---- PubSub ---- */
+
+// Subscribe add current connection into subscribers of the given channel
+func (c *Connection) Subscribe(channel string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.subs == nil {
+		c.subs = make(map[string]bool)
+	}
+	c.subs[channel] = true
+}
+
+// UnSubscribe removes current connection into subscribers of the given channel
+func (c *Connection) UnSubscribe(channel string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.subs) == 0 {
+		return
+	}
+	delete(c.subs, channel)
+}
+
+// PSubscribe add current connection into subscribers of the given pattern
+func (c *Connection) PSubscribe(pattern string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.psubs == nil {
+		c.psubs = make(map[string]bool)
+	}
+	c.psubs[pattern] = true
+}
+
+// PUnSubscribe removes current connection into subscribers of the given pattern
+func (c *Connection) PUnSubscribe(pattern string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.psubs) == 0 {
+		return
+	}
+	delete(c.psubs, pattern)
+}
+
+// SubsCount returns the number of subscribing channels and patterns
+func (c *Connection) SubsCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.subs) + len(c.psubs)
+}
+
+// GetChannels returns all subscribing channels
+func (c *Connection) GetChannels() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.subs == nil {
+		return make([]string, 0)
+	}
+	channels := make([]string, len(c.subs))
+	i := 0
+	for channel := range c.subs {
+		channels[i] = channel
+		i++
+	}
+	return channels
+}
+
+// GetPatterns returns all subscribing patterns
+func (c *Connection) GetPatterns() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.psubs == nil {
+		return make([]string, 0)
+	}
+	patterns := make([]string, len(c.psubs))
+	i := 0
+	for pattern := range c.psubs {
+		patterns[i] = pattern
+		i++
+	}
+	return patterns
+}
+
+/* ---- Multi ---- */
+
+// InMultiState tells is connection in an uncommitted transaction
+func (c *Connection) InMultiState() bool {
+	return c.flags&flagMulti > 0
+}
+
+// SetMultiState sets transaction flag
+func (c *Connection) SetMultiState(state bool) {
+	if !state { // reset data when cancel multi
+		c.watching = nil
+		c.queue = nil
+		c.txErrors = nil
+		c.flags &= ^flagMulti // clean multi flag
+		return
+	}
+	c.flags |= flagMulti
+}
+
+// GetQueuedCmdLine returns queued commands of transaction
+func (c *Connection) GetQueuedCmdLine() [][][]byte {
+	return c.queue
+}
+
+// EnqueueCmd  enqueues command of current transaction
+func (c *Connection) EnqueueCmd(cmdLine [][]byte) {
+	c.queue = append(c.queue, cmdLine)
+}
+
+// AddTxError stores syntax error within transaction
+func (c *Connection) AddTxError(err error) {
+	c.txErrors = append(c.txErrors, err)
+}
+
+// GetTxErrors returns syntax error within transaction
+func (c *Connection) GetTxErrors() []error {
+	return c.txErrors
+}
+
+// ClearQueuedCmds clears queued commands of current transaction
+func (c *Connection) ClearQueuedCmds() {
+	c.queue = nil
+}
+
+// GetWatching returns watching keys and their version code when started watching
+func (c *Connection) GetWatching() map[string]uint32 {
+	if c.watching == nil {
+		c.watching = make(map[string]uint32)
+	}
+	return c.watching
+}
+
+// ClearWatching forgets all watching keys
+func (c *Connection) ClearWatching() {
+	c.watching = nil
+}
+
+// SetPassword stores password for authentication
+func (c *Connection) SetPassword(password string) {
+	c.password = password
+}
+
+// GetPassword get password for authentication
+func (c *Connection) GetPassword() string {
+	return c.password
+}
+
+/* ---- Replication ---- */
+
+// SetSlave marks this connection as the link with a slave
+func (c *Connection) SetSlave() {
+	c.flags |= flagSlave
+}
+
+// IsSlave returns whether this connection is the link with a slave
+func (c *Connection) IsSlave() bool {
+	return c.flags&flagSlave > 0
+}
+
+// SetMaster marks this connection as the link with master
+func (c *Connection) SetMaster() {
+	c.flags |= flagMaster
+}
+
+// IsMaster returns whether this connection is the link with master
+func (c *Connection) IsMaster() bool {
+	return c.flags&flagMaster > 0
+}
@@ -57,6 +57,7 @@ func (c *FakeConn) notify() {
 func (c *FakeConn) wait(offset int) {
 	c.mu.Lock()
 	if c.offset != offset { // new data during waiting lock
+		c.mu.Unlock()
 		return
 	}
 	if c.waitOn == nil {
@@ -102,9 +103,11 @@ func (c *FakeConn) Clean() {
 	c.offset = 0
 }
 
-// Bytes returns written data
+// Bytes returns a copy of written data, it is safe to call while other goroutines are writing
 func (c *FakeConn) Bytes() []byte {
-	return c.buf
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]byte(nil), c.buf...)
 }
 
 func (c *FakeConn) Close() error {
@@ -113,6 +116,11 @@ func (c *FakeConn) Close() error {
 	return nil
 }
 
+// Disconnect closes the fake connection like Close
+func (c *FakeConn) Disconnect() error {
+	return c.Close()
+}
+
 func (c *FakeConn) RemoteAddr() string {
 	return ""
 }
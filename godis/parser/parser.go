@@ -123,15 +123,15 @@ func parse0(rawReader io.Reader, ch chan<- *PayLoad) {
 			case '+': // status reply
 				content := strings.TrimSuffix(string(line[1:]), "\r\n")
 				ch <- &PayLoad{Data: protocol.MakeStatusReply(content)}
-				// TODO RDB action
-				//if strings.HasPrefix(content, "FULLRESYNC") {
-				//	err = parseRDBBulkString(reader, ch)
-				//	if err != nil {
-				//		ch <- &Payload{Err: err}
-				//		close(ch)
-				//		return
-				//	}
-				//}
+				// 全量同步时主节点紧接着发送 rdb 文件
+				if strings.HasPrefix(content, "FULLRESYNC") {
+					err = parseRDBBulkString(bufReader, ch)
+					if err != nil {
+						ch <- &PayLoad{Err: err}
+						close(ch)
+						return
+					}
+				}
 				continue
 			case '-': // error reply
 				content := strings.TrimSuffix(string(line[1:]), "\r\n")
@@ -341,24 +341,27 @@ func protocolError(msg string) error {
 	return errors.New("protocol error: " + msg)
 }
 
-//// there is no CRLF between RDB and following AOF, therefore it needs to be treated differently
-//func parseRDBBulkString(reader *bufio.Reader, ch chan<- *Payload) error {
-//	header, err := reader.ReadBytes('\n')
-//	header = bytes.TrimSuffix(header, []byte{'\r', '\n'})
-//	if len(header) == 0 {
-//		return protocolError("empty header")
-//	}
-//	strLen, err := strconv.ParseInt(string(header[1:]), 10, 64)
-//	if err != nil || strLen <= 0 {
-//		return protocolError("illegal bulk header: " + string(header))
-//	}
-//	body := make([]byte, strLen)
-//	_, err = io.ReadFull(reader, body)
-//	if err != nil {
-//		return err
-//	}
-//	ch <- &Payload{
-//		Data: protocol.MakeBulkReply(body[:len(body)]),
-//	}
-//	return nil
-//}
+// there is no CRLF between RDB and following AOF, therefore it needs to be treated differently
+func parseRDBBulkString(reader *bufio.Reader, ch chan<- *PayLoad) error {
+	header, err := reader.ReadBytes('\n')
+	if err != nil {
+		return err
+	}
+	header = bytes.TrimSuffix(header, []byte{'\r', '\n'})
+	if len(header) == 0 {
+		return protocolError("empty header")
+	}
+	strLen, err := strconv.ParseInt(string(header[1:]), 10, 64)
+	if err != nil || strLen <= 0 {
+		return protocolError("illegal bulk header: " + string(header))
+	}
+	body := make([]byte, strLen)
+	_, err = io.ReadFull(reader, body)
+	if err != nil {
+		return err
+	}
+	ch <- &PayLoad{
+		Data: protocol.MakeBulkReply(body),
+	}
+	return nil
+}
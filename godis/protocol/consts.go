@@ -48,6 +48,21 @@ func MakeNullBulkReply() *NullBulkReply {
 	return &NullBulkReply{}
 }
 
+var emptyBulkBytes = []byte("$0\r\n\r\n")
+
+// EmptyBulkReply is an empty string, BulkReply with empty arg is encoded as null bulk
+type EmptyBulkReply struct{}
+
+// ToBytes marshal redis.Reply
+func (r *EmptyBulkReply) ToBytes() []byte {
+	return emptyBulkBytes
+}
+
+// MakeEmptyBulkReply creates a new EmptyBulkReply
+func MakeEmptyBulkReply() *EmptyBulkReply {
+	return &EmptyBulkReply{}
+}
+
 var emptyMultiBulkBytes = []byte("*0\r\n")
 
 // EmptyMultiBulkReply is a empty list
@@ -62,6 +77,37 @@ func MakeEmptyMultiBulkReply() *EmptyMultiBulkReply {
 	return &EmptyMultiBulkReply{}
 }
 
+var nullMultiBulkBytes = []byte("*-1\r\n")
+
+// NullMultiBulkReply is a nil list, e.g. EXEC aborted by WATCH
+type NullMultiBulkReply struct{}
+
+// ToBytes marshal redis.Reply
+func (r *NullMultiBulkReply) ToBytes() []byte {
+	return nullMultiBulkBytes
+}
+
+func MakeNullMultiBulkReply() *NullMultiBulkReply {
+	return &NullMultiBulkReply{}
+}
+
+// QueuedReply is +QUEUED
+type QueuedReply struct{}
+
+var queuedBytes = []byte("+QUEUED\r\n")
+
+// ToBytes marshal redis.Reply
+func (r *QueuedReply) ToBytes() []byte {
+	return queuedBytes
+}
+
+var theQueuedReply = new(QueuedReply)
+
+// MakeQueuedReply returns a QUEUED protocol
+func MakeQueuedReply() *QueuedReply {
+	return theQueuedReply
+}
+
 // NoReply respond nothing, for commands like subscribe
 type NoReply struct{}
 
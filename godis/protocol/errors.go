@@ -1,5 +1,7 @@
 package protocol
 
+import "strconv"
+
 // 常见错误回复
 
 // UnknownErrReply 未知错误回复
@@ -94,3 +96,49 @@ func (r *ProtocolErrReply) ToBytes() []byte {
 func (r *ProtocolErrReply) Error() string {
 	return "ERR Protocol error: '" + r.Msg + "' command"
 }
+
+// MovedErrReply redirects client to the node serving the slot in cluster mode
+type MovedErrReply struct {
+	Slot uint32
+	Addr string
+}
+
+// ToBytes marshals redis.Reply	-MOVED 3999 127.0.0.1:6381\r\n
+func (r *MovedErrReply) ToBytes() []byte {
+	return []byte("-" + r.Error() + CRLF)
+}
+
+func (r *MovedErrReply) Error() string {
+	return "MOVED " + strconv.FormatUint(uint64(r.Slot), 10) + " " + r.Addr
+}
+
+// MakeMovedErrReply creates MovedErrReply
+func MakeMovedErrReply(slot uint32, addr string) *MovedErrReply {
+	return &MovedErrReply{
+		Slot: slot,
+		Addr: addr,
+	}
+}
+
+// AskErrReply redirects client to the node importing the slot for the next command only
+type AskErrReply struct {
+	Slot uint32
+	Addr string
+}
+
+// ToBytes marshals redis.Reply	-ASK 3999 127.0.0.1:6381\r\n
+func (r *AskErrReply) ToBytes() []byte {
+	return []byte("-" + r.Error() + CRLF)
+}
+
+func (r *AskErrReply) Error() string {
+	return "ASK " + strconv.FormatUint(uint64(r.Slot), 10) + " " + r.Addr
+}
+
+// MakeAskErrReply creates AskErrReply
+func MakeAskErrReply(slot uint32, addr string) *AskErrReply {
+	return &AskErrReply{
+		Slot: slot,
+		Addr: addr,
+	}
+}
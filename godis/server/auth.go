@@ -0,0 +1,63 @@
+package server
+
+import (
+	"github.com/Allen9012/Godis/config"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/interface/godis"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/5
+  @desc: AUTH 认证, 配置 requirepass 后未认证的连接只能执行 AUTH PING QUIT
+  @modified by:
+**/
+
+// defaultUser is the only user before ACL is supported
+const defaultUser = "default"
+
+// execAuth
+//
+//	@Description: 校验密码, 通过后记录在连接上
+//	@param c
+//	@param args	eg: auth password | auth default password
+//	@return godis.Reply
+func execAuth(c godis.Connection, args [][]byte) godis.Reply {
+	if len(args) != 1 && len(args) != 2 {
+		return protocol.MakeArgNumErrReply("auth")
+	}
+	requirePass := config.Get(&config.Properties.RequirePass)
+	if requirePass == "" {
+		return protocol.MakeErrReply("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+	}
+	username := defaultUser
+	password := string(args[len(args)-1])
+	if len(args) == 2 {
+		username = string(args[0])
+	}
+	if username != defaultUser || password != requirePass {
+		return protocol.MakeErrReply("WRONGPASS invalid username-password pair or user is disabled.")
+	}
+	c.SetPassword(password)
+	return protocol.MakeOkReply()
+}
+
+// isAuthenticated returns whether the connection is allowed to execute commands
+// requirepass may be changed during runtime, so compare with the current config
+func isAuthenticated(c godis.Connection) bool {
+	requirePass := config.Get(&config.Properties.RequirePass)
+	if requirePass == "" {
+		return true
+	}
+	return c.GetPassword() == requirePass
+}
+
+// isNoAuthCommand returns whether the command can be executed before authentication
+func isNoAuthCommand(cmdName string) bool {
+	switch cmdName {
+	case "auth", "ping", "quit":
+		return true
+	}
+	return false
+}
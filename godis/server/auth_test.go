@@ -0,0 +1,80 @@
+package server
+
+import (
+	"bufio"
+	"github.com/Allen9012/Godis/config"
+	"github.com/Allen9012/Godis/godis/client"
+	"github.com/Allen9012/Godis/godis/protocol/asserts"
+	"github.com/Allen9012/Godis/lib/utils"
+	"github.com/Allen9012/Godis/tcp"
+	"net"
+	"testing"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/5
+  @desc:
+  @modified by:
+**/
+
+func TestAuth(t *testing.T) {
+	appendOnly := config.Properties.AppendOnly
+	config.Properties.AppendOnly = false
+	config.Properties.RequirePass = "secret"
+	defer func() {
+		config.Properties.AppendOnly = appendOnly
+		config.Properties.RequirePass = ""
+	}()
+	closeChan := make(chan struct{})
+	defer close(closeChan)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	go tcp.ListenAndServe(listener, MakeHandler(), closeChan)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	reader := bufio.NewReader(conn)
+	request := func(cmd string, expected string) {
+		if _, err := conn.Write([]byte(cmd + "\r\n")); err != nil {
+			t.Fatal(err)
+		}
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != expected+"\r\n" {
+			t.Errorf("%s: expect %s, actual %s", cmd, expected, line)
+		}
+	}
+	request("SET k v", "-NOAUTH Authentication required.")
+	request("PING", "+PONG")
+	request("AUTH wrong", "-WRONGPASS invalid username-password pair or user is disabled.")
+	request("AUTH someone secret", "-WRONGPASS invalid username-password pair or user is disabled.")
+	request("AUTH secret", "+OK")
+	request("SET k v", "+OK")
+	request("AUTH default secret", "+OK")
+	request("QUIT", "+OK")
+
+	_, err = client.MakeClientWithPassword(addr, "wrong")
+	if err == nil {
+		t.Error("expect auth failed")
+	}
+	c, err := client.MakeClientWithPassword(addr, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Start()
+	defer c.Close()
+	result := c.Send(utils.ToCmdLine("GET", "k"))
+	asserts.AssertBulkReply(t, result, "v")
+}
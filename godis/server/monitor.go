@@ -0,0 +1,230 @@
+package server
+
+import (
+	"bytes"
+	"github.com/Allen9012/Godis/godis/connection"
+	"github.com/Allen9012/Godis/lib/logger"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/19
+  @desc: MONITOR 把服务器处理的每条命令发送给监视者, 格式与 redis 相同
+	eg: +1697700000.123456 [0 127.0.0.1:52100] "set" "key" "value"
+	每个监视者有独立的缓冲队列和写协程, 队列满时断开监视者, 不会阻塞处理命令的协程
+  @modified by:
+**/
+
+// monitorQueueSize is the max number of lines waiting to be sent to a monitor
+const monitorQueueSize = 1024
+
+// redactedCommands are commands whose arguments are hidden from monitors
+var redactedCommands = map[string]struct{}{
+	"auth": {},
+}
+
+// skippedCommands are administrative commands never sent to monitors like CMD_ADMIN of redis,
+// arguments of them may be secrets, eg: CONFIG SET requirepass
+var skippedCommands = map[string]struct{}{
+	"monitor":      {},
+	"config":       {},
+	"slaveof":      {},
+	"replicaof":    {},
+	"sync":         {},
+	"psync":        {},
+	"replconf":     {},
+	"debug":        {},
+	"save":         {},
+	"bgsave":       {},
+	"bgrewriteaof": {},
+	"shutdown":     {},
+	"slowlog":      {},
+	"latency":      {},
+}
+
+// monitor is a connection watching all commands
+type monitor struct {
+	client *connection.Connection
+	// conn is closed to disconnect the monitor when it is too slow
+	conn  net.Conn
+	queue chan []byte
+	// stopped is closed when the monitor is removed or too slow
+	stopped  chan struct{}
+	stopOnce sync.Once
+	// writerDone is closed after writer goroutine exited
+	writerDone chan struct{}
+}
+
+// monitorHub holds all monitors
+type monitorHub struct {
+	mu       sync.RWMutex
+	monitors map[*connection.Connection]*monitor
+	// count is the number of monitors, checked without lock before formatting lines
+	count int32
+}
+
+func makeMonitorHub() *monitorHub {
+	return &monitorHub{
+		monitors: make(map[*connection.Connection]*monitor),
+	}
+}
+
+// add makes client a monitor, it is a no-op if client is already a monitor
+func (hub *monitorHub) add(client *connection.Connection, conn net.Conn) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if _, ok := hub.monitors[client]; ok {
+		return
+	}
+	m := &monitor{
+		client:     client,
+		conn:       conn,
+		queue:      make(chan []byte, monitorQueueSize),
+		stopped:    make(chan struct{}),
+		writerDone: make(chan struct{}),
+	}
+	hub.monitors[client] = m
+	atomic.AddInt32(&hub.count, 1)
+	go m.write()
+}
+
+// remove stops sending commands to client and waits for its writer goroutine exited,
+// invoker must call it before the connection is closed and put back into pool
+func (hub *monitorHub) remove(client *connection.Connection) {
+	hub.mu.Lock()
+	m, ok := hub.monitors[client]
+	if ok {
+		delete(hub.monitors, client)
+		atomic.AddInt32(&hub.count, -1)
+	}
+	hub.mu.Unlock()
+	if ok {
+		m.stop()
+		<-m.writerDone
+	}
+}
+
+// feed sends command to all monitors, administrative commands are skipped
+//
+//	@Description: 命令行在这里格式化, 写入由每个监视者自己的协程完成
+//	@receiver hub
+//	@param client	发送命令的客户端
+//	@param cmdLine
+func (hub *monitorHub) feed(client *connection.Connection, cmdLine [][]byte) {
+	if atomic.LoadInt32(&hub.count) == 0 {
+		return
+	}
+	if _, skipped := skippedCommands[string(bytes.ToLower(cmdLine[0]))]; skipped {
+		return
+	}
+	line := formatMonitorLine(time.Now(), client.GetDBIndex(), client.RemoteAddr(), cmdLine)
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	for _, m := range hub.monitors {
+		select {
+		case <-m.stopped:
+			// 已断开的监视者等待读协程移除
+			continue
+		default:
+		}
+		select {
+		case m.queue <- line:
+		default:
+			// 与 redis 超过输出缓冲区限制一样断开连接, 连接的读协程会发现连接关闭并清理监视者
+			logger.Warn("monitor is too slow, disconnect: " + m.client.RemoteAddr())
+			m.stop()
+		}
+	}
+}
+
+// stop closes the connection of monitor and makes writer goroutine exit
+//
+//	@Description: queue 不会被关闭, 因为其他协程可能正在持有读锁向 queue 发送
+//	@receiver m
+func (m *monitor) stop() {
+	m.stopOnce.Do(func() {
+		close(m.stopped)
+		_ = m.conn.Close()
+	})
+}
+
+// write sends lines in queue to monitor until stopped
+func (m *monitor) write() {
+	defer close(m.writerDone)
+	for {
+		select {
+		case line := <-m.queue:
+			// 写入失败说明连接已断开, 读协程会发现并移除监视者
+			_, _ = m.client.Write(line)
+		case <-m.stopped:
+			return
+		}
+	}
+}
+
+// formatMonitorLine formats command as status reply, eg: +1697700000.123456 [0 127.0.0.1:52100] "get" "key"
+func formatMonitorLine(now time.Time, dbIndex int, addr string, cmdLine [][]byte) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('+')
+	buf.WriteString(strconv.FormatInt(now.Unix(), 10))
+	buf.WriteByte('.')
+	micro := strconv.Itoa(now.Nanosecond() / 1000)
+	for i := len(micro); i < 6; i++ {
+		buf.WriteByte('0')
+	}
+	buf.WriteString(micro)
+	buf.WriteString(" [")
+	buf.WriteString(strconv.Itoa(dbIndex))
+	buf.WriteByte(' ')
+	buf.WriteString(addr)
+	buf.WriteByte(']')
+	_, redacted := redactedCommands[string(bytes.ToLower(cmdLine[0]))]
+	for i, arg := range cmdLine {
+		buf.WriteByte(' ')
+		if redacted && i > 0 {
+			buf.WriteString(`"(redacted)"`)
+			continue
+		}
+		writeQuoted(buf, arg)
+	}
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
+
+// writeQuoted writes arg as a quoted string escaping special characters like sdscatrepr of redis
+func writeQuoted(buf *bytes.Buffer, arg []byte) {
+	const hex = "0123456789abcdef"
+	buf.WriteByte('"')
+	for _, b := range arg {
+		switch b {
+		case '\\', '"':
+			buf.WriteByte('\\')
+			buf.WriteByte(b)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\a':
+			buf.WriteString(`\a`)
+		case '\b':
+			buf.WriteString(`\b`)
+		default:
+			if b < ' ' || b > '~' {
+				buf.WriteString(`\x`)
+				buf.WriteByte(hex[b>>4])
+				buf.WriteByte(hex[b&0xf])
+			} else {
+				buf.WriteByte(b)
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
@@ -0,0 +1,129 @@
+package server
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/19
+  @desc: monitor
+  @modified by:
+**/
+
+import (
+	"bufio"
+	"github.com/Allen9012/Godis/config"
+	"github.com/Allen9012/Godis/godis/connection"
+	"github.com/Allen9012/Godis/lib/utils"
+	"github.com/Allen9012/Godis/tcp"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatMonitorLine(t *testing.T) {
+	now := time.Unix(1697700000, 1000)
+	line := formatMonitorLine(now, 2, "127.0.0.1:52100", utils.ToCmdLine("set", "k", "a \"b\"\r\n\x01"))
+	expected := "+1697700000.000001 [2 127.0.0.1:52100] \"set\" \"k\" \"a \\\"b\\\"\\r\\n\\x01\"\r\n"
+	if string(line) != expected {
+		t.Errorf("expect %s, actual %s", expected, string(line))
+	}
+	line = formatMonitorLine(now, 0, "127.0.0.1:52100", utils.ToCmdLine("AUTH", "default", "secret"))
+	if strings.Contains(string(line), "secret") || !strings.Contains(string(line), `"AUTH" "(redacted)" "(redacted)"`) {
+		t.Errorf("auth should be redacted, actual %s", string(line))
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	appendOnly := config.Properties.AppendOnly
+	config.Properties.AppendOnly = false
+	defer func() {
+		config.Properties.AppendOnly = appendOnly
+		_ = config.SetProperty("requirepass", "")
+	}()
+	closeChan := make(chan struct{})
+	defer close(closeChan)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	go tcp.ListenAndServe(listener, MakeHandler(), closeChan)
+
+	monitorConn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = monitorConn.Close()
+	}()
+	monitorReader := bufio.NewReader(monitorConn)
+	_, _ = monitorConn.Write([]byte("MONITOR\r\n"))
+	if line, _ := monitorReader.ReadString('\n'); line != "+OK\r\n" {
+		t.Fatalf("expect OK, actual %s", line)
+	}
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	reader := bufio.NewReader(conn)
+	// CONFIG is not sent to monitors, otherwise the password is leaked
+	_, _ = conn.Write([]byte("SELECT 1\r\nSET k v\r\nCONFIG SET requirepass secret\r\nAUTH secret\r\n" +
+		"*4\r\n$6\r\nCONFIG\r\n$3\r\nSET\r\n$11\r\nrequirepass\r\n$0\r\n\r\nGET k\r\n"))
+	for i := 0; i < 7; i++ {
+		_, _ = reader.ReadString('\n')
+	}
+	localAddr := regexp.QuoteMeta(conn.LocalAddr().String())
+	patterns := []string{
+		`^\+\d+\.\d{6} \[0 ` + localAddr + `\] "SELECT" "1"\r\n$`,
+		`^\+\d+\.\d{6} \[1 ` + localAddr + `\] "SET" "k" "v"\r\n$`,
+		`^\+\d+\.\d{6} \[1 ` + localAddr + `\] "AUTH" "\(redacted\)"\r\n$`,
+		`^\+\d+\.\d{6} \[1 ` + localAddr + `\] "GET" "k"\r\n$`,
+	}
+	_ = monitorConn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	for _, pattern := range patterns {
+		line, err := monitorReader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !regexp.MustCompile(pattern).MatchString(line) {
+			t.Errorf("expect %s, actual %s", pattern, line)
+		}
+	}
+}
+
+func TestSlowMonitor(t *testing.T) {
+	hub := makeMonitorHub()
+	serverSide, clientSide := net.Pipe()
+	defer func() {
+		_ = clientSide.Close()
+	}()
+	// nobody reads from clientSide, so writing to monitor blocks
+	monitorClient := connection.NewConn(serverSide)
+	hub.add(monitorClient, serverSide)
+	client := connection.NewConn(serverSide)
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < monitorQueueSize*2; i++ {
+			hub.feed(client, utils.ToCmdLine("get", "k"))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("feeding a slow monitor should not block")
+	}
+	// slow monitor is disconnected
+	if _, err := clientSide.Read(make([]byte, 1)); err == nil {
+		t.Error("slow monitor should be disconnected")
+	}
+	hub.remove(monitorClient)
+	if hub.count != 0 {
+		t.Errorf("expect no monitor, actual %d", hub.count)
+	}
+}
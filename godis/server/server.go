@@ -10,12 +10,14 @@ import (
 	"github.com/Allen9012/Godis/godis/parser"
 	"github.com/Allen9012/Godis/godis/protocol"
 	databaseface "github.com/Allen9012/Godis/interface/database"
+	"github.com/Allen9012/Godis/interface/godis"
 	"github.com/Allen9012/Godis/lib/logger"
 	"github.com/Allen9012/Godis/lib/sync/atomic"
 	"io"
 	"net"
 	"strings"
 	"sync"
+	"time"
 )
 
 /*
@@ -25,9 +27,11 @@ import (
 */
 
 type Handler struct {
-	activeConn sync.Map // *client -> placeholder
+	activeConn sync.Map // *client -> net.Conn
 	db         databaseface.DB
 	closing    atomic.Boolean // refusing new client and new request
+	// connections watching all commands by MONITOR
+	monitors *monitorHub
 }
 
 func MakeHandler() *Handler {
@@ -38,14 +42,17 @@ func MakeHandler() *Handler {
 		db = database.NewStandaloneServer()
 	}
 	return &Handler{
-		db: db,
+		db:       db,
+		monitors: makeMonitorHub(),
 	}
 }
 
 // 关闭一个客户端连接
 func (h *Handler) closeClient(client *connection.Connection) {
-	_ = client.Close()
+	// 先清理订阅等状态，Close会重置连接并放回连接池
+	h.monitors.remove(client)
 	h.db.AfterClientClose(client)
+	_ = client.Close()
 	// 删除map的内容
 	h.activeConn.Delete(client)
 }
@@ -62,21 +69,33 @@ func (h *Handler) Handle(ctx context.Context, conn net.Conn) {
 	}
 	// 获得一个conn
 	client := connection.NewConn(conn)
-	// todo 先写成空结构体，可以节约空间，后期有需求可以修改
-	h.activeConn.Store(client, struct{}{})
+	// 保存 net.Conn, 关闭服务时只关闭底层连接, 由 Handle 协程清理并回收 client
+	h.activeConn.Store(client, conn)
 	// parser开始工作
 	ch := parser.ParseStream(conn)
+	// payloads received while executing blocking command
+	var pending []*parser.PayLoad
 	// 不断解析ch，死循环
-	for payload := range ch {
+	for {
+		var payload *parser.PayLoad
+		if len(pending) > 0 {
+			payload, pending = pending[0], pending[1:]
+		} else {
+			var ok bool
+			payload, ok = <-ch
+			if !ok {
+				return
+			}
+		}
 		// 1. payload有错误
 		// 2. payload没有错误
 		if payload.Err != nil {
 			// 错误类型
-			if payload.Err == io.EOF || errors.Is(payload.Err, io.ErrUnexpectedEOF) ||
-				strings.Contains(payload.Err.Error(), "use of closed network connection") {
+			if isClosedErr(payload.Err) {
 				// 果断断开连接就可以
 				h.closeClient(client)
-				logger.Info("connection closed: " + client.RemoteAddr())
+				// client 已放回连接池, 不能再使用
+				logger.Info("connection closed: " + conn.RemoteAddr().String())
 				return
 			}
 			// protocol err
@@ -84,7 +103,7 @@ func (h *Handler) Handle(ctx context.Context, conn net.Conn) {
 			_, err := client.Write(errReply.ToBytes())
 			if err != nil {
 				h.closeClient(client)
-				logger.Info("connection closed: " + client.RemoteAddr())
+				logger.Info("connection closed: " + conn.RemoteAddr().String())
 				return
 			}
 			continue
@@ -100,7 +119,47 @@ func (h *Handler) Handle(ctx context.Context, conn net.Conn) {
 			logger.Error("require multi bulk reply")
 			continue
 		}
-		result := h.db.Exec(client, multiBulkReply.Args)
+		if len(multiBulkReply.Args) == 0 {
+			continue
+		}
+		cmdName := strings.ToLower(string(multiBulkReply.Args[0]))
+		// 未认证的连接只能执行 AUTH PING QUIT
+		if !isNoAuthCommand(cmdName) && !isAuthenticated(client) {
+			_, _ = client.Write(protocol.MakeErrReply("NOAUTH Authentication required.").ToBytes())
+			continue
+		}
+		h.monitors.feed(client, multiBulkReply.Args)
+		if cmdName == "auth" {
+			_, _ = client.Write(execAuth(client, multiBulkReply.Args[1:]).ToBytes())
+			continue
+		} else if cmdName == "monitor" {
+			if len(multiBulkReply.Args) != 1 {
+				_, _ = client.Write(protocol.MakeArgNumErrReply(cmdName).ToBytes())
+				continue
+			}
+			// 先回复 OK, 之后的命令才会发送给监视者
+			_, _ = client.Write(protocol.MakeOkReply().ToBytes())
+			h.monitors.add(client, conn)
+			continue
+		} else if cmdName == "quit" {
+			_, _ = client.Write(protocol.MakeOkReply().ToBytes())
+			h.closeClient(client)
+			logger.Info("connection closed: " + conn.RemoteAddr().String())
+			return
+		}
+		var result godis.Reply
+		if database.IsBlockingCommand(cmdName) {
+			var received []*parser.PayLoad
+			var closed bool
+			result, received, closed = h.execBlocking(client, ch, multiBulkReply.Args)
+			pending = append(pending, received...)
+			if closed {
+				logger.Info("connection closed: " + conn.RemoteAddr().String())
+				return
+			}
+		} else {
+			result = h.db.Exec(client, multiBulkReply.Args)
+		}
 		if result != nil {
 			_, _ = client.Write(result.ToBytes())
 		} else {
@@ -110,15 +169,58 @@ func (h *Handler) Handle(ctx context.Context, conn net.Conn) {
 	}
 }
 
+// execBlocking executes command which may block in another goroutine, so that disconnection can be detected while blocking.
+// It returns the result, payloads received during blocking and whether the connection is closed
+func (h *Handler) execBlocking(client *connection.Connection, ch <-chan *parser.PayLoad, cmdLine [][]byte) (godis.Reply, []*parser.PayLoad, bool) {
+	done := make(chan godis.Reply, 1)
+	go func() {
+		done <- h.db.Exec(client, cmdLine)
+	}()
+	var pending []*parser.PayLoad
+	for {
+		select {
+		case result := <-done:
+			return result, pending, false
+		case payload, ok := <-ch:
+			if ok && (payload.Err == nil || !isClosedErr(payload.Err)) {
+				// commands sent during blocking are executed after it returns
+				pending = append(pending, payload)
+				continue
+			}
+			// release the blocked command before closing connection, it may not be blocked yet so retry until it returns
+			h.db.AfterClientClose(client)
+			ticker := time.NewTicker(100 * time.Millisecond)
+			for waiting := true; waiting; {
+				select {
+				case <-done:
+					waiting = false
+				case <-ticker.C:
+					h.db.AfterClientClose(client)
+				}
+			}
+			ticker.Stop()
+			h.closeClient(client)
+			return nil, nil, true
+		}
+	}
+}
+
+// isClosedErr returns whether the error means the connection has been closed
+func isClosedErr(err error) bool {
+	return err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) ||
+		strings.Contains(err.Error(), "use of closed network connection")
+}
+
 // Close 关闭所有连接
 func (h *Handler) Close() error {
 	logger.Info("server shutting down")
 	h.closing.Set(true)
 	// 遍历和关闭
+	// client.Close 会把连接放回连接池, 在这里调用会与 Handle 协程的 closeClient 重复回收,
+	// 监视者的写协程也可能还在使用 client
 	h.activeConn.Range(
 		func(key, value any) bool {
-			client := key.(*connection.Connection)
-			_ = client.Close()
+			_ = value.(net.Conn).Close()
 			return true
 		},
 	)
@@ -2,6 +2,7 @@ package server
 
 import (
 	"bufio"
+	"github.com/Allen9012/Godis/config"
 	"github.com/Allen9012/Godis/tcp"
 	"net"
 	"testing"
@@ -50,3 +51,65 @@ func TestListenAndServe(t *testing.T) {
 	closeChan <- struct{}{}
 	time.Sleep(time.Second)
 }
+
+func TestBlockingCommand(t *testing.T) {
+	appendOnly := config.Properties.AppendOnly
+	config.Properties.AppendOnly = false
+	defer func() {
+		config.Properties.AppendOnly = appendOnly
+	}()
+	closeChan := make(chan struct{})
+	defer close(closeChan)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	go tcp.ListenAndServe(listener, MakeHandler(), closeChan)
+
+	dial := func() (net.Conn, *bufio.Reader) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn, bufio.NewReader(conn)
+	}
+	readLines := func(reader *bufio.Reader, expected ...string) {
+		for _, line := range expected {
+			actual, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if actual != line+"\r\n" {
+				t.Errorf("expect %s, actual %s", line, actual)
+			}
+		}
+	}
+	conn, reader := dial()
+	defer func() {
+		_ = conn.Close()
+	}()
+	_, _ = conn.Write([]byte("DEL blocking-list\r\n"))
+	readLines(reader, ":0")
+
+	// a client closed while blocking must not consume data
+	closedConn, _ := dial()
+	_, _ = closedConn.Write([]byte("BLPOP blocking-list 0\r\n"))
+	time.Sleep(200 * time.Millisecond)
+	_ = closedConn.Close()
+	time.Sleep(200 * time.Millisecond)
+	_, _ = conn.Write([]byte("RPUSH blocking-list a\r\nLLEN blocking-list\r\n"))
+	readLines(reader, ":1", ":1")
+
+	// commands sent while blocking are executed after blocking command returns
+	blockedConn, blockedReader := dial()
+	defer func() {
+		_ = blockedConn.Close()
+	}()
+	_, _ = blockedConn.Write([]byte("BRPOP blocking-list other-list 0\r\nBLPOP other-list 0\r\nPING\r\n"))
+	readLines(blockedReader, "*2", "$13", "blocking-list", "$1", "a")
+	time.Sleep(200 * time.Millisecond)
+	_, _ = conn.Write([]byte("LPUSH other-list b\r\n"))
+	readLines(reader, ":1")
+	readLines(blockedReader, "*2", "$10", "other-list", "$1", "b", "+PONG")
+}
@@ -7,6 +7,7 @@ package database
 */
 import (
 	"github.com/Allen9012/Godis/interface/godis"
+	"github.com/Allen9012/Godis/lib/rdb"
 	"time"
 )
 
@@ -17,14 +18,14 @@ type DB interface {
 	Exec(client godis.Connection, args [][]byte) godis.Reply //执行操作，回复响应
 	Close()                                                  //关闭
 	AfterClientClose(c godis.Connection)                     //删除后数据清理
-	//LoadRDB(dec *core.Decoder) error
+	LoadRDB(dec *rdb.Decoder) error                          //加载rdb快照
 }
 
 // DBEngine is the embedding storage engine exposing more methods for complex application
 type DBEngine interface {
 	DB
 	ExecWithLock(conn godis.Connection, cmdLine [][]byte) godis.Reply
-	// ExecMulti(conn godis.Connection, watching map[string]uint32, cmdLines []CmdLine) godis.Reply
+	ExecMulti(conn godis.Connection, watching map[string]uint32, cmdLines []CmdLine) godis.Reply
 	GetUndoLogs(dbIndex int, cmdLine [][]byte) []CmdLine
 	ForEach(dbIndex int, cb func(key string, data *DataEntity, expiration *time.Time) bool)
 	RWLocks(dbIndex int, writeKeys []string, readKeys []string)
@@ -32,10 +33,14 @@ type DBEngine interface {
 	GetDBSize(dbIndex int) (int, int)
 	GetEntity(dbIndex int, key string) (*DataEntity, bool)
 	GetExpiration(dbIndex int, key string) *time.Time
-	//SetKeyInsertedCallback(cb KeyEventCallback)
-	//SetKeyDeletedCallback(cb KeyEventCallback)
+	SetKeyInsertedCallback(cb KeyEventCallback)
+	SetKeyDeletedCallback(cb KeyEventCallback)
 }
 
+// KeyEventCallback will be called back on key event, such as key inserted or deleted
+// may be called concurrently
+type KeyEventCallback func(dbIndex int, key string, entity *DataEntity)
+
 type DataEntity struct {
 	Data interface{}
 }
@@ -7,33 +7,39 @@ type Connection interface {
 	GetDBIndex() int // 获取DB编号
 	SelectDB(int)    // 选择DB
 	Close() error
+	// Disconnect closes the underlying connection only, the handler of connection will notice it and call Close
+	Disconnect() error
 	RemoteAddr() string
-	// TODO password
-	//SetPassword(string)
-	//GetPassword() string
+	// used for `Client SetName` command
+	SetName(string)
+	GetName() string
+	// used for `Auth` command
+	SetPassword(string)
+	GetPassword() string
 
-	//// TODO pubsub
-	//// client should keep its subscribing channels
-	//Subscribe(channel string)
-	//UnSubscribe(channel string)
-	//SubsCount() int
-	//GetChannels() []string
-	//
-	//InMultiState() bool
-	//SetMultiState(bool)
-	//GetQueuedCmdLine() [][][]byte
-	//EnqueueCmd([][]byte)
-	//ClearQueuedCmds()
-	//GetWatching() map[string]uint32
-	//AddTxError(err error)
-	//GetTxErrors() []error
+	// client should keep its subscribing channels and patterns
+	Subscribe(channel string)
+	UnSubscribe(channel string)
+	PSubscribe(pattern string)
+	PUnSubscribe(pattern string)
+	SubsCount() int
+	GetChannels() []string
+	GetPatterns() []string
 
-	// TODO replicaof
-	//SetSlave()
-	//IsSlave() bool
-	//
-	//SetMaster()
-	//IsMaster() bool
-	//
-	//Name() string
+	// used for `Multi` command
+	InMultiState() bool
+	SetMultiState(bool)
+	GetQueuedCmdLine() [][][]byte
+	EnqueueCmd([][]byte)
+	ClearQueuedCmds()
+	GetWatching() map[string]uint32
+	ClearWatching()
+	AddTxError(err error)
+	GetTxErrors() []error
+
+	// used for replication
+	SetSlave()
+	IsSlave() bool
+	SetMaster()
+	IsMaster() bool
 }
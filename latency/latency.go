@@ -0,0 +1,198 @@
+package latency
+
+import (
+	"github.com/Allen9012/Godis/config"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/interface/godis"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/18
+  @desc: LATENCY LATEST | HISTORY | RESET
+	耗时超过 latency-monitor-threshold 毫秒的事件会被采样, 每个事件保留最近 160 个采样
+	同一秒内的多次采样只保留最大值, 与 redis 相同
+  @modified by:
+**/
+
+// events sampled by latency monitor
+const (
+	EventCommand          = "command"
+	EventAofFsyncAlways   = "aof-fsync-always"
+	EventAofFsyncEverySec = "aof-fsync-everysec"
+	EventAofRewrite       = "aof-rewrite"
+	EventExpireCycle      = "expire-cycle"
+	EventEvictionCycle    = "eviction-cycle"
+)
+
+// maxSamples is the number of samples kept for each event
+const maxSamples = 160
+
+type sample struct {
+	// unix seconds
+	time int64
+	// milliseconds
+	latency int64
+}
+
+// eventHistory holds the latest samples of an event in a ring
+type eventHistory struct {
+	samples [maxSamples]sample
+	// next is the index in samples to be written
+	next int
+	// max is the max latency of all samples since the last reset
+	max int64
+}
+
+func (history *eventHistory) latest() sample {
+	return history.samples[(history.next+maxSamples-1)%maxSamples]
+}
+
+// Monitor holds latency samples of all events
+type Monitor struct {
+	mu     sync.Mutex
+	events map[string]*eventHistory
+}
+
+// the latency monitor shared by the whole process, like redis
+var monitor = &Monitor{
+	events: make(map[string]*eventHistory),
+}
+
+// AddSampleIfNeeded records latency of event if it exceeds latency-monitor-threshold
+func AddSampleIfNeeded(event string, latency time.Duration) {
+	threshold := config.Get(&config.Properties.LatencyMonitorThreshold)
+	ms := latency.Milliseconds()
+	if threshold <= 0 || ms < int64(threshold) {
+		return
+	}
+	monitor.addSample(event, time.Now().Unix(), ms)
+}
+
+func (m *Monitor) addSample(event string, now int64, ms int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	history, ok := m.events[event]
+	if !ok {
+		history = &eventHistory{}
+		m.events[event] = history
+	}
+	if ms > history.max {
+		history.max = ms
+	}
+	// 同一秒内的采样合并
+	prev := &history.samples[(history.next+maxSamples-1)%maxSamples]
+	if prev.time == now {
+		if ms > prev.latency {
+			prev.latency = ms
+		}
+		return
+	}
+	history.samples[history.next] = sample{time: now, latency: ms}
+	history.next = (history.next + 1) % maxSamples
+}
+
+// sortedEvents returns names of all events in order, invoker should hold lock
+func (m *Monitor) sortedEvents() []string {
+	events := make([]string, 0, len(m.events))
+	for event := range m.events {
+		events = append(events, event)
+	}
+	sort.Strings(events)
+	return events
+}
+
+// reset removes samples of the given events, removes all events if no event given
+func (m *Monitor) reset(events []string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(events) == 0 {
+		n := len(m.events)
+		m.events = make(map[string]*eventHistory)
+		return n
+	}
+	n := 0
+	for _, event := range events {
+		if _, ok := m.events[event]; ok {
+			delete(m.events, event)
+			n++
+		}
+	}
+	return n
+}
+
+// Exec
+//
+//	@Description: LATENCY LATEST | LATENCY HISTORY event | LATENCY RESET [event ...]
+//	@param args
+//	@return godis.Reply
+func Exec(args [][]byte) godis.Reply {
+	if len(args) == 0 {
+		return protocol.MakeArgNumErrReply("latency")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "latest":
+		if len(args) != 1 {
+			return protocol.MakeArgNumErrReply("latency|latest")
+		}
+		return monitor.latestReply()
+	case "history":
+		if len(args) != 2 {
+			return protocol.MakeArgNumErrReply("latency|history")
+		}
+		return monitor.historyReply(strings.ToLower(string(args[1])))
+	case "reset":
+		events := make([]string, 0, len(args)-1)
+		for _, arg := range args[1:] {
+			events = append(events, strings.ToLower(string(arg)))
+		}
+		return protocol.MakeIntReply(int64(monitor.reset(events)))
+	}
+	return protocol.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try LATENCY HELP.")
+}
+
+// latestReply returns [event, time of latest sample, latest latency, max latency] of all events
+func (m *Monitor) latestReply() godis.Reply {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	replies := make([]godis.Reply, 0, len(m.events))
+	for _, event := range m.sortedEvents() {
+		history := m.events[event]
+		latest := history.latest()
+		replies = append(replies, protocol.MakeMultiRawReply([]godis.Reply{
+			protocol.MakeBulkReply([]byte(event)),
+			protocol.MakeIntReply(latest.time),
+			protocol.MakeIntReply(latest.latency),
+			protocol.MakeIntReply(history.max),
+		}))
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
+
+// historyReply returns [time, latency] of samples of event from oldest to newest
+func (m *Monitor) historyReply(event string) godis.Reply {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	history, ok := m.events[event]
+	if !ok {
+		return protocol.MakeEmptyMultiBulkReply()
+	}
+	var replies []godis.Reply
+	for i := 0; i < maxSamples; i++ {
+		s := history.samples[(history.next+i)%maxSamples]
+		if s.time == 0 {
+			continue
+		}
+		replies = append(replies, protocol.MakeMultiRawReply([]godis.Reply{
+			protocol.MakeIntReply(s.time),
+			protocol.MakeIntReply(s.latency),
+		}))
+	}
+	return protocol.MakeMultiRawReply(replies)
+}
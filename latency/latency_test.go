@@ -0,0 +1,79 @@
+package latency
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/18
+  @desc: latency monitor
+  @modified by:
+**/
+
+import (
+	"github.com/Allen9012/Godis/config"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/godis/protocol/asserts"
+	"github.com/Allen9012/Godis/interface/godis"
+	"github.com/Allen9012/Godis/lib/utils"
+	"testing"
+	"time"
+)
+
+func TestAddSample(t *testing.T) {
+	Exec(utils.ToCmdLine("reset"))
+	AddSampleIfNeeded(EventCommand, time.Second)
+	asserts.AssertMultiBulkReplySize(t, Exec(utils.ToCmdLine("latest")), 0)
+
+	config.Properties.LatencyMonitorThreshold = 100
+	defer func() {
+		config.Properties.LatencyMonitorThreshold = 0
+	}()
+	AddSampleIfNeeded(EventCommand, 99*time.Millisecond)
+	asserts.AssertMultiBulkReplySize(t, Exec(utils.ToCmdLine("latest")), 0)
+	// samples in the same second are merged
+	monitor.addSample(EventCommand, 1000, 300)
+	monitor.addSample(EventCommand, 1000, 200)
+	monitor.addSample(EventCommand, 1001, 150)
+	monitor.addSample(EventExpireCycle, 1001, 120)
+
+	result := Exec(utils.ToCmdLine("latest"))
+	expected := protocol.MakeMultiRawReply([]godis.Reply{
+		protocol.MakeMultiRawReply([]godis.Reply{
+			protocol.MakeBulkReply([]byte(EventCommand)),
+			protocol.MakeIntReply(1001), protocol.MakeIntReply(150), protocol.MakeIntReply(300),
+		}),
+		protocol.MakeMultiRawReply([]godis.Reply{
+			protocol.MakeBulkReply([]byte(EventExpireCycle)),
+			protocol.MakeIntReply(1001), protocol.MakeIntReply(120), protocol.MakeIntReply(120),
+		}),
+	})
+	if string(result.ToBytes()) != string(expected.ToBytes()) {
+		t.Errorf("expect %s, actual %s", string(expected.ToBytes()), string(result.ToBytes()))
+	}
+	result = Exec(utils.ToCmdLine("history", "command"))
+	expected = protocol.MakeMultiRawReply([]godis.Reply{
+		protocol.MakeMultiRawReply([]godis.Reply{protocol.MakeIntReply(1000), protocol.MakeIntReply(300)}),
+		protocol.MakeMultiRawReply([]godis.Reply{protocol.MakeIntReply(1001), protocol.MakeIntReply(150)}),
+	})
+	if string(result.ToBytes()) != string(expected.ToBytes()) {
+		t.Errorf("expect %s, actual %s", string(expected.ToBytes()), string(result.ToBytes()))
+	}
+
+	asserts.AssertIntReply(t, Exec(utils.ToCmdLine("reset", "command", "fork")), 1)
+	asserts.AssertMultiBulkReplySize(t, Exec(utils.ToCmdLine("history", "command")), 0)
+	asserts.AssertIntReply(t, Exec(utils.ToCmdLine("reset")), 1)
+}
+
+func TestHistoryRing(t *testing.T) {
+	m := &Monitor{events: make(map[string]*eventHistory)}
+	for i := 0; i < maxSamples+10; i++ {
+		m.addSample(EventCommand, int64(i+1), int64(i))
+	}
+	result, ok := m.historyReply(EventCommand).(*protocol.MultiRawReply)
+	if !ok || len(result.Replies) != maxSamples {
+		t.Fatalf("expect %d samples", maxSamples)
+	}
+	first := result.Replies[0].(*protocol.MultiRawReply).Replies[0].(*protocol.IntReply).Code
+	if first != 11 {
+		t.Errorf("oldest samples should be dropped, actual first sample at %d", first)
+	}
+}
@@ -0,0 +1,228 @@
+package geohash
+
+import (
+	"math"
+	"sort"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/11
+  @desc: 52 位 geohash, 经纬度各 26 位交错排列, 作为 sorted set 的 score 使用
+	纬度范围与 Web Mercator 一致, 为 [-85.05112878, 85.05112878]
+  @modified by:
+**/
+
+const (
+	// MaxStep is the number of bits of latitude or longitude
+	MaxStep = 26
+	// LatMin is the min latitude supported
+	LatMin = -85.05112878
+	// LatMax is the max latitude supported
+	LatMax = 85.05112878
+	// LngMin is the min longitude supported
+	LngMin = -180.0
+	// LngMax is the max longitude supported
+	LngMax = 180.0
+	// EarthRadius in meters, the same as redis
+	EarthRadius = 6372797.560856
+)
+
+const base32Alphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// Area is a rectangle on the map
+type Area struct {
+	MinLat float64
+	MaxLat float64
+	MinLng float64
+	MaxLng float64
+}
+
+// interleave puts bits of x at even positions and bits of y at odd positions
+func interleave(x uint64, y uint64, step uint) uint64 {
+	var code uint64
+	for i := uint(0); i < step; i++ {
+		code |= (x >> i & 1) << (2 * i)
+		code |= (y >> i & 1) << (2*i + 1)
+	}
+	return code
+}
+
+// deinterleave is the reverse of interleave
+func deinterleave(code uint64, step uint) (x uint64, y uint64) {
+	for i := uint(0); i < step; i++ {
+		x |= (code >> (2 * i) & 1) << i
+		y |= (code >> (2*i + 1) & 1) << i
+	}
+	return x, y
+}
+
+func encode(lat float64, lng float64, latMin float64, latMax float64, step uint) uint64 {
+	cells := float64(uint64(1) << step)
+	latBits := uint64((lat - latMin) / (latMax - latMin) * cells)
+	lngBits := uint64((lng - LngMin) / (LngMax - LngMin) * cells)
+	// the max latitude or longitude belongs to the last cell
+	limit := uint64(1)<<step - 1
+	if latBits > limit {
+		latBits = limit
+	}
+	if lngBits > limit {
+		lngBits = limit
+	}
+	return interleave(latBits, lngBits, step)
+}
+
+// Valid returns whether the coordinate could be encoded
+func Valid(lat float64, lng float64) bool {
+	return lat >= LatMin && lat <= LatMax && lng >= LngMin && lng <= LngMax
+}
+
+// Encode returns 52-bit geohash of the coordinate
+func Encode(lat float64, lng float64) uint64 {
+	return EncodeWithStep(lat, lng, MaxStep)
+}
+
+// EncodeWithStep returns geohash of 2*step bits
+func EncodeWithStep(lat float64, lng float64, step uint) uint64 {
+	return encode(lat, lng, LatMin, LatMax, step)
+}
+
+// DecodeArea returns the cell of geohash with 2*step bits
+func DecodeArea(code uint64, step uint) Area {
+	latBits, lngBits := deinterleave(code, step)
+	cells := float64(uint64(1) << step)
+	latScale := (LatMax - LatMin) / cells
+	lngScale := (LngMax - LngMin) / cells
+	return Area{
+		MinLat: LatMin + float64(latBits)*latScale,
+		MaxLat: LatMin + float64(latBits+1)*latScale,
+		MinLng: LngMin + float64(lngBits)*lngScale,
+		MaxLng: LngMin + float64(lngBits+1)*lngScale,
+	}
+}
+
+// Decode returns the center of the cell of 52-bit geohash
+func Decode(code uint64) (lat float64, lng float64) {
+	area := DecodeArea(code, MaxStep)
+	lat = math.Max(LatMin, math.Min(LatMax, (area.MinLat+area.MaxLat)/2))
+	lng = math.Max(LngMin, math.Min(LngMax, (area.MinLng+area.MaxLng)/2))
+	return lat, lng
+}
+
+// ToBase32 returns the standard 11 characters geohash string, whose latitude range is [-90, 90]
+func ToBase32(lat float64, lng float64) string {
+	code := encode(lat, lng, -90, 90, MaxStep)
+	buf := make([]byte, 11)
+	for i := 0; i < 11; i++ {
+		idx := 0
+		// 52 bits is not enough for the last character
+		if i < 10 {
+			idx = int(code >> (52 - (i+1)*5) & 0x1f)
+		}
+		buf[i] = base32Alphabet[idx]
+	}
+	return string(buf)
+}
+
+func degRad(deg float64) float64 {
+	return deg * math.Pi / 180
+}
+
+func radDeg(rad float64) float64 {
+	return rad * 180 / math.Pi
+}
+
+// Distance returns the distance between two coordinates in meters by haversine formula
+func Distance(lat1 float64, lng1 float64, lat2 float64, lng2 float64) float64 {
+	lat1r, lat2r := degRad(lat1), degRad(lat2)
+	u := math.Sin((lat2r - lat1r) / 2)
+	v := math.Sin(degRad(lng2-lng1) / 2)
+	a := u*u + math.Cos(lat1r)*math.Cos(lat2r)*v*v
+	return 2 * EarthRadius * math.Asin(math.Sqrt(a))
+}
+
+// LatDistance returns the distance between two latitudes in meters
+func LatDistance(lat1 float64, lat2 float64) float64 {
+	return EarthRadius * math.Abs(degRad(lat2)-degRad(lat1))
+}
+
+// estimateStep returns the max step whose cells are large enough,
+// so that the circle of radius around a point is covered by the cell of the point and its 8 neighbours
+func estimateStep(lat float64, radius float64) uint {
+	if radius <= 0 {
+		return MaxStep
+	}
+	angle := radius / EarthRadius
+	if angle >= math.Pi/2 {
+		return 1
+	}
+	latSpan := radDeg(angle)
+	lngSpan := 360.0
+	// the longitude span of circle on sphere
+	if ratio := math.Sin(angle) / math.Cos(degRad(lat)); ratio < 1 {
+		lngSpan = radDeg(math.Asin(ratio))
+	}
+	step := uint(MaxStep)
+	for step > 1 {
+		cells := float64(uint64(1) << step)
+		if (LatMax-LatMin)/cells >= latSpan && (LngMax-LngMin)/cells >= lngSpan {
+			break
+		}
+		step--
+	}
+	return step
+}
+
+// Ranges returns ranges [min, max) of 52-bit geohash which covers the circle of radius meters around the coordinate
+//
+//	@Description: 选取足够大的格子, 圆一定落在中心点所在格子及其 8 个邻居之内, 相邻的范围会被合并
+//	@param lat
+//	@param lng
+//	@param radius
+//	@return [][2]uint64
+func Ranges(lat float64, lng float64, radius float64) [][2]uint64 {
+	step := estimateStep(lat, radius)
+	area := DecodeArea(EncodeWithStep(lat, lng, step), step)
+	height := area.MaxLat - area.MinLat
+	width := area.MaxLng - area.MinLng
+	centerLat := (area.MinLat + area.MaxLat) / 2
+	centerLng := (area.MinLng + area.MaxLng) / 2
+	shift := 2 * (MaxStep - step)
+
+	seen := make(map[uint64]struct{})
+	var ranges [][2]uint64
+	for dLat := -1; dLat <= 1; dLat++ {
+		for dLng := -1; dLng <= 1; dLng++ {
+			cellLat := centerLat + float64(dLat)*height
+			if cellLat < LatMin || cellLat > LatMax {
+				continue
+			}
+			cellLng := centerLng + float64(dLng)*width
+			if cellLng > LngMax {
+				cellLng -= 360
+			} else if cellLng < LngMin {
+				cellLng += 360
+			}
+			code := EncodeWithStep(cellLat, cellLng, step)
+			if _, ok := seen[code]; ok {
+				continue
+			}
+			seen[code] = struct{}{}
+			ranges = append(ranges, [2]uint64{code << shift, (code + 1) << shift})
+		}
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i][0] < ranges[j][0]
+	})
+	merged := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r[0] == last[1] {
+			last[1] = r[1]
+		} else {
+			merged = append(merged, r)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,70 @@
+package geohash
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/11
+  @desc:
+  @modified by:
+**/
+
+func TestEncodeAndDecode(t *testing.T) {
+	lat, lng := 38.115556, 13.361389
+	code := Encode(lat, lng)
+	if code != 3479099956230698 {
+		t.Errorf("wrong geohash %d", code)
+	}
+	decodedLat, decodedLng := Decode(code)
+	if math.Abs(decodedLat-lat) > 1e-5 || math.Abs(decodedLng-lng) > 1e-5 {
+		t.Errorf("wrong decoded coordinate %f %f", decodedLat, decodedLng)
+	}
+	if s := ToBase32(lat, lng); s != "sqc8b49rny0" {
+		t.Errorf("wrong base32 geohash %s", s)
+	}
+	if s := ToBase32(37.502669, 15.087269); s != "sqdtr74hyu0" {
+		t.Errorf("wrong base32 geohash %s", s)
+	}
+}
+
+func TestDistance(t *testing.T) {
+	dist := Distance(38.115556, 13.361389, 37.502669, 15.087269)
+	if math.Abs(dist-166274.1516) > 1 {
+		t.Errorf("wrong distance %f", dist)
+	}
+}
+
+func TestRanges(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		lat := (r.Float64()*2 - 1) * 80
+		lng := (r.Float64()*2 - 1) * 180
+		radius := math.Pow(10, r.Float64()*7)
+		ranges := Ranges(lat, lng, radius)
+		// random points within radius must be covered by ranges
+		for j := 0; j < 20; j++ {
+			span := radDeg(radius / EarthRadius)
+			pLat := lat + (r.Float64()*2-1)*span
+			pLng := lng + (r.Float64()*2-1)*math.Min(180, span/math.Cos(degRad(lat)))
+			if !Valid(pLat, pLng) || Distance(lat, lng, pLat, pLng) > radius {
+				continue
+			}
+			code := Encode(pLat, pLng)
+			covered := false
+			for _, rng := range ranges {
+				if code >= rng[0] && code < rng[1] {
+					covered = true
+					break
+				}
+			}
+			if !covered {
+				t.Fatalf("point %f,%f is not covered by circle of %f,%f radius %f", pLat, pLng, lat, lng, radius)
+			}
+		}
+	}
+}
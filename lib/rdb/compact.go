@@ -0,0 +1,311 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/9/30
+  @desc: redis 小对象的紧凑编码: ziplist, listpack, intset
+  @modified by:
+**/
+
+var errCompactCorrupted = errors.New("compact encoding corrupted")
+
+// parseZipList returns entries of a ziplist
+//
+//	<zlbytes uint32><zltail uint32><zllen uint16><entry>...<0xff>
+//	entry: <prevlen 1 or 5 bytes><encoding><data>
+func parseZipList(buf []byte) ([][]byte, error) {
+	if len(buf) < 11 {
+		return nil, errCompactCorrupted
+	}
+	var values [][]byte
+	i := 10
+	for i < len(buf) && buf[i] != 0xff {
+		// skip prevlen
+		if buf[i] == 0xfe {
+			i += 5
+		} else {
+			i++
+		}
+		if i >= len(buf) {
+			return nil, errCompactCorrupted
+		}
+		enc := buf[i]
+		i++
+		var (
+			strLen = -1
+			intLen = 0
+			intVal int64
+		)
+		switch {
+		case enc>>6 == 0:
+			strLen = int(enc & 0x3f)
+		case enc>>6 == 1:
+			if i >= len(buf) {
+				return nil, errCompactCorrupted
+			}
+			strLen = int(enc&0x3f)<<8 | int(buf[i])
+			i++
+		case enc == 0x80:
+			if i+4 > len(buf) {
+				return nil, errCompactCorrupted
+			}
+			strLen = int(binary.BigEndian.Uint32(buf[i:]))
+			i += 4
+		case enc == 0xc0:
+			intLen = 2
+		case enc == 0xd0:
+			intLen = 4
+		case enc == 0xe0:
+			intLen = 8
+		case enc == 0xf0:
+			intLen = 3
+		case enc == 0xfe:
+			intLen = 1
+		case enc >= 0xf1 && enc <= 0xfd:
+			// 4 bit immediate integer
+			intVal = int64(enc&0x0f) - 1
+		default:
+			return nil, fmt.Errorf("unknown ziplist encoding: %x", enc)
+		}
+		if strLen >= 0 {
+			if i+strLen > len(buf) {
+				return nil, errCompactCorrupted
+			}
+			values = append(values, buf[i:i+strLen])
+			i += strLen
+			continue
+		}
+		if i+intLen > len(buf) {
+			return nil, errCompactCorrupted
+		}
+		if intLen > 0 {
+			intVal = readSignedLE(buf[i : i+intLen])
+			i += intLen
+		}
+		values = append(values, []byte(strconv.FormatInt(intVal, 10)))
+	}
+	return values, nil
+}
+
+// parseListPack returns entries of a listpack
+//
+//	<total-bytes uint32><num-elements uint16><element>...<0xff>
+//	element: <encoding-type><element-data><element-tot-len>
+func parseListPack(buf []byte) ([][]byte, error) {
+	if len(buf) < 7 {
+		return nil, errCompactCorrupted
+	}
+	var values [][]byte
+	i := 6
+	for i < len(buf) && buf[i] != 0xff {
+		start := i
+		enc := buf[i]
+		i++
+		var (
+			strLen = -1
+			intLen = 0
+			intVal int64
+		)
+		switch {
+		case enc>>7 == 0:
+			// 7 bit unsigned integer
+			intVal = int64(enc & 0x7f)
+		case enc>>6 == 2:
+			strLen = int(enc & 0x3f)
+		case enc>>5 == 6:
+			// 13 bit signed integer
+			if i >= len(buf) {
+				return nil, errCompactCorrupted
+			}
+			uval := int64(enc&0x1f)<<8 | int64(buf[i])
+			i++
+			if uval >= 1<<12 {
+				uval -= 1 << 13
+			}
+			intVal = uval
+		case enc>>4 == 0xe:
+			if i >= len(buf) {
+				return nil, errCompactCorrupted
+			}
+			strLen = int(enc&0x0f)<<8 | int(buf[i])
+			i++
+		case enc == 0xf0:
+			if i+4 > len(buf) {
+				return nil, errCompactCorrupted
+			}
+			strLen = int(binary.LittleEndian.Uint32(buf[i:]))
+			i += 4
+		case enc == 0xf1:
+			intLen = 2
+		case enc == 0xf2:
+			intLen = 3
+		case enc == 0xf3:
+			intLen = 4
+		case enc == 0xf4:
+			intLen = 8
+		default:
+			return nil, fmt.Errorf("unknown listpack encoding: %x", enc)
+		}
+		if strLen >= 0 {
+			if i+strLen > len(buf) {
+				return nil, errCompactCorrupted
+			}
+			values = append(values, buf[i:i+strLen])
+			i += strLen
+		} else {
+			if i+intLen > len(buf) {
+				return nil, errCompactCorrupted
+			}
+			if intLen > 0 {
+				intVal = readSignedLE(buf[i : i+intLen])
+				i += intLen
+			}
+			values = append(values, []byte(strconv.FormatInt(intVal, 10)))
+		}
+		// skip element-tot-len
+		i += backLenSize(i - start)
+	}
+	return values, nil
+}
+
+// backLenSize returns how many bytes are used to store the length of a listpack element
+func backLenSize(l int) int {
+	switch {
+	case l <= 127:
+		return 1
+	case l < 16383:
+		return 2
+	case l < 2097151:
+		return 3
+	case l < 268435455:
+		return 4
+	}
+	return 5
+}
+
+// listPackBuilder makes a listpack, integers are stored in the smallest encoding like redis
+type listPackBuilder struct {
+	buf   []byte
+	count int
+}
+
+func newListPackBuilder() *listPackBuilder {
+	return &listPackBuilder{
+		// total-bytes and num-elements are filled by build
+		buf: make([]byte, 6),
+	}
+}
+
+// appendInt appends an integer element
+func (b *listPackBuilder) appendInt(v int64) {
+	var ele []byte
+	switch {
+	case v >= 0 && v <= 127:
+		ele = []byte{byte(v)}
+	case v >= -4096 && v <= 4095:
+		u := uint64(v) & 0x1fff
+		ele = []byte{0xc0 | byte(u>>8), byte(u)}
+	case v >= math.MinInt16 && v <= math.MaxInt16:
+		ele = []byte{0xf1, byte(v), byte(v >> 8)}
+	case v >= -1<<23 && v < 1<<23:
+		ele = []byte{0xf2, byte(v), byte(v >> 8), byte(v >> 16)}
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		ele = make([]byte, 5)
+		ele[0] = 0xf3
+		binary.LittleEndian.PutUint32(ele[1:], uint32(v))
+	default:
+		ele = make([]byte, 9)
+		ele[0] = 0xf4
+		binary.LittleEndian.PutUint64(ele[1:], uint64(v))
+	}
+	b.appendElement(ele)
+}
+
+// appendString appends a string element
+func (b *listPackBuilder) appendString(s []byte) {
+	var ele []byte
+	switch {
+	case len(s) < 1<<6:
+		ele = append([]byte{0x80 | byte(len(s))}, s...)
+	case len(s) < 1<<12:
+		ele = append([]byte{0xe0 | byte(len(s)>>8), byte(len(s))}, s...)
+	default:
+		ele = make([]byte, 5, 5+len(s))
+		ele[0] = 0xf0
+		binary.LittleEndian.PutUint32(ele[1:], uint32(len(s)))
+		ele = append(ele, s...)
+	}
+	b.appendElement(ele)
+}
+
+// appendElement appends encoding-type and element-data, then element-tot-len which is read from right to left
+func (b *listPackBuilder) appendElement(ele []byte) {
+	b.buf = append(b.buf, ele...)
+	l := len(ele)
+	size := backLenSize(l)
+	for i := size - 1; i >= 0; i-- {
+		part := byte(l>>(7*uint(i))) & 127
+		if i != size-1 {
+			part |= 128
+		}
+		b.buf = append(b.buf, part)
+	}
+	b.count++
+}
+
+// build returns the listpack, builder should not be used after build
+func (b *listPackBuilder) build() []byte {
+	b.buf = append(b.buf, 0xff)
+	binary.LittleEndian.PutUint32(b.buf, uint32(len(b.buf)))
+	// 65535 means the number of elements is unknown
+	count := b.count
+	if count > math.MaxUint16 {
+		count = math.MaxUint16
+	}
+	binary.LittleEndian.PutUint16(b.buf[4:], uint16(count))
+	return b.buf
+}
+
+// parseIntSet returns members of an intset
+//
+//	<encoding uint32><length uint32><contents>
+func parseIntSet(buf []byte) ([][]byte, error) {
+	if len(buf) < 8 {
+		return nil, errCompactCorrupted
+	}
+	size := int(binary.LittleEndian.Uint32(buf))
+	length := int(binary.LittleEndian.Uint32(buf[4:]))
+	if size != 2 && size != 4 && size != 8 {
+		return nil, fmt.Errorf("unknown intset encoding: %d", size)
+	}
+	if 8+size*length > len(buf) {
+		return nil, errCompactCorrupted
+	}
+	members := make([][]byte, 0, length)
+	for i := 0; i < length; i++ {
+		offset := 8 + i*size
+		v := readSignedLE(buf[offset : offset+size])
+		members = append(members, []byte(strconv.FormatInt(v, 10)))
+	}
+	return members, nil
+}
+
+// readSignedLE reads little endian signed integer of 1 to 8 bytes
+func readSignedLE(b []byte) int64 {
+	var u uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		u = u<<8 | uint64(b[i])
+	}
+	// sign extension
+	shift := uint(64 - 8*len(b))
+	return int64(u<<shift) >> shift
+}
@@ -0,0 +1,41 @@
+package rdb
+
+import "hash/crc64"
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/9/30
+  @desc: RDB 文件末尾的 crc64 校验和 (Jones 多项式)
+  @modified by:
+**/
+
+// jonesPoly is the bit-reversed form of Jones polynomial 0xad93d23594c935a9 used by redis
+const jonesPoly = 0x95ac9329ac4bc9b5
+
+var crcTable = crc64.MakeTable(jonesPoly)
+
+// digest computes redis flavored crc64 incrementally
+// redis uses 0 as initial value without final xor, while hash/crc64 inverts both, so the state is kept inverted
+type digest struct {
+	state uint64
+}
+
+func newDigest() *digest {
+	return &digest{state: ^uint64(0)}
+}
+
+func (d *digest) update(p []byte) {
+	d.state = crc64.Update(d.state, crcTable, p)
+}
+
+func (d *digest) sum() uint64 {
+	return ^d.state
+}
+
+// crc64Jones returns the redis crc64 checksum of given bytes
+func crc64Jones(p []byte) uint64 {
+	d := newDigest()
+	d.update(p)
+	return d.sum()
+}
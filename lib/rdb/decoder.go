@@ -0,0 +1,489 @@
+package rdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/9/30
+  @desc: RDB 解码器
+  @modified by:
+**/
+
+// Decoder reads redis compatible rdb file
+type Decoder struct {
+	reader  *bufio.Reader
+	crc     *digest
+	version int
+	buf     []byte
+}
+
+// NewDecoder creates a decoder reading from r
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{
+		reader: bufio.NewReader(r),
+		crc:    newDigest(),
+		buf:    make([]byte, 8),
+	}
+}
+
+func (dec *Decoder) readFull(p []byte) error {
+	if _, err := io.ReadFull(dec.reader, p); err != nil {
+		return err
+	}
+	dec.crc.update(p)
+	return nil
+}
+
+func (dec *Decoder) readByte() (byte, error) {
+	if err := dec.readFull(dec.buf[:1]); err != nil {
+		return 0, err
+	}
+	return dec.buf[0], nil
+}
+
+// readLength reads length encoded integer, special is true if the value is a special string encoding
+func (dec *Decoder) readLength() (length uint64, special bool, err error) {
+	first, err := dec.readByte()
+	if err != nil {
+		return 0, false, err
+	}
+	switch first >> 6 {
+	case len6Bit:
+		return uint64(first & 0x3f), false, nil
+	case len14Bit:
+		next, err := dec.readByte()
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(first&0x3f)<<8 | uint64(next), false, nil
+	case len32or64Bit:
+		if first == len32Bit {
+			if err := dec.readFull(dec.buf[:4]); err != nil {
+				return 0, false, err
+			}
+			return uint64(binary.BigEndian.Uint32(dec.buf)), false, nil
+		} else if first == len64Bit {
+			if err := dec.readFull(dec.buf[:8]); err != nil {
+				return 0, false, err
+			}
+			return binary.BigEndian.Uint64(dec.buf), false, nil
+		}
+		return 0, false, fmt.Errorf("illegal length encoding: %x", first)
+	default:
+		return uint64(first & 0x3f), true, nil
+	}
+}
+
+func (dec *Decoder) readCount() (int, error) {
+	n, special, err := dec.readLength()
+	if err != nil {
+		return 0, err
+	}
+	if special {
+		return 0, errors.New("unexpected string encoding")
+	}
+	return int(n), nil
+}
+
+func (dec *Decoder) readString() ([]byte, error) {
+	length, special, err := dec.readLength()
+	if err != nil {
+		return nil, err
+	}
+	if !special {
+		buf := make([]byte, length)
+		if err := dec.readFull(buf); err != nil {
+			return nil, err
+		}
+		return buf, nil
+	}
+	switch length {
+	case encodeInt8:
+		b, err := dec.readByte()
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strconv.Itoa(int(int8(b)))), nil
+	case encodeInt16:
+		if err := dec.readFull(dec.buf[:2]); err != nil {
+			return nil, err
+		}
+		return []byte(strconv.Itoa(int(int16(binary.LittleEndian.Uint16(dec.buf))))), nil
+	case encodeInt32:
+		if err := dec.readFull(dec.buf[:4]); err != nil {
+			return nil, err
+		}
+		return []byte(strconv.Itoa(int(int32(binary.LittleEndian.Uint32(dec.buf))))), nil
+	case encodeLZF:
+		compressedLen, err := dec.readCount()
+		if err != nil {
+			return nil, err
+		}
+		rawLen, err := dec.readCount()
+		if err != nil {
+			return nil, err
+		}
+		compressed := make([]byte, compressedLen)
+		if err := dec.readFull(compressed); err != nil {
+			return nil, err
+		}
+		return lzfDecompress(compressed, rawLen)
+	}
+	return nil, fmt.Errorf("unknown string encoding: %d", length)
+}
+
+func (dec *Decoder) readStrings() ([][]byte, error) {
+	n, err := dec.readCount()
+	if err != nil {
+		return nil, err
+	}
+	values := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		v, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// readFloat reads the string encoded double used by type zset
+func (dec *Decoder) readFloat() (float64, error) {
+	n, err := dec.readByte()
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 253:
+		return math.NaN(), nil
+	case 254:
+		return math.Inf(1), nil
+	case 255:
+		return math.Inf(-1), nil
+	}
+	buf := make([]byte, n)
+	if err := dec.readFull(buf); err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(string(buf), 64)
+}
+
+func (dec *Decoder) readBinaryFloat() (float64, error) {
+	if err := dec.readFull(dec.buf[:8]); err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(dec.buf)), nil
+}
+
+func (dec *Decoder) readHeader() error {
+	header := make([]byte, len(magic)+4)
+	if err := dec.readFull(header); err != nil {
+		return err
+	}
+	if string(header[:len(magic)]) != magic {
+		return errors.New("file is not a rdb file")
+	}
+	v, err := strconv.Atoi(string(header[len(magic):]))
+	if err != nil {
+		return fmt.Errorf("illegal rdb version: %s", header[len(magic):])
+	}
+	dec.version = v
+	return nil
+}
+
+// Parse reads the whole rdb file and calls cb for every object, stops parsing if cb returns false
+func (dec *Decoder) Parse(cb func(object RedisObject) bool) error {
+	if err := dec.readHeader(); err != nil {
+		return err
+	}
+	dbIndex := 0
+	var expiration *time.Time
+	for {
+		b, err := dec.readByte()
+		if err != nil {
+			return err
+		}
+		switch b {
+		case opCodeEOF:
+			return dec.verifyChecksum()
+		case opCodeSelectDB:
+			dbIndex, err = dec.readCount()
+			if err != nil {
+				return err
+			}
+		case opCodeResizeDB:
+			if _, err := dec.readCount(); err != nil {
+				return err
+			}
+			if _, err := dec.readCount(); err != nil {
+				return err
+			}
+		case opCodeAux:
+			if _, err := dec.readString(); err != nil {
+				return err
+			}
+			if _, err := dec.readString(); err != nil {
+				return err
+			}
+		case opCodeExpireTime:
+			if err := dec.readFull(dec.buf[:4]); err != nil {
+				return err
+			}
+			t := time.Unix(int64(binary.LittleEndian.Uint32(dec.buf)), 0)
+			expiration = &t
+		case opCodeExpireTimeMs:
+			if err := dec.readFull(dec.buf[:8]); err != nil {
+				return err
+			}
+			ms := int64(binary.LittleEndian.Uint64(dec.buf))
+			t := time.Unix(ms/1000, ms%1000*int64(time.Millisecond))
+			expiration = &t
+		case opCodeIdle:
+			if _, err := dec.readCount(); err != nil {
+				return err
+			}
+		case opCodeFreq:
+			if _, err := dec.readByte(); err != nil {
+				return err
+			}
+		case opCodeModuleAux, opCodeFunction:
+			return fmt.Errorf("unsupported op code: %x", b)
+		default:
+			key, err := dec.readString()
+			if err != nil {
+				return err
+			}
+			base := &BaseObject{
+				DB:         dbIndex,
+				Key:        string(key),
+				Expiration: expiration,
+			}
+			expiration = nil
+			obj, err := dec.readObject(b, base)
+			if err != nil {
+				return fmt.Errorf("read object %s failed: %v", key, err)
+			}
+			if !cb(obj) {
+				return nil
+			}
+		}
+	}
+}
+
+func (dec *Decoder) verifyChecksum() error {
+	if dec.version < 5 {
+		return nil
+	}
+	expected := dec.crc.sum()
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(dec.reader, buf); err != nil {
+		return err
+	}
+	actual := binary.LittleEndian.Uint64(buf)
+	// redis writes 0 when rdbchecksum is disabled
+	if actual != 0 && actual != expected {
+		return fmt.Errorf("checksum mismatch: expect %x, actual %x", expected, actual)
+	}
+	return nil
+}
+
+func (dec *Decoder) readObject(objType byte, base *BaseObject) (RedisObject, error) {
+	switch objType {
+	case typeString:
+		value, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		return &StringObject{BaseObject: base, Value: value}, nil
+	case typeList:
+		values, err := dec.readStrings()
+		if err != nil {
+			return nil, err
+		}
+		return &ListObject{BaseObject: base, Values: values}, nil
+	case typeSet:
+		members, err := dec.readStrings()
+		if err != nil {
+			return nil, err
+		}
+		return &SetObject{BaseObject: base, Members: members}, nil
+	case typeHash:
+		values, err := dec.readHashPairs()
+		if err != nil {
+			return nil, err
+		}
+		return &HashObject{BaseObject: base, Hash: values}, nil
+	case typeZSet, typeZSet2:
+		entries, err := dec.readZSetEntries(objType == typeZSet2)
+		if err != nil {
+			return nil, err
+		}
+		return &ZSetObject{BaseObject: base, Entries: entries}, nil
+	case typeListZipList, typeListQuickList, typeListQuickList2:
+		values, err := dec.readCompactList(objType)
+		if err != nil {
+			return nil, err
+		}
+		return &ListObject{BaseObject: base, Values: values}, nil
+	case typeSetIntSet, typeSetListPack:
+		blob, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		var members [][]byte
+		if objType == typeSetIntSet {
+			members, err = parseIntSet(blob)
+		} else {
+			members, err = parseListPack(blob)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &SetObject{BaseObject: base, Members: members}, nil
+	case typeHashZipList, typeHashListPack:
+		values, err := dec.readCompactEntries(objType == typeHashZipList)
+		if err != nil {
+			return nil, err
+		}
+		if len(values)%2 != 0 {
+			return nil, errors.New("odd number of hash entries")
+		}
+		hash := make(map[string][]byte, len(values)/2)
+		for i := 0; i < len(values); i += 2 {
+			hash[string(values[i])] = values[i+1]
+		}
+		return &HashObject{BaseObject: base, Hash: hash}, nil
+	case typeZSetZipList, typeZSetListPack:
+		values, err := dec.readCompactEntries(objType == typeZSetZipList)
+		if err != nil {
+			return nil, err
+		}
+		if len(values)%2 != 0 {
+			return nil, errors.New("odd number of zset entries")
+		}
+		entries := make([]*ZSetEntry, 0, len(values)/2)
+		for i := 0; i < len(values); i += 2 {
+			score, err := strconv.ParseFloat(string(values[i+1]), 64)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, &ZSetEntry{Member: string(values[i]), Score: score})
+		}
+		return &ZSetObject{BaseObject: base, Entries: entries}, nil
+	case typeStreamListPacks, typeStreamListPacks2, typeStreamListPacks3:
+		stream, err := dec.readStream(objType)
+		if err != nil {
+			return nil, err
+		}
+		return &StreamObject{BaseObject: base, StreamData: stream}, nil
+	}
+	return nil, fmt.Errorf("unsupported object type: %d", objType)
+}
+
+func (dec *Decoder) readHashPairs() (map[string][]byte, error) {
+	n, err := dec.readCount()
+	if err != nil {
+		return nil, err
+	}
+	hash := make(map[string][]byte, n)
+	for i := 0; i < n; i++ {
+		field, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		value, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		hash[string(field)] = value
+	}
+	return hash, nil
+}
+
+func (dec *Decoder) readZSetEntries(binaryScore bool) ([]*ZSetEntry, error) {
+	n, err := dec.readCount()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*ZSetEntry, 0, n)
+	for i := 0; i < n; i++ {
+		member, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		var score float64
+		if binaryScore {
+			score, err = dec.readBinaryFloat()
+		} else {
+			score, err = dec.readFloat()
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &ZSetEntry{Member: string(member), Score: score})
+	}
+	return entries, nil
+}
+
+// readCompactEntries reads a single ziplist or listpack blob
+func (dec *Decoder) readCompactEntries(zipList bool) ([][]byte, error) {
+	blob, err := dec.readString()
+	if err != nil {
+		return nil, err
+	}
+	if zipList {
+		return parseZipList(blob)
+	}
+	return parseListPack(blob)
+}
+
+// readCompactList reads list stored as ziplist, quicklist of ziplist or quicklist of listpack
+func (dec *Decoder) readCompactList(objType byte) ([][]byte, error) {
+	if objType == typeListZipList {
+		return dec.readCompactEntries(true)
+	}
+	nodes, err := dec.readCount()
+	if err != nil {
+		return nil, err
+	}
+	var values [][]byte
+	for i := 0; i < nodes; i++ {
+		container := quickListNodePacked
+		if objType == typeListQuickList2 {
+			container, err = dec.readCount()
+			if err != nil {
+				return nil, err
+			}
+		}
+		blob, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		if container == quickListNodePlain {
+			values = append(values, blob)
+			continue
+		}
+		var entries [][]byte
+		if objType == typeListQuickList {
+			entries, err = parseZipList(blob)
+		} else {
+			entries, err = parseListPack(blob)
+		}
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, entries...)
+	}
+	return values, nil
+}
@@ -0,0 +1,234 @@
+package rdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/9/30
+  @desc: RDB 编码器
+  @modified by:
+**/
+
+// Encoder writes redis compatible rdb file
+type Encoder struct {
+	writer *bufio.Writer
+	crc    *digest
+	buf    []byte
+}
+
+// NewEncoder creates an encoder writing to w
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{
+		writer: bufio.NewWriter(w),
+		crc:    newDigest(),
+		buf:    make([]byte, 9),
+	}
+}
+
+func (enc *Encoder) write(p []byte) error {
+	enc.crc.update(p)
+	_, err := enc.writer.Write(p)
+	return err
+}
+
+func (enc *Encoder) writeByte(b byte) error {
+	enc.buf[0] = b
+	return enc.write(enc.buf[:1])
+}
+
+// writeLength writes length encoded integer
+func (enc *Encoder) writeLength(n uint64) error {
+	var buf []byte
+	switch {
+	case n < 1<<6:
+		buf = []byte{byte(n)}
+	case n < 1<<14:
+		buf = []byte{byte(n>>8) | len14Bit<<6, byte(n)}
+	case n <= math.MaxUint32:
+		buf = make([]byte, 5)
+		buf[0] = len32Bit
+		binary.BigEndian.PutUint32(buf[1:], uint32(n))
+	default:
+		buf = make([]byte, 9)
+		buf[0] = len64Bit
+		binary.BigEndian.PutUint64(buf[1:], n)
+	}
+	return enc.write(buf)
+}
+
+// writeString writes string, integer-like strings are stored in integer encoding like redis does
+func (enc *Encoder) writeString(s []byte) error {
+	if len(s) > 0 && len(s) <= 11 {
+		if i, err := strconv.ParseInt(string(s), 10, 32); err == nil && strconv.FormatInt(i, 10) == string(s) {
+			return enc.writeInt(i)
+		}
+	}
+	if err := enc.writeLength(uint64(len(s))); err != nil {
+		return err
+	}
+	return enc.write(s)
+}
+
+func (enc *Encoder) writeInt(i int64) error {
+	var buf []byte
+	switch {
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		buf = []byte{lenSpecial<<6 | encodeInt8, byte(int8(i))}
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		buf = make([]byte, 3)
+		buf[0] = lenSpecial<<6 | encodeInt16
+		binary.LittleEndian.PutUint16(buf[1:], uint16(int16(i)))
+	default:
+		buf = make([]byte, 5)
+		buf[0] = lenSpecial<<6 | encodeInt32
+		binary.LittleEndian.PutUint32(buf[1:], uint32(int32(i)))
+	}
+	return enc.write(buf)
+}
+
+// WriteHeader writes magic number and version, it must be called before writing anything else
+func (enc *Encoder) WriteHeader() error {
+	return enc.write([]byte(fmt.Sprintf("%s%04d", magic, version)))
+}
+
+// WriteAux writes an auxiliary field, such as redis-ver or ctime
+func (enc *Encoder) WriteAux(key string, value string) error {
+	if err := enc.writeByte(opCodeAux); err != nil {
+		return err
+	}
+	if err := enc.writeString([]byte(key)); err != nil {
+		return err
+	}
+	return enc.writeString([]byte(value))
+}
+
+// WriteDBHeader writes select db op and resize db op
+func (enc *Encoder) WriteDBHeader(dbIndex int, keyCount int, ttlCount int) error {
+	if err := enc.writeByte(opCodeSelectDB); err != nil {
+		return err
+	}
+	if err := enc.writeLength(uint64(dbIndex)); err != nil {
+		return err
+	}
+	if err := enc.writeByte(opCodeResizeDB); err != nil {
+		return err
+	}
+	if err := enc.writeLength(uint64(keyCount)); err != nil {
+		return err
+	}
+	return enc.writeLength(uint64(ttlCount))
+}
+
+// beginObject writes expiration, type code and key of an object
+func (enc *Encoder) beginObject(key string, objType byte, expiration *time.Time) error {
+	if expiration != nil {
+		buf := make([]byte, 9)
+		buf[0] = opCodeExpireTimeMs
+		binary.LittleEndian.PutUint64(buf[1:], uint64(expiration.UnixNano()/int64(time.Millisecond)))
+		if err := enc.write(buf); err != nil {
+			return err
+		}
+	}
+	if err := enc.writeByte(objType); err != nil {
+		return err
+	}
+	return enc.writeString([]byte(key))
+}
+
+// WriteStringObject writes a string key
+func (enc *Encoder) WriteStringObject(key string, value []byte, expiration *time.Time) error {
+	if err := enc.beginObject(key, typeString, expiration); err != nil {
+		return err
+	}
+	return enc.writeString(value)
+}
+
+// WriteListObject writes a list key
+func (enc *Encoder) WriteListObject(key string, values [][]byte, expiration *time.Time) error {
+	if err := enc.beginObject(key, typeList, expiration); err != nil {
+		return err
+	}
+	return enc.writeStrings(values)
+}
+
+// WriteSetObject writes a set key
+func (enc *Encoder) WriteSetObject(key string, members [][]byte, expiration *time.Time) error {
+	if err := enc.beginObject(key, typeSet, expiration); err != nil {
+		return err
+	}
+	return enc.writeStrings(members)
+}
+
+func (enc *Encoder) writeStrings(values [][]byte) error {
+	if err := enc.writeLength(uint64(len(values))); err != nil {
+		return err
+	}
+	for _, v := range values {
+		if err := enc.writeString(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteHashObject writes a hash key
+func (enc *Encoder) WriteHashObject(key string, hash map[string][]byte, expiration *time.Time) error {
+	if err := enc.beginObject(key, typeHash, expiration); err != nil {
+		return err
+	}
+	if err := enc.writeLength(uint64(len(hash))); err != nil {
+		return err
+	}
+	for field, value := range hash {
+		if err := enc.writeString([]byte(field)); err != nil {
+			return err
+		}
+		if err := enc.writeString(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteZSetObject writes a sorted set key, scores are stored as binary double
+func (enc *Encoder) WriteZSetObject(key string, entries []*ZSetEntry, expiration *time.Time) error {
+	if err := enc.beginObject(key, typeZSet2, expiration); err != nil {
+		return err
+	}
+	if err := enc.writeLength(uint64(len(entries))); err != nil {
+		return err
+	}
+	buf := make([]byte, 8)
+	for _, e := range entries {
+		if err := enc.writeString([]byte(e.Member)); err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint64(buf, math.Float64bits(e.Score))
+		if err := enc.write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteEnd writes EOF op and checksum, then flushes buffered data
+func (enc *Encoder) WriteEnd() error {
+	if err := enc.writeByte(opCodeEOF); err != nil {
+		return err
+	}
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, enc.crc.sum())
+	if _, err := enc.writer.Write(buf); err != nil {
+		return err
+	}
+	return enc.writer.Flush()
+}
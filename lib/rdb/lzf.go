@@ -0,0 +1,57 @@
+package rdb
+
+import "errors"
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/9/30
+  @desc: lzf 解压, redis 在 rdbcompression 开启时会压缩较长的字符串
+  @modified by:
+**/
+
+var errLZFCorrupted = errors.New("lzf: corrupted input")
+
+// lzfDecompress decompresses lzf compressed data, outLen is the length of uncompressed data
+func lzfDecompress(in []byte, outLen int) ([]byte, error) {
+	out := make([]byte, 0, outLen)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 32 {
+			// literal run of ctrl+1 bytes
+			n := ctrl + 1
+			if i+n > len(in) {
+				return nil, errLZFCorrupted
+			}
+			out = append(out, in[i:i+n]...)
+			i += n
+			continue
+		}
+		// back reference
+		n := ctrl >> 5
+		if n == 7 {
+			if i >= len(in) {
+				return nil, errLZFCorrupted
+			}
+			n += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, errLZFCorrupted
+		}
+		ref := len(out) - ((ctrl & 0x1f) << 8) - int(in[i]) - 1
+		i++
+		if ref < 0 {
+			return nil, errLZFCorrupted
+		}
+		// the referenced range may overlap with bytes being written, so copy one by one
+		for j := 0; j < n+2; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+	if len(out) != outLen {
+		return nil, errLZFCorrupted
+	}
+	return out, nil
+}
@@ -0,0 +1,228 @@
+package rdb
+
+import "time"
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/9/30
+  @desc: Redis 兼容的 RDB 文件格式定义
+  @modified by:
+**/
+
+const (
+	magic   = "REDIS"
+	version = 9
+)
+
+// op codes
+const (
+	opCodeFunction     = 0xF5
+	opCodeModuleAux    = 0xF7
+	opCodeIdle         = 0xF8
+	opCodeFreq         = 0xF9
+	opCodeAux          = 0xFA
+	opCodeResizeDB     = 0xFB
+	opCodeExpireTimeMs = 0xFC
+	opCodeExpireTime   = 0xFD
+	opCodeSelectDB     = 0xFE
+	opCodeEOF          = 0xFF
+)
+
+// object types
+const (
+	typeString          = 0
+	typeList            = 1
+	typeSet             = 2
+	typeZSet            = 3
+	typeHash            = 4
+	typeZSet2           = 5
+	typeListZipList     = 10
+	typeSetIntSet       = 11
+	typeZSetZipList     = 12
+	typeHashZipList     = 13
+	typeListQuickList   = 14
+	typeStreamListPacks = 15
+	typeHashListPack    = 16
+	typeZSetListPack    = 17
+	typeListQuickList2  = 18
+	// typeStreamListPacks2 adds first id, max deleted id, entries added and entries read of groups since redis 7.0
+	typeStreamListPacks2 = 19
+	typeSetListPack      = 20
+	// typeStreamListPacks3 adds active time of consumers since redis 7.2
+	typeStreamListPacks3 = 21
+	quickListNodePlain   = 1
+	quickListNodePacked  = 2
+)
+
+// length encoding
+const (
+	len6Bit      = 0
+	len14Bit     = 1
+	len32or64Bit = 2
+	lenSpecial   = 3
+	len32Bit     = 0x80
+	len64Bit     = 0x81
+	encodeInt8   = 0
+	encodeInt16  = 1
+	encodeInt32  = 2
+	encodeLZF    = 3
+)
+
+// object type names returned by RedisObject.GetType
+const (
+	StringType = "string"
+	ListType   = "list"
+	SetType    = "set"
+	HashType   = "hash"
+	ZSetType   = "zset"
+	StreamType = "stream"
+)
+
+// RedisObject is a key-value pair read from rdb file
+type RedisObject interface {
+	GetType() string
+	GetKey() string
+	GetDBIndex() int
+	GetExpiration() *time.Time
+}
+
+// BaseObject holds the fields shared by all kinds of objects
+type BaseObject struct {
+	DB         int
+	Key        string
+	Expiration *time.Time
+}
+
+// GetKey returns key of object
+func (o *BaseObject) GetKey() string {
+	return o.Key
+}
+
+// GetDBIndex returns index of the database which the object belongs to
+func (o *BaseObject) GetDBIndex() int {
+	return o.DB
+}
+
+// GetExpiration returns expiration of object, nil means no ttl
+func (o *BaseObject) GetExpiration() *time.Time {
+	return o.Expiration
+}
+
+// StringObject stores a string value
+type StringObject struct {
+	*BaseObject
+	Value []byte
+}
+
+// GetType returns StringType
+func (o *StringObject) GetType() string {
+	return StringType
+}
+
+// ListObject stores a list value
+type ListObject struct {
+	*BaseObject
+	Values [][]byte
+}
+
+// GetType returns ListType
+func (o *ListObject) GetType() string {
+	return ListType
+}
+
+// SetObject stores a set value
+type SetObject struct {
+	*BaseObject
+	Members [][]byte
+}
+
+// GetType returns SetType
+func (o *SetObject) GetType() string {
+	return SetType
+}
+
+// HashObject stores a hash value
+type HashObject struct {
+	*BaseObject
+	Hash map[string][]byte
+}
+
+// GetType returns HashType
+func (o *HashObject) GetType() string {
+	return HashType
+}
+
+// ZSetEntry is a member-score pair of sorted set
+type ZSetEntry struct {
+	Member string
+	Score  float64
+}
+
+// ZSetObject stores a sorted set value
+type ZSetObject struct {
+	*BaseObject
+	Entries []*ZSetEntry
+}
+
+// GetType returns ZSetType
+func (o *ZSetObject) GetType() string {
+	return ZSetType
+}
+
+// StreamID is the id of stream entry
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+// StreamEntry is an entry of stream
+type StreamEntry struct {
+	ID StreamID
+	// Fields are field-value pairs
+	Fields [][]byte
+}
+
+// StreamPending is an entry delivered to a consumer but not acknowledged
+type StreamPending struct {
+	ID            StreamID
+	Consumer      string
+	DeliveryTime  time.Time
+	DeliveryCount uint64
+}
+
+// StreamConsumer is a consumer of group
+type StreamConsumer struct {
+	Name     string
+	SeenTime time.Time
+}
+
+// StreamGroup is a consumer group of stream
+type StreamGroup struct {
+	Name      string
+	LastID    StreamID
+	Consumers []*StreamConsumer
+	// Pending is pending entries list sorted by id
+	Pending []*StreamPending
+}
+
+// StreamData holds entries and metadata of a stream
+type StreamData struct {
+	// Entries are sorted by id
+	Entries      []*StreamEntry
+	LastID       StreamID
+	MaxDeletedID StreamID
+	EntriesAdded uint64
+	Groups       []*StreamGroup
+}
+
+// StreamObject stores a stream value
+type StreamObject struct {
+	*BaseObject
+	*StreamData
+}
+
+// GetType returns StreamType
+func (o *StreamObject) GetType() string {
+	return StreamType
+}
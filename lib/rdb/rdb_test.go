@@ -0,0 +1,305 @@
+package rdb
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCrc64(t *testing.T) {
+	// test vector from redis crc64.c
+	if sum := crc64Jones([]byte("123456789")); sum != 0xe9c6d914c4b8d9ca {
+		t.Errorf("wrong crc64: %x", sum)
+	}
+}
+
+func TestLZF(t *testing.T) {
+	compressed := []byte{0x00, 'a', 0xe0, 0x00, 0x00}
+	out, err := lzfDecompress(compressed, 10)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if string(out) != "aaaaaaaaaa" {
+		t.Errorf("wrong result: %s", out)
+	}
+	if _, err := lzfDecompress(compressed, 11); err == nil {
+		t.Error("expect error")
+	}
+}
+
+func TestCompactEncodings(t *testing.T) {
+	listPack := []byte{0x10, 0, 0, 0, 0x03, 0,
+		0x81, 'a', 0x02,
+		0xc4, 0x00, 0x02,
+		0xdf, 0xff, 0x02,
+		0xff}
+	assertValues(t, listPack, parseListPack, "a", "1024", "-1")
+
+	zipList := []byte{0, 0, 0, 0, 0, 0, 0, 0, 0x03, 0,
+		0x00, 0x02, 'a', 'b',
+		0x04, 0xf6,
+		0x02, 0xc0, 0x2c, 0x01,
+		0xff}
+	assertValues(t, zipList, parseZipList, "ab", "5", "300")
+
+	intSet := []byte{0x02, 0, 0, 0, 0x02, 0, 0, 0, 0xfe, 0xff, 0x07, 0x00}
+	assertValues(t, intSet, parseIntSet, "-2", "7")
+}
+
+func assertValues(t *testing.T, blob []byte, parse func([]byte) ([][]byte, error), expected ...string) {
+	values, err := parse(blob)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(values) != len(expected) {
+		t.Errorf("expect %d values, actually %d", len(expected), len(values))
+		return
+	}
+	for i, v := range values {
+		if string(v) != expected[i] {
+			t.Errorf("expect %s, actually %s", expected[i], v)
+		}
+	}
+}
+
+func TestEncodeAndDecode(t *testing.T) {
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	expireAt := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	must := func(err error) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(enc.WriteHeader())
+	must(enc.WriteAux("redis-ver", "7.0.0"))
+	must(enc.WriteDBHeader(0, 3, 1))
+	must(enc.WriteStringObject("str", []byte("hello"), &expireAt))
+	must(enc.WriteStringObject("int", []byte("-70000"), nil))
+	must(enc.WriteListObject("list", [][]byte{[]byte("a"), []byte("12")}, nil))
+	must(enc.WriteDBHeader(3, 2, 0))
+	must(enc.WriteSetObject("set", [][]byte{[]byte("x"), []byte("y")}, nil))
+	must(enc.WriteHashObject("hash", map[string][]byte{"f": []byte("v")}, nil))
+	must(enc.WriteZSetObject("zset", []*ZSetEntry{{Member: "m", Score: 1.5}, {Member: "n", Score: math.Inf(-1)}}, nil))
+	must(enc.WriteEnd())
+
+	var objects []RedisObject
+	dec := NewDecoder(bytes.NewReader(buf.Bytes()))
+	err := dec.Parse(func(object RedisObject) bool {
+		objects = append(objects, object)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 6 {
+		t.Fatalf("expect 6 objects, actually %d", len(objects))
+	}
+	str := objects[0].(*StringObject)
+	if str.Key != "str" || string(str.Value) != "hello" || str.DB != 0 {
+		t.Errorf("wrong string object: %+v", str)
+	}
+	if str.Expiration == nil || !str.Expiration.Equal(expireAt) {
+		t.Errorf("wrong expiration: %v", str.Expiration)
+	}
+	if v := objects[1].(*StringObject).Value; string(v) != "-70000" {
+		t.Errorf("wrong int value: %s", v)
+	}
+	if objects[1].GetExpiration() != nil {
+		t.Error("expect no expiration")
+	}
+	list := objects[2].(*ListObject)
+	if len(list.Values) != 2 || string(list.Values[1]) != "12" {
+		t.Errorf("wrong list object: %+v", list.Values)
+	}
+	set := objects[3].(*SetObject)
+	members := []string{string(set.Members[0]), string(set.Members[1])}
+	sort.Strings(members)
+	if set.DB != 3 || members[0] != "x" || members[1] != "y" {
+		t.Errorf("wrong set object: %v", members)
+	}
+	hash := objects[4].(*HashObject)
+	if string(hash.Hash["f"]) != "v" {
+		t.Errorf("wrong hash object: %v", hash.Hash)
+	}
+	zset := objects[5].(*ZSetObject)
+	if zset.GetType() != ZSetType || zset.Entries[0].Score != 1.5 || !math.IsInf(zset.Entries[1].Score, -1) {
+		t.Errorf("wrong zset object: %+v", zset.Entries)
+	}
+
+	// corrupt checksum
+	data := buf.Bytes()
+	data[len(data)-1]++
+	err = NewDecoder(bytes.NewReader(data)).Parse(func(object RedisObject) bool {
+		return true
+	})
+	if err == nil {
+		t.Error("expect checksum error")
+	}
+}
+
+func TestDecodeCompactObjects(t *testing.T) {
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	must := func(err error) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	listPack := []byte{0x0d, 0, 0, 0, 0x02, 0,
+		0x81, 'f', 0x02,
+		0x81, 'v', 0x02,
+		0xff}
+	must(enc.WriteHeader())
+	// hash stored as listpack, expiration in seconds
+	must(enc.write([]byte{opCodeExpireTime, 0x10, 0, 0, 0, typeHashListPack}))
+	must(enc.writeString([]byte("hash")))
+	must(enc.writeString(listPack))
+	// list stored as quicklist2 with one packed node
+	must(enc.writeByte(typeListQuickList2))
+	must(enc.writeString([]byte("list")))
+	must(enc.writeLength(1))
+	must(enc.writeLength(quickListNodePacked))
+	must(enc.writeString(listPack))
+	must(enc.WriteEnd())
+
+	var objects []RedisObject
+	err := NewDecoder(buf).Parse(func(object RedisObject) bool {
+		objects = append(objects, object)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := objects[0].(*HashObject)
+	if string(hash.Hash["f"]) != "v" || hash.Expiration.Unix() != 16 {
+		t.Errorf("wrong hash object: %v", hash.Hash)
+	}
+	list := objects[1].(*ListObject)
+	if len(list.Values) != 2 || string(list.Values[0]) != "f" {
+		t.Errorf("wrong list object: %v", list.Values)
+	}
+}
+
+func TestStreamEncodeAndDecode(t *testing.T) {
+	deliveryTime := time.Now().Add(-time.Minute).Truncate(time.Millisecond)
+	stream := &StreamData{
+		LastID:       StreamID{Ms: 1000, Seq: 300},
+		MaxDeletedID: StreamID{Ms: 1000, Seq: 1},
+		EntriesAdded: 301,
+		Groups: []*StreamGroup{
+			{
+				Name:   "g1",
+				LastID: StreamID{Ms: 1000, Seq: 5},
+				Consumers: []*StreamConsumer{
+					{Name: "alice", SeenTime: deliveryTime},
+					{Name: "bob", SeenTime: deliveryTime},
+				},
+				Pending: []*StreamPending{
+					{ID: StreamID{Ms: 1000, Seq: 2}, Consumer: "bob", DeliveryTime: deliveryTime, DeliveryCount: 3},
+					{ID: StreamID{Ms: 1000, Seq: 5}, Consumer: "alice", DeliveryTime: deliveryTime, DeliveryCount: 1},
+				},
+			},
+			{Name: "empty"},
+		},
+	}
+	// more entries than a listpack node, ids and fields need various encodings
+	for i := 2; i <= 300; i++ {
+		stream.Entries = append(stream.Entries, &StreamEntry{
+			ID:     StreamID{Ms: 1000, Seq: uint64(i)},
+			Fields: [][]byte{[]byte("f"), []byte(strings.Repeat("v", i)), []byte("n"), []byte(strconv.Itoa(-i * 1000))},
+		})
+	}
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	must := func(err error) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(enc.WriteHeader())
+	must(enc.WriteDBHeader(0, 2, 0))
+	must(enc.WriteStreamObject("stream", stream, nil))
+	must(enc.WriteStreamObject("empty", &StreamData{LastID: StreamID{Ms: 7}}, nil))
+	must(enc.WriteEnd())
+
+	var objects []RedisObject
+	err := NewDecoder(buf).Parse(func(object RedisObject) bool {
+		objects = append(objects, object)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := objects[0].(*StreamObject)
+	if decoded.GetType() != StreamType || len(decoded.Entries) != len(stream.Entries) {
+		t.Fatalf("expect %d entries, actually %d", len(stream.Entries), len(decoded.Entries))
+	}
+	for i, entry := range decoded.Entries {
+		expected := stream.Entries[i]
+		if entry.ID != expected.ID || len(entry.Fields) != 4 ||
+			!bytes.Equal(entry.Fields[1], expected.Fields[1]) || !bytes.Equal(entry.Fields[3], expected.Fields[3]) {
+			t.Fatalf("wrong entry %d: %+v", i, entry)
+		}
+	}
+	if decoded.LastID != stream.LastID || decoded.MaxDeletedID != stream.MaxDeletedID || decoded.EntriesAdded != 301 {
+		t.Errorf("wrong metadata: %+v %+v %d", decoded.LastID, decoded.MaxDeletedID, decoded.EntriesAdded)
+	}
+	if len(decoded.Groups) != 2 || decoded.Groups[1].Name != "empty" {
+		t.Fatalf("wrong groups: %+v", decoded.Groups)
+	}
+	group := decoded.Groups[0]
+	if group.LastID != stream.Groups[0].LastID || len(group.Consumers) != 2 || !group.Consumers[0].SeenTime.Equal(deliveryTime) {
+		t.Errorf("wrong group: %+v", group)
+	}
+	if len(group.Pending) != 2 {
+		t.Fatalf("expect 2 pending entries, actually %d", len(group.Pending))
+	}
+	for i, pending := range group.Pending {
+		expected := stream.Groups[0].Pending[i]
+		if pending.ID != expected.ID || pending.Consumer != expected.Consumer ||
+			pending.DeliveryCount != expected.DeliveryCount || !pending.DeliveryTime.Equal(deliveryTime) {
+			t.Errorf("wrong pending entry: %+v", pending)
+		}
+	}
+	empty := objects[1].(*StreamObject)
+	if len(empty.Entries) != 0 || empty.LastID.Ms != 7 {
+		t.Errorf("wrong empty stream: %+v", empty.StreamData)
+	}
+}
+
+func TestParseStreamListPack(t *testing.T) {
+	// listpack written by redis: master fields are shared and deleted entries are kept with flag
+	builder := newListPackBuilder()
+	for _, v := range []int64{1, 1, 1} {
+		builder.appendInt(v)
+	}
+	builder.appendString([]byte("f"))
+	builder.appendInt(0)
+	// same fields with master entry
+	builder.appendInt(streamItemSameFields)
+	builder.appendInt(0)
+	builder.appendInt(0)
+	builder.appendString([]byte("v1"))
+	builder.appendInt(4)
+	// deleted entry
+	builder.appendInt(streamItemDeleted | streamItemSameFields)
+	builder.appendInt(5)
+	builder.appendInt(-1)
+	builder.appendString([]byte("v2"))
+	builder.appendInt(4)
+	entries, err := parseStreamListPack(StreamID{Ms: 100, Seq: 1}, builder.build())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].ID != (StreamID{Ms: 100, Seq: 1}) ||
+		string(entries[0].Fields[0]) != "f" || string(entries[0].Fields[1]) != "v1" {
+		t.Errorf("wrong entries: %+v", entries)
+	}
+}
@@ -0,0 +1,468 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/20
+  @desc: stream 的 RDB 编码, 与 redis 7.0 的 RDB_TYPE_STREAM_LISTPACKS_2 相同
+	<listpack 数量> 每个 listpack: <master ID 16 字节大端> <listpack>
+	<length> <last id> <first id> <max deleted id> <entries added>
+	<group 数量> 每个 group: <name> <last id> <entries read> <PEL> <consumers>
+  @modified by:
+**/
+
+// streamNodeSize is the max number of entries in a listpack, like stream-node-max-entries of redis
+const streamNodeSize = 100
+
+// flags of entry in stream listpack
+const (
+	streamItemDeleted    = 1
+	streamItemSameFields = 2
+)
+
+// entriesReadUnknown means entries read of group is unknown, it is SCG_INVALID_ENTRIES_READ of redis
+const entriesReadUnknown = math.MaxUint64
+
+var errStreamCorrupted = errors.New("stream listpack corrupted")
+
+func encodeStreamID(id StreamID) []byte {
+	buf := make([]byte, 16)
+	binary.BigEndian.PutUint64(buf, id.Ms)
+	binary.BigEndian.PutUint64(buf[8:], id.Seq)
+	return buf
+}
+
+func decodeStreamID(buf []byte) (StreamID, error) {
+	if len(buf) != 16 {
+		return StreamID{}, fmt.Errorf("illegal stream id length: %d", len(buf))
+	}
+	return StreamID{
+		Ms:  binary.BigEndian.Uint64(buf),
+		Seq: binary.BigEndian.Uint64(buf[8:]),
+	}, nil
+}
+
+// makeStreamListPack encodes entries into a listpack, master entry has no fields so every entry stores its own fields
+//
+//	master entry: <count> <deleted> <num-fields> <field>... <0>
+//	entry: <flags> <ms-diff> <seq-diff> <num-fields> <field> <value>... <lp-count>
+func makeStreamListPack(master StreamID, entries []*StreamEntry) []byte {
+	builder := newListPackBuilder()
+	builder.appendInt(int64(len(entries)))
+	builder.appendInt(0)
+	builder.appendInt(0)
+	builder.appendInt(0)
+	for _, entry := range entries {
+		numFields := len(entry.Fields) / 2
+		builder.appendInt(0)
+		builder.appendInt(int64(entry.ID.Ms - master.Ms))
+		builder.appendInt(int64(entry.ID.Seq - master.Seq))
+		builder.appendInt(int64(numFields))
+		for _, field := range entry.Fields {
+			builder.appendString(field)
+		}
+		builder.appendInt(int64(3 + numFields*2 + 1))
+	}
+	return builder.build()
+}
+
+// parseStreamListPack decodes entries from a listpack, entries marked as deleted are skipped
+func parseStreamListPack(master StreamID, blob []byte) ([]*StreamEntry, error) {
+	values, err := parseListPack(blob)
+	if err != nil {
+		return nil, err
+	}
+	i := 0
+	next := func() ([]byte, error) {
+		if i >= len(values) {
+			return nil, errStreamCorrupted
+		}
+		i++
+		return values[i-1], nil
+	}
+	nextInt := func() (int64, error) {
+		value, err := next()
+		if err != nil {
+			return 0, err
+		}
+		return strconv.ParseInt(string(value), 10, 64)
+	}
+	// count and deleted of master entry are not needed
+	for j := 0; j < 2; j++ {
+		if _, err := nextInt(); err != nil {
+			return nil, err
+		}
+	}
+	numMasterFields, err := nextInt()
+	if err != nil {
+		return nil, err
+	}
+	masterFields := make([][]byte, 0, numMasterFields)
+	for j := int64(0); j < numMasterFields; j++ {
+		field, err := next()
+		if err != nil {
+			return nil, err
+		}
+		masterFields = append(masterFields, field)
+	}
+	// the terminator of master entry
+	if _, err := nextInt(); err != nil {
+		return nil, err
+	}
+	var entries []*StreamEntry
+	for i < len(values) {
+		flags, err := nextInt()
+		if err != nil {
+			return nil, err
+		}
+		msDiff, err := nextInt()
+		if err != nil {
+			return nil, err
+		}
+		seqDiff, err := nextInt()
+		if err != nil {
+			return nil, err
+		}
+		var fields [][]byte
+		if flags&streamItemSameFields != 0 {
+			fields = make([][]byte, 0, len(masterFields)*2)
+			for _, field := range masterFields {
+				value, err := next()
+				if err != nil {
+					return nil, err
+				}
+				fields = append(fields, field, value)
+			}
+		} else {
+			numFields, err := nextInt()
+			if err != nil {
+				return nil, err
+			}
+			fields = make([][]byte, 0, numFields*2)
+			for j := int64(0); j < numFields*2; j++ {
+				value, err := next()
+				if err != nil {
+					return nil, err
+				}
+				fields = append(fields, value)
+			}
+		}
+		// lp-count is used by redis to iterate backward
+		if _, err := nextInt(); err != nil {
+			return nil, err
+		}
+		if flags&streamItemDeleted != 0 {
+			continue
+		}
+		entries = append(entries, &StreamEntry{
+			ID: StreamID{
+				Ms:  master.Ms + uint64(msDiff),
+				Seq: master.Seq + uint64(seqDiff),
+			},
+			Fields: fields,
+		})
+	}
+	return entries, nil
+}
+
+func (enc *Encoder) writeStreamID(id StreamID) error {
+	if err := enc.writeLength(id.Ms); err != nil {
+		return err
+	}
+	return enc.writeLength(id.Seq)
+}
+
+func (enc *Encoder) writeMillisecondTime(t time.Time) error {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, uint64(t.UnixMilli()))
+	return enc.write(buf)
+}
+
+// WriteStreamObject writes a stream key with entries, consumer groups and pending entries
+func (enc *Encoder) WriteStreamObject(key string, stream *StreamData, expiration *time.Time) error {
+	if err := enc.beginObject(key, typeStreamListPacks2, expiration); err != nil {
+		return err
+	}
+	entries := stream.Entries
+	if err := enc.writeLength(uint64((len(entries) + streamNodeSize - 1) / streamNodeSize)); err != nil {
+		return err
+	}
+	for begin := 0; begin < len(entries); begin += streamNodeSize {
+		end := begin + streamNodeSize
+		if end > len(entries) {
+			end = len(entries)
+		}
+		master := entries[begin].ID
+		if err := enc.writeString(encodeStreamID(master)); err != nil {
+			return err
+		}
+		if err := enc.writeString(makeStreamListPack(master, entries[begin:end])); err != nil {
+			return err
+		}
+	}
+	if err := enc.writeLength(uint64(len(entries))); err != nil {
+		return err
+	}
+	if err := enc.writeStreamID(stream.LastID); err != nil {
+		return err
+	}
+	var firstID StreamID
+	if len(entries) > 0 {
+		firstID = entries[0].ID
+	}
+	if err := enc.writeStreamID(firstID); err != nil {
+		return err
+	}
+	if err := enc.writeStreamID(stream.MaxDeletedID); err != nil {
+		return err
+	}
+	if err := enc.writeLength(stream.EntriesAdded); err != nil {
+		return err
+	}
+	if err := enc.writeLength(uint64(len(stream.Groups))); err != nil {
+		return err
+	}
+	for _, group := range stream.Groups {
+		if err := enc.writeStreamGroup(group); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeStreamGroup writes the whole PEL of group, then every consumer with ids of its pending entries
+func (enc *Encoder) writeStreamGroup(group *StreamGroup) error {
+	if err := enc.writeString([]byte(group.Name)); err != nil {
+		return err
+	}
+	if err := enc.writeStreamID(group.LastID); err != nil {
+		return err
+	}
+	if err := enc.writeLength(entriesReadUnknown); err != nil {
+		return err
+	}
+	if err := enc.writeLength(uint64(len(group.Pending))); err != nil {
+		return err
+	}
+	consumerPending := make(map[string][]StreamID)
+	for _, pending := range group.Pending {
+		if err := enc.write(encodeStreamID(pending.ID)); err != nil {
+			return err
+		}
+		if err := enc.writeMillisecondTime(pending.DeliveryTime); err != nil {
+			return err
+		}
+		if err := enc.writeLength(pending.DeliveryCount); err != nil {
+			return err
+		}
+		consumerPending[pending.Consumer] = append(consumerPending[pending.Consumer], pending.ID)
+	}
+	if err := enc.writeLength(uint64(len(group.Consumers))); err != nil {
+		return err
+	}
+	for _, consumer := range group.Consumers {
+		if err := enc.writeString([]byte(consumer.Name)); err != nil {
+			return err
+		}
+		if err := enc.writeMillisecondTime(consumer.SeenTime); err != nil {
+			return err
+		}
+		ids := consumerPending[consumer.Name]
+		if err := enc.writeLength(uint64(len(ids))); err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := enc.write(encodeStreamID(id)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (dec *Decoder) readUint() (uint64, error) {
+	n, special, err := dec.readLength()
+	if err != nil {
+		return 0, err
+	}
+	if special {
+		return 0, errors.New("unexpected string encoding")
+	}
+	return n, nil
+}
+
+func (dec *Decoder) readStreamID() (StreamID, error) {
+	ms, err := dec.readUint()
+	if err != nil {
+		return StreamID{}, err
+	}
+	seq, err := dec.readUint()
+	if err != nil {
+		return StreamID{}, err
+	}
+	return StreamID{Ms: ms, Seq: seq}, nil
+}
+
+func (dec *Decoder) readRawStreamID() (StreamID, error) {
+	buf := make([]byte, 16)
+	if err := dec.readFull(buf); err != nil {
+		return StreamID{}, err
+	}
+	return decodeStreamID(buf)
+}
+
+func (dec *Decoder) readMillisecondTime() (time.Time, error) {
+	if err := dec.readFull(dec.buf[:8]); err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(int64(binary.LittleEndian.Uint64(dec.buf))), nil
+}
+
+// readStream reads stream of all 3 versions of redis
+func (dec *Decoder) readStream(objType byte) (*StreamData, error) {
+	nodes, err := dec.readCount()
+	if err != nil {
+		return nil, err
+	}
+	stream := &StreamData{}
+	for i := 0; i < nodes; i++ {
+		rawMaster, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		master, err := decodeStreamID(rawMaster)
+		if err != nil {
+			return nil, err
+		}
+		blob, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		entries, err := parseStreamListPack(master, blob)
+		if err != nil {
+			return nil, err
+		}
+		stream.Entries = append(stream.Entries, entries...)
+	}
+	length, err := dec.readUint()
+	if err != nil {
+		return nil, err
+	}
+	if stream.LastID, err = dec.readStreamID(); err != nil {
+		return nil, err
+	}
+	if objType == typeStreamListPacks {
+		// older versions don't record it, every entry is considered added once
+		stream.EntriesAdded = length
+	} else {
+		// first id can be found from entries
+		if _, err := dec.readStreamID(); err != nil {
+			return nil, err
+		}
+		if stream.MaxDeletedID, err = dec.readStreamID(); err != nil {
+			return nil, err
+		}
+		if stream.EntriesAdded, err = dec.readUint(); err != nil {
+			return nil, err
+		}
+	}
+	groupCount, err := dec.readCount()
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < groupCount; i++ {
+		group, err := dec.readStreamGroup(objType)
+		if err != nil {
+			return nil, err
+		}
+		stream.Groups = append(stream.Groups, group)
+	}
+	return stream, nil
+}
+
+func (dec *Decoder) readStreamGroup(objType byte) (*StreamGroup, error) {
+	name, err := dec.readString()
+	if err != nil {
+		return nil, err
+	}
+	group := &StreamGroup{Name: string(name)}
+	if group.LastID, err = dec.readStreamID(); err != nil {
+		return nil, err
+	}
+	if objType != typeStreamListPacks {
+		// entries read is only used to calculate lag
+		if _, err := dec.readUint(); err != nil {
+			return nil, err
+		}
+	}
+	pendingCount, err := dec.readCount()
+	if err != nil {
+		return nil, err
+	}
+	pendingMap := make(map[StreamID]*StreamPending, pendingCount)
+	for i := 0; i < pendingCount; i++ {
+		pending := &StreamPending{}
+		if pending.ID, err = dec.readRawStreamID(); err != nil {
+			return nil, err
+		}
+		if pending.DeliveryTime, err = dec.readMillisecondTime(); err != nil {
+			return nil, err
+		}
+		if pending.DeliveryCount, err = dec.readUint(); err != nil {
+			return nil, err
+		}
+		pendingMap[pending.ID] = pending
+		group.Pending = append(group.Pending, pending)
+	}
+	consumerCount, err := dec.readCount()
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < consumerCount; i++ {
+		name, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		consumer := &StreamConsumer{Name: string(name)}
+		if consumer.SeenTime, err = dec.readMillisecondTime(); err != nil {
+			return nil, err
+		}
+		if objType == typeStreamListPacks3 {
+			// active time is not supported
+			if _, err := dec.readMillisecondTime(); err != nil {
+				return nil, err
+			}
+		}
+		ownedCount, err := dec.readCount()
+		if err != nil {
+			return nil, err
+		}
+		for j := 0; j < ownedCount; j++ {
+			id, err := dec.readRawStreamID()
+			if err != nil {
+				return nil, err
+			}
+			pending, ok := pendingMap[id]
+			if !ok {
+				return nil, fmt.Errorf("consumer %s owns entry %d-%d not in PEL of group", name, id.Ms, id.Seq)
+			}
+			pending.Consumer = consumer.Name
+		}
+		group.Consumers = append(group.Consumers, consumer)
+	}
+	for _, pending := range group.Pending {
+		if pending.Consumer == "" {
+			return nil, fmt.Errorf("pending entry %d-%d of group %s has no consumer", pending.ID.Ms, pending.ID.Seq, name)
+		}
+	}
+	return group, nil
+}
@@ -114,7 +114,8 @@ func (tw *TimeWheel) tickHandler() {
 	} else {
 		tw.currentPos++
 	}
-	go tw.scanAndRunTask(l)
+	// slots and timer are only accessed by the goroutine of start, jobs still run in their own goroutines
+	tw.scanAndRunTask(l)
 }
 
 func (tw *TimeWheel) scanAndRunTask(l *list.List) {
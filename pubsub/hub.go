@@ -0,0 +1,33 @@
+package pubsub
+
+import (
+	"github.com/Allen9012/Godis/datastruct/dict"
+	"github.com/Allen9012/Godis/datastruct/lock"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/9/24
+  @desc: 订阅关系
+  @modified by:
+**/
+
+// Hub stores all subscribe relations
+type Hub struct {
+	// channel -> list(*Client)
+	subs dict.Dict
+	// pattern -> list(*Client)
+	psubs dict.Dict
+	// lock channel and pattern
+	subsLocker *lock.Locks
+}
+
+// MakeHub creates new hub
+func MakeHub() *Hub {
+	return &Hub{
+		subs:       dict.MakeConcurrent(4),
+		psubs:      dict.MakeConcurrent(4),
+		subsLocker: lock.Make(16),
+	}
+}
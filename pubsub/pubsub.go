@@ -0,0 +1,324 @@
+package pubsub
+
+import (
+	"github.com/Allen9012/Godis/datastruct/dict"
+	List "github.com/Allen9012/Godis/datastruct/list"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/interface/godis"
+	"github.com/Allen9012/Godis/lib/wildcard"
+	"strconv"
+	"strings"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/9/24
+  @desc: SUBSCRIBE/PSUBSCRIBE/PUBLISH/PUBSUB
+  @modified by:
+**/
+
+var (
+	_subscribe          = "subscribe"
+	_unsubscribe        = "unsubscribe"
+	_psubscribe         = "psubscribe"
+	_punsubscribe       = "punsubscribe"
+	messageBytes        = []byte("message")
+	pMessageBytes       = []byte("pmessage")
+	unSubscribeNothing  = []byte("*3\r\n$11\r\nunsubscribe\r\n$-1\r\n:0\r\n")
+	pUnSubscribeNothing = []byte("*3\r\n$12\r\npunsubscribe\r\n$-1\r\n:0\r\n")
+)
+
+// makeMsg 订阅/取消订阅的回复 eg: *3 subscribe ch 1
+func makeMsg(t string, channel string, code int64) []byte {
+	return []byte("*3\r\n$" + strconv.FormatInt(int64(len(t)), 10) + protocol.CRLF + t + protocol.CRLF +
+		"$" + strconv.FormatInt(int64(len(channel)), 10) + protocol.CRLF + channel + protocol.CRLF +
+		":" + strconv.FormatInt(code, 10) + protocol.CRLF)
+}
+
+// subscribe0 adds client to the subscriber list of key
+// return: is new subscribed
+func subscribe0(subs dict.Dict, key string, client godis.Connection) bool {
+	raw, ok := subs.Get(key)
+	var subscribers List.List
+	if ok {
+		subscribers, _ = raw.(List.List)
+	} else {
+		subscribers = List.NewQuickList()
+		subs.Put(key, subscribers)
+	}
+	if subscribers.Contains(func(a interface{}) bool {
+		return a == client
+	}) {
+		return false
+	}
+	subscribers.Add(client)
+	return true
+}
+
+// unsubscribe0 removes client from the subscriber list of key
+// return: is actually un-subscribe
+func unsubscribe0(subs dict.Dict, key string, client godis.Connection) bool {
+	raw, ok := subs.Get(key)
+	if !ok {
+		return false
+	}
+	subscribers, _ := raw.(List.List)
+	removed := subscribers.RemoveAllByVal(func(a interface{}) bool {
+		return a == client
+	})
+	if subscribers.Len() == 0 {
+		// clean
+		subs.Remove(key)
+	}
+	return removed > 0
+}
+
+// Subscribe puts the given connection into the given channel
+//
+//	@Description: SUBSCRIBE channel [channel ...]
+//	@param hub
+//	@param c
+//	@param args
+//	@return godis.Reply
+func Subscribe(hub *Hub, c godis.Connection, args [][]byte) godis.Reply {
+	channels := make([]string, len(args))
+	for i, b := range args {
+		channels[i] = string(b)
+	}
+
+	hub.subsLocker.Locks(channels...)
+	defer hub.subsLocker.UnLocks(channels...)
+
+	for _, channel := range channels {
+		if subscribe0(hub.subs, channel, c) {
+			c.Subscribe(channel)
+		}
+		_, _ = c.Write(makeMsg(_subscribe, channel, int64(c.SubsCount())))
+	}
+	return protocol.MakeNoReply()
+}
+
+// UnSubscribe removes the given connection from the given channel, or all channels if no channel given
+//
+//	@Description: UNSUBSCRIBE [channel [channel ...]]
+//	@param hub
+//	@param c
+//	@param args
+//	@return godis.Reply
+func UnSubscribe(hub *Hub, c godis.Connection, args [][]byte) godis.Reply {
+	var channels []string
+	if len(args) > 0 {
+		channels = make([]string, len(args))
+		for i, b := range args {
+			channels[i] = string(b)
+		}
+	} else {
+		channels = c.GetChannels()
+	}
+
+	hub.subsLocker.Locks(channels...)
+	defer hub.subsLocker.UnLocks(channels...)
+
+	if len(channels) == 0 {
+		_, _ = c.Write(unSubscribeNothing)
+		return protocol.MakeNoReply()
+	}
+
+	for _, channel := range channels {
+		if unsubscribe0(hub.subs, channel, c) {
+			c.UnSubscribe(channel)
+		}
+		_, _ = c.Write(makeMsg(_unsubscribe, channel, int64(c.SubsCount())))
+	}
+	return protocol.MakeNoReply()
+}
+
+// PSubscribe puts the given connection into the given patterns
+//
+//	@Description: PSUBSCRIBE pattern [pattern ...]
+//	@param hub
+//	@param c
+//	@param args
+//	@return godis.Reply
+func PSubscribe(hub *Hub, c godis.Connection, args [][]byte) godis.Reply {
+	patterns := make([]string, len(args))
+	for i, b := range args {
+		patterns[i] = string(b)
+	}
+
+	hub.subsLocker.Locks(patterns...)
+	defer hub.subsLocker.UnLocks(patterns...)
+
+	for _, pattern := range patterns {
+		if subscribe0(hub.psubs, pattern, c) {
+			c.PSubscribe(pattern)
+		}
+		_, _ = c.Write(makeMsg(_psubscribe, pattern, int64(c.SubsCount())))
+	}
+	return protocol.MakeNoReply()
+}
+
+// PUnSubscribe removes the given connection from the given patterns, or all patterns if no pattern given
+//
+//	@Description: PUNSUBSCRIBE [pattern [pattern ...]]
+//	@param hub
+//	@param c
+//	@param args
+//	@return godis.Reply
+func PUnSubscribe(hub *Hub, c godis.Connection, args [][]byte) godis.Reply {
+	var patterns []string
+	if len(args) > 0 {
+		patterns = make([]string, len(args))
+		for i, b := range args {
+			patterns[i] = string(b)
+		}
+	} else {
+		patterns = c.GetPatterns()
+	}
+
+	hub.subsLocker.Locks(patterns...)
+	defer hub.subsLocker.UnLocks(patterns...)
+
+	if len(patterns) == 0 {
+		_, _ = c.Write(pUnSubscribeNothing)
+		return protocol.MakeNoReply()
+	}
+
+	for _, pattern := range patterns {
+		if unsubscribe0(hub.psubs, pattern, c) {
+			c.PUnSubscribe(pattern)
+		}
+		_, _ = c.Write(makeMsg(_punsubscribe, pattern, int64(c.SubsCount())))
+	}
+	return protocol.MakeNoReply()
+}
+
+// UnsubscribeAll removes the given connection from all channels and patterns, used when client closed
+func UnsubscribeAll(hub *Hub, c godis.Connection) {
+	channels := c.GetChannels()
+	hub.subsLocker.Locks(channels...)
+	for _, channel := range channels {
+		unsubscribe0(hub.subs, channel, c)
+		c.UnSubscribe(channel)
+	}
+	hub.subsLocker.UnLocks(channels...)
+
+	patterns := c.GetPatterns()
+	hub.subsLocker.Locks(patterns...)
+	for _, pattern := range patterns {
+		unsubscribe0(hub.psubs, pattern, c)
+		c.PUnSubscribe(pattern)
+	}
+	hub.subsLocker.UnLocks(patterns...)
+}
+
+// Publish send msg to all subscribing client
+//
+//	@Description: PUBLISH channel message
+//	@param hub
+//	@param args
+//	@return godis.Reply 收到消息的客户端数量
+//	1. 发给订阅了channel的客户端
+//	2. 发给订阅了匹配channel的pattern的客户端
+func Publish(hub *Hub, args [][]byte) godis.Reply {
+	if len(args) != 2 {
+		return protocol.MakeArgNumErrReply("publish")
+	}
+	channel := string(args[0])
+	message := args[1]
+
+	var count int64
+	hub.subsLocker.Lock(channel)
+	raw, ok := hub.subs.Get(channel)
+	if ok {
+		subscribers, _ := raw.(List.List)
+		subscribers.ForEach(func(i int, c interface{}) bool {
+			client, _ := c.(godis.Connection)
+			replyArgs := make([][]byte, 3)
+			replyArgs[0] = messageBytes
+			replyArgs[1] = []byte(channel)
+			replyArgs[2] = message
+			_, _ = client.Write(protocol.MakeMultiBulkReply(replyArgs).ToBytes())
+			count++
+			return true
+		})
+	}
+	hub.subsLocker.UnLock(channel)
+
+	// 每个pattern单独加锁，避免和上面的channel锁嵌套
+	for _, pattern := range hub.psubs.Keys() {
+		if !wildcard.CompilePattern(pattern).IsMatch(channel) {
+			continue
+		}
+		hub.subsLocker.Lock(pattern)
+		raw, ok := hub.psubs.Get(pattern)
+		if ok {
+			subscribers, _ := raw.(List.List)
+			subscribers.ForEach(func(i int, c interface{}) bool {
+				client, _ := c.(godis.Connection)
+				replyArgs := make([][]byte, 4)
+				replyArgs[0] = pMessageBytes
+				replyArgs[1] = []byte(pattern)
+				replyArgs[2] = []byte(channel)
+				replyArgs[3] = message
+				_, _ = client.Write(protocol.MakeMultiBulkReply(replyArgs).ToBytes())
+				count++
+				return true
+			})
+		}
+		hub.subsLocker.UnLock(pattern)
+	}
+	return protocol.MakeIntReply(count)
+}
+
+// PubSub returns the state of the pub/sub subsystem
+//
+//	@Description: PUBSUB CHANNELS [pattern] | PUBSUB NUMSUB [channel [channel ...]] | PUBSUB NUMPAT
+//	@param hub
+//	@param args
+//	@return godis.Reply
+func PubSub(hub *Hub, args [][]byte) godis.Reply {
+	if len(args) == 0 {
+		return protocol.MakeArgNumErrReply("pubsub")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "channels":
+		if len(args) > 2 {
+			return protocol.MakeArgNumErrReply("pubsub|channels")
+		}
+		var pattern *wildcard.Pattern
+		if len(args) == 2 {
+			pattern = wildcard.CompilePattern(string(args[1]))
+		}
+		result := make([][]byte, 0)
+		for _, channel := range hub.subs.Keys() {
+			if pattern == nil || pattern.IsMatch(channel) {
+				result = append(result, []byte(channel))
+			}
+		}
+		return protocol.MakeMultiBulkReply(result)
+	case "numsub":
+		replies := make([]godis.Reply, 0, 2*(len(args)-1))
+		for _, arg := range args[1:] {
+			channel := string(arg)
+			var n int64
+			hub.subsLocker.RLock(channel)
+			raw, ok := hub.subs.Get(channel)
+			if ok {
+				subscribers, _ := raw.(List.List)
+				n = int64(subscribers.Len())
+			}
+			hub.subsLocker.RUnLock(channel)
+			replies = append(replies, protocol.MakeBulkReply(arg), protocol.MakeIntReply(n))
+		}
+		return protocol.MakeMultiRawReply(replies)
+	case "numpat":
+		if len(args) != 1 {
+			return protocol.MakeArgNumErrReply("pubsub|numpat")
+		}
+		return protocol.MakeIntReply(int64(hub.psubs.Len()))
+	}
+	return protocol.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try PUBSUB HELP.")
+}
@@ -0,0 +1,113 @@
+package pubsub
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/9/24
+  @desc: pubsub
+  @modified by:
+**/
+
+import (
+	"github.com/Allen9012/Godis/godis/connection"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/godis/protocol/asserts"
+	"github.com/Allen9012/Godis/interface/godis"
+	"github.com/Allen9012/Godis/lib/utils"
+	"testing"
+)
+
+func TestPublish(t *testing.T) {
+	hub := MakeHub()
+	channel := utils.RandString(5)
+	msg := utils.RandString(5)
+	conn := connection.NewFakeConn()
+	Subscribe(hub, conn, utils.ToCmdLine(channel))
+	conn.Clean() // clean subscribe success
+	result := Publish(hub, utils.ToCmdLine(channel, msg))
+	asserts.AssertIntReply(t, result, 1)
+	data := conn.Bytes()
+	expected := protocol.MakeMultiBulkReply(utils.ToCmdLine("message", channel, msg)).ToBytes()
+	if !utils.BytesEquals(data, expected) {
+		t.Errorf("wrong message response, expected %s, actually %s", expected, data)
+	}
+
+	// unsubscribe
+	UnSubscribe(hub, conn, utils.ToCmdLine(channel))
+	conn.Clean()
+	result = Publish(hub, utils.ToCmdLine(channel, msg))
+	asserts.AssertIntReply(t, result, 0)
+	if len(conn.Bytes()) > 0 {
+		t.Error("expect no msg")
+	}
+
+	// unsubscribe all
+	Subscribe(hub, conn, utils.ToCmdLine(channel))
+	UnSubscribe(hub, conn, utils.ToCmdLine())
+	conn.Clean()
+	Publish(hub, utils.ToCmdLine(channel, msg))
+	if len(conn.Bytes()) > 0 {
+		t.Error("expect no msg")
+	}
+	if conn.SubsCount() != 0 {
+		t.Error("expect no subscription")
+	}
+}
+
+func TestPSubscribe(t *testing.T) {
+	hub := MakeHub()
+	msg := utils.RandString(5)
+	conn := connection.NewFakeConn()
+	PSubscribe(hub, conn, utils.ToCmdLine("news.*"))
+	conn.Clean()
+	result := Publish(hub, utils.ToCmdLine("news.tech", msg))
+	asserts.AssertIntReply(t, result, 1)
+	expected := protocol.MakeMultiBulkReply(utils.ToCmdLine("pmessage", "news.*", "news.tech", msg)).ToBytes()
+	if !utils.BytesEquals(conn.Bytes(), expected) {
+		t.Errorf("wrong message response, expected %s, actually %s", expected, conn.Bytes())
+	}
+	conn.Clean()
+	result = Publish(hub, utils.ToCmdLine("sport", msg))
+	asserts.AssertIntReply(t, result, 0)
+
+	PUnSubscribe(hub, conn, utils.ToCmdLine())
+	result = Publish(hub, utils.ToCmdLine("news.tech", msg))
+	asserts.AssertIntReply(t, result, 0)
+}
+
+func TestUnsubscribeAll(t *testing.T) {
+	hub := MakeHub()
+	conn := connection.NewFakeConn()
+	Subscribe(hub, conn, utils.ToCmdLine("a", "b"))
+	PSubscribe(hub, conn, utils.ToCmdLine("c*"))
+	UnsubscribeAll(hub, conn)
+	result := Publish(hub, utils.ToCmdLine("a", "msg"))
+	asserts.AssertIntReply(t, result, 0)
+	result = Publish(hub, utils.ToCmdLine("c1", "msg"))
+	asserts.AssertIntReply(t, result, 0)
+	result = PubSub(hub, utils.ToCmdLine("numpat"))
+	asserts.AssertIntReply(t, result, 0)
+}
+
+func TestPubSubIntrospection(t *testing.T) {
+	hub := MakeHub()
+	conn1 := connection.NewFakeConn()
+	conn2 := connection.NewFakeConn()
+	Subscribe(hub, conn1, utils.ToCmdLine("news", "sport"))
+	Subscribe(hub, conn2, utils.ToCmdLine("news"))
+	PSubscribe(hub, conn2, utils.ToCmdLine("n*", "s*"))
+
+	result := PubSub(hub, utils.ToCmdLine("channels", "n*"))
+	asserts.AssertMultiBulkReply(t, result, []string{"news"})
+	result = PubSub(hub, utils.ToCmdLine("numsub", "news", "sport", "none"))
+	expected := protocol.MakeMultiRawReply([]godis.Reply{
+		protocol.MakeBulkReply([]byte("news")), protocol.MakeIntReply(2),
+		protocol.MakeBulkReply([]byte("sport")), protocol.MakeIntReply(1),
+		protocol.MakeBulkReply([]byte("none")), protocol.MakeIntReply(0),
+	}).ToBytes()
+	if !utils.BytesEquals(result.ToBytes(), expected) {
+		t.Errorf("wrong numsub response, expected %s, actually %s", expected, result.ToBytes())
+	}
+	result = PubSub(hub, utils.ToCmdLine("numpat"))
+	asserts.AssertIntReply(t, result, 2)
+}
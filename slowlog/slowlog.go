@@ -0,0 +1,205 @@
+package slowlog
+
+import (
+	"container/list"
+	"github.com/Allen9012/Godis/config"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/interface/godis"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/18
+  @desc: SLOWLOG GET | LEN | RESET
+	执行时间超过 slowlog-log-slower-than 微秒的命令会被记录, 最多保留 slowlog-max-len 条
+  @modified by:
+**/
+
+const (
+	// at most maxArgc arguments of a command are logged
+	maxArgc = 32
+	// arguments longer than maxArgLen are truncated
+	maxArgLen = 128
+	// default count of SLOWLOG GET
+	defaultGetCount = 10
+)
+
+// Entry is a logged slow command
+type Entry struct {
+	ID         int64
+	Time       time.Time
+	Duration   time.Duration
+	Args       [][]byte
+	ClientAddr string
+	ClientName string
+}
+
+// SlowLog holds the latest slow commands
+type SlowLog struct {
+	mu sync.Mutex
+	// newest entry at front
+	entries *list.List
+	nextID  int64
+}
+
+// MakeSlowLog creates an empty SlowLog
+func MakeSlowLog() *SlowLog {
+	return &SlowLog{
+		entries: list.New(),
+	}
+}
+
+// Record logs the command if its duration exceeds slowlog-log-slower-than
+//
+//	@Description: 参数会被复制和截断, 调用方可以继续复用 cmdLine
+//	@receiver log
+//	@param c	执行命令的客户端, 可以为 nil
+//	@param cmdLine
+//	@param start	命令开始执行的时间
+//	@param duration
+func (log *SlowLog) Record(c godis.Connection, cmdLine [][]byte, start time.Time, duration time.Duration) {
+	threshold := config.Get(&config.Properties.SlowlogLogSlowerThan)
+	if threshold < 0 || duration.Microseconds() < int64(threshold) {
+		return
+	}
+	entry := &Entry{
+		Time:     start,
+		Duration: duration,
+		Args:     truncateArgs(cmdLine),
+	}
+	if c != nil {
+		entry.ClientAddr = c.RemoteAddr()
+		entry.ClientName = c.GetName()
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	entry.ID = log.nextID
+	log.nextID++
+	log.entries.PushFront(entry)
+	log.trim(config.Get(&config.Properties.SlowlogMaxLen))
+}
+
+// trim removes the oldest entries until there are at most maxLen entries, invoker should hold lock
+func (log *SlowLog) trim(maxLen int) {
+	if maxLen < 0 {
+		maxLen = 0
+	}
+	for log.entries.Len() > maxLen {
+		log.entries.Remove(log.entries.Back())
+	}
+}
+
+// truncateArgs copies arguments like redis, eg: [set key "aaa... (1000 more bytes)"]
+func truncateArgs(cmdLine [][]byte) [][]byte {
+	argc := len(cmdLine)
+	if argc > maxArgc {
+		argc = maxArgc
+	}
+	args := make([][]byte, argc)
+	for i := 0; i < argc; i++ {
+		if i == maxArgc-1 && len(cmdLine) > maxArgc {
+			args[i] = []byte("... (" + strconv.Itoa(len(cmdLine)-maxArgc+1) + " more arguments)")
+			break
+		}
+		arg := cmdLine[i]
+		if len(arg) > maxArgLen {
+			args[i] = append(append([]byte{}, arg[:maxArgLen]...),
+				"... ("+strconv.Itoa(len(arg)-maxArgLen)+" more bytes)"...)
+			continue
+		}
+		args[i] = append([]byte{}, arg...)
+	}
+	return args
+}
+
+// Get returns at most count newest entries, negative count means all entries
+func (log *SlowLog) Get(count int) []*Entry {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	log.trim(config.Get(&config.Properties.SlowlogMaxLen))
+	var entries []*Entry
+	for e := log.entries.Front(); e != nil && (count < 0 || len(entries) < count); e = e.Next() {
+		entries = append(entries, e.Value.(*Entry))
+	}
+	return entries
+}
+
+// Len returns the number of logged entries
+func (log *SlowLog) Len() int {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	log.trim(config.Get(&config.Properties.SlowlogMaxLen))
+	return log.entries.Len()
+}
+
+// Reset removes all entries
+func (log *SlowLog) Reset() {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	log.entries.Init()
+}
+
+// Exec
+//
+//	@Description: SLOWLOG GET [count] | SLOWLOG LEN | SLOWLOG RESET
+//	@param log
+//	@param args
+//	@return godis.Reply
+func Exec(log *SlowLog, args [][]byte) godis.Reply {
+	if len(args) == 0 {
+		return protocol.MakeArgNumErrReply("slowlog")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "get":
+		if len(args) > 2 {
+			return protocol.MakeArgNumErrReply("slowlog|get")
+		}
+		count := defaultGetCount
+		if len(args) == 2 {
+			n, err := strconv.Atoi(string(args[1]))
+			if err != nil || n < -1 {
+				return protocol.MakeErrReply("ERR count should be greater than or equal to -1")
+			}
+			count = n
+		}
+		entries := log.Get(count)
+		replies := make([]godis.Reply, 0, len(entries))
+		for _, entry := range entries {
+			replies = append(replies, protocol.MakeMultiRawReply([]godis.Reply{
+				protocol.MakeIntReply(entry.ID),
+				protocol.MakeIntReply(entry.Time.Unix()),
+				protocol.MakeIntReply(entry.Duration.Microseconds()),
+				protocol.MakeMultiBulkReply(entry.Args),
+				makeStringReply(entry.ClientAddr),
+				makeStringReply(entry.ClientName),
+			}))
+		}
+		return protocol.MakeMultiRawReply(replies)
+	case "len":
+		if len(args) != 1 {
+			return protocol.MakeArgNumErrReply("slowlog|len")
+		}
+		return protocol.MakeIntReply(int64(log.Len()))
+	case "reset":
+		if len(args) != 1 {
+			return protocol.MakeArgNumErrReply("slowlog|reset")
+		}
+		log.Reset()
+		return protocol.MakeOkReply()
+	}
+	return protocol.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try SLOWLOG HELP.")
+}
+
+// makeStringReply returns bulk reply of s, empty s is encoded as empty string like redis instead of null bulk
+func makeStringReply(s string) godis.Reply {
+	if s == "" {
+		return protocol.MakeEmptyBulkReply()
+	}
+	return protocol.MakeBulkReply([]byte(s))
+}
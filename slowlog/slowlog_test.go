@@ -0,0 +1,114 @@
+package slowlog
+
+/**
+  Copyright © 2023 github.com/Allen9012 All rights reserved.
+  @author: Allen
+  @since: 2023/10/18
+  @desc: slow log
+  @modified by:
+**/
+
+import (
+	"github.com/Allen9012/Godis/config"
+	"github.com/Allen9012/Godis/godis/connection"
+	"github.com/Allen9012/Godis/godis/protocol"
+	"github.com/Allen9012/Godis/godis/protocol/asserts"
+	"github.com/Allen9012/Godis/interface/godis"
+	"github.com/Allen9012/Godis/lib/utils"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setSlowLogConfig(slowerThan int, maxLen int) func() {
+	config.Properties.SlowlogLogSlowerThan = slowerThan
+	config.Properties.SlowlogMaxLen = maxLen
+	return func() {
+		config.Properties.SlowlogLogSlowerThan = 10000
+		config.Properties.SlowlogMaxLen = 128
+	}
+}
+
+func TestRecord(t *testing.T) {
+	defer setSlowLogConfig(1000, 3)()
+	log := MakeSlowLog()
+	conn := connection.NewFakeConn()
+	conn.SetName("conn1")
+	now := time.Now()
+	log.Record(conn, utils.ToCmdLine("get", "fast"), now, 999*time.Microsecond)
+	if log.Len() != 0 {
+		t.Fatal("fast command should not be logged")
+	}
+	for i := 0; i < 5; i++ {
+		log.Record(conn, utils.ToCmdLine("get", strconv.Itoa(i)), now, time.Millisecond)
+	}
+	result := Exec(log, utils.ToCmdLine("len"))
+	asserts.AssertIntReply(t, result, 3)
+
+	entries := log.Get(-1)
+	if len(entries) != 3 || entries[0].ID != 4 || string(entries[0].Args[1]) != "4" || entries[2].ID != 2 {
+		t.Fatal("expect newest 3 entries")
+	}
+	if entries[0].Duration != time.Millisecond || entries[0].ClientName != "conn1" {
+		t.Errorf("wrong entry %+v", entries[0])
+	}
+	result = Exec(log, utils.ToCmdLine("get", "1"))
+	expected := protocol.MakeMultiRawReply([]godis.Reply{
+		protocol.MakeMultiRawReply([]godis.Reply{
+			protocol.MakeIntReply(4),
+			protocol.MakeIntReply(now.Unix()),
+			protocol.MakeIntReply(1000),
+			protocol.MakeMultiBulkReply(utils.ToCmdLine("get", "4")),
+			protocol.MakeEmptyBulkReply(),
+			protocol.MakeBulkReply([]byte("conn1")),
+		}),
+	})
+	if string(result.ToBytes()) != string(expected.ToBytes()) {
+		t.Errorf("expect %s, actual %s", string(expected.ToBytes()), string(result.ToBytes()))
+	}
+	// empty address and name are empty strings instead of null bulk
+	log.Record(nil, utils.ToCmdLine("get", "k"), now, time.Millisecond)
+	result = Exec(log, utils.ToCmdLine("get", "1"))
+	if !strings.HasSuffix(string(result.ToBytes()), "$0\r\n\r\n$0\r\n\r\n") {
+		t.Errorf("wrong empty client fields: %q", result.ToBytes())
+	}
+
+	// slowlog-max-len may be reduced during runtime
+	config.Properties.SlowlogMaxLen = 1
+	asserts.AssertIntReply(t, Exec(log, utils.ToCmdLine("len")), 1)
+	asserts.AssertStatusReply(t, Exec(log, utils.ToCmdLine("reset")), "OK")
+	asserts.AssertIntReply(t, Exec(log, utils.ToCmdLine("len")), 0)
+}
+
+func TestDisabled(t *testing.T) {
+	defer setSlowLogConfig(-1, 128)()
+	log := MakeSlowLog()
+	log.Record(nil, utils.ToCmdLine("get", "k"), time.Now(), time.Hour)
+	if log.Len() != 0 {
+		t.Error("negative slowlog-log-slower-than should disable slow log")
+	}
+}
+
+func TestTruncateArgs(t *testing.T) {
+	cmdLine := [][]byte{[]byte("set"), []byte("k"), []byte(strings.Repeat("a", 200))}
+	args := truncateArgs(cmdLine)
+	if string(args[2]) != strings.Repeat("a", maxArgLen)+"... (72 more bytes)" {
+		t.Errorf("wrong truncated arg %s", string(args[2]))
+	}
+	cmdLine = [][]byte{[]byte("sadd"), []byte("k")}
+	for i := 0; i < 40; i++ {
+		cmdLine = append(cmdLine, []byte(strconv.Itoa(i)))
+	}
+	args = truncateArgs(cmdLine)
+	if len(args) != maxArgc || string(args[maxArgc-1]) != "... (11 more arguments)" {
+		t.Errorf("wrong truncated args %d %s", len(args), string(args[len(args)-1]))
+	}
+	// args should be copied
+	cmdLine[0][0] = 'S'
+	if string(args[0]) != "sadd" {
+		t.Error("args should be copied")
+	}
+	asserts.AssertErrReply(t, Exec(MakeSlowLog(), utils.ToCmdLine("get", "-2")),
+		"ERR count should be greater than or equal to -1")
+}
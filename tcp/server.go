@@ -3,6 +3,7 @@ package tcp
 import (
 	"context"
 	"fmt"
+	"github.com/Allen9012/Godis/config"
 	"github.com/Allen9012/Godis/interface/tcp"
 	"github.com/Allen9012/Godis/lib/logger"
 	"net"
@@ -10,6 +11,7 @@ import (
 	"os/signal"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -22,8 +24,8 @@ type Config struct {
 	Timeout    time.Duration `yaml:"timeout"`
 }
 
-// ClientCounter Record the number of clients in the current godis server
-var ClientCounter int
+// ClientCounter Record the number of clients in the current godis server, use atomic to access
+var ClientCounter int32
 
 // ListenAndServeWithSignal 启动服务
 func ListenAndServeWithSignal(config *Config, handler tcp.Handler) error {
@@ -102,14 +104,20 @@ func ListenAndServe(listener net.Listener, handler tcp.Handler, closeChan <-chan
 			errCh <- err
 			break
 		}
+		// maxclients may be changed by CONFIG SET
+		if maxClients := config.Get(&config.Properties.MaxClients); maxClients > 0 && int(atomic.LoadInt32(&ClientCounter)) >= maxClients {
+			_, _ = conn.Write([]byte("-ERR max number of clients reached\r\n"))
+			_ = conn.Close()
+			continue
+		}
 		// handle
 		logger.Info("accepted link")
-		ClientCounter++
+		atomic.AddInt32(&ClientCounter, 1)
 		wg.Add(1)
 		go func() {
 			defer func() {
 				wg.Done()
-				ClientCounter--
+				atomic.AddInt32(&ClientCounter, -1)
 			}()
 			// 一个协程连接执行完就wait_group -1
 			handler.Handle(ctx, conn)